@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/identity"
+	"github.com/spf13/cobra"
+)
+
+// newIdentityCmd builds the "identity" command group for managing the relay key
+func newIdentityCmd() *cobra.Command {
+	identityCmd := &cobra.Command{
+		Use:   "identity",
+		Short: "Manage the relay identity key",
+		Long:  "Show, import and export the relay's secp256k1 identity key and per-tenant keys",
+	}
+	identityCmd.PersistentFlags().StringP("tenant", "t", identity.DefaultTenantName, "Virtual relay whose identity to manage")
+
+	showCmd := &cobra.Command{
+		Use:   "show",
+		Short: "Show the relay public key and key file location",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := requireFileBackend(); err != nil {
+				return err
+			}
+			tenant, _ := cmd.Flags().GetString("tenant")
+			relayIdentity, err := tenantIdentity(tenant)
+			if err != nil {
+				return err
+			}
+			path, err := tenantKeyPath(tenant)
+			if err != nil {
+				return err
+			}
+			npub, err := relayIdentity.Npub()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Relay ID:   %s\n", relayIdentity.RelayID)
+			fmt.Printf("Public key: %s\n", relayIdentity.PublicKey)
+			fmt.Printf("npub:       %s\n", npub)
+			fmt.Printf("Key file:   %s\n", path)
+			fmt.Printf("Encrypted:  %t\n", identity.Encrypted())
+			return nil
+		},
+	}
+
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the relay key as npub, nsec or hex",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := requireFileBackend(); err != nil {
+				return err
+			}
+			format, _ := cmd.Flags().GetString("format")
+			tenant, _ := cmd.Flags().GetString("tenant")
+			relayIdentity, err := tenantIdentity(tenant)
+			if err != nil {
+				return err
+			}
+
+			var out string
+			switch format {
+			case "npub":
+				out, err = relayIdentity.Npub()
+			case "nsec":
+				out, err = relayIdentity.Nsec()
+			case "hex":
+				out = relayIdentity.PublicKey
+			case "hex-private":
+				out = relayIdentity.PrivateKey
+			default:
+				return fmt.Errorf("unknown format %q (use npub, nsec, hex or hex-private)", format)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Println(out)
+			return nil
+		},
+	}
+	exportCmd.Flags().StringP("format", "f", "npub", "Output format: npub, nsec, hex or hex-private")
+
+	importCmd := &cobra.Command{
+		Use:   "import <nsec|hex>",
+		Short: "Import an existing nsec or hex private key as the relay identity",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := requireFileBackend(); err != nil {
+				return err
+			}
+			force, _ := cmd.Flags().GetBool("force")
+			tenant, _ := cmd.Flags().GetString("tenant")
+			keyring, err := identity.DefaultKeyring()
+			if err != nil {
+				return err
+			}
+			relayIdentity, err := keyring.Import(tenant, args[0], force)
+			if err != nil {
+				return err
+			}
+			path, _ := tenantKeyPath(tenant)
+			fmt.Printf("Imported relay identity %s into %s\n", relayIdentity.PublicKey, path)
+			return nil
+		},
+	}
+	importCmd.Flags().Bool("force", false, "Replace an existing identity file holding a different key")
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the tenants in the identity keyring and their public keys",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := requireFileBackend(); err != nil {
+				return err
+			}
+			keyring, err := identity.DefaultKeyring()
+			if err != nil {
+				return err
+			}
+			names, err := keyring.Names()
+			if err != nil {
+				return err
+			}
+			for _, name := range names {
+				relayIdentity, err := keyring.Get(name)
+				if err != nil {
+					fmt.Printf("%-20s error: %v\n", name, err)
+					continue
+				}
+				fmt.Printf("%-20s %s\n", name, relayIdentity.PublicKey)
+			}
+			return nil
+		},
+	}
+
+	rotateCmd := &cobra.Command{
+		Use:   "rotate",
+		Short: "Replace the relay key, keeping the old one for a grace period",
+		Long: "Generate a new relay key. The old key is kept for the grace period, both keys sign a\n" +
+			"rotation statement and NIP-11 advertises the previous key until the grace period ends.\n" +
+			"Restart the relay to start signing with the new key.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := requireFileBackend(); err != nil {
+				return err
+			}
+			grace, _ := cmd.Flags().GetDuration("grace")
+			if grace <= 0 {
+				return fmt.Errorf("grace period must be positive")
+			}
+			rotation, err := identity.RotateRelayIdentity(grace)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Previous key: %s\n", rotation.PreviousPubKey)
+			fmt.Printf("New key:      %s\n", rotation.PubKey)
+			fmt.Printf("Grace until:  %s\n", time.Unix(rotation.GraceUntil, 0).UTC().Format(time.RFC3339))
+			fmt.Println("Restart the relay to start using the new key.")
+			return nil
+		},
+	}
+	rotateCmd.Flags().Duration("grace", identity.DefaultRotationGracePeriod, "How long the previous key stays advertised")
+
+	identityCmd.AddCommand(showCmd, exportCmd, importCmd, listCmd, rotateCmd)
+	return identityCmd
+}
+
+// requireFileBackend rejects key file commands when the relay key lives in the database
+func requireFileBackend() error {
+	if cfg != nil && cfg.Identity.Backend == identity.BackendDatabase {
+		return fmt.Errorf("the relay key is stored in the database (IDENTITY.BACKEND=database); " +
+			"set IDENTITY.IMPORT_KEY to seed it and check the relay logs or NIP-11 for its public key")
+	}
+	return nil
+}
+
+// tenantIdentity loads (or creates) the identity of a tenant from the keyring
+func tenantIdentity(tenant string) (*identity.RelayIdentity, error) {
+	keyring, err := identity.DefaultKeyring()
+	if err != nil {
+		return nil, err
+	}
+	return keyring.GetOrCreate(tenant)
+}
+
+// tenantKeyPath returns the key file backing a tenant's identity
+func tenantKeyPath(tenant string) (string, error) {
+	if identity.IsDefaultTenant(tenant) {
+		return identity.KeyFilePath()
+	}
+	keyring, err := identity.DefaultKeyring()
+	if err != nil {
+		return "", err
+	}
+	return keyring.KeyPath(tenant), nil
+}
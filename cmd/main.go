@@ -57,6 +57,10 @@ func main() {
 	if needsBlocking {
 		// Block the main goroutine until the context is canceled
 		<-ctx.Done()
+		// Let the node drain its connections and finish shutting down
+		if shutdownDone != nil {
+			<-shutdownDone
+		}
 
 		// Perform any cleanup (if needed) before exiting
 		logger.Info("Node has shut down successfully.")
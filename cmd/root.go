@@ -9,6 +9,7 @@ import (
 
 	"github.com/Shugur-Network/relay/internal/application"
 	"github.com/Shugur-Network/relay/internal/config"
+	"github.com/Shugur-Network/relay/internal/identity"
 	"github.com/Shugur-Network/relay/internal/logger"
 	"github.com/Shugur-Network/relay/internal/metrics"
 	"go.uber.org/zap"
@@ -19,6 +20,9 @@ import (
 var (
 	cfgFile string         // Path to custom config file (optional)
 	cfg     *config.Config // Global reference to loaded configuration
+
+	// shutdownDone is closed once the started relay finished shutting down
+	shutdownDone chan struct{}
 )
 
 // rootCmd defines the main CLI command for shugur relay
@@ -59,6 +63,11 @@ var rootCmd = &cobra.Command{
 			cfg.Metrics.Port, _ = strconv.Atoi(portStr)
 		}
 
+		// Point the identity package at the configured key file and passphrase
+		if err := identity.Configure(cfg.Identity); err != nil {
+			return err
+		}
+
 		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
@@ -147,6 +156,27 @@ func init() {
 			// Initialize metrics
 			metrics.RegisterMetrics()
 
+			// Drop the previous relay key once a rotation's grace period is over
+			if pruned, err := identity.PruneKeyRotation(); err != nil {
+				logger.Warn("Failed to prune expired key rotation", zap.Error(err))
+			} else if pruned {
+				logger.Info("Key rotation grace period ended, previous relay key removed")
+			}
+
+			// Verify the operator's NIP-05 linkage (non-fatal)
+			if cfg.Relay.OperatorPubKey != "" {
+				status := identity.VerifyOperator(ctx, cfg.Relay.OperatorPubKey, cfg.Relay.OperatorNIP05)
+				if cfg.Relay.OperatorNIP05 != "" && !status.Verified {
+					logger.Warn("Operator NIP-05 verification failed",
+						zap.String("nip05", status.NIP05),
+						zap.String("error", status.Error))
+				} else {
+					logger.Info("Operator configured",
+						zap.String("pubkey", status.PubKey),
+						zap.Bool("nip05_verified", status.Verified))
+				}
+			}
+
 			// Initialize the application/relay
 			logger.Info("Starting relay...")
 			app, err := application.New(ctx, cfg, nil)
@@ -155,8 +185,20 @@ func init() {
 				os.Exit(1)
 			}
 
+			// Initialize the relay signer (key file, database or external signer)
+			signer, err := identity.InitSigner(ctx, cfg.Identity)
+			if err != nil {
+				logger.Error("Failed to initialize relay signer", zap.Error(err))
+				os.Exit(1)
+			}
+			logger.Info("Relay signer ready",
+				zap.String("signer", signer.Kind()),
+				zap.String("pubkey", signer.PublicKey()))
+
 			// Set up graceful shutdown handling
+			shutdownDone = make(chan struct{})
 			go func() {
+				defer close(shutdownDone)
 				<-ctx.Done() // Wait for cancellation signal
 				logger.Info("Shutdown signal received, initiating graceful shutdown...")
 				app.Shutdown() // Call the enhanced shutdown method
@@ -173,4 +215,5 @@ func init() {
 	}
 
 	rootCmd.AddCommand(startCmd)
+	rootCmd.AddCommand(newIdentityCmd())
 }
@@ -0,0 +1,311 @@
+// Package analytics aggregates the filters of the REQs a node serves: which
+// kinds and authors are asked for, how selective the filters are and how often
+// the in-memory read paths answer them, so indexes and retention can be chosen
+// to match what clients actually read.
+package analytics
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	nostr "github.com/nbd-wtf/go-nostr"
+)
+
+// Source is the read path that answered a REQ
+type Source int
+
+// Read paths
+const (
+	// Live is the ring of recently ingested events
+	Live Source = iota
+	// Cache is the recent events cache of common kinds
+	Cache
+	Database
+	numSources
+)
+
+// sourceNames are the names sources are reported under
+var sourceNames = [numSources]string{
+	Live:     "live",
+	Cache:    "cache",
+	Database: "database",
+}
+
+// String returns the name source is reported under
+func (s Source) String() string {
+	return sourceNames[s]
+}
+
+// Breadths of a filter, by its most selective condition. Filters by ids,
+// authors or tags read few rows through an index; filters by kinds alone, or
+// by nothing, scan.
+const (
+	ByIDs     = "ids"
+	ByAuthors = "authors"
+	ByTags    = "tags"
+	ByKinds   = "kinds"
+	Open      = "open"
+)
+
+// Breadth returns the breadth of f
+func Breadth(f nostr.Filter) string {
+	switch {
+	case len(f.IDs) > 0:
+		return ByIDs
+	case len(f.Authors) > 0:
+		return ByAuthors
+	case len(f.Tags) > 0:
+		return ByTags
+	case len(f.Kinds) > 0:
+		return ByKinds
+	}
+	return Open
+}
+
+// Normalize returns the shape of f: the conditions it sets, with its kinds and
+// tag names sorted but without the values it matches, so REQs for different
+// authors or events count as the same filter
+func Normalize(f nostr.Filter) string {
+	var parts []string
+	if len(f.IDs) > 0 {
+		parts = append(parts, "ids")
+	}
+	if len(f.Authors) > 0 {
+		parts = append(parts, "authors")
+	}
+	if len(f.Kinds) > 0 {
+		kinds := append([]int(nil), f.Kinds...)
+		sort.Ints(kinds)
+		names := make([]string, 0, len(kinds))
+		for i, kind := range kinds {
+			if i == 0 || kind != kinds[i-1] {
+				names = append(names, strconv.Itoa(kind))
+			}
+		}
+		parts = append(parts, "kinds="+strings.Join(names, ","))
+	}
+	if len(f.Tags) > 0 {
+		names := make([]string, 0, len(f.Tags))
+		for name := range f.Tags {
+			names = append(names, "#"+name)
+		}
+		sort.Strings(names)
+		parts = append(parts, names...)
+	}
+	if f.Since != nil {
+		parts = append(parts, "since")
+	}
+	if f.Until != nil {
+		parts = append(parts, "until")
+	}
+	if f.Search != "" {
+		parts = append(parts, "search")
+	}
+	if len(parts) == 0 {
+		return Open
+	}
+	return strings.Join(parts, " ")
+}
+
+// counts tallies keys, keeping at most max of them. Once full, the less
+// frequent half is dropped, so the counts of the keys kept are a lower bound.
+type counts[K comparable] struct {
+	max    int
+	counts map[K]int64
+}
+
+func newCounts[K comparable](max int) *counts[K] {
+	return &counts[K]{max: max, counts: make(map[K]int64)}
+}
+
+// add counts key once
+func (c *counts[K]) add(key K) {
+	if _, ok := c.counts[key]; !ok && len(c.counts) >= c.max {
+		c.prune()
+	}
+	c.counts[key]++
+}
+
+// prune drops the less frequent half of the keys
+func (c *counts[K]) prune() {
+	top := c.top(c.max / 2)
+	c.counts = make(map[K]int64, c.max)
+	for _, e := range top {
+		c.counts[e.key] = e.count
+	}
+}
+
+type entry[K comparable] struct {
+	key   K
+	count int64
+}
+
+// top returns the n most frequent keys, highest count first
+func (c *counts[K]) top(n int) []entry[K] {
+	entries := make([]entry[K], 0, len(c.counts))
+	for key, count := range c.counts {
+		entries = append(entries, entry[K]{key, count})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].count > entries[j].count })
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+// Recorder aggregates the REQ filters served by this node since it started or
+// was last reset. A nil recorder records nothing.
+type Recorder struct {
+	mu       sync.Mutex
+	since    time.Time
+	requests int64
+	kinds    *counts[int]
+	authors  *counts[string]
+	filters  *counts[string]
+	breadth  map[string]int64
+	sources  [numSources]int64
+	// maxKeys bounds the kinds, authors and filter shapes tallied
+	maxKeys int
+}
+
+// NewRecorder returns a recorder tallying at most maxKeys kinds, authors and
+// filter shapes each
+func NewRecorder(maxKeys int) *Recorder {
+	r := &Recorder{maxKeys: maxKeys}
+	r.Reset()
+	return r
+}
+
+// Reset forgets everything recorded
+func (r *Recorder) Reset() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.since = time.Now().UTC()
+	r.requests = 0
+	r.kinds = newCounts[int](r.maxKeys)
+	r.authors = newCounts[string](r.maxKeys)
+	r.filters = newCounts[string](r.maxKeys)
+	r.breadth = make(map[string]int64)
+	r.sources = [numSources]int64{}
+}
+
+// Record counts a REQ for f answered from source
+func (r *Recorder) Record(f nostr.Filter, source Source) {
+	if r == nil {
+		return
+	}
+	shape, breadth := Normalize(f), Breadth(f)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests++
+	seenKinds := make(map[int]bool, len(f.Kinds))
+	for _, kind := range f.Kinds {
+		if !seenKinds[kind] {
+			seenKinds[kind] = true
+			r.kinds.add(kind)
+		}
+	}
+	seenAuthors := make(map[string]bool, len(f.Authors))
+	for _, author := range f.Authors {
+		if author = strings.ToLower(author); !seenAuthors[author] {
+			seenAuthors[author] = true
+			r.authors.add(author)
+		}
+	}
+	r.filters.add(shape)
+	r.breadth[breadth]++
+	r.sources[source]++
+}
+
+// KindCount is how many REQs asked for a kind
+type KindCount struct {
+	Kind     int   `json:"kind"`
+	Requests int64 `json:"requests"`
+}
+
+// AuthorCount is how many REQs asked for an author
+type AuthorCount struct {
+	PubKey   string `json:"pubkey"`
+	Requests int64  `json:"requests"`
+}
+
+// FilterCount is how many REQs had a filter shape
+type FilterCount struct {
+	Filter   string `json:"filter"`
+	Requests int64  `json:"requests"`
+}
+
+// Report summarizes the REQs recorded since Since
+type Report struct {
+	Since    time.Time     `json:"since"`
+	Requests int64         `json:"requests"`
+	Kinds    []KindCount   `json:"top_kinds"`
+	Authors  []AuthorCount `json:"top_authors"`
+	Filters  []FilterCount `json:"top_filters"`
+	// Breadth counts REQs by their most selective condition, and Narrow and
+	// Broad sum the ones read through an index and the ones scanning
+	Breadth map[string]int64 `json:"breadth"`
+	Narrow  int64            `json:"narrow"`
+	Broad   int64            `json:"broad"`
+	// Sources counts REQs by the read path that answered them, and HitRates
+	// are the shares of the in-memory ones
+	Sources  map[string]int64   `json:"sources"`
+	HitRates map[string]float64 `json:"hit_rates"`
+}
+
+// Report returns the top n kinds, authors and filter shapes with the rest of
+// what was recorded
+func (r *Recorder) Report(n int) Report {
+	if r == nil {
+		return Report{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := Report{
+		Since:    r.since,
+		Requests: r.requests,
+		Kinds:    []KindCount{},
+		Authors:  []AuthorCount{},
+		Filters:  []FilterCount{},
+		Breadth:  make(map[string]int64, len(r.breadth)),
+		Sources:  make(map[string]int64, numSources),
+		HitRates: make(map[string]float64, 2),
+	}
+	for _, e := range r.kinds.top(n) {
+		report.Kinds = append(report.Kinds, KindCount{Kind: e.key, Requests: e.count})
+	}
+	for _, e := range r.authors.top(n) {
+		report.Authors = append(report.Authors, AuthorCount{PubKey: e.key, Requests: e.count})
+	}
+	for _, e := range r.filters.top(n) {
+		report.Filters = append(report.Filters, FilterCount{Filter: e.key, Requests: e.count})
+	}
+	for breadth, count := range r.breadth {
+		report.Breadth[breadth] = count
+		switch breadth {
+		case ByIDs, ByAuthors, ByTags:
+			report.Narrow += count
+		default:
+			report.Broad += count
+		}
+	}
+	for source, count := range r.sources {
+		report.Sources[Source(source).String()] = count
+	}
+	for _, source := range []Source{Live, Cache} {
+		rate := 0.0
+		if r.requests > 0 {
+			rate = float64(r.sources[source]) / float64(r.requests)
+		}
+		report.HitRates[source.String()] = rate
+	}
+	return report
+}
@@ -0,0 +1,207 @@
+package application
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/blocklist"
+	"github.com/Shugur-Network/relay/internal/config"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// blocklistFetchTimeout bounds the download of one blocklist feed
+const blocklistFetchTimeout = time.Minute
+
+// runURLBlocklistSync syncs the URL blocklist feeds at startup and then every
+// RELAY_POLICY.URL_BLOCKLIST.REFRESH_INTERVAL
+func (n *Node) runURLBlocklistSync(ctx context.Context) {
+	client := &http.Client{Timeout: blocklistFetchTimeout}
+	n.syncURLBlocklist(ctx, client)
+
+	interval := n.config.RelayPolicy.URLBlocklist.RefreshInterval
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n.syncURLBlocklist(ctx, client)
+		}
+	}
+}
+
+// syncURLBlocklist fetches every feed; a feed that fails keeps its last domains
+func (n *Node) syncURLBlocklist(ctx context.Context, client *http.Client) {
+	for _, feed := range n.config.RelayPolicy.URLBlocklist.Feeds {
+		domains, err := blocklist.FetchFeed(ctx, client, feed)
+		if err != nil {
+			logger.Warn("Failed to sync URL blocklist feed",
+				zap.String("feed", feed),
+				zap.Error(err))
+			continue
+		}
+		n.urlBlocklist.SetFeed(feed, domains)
+		logger.Info("Synced URL blocklist feed",
+			zap.String("feed", feed),
+			zap.Int("domains", len(domains)))
+	}
+	metrics.BlockedDomains.Set(float64(n.urlBlocklist.Len()))
+}
+
+// runBlocklistFeedSync applies the stored entries of the blocklist feeds and
+// mute lists, then syncs the feeds at startup and every
+// RELAY_POLICY.BLOCKLIST_FEEDS.REFRESH_INTERVAL and the mute lists every minute
+func (n *Node) runBlocklistFeedSync(ctx context.Context) {
+	n.restoreBlocklistFeeds(ctx)
+	client := &http.Client{Timeout: blocklistFetchTimeout}
+	n.syncBlocklistFeeds(ctx, client)
+	mutes := newMuteListSync()
+	n.syncMuteLists(ctx, mutes)
+
+	// A nil channel never fires, leaving feeds without an interval unsynced
+	var feedTick <-chan time.Time
+	if interval := n.config.RelayPolicy.BlocklistFeeds.RefreshInterval; interval > 0 && len(n.config.RelayPolicy.BlocklistFeeds.Feeds) > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		feedTick = ticker.C
+	}
+	var muteTick <-chan time.Time
+	if len(n.config.RelayPolicy.MuteLists.PubKeys) > 0 {
+		ticker := time.NewTicker(muteListCheckInterval)
+		defer ticker.Stop()
+		muteTick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-feedTick:
+			n.syncBlocklistFeeds(ctx, client)
+		case <-muteTick:
+			n.syncMuteLists(ctx, mutes)
+		}
+	}
+}
+
+// restoreBlocklistFeeds applies the entries stored by the last syncs, so feeds
+// that can't be reached at startup still block what they listed. Entries of
+// feeds and mute lists no longer configured are deleted.
+func (n *Node) restoreBlocklistFeeds(ctx context.Context) {
+	var names []string
+	for _, feed := range n.config.RelayPolicy.BlocklistFeeds.Feeds {
+		names = append(names, feed.Name)
+	}
+	for _, pubkey := range n.config.RelayPolicy.MuteLists.PubKeys {
+		names = append(names, muteListFeed(pubkey))
+	}
+	if err := n.db.PruneBlocklistFeeds(ctx, names); err != nil {
+		logger.Warn("Failed to prune blocklist feeds", zap.Error(err))
+	}
+
+	entries, err := n.db.GetBlocklistEntries(ctx)
+	if err != nil {
+		logger.Warn("Failed to restore blocklist feeds", zap.Error(err))
+		return
+	}
+	lists := make(map[string]blocklist.List)
+	for _, e := range entries {
+		list, ok := lists[e.Feed]
+		if !ok {
+			list = blocklist.NewList()
+			lists[e.Feed] = list
+		}
+		switch e.Type {
+		case blocklist.EntryPubKey:
+			list.PubKeys[e.Value] = struct{}{}
+		case blocklist.EntryEvent:
+			list.Events[e.Value] = struct{}{}
+		case blocklist.EntryDomain:
+			list.Domains[e.Value] = struct{}{}
+		}
+	}
+	for feed, list := range lists {
+		n.applyBlocklistFeed(feed, list)
+	}
+	n.reportBlocklistFeeds()
+}
+
+// syncBlocklistFeeds fetches every feed, applies its entries and stores them
+// with the feed as their source; a feed that fails keeps its last entries
+func (n *Node) syncBlocklistFeeds(ctx context.Context, client *http.Client) {
+	for _, feed := range n.config.RelayPolicy.BlocklistFeeds.Feeds {
+		list, err := fetchBlocklistFeed(ctx, client, feed)
+		if err != nil {
+			metrics.BlocklistFeedSyncs.WithLabelValues(feed.Name, "failure").Inc()
+			logger.Warn("Failed to sync blocklist feed",
+				zap.String("feed", feed.Name),
+				zap.Error(err))
+			continue
+		}
+		n.applyBlocklistFeed(feed.Name, list)
+		metrics.BlocklistFeedSyncs.WithLabelValues(feed.Name, "success").Inc()
+
+		stored := map[string][]string{
+			blocklist.EntryPubKey: setValues(list.PubKeys),
+			blocklist.EntryEvent:  setValues(list.Events),
+			blocklist.EntryDomain: setValues(list.Domains),
+		}
+		if err := n.db.ReplaceBlocklistFeed(ctx, feed.Name, stored, time.Now().Unix()); err != nil {
+			logger.Warn("Failed to store blocklist feed",
+				zap.String("feed", feed.Name),
+				zap.Error(err))
+		}
+		logger.Info("Synced blocklist feed",
+			zap.String("feed", feed.Name),
+			zap.Int("pubkeys", len(list.PubKeys)),
+			zap.Int("events", len(list.Events)),
+			zap.Int("domains", len(list.Domains)))
+	}
+	n.reportBlocklistFeeds()
+}
+
+// fetchBlocklistFeed downloads the list of feed or fetches its list event
+func fetchBlocklistFeed(ctx context.Context, client *http.Client, feed config.BlocklistFeed) (blocklist.List, error) {
+	if feed.URL != "" {
+		return blocklist.FetchList(ctx, client, feed.URL, feed.Type)
+	}
+	ctx, cancel := context.WithTimeout(ctx, blocklistFetchTimeout)
+	defer cancel()
+	evt, err := blocklist.FetchListEvent(ctx, feed.Relays, strings.ToLower(feed.Author), feed.ListKind(), feed.D)
+	if err != nil {
+		return blocklist.List{}, err
+	}
+	return blocklist.ListFromEvent(evt), nil
+}
+
+// applyBlocklistFeed replaces what the feed blocks, from now on
+func (n *Node) applyBlocklistFeed(feed string, list blocklist.List) {
+	n.feedBlocklist.Set(feed, list)
+	if n.urlBlocklist != nil {
+		n.urlBlocklist.SetFeed(feed, list.Domains)
+	}
+}
+
+// reportBlocklistFeeds updates the blocklist gauges
+func (n *Node) reportBlocklistFeeds() {
+	metrics.BlocklistFeedEntries.Set(float64(n.feedBlocklist.Len()))
+	if n.urlBlocklist != nil {
+		metrics.BlockedDomains.Set(float64(n.urlBlocklist.Len()))
+	}
+}
+
+// setValues returns the members of a set
+func setValues(set map[string]struct{}) []string {
+	values := make([]string, 0, len(set))
+	for v := range set {
+		values = append(values, v)
+	}
+	return values
+}
@@ -0,0 +1,75 @@
+package application
+
+import (
+	"context"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/config"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// bloomCheckInterval is how often the duplicate filter's saturation is checked
+const bloomCheckInterval = time.Minute
+
+// bloomCapacity returns the capacity the duplicate filter needs to hold entries
+// IDs within DATABASE.BLOOM_MAX_FILL: capacity doubled as often as needed, up to
+// DATABASE.BLOOM_MAX_CAPACITY
+func bloomCapacity(cfg config.DatabaseConfig, capacity, entries uint) uint {
+	limit := uint(cfg.BloomMaxCapacity)
+	for capacity < limit && float64(entries) >= cfg.BloomMaxFill*float64(capacity) {
+		capacity = min(capacity*2, limit)
+	}
+	return capacity
+}
+
+// runBloomMonitor reports the duplicate filter's saturation and rebuilds it
+// larger once it holds DATABASE.BLOOM_MAX_FILL of its capacity, since past that
+// its false positives silently drop new events
+func (n *Node) runBloomMonitor(ctx context.Context) {
+	ticker := time.NewTicker(bloomCheckInterval)
+	defer ticker.Stop()
+	saturated := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stats := n.db.Bloom.Stats()
+		metrics.BloomFilterCapacity.Set(float64(stats.Capacity))
+		metrics.BloomFilterEntries.Set(float64(stats.Entries))
+		metrics.BloomFilterFillRatio.Set(stats.FillRatio)
+		metrics.BloomFilterFalsePositiveRate.Set(stats.FalsePositiveRate)
+
+		cfg := n.config.Database
+		if float64(stats.Entries) < cfg.BloomMaxFill*float64(stats.Capacity) {
+			saturated = false
+			continue
+		}
+		capacity := bloomCapacity(cfg, stats.Capacity, stats.Entries)
+		if capacity == stats.Capacity {
+			if !saturated {
+				logger.Warn("Duplicate filter is saturated at DATABASE.BLOOM_MAX_CAPACITY, new events may be dropped as duplicates",
+					zap.Uint("capacity", stats.Capacity),
+					zap.Uint("entries", stats.Entries),
+					zap.Float64("false_positive_rate", stats.FalsePositiveRate))
+				saturated = true
+			}
+			continue
+		}
+
+		logger.Info("Growing saturated duplicate filter",
+			zap.Uint("capacity", stats.Capacity),
+			zap.Uint("new_capacity", capacity),
+			zap.Uint("entries", stats.Entries),
+			zap.Float64("false_positive_rate", stats.FalsePositiveRate))
+		if err := n.db.ResizeBloomFilter(ctx, capacity); err != nil {
+			logger.Warn("Failed to grow duplicate filter", zap.Error(err))
+			continue
+		}
+		metrics.BloomFilterResizes.Inc()
+	}
+}
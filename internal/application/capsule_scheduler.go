@@ -0,0 +1,114 @@
+package application
+
+import (
+	"context"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/domain"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/metrics"
+	"github.com/Shugur-Network/relay/internal/relay/nips"
+	"github.com/Shugur-Network/relay/internal/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultSchedulerInterval is used when CAPSULES.SCHEDULER_INTERVAL is unset
+	defaultSchedulerInterval = 15 * time.Second
+	// unlockBatchSize bounds the capsules delivered per scheduler pass
+	unlockBatchSize = 500
+)
+
+// runCapsuleScheduler flags time capsules as unlocked once their drand round is
+// reached and pushes them to this node's "#unlocked" subscriptions. Each node
+// delivers the capsules unlocking after it started, so every node in a cluster
+// notifies its own clients while the unlocked flag is shared through the database.
+func (n *Node) runCapsuleScheduler(ctx context.Context) {
+	interval := n.config.Capsules.SchedulerInterval
+	if interval <= 0 {
+		interval = defaultSchedulerInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	watermark := time.Now().Unix()
+	logger.Info("Capsule unlock scheduler started", zap.Duration("interval", interval))
+
+	// Index capsules stored before the index was enabled or the capsule kinds changed
+	if indexed, err := n.EventProcessor.BackfillCapsuleIndex(ctx); err != nil {
+		logger.Warn("Failed to backfill capsule unlock index", zap.Int("indexed", indexed), zap.Error(err))
+	} else if indexed > 0 {
+		logger.Info("Backfilled capsule unlock index", zap.Int("indexed", indexed))
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			watermark = n.deliverUnlockedCapsules(ctx, watermark)
+		}
+	}
+}
+
+// deliverUnlockedCapsules handles one scheduler pass and returns the new watermark
+func (n *Node) deliverUnlockedCapsules(ctx context.Context, watermark int64) int64 {
+	passCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	now := time.Now().Unix()
+	marked, err := n.db.MarkCapsulesUnlocked(passCtx, now)
+	if err != nil {
+		logger.Warn("Failed to flag unlocked capsules", zap.Error(err))
+		return watermark
+	}
+	metrics.CapsulesUnlocked.Add(float64(marked))
+
+	capsules, lastUnlockAt, err := n.db.GetCapsulesUnlockedBetween(passCtx, watermark, now, unlockBatchSize)
+	if err != nil {
+		logger.Warn("Failed to load unlocked capsules", zap.Error(err))
+		return watermark
+	}
+	if len(capsules) == 0 {
+		return now
+	}
+
+	delivered := n.pushUnlockedCapsules(capsules)
+	logger.Debug("Delivered unlocked capsules",
+		zap.Int("capsules", len(capsules)),
+		zap.Int("deliveries", delivered))
+
+	// A full batch may leave capsules behind. Resume just before the last unlock
+	// time so capsules sharing it aren't skipped (clients dedupe repeats by ID).
+	if len(capsules) == unlockBatchSize && lastUnlockAt-1 > watermark {
+		return lastUnlockAt - 1
+	}
+	return now
+}
+
+// pushUnlockedCapsules sends capsules to every local subscription of their
+// tenant using the "#unlocked" vendor filter whose other conditions match, when
+// the connection may receive them. Returns the number sent.
+func (n *Node) pushUnlockedCapsules(capsules []storage.TenantEvent) int {
+	sent := 0
+	n.conns.each(func(conn domain.WebSocketConnection) {
+		for subID, filters := range conn.GetSubscriptions() {
+			for i := range capsules {
+				if capsules[i].Tenant != conn.Tenant() || !conn.CanReceive(&capsules[i].Event) {
+					continue
+				}
+				for _, filter := range filters {
+					if !nips.WantsUnlockedCapsules(filter) {
+						continue
+					}
+					if nips.WithoutUnlockedFilter(filter).Matches(&capsules[i].Event) {
+						conn.SendEvent(subID, &capsules[i].Event)
+						sent++
+						break
+					}
+				}
+			}
+		}
+	})
+	return sent
+}
@@ -0,0 +1,55 @@
+package application
+
+import (
+	"context"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/clock"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// runClockCheck measures the offset of the system clock at startup and then every
+// CLOCK.CHECK_INTERVAL
+func (n *Node) runClockCheck(ctx context.Context) {
+	n.checkClock(ctx)
+	interval := n.config.Clock.CheckInterval
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n.checkClock(ctx)
+		}
+	}
+}
+
+// checkClock measures the offset of the system clock, warning when it is past
+// CLOCK.MAX_SKEW and the created_at bounds are widened
+func (n *Node) checkClock(ctx context.Context) {
+	cfg := n.config.Clock
+	offset, err := clock.Check(ctx, cfg.NTPServers, cfg.MaxSkew, cfg.MaxTolerance)
+	if err != nil {
+		logger.Warn("Failed to check the system clock against NTP",
+			zap.Strings("servers", cfg.NTPServers),
+			zap.Error(err))
+		return
+	}
+	metrics.ClockOffset.Set(offset.Seconds())
+
+	if tolerance := clock.Tolerance(); tolerance > 0 {
+		logger.Warn("System clock is skewed, widening created_at bounds",
+			zap.Duration("offset", offset),
+			zap.Duration("max_skew", cfg.MaxSkew),
+			zap.Duration("tolerance", tolerance))
+		return
+	}
+	logger.Debug("System clock checked against NTP", zap.Duration("offset", offset))
+}
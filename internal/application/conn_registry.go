@@ -0,0 +1,112 @@
+package application
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Shugur-Network/relay/internal/domain"
+)
+
+// connShards is the number of independently locked shards of the registry
+const connShards = 32
+
+// connRegistry tracks the WebSocket clients of a node by client ID. Clients are
+// spread over shards with their own locks, so connection churn and fan-out to one
+// shard don't contend with the others.
+type connRegistry struct {
+	shards [connShards]connShard
+	count  atomic.Int64
+}
+
+// connShard holds the clients whose IDs hash to it
+type connShard struct {
+	mu    sync.RWMutex
+	conns map[string]domain.WebSocketConnection
+}
+
+// newConnRegistry creates an empty registry
+func newConnRegistry() *connRegistry {
+	r := &connRegistry{}
+	for i := range r.shards {
+		r.shards[i].conns = make(map[string]domain.WebSocketConnection)
+	}
+	return r
+}
+
+// shard returns the shard holding clientID
+func (r *connRegistry) shard(clientID string) *connShard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(clientID))
+	return &r.shards[h.Sum32()%connShards]
+}
+
+// add registers conn and returns the number of clients
+func (r *connRegistry) add(conn domain.WebSocketConnection) int64 {
+	s := r.shard(conn.ClientID())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.conns[conn.ClientID()]; !ok {
+		r.count.Add(1)
+	}
+	s.conns[conn.ClientID()] = conn
+	return r.count.Load()
+}
+
+// remove unregisters conn and returns the number of clients
+func (r *connRegistry) remove(conn domain.WebSocketConnection) int64 {
+	s := r.shard(conn.ClientID())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conns[conn.ClientID()] == conn {
+		delete(s.conns, conn.ClientID())
+		r.count.Add(-1)
+	}
+	return r.count.Load()
+}
+
+// get returns the client with clientID
+func (r *connRegistry) get(clientID string) (domain.WebSocketConnection, bool) {
+	s := r.shard(clientID)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	conn, ok := s.conns[clientID]
+	return conn, ok
+}
+
+// each calls fn for every client, holding one shard's read lock at a time
+func (r *connRegistry) each(fn func(conn domain.WebSocketConnection)) {
+	for i := range r.shards {
+		s := &r.shards[i]
+		s.mu.RLock()
+		for _, conn := range s.conns {
+			fn(conn)
+		}
+		s.mu.RUnlock()
+	}
+}
+
+// all returns a snapshot of every client
+func (r *connRegistry) all() []domain.WebSocketConnection {
+	conns := make([]domain.WebSocketConnection, 0, r.len())
+	r.each(func(conn domain.WebSocketConnection) {
+		conns = append(conns, conn)
+	})
+	return conns
+}
+
+// clear unregisters every client
+func (r *connRegistry) clear() {
+	for i := range r.shards {
+		s := &r.shards[i]
+		s.mu.Lock()
+		r.count.Add(-int64(len(s.conns)))
+		s.conns = make(map[string]domain.WebSocketConnection)
+		s.mu.Unlock()
+	}
+}
+
+// len returns the number of clients
+func (r *connRegistry) len() int {
+	return int(r.count.Load())
+}
@@ -0,0 +1,82 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/storage"
+	"go.uber.org/zap"
+)
+
+// moderationInterval is how often the reported pubkeys are checked against the
+// moderation thresholds
+const moderationInterval = time.Minute
+
+// runModeration shadow-bans or suspends the pubkeys reported by as many of
+// RELAY_POLICY.MODERATION's reporters as its thresholds
+func (n *Node) runModeration(ctx context.Context) {
+	ticker := time.NewTicker(moderationInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n.applyReportThresholds(ctx)
+		}
+	}
+}
+
+// applyReportThresholds acts on the pubkeys whose open reports reached a
+// threshold. A shadow-banned pubkey is suspended once it reaches the blacklist
+// threshold; other suspensions are left as the operator set them.
+func (n *Node) applyReportThresholds(ctx context.Context) {
+	policy := n.config.RelayPolicy.Moderation
+	threshold := policy.ShadowBanThreshold
+	if threshold <= 0 || (policy.BlacklistThreshold > 0 && policy.BlacklistThreshold < threshold) {
+		threshold = policy.BlacklistThreshold
+	}
+	reporters := make([]string, len(policy.Reporters))
+	for i, pubkey := range policy.Reporters {
+		reporters[i] = strings.ToLower(pubkey)
+	}
+
+	loadCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	reported, err := n.db.GetReportedPubkeys(loadCtx, threshold, reporters)
+	if err != nil {
+		logger.Warn("Failed to check reported pubkeys", zap.Error(err))
+		return
+	}
+
+	for pubkey, count := range reported {
+		current, suspended := n.Suspension(pubkey)
+		var shadow bool
+		switch {
+		case policy.BlacklistThreshold > 0 && count >= policy.BlacklistThreshold && (!suspended || current.Shadow):
+		case policy.ShadowBanThreshold > 0 && count >= policy.ShadowBanThreshold && !suspended:
+			shadow = true
+		default:
+			continue
+		}
+
+		suspension := storage.Suspension{
+			PubKey:      pubkey,
+			Reason:      fmt.Sprintf("reported by %d pubkeys", count),
+			SuspendedAt: time.Now().Unix(),
+			Shadow:      shadow,
+		}
+		if err := n.db.SuspendPubkey(loadCtx, suspension); err != nil {
+			logger.Warn("Failed to suspend reported pubkey", zap.String("pubkey", pubkey), zap.Error(err))
+			continue
+		}
+		n.Suspend(suspension)
+		logger.Info("Suspended reported pubkey",
+			zap.String("pubkey", pubkey),
+			zap.Int("reporters", count),
+			zap.Bool("shadow", shadow))
+	}
+}
@@ -0,0 +1,109 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/blocklist"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/storage"
+	"github.com/jackc/pgx/v5"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+// muteListCheckInterval is how often the operators' mute lists stored on this
+// relay are read
+const muteListCheckInterval = time.Minute
+
+// muteListSync is what the mute list sync keeps between checks
+type muteListSync struct {
+	// peers holds the newest list of each operator fetched from the peers
+	peers     map[string]*nostr.Event
+	fetchedAt time.Time
+	// applied holds the ID of the list applied for each operator
+	applied map[string]string
+}
+
+// newMuteListSync returns the state of a sync that hasn't run yet
+func newMuteListSync() *muteListSync {
+	return &muteListSync{
+		peers:   make(map[string]*nostr.Event),
+		applied: make(map[string]string),
+	}
+}
+
+// muteListFeed returns the feed the entries of pubkey's mute list are kept
+// under. It is longer than any BLOCKLIST_FEEDS name, so the two never clash.
+func muteListFeed(pubkey string) string {
+	return "mute:" + strings.ToLower(pubkey)
+}
+
+// syncMuteLists applies the newest mute list of each operator, whether stored
+// on this relay or fetched from RELAY_POLICY.MUTE_LISTS.RELAYS. Peers are asked
+// at most every REFRESH_INTERVAL.
+func (n *Node) syncMuteLists(ctx context.Context, state *muteListSync) {
+	policy := n.config.RelayPolicy.MuteLists
+	if len(policy.PubKeys) == 0 {
+		return
+	}
+
+	if len(policy.Relays) > 0 && (state.fetchedAt.IsZero() || (policy.RefreshInterval > 0 && time.Since(state.fetchedAt) >= policy.RefreshInterval)) {
+		state.fetchedAt = time.Now()
+		for _, pubkey := range policy.PubKeys {
+			pubkey = strings.ToLower(pubkey)
+			fetchCtx, cancel := context.WithTimeout(ctx, blocklistFetchTimeout)
+			evt, err := blocklist.FetchListEvent(fetchCtx, policy.Relays, pubkey, blocklist.KindMuteList, "")
+			cancel()
+			if err != nil {
+				logger.Warn("Failed to fetch operator mute list",
+					zap.String("pubkey", pubkey),
+					zap.Error(err))
+				continue
+			}
+			state.peers[pubkey] = evt
+		}
+	}
+
+	for _, pubkey := range policy.PubKeys {
+		pubkey = strings.ToLower(pubkey)
+		newest := state.peers[pubkey]
+		stored, err := n.db.GetReplaceableEvent(ctx, storage.DefaultTenant, pubkey, blocklist.KindMuteList)
+		switch {
+		case err == nil:
+			if newest == nil || stored.CreatedAt > newest.CreatedAt {
+				newest = &stored
+			}
+		case !errors.Is(err, pgx.ErrNoRows):
+			logger.Warn("Failed to read operator mute list",
+				zap.String("pubkey", pubkey),
+				zap.Error(err))
+		}
+		if newest == nil || state.applied[pubkey] == newest.ID {
+			continue
+		}
+
+		list := blocklist.ListFromEvent(newest)
+		feed := muteListFeed(pubkey)
+		n.applyBlocklistFeed(feed, list)
+		state.applied[pubkey] = newest.ID
+
+		entries := map[string][]string{
+			blocklist.EntryPubKey: setValues(list.PubKeys),
+			blocklist.EntryEvent:  setValues(list.Events),
+		}
+		if err := n.db.ReplaceBlocklistFeed(ctx, feed, entries, time.Now().Unix()); err != nil {
+			logger.Warn("Failed to store operator mute list",
+				zap.String("pubkey", pubkey),
+				zap.Error(err))
+		}
+		logger.Info("Applied operator mute list",
+			zap.String("pubkey", pubkey),
+			zap.String("event_id", newest.ID),
+			zap.Int("pubkeys", len(list.PubKeys)),
+			zap.Int("events", len(list.Events)))
+	}
+	n.reportBlocklistFeeds()
+}
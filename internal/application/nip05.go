@@ -0,0 +1,51 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/Shugur-Network/relay/internal/storage"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip05"
+)
+
+// maxNIP05Response caps the nostr.json documents read to verify a domain
+const maxNIP05Response = 64 * 1024
+
+// nip05Resolver resolves NIP-05 identifiers with client. Identifiers come from
+// anyone publishing a profile, so client must refuse internal addresses.
+func nip05Resolver(client *http.Client) storage.NIP05Resolver {
+	return func(ctx context.Context, identifier string) (string, error) {
+		name, domain, err := nip05.ParseIdentifier(identifier)
+		if err != nil {
+			return "", fmt.Errorf("invalid identifier %q: %w", identifier, err)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+			"https://"+domain+"/.well-known/nostr.json?name="+url.QueryEscape(name), nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("%s answered %s", domain, resp.Status)
+		}
+
+		var doc nip05.WellKnownResponse
+		if err := json.NewDecoder(io.LimitReader(resp.Body, maxNIP05Response)).Decode(&doc); err != nil {
+			return "", fmt.Errorf("invalid nostr.json from %s: %w", domain, err)
+		}
+		pubkey := doc.Names[name]
+		if !nostr.IsValidPublicKey(pubkey) {
+			return "", fmt.Errorf("no valid pubkey for %q", identifier)
+		}
+		return pubkey, nil
+	}
+}
@@ -7,13 +7,24 @@ import (
 	"sync"
 	"time"
 
+	"github.com/Shugur-Network/relay/internal/analytics"
+	"github.com/Shugur-Network/relay/internal/blocklist"
+	"github.com/Shugur-Network/relay/internal/capture"
 	"github.com/Shugur-Network/relay/internal/config"
 	"github.com/Shugur-Network/relay/internal/constants"
 	"github.com/Shugur-Network/relay/internal/domain"
+	"github.com/Shugur-Network/relay/internal/identity"
 	"github.com/Shugur-Network/relay/internal/limiter"
 	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/motd"
+	"github.com/Shugur-Network/relay/internal/payments"
+	"github.com/Shugur-Network/relay/internal/rebroadcast"
 	"github.com/Shugur-Network/relay/internal/relay"
+	"github.com/Shugur-Network/relay/internal/sessions"
+	"github.com/Shugur-Network/relay/internal/sink"
 	"github.com/Shugur-Network/relay/internal/storage"
+	"github.com/Shugur-Network/relay/internal/tenant"
+	"github.com/Shugur-Network/relay/internal/web"
 	"github.com/Shugur-Network/relay/internal/workers"
 	nostr "github.com/nbd-wtf/go-nostr"
 	"go.uber.org/zap"
@@ -32,13 +43,58 @@ type Node struct {
 	Validator       domain.EventValidator
 	EventValidator  *relay.EventValidator
 
-	wsConns   map[domain.WebSocketConnection]bool
-	wsConnsMu sync.RWMutex
+	conns *connRegistry
 
 	blacklistPubKeys map[string]struct{}
+	whitelistMu      sync.RWMutex
 	whitelistPubKeys map[string]struct{}
 
+	paidMu      sync.RWMutex
+	paidPubKeys map[string]storage.PaidPubkey // pubkey -> paid admission
+	payments    *payments.Service
+	zaps        *payments.ZapCreditor
+	cashu       *payments.CashuRedeemer
+	webhooks    *payments.WebhookNotifier
+	// forwarder delivers stored events to SINK.URL, nil unless in forwarder mode
+	forwarder *sink.Forwarder
+
+	suspendedMu sync.RWMutex
+	suspended   map[string]storage.Suspension // pubkey -> suspension
+
+	vanishedMu sync.RWMutex
+	vanished   map[string]storage.Vanish // vanishKey(tenant, pubkey) -> NIP-62 vanish
+
+	// revalidate wakes the revalidation runner
+	revalidate chan struct{}
+
+	// urlBlocklist screens the URLs events link to, nil when none are blocked
+	urlBlocklist *blocklist.Domains
+	// feedBlocklist holds what the blocklist feeds block, nil without feeds
+	feedBlocklist *blocklist.Entries
+	// ipAccess screens the addresses WebSocket clients connect from
+	ipAccess *blocklist.IPAccess
+
+	// tenants are the virtual relays hosted alongside the main relay
+	tenants *tenant.Registry
+	// tenantMeter accounts the usage of the virtual relays
+	tenantMeter *tenant.Meter
+
 	rateLimiter *limiter.RateLimiter
+	freeQuota   *limiter.DailyQuota
+	// challenge asks unverified clients for proof of work under load, nil when disabled
+	challenge *limiter.Challenge
+	// sessions counts the activity of each client across reconnects, nil when disabled
+	sessions *sessions.Tracker
+	// captures records the frames of clients admins chose, nil without the admin API
+	captures *capture.Recorder
+	// rebroadcasts republishes stored events to other relays, nil without the admin API
+	rebroadcasts *rebroadcast.Manager
+	// queryAnalytics aggregates the REQ filters served, nil without the admin API
+	queryAnalytics *analytics.Recorder
+	// motd decides the messages of the day clients are sent, nil when disabled
+	motd *motd.Board
+	// draining is closed once shutdown starts, for the listeners to stop accepting
+	draining chan struct{}
 	startTime   time.Time
 }
 
@@ -55,6 +111,11 @@ func New(ctx context.Context, cfg *config.Config, privKey ed25519.PrivateKey) (*
 		return nil, fmt.Errorf("failed building db: %w", err)
 	}
 
+	// Keep the relay identity in the database when configured
+	if cfg.Identity.Backend == identity.BackendDatabase {
+		identity.UseKeyStore(builder.database)
+	}
+
 	// 3) Build worker pool
 	builder.BuildWorkers()
 
@@ -87,6 +148,111 @@ func (n *Node) Start(ctx context.Context) error {
 		return err
 	}
 
+	// Republish the key rotation statements while the grace period lasts
+	if rotation := identity.CurrentKeyRotation(); rotation != nil {
+		for _, statement := range rotation.Statements {
+			if !n.EventProcessor.QueueEvent(storage.DefaultTenant, statement) {
+				logger.Warn("Failed to queue key rotation statement", zap.String("event_id", statement.ID))
+			}
+		}
+		logger.Info("Relay key rotation in progress",
+			zap.String("previous_pubkey", rotation.PreviousPubKey),
+			zap.String("pubkey", rotation.PubKey),
+			zap.Time("grace_until", time.Unix(rotation.GraceUntil, 0)))
+	}
+
+	// Track paid admissions and suspensions recorded in the database
+	go n.runAdmissionRefresher(n.ctx)
+
+	// Confirm lightning invoices that settled without a webhook
+	if n.payments != nil {
+		go n.payments.Run(n.ctx)
+	}
+
+	// Notify the operator's billing system of admissions and lapses
+	if n.webhooks != nil {
+		go n.webhooks.Run(n.ctx)
+	}
+
+	// Deliver accepted events to the external sink
+	if n.forwarder != nil {
+		go n.forwarder.Run(n.ctx)
+	}
+	go n.setUpSinkChangefeed(n.ctx)
+
+	// Resolve the zap provider so zap receipts can be credited
+	if n.zaps != nil {
+		go n.zaps.Run(n.ctx)
+	}
+
+	// Advertise the mints and locking key nutzaps to the relay must use
+	if n.cashu != nil && n.config.Payments.Cashu.Nutzaps {
+		info, err := n.cashu.NutzapInfo(n.ctx, n.config.Relay.PublicURL)
+		if err != nil {
+			logger.Warn("Failed to sign nutzap info event", zap.Error(err))
+		} else if !n.EventProcessor.QueueEvent(storage.DefaultTenant, *info) {
+			logger.Warn("Failed to queue nutzap info event", zap.String("event_id", info.ID))
+		}
+	}
+
+	// Deliver time capsules to "#unlocked" subscriptions as they unlock
+	if n.config.Capsules.Enabled && n.config.Capsules.UnlockScheduler {
+		go n.runCapsuleScheduler(n.ctx)
+	}
+
+	// Load the tenants created at runtime and keep them in sync across nodes
+	go n.runTenantSync(n.ctx)
+
+	// Re-run the current policies over stored events when the operator asks
+	go n.runRevalidation(n.ctx)
+
+	// Report the duplicate filter's saturation and grow it before it degrades
+	go n.runBloomMonitor(n.ctx)
+
+	// Keep the domain lists of the URL blocklist feeds current
+	if n.urlBlocklist != nil && len(n.config.RelayPolicy.URLBlocklist.Feeds) > 0 {
+		go n.runURLBlocklistSync(n.ctx)
+	}
+
+	// Keep what the blocklist feeds and operator mute lists block current
+	if n.feedBlocklist != nil {
+		go n.runBlocklistFeedSync(n.ctx)
+	}
+
+	// Publish the relay as a Tor onion service
+	if n.config.Tor.Enabled {
+		go n.runOnionService(n.ctx)
+	}
+
+	// Forget the sessions of clients gone for RELAY.SESSIONS.RETENTION
+	if n.sessions != nil {
+		go n.runSessionSweep(n.ctx)
+	}
+
+	// Act on the pubkeys reported past the moderation thresholds
+	if moderation := n.config.RelayPolicy.Moderation; moderation.Enabled && (moderation.ShadowBanThreshold > 0 || moderation.BlacklistThreshold > 0) {
+		go n.runModeration(n.ctx)
+	}
+
+	// Compare the system clock, which the created_at checks trust, with NTP
+	if len(n.config.Clock.NTPServers) > 0 {
+		go n.runClockCheck(n.ctx)
+	}
+
+	// Check the deployment once the listeners are up
+	if n.config.SelfTest.Enabled {
+		go n.runSelfTest(n.ctx)
+	}
+
+	// Serve Prometheus metrics on their own listener
+	if n.config.Metrics.Enabled {
+		go func() {
+			if err := web.ServeMetrics(n.ctx, n.config.Metrics, n.config.Relay.ReusePort); err != nil {
+				logger.Error("Metrics server error", zap.Error(err))
+			}
+		}()
+	}
+
 	// Start the relay server (now includes web dashboard)
 	go func() {
 		addr := n.config.Relay.WSAddr
@@ -108,7 +274,7 @@ func (n *Node) Start(ctx context.Context) error {
 // Shutdown gracefully shuts down the node with configurable timeout.
 func (n *Node) Shutdown() {
 	logger.Info("Initiating graceful shutdown...")
-	shutdownTimeout := 30 * time.Second // Hardcoded 30-second timeout
+	shutdownTimeout := 30*time.Second + n.config.Relay.DrainPeriod // 30 seconds on top of draining
 
 	// Create a timeout context for shutdown operations
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
@@ -116,7 +282,10 @@ func (n *Node) Shutdown() {
 
 	var shutdownErrors []error
 
-	// Step 1: Stop accepting new connections and close existing WebSocket connections gracefully
+	// Step 1: Stop accepting new connections, leaving them to a process started on
+	// the same port, then close existing WebSocket connections gracefully
+	close(n.draining)
+	n.drainWebSocketConnections(shutdownCtx)
 	n.shutdownWebSocketConnections(shutdownCtx)
 
 	// Step 2: Stop the event dispatcher
@@ -149,14 +318,17 @@ func (n *Node) Shutdown() {
 		logger.Warn("Worker pool shutdown timed out", zap.Duration("timeout", shutdownTimeout))
 	}
 
-	// Step 5: Cancel the node context
+	// Step 5: Record the usage metered since the last flush
+	n.flushTenantUsage(shutdownCtx)
+
+	// Step 6: Cancel the node context
 	if n.cancel != nil {
 		logger.Debug("Canceling node context...")
 		n.cancel()
 		logger.Debug("✅ Node context canceled")
 	}
 
-	// Step 6: Close DB with retry mechanism and timeout
+	// Step 7: Close DB with retry mechanism and timeout
 	if n.db != nil {
 		logger.Debug("Closing database connection...")
 		if err := n.shutdownDatabase(shutdownCtx); err != nil {
@@ -178,15 +350,53 @@ func (n *Node) Shutdown() {
 	}
 }
 
+// drainWebSocketConnections closes WebSocket connections a few at a time over
+// RELAY.DRAIN_PERIOD, telling clients the relay restarts, so their reconnects
+// reach the process taking over gradually rather than all at once.
+func (n *Node) drainWebSocketConnections(ctx context.Context) {
+	period := n.config.Relay.DrainPeriod
+	connections := n.conns.all()
+	if period <= 0 || len(connections) == 0 {
+		return
+	}
+
+	logger.Info("Draining WebSocket connections",
+		zap.Int("connection_count", len(connections)),
+		zap.Duration("drain_period", period))
+
+	const interval = 100 * time.Millisecond
+	steps := int(period / interval)
+	if steps < 1 {
+		steps = 1
+	}
+	batch := (len(connections) + steps - 1) / steps
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for len(connections) > 0 {
+		count := min(batch, len(connections))
+		for _, conn := range connections[:count] {
+			conn.CloseForRestart()
+		}
+		connections = connections[count:]
+		if len(connections) == 0 {
+			break
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			logger.Warn("WebSocket connection draining timed out",
+				zap.Int("remaining", len(connections)))
+			return
+		}
+	}
+	logger.Debug("✅ WebSocket connections drained")
+}
+
 // shutdownWebSocketConnections gracefully closes all active WebSocket connections.
 func (n *Node) shutdownWebSocketConnections(ctx context.Context) {
-	n.wsConnsMu.Lock()
-	connectionCount := len(n.wsConns)
-	connections := make([]domain.WebSocketConnection, 0, connectionCount)
-	for conn := range n.wsConns {
-		connections = append(connections, conn)
-	}
-	n.wsConnsMu.Unlock()
+	connections := n.conns.all()
+	connectionCount := len(connections)
 
 	if connectionCount == 0 {
 		logger.Debug("✅ No WebSocket connections to close")
@@ -206,10 +416,8 @@ func (n *Node) shutdownWebSocketConnections(ctx context.Context) {
 			conn.Close()
 		}
 
-		// Clear the connections map
-		n.wsConnsMu.Lock()
-		n.wsConns = make(map[domain.WebSocketConnection]bool)
-		n.wsConnsMu.Unlock()
+		// Clear the connection registry
+		n.conns.clear()
 	}()
 
 	select {
@@ -217,10 +425,8 @@ func (n *Node) shutdownWebSocketConnections(ctx context.Context) {
 		logger.Debug("✅ WebSocket connections closed")
 	case <-ctx.Done():
 		logger.Warn("WebSocket connection shutdown timed out")
-		// Force clear the map in case of timeout
-		n.wsConnsMu.Lock()
-		n.wsConns = make(map[domain.WebSocketConnection]bool)
-		n.wsConnsMu.Unlock()
+		// Force clear the registry in case of timeout
+		n.conns.clear()
 	}
 }
 
@@ -258,39 +464,34 @@ func (n *Node) shutdownDatabase(ctx context.Context) error {
 
 // RegisterConn tracks a new WebSocket client
 func (n *Node) RegisterConn(conn domain.WebSocketConnection) {
-	n.wsConnsMu.Lock()
-	defer n.wsConnsMu.Unlock()
-	n.wsConns[conn] = true
-	count := len(n.wsConns)
-	logger.Debug("WebSocket client registered", zap.Int("total_connections", count))
+	count := n.conns.add(conn)
+	logger.Debug("WebSocket client registered", zap.Int64("total_connections", count))
 }
 
 // UnregisterConn removes a WebSocket client
 func (n *Node) UnregisterConn(conn domain.WebSocketConnection) {
-	n.wsConnsMu.Lock()
-	defer n.wsConnsMu.Unlock()
-	delete(n.wsConns, conn)
-	count := len(n.wsConns)
-	logger.Debug("WebSocket client unregistered", zap.Int("total_connections", count))
+	count := n.conns.remove(conn)
+	logger.Debug("WebSocket client unregistered", zap.Int64("total_connections", count))
+}
+
+// Connection returns the WebSocket client with clientID
+func (n *Node) Connection(clientID string) (domain.WebSocketConnection, bool) {
+	return n.conns.get(clientID)
 }
 
 // GetActiveConnectionCount returns the actual number of active WebSocket connections
 func (n *Node) GetActiveConnectionCount() int64 {
-	n.wsConnsMu.RLock()
-	defer n.wsConnsMu.RUnlock()
-	return int64(len(n.wsConns))
+	return int64(n.conns.len())
 }
 
 // GetEventCount returns the count of events matching the given filter
 func (n *Node) GetEventCount(ctx context.Context, filter nostr.Filter) (int64, error) {
-	return n.db.GetEventCount(ctx, filter)
+	return n.db.GetEventCount(ctx, storage.DefaultTenant, filter)
 }
 
 // GetConnectionCount returns the current number of active connections (for health checks)
 func (n *Node) GetConnectionCount() int {
-	n.wsConnsMu.RLock()
-	defer n.wsConnsMu.RUnlock()
-	return len(n.wsConns)
+	return n.conns.len()
 }
 
 // GetStartTime returns when the node was started (for health checks)
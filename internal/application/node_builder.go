@@ -9,16 +9,29 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Shugur-Network/relay/internal/analytics"
+	"github.com/Shugur-Network/relay/internal/blocklist"
+	"github.com/Shugur-Network/relay/internal/capture"
 	"github.com/Shugur-Network/relay/internal/config"
 	"github.com/Shugur-Network/relay/internal/constants"
 	"github.com/Shugur-Network/relay/internal/domain"
+	"github.com/Shugur-Network/relay/internal/drand"
 	"github.com/Shugur-Network/relay/internal/errors"
 	"github.com/Shugur-Network/relay/internal/limiter"
 	"github.com/Shugur-Network/relay/internal/logger"
 	"github.com/Shugur-Network/relay/internal/metrics"
+	"github.com/Shugur-Network/relay/internal/motd"
+	"github.com/Shugur-Network/relay/internal/outbound"
+	"github.com/Shugur-Network/relay/internal/payments"
+	"github.com/Shugur-Network/relay/internal/rebroadcast"
 	"github.com/Shugur-Network/relay/internal/relay"
+	"github.com/Shugur-Network/relay/internal/relay/nips"
+	"github.com/Shugur-Network/relay/internal/sessions"
+	"github.com/Shugur-Network/relay/internal/sink"
 	"github.com/Shugur-Network/relay/internal/storage"
+	"github.com/Shugur-Network/relay/internal/tenant"
 	"github.com/Shugur-Network/relay/internal/workers"
+	nostr "github.com/nbd-wtf/go-nostr"
 
 	"go.uber.org/zap"
 )
@@ -35,6 +48,8 @@ type NodeBuilder struct {
 	workerPool      *workers.WorkerPool
 	validator       domain.EventValidator
 	eventVal        *relay.EventValidator
+	urlBlocklist    *blocklist.Domains
+	feedBlocklist   *blocklist.Entries
 	eventProc       *storage.EventProcessor
 	rateLimiter     *limiter.RateLimiter
 
@@ -281,6 +296,29 @@ func (b *NodeBuilder) BuildDB() error {
 	}
 	b.database = dbConn
 
+	// Bound concurrent reads so query bursts can't starve writes of connections
+	dbConn.LimitQueryConcurrency(int64(b.config.Database.MaxConcurrentQueries), b.config.Database.QueryQueueTimeout)
+
+	// Fail storage operations at once rather than waiting on a database that is down
+	if b.config.Database.BreakerThreshold > 0 {
+		dbConn.EnableCircuitBreaker(b.config.Database.BreakerThreshold, b.config.Database.BreakerProbeInterval)
+	}
+
+	// Answer REQs for the latest events of common kinds from memory
+	dbConn.EnableRecentCache(b.config.Relay.EventCacheSize)
+	if b.config.Relay.LiveWindow > 0 {
+		dbConn.EnableLiveRing(b.config.Relay.LiveWindow)
+	}
+	if b.config.RelayPolicy.HideDeletedInteractions {
+		dbConn.EnableDeletedInteractionFilter()
+	}
+	if b.config.Database.ApproximateCountThreshold > 0 {
+		dbConn.EnableCountSketches(int64(b.config.Database.ApproximateCountThreshold))
+	}
+	if b.config.Search.SpamReports > 0 {
+		dbConn.EnableSpamFilter(b.config.Search.SpamReports)
+	}
+
 	// Initialize database schema on first run
 	if err := dbConn.InitializeSchema(b.ctx); err != nil {
 		logger.Error("Failed to initialize database schema", zap.Error(err))
@@ -294,13 +332,17 @@ func (b *NodeBuilder) BuildDB() error {
 	}
 
 	// Initialize EventsStored metric with current count
+	bloomSize := uint(b.config.Database.BloomCapacity)
 	if count, err := dbConn.GetTotalEventCount(b.ctx); err != nil {
 		logger.Warn("Failed to get initial event count for metrics", zap.Error(err))
 	} else {
 		metrics.EventsStored.Set(float64(count))
 		logger.Info("Initialized EventsStored metric", zap.Int64("count", count))
+		// Size the duplicate filter for the events already stored
+		bloomSize = bloomCapacity(b.config.Database, bloomSize, uint(count))
 	}
 
+	dbConn.SizeBloomFilter(bloomSize, b.config.Database.BloomFalsePositiveRate)
 	if err := b.database.RebuildBloomFilter(b.ctx); err != nil {
 		logger.Warn("Failed to rebuild bloom filter", zap.Error(err))
 	}
@@ -324,14 +366,57 @@ func (b *NodeBuilder) BuildWorkers() {
 
 // BuildValidators configures the validation logic.
 func (b *NodeBuilder) BuildValidators() {
-	b.validator = relay.NewPluginValidator(b.config, b.database)
+	nips.SetTimeCapsuleKinds(b.config.Capsules.Kinds)
+	pv := relay.NewPluginValidator(b.config, b.database)
+	feeds := b.config.RelayPolicy.BlocklistFeeds.Feeds
+	domainFeeds := false
+	for _, feed := range feeds {
+		domainFeeds = domainFeeds || feed.Type == blocklist.EntryDomain
+	}
+	if policy := b.config.RelayPolicy.URLBlocklist; len(policy.Domains) > 0 || len(policy.Feeds) > 0 || domainFeeds {
+		b.urlBlocklist = blocklist.NewDomains(policy.Domains)
+		pv.UseURLBlocklist(b.urlBlocklist)
+		metrics.BlockedDomains.Set(float64(b.urlBlocklist.Len()))
+	}
+	if len(feeds) > 0 || len(b.config.RelayPolicy.MuteLists.PubKeys) > 0 {
+		b.feedBlocklist = blocklist.NewEntries()
+		pv.UseFeedBlocklist(b.feedBlocklist)
+	}
+	b.validator = pv
 	b.eventVal = relay.NewEventValidator(b.config, b.database)
 }
 
 // BuildProcessor sets up the event processor.
 func (b *NodeBuilder) BuildProcessor() {
-	// 100000 is the buffer size from your original code
-	b.eventProc = storage.NewEventProcessor(b.ctx, b.database, 100000)
+	b.eventProc = storage.NewEventProcessor(b.ctx, b.database, storage.ProcessorLimits{
+		MinWorkers:    b.config.Database.MinWriteWorkers,
+		MaxWorkers:    b.config.Database.MaxWriteWorkers,
+		QueueSize:     b.config.Database.WriteQueueSize,
+		LatencyTarget: b.config.Database.WriteLatencyTarget,
+	})
+	if b.config.Identity.Attestations {
+		b.eventProc.EnableReceipts()
+	}
+	if b.config.RelayPolicy.Moderation.Enabled {
+		b.eventProc.EnableReportQueue()
+	}
+	if b.config.Capsules.Enabled && b.config.Capsules.UnlockScheduler {
+		b.eventProc.EnableCapsuleIndex(drand.NewClient(b.config.Capsules.DrandURLs, b.config.Capsules.DrandTimeout))
+	}
+	if b.config.Capsules.Enabled {
+		b.eventProc.EnableShareTracking()
+	}
+	if b.config.Search.VerifyDomains {
+		b.eventProc.EnableDomainVerification(
+			nip05Resolver(outbound.NewClient(b.config.Search.DomainTimeout)), b.config.Search.DomainTimeout)
+	}
+	if b.config.ZapTotals.Enabled {
+		providers := payments.NewZapProviders(b.database, outbound.NewClient(b.config.ZapTotals.ProviderTimeout))
+		b.eventProc.EnableZapIndex(providers.Resolve, b.config.ZapTotals.ProviderTimeout)
+	}
+	if b.config.Capsules.Enabled && b.config.Capsules.BlobOffloadThreshold > 0 {
+		b.database.EnableCapsuleBlobOffload(b.config.Capsules.BlobOffloadThreshold)
+	}
 }
 
 // BuildRateLimiter sets up the rate limiter.
@@ -384,6 +469,11 @@ func (b *NodeBuilder) Build() (*Node, error) {
 		return nil, fmt.Errorf("rate limiter must be built before calling Build()")
 	}
 
+	ipAccess, err := blocklist.NewIPAccess(b.config.RelayPolicy.IPAccess.Allow, b.config.RelayPolicy.IPAccess.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RELAY_POLICY.IP_ACCESS: %w", err)
+	}
+
 	node := &Node{
 		ctx:             b.ctx,
 		cancel:          b.cancel,
@@ -394,15 +484,87 @@ func (b *NodeBuilder) Build() (*Node, error) {
 		Validator:       b.validator,
 		EventValidator:  b.eventVal,
 		WorkerPool:      b.workerPool,
-		wsConns:         make(map[domain.WebSocketConnection]bool),
+		conns:           newConnRegistry(),
 		rateLimiter:     b.rateLimiter,
 
 		blacklistPubKeys: b.blacklist,
 		whitelistPubKeys: b.whitelist,
+		paidPubKeys:      make(map[string]storage.PaidPubkey),
+		suspended:        make(map[string]storage.Suspension),
+		vanished:         make(map[string]storage.Vanish),
+		revalidate:       make(chan struct{}, 1),
+		draining:         make(chan struct{}),
+		urlBlocklist:     b.urlBlocklist,
+		feedBlocklist:    b.feedBlocklist,
+		ipAccess:         ipAccess,
+		tenants:          tenant.NewRegistry(b.config.Tenants),
+		tenantMeter:      tenant.NewMeter(),
 		startTime:        time.Now(),
 	}
 
+	b.eventProc.EnableTenantMetering(node.tenantMeter)
+
+	if b.config.Payments.Webhook.URL != "" {
+		node.webhooks = payments.NewWebhookNotifier(b.config.Payments, b.database)
+	}
+	if b.config.Sink.Enabled && b.config.Sink.Mode == config.SinkForwarder {
+		node.forwarder = sink.NewForwarder(b.config.Sink)
+		b.eventProc.EnableSink(node.forwarder)
+	}
+	if quota := b.config.RelayPolicy.FreeDailyEvents; quota > 0 {
+		node.freeQuota = limiter.NewDailyQuota(quota)
+	}
+	if challenge := b.config.Relay.ThrottlingConfig.Challenge; challenge.Enabled {
+		node.challenge = limiter.NewChallenge(challenge)
+	}
+	if b.config.MOTD.Enabled {
+		board, err := motd.NewBoard(b.config.MOTD, b.config.Relay.Name, b.config.Relay.Contact)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up messages of the day: %w", err)
+		}
+		node.motd = board
+	}
+	if tracking := b.config.Relay.Sessions; tracking.Enabled {
+		node.sessions = sessions.NewTracker(tracking.Retention, tracking.MaxSessions)
+	}
+	if b.config.Admin.Enabled {
+		node.captures = capture.NewRecorder(b.config.Admin.Capture)
+		node.rebroadcasts = rebroadcast.NewManager(b.ctx, b.database.GetEvents)
+		if b.config.Admin.QueryAnalytics.Enabled {
+			node.queryAnalytics = analytics.NewRecorder(b.config.Admin.QueryAnalytics.MaxKeys)
+		}
+	}
+
+	if b.config.Payments.Enabled && b.config.Payments.Lightning.Backend != "" {
+		service, err := payments.NewService(b.config.Payments, b.database, node.SetPaid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up lightning payments: %w", err)
+		}
+		node.payments = service
+	}
+	if b.config.Payments.Enabled && b.config.Payments.Zaps.Enabled {
+		node.zaps = payments.NewZapCreditor(b.config.Payments, b.database, node.SetPaid)
+		b.eventProc.EnablePaymentEvents(nostr.KindZap, node.zaps)
+	}
+	if b.config.Payments.Enabled && b.config.Payments.Cashu.Enabled {
+		cashu, err := payments.NewCashuRedeemer(b.config.Payments, b.database, node.SetPaid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up cashu payments: %w", err)
+		}
+		node.cashu = cashu
+		if b.config.Payments.Cashu.Nutzaps {
+			b.eventProc.EnablePaymentEvents(nostr.KindNutZap, cashu)
+		}
+	}
+
 	logger.Debug("Node initialized successfully via builder")
 	b.database.StartExpiredEventsCleaner(b.ctx, time.Hour)
+	b.database.StartCountSketches(b.ctx, b.config.Database.CountSketchRebuild)
+	if b.config.Capsules.Enabled && b.config.Capsules.GCInterval > 0 {
+		b.eventProc.StartCapsuleCollector(b.ctx, b.config.Capsules.GCInterval, storage.CapsuleRetention{
+			Unlocked:     b.config.Capsules.Retention,
+			Unresolvable: b.config.Capsules.UnresolvableTTL,
+		})
+	}
 	return node, nil
 }
@@ -1,9 +1,22 @@
 package application
 
 import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/analytics"
+	"github.com/Shugur-Network/relay/internal/blocklist"
+	"github.com/Shugur-Network/relay/internal/capture"
 	"github.com/Shugur-Network/relay/internal/config"
 	"github.com/Shugur-Network/relay/internal/domain"
+	"github.com/Shugur-Network/relay/internal/limiter"
+	"github.com/Shugur-Network/relay/internal/motd"
+	"github.com/Shugur-Network/relay/internal/payments"
+	"github.com/Shugur-Network/relay/internal/rebroadcast"
+	"github.com/Shugur-Network/relay/internal/sessions"
 	"github.com/Shugur-Network/relay/internal/storage"
+	"github.com/Shugur-Network/relay/internal/tenant"
 )
 
 // DB returns the node's database instance.
@@ -30,3 +43,167 @@ func (n *Node) GetEventProcessor() *storage.EventProcessor {
 func (n *Node) GetEventDispatcher() *storage.EventDispatcher {
 	return n.EventDispatcher
 }
+
+// Tenants returns the virtual relays hosted by the node.
+func (n *Node) Tenants() *tenant.Registry {
+	return n.tenants
+}
+
+// TenantMeter returns the meter of the virtual relays' usage.
+func (n *Node) TenantMeter() *tenant.Meter {
+	return n.tenantMeter
+}
+
+// IPAccess returns the allowed and denied client address ranges.
+func (n *Node) IPAccess() *blocklist.IPAccess {
+	return n.ipAccess
+}
+
+// ClassifyClient returns the rate limit class for an authenticated pubkey.
+// An empty pubkey means the connection has not authenticated.
+func (n *Node) ClassifyClient(pubkey string) limiter.ClientClass {
+	if pubkey == "" {
+		return limiter.ClassAnonymous
+	}
+	pubkey = strings.ToLower(pubkey)
+	n.whitelistMu.RLock()
+	_, whitelisted := n.whitelistPubKeys[pubkey]
+	n.whitelistMu.RUnlock()
+	if whitelisted {
+		return limiter.ClassWhitelisted
+	}
+	if _, paid := n.PaidAdmission(pubkey); paid {
+		return limiter.ClassPaid
+	}
+	return limiter.ClassAuthenticated
+}
+
+// PaidAdmission returns a pubkey's paid admission and whether it is active.
+// Admission stays active for PAYMENTS.GRACE_PERIOD after it lapses.
+func (n *Node) PaidAdmission(pubkey string) (storage.PaidPubkey, bool) {
+	n.paidMu.RLock()
+	paid, ok := n.paidPubKeys[strings.ToLower(pubkey)]
+	n.paidMu.RUnlock()
+	return paid, ok && paid.Active(time.Now().Add(-n.config.Payments.GracePeriod).Unix())
+}
+
+// SetPaid marks a pubkey as a paying client in tier until paidUntil (0 for no
+// expiry) and queues an admission.granted webhook when webhooks are configured.
+func (n *Node) SetPaid(pubkey string, paidUntil int64, tier string) {
+	pubkey = strings.ToLower(pubkey)
+	n.paidMu.Lock()
+	n.paidPubKeys[pubkey] = storage.PaidPubkey{PubKey: pubkey, PaidUntil: paidUntil, Tier: tier}
+	n.paidMu.Unlock()
+
+	if n.webhooks != nil {
+		ctx, cancel := context.WithTimeout(n.ctx, 10*time.Second)
+		defer cancel()
+		n.webhooks.AdmissionGranted(ctx, pubkey, paidUntil, tier)
+	}
+}
+
+// RevokePaid unmarks a pubkey as a paying client.
+func (n *Node) RevokePaid(pubkey string) {
+	n.paidMu.Lock()
+	defer n.paidMu.Unlock()
+	delete(n.paidPubKeys, strings.ToLower(pubkey))
+}
+
+// Suspension returns a pubkey's suspension and whether it is suspended.
+func (n *Node) Suspension(pubkey string) (storage.Suspension, bool) {
+	n.suspendedMu.RLock()
+	defer n.suspendedMu.RUnlock()
+	s, ok := n.suspended[strings.ToLower(pubkey)]
+	return s, ok
+}
+
+// Suspend bars a pubkey from publishing.
+func (n *Node) Suspend(s storage.Suspension) {
+	s.PubKey = strings.ToLower(s.PubKey)
+	n.suspendedMu.Lock()
+	defer n.suspendedMu.Unlock()
+	n.suspended[s.PubKey] = s
+}
+
+// Reinstate lifts a pubkey's suspension.
+func (n *Node) Reinstate(pubkey string) {
+	n.suspendedMu.Lock()
+	defer n.suspendedMu.Unlock()
+	delete(n.suspended, strings.ToLower(pubkey))
+}
+
+// vanishKey keys the vanished pubkeys by tenant and pubkey
+func vanishKey(tenant, pubkey string) string {
+	return tenant + "/" + strings.ToLower(pubkey)
+}
+
+// Vanished returns the NIP-62 request to vanish a pubkey sent to tenant and
+// whether it sent one.
+func (n *Node) Vanished(tenant, pubkey string) (storage.Vanish, bool) {
+	n.vanishedMu.RLock()
+	defer n.vanishedMu.RUnlock()
+	v, ok := n.vanished[vanishKey(tenant, pubkey)]
+	return v, ok
+}
+
+// RecordVanish remembers a pubkey that asked to vanish.
+func (n *Node) RecordVanish(v storage.Vanish) {
+	n.vanishedMu.Lock()
+	defer n.vanishedMu.Unlock()
+	n.vanished[vanishKey(v.Tenant, v.PubKey)] = v
+}
+
+// FreeQuota returns the daily event quota of unpaid authors, or nil when there is none.
+func (n *Node) FreeQuota() *limiter.DailyQuota {
+	return n.freeQuota
+}
+
+// Challenge returns the proof of work challenge of unverified clients, or nil when it is disabled.
+func (n *Node) Challenge() *limiter.Challenge {
+	return n.challenge
+}
+
+// Sessions returns the client session tracker, or nil when it is disabled.
+func (n *Node) Sessions() *sessions.Tracker {
+	return n.sessions
+}
+
+// Captures returns the recorder of client frame captures, or nil without the admin API.
+func (n *Node) Captures() *capture.Recorder {
+	return n.captures
+}
+
+// Rebroadcasts returns the jobs republishing stored events to other relays, or nil without the admin API.
+func (n *Node) Rebroadcasts() *rebroadcast.Manager {
+	return n.rebroadcasts
+}
+
+// QueryAnalytics returns the aggregate of the REQ filters served, or nil when it is disabled.
+func (n *Node) QueryAnalytics() *analytics.Recorder {
+	return n.queryAnalytics
+}
+
+// MOTD returns the messages of the day, or nil when they are disabled.
+func (n *Node) MOTD() *motd.Board {
+	return n.motd
+}
+
+// Draining returns a channel closed once the node starts shutting down.
+func (n *Node) Draining() <-chan struct{} {
+	return n.draining
+}
+
+// Payments returns the lightning payment service, or nil when no backend is configured.
+func (n *Node) Payments() *payments.Service {
+	return n.payments
+}
+
+// Zaps returns the zap top-up creditor, or nil when zaps are not credited.
+func (n *Node) Zaps() *payments.ZapCreditor {
+	return n.zaps
+}
+
+// Cashu returns the Cashu payment redeemer, or nil when Cashu is not accepted.
+func (n *Node) Cashu() *payments.CashuRedeemer {
+	return n.cashu
+}
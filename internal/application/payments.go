@@ -0,0 +1,110 @@
+package application
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/storage"
+	"go.uber.org/zap"
+)
+
+// defaultPaidRefreshInterval is used when PAYMENTS.REFRESH_INTERVAL is unset
+const defaultPaidRefreshInterval = time.Minute
+
+// runAdmissionRefresher keeps the in-memory paid pubkeys, suspensions and
+// vanished pubkeys in sync with the database, so admissions, suspensions and
+// vanish requests recorded on any node and lapsed payments take effect. Paid
+// pubkeys are only tracked when payments or invites are enabled.
+func (n *Node) runAdmissionRefresher(ctx context.Context) {
+	interval := n.config.Payments.RefreshInterval
+	if interval <= 0 {
+		interval = defaultPaidRefreshInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	trackPaid := n.config.Payments.Enabled || n.config.Invites.Enabled
+	refresh := func() {
+		if trackPaid {
+			n.refreshPaidPubkeys(ctx)
+		}
+		n.refreshSuspensions(ctx)
+		n.refreshVanished(ctx)
+	}
+
+	refresh()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			refresh()
+		}
+	}
+}
+
+// refreshPaidPubkeys replaces the in-memory paid pubkeys with the rows still
+// active or within PAYMENTS.GRACE_PERIOD
+func (n *Node) refreshPaidPubkeys(ctx context.Context) {
+	loadCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	paid, err := n.db.GetPaidPubkeys(loadCtx, time.Now().Add(-n.config.Payments.GracePeriod).Unix())
+	if err != nil {
+		logger.Warn("Failed to refresh paid pubkeys", zap.Error(err))
+		return
+	}
+
+	paidPubKeys := make(map[string]storage.PaidPubkey, len(paid))
+	for _, p := range paid {
+		paidPubKeys[strings.ToLower(p.PubKey)] = p
+	}
+	n.paidMu.Lock()
+	n.paidPubKeys = paidPubKeys
+	n.paidMu.Unlock()
+	logger.Debug("Refreshed paid pubkeys", zap.Int("count", len(paidPubKeys)))
+}
+
+// refreshSuspensions replaces the in-memory suspensions with the stored ones
+func (n *Node) refreshSuspensions(ctx context.Context) {
+	loadCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	suspensions, err := n.db.GetSuspensions(loadCtx)
+	if err != nil {
+		logger.Warn("Failed to refresh suspensions", zap.Error(err))
+		return
+	}
+
+	suspended := make(map[string]storage.Suspension, len(suspensions))
+	for _, s := range suspensions {
+		suspended[strings.ToLower(s.PubKey)] = s
+	}
+	n.suspendedMu.Lock()
+	n.suspended = suspended
+	n.suspendedMu.Unlock()
+	logger.Debug("Refreshed suspensions", zap.Int("count", len(suspended)))
+}
+
+// refreshVanished replaces the in-memory vanished pubkeys with the stored ones
+func (n *Node) refreshVanished(ctx context.Context) {
+	loadCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	vanishes, err := n.db.GetVanishes(loadCtx)
+	if err != nil {
+		logger.Warn("Failed to refresh vanished pubkeys", zap.Error(err))
+		return
+	}
+
+	vanished := make(map[string]storage.Vanish, len(vanishes))
+	for _, v := range vanishes {
+		vanished[vanishKey(v.Tenant, v.PubKey)] = v
+	}
+	n.vanishedMu.Lock()
+	n.vanished = vanished
+	n.vanishedMu.Unlock()
+	logger.Debug("Refreshed vanished pubkeys", zap.Int("count", len(vanished)))
+}
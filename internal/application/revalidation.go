@@ -0,0 +1,234 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/metrics"
+	"github.com/Shugur-Network/relay/internal/storage"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+const (
+	// revalidationBatch bounds the events checked between progress saves
+	revalidationBatch = 500
+	// revalidationPoll is how often nodes look for a run to take over
+	revalidationPoll = time.Minute
+	// revalidationLease is how long a run stays with the node that saved its
+	// progress last before another node may take it over
+	revalidationLease = 2 * time.Minute
+)
+
+// runRevalidation runs the revalidation runs recorded through the admin API. A run
+// is taken by whichever node finds it first and resumed from its last saved batch
+// by any node once that node stops renewing it.
+func (n *Node) runRevalidation(ctx context.Context) {
+	ticker := time.NewTicker(revalidationPoll)
+	defer ticker.Stop()
+
+	for {
+		n.scheduleIntegrityCheck(ctx)
+		n.claimRevalidation(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-n.revalidate:
+		}
+	}
+}
+
+// ResumeRevalidation wakes the revalidation runner, so a newly recorded run starts
+// without waiting for the next poll
+func (n *Node) ResumeRevalidation() {
+	select {
+	case n.revalidate <- struct{}{}:
+	default:
+	}
+}
+
+// scheduleIntegrityCheck records an integrity run once DATABASE.INTEGRITY_CHECK_INTERVAL
+// passed since the last one started. Runs are shared by the cluster, so whichever
+// node gets there first records it for all.
+func (n *Node) scheduleIntegrityCheck(ctx context.Context) {
+	cfg := n.config.Database
+	if cfg.IntegrityCheckInterval <= 0 {
+		return
+	}
+	last, err := n.db.LastRevalidationRun(ctx, storage.RevalidateIntegrity)
+	if err != nil {
+		logger.Warn("Failed to load the last integrity check", zap.Error(err))
+		return
+	}
+	now := time.Now()
+	if last != nil && now.Sub(time.Unix(last.StartedAt, 0)) < cfg.IntegrityCheckInterval {
+		return
+	}
+
+	action := cfg.IntegrityCheckAction
+	if action == "" {
+		action = storage.RevalidateReport
+	}
+	run := storage.RevalidationRun{
+		ID:        strconv.FormatInt(now.UnixNano(), 36),
+		Action:    action,
+		Mode:      storage.RevalidateIntegrity,
+		Status:    storage.RevalidationRunning,
+		StartedAt: now.Unix(),
+	}
+	err = n.db.CreateRevalidationRun(ctx, run)
+	if errors.Is(err, storage.ErrRevalidationRunning) {
+		// Checked again once the run in progress is done
+		return
+	}
+	if err != nil {
+		logger.Warn("Failed to schedule integrity check", zap.Error(err))
+		return
+	}
+	logger.Info("Scheduled integrity check of stored events",
+		zap.String("run_id", run.ID),
+		zap.String("action", run.Action))
+}
+
+// claimRevalidation takes over the run in progress when no node holds it and runs
+// it to completion
+func (n *Node) claimRevalidation(ctx context.Context) {
+	now := time.Now()
+	run, err := n.db.ClaimRevalidationRun(ctx, now.Add(-revalidationLease).Unix(), now.Unix())
+	if err != nil {
+		logger.Warn("Failed to claim revalidation run", zap.Error(err))
+		return
+	}
+	if run == nil {
+		return
+	}
+
+	logger.Info("Revalidating stored events",
+		zap.String("run_id", run.ID),
+		zap.String("action", run.Action),
+		zap.String("mode", run.Mode),
+		zap.Ints("kinds", run.Kinds),
+		zap.Int64("scanned", run.Scanned))
+	n.revalidateRun(ctx, run)
+}
+
+// revalidateRun checks the stored events of run batch by batch, acting on those
+// that fail, until every event was checked, the run is canceled or ctx is done
+func (n *Node) revalidateRun(ctx context.Context, run *storage.RevalidationRun) {
+	for {
+		batch, err := n.db.GetEventsAfter(ctx, run.CursorTenant, run.Cursor, run.Kinds, revalidationBatch)
+		if err == nil {
+			err = n.revalidateBatch(ctx, run, batch)
+		}
+		if ctx.Err() != nil {
+			// Another node, or this one once restarted, resumes after the lease
+			return
+		}
+
+		switch {
+		case err != nil:
+			run.Status = storage.RevalidationFailed
+			run.Error = err.Error()
+		case len(batch) < revalidationBatch:
+			run.Status = storage.RevalidationDone
+		}
+		run.UpdatedAt = time.Now().Unix()
+
+		running, saveErr := n.db.SaveRevalidationProgress(ctx, run)
+		if saveErr != nil {
+			logger.Warn("Failed to save revalidation progress", zap.String("run_id", run.ID), zap.Error(saveErr))
+			return
+		}
+		if !running {
+			logger.Info("Revalidation run canceled",
+				zap.String("run_id", run.ID),
+				zap.Int64("scanned", run.Scanned),
+				zap.Int64("failed", run.Failed))
+			return
+		}
+		if run.Status != storage.RevalidationRunning {
+			logger.Info("Revalidation run finished",
+				zap.String("run_id", run.ID),
+				zap.String("status", run.Status),
+				zap.Int64("scanned", run.Scanned),
+				zap.Int64("failed", run.Failed),
+				zap.String("error", run.Error))
+			return
+		}
+	}
+}
+
+// revalidateBatch checks batch as run's mode asks, quarantines or deletes the
+// events failing as run asks, and advances run past the batch
+func (n *Node) revalidateBatch(ctx context.Context, run *storage.RevalidationRun, batch []storage.TenantEvent) error {
+	var failing []storage.TenantEvent
+	var reasons []string
+	for _, te := range batch {
+		evt := te.Event
+		if run.Mode == storage.RevalidateIntegrity {
+			if ok, reason := verifyIntegrity(evt); !ok {
+				logger.Warn("Stored event failed integrity check",
+					zap.String("run_id", run.ID),
+					zap.String("tenant", te.Tenant),
+					zap.String("event_id", evt.ID),
+					zap.String("reason", reason))
+				metrics.CorruptedEvents.Inc()
+				failing = append(failing, te)
+				reasons = append(reasons, reason)
+			}
+			continue
+		}
+		if ok, reason := n.revalidateEvent(ctx, evt); !ok {
+			failing = append(failing, te)
+			reasons = append(reasons, reason)
+		}
+	}
+
+	var err error
+	switch run.Action {
+	case storage.RevalidateQuarantine:
+		err = n.db.QuarantineEvents(ctx, failing, reasons, run.ID, time.Now().Unix())
+	case storage.RevalidateDelete:
+		err = n.db.DeleteEvents(ctx, failing)
+	}
+	if err != nil {
+		return err
+	}
+
+	run.Scanned += int64(len(batch))
+	run.Failed += int64(len(failing))
+	if len(batch) > 0 {
+		last := batch[len(batch)-1]
+		run.CursorTenant, run.Cursor = last.Tenant, last.Event.ID
+	}
+	return nil
+}
+
+// revalidateEvent checks a stored event against the configured blacklist, the
+// suspensions and the validation policies it would be checked against today
+func (n *Node) revalidateEvent(ctx context.Context, evt nostr.Event) (bool, string) {
+	if _, ok := n.blacklistPubKeys[strings.ToLower(evt.PubKey)]; ok {
+		return false, "pubkey is blacklisted"
+	}
+	if _, ok := n.Suspension(evt.PubKey); ok {
+		return false, "pubkey is suspended"
+	}
+	return n.Validator.RevalidateEvent(ctx, evt)
+}
+
+// verifyIntegrity checks that a stored event's ID is the hash of its content and
+// that its signature verifies
+func verifyIntegrity(evt nostr.Event) (bool, string) {
+	if evt.GetID() != evt.ID {
+		return false, "event ID doesn't match its content"
+	}
+	if ok, err := evt.CheckSignature(); err != nil || !ok {
+		return false, "invalid signature"
+	}
+	return true, ""
+}
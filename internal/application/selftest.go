@@ -0,0 +1,145 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/identity"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/metrics"
+	"github.com/Shugur-Network/relay/internal/selftest"
+	"github.com/Shugur-Network/relay/internal/storage"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+// runSelfTest checks the deployment once SELFTEST.DELAY after startup, when the
+// listeners are up, and logs the report the dashboard and /api/admin/selftest show
+func (n *Node) runSelfTest(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(n.config.SelfTest.Delay):
+	}
+
+	report := selftest.Run(ctx, n.selfTestChecks(), n.config.SelfTest.Timeout)
+	failures := 0
+	for _, result := range report.Results {
+		switch result.Status {
+		case selftest.StatusFail:
+			failures++
+			logger.Error("Self-test check failed", zap.String("check", result.Name), zap.String("message", result.Message))
+		case selftest.StatusWarn:
+			logger.Warn("Self-test check warned", zap.String("check", result.Name), zap.String("message", result.Message))
+		}
+	}
+	metrics.SelfTestFailures.Set(float64(failures))
+	logger.Info("Self-test finished",
+		zap.String("status", string(report.Status)),
+		zap.Int("checks", len(report.Results)),
+		zap.Int("failed", failures),
+		zap.Duration("took", report.FinishedAt.Sub(report.StartedAt)))
+}
+
+// selfTestChecks returns the checks of the self-test, in the order they run
+func (n *Node) selfTestChecks() []selftest.Check {
+	cfg := n.config
+	return []selftest.Check{
+		{Name: "schema", Run: n.checkSchema},
+		{Name: "changefeed", Run: n.checkChangefeed},
+		{Name: "disk", Run: func(context.Context) (selftest.Status, string, map[string]interface{}) {
+			return selftest.DiskSpace(n.dataDirs(), uint64(cfg.SelfTest.MinFreeDisk))
+		}},
+		{Name: "identity", Run: checkIdentity},
+		{Name: "relay_port", Run: func(ctx context.Context) (selftest.Status, string, map[string]interface{}) {
+			return selftest.Listening(ctx, cfg.Relay.WSAddr)
+		}},
+		{Name: "metrics_port", Run: func(ctx context.Context) (selftest.Status, string, map[string]interface{}) {
+			if !cfg.Metrics.Enabled {
+				return selftest.StatusSkip, "Metrics are disabled", nil
+			}
+			return selftest.Listening(ctx, net.JoinHostPort(cfg.Metrics.Address, strconv.Itoa(cfg.Metrics.Port)))
+		}},
+		{Name: "onion_port", Run: func(ctx context.Context) (selftest.Status, string, map[string]interface{}) {
+			if !cfg.Tor.Enabled {
+				return selftest.StatusSkip, "Tor is disabled", nil
+			}
+			return selftest.Listening(ctx, cfg.Tor.ListenAddr)
+		}},
+		{Name: "outbound", Run: func(ctx context.Context) (selftest.Status, string, map[string]interface{}) {
+			return selftest.Reachable(ctx, cfg.SelfTest.OutboundHosts)
+		}},
+	}
+}
+
+// checkSchema checks that the database applied every schema migration
+func (n *Node) checkSchema(ctx context.Context) (selftest.Status, string, map[string]interface{}) {
+	version, pending, err := n.db.SchemaVersion(ctx)
+	if err != nil {
+		return selftest.StatusFail, fmt.Sprintf("Failed to read the schema version: %v", err), nil
+	}
+	details := map[string]interface{}{"version": version, "latest": storage.LatestSchemaVersion()}
+	if len(pending) == 0 {
+		return selftest.StatusPass, fmt.Sprintf("Schema is at version %d", version), details
+	}
+	details["pending"] = pending
+	for _, m := range pending {
+		if !m.Unsupported {
+			return selftest.StatusFail, fmt.Sprintf("Schema is at version %d, migration %d (%s) is not applied", version, m.Version, m.Name), details
+		}
+	}
+	return selftest.StatusWarn, fmt.Sprintf("Schema is at version %d, %d migrations need a newer CockroachDB", version, len(pending)), details
+}
+
+// checkChangefeed checks that events stored by other nodes can be picked up
+func (n *Node) checkChangefeed(ctx context.Context) (selftest.Status, string, map[string]interface{}) {
+	if n.EventDispatcher == nil {
+		return selftest.StatusFail, "Event dispatcher is not running", nil
+	}
+	cluster, err := n.EventDispatcher.CheckSync(ctx)
+	if err != nil {
+		return selftest.StatusFail, fmt.Sprintf("Cross-node synchronization doesn't work: %v", err), nil
+	}
+	if !cluster {
+		return selftest.StatusSkip, "Single-node database, nothing to synchronize", nil
+	}
+	return selftest.StatusPass, "Cross-node synchronization works", nil
+}
+
+// checkIdentity checks that the relay can sign with its identity, without
+// publishing what it signs
+func checkIdentity(ctx context.Context) (selftest.Status, string, map[string]interface{}) {
+	signer, err := identity.ActiveSigner()
+	if err != nil {
+		return selftest.StatusFail, fmt.Sprintf("Relay identity is unavailable: %v", err), nil
+	}
+	details := map[string]interface{}{"pubkey": signer.PublicKey(), "signer": signer.Kind()}
+
+	evt := nostr.Event{Kind: nostr.KindTextNote, CreatedAt: nostr.Now(), Tags: nostr.Tags{}, Content: "selftest"}
+	if err := signer.SignEvent(ctx, &evt); err != nil {
+		return selftest.StatusFail, fmt.Sprintf("Relay identity failed to sign: %v", err), details
+	}
+	if ok, err := evt.CheckSignature(); !ok || err != nil {
+		return selftest.StatusFail, "Relay identity produced an invalid signature", details
+	}
+	return selftest.StatusPass, "Relay identity signs", details
+}
+
+// dataDirs returns the directories the relay writes to
+func (n *Node) dataDirs() []string {
+	dirs := []string{"."}
+	if file := n.config.Logging.FilePath; file != "" {
+		dirs = append(dirs, filepath.Dir(file))
+	}
+	if file, err := identity.KeyFilePath(); err == nil {
+		dirs = append(dirs, filepath.Dir(file))
+	}
+	if n.config.Admin.Enabled {
+		dirs = append(dirs, n.config.Admin.Capture.Dir)
+	}
+	return dirs
+}
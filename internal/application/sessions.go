@@ -0,0 +1,24 @@
+package application
+
+import (
+	"context"
+	"time"
+)
+
+// sessionSweepInterval is how often sessions gone idle are forgotten
+const sessionSweepInterval = time.Minute
+
+// runSessionSweep forgets the client sessions without connections once they
+// have been idle for RELAY.SESSIONS.RETENTION
+func (n *Node) runSessionSweep(ctx context.Context) {
+	ticker := time.NewTicker(sessionSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n.sessions.Sweep()
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package application
+
+import (
+	"context"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/config"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"go.uber.org/zap"
+)
+
+// sinkChangefeedRetry is how long to wait before checking the sink changefeed
+// again while another node is checking it
+const sinkChangefeedRetry = 30 * time.Second
+
+// setUpSinkChangefeed makes sure the changefeed into SINK.URL runs when the sink
+// is in changefeed mode, and cancels it otherwise. The changefeed is a cluster
+// job, so whichever node starts first creates it and the others find it running.
+func (n *Node) setUpSinkChangefeed(ctx context.Context) {
+	cfg := n.config.Sink
+	if !cfg.Enabled || cfg.Mode != config.SinkChangefeed {
+		jobID, err := n.db.DropSinkChangefeed(ctx)
+		if err != nil {
+			logger.Warn("Failed to cancel the sink changefeed", zap.Error(err))
+		} else if jobID != 0 {
+			logger.Info("Sink changefeed canceled", zap.Int64("job_id", jobID))
+		}
+		return
+	}
+
+	for {
+		jobID, created, err := n.db.EnsureSinkChangefeed(ctx, cfg.URL, cfg.Kinds, time.Now().Unix())
+		switch {
+		case err != nil:
+			logger.Error("Failed to set up the sink changefeed, events aren't delivered to the sink",
+				zap.Error(err))
+			return
+		case created:
+			logger.Info("Sink changefeed created",
+				zap.Int64("job_id", jobID),
+				zap.Ints("kinds", cfg.Kinds))
+			return
+		case jobID != 0:
+			logger.Info("Sink changefeed running", zap.Int64("job_id", jobID))
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(sinkChangefeedRetry):
+		}
+	}
+}
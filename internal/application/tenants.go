@@ -0,0 +1,104 @@
+package application
+
+import (
+	"context"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/domain"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/storage"
+	"go.uber.org/zap"
+)
+
+// tenantSyncInterval is how often the tenants created at runtime and the counts
+// of their stored events are reloaded from the database, and the metered usage
+// is recorded
+const tenantSyncInterval = time.Minute
+
+// runTenantSync keeps the tenants created through the admin API of any node in
+// the registry, and the stored event counts their quotas are checked against,
+// and records the usage metered by this node
+func (n *Node) runTenantSync(ctx context.Context) {
+	ticker := time.NewTicker(tenantSyncInterval)
+	defer ticker.Stop()
+
+	n.syncTenants(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n.syncTenants(ctx)
+			n.flushTenantUsage(ctx)
+		}
+	}
+}
+
+// flushTenantUsage adds the usage metered since the last flush to today's
+// usage in the database, keeping it metered when it can't be recorded
+func (n *Node) flushTenantUsage(ctx context.Context) {
+	usage := n.tenantMeter.Drain()
+	if len(usage) == 0 {
+		return
+	}
+	flushCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	day := time.Now().UTC().Truncate(24 * time.Hour).Unix()
+	if err := n.db.AddTenantUsage(flushCtx, day, usage); err != nil {
+		logger.Warn("Failed to record tenant usage", zap.Error(err))
+		n.tenantMeter.Restore(usage)
+	}
+}
+
+// syncTenants reloads the stored tenants and drops the connections of those that
+// were deleted or suspended meanwhile
+func (n *Node) syncTenants(ctx context.Context) {
+	loadCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	stored, err := n.db.GetTenants(loadCtx)
+	if err != nil {
+		logger.Warn("Failed to sync tenants", zap.Error(err))
+		return
+	}
+	for _, t := range n.tenants.Sync(stored) {
+		logger.Warn("Ignoring stored tenant clashing with a configured one", zap.String("tenant", t.ID))
+	}
+
+	counts, err := n.db.CountTenantEvents(loadCtx)
+	if err != nil {
+		logger.Warn("Failed to count tenant events", zap.Error(err))
+	} else {
+		n.tenants.SetStoredEvents(counts)
+	}
+
+	for _, conn := range n.conns.all() {
+		if id := conn.Tenant(); id != storage.DefaultTenant {
+			if t, ok := n.tenants.Get(id); !ok || t.Suspended {
+				conn.Close()
+			}
+		}
+	}
+	logger.Debug("Synced tenants", zap.Int("count", n.tenants.Len()))
+}
+
+// TenantConnections returns the number of clients connected to the tenant
+func (n *Node) TenantConnections(id string) int {
+	count := 0
+	n.conns.each(func(conn domain.WebSocketConnection) {
+		if conn.Tenant() == id {
+			count++
+		}
+	})
+	return count
+}
+
+// DisconnectTenant closes the connections of every client of the tenant
+func (n *Node) DisconnectTenant(id string) {
+	for _, conn := range n.conns.all() {
+		if conn.Tenant() == id {
+			conn.Close()
+		}
+	}
+}
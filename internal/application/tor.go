@@ -0,0 +1,62 @@
+package application
+
+import (
+	"context"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/tor"
+	"go.uber.org/zap"
+)
+
+// onionRetryInterval is how long to wait before publishing the onion service
+// again after the control port failed or went away
+const onionRetryInterval = 30 * time.Second
+
+// runOnionService publishes the relay as an onion service through tor's control
+// port and keeps it published until ctx is done. Without a control port the
+// service is configured in torrc and only its address is recorded.
+func (n *Node) runOnionService(ctx context.Context) {
+	cfg := n.config.Tor
+	if cfg.ControlAddr == "" {
+		tor.SetAddress(cfg.OnionAddress)
+		logger.Info("Relay published as onion service", zap.String("address", cfg.OnionAddress))
+		return
+	}
+
+	for {
+		err := n.publishOnion(ctx)
+		tor.SetAddress("")
+		if err != nil {
+			logger.Warn("Onion service is down",
+				zap.String("control_addr", cfg.ControlAddr),
+				zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(onionRetryInterval):
+		}
+	}
+}
+
+// publishOnion publishes the onion service and holds the control connection the
+// service lives on until ctx is done or tor closes it
+func (n *Node) publishOnion(ctx context.Context) error {
+	cfg := n.config.Tor
+	controller, err := tor.Dial(ctx, cfg.ControlAddr)
+	if err != nil {
+		return err
+	}
+	defer controller.Close()
+
+	addr, err := controller.Publish(cfg.ControlPassword, cfg.KeyFile, cfg.ListenAddr)
+	if err != nil {
+		return err
+	}
+	tor.SetAddress(addr)
+	logger.Info("Relay published as onion service", zap.String("address", addr))
+
+	return controller.Wait(ctx)
+}
@@ -0,0 +1,222 @@
+// Package blocklist screens the URLs linked from events against blocked domains,
+// configured by the operator or synced from remote phishing and malware feeds.
+package blocklist
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	nostr "github.com/nbd-wtf/go-nostr"
+)
+
+// maxFeedSize limits the size of a remote feed
+const maxFeedSize = 32 << 20
+
+// urlPattern finds http(s) URLs in free text
+var urlPattern = regexp.MustCompile(`(?i)https?://[^\s<>"'\x60]+`)
+
+// Domains is a set of blocked domains. A blocked domain blocks its subdomains.
+type Domains struct {
+	mu         sync.RWMutex
+	configured map[string]struct{}
+	// feeds holds the domains of each remote feed, by feed URL
+	feeds map[string]map[string]struct{}
+}
+
+// NewDomains returns a blocklist of the configured domains
+func NewDomains(domains []string) *Domains {
+	configured := make(map[string]struct{}, len(domains))
+	for _, d := range domains {
+		if d = normalizeDomain(d); d != "" {
+			configured[d] = struct{}{}
+		}
+	}
+	return &Domains{
+		configured: configured,
+		feeds:      make(map[string]map[string]struct{}),
+	}
+}
+
+// SetFeed replaces the domains synced from the feed at feedURL
+func (b *Domains) SetFeed(feedURL string, domains map[string]struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.feeds[feedURL] = domains
+}
+
+// Len returns the number of entries of the configured domains and feeds together
+func (b *Domains) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	n := len(b.configured)
+	for _, domains := range b.feeds {
+		n += len(domains)
+	}
+	return n
+}
+
+// Blocked returns the blocked domain host is or belongs to
+func (b *Domains) Blocked(host string) (string, bool) {
+	host = normalizeDomain(host)
+	if host == "" {
+		return "", false
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.blocked(host)
+}
+
+// blocked returns the listed domain host is or belongs to; b.mu must be held
+func (b *Domains) blocked(host string) (string, bool) {
+	for d := host; ; {
+		if b.contains(d) {
+			return d, true
+		}
+		dot := strings.IndexByte(d, '.')
+		if dot == -1 {
+			return "", false
+		}
+		d = d[dot+1:]
+	}
+}
+
+// contains reports whether domain is listed; b.mu must be held
+func (b *Domains) contains(domain string) bool {
+	if _, ok := b.configured[domain]; ok {
+		return true
+	}
+	for _, domains := range b.feeds {
+		if _, ok := domains[domain]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// BlockedIn returns the first blocked domain linked from evt, in its content or
+// its NIP-92 imeta tags
+func (b *Domains) BlockedIn(evt *nostr.Event) (string, bool) {
+	hosts := EventHosts(evt)
+	if len(hosts) == 0 {
+		return "", false
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, host := range hosts {
+		if domain, ok := b.blocked(host); ok {
+			return domain, true
+		}
+	}
+	return "", false
+}
+
+// EventHosts returns the distinct hosts of the URLs in the content and imeta
+// tags of evt; imeta URLs usually repeat those in the content
+func EventHosts(evt *nostr.Event) []string {
+	var hosts []string
+	seen := make(map[string]bool)
+	add := func(text string) {
+		for _, raw := range urlPattern.FindAllString(text, -1) {
+			u, err := url.Parse(raw)
+			if err != nil || u.Hostname() == "" {
+				continue
+			}
+			host := normalizeDomain(u.Hostname())
+			if host != "" && !seen[host] {
+				seen[host] = true
+				hosts = append(hosts, host)
+			}
+		}
+	}
+
+	add(evt.Content)
+	for _, tag := range evt.Tags {
+		if len(tag) < 2 || tag[0] != "imeta" {
+			continue
+		}
+		// Entries are "url <url>", "fallback <url>", ...
+		for _, entry := range tag[1:] {
+			add(entry)
+		}
+	}
+	return hosts
+}
+
+// FetchFeed downloads and parses the feed at feedURL
+func FetchFeed(ctx context.Context, client *http.Client, feedURL string) (map[string]struct{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid feed URL: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch feed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed returned status %d", resp.StatusCode)
+	}
+	return ParseFeed(io.LimitReader(resp.Body, maxFeedSize))
+}
+
+// ParseFeed reads a domain list: one domain per line, hosts file lines
+// ("0.0.0.0 domain"), adblock rules ("||domain^") or URLs. Blank lines and
+// comments starting with # or ! are skipped.
+func ParseFeed(r io.Reader) (map[string]struct{}, error) {
+	domains := make(map[string]struct{})
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+		if i := strings.IndexByte(line, '#'); i != -1 {
+			line = strings.TrimSpace(line[:i])
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		entry := fields[0]
+		if len(fields) >= 2 && net.ParseIP(fields[0]) != nil {
+			entry = fields[1]
+		}
+		entry = strings.TrimSuffix(strings.TrimPrefix(entry, "||"), "^")
+		if strings.Contains(entry, "://") {
+			u, err := url.Parse(entry)
+			if err != nil {
+				continue
+			}
+			entry = u.Hostname()
+		}
+		if d := normalizeDomain(entry); d != "" && strings.Contains(d, ".") {
+			domains[d] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read feed: %w", err)
+	}
+	return domains, nil
+}
+
+// normalizeDomain lowercases a domain and drops a trailing dot, returning ""
+// for what can't be a domain
+func normalizeDomain(d string) string {
+	d = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(d)), ".")
+	if d == "" || strings.ContainsAny(d, " /:@") {
+		return ""
+	}
+	return d
+}
@@ -0,0 +1,92 @@
+package blocklist
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// IPAccess decides which client addresses may connect from CIDR ranges. A
+// denied range always refuses; when allowed ranges are listed, addresses
+// outside them are refused too.
+type IPAccess struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// NewIPAccess parses the allowed and denied ranges. Entries are CIDR ranges or
+// single addresses, IPv4 or IPv6.
+func NewIPAccess(allow, deny []string) (*IPAccess, error) {
+	a := &IPAccess{}
+	var err error
+	if a.allow, err = parsePrefixes(allow); err != nil {
+		return nil, err
+	}
+	if a.deny, err = parsePrefixes(deny); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Enabled reports whether any range is listed
+func (a *IPAccess) Enabled() bool {
+	return len(a.allow) > 0 || len(a.deny) > 0
+}
+
+// Check returns why ip is refused: "denied" when it is in a denied range,
+// "not_allowed" when it is outside the allowed ones, "" when it may connect.
+// An address that can't be parsed is refused as soon as any range is listed.
+func (a *IPAccess) Check(ip string) string {
+	if !a.Enabled() {
+		return ""
+	}
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return "not_allowed"
+	}
+	addr = addr.Unmap()
+	if containsAddr(a.deny, addr) {
+		return "denied"
+	}
+	if len(a.allow) > 0 && !containsAddr(a.allow, addr) {
+		return "not_allowed"
+	}
+	return ""
+}
+
+// containsAddr reports whether addr is in one of prefixes
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePrefixes parses CIDR ranges and single addresses, the latter as ranges of
+// one address
+func parsePrefixes(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if strings.Contains(entry, "/") {
+			p, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR range %q: %w", entry, err)
+			}
+			if p.Addr().Is4In6() && p.Bits() >= 96 {
+				p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP address %q: %w", entry, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,268 @@
+package blocklist
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	nostr "github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// Entry types of a blocklist feed
+const (
+	EntryPubKey = "pubkey"
+	EntryEvent  = "event"
+	EntryDomain = "domain"
+)
+
+// KindMuteList is the kind of NIP-51 mute lists
+const KindMuteList = 10000
+
+// List is what a blocklist feed blocks
+type List struct {
+	PubKeys map[string]struct{}
+	Events  map[string]struct{}
+	Domains map[string]struct{}
+}
+
+// NewList returns an empty list
+func NewList() List {
+	return List{
+		PubKeys: make(map[string]struct{}),
+		Events:  make(map[string]struct{}),
+		Domains: make(map[string]struct{}),
+	}
+}
+
+// Entries are the pubkeys and event IDs blocked by feeds, kept by feed so each
+// entry can be traced back to the feeds listing it
+type Entries struct {
+	mu sync.RWMutex
+	// pubkeys and events hold the entries of each feed, by feed name
+	pubkeys map[string]map[string]struct{}
+	events  map[string]map[string]struct{}
+}
+
+// NewEntries returns an empty set of feed entries
+func NewEntries() *Entries {
+	return &Entries{
+		pubkeys: make(map[string]map[string]struct{}),
+		events:  make(map[string]map[string]struct{}),
+	}
+}
+
+// Set replaces the pubkeys and event IDs of the feed
+func (e *Entries) Set(feed string, list List) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pubkeys[feed] = list.PubKeys
+	e.events[feed] = list.Events
+}
+
+// PubKey returns the first feed, in name order, blocking pubkey
+func (e *Entries) PubKey(pubkey string) (string, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return firstFeed(e.pubkeys, strings.ToLower(pubkey))
+}
+
+// Event returns the first feed, in name order, blocking the event with id
+func (e *Entries) Event(id string) (string, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return firstFeed(e.events, strings.ToLower(id))
+}
+
+// Len returns the number of entries of every feed together
+func (e *Entries) Len() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	n := 0
+	for _, pubkeys := range e.pubkeys {
+		n += len(pubkeys)
+	}
+	for _, events := range e.events {
+		n += len(events)
+	}
+	return n
+}
+
+// firstFeed returns the lowest named feed listing value
+func firstFeed(feeds map[string]map[string]struct{}, value string) (string, bool) {
+	found := ""
+	for feed, entries := range feeds {
+		if _, ok := entries[value]; ok && (found == "" || feed < found) {
+			found = feed
+		}
+	}
+	return found, found != ""
+}
+
+// FetchList downloads and parses the list at listURL, reading its hex and plain
+// entries as entryType
+func FetchList(ctx context.Context, client *http.Client, listURL, entryType string) (List, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, listURL, nil)
+	if err != nil {
+		return List{}, fmt.Errorf("invalid list URL: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return List{}, fmt.Errorf("failed to fetch list: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return List{}, fmt.Errorf("list returned status %d", resp.StatusCode)
+	}
+	return ParseList(io.LimitReader(resp.Body, maxFeedSize), entryType)
+}
+
+// ParseList reads a list of entryType entries, one per line. Domain lists take
+// the forms ParseFeed does; pubkey and event lists take 64 hex characters, and
+// npub, nprofile, note and nevent entries are read as what they encode whatever
+// entryType is. Blank lines, comments and entries of no known form are skipped.
+func ParseList(r io.Reader, entryType string) (List, error) {
+	list := NewList()
+	if entryType == EntryDomain {
+		domains, err := ParseFeed(r)
+		if err != nil {
+			return List{}, err
+		}
+		list.Domains = domains
+		return list, nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0][0] == '#' || fields[0][0] == '!' {
+			continue
+		}
+		entry := strings.ToLower(fields[0])
+		switch {
+		case isHex64(entry) && entryType == EntryPubKey:
+			list.PubKeys[entry] = struct{}{}
+		case isHex64(entry) && entryType == EntryEvent:
+			list.Events[entry] = struct{}{}
+		default:
+			list.addBech32(entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return List{}, fmt.Errorf("failed to read list: %w", err)
+	}
+	return list, nil
+}
+
+// addBech32 adds the pubkey or event ID a NIP-19 entry encodes
+func (l List) addBech32(entry string) {
+	prefix, value, err := nip19.Decode(entry)
+	if err != nil {
+		return
+	}
+	switch v := value.(type) {
+	case string:
+		switch prefix {
+		case "npub":
+			l.PubKeys[v] = struct{}{}
+		case "note":
+			l.Events[v] = struct{}{}
+		}
+	case nostr.ProfilePointer:
+		l.PubKeys[v.PublicKey] = struct{}{}
+	case nostr.EventPointer:
+		l.Events[v.ID] = struct{}{}
+	}
+}
+
+// ListFromEvent returns the pubkeys and event IDs of the public "p" and "e" tags
+// of a NIP-51 list event
+func ListFromEvent(evt *nostr.Event) List {
+	list := NewList()
+	for _, tag := range evt.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		value := strings.ToLower(tag[1])
+		if !isHex64(value) {
+			continue
+		}
+		switch tag[0] {
+		case "p":
+			list.PubKeys[value] = struct{}{}
+		case "e":
+			list.Events[value] = struct{}{}
+		}
+	}
+	return list
+}
+
+// FetchListEvent returns the newest list event of author of kind found on
+// relays, named d when d is set. Relays that can't be reached are skipped.
+func FetchListEvent(ctx context.Context, relays []string, author string, kind int, d string) (*nostr.Event, error) {
+	filter := nostr.Filter{Authors: []string{author}, Kinds: []int{kind}, Limit: 1}
+	if d != "" {
+		filter.Tags = nostr.TagMap{"d": []string{d}}
+	}
+
+	var newest *nostr.Event
+	var lastErr error
+	for _, url := range relays {
+		events, err := queryRelay(ctx, url, filter)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, evt := range events {
+			if evt.PubKey != author || evt.Kind != kind {
+				continue
+			}
+			if ok, err := evt.CheckSignature(); err != nil || !ok {
+				continue
+			}
+			if newest == nil || evt.CreatedAt > newest.CreatedAt {
+				newest = evt
+			}
+		}
+	}
+	if newest == nil {
+		if lastErr != nil {
+			return nil, lastErr
+		}
+		return nil, fmt.Errorf("no kind %d list of %s found", kind, author)
+	}
+	return newest, nil
+}
+
+// queryRelay runs filter on the relay at url
+func queryRelay(ctx context.Context, url string, filter nostr.Filter) ([]*nostr.Event, error) {
+	relay, err := nostr.RelayConnect(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", url, err)
+	}
+	defer relay.Close()
+	events, err := relay.QuerySync(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", url, err)
+	}
+	return events, nil
+}
+
+// isHex64 reports whether s is 64 lowercase hex characters
+func isHex64(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,298 @@
+// Package capture records the raw frames exchanged with chosen clients to files,
+// so interoperability issues with a client can be debugged without turning on
+// debug logging for every connection.
+package capture
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/config"
+)
+
+// Directions of a captured frame
+const (
+	Inbound  = "in"
+	Outbound = "out"
+)
+
+// maxKept is how many captures, running or stopped, are listed
+const maxKept = 100
+
+var (
+	// ErrNoTarget is returned for a capture that names no client
+	ErrNoTarget = errors.New("capture needs a client_id, session or pubkey")
+	// ErrTooManyCaptures is returned when ADMIN.CAPTURE.MAX_ACTIVE captures run
+	ErrTooManyCaptures = errors.New("too many captures running")
+)
+
+// Target names the clients a capture records: a connection by its client ID,
+// the connections of a session, or those authenticated as a pubkey
+type Target struct {
+	ClientID string `json:"client_id,omitempty"`
+	Session  string `json:"session,omitempty"`
+	PubKey   string `json:"pubkey,omitempty"`
+}
+
+// Client is a connection whose frames may be captured
+type Client struct {
+	ClientID string
+	Session  string
+	PubKey   string
+	IP       string
+}
+
+// matches reports whether the target names c
+func (t Target) matches(c Client) bool {
+	return (t.ClientID != "" && t.ClientID == c.ClientID) ||
+		(t.Session != "" && t.Session == c.Session) ||
+		(t.PubKey != "" && c.PubKey != "" && strings.EqualFold(t.PubKey, c.PubKey))
+}
+
+// Info describes a capture
+type Info struct {
+	ID string `json:"id"`
+	Target
+	File      string    `json:"file"`
+	StartedAt time.Time `json:"started_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	MaxBytes  int64     `json:"max_bytes"`
+	Bytes     int64     `json:"bytes"`
+	Frames    int64     `json:"frames"`
+	Active    bool      `json:"active"`
+	// StopReason is why a capture stopped: "expired", "size" or "stopped"
+	StopReason string `json:"stop_reason,omitempty"`
+}
+
+// frame is a line of a capture file
+type frame struct {
+	At        time.Time `json:"at"`
+	Direction string    `json:"dir"`
+	ClientID  string    `json:"client_id"`
+	Session   string    `json:"session,omitempty"`
+	PubKey    string    `json:"pubkey,omitempty"`
+	IP        string    `json:"ip"`
+	Frame     string    `json:"frame"`
+}
+
+// capture is a running or stopped capture
+type capture struct {
+	mu    sync.Mutex
+	info  Info
+	file  *os.File
+	timer *time.Timer
+}
+
+// Recorder runs the captures of this node
+type Recorder struct {
+	cfg      config.CaptureConfig
+	mu       sync.RWMutex
+	captures map[string]*capture
+	// active is the number of running captures, so connections skip the lookup
+	// while nothing is captured
+	active atomic.Int32
+}
+
+// NewRecorder returns a recorder bounded by cfg
+func NewRecorder(cfg config.CaptureConfig) *Recorder {
+	return &Recorder{cfg: cfg, captures: make(map[string]*capture)}
+}
+
+// Active reports whether any capture is running
+func (r *Recorder) Active() bool {
+	return r != nil && r.active.Load() > 0
+}
+
+// Start begins capturing the frames of the clients target names for duration,
+// up to maxBytes. Zero or larger values are capped to ADMIN.CAPTURE.
+func (r *Recorder) Start(target Target, duration time.Duration, maxBytes int64) (Info, error) {
+	if target == (Target{}) {
+		return Info{}, ErrNoTarget
+	}
+	if duration <= 0 || duration > r.cfg.MaxDuration {
+		duration = r.cfg.MaxDuration
+	}
+	if maxBytes <= 0 || maxBytes > r.cfg.MaxBytes {
+		maxBytes = r.cfg.MaxBytes
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Info{}, fmt.Errorf("failed to generate capture ID: %w", err)
+	}
+	now := time.Now().UTC()
+	c := &capture{info: Info{
+		ID:        hex.EncodeToString(id),
+		Target:    target,
+		StartedAt: now,
+		ExpiresAt: now.Add(duration),
+		MaxBytes:  maxBytes,
+		Active:    true,
+	}}
+	c.info.File = filepath.Join(r.cfg.Dir, fmt.Sprintf("capture-%s-%s.jsonl", now.Format("20060102T150405"), c.info.ID))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if int(r.active.Load()) >= r.cfg.MaxActive {
+		return Info{}, ErrTooManyCaptures
+	}
+	if err := os.MkdirAll(r.cfg.Dir, 0o700); err != nil {
+		return Info{}, fmt.Errorf("failed to create capture directory: %w", err)
+	}
+	file, err := os.OpenFile(c.info.File, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return Info{}, fmt.Errorf("failed to create capture file: %w", err)
+	}
+	c.file = file
+	c.timer = time.AfterFunc(duration, func() { r.stop(c, "expired") })
+
+	r.captures[c.info.ID] = c
+	r.active.Add(1)
+	r.prune()
+	return c.info, nil
+}
+
+// Stop stops the capture with id, keeping its file
+func (r *Recorder) Stop(id string) (Info, bool) {
+	r.mu.RLock()
+	c, ok := r.captures[id]
+	r.mu.RUnlock()
+	if !ok {
+		return Info{}, false
+	}
+	r.stop(c, "stopped")
+	return c.snapshot(), true
+}
+
+// stop closes c's file unless it is stopped already
+func (r *Recorder) stop(c *capture, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.info.Active {
+		return
+	}
+	c.info.Active = false
+	c.info.StopReason = reason
+	c.timer.Stop()
+	_ = c.file.Close()
+	r.active.Add(-1)
+}
+
+// Record writes a frame sent or received by client to the captures naming it
+func (r *Recorder) Record(client Client, direction string, data []byte) {
+	if !r.Active() {
+		return
+	}
+	r.mu.RLock()
+	var matching []*capture
+	for _, c := range r.captures {
+		if c.info.Target.matches(client) {
+			matching = append(matching, c)
+		}
+	}
+	r.mu.RUnlock()
+	if len(matching) == 0 {
+		return
+	}
+
+	line, err := json.Marshal(frame{
+		At:        time.Now().UTC(),
+		Direction: direction,
+		ClientID:  client.ClientID,
+		Session:   client.Session,
+		PubKey:    client.PubKey,
+		IP:        client.IP,
+		Frame:     string(data),
+	})
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+	for _, c := range matching {
+		if full := c.write(line); full {
+			r.stop(c, "size")
+		}
+	}
+}
+
+// write appends line to c's file and reports whether the file reached its size
+// bound; lines that would go past it are left out
+func (c *capture) write(line []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.info.Active {
+		return false
+	}
+	if c.info.Bytes+int64(len(line)) > c.info.MaxBytes {
+		return true
+	}
+	n, err := c.file.Write(line)
+	c.info.Bytes += int64(n)
+	if err != nil {
+		return true
+	}
+	c.info.Frames++
+	return false
+}
+
+// snapshot returns what describes c
+func (c *capture) snapshot() Info {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.info
+}
+
+// Get returns the capture with id
+func (r *Recorder) Get(id string) (Info, bool) {
+	r.mu.RLock()
+	c, ok := r.captures[id]
+	r.mu.RUnlock()
+	if !ok {
+		return Info{}, false
+	}
+	return c.snapshot(), true
+}
+
+// List returns the captures, newest first
+func (r *Recorder) List() []Info {
+	r.mu.RLock()
+	infos := make([]Info, 0, len(r.captures))
+	for _, c := range r.captures {
+		infos = append(infos, c.snapshot())
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].StartedAt.After(infos[j].StartedAt) })
+	return infos
+}
+
+// prune forgets the oldest stopped captures past maxKept, leaving their files;
+// r.mu must be held
+func (r *Recorder) prune() {
+	if len(r.captures) <= maxKept {
+		return
+	}
+	stopped := make([]*capture, 0, len(r.captures))
+	for _, c := range r.captures {
+		if !c.snapshot().Active {
+			stopped = append(stopped, c)
+		}
+	}
+	sort.Slice(stopped, func(i, j int) bool { return stopped[i].info.StartedAt.Before(stopped[j].info.StartedAt) })
+	for _, c := range stopped {
+		if len(r.captures) <= maxKept {
+			return
+		}
+		delete(r.captures, c.info.ID)
+	}
+}
@@ -0,0 +1,178 @@
+// Package clock compares the system clock with NTP servers. The created_at checks
+// trust the system clock, so the measured offset is kept for them to account for
+// a skewed clock and for the health checks to report it.
+package clock
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultTimeout bounds a single NTP query
+	DefaultTimeout = 5 * time.Second
+	// ntpEpochOffset is the seconds between the NTP epoch (1900) and the Unix epoch
+	ntpEpochOffset = 2208988800
+	// ntpPacketSize is the size of an SNTP request and response
+	ntpPacketSize = 48
+	// Samples is how many times each server is queried per check
+	Samples = 4
+)
+
+// ErrNoServers is returned when no NTP server answered
+var ErrNoServers = errors.New("no NTP server answered")
+
+var (
+	// offset is the last measured offset in nanoseconds, the time to add to the
+	// system clock to get the reference time
+	offset atomic.Int64
+	// checkedAt is the unix time of the last successful check, 0 before any
+	checkedAt atomic.Int64
+	// tolerance is how much the created_at bounds are widened, in nanoseconds
+	tolerance atomic.Int64
+)
+
+// Offset returns the last measured offset of the system clock, positive when it
+// is behind the reference, and when it was measured. It reports false before the
+// first successful check.
+func Offset() (time.Duration, time.Time, bool) {
+	at := checkedAt.Load()
+	if at == 0 {
+		return 0, time.Time{}, false
+	}
+	return time.Duration(offset.Load()), time.Unix(at, 0), true
+}
+
+// Tolerance returns how much the created_at bounds should be widened to make up
+// for a skewed clock, 0 while the clock is within the allowed skew
+func Tolerance() time.Duration {
+	return time.Duration(tolerance.Load())
+}
+
+// Check measures the offset against every one of servers that answers and
+// records the median, so a single wrong or spoofed server can't skew it. Past
+// maxSkew the tolerance is set to the size of the offset, up to maxTolerance.
+func Check(ctx context.Context, servers []string, maxSkew, maxTolerance time.Duration) (time.Duration, error) {
+	var lastErr error = ErrNoServers
+	var offsets []time.Duration
+	for _, server := range servers {
+		measured, err := Measure(ctx, server)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		offsets = append(offsets, measured)
+	}
+	if len(offsets) == 0 {
+		return 0, lastErr
+	}
+	slices.Sort(offsets)
+	measured := offsets[len(offsets)/2]
+	if len(offsets)%2 == 0 {
+		measured = (offsets[len(offsets)/2-1] + measured) / 2
+	}
+
+	offset.Store(int64(measured))
+	checkedAt.Store(time.Now().Unix())
+	if abs := measured.Abs(); abs > maxSkew {
+		tolerance.Store(int64(min(abs, maxTolerance)))
+	} else {
+		tolerance.Store(0)
+	}
+	return measured, nil
+}
+
+// Measure queries server Samples times and returns the offset of the answer
+// with the shortest round trip, the one least distorted by network delay
+func Measure(ctx context.Context, server string) (time.Duration, error) {
+	var best, bestDelay time.Duration
+	var lastErr error
+	answered := false
+	for i := 0; i < Samples; i++ {
+		measured, delay, err := Query(ctx, server)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if !answered || delay < bestDelay {
+			best, bestDelay, answered = measured, delay, true
+		}
+	}
+	if !answered {
+		return 0, lastErr
+	}
+	return best, nil
+}
+
+// Query asks an NTP server for the offset of the system clock with SNTP, and
+// returns it with the round-trip delay. server is a host, optionally with a port
+// (123 by default). The answer must echo the random transmit timestamp of the
+// request, which an off-path attacker can't guess.
+func Query(ctx context.Context, server string) (time.Duration, time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", server)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to reach %s: %w", server, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	// LI 0, version 4, mode 3 (client); the transmit timestamp is a nonce rather
+	// than the time, which servers only echo as the origin timestamp
+	req := make([]byte, ntpPacketSize)
+	req[0] = 0x23
+	if _, err := rand.Read(req[40:48]); err != nil {
+		return 0, 0, err
+	}
+	sent := time.Now()
+	if _, err := conn.Write(req); err != nil {
+		return 0, 0, fmt.Errorf("failed to query %s: %w", server, err)
+	}
+	resp := make([]byte, ntpPacketSize)
+	n, err := conn.Read(resp)
+	received := time.Now()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read from %s: %w", server, err)
+	}
+	if n < ntpPacketSize || resp[0]&0x07 != 4 || resp[1] == 0 || resp[1] > 15 {
+		return 0, 0, fmt.Errorf("invalid NTP response from %s", server)
+	}
+	if !bytes.Equal(resp[24:32], req[40:48]) {
+		return 0, 0, fmt.Errorf("NTP response from %s doesn't answer the request", server)
+	}
+
+	serverReceived := ntpTime(resp[32:40])
+	serverSent := ntpTime(resp[40:48])
+	if serverReceived.IsZero() || serverSent.IsZero() || serverSent.Before(serverReceived) {
+		return 0, 0, fmt.Errorf("invalid NTP response from %s", server)
+	}
+	delay := received.Sub(sent) - serverSent.Sub(serverReceived)
+	return (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2, max(delay, 0), nil
+}
+
+// ntpTime decodes a 64-bit NTP timestamp, zero when it is unset
+func ntpTime(b []byte) time.Time {
+	secs := binary.BigEndian.Uint32(b[:4])
+	frac := binary.BigEndian.Uint32(b[4:])
+	if secs == 0 && frac == 0 {
+		return time.Time{}
+	}
+	nanos := (int64(frac) * int64(time.Second)) >> 32
+	return time.Unix(int64(secs)-ntpEpochOffset, nanos)
+}
@@ -0,0 +1,30 @@
+package config
+
+import "time"
+
+// AdminConfig holds settings for the authenticated admin HTTP API.
+type AdminConfig struct {
+	Enabled        bool                 `mapstructure:"ENABLED"         json:"enabled"`
+	Token          string               `mapstructure:"TOKEN"           json:"-"               validate:"omitempty,min=16"`
+	AnnounceRelays []string             `mapstructure:"ANNOUNCE_RELAYS" json:"announce_relays" validate:"omitempty,dive,url"`
+	Capture        CaptureConfig        `mapstructure:"CAPTURE"         json:"capture"`
+	QueryAnalytics QueryAnalyticsConfig `mapstructure:"QUERY_ANALYTICS" json:"query_analytics"`
+}
+
+// CaptureConfig bounds the frame captures admins start for a connection, a
+// session or a pubkey. Captures are written to Dir, last at most MaxDuration and
+// stop once MaxBytes are written; MaxActive may run at once.
+type CaptureConfig struct {
+	Dir         string        `mapstructure:"DIR"          json:"dir"          validate:"required"`
+	MaxDuration time.Duration `mapstructure:"MAX_DURATION" json:"max_duration" validate:"min=1s"`
+	MaxBytes    int64         `mapstructure:"MAX_BYTES"    json:"max_bytes"    validate:"min=1024"`
+	MaxActive   int           `mapstructure:"MAX_ACTIVE"   json:"max_active"   validate:"min=1,max=100"`
+}
+
+// QueryAnalyticsConfig aggregates the REQ filters this node serves for
+// /api/admin/query-analytics. At most MaxKeys authors and as many filter shapes
+// are tallied, the least requested dropped first.
+type QueryAnalyticsConfig struct {
+	Enabled bool `mapstructure:"ENABLED"  json:"enabled"`
+	MaxKeys int  `mapstructure:"MAX_KEYS" json:"max_keys" validate:"min=100,max=1000000"`
+}
@@ -0,0 +1,13 @@
+package config
+
+import "time"
+
+// BlossomConfig holds settings for the Blossom (BUD-01/BUD-02) media endpoints.
+type BlossomConfig struct {
+	Enabled bool `mapstructure:"ENABLED"       json:"enabled"`
+	// MaxBlobSize is capped at 16 MiB: blobs are stored as single database values
+	MaxBlobSize int64 `mapstructure:"MAX_BLOB_SIZE" json:"max_blob_size" validate:"min=1,max=16777216"`
+	// UploadTimeout bounds reading an upload and answering it, in place of the
+	// shorter timeouts of the other HTTP requests
+	UploadTimeout time.Duration `mapstructure:"UPLOAD_TIMEOUT" json:"upload_timeout" validate:"min=1s,max=1h"`
+}
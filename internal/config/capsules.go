@@ -1,7 +1,24 @@
 package config
 
+import "time"
+
 // CapsulesConfig holds time capsules feature settings
 type CapsulesConfig struct {
-	Enabled      bool `mapstructure:"ENABLED"       json:"enabled"`
-	MaxWitnesses int  `mapstructure:"MAX_WITNESSES" json:"max_witnesses" validate:"required,min=1,max=20"`
+	Enabled                 bool          `mapstructure:"ENABLED"                    json:"enabled"`
+	Kinds                   []int         `mapstructure:"KINDS"                      json:"kinds"                      validate:"omitempty,dive,min=1,max=65535"`
+	AuthPrivate             bool          `mapstructure:"AUTH_PRIVATE"               json:"auth_private"`
+	MaxWitnesses            int           `mapstructure:"MAX_WITNESSES"              json:"max_witnesses"              validate:"required,min=1,max=20"`
+	DrandChains             []string      `mapstructure:"DRAND_CHAINS"               json:"drand_chains"               validate:"omitempty,dive,len=64,hexadecimal,lowercase"`
+	DrandVerify             bool          `mapstructure:"DRAND_VERIFY"               json:"drand_verify"`
+	DrandURLs               []string      `mapstructure:"DRAND_URLS"                 json:"drand_urls"                 validate:"omitempty,dive,url"`
+	DrandRequireFutureRound bool          `mapstructure:"DRAND_REQUIRE_FUTURE_ROUND" json:"drand_require_future_round"`
+	DrandTimeout            time.Duration `mapstructure:"DRAND_TIMEOUT"              json:"drand_timeout"              validate:"omitempty,min=100ms,max=1m"`
+	UnlockScheduler         bool          `mapstructure:"UNLOCK_SCHEDULER"           json:"unlock_scheduler"`
+	SchedulerInterval       time.Duration `mapstructure:"SCHEDULER_INTERVAL"         json:"scheduler_interval"         validate:"omitempty,min=1s,max=1h"`
+	MaxPerPubkey            int           `mapstructure:"MAX_PER_PUBKEY"             json:"max_per_pubkey"             validate:"min=0"`
+	BlobOffloadThreshold    int           `mapstructure:"BLOB_OFFLOAD_THRESHOLD"     json:"blob_offload_threshold"     validate:"min=0"`
+	MaxBytesPerPubkey       int64         `mapstructure:"MAX_BYTES_PER_PUBKEY"       json:"max_bytes_per_pubkey"       validate:"min=0"`
+	GCInterval              time.Duration `mapstructure:"GC_INTERVAL"                json:"gc_interval"                validate:"omitempty,min=1m"`
+	Retention               time.Duration `mapstructure:"RETENTION"                  json:"retention"                  validate:"omitempty,min=1m"`
+	UnresolvableTTL         time.Duration `mapstructure:"UNRESOLVABLE_TTL"           json:"unresolvable_ttl"           validate:"omitempty,min=1m"`
 }
@@ -0,0 +1,20 @@
+package config
+
+import "time"
+
+// ClockConfig holds settings for checking the system clock against NTP servers.
+// The created_at checks trust the system clock, so a skewed one rejects good
+// events and admits bad ones.
+type ClockConfig struct {
+	// NTPServers are all asked and the median offset kept; empty disables the
+	// check, as it is by default
+	NTPServers []string `mapstructure:"NTP_SERVERS" json:"ntp_servers" validate:"omitempty,dive,required"`
+	// CheckInterval is how often the clock is checked after startup (0 = only at startup)
+	CheckInterval time.Duration `mapstructure:"CHECK_INTERVAL" json:"check_interval" validate:"min=0"`
+	// MaxSkew is the offset past which the clock is reported as skewed and the
+	// created_at bounds are widened by the offset
+	MaxSkew time.Duration `mapstructure:"MAX_SKEW" json:"max_skew" validate:"min=0"`
+	// MaxTolerance caps how much the created_at bounds are widened, however
+	// large the offset measured
+	MaxTolerance time.Duration `mapstructure:"MAX_TOLERANCE" json:"max_tolerance" validate:"min=0"`
+}
@@ -33,6 +33,22 @@ type Config struct {
 	RelayPolicy RelayPolicyConfig `mapstructure:"relay_policy" validate:"required"`
 	Database    DatabaseConfig    `mapstructure:"database"     validate:"required"`
 	Capsules    CapsulesConfig    `mapstructure:"capsules"     validate:"required"`
+	Identity    IdentityConfig    `mapstructure:"identity"     validate:"required"`
+	Admin       AdminConfig       `mapstructure:"admin"        validate:"required"`
+	WellKnown   WellKnownConfig   `mapstructure:"well_known"   validate:"required"`
+	CORS        CORSConfig        `mapstructure:"cors"         validate:"required"`
+	HTTPLimits  HTTPLimitConfig   `mapstructure:"http_limits"  validate:"required"`
+	Blossom     BlossomConfig     `mapstructure:"blossom"      validate:"required"`
+	Payments    PaymentsConfig    `mapstructure:"payments"     validate:"required"`
+	Invites     InvitesConfig     `mapstructure:"invites"      validate:"required"`
+	Clock       ClockConfig       `mapstructure:"clock"        validate:"required"`
+	Tor         TorConfig         `mapstructure:"tor"          validate:"required"`
+	SelfTest    SelfTestConfig    `mapstructure:"selftest"     validate:"required"`
+	Sink        SinkConfig        `mapstructure:"sink"         validate:"required"`
+	Search      SearchConfig      `mapstructure:"search"       validate:"required"`
+	MOTD        MOTDConfig        `mapstructure:"motd"         validate:"required"`
+	ZapTotals   ZapTotalsConfig   `mapstructure:"zap_totals"   validate:"required"`
+	Tenants     []TenantConfig    `mapstructure:"tenants"      validate:"omitempty,dive"`
 }
 
 // Register custom validation rules
@@ -65,6 +81,57 @@ func init() {
 		if err := validate.Struct(cfg.Capsules); err != nil {
 			sl.ReportError(cfg.Capsules, "Capsules", "Capsules", "required", "")
 		}
+		if err := validate.Struct(cfg.Identity); err != nil {
+			sl.ReportError(cfg.Identity, "Identity", "Identity", "required", "")
+		}
+		if err := validate.Struct(cfg.Admin); err != nil {
+			sl.ReportError(cfg.Admin, "Admin", "Admin", "required", "")
+		}
+		if err := validate.Struct(cfg.WellKnown); err != nil {
+			sl.ReportError(cfg.WellKnown, "WellKnown", "WellKnown", "required", "")
+		}
+		if err := validate.Struct(cfg.CORS); err != nil {
+			sl.ReportError(cfg.CORS, "CORS", "CORS", "required", "")
+		}
+		if err := validate.Struct(cfg.HTTPLimits); err != nil {
+			sl.ReportError(cfg.HTTPLimits, "HTTPLimits", "HTTPLimits", "required", "")
+		}
+		if err := validate.Struct(cfg.Blossom); err != nil {
+			sl.ReportError(cfg.Blossom, "Blossom", "Blossom", "required", "")
+		}
+		if err := validate.Struct(cfg.Payments); err != nil {
+			sl.ReportError(cfg.Payments, "Payments", "Payments", "required", "")
+		}
+		if err := validate.Struct(cfg.Invites); err != nil {
+			sl.ReportError(cfg.Invites, "Invites", "Invites", "required", "")
+		}
+		if err := validate.Struct(cfg.Clock); err != nil {
+			sl.ReportError(cfg.Clock, "Clock", "Clock", "required", "")
+		}
+		if err := validate.Struct(cfg.Tor); err != nil {
+			sl.ReportError(cfg.Tor, "Tor", "Tor", "required", "")
+		}
+		if err := validate.Struct(cfg.SelfTest); err != nil {
+			sl.ReportError(cfg.SelfTest, "SelfTest", "SelfTest", "required", "")
+		}
+		if err := validate.Struct(cfg.Sink); err != nil {
+			sl.ReportError(cfg.Sink, "Sink", "Sink", "required", "")
+		}
+		if err := validate.Struct(cfg.Search); err != nil {
+			sl.ReportError(cfg.Search, "Search", "Search", "required", "")
+		}
+		if err := validate.Struct(cfg.MOTD); err != nil {
+			sl.ReportError(cfg.MOTD, "MOTD", "MOTD", "required", "")
+		}
+		if err := validate.Struct(cfg.ZapTotals); err != nil {
+			sl.ReportError(cfg.ZapTotals, "ZapTotals", "ZapTotals", "required", "")
+		}
+		for _, tenant := range cfg.Tenants {
+			if err := ValidateTenant(tenant); err != nil {
+				sl.ReportError(tenant.ID, "Tenants", "Tenants", "tenant_invalid", "")
+				break
+			}
+		}
 		
 		// Cross-field validation
 		performCrossFieldValidation(sl, cfg)
@@ -135,6 +202,13 @@ func registerCustomValidators() {
 		logger.Error("Failed to register pubkey validator", zap.Error(err))
 	}
 	
+	// Validate tenant IDs, which name virtual relays in logs, metrics and URLs
+	if err := validate.RegisterValidation("tenantid", func(fl validator.FieldLevel) bool {
+		return TenantIDPattern.MatchString(fl.Field().String())
+	}); err != nil {
+		logger.Error("Failed to register tenantid validator", zap.Error(err))
+	}
+	
 	// Validate duration is reasonable (not too short or too long)
 	if err := validate.RegisterValidation("reasonable_duration", func(fl validator.FieldLevel) bool {
 		duration := fl.Field().Interface().(time.Duration)
@@ -226,6 +300,192 @@ func performCrossFieldValidation(sl validator.StructLevel, cfg Config) {
 		sl.ReportError(cfg.Database.Port, "Port", "Port", "port_conflict", "")
 	}
 	
+	// Validate that metrics get their own listener instead of the public WebSocket port
+	if _, wsPort, err := net.SplitHostPort(cfg.Relay.WSAddr); err == nil && cfg.Metrics.Enabled && wsPort == fmt.Sprint(cfg.Metrics.Port) {
+		sl.ReportError(cfg.Metrics.Port, "Port", "Port", "metrics_port_conflict", "")
+	}
+	
+	// Validate that the native TLS listener has both halves of its key pair
+	if (cfg.Relay.TLSCert == "") != (cfg.Relay.TLSKey == "") {
+		sl.ReportError(cfg.Relay.TLSCert, "TLSCert", "TLSCert", "relay_tls_incomplete", "")
+	}
+	
+	// Validate that metrics TLS has both halves of the key pair before enabling mTLS
+	if (cfg.Metrics.TLSCert == "") != (cfg.Metrics.TLSKey == "") || (cfg.Metrics.ClientCA != "" && cfg.Metrics.TLSCert == "") {
+		sl.ReportError(cfg.Metrics.TLSCert, "TLSCert", "TLSCert", "metrics_tls_incomplete", "")
+	}
+	
+	// Validate that the admin API is never enabled without a token
+	if cfg.Admin.Enabled && cfg.Admin.Token == "" {
+		sl.ReportError(cfg.Admin.Token, "Token", "Token", "admin_token_required", "")
+	}
+	
+	// Validate that an onion service has a listener and a way to be published
+	if tor := cfg.Tor; tor.Enabled && (tor.ListenAddr == "" || (tor.ControlAddr == "" && tor.OnionAddress == "")) {
+		sl.ReportError(tor.Enabled, "Enabled", "Enabled", "tor_incomplete", "")
+	}
+	
+	// Validate that resumable subscriptions are kept for a while and buffer something
+	if resume := cfg.Relay.Resume; resume.Enabled && (resume.Window <= 0 || resume.MaxEvents < 1 || resume.MaxSessions < 1 || resume.MaxPerIP < 1) {
+		sl.ReportError(resume.Window, "Window", "Window", "resume_incomplete", "")
+	}
+	
+	// Validate that client sessions are kept for a while
+	if sessions := cfg.Relay.Sessions; sessions.Enabled && (sessions.Retention <= 0 || sessions.MaxSessions < 1) {
+		sl.ReportError(sessions.Retention, "Retention", "Retention", "sessions_incomplete", "")
+	}
+	
+	// Validate that connection challenges ask for some work
+	if challenge := cfg.Relay.ThrottlingConfig.Challenge; challenge.Enabled && challenge.Difficulty < 1 {
+		sl.ReportError(challenge.Difficulty, "Difficulty", "Difficulty", "challenge_difficulty_required", "")
+	}
+	
+	// Validate that a NIP-05 identifier has a pubkey to be checked against
+	if cfg.Relay.OperatorNIP05 != "" && cfg.Relay.OperatorPubKey == "" {
+		sl.ReportError(cfg.Relay.OperatorNIP05, "OperatorNIP05", "OperatorNIP05", "operator_pubkey_required", "")
+	}
+	
+	// Validate that a bunker signer has somewhere to connect to
+	if cfg.Identity.Signer == "bunker" && cfg.Identity.BunkerURL == "" {
+		sl.ReportError(cfg.Identity.BunkerURL, "BunkerURL", "BunkerURL", "bunker_url_required", "")
+	}
+	
+	// Validate that a relay key kept in the database is encrypted
+	if cfg.Identity.Backend == "database" && cfg.Identity.Passphrase == "" && cfg.Identity.PassphraseFile == "" {
+		sl.ReportError(cfg.Identity.Passphrase, "Passphrase", "Passphrase", "identity_passphrase_required", "")
+	}
+	
+	// Validate that drand verification and unlock scheduling have endpoints to query
+	if (cfg.Capsules.DrandVerify || cfg.Capsules.UnlockScheduler) && len(cfg.Capsules.DrandURLs) == 0 {
+		sl.ReportError(cfg.Capsules.DrandURLs, "DrandURLs", "DrandURLs", "drand_urls_required", "")
+	}
+	
+	// Validate that time capsule kinds are stored (ephemeral kinds never are)
+	for _, kind := range cfg.Capsules.Kinds {
+		if kind >= 20000 && kind < 30000 {
+			sl.ReportError(cfg.Capsules.Kinds, "Kinds", "Kinds", "capsule_kind_ephemeral", "")
+			break
+		}
+	}
+	
+	// Validate that a private or whitelist-only relay has members
+	if (cfg.RelayPolicy.Private || cfg.RelayPolicy.WritePolicy == "whitelist") && len(cfg.RelayPolicy.Whitelist.PubKeys) == 0 {
+		sl.ReportError(cfg.RelayPolicy.Private, "Private", "Private", "private_whitelist_required", "")
+	}
+	
+	// Validate that the write worker bounds aren't inverted
+	if db := cfg.Database; db.MaxWriteWorkers > 0 && db.MaxWriteWorkers < db.MinWriteWorkers {
+		sl.ReportError(db.MaxWriteWorkers, "MaxWriteWorkers", "MaxWriteWorkers", "write_workers_inverted", "")
+	}
+
+	// Validate that the bloom filter can grow from its initial capacity
+	if db := cfg.Database; db.BloomMaxCapacity > 0 && db.BloomMaxCapacity < db.BloomCapacity {
+		sl.ReportError(db.BloomMaxCapacity, "BloomMaxCapacity", "BloomMaxCapacity", "bloom_capacity_inverted", "")
+	}
+
+	// Validate that an enabled circuit breaker probes for recovery
+	if db := cfg.Database; db.BreakerThreshold > 0 && db.BreakerProbeInterval <= 0 {
+		sl.ReportError(db.BreakerProbeInterval, "BreakerProbeInterval", "BreakerProbeInterval", "breaker_probe_required", "")
+	}
+	
+	// Validate that an HTTP rate limit allows at least one request
+	if limits := cfg.HTTPLimits; limits.Enabled && limits.RequestsPerSecond > 0 && limits.BurstSize < 1 {
+		sl.ReportError(limits.BurstSize, "BurstSize", "BurstSize", "http_limit_burst_required", "")
+	}
+	
+	// Validate that paid admission is enforced and tells unpaid authors where to pay
+	if cfg.Payments.Enabled && (cfg.RelayPolicy.WritePolicy != "paid" || cfg.Payments.URL == "") {
+		sl.ReportError(cfg.Payments.Enabled, "Enabled", "Enabled", "payments_policy_required", "")
+	}
+	
+	// Validate that a lightning backend can be reached and authenticated
+	if ln := cfg.Payments.Lightning; ln.Backend != "" && (ln.URL == "" || ln.AuthToken == "") {
+		sl.ReportError(ln.Backend, "Backend", "Backend", "lightning_backend_incomplete", "")
+	}
+	
+	// Validate that zap receipts can be attributed to a zap provider
+	if zaps := cfg.Payments.Zaps; zaps.Enabled && zaps.LightningAddress == "" && zaps.ProviderPubkey == "" {
+		sl.ReportError(zaps.Enabled, "Enabled", "Enabled", "zaps_provider_required", "")
+	}
+	
+	// Validate that Cashu payments name their mints and, for nutzaps, a locking key
+	if cashu := cfg.Payments.Cashu; cashu.Enabled && (len(cashu.Mints) == 0 || (cashu.Nutzaps && cashu.P2PKKey == "")) {
+		sl.ReportError(cashu.Enabled, "Enabled", "Enabled", "cashu_incomplete", "")
+	}
+	
+	// Validate that payment webhooks can be signed
+	if cfg.Payments.Webhook.URL != "" && cfg.Payments.Webhook.Secret == "" {
+		sl.ReportError(cfg.Payments.Webhook.URL, "URL", "URL", "webhook_secret_required", "")
+	}
+	
+	// Validate that the event sink has a URL its mode can deliver to
+	if sink := cfg.Sink; sink.Enabled {
+		if u, err := url.Parse(sink.URL); err != nil || u.Host == "" ||
+			(sink.Mode == SinkForwarder && u.Scheme != "http" && u.Scheme != "https") {
+			sl.ReportError(sink.URL, "URL", "URL", "sink_url_invalid", "")
+		}
+	}
+	
+	// Validate that messages of the day render and their windows are ordered
+	for _, msg := range cfg.MOTD.Messages {
+		from, until := msg.Window()
+		if _, err := msg.Template(); err != nil || (!from.IsZero() && !until.IsZero() && !until.After(from)) {
+			sl.ReportError(msg.Text, "Messages", "Messages", "motd_message_invalid", "")
+			break
+		}
+	}
+	
+	// Validate that tier names are unique and don't shadow the fee schedule plans
+	seenTiers := make(map[string]bool, len(cfg.Payments.Tiers))
+	for _, tier := range cfg.Payments.Tiers {
+		if seenTiers[tier.Name] || tier.Name == "admission" || tier.Name == "subscription" || tier.Period <= 0 {
+			sl.ReportError(tier.Name, "Tiers", "Tiers", "tier_invalid", "")
+			break
+		}
+		seenTiers[tier.Name] = true
+	}
+	
+	// Validate that invite codes gate writes behind admission
+	if cfg.Invites.Enabled && cfg.RelayPolicy.WritePolicy != "paid" {
+		sl.ReportError(cfg.Invites.Enabled, "Enabled", "Enabled", "invites_policy_required", "")
+	}
+	
+	// Validate that the expiration bounds leave a valid window
+	if exp := cfg.RelayPolicy.Expiration; exp.MaxHorizon > 0 && exp.MinDuration > exp.MaxHorizon {
+		sl.ReportError(exp.MinDuration, "MinDuration", "MinDuration", "expiration_bounds_inverted", "")
+	}
+	
+	// Validate that virtual relays have distinct IDs and don't share a route
+	seenTenants := make(map[string]bool, len(cfg.Tenants))
+	seenRoutes := make(map[string]bool, len(cfg.Tenants))
+tenants:
+	for _, tenant := range cfg.Tenants {
+		if seenTenants[tenant.ID] {
+			sl.ReportError(tenant.ID, "Tenants", "Tenants", "tenant_conflict", "")
+			break
+		}
+		seenTenants[tenant.ID] = true
+		for _, route := range tenant.Routes() {
+			if seenRoutes[route] {
+				sl.ReportError(tenant.ID, "Tenants", "Tenants", "tenant_conflict", "")
+				break tenants
+			}
+			seenRoutes[route] = true
+		}
+	}
+	
+	// Validate that blocklist feeds have distinct names and one source each
+	seenFeeds := make(map[string]bool, len(cfg.RelayPolicy.BlocklistFeeds.Feeds))
+	for _, feed := range cfg.RelayPolicy.BlocklistFeeds.Feeds {
+		fromURL := feed.URL != "" && feed.Type != ""
+		fromRelays := feed.Author != "" && len(feed.Relays) > 0
+		if seenFeeds[feed.Name] || fromURL == fromRelays || (feed.URL != "" && !fromURL) {
+			sl.ReportError(feed.Name, "Feeds", "Feeds", "blocklist_feed_invalid", "")
+			break
+		}
+		seenFeeds[feed.Name] = true
+	}
+	
 	// Validate that public URL scheme matches WebSocket address
 	if cfg.Relay.PublicURL != "" {
 		if parsedURL, err := url.Parse(cfg.Relay.PublicURL); err == nil {
@@ -392,6 +652,68 @@ func getFieldErrorMessage(fe validator.FieldError) string {
 		return fmt.Sprintf("%s should be longer than write timeout to allow proper connection closure", field)
 	case "port_conflict":
 		return "database port conflicts with metrics port, they must be different"
+	case "metrics_port_conflict":
+		return "METRICS.PORT conflicts with the RELAY.WS_ADDR port, metrics need their own listener"
+	case "admin_token_required":
+		return "admin API is enabled but ADMIN.TOKEN is empty"
+	case "operator_pubkey_required":
+		return "RELAY.OPERATOR_NIP05 is set but RELAY.OPERATOR_PUBKEY is empty"
+	case "bunker_url_required":
+		return "IDENTITY.SIGNER is 'bunker' but IDENTITY.BUNKER_URL is empty"
+	case "identity_passphrase_required":
+		return "IDENTITY.BACKEND is 'database' but neither IDENTITY.PASSPHRASE nor PASSPHRASE_FILE is set, the key would be stored unencrypted"
+	case "drand_urls_required":
+		return "CAPSULES.DRAND_VERIFY or CAPSULES.UNLOCK_SCHEDULER is enabled but CAPSULES.DRAND_URLS is empty"
+	case "capsule_kind_ephemeral":
+		return "CAPSULES.KINDS must not contain ephemeral kinds (20000-29999), capsules have to be stored"
+	case "relay_tls_incomplete":
+		return "RELAY.TLS_CERT and TLS_KEY must be set together"
+	case "metrics_tls_incomplete":
+		return "METRICS.TLS_CERT and TLS_KEY must be set together, and CLIENT_CA requires them"
+	case "payments_policy_required":
+		return "PAYMENTS.ENABLED requires RELAY_POLICY.WRITE_POLICY \"paid\" and PAYMENTS.URL"
+	case "lightning_backend_incomplete":
+		return "PAYMENTS.LIGHTNING.BACKEND requires LIGHTNING.URL and LIGHTNING.AUTH_TOKEN"
+	case "zaps_provider_required":
+		return "PAYMENTS.ZAPS.ENABLED requires ZAPS.LIGHTNING_ADDRESS or ZAPS.PROVIDER_PUBKEY"
+	case "cashu_incomplete":
+		return "PAYMENTS.CASHU.ENABLED requires CASHU.MINTS, and CASHU.NUTZAPS requires CASHU.P2PK_KEY"
+	case "webhook_secret_required":
+		return "PAYMENTS.WEBHOOK.URL requires WEBHOOK.SECRET to sign deliveries"
+	case "sink_url_invalid":
+		return "SINK.ENABLED requires SINK.URL, an http(s) URL in forwarder mode or a CockroachDB sink URI in changefeed mode"
+	case "motd_message_invalid":
+		return "MOTD.MESSAGES TEXT must be a valid template, and UNTIL must be after FROM"
+	case "tier_invalid":
+		return "PAYMENTS.TIERS names must be unique and not \"admission\" or \"subscription\", and PERIOD must be positive"
+	case "invites_policy_required":
+		return "INVITES.ENABLED requires RELAY_POLICY.WRITE_POLICY \"paid\""
+	case "write_workers_inverted":
+		return "DATABASE.MAX_WRITE_WORKERS must not be below MIN_WRITE_WORKERS"
+	case "bloom_capacity_inverted":
+		return "DATABASE.BLOOM_MAX_CAPACITY must not be below BLOOM_CAPACITY"
+	case "breaker_probe_required":
+		return "DATABASE.BREAKER_PROBE_INTERVAL must be set when BREAKER_THRESHOLD is"
+	case "http_limit_burst_required":
+		return "HTTP_LIMITS.BURST_SIZE must be at least 1 when REQUESTS_PER_SECOND is set"
+	case "expiration_bounds_inverted":
+		return "RELAY_POLICY.EXPIRATION.MIN_DURATION must not exceed MAX_HORIZON"
+	case "private_whitelist_required":
+		return "RELAY_POLICY.PRIVATE or WRITE_POLICY \"whitelist\" is set but RELAY_POLICY.WHITELIST.PUBKEYS is empty"
+	case "tenant_invalid":
+		return "TENANTS entries need an ID of lowercase letters, digits and dashes, HOSTS or a PATH not served by the main relay, and a WHITELIST when PRIVATE or WRITE_POLICY \"whitelist\""
+	case "tor_incomplete":
+		return "TOR.ENABLED requires TOR.LISTEN_ADDR and either TOR.CONTROL_ADDR or TOR.ONION_ADDRESS"
+	case "resume_incomplete":
+		return "RELAY.RESUME.ENABLED requires a positive RELAY.RESUME.WINDOW, MAX_EVENTS, MAX_SESSIONS and MAX_PER_IP"
+	case "sessions_incomplete":
+		return "RELAY.SESSIONS.ENABLED requires a positive RELAY.SESSIONS.RETENTION and RELAY.SESSIONS.MAX_SESSIONS"
+	case "challenge_difficulty_required":
+		return "RELAY.THROTTLING.CHALLENGE.DIFFICULTY must be at least 1 when challenges are enabled"
+	case "blocklist_feed_invalid":
+		return "RELAY_POLICY.BLOCKLIST_FEEDS.FEEDS need unique NAMEs and either a URL and TYPE or an AUTHOR and RELAYS"
+	case "tenant_conflict":
+		return "TENANTS IDs must be unique and no two tenants may share a host and path"
 	case "invalid_websocket_scheme":
 		return fmt.Sprintf("%s must use 'ws://' or 'wss://' scheme for WebSocket connections", field)
 	default:
@@ -0,0 +1,21 @@
+package config
+
+// CORSConfig holds the CORS policy of each HTTP endpoint group.
+type CORSConfig struct {
+	// API covers the dashboard and public JSON APIs (/api/*, /subscribe)
+	API CORSPolicy `mapstructure:"API"   json:"api"`
+	// NIP11 covers the NIP-11 document and the /.well-known/ discovery documents
+	NIP11 CORSPolicy `mapstructure:"NIP11" json:"nip11"`
+	// Admin covers the token-authenticated admin API
+	Admin CORSPolicy `mapstructure:"ADMIN" json:"admin"`
+	// Blossom covers the Blossom media endpoints, which BUD-01 requires to be open
+	Blossom CORSPolicy `mapstructure:"BLOSSOM" json:"blossom"`
+}
+
+// CORSPolicy lists what cross-origin browser requests may do. An empty origin
+// list sends no CORS headers, "*" allows any origin.
+type CORSPolicy struct {
+	AllowedOrigins []string `mapstructure:"ALLOWED_ORIGINS" json:"allowed_origins" validate:"omitempty,dive,min=1"`
+	AllowedMethods []string `mapstructure:"ALLOWED_METHODS" json:"allowed_methods" validate:"omitempty,dive,oneof=GET HEAD POST PUT PATCH DELETE OPTIONS"`
+	AllowedHeaders []string `mapstructure:"ALLOWED_HEADERS" json:"allowed_headers" validate:"omitempty,dive,min=1"`
+}
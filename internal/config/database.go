@@ -1,8 +1,60 @@
 package config
 
+import "time"
+
 // DatabaseConfig holds database-related settings.
 type DatabaseConfig struct {
 	// Connection settings
 	Server string `mapstructure:"SERVER"            json:"server"            validate:"required,host"`
 	Port   int    `mapstructure:"PORT"             json:"port"             validate:"required,min=1,max=65535"`
+
+	// MaxConcurrentQueries bounds the total weight of REQ and COUNT queries running
+	// at once (searches weigh 3, scans 2, id/author lookups 1), keeping pool
+	// connections free for writes (0 = half the connection pool)
+	MaxConcurrentQueries int `mapstructure:"MAX_CONCURRENT_QUERIES" json:"max_concurrent_queries" validate:"min=0"`
+	// QueryQueueTimeout is how long a query waits for capacity before its REQ is
+	// closed as rate-limited (0 = reject at once)
+	QueryQueueTimeout time.Duration `mapstructure:"QUERY_QUEUE_TIMEOUT" json:"query_queue_timeout" validate:"min=0"`
+
+	// BreakerThreshold is how many storage operations in a row may fail to reach
+	// the database before the circuit breaker opens, serving REQs from memory
+	// where possible and failing the rest at once (0 = no circuit breaker)
+	BreakerThreshold int `mapstructure:"BREAKER_THRESHOLD" json:"breaker_threshold" validate:"min=0"`
+	// BreakerProbeInterval is how often the database is pinged while the circuit
+	// is open, closing it once the database answers
+	BreakerProbeInterval time.Duration `mapstructure:"BREAKER_PROBE_INTERVAL" json:"breaker_probe_interval" validate:"min=0"`
+
+	// MinWriteWorkers and MaxWriteWorkers bound the workers storing queued events,
+	// scaled with queue depth and write latency (0 = NumCPU and 8x NumCPU)
+	MinWriteWorkers int `mapstructure:"MIN_WRITE_WORKERS" json:"min_write_workers" validate:"min=0"`
+	MaxWriteWorkers int `mapstructure:"MAX_WRITE_WORKERS" json:"max_write_workers" validate:"min=0"`
+	// WriteQueueSize is the most events queued for storage (0 = 100000)
+	WriteQueueSize int `mapstructure:"WRITE_QUEUE_SIZE" json:"write_queue_size" validate:"min=0"`
+	// WriteLatencyTarget is the write latency above which no workers are added and
+	// the queue admits proportionally fewer events (0 = 250ms)
+	WriteLatencyTarget time.Duration `mapstructure:"WRITE_LATENCY_TARGET" json:"write_latency_target" validate:"min=0"`
+
+	// BloomCapacity and BloomFalsePositiveRate size the filter of stored event IDs
+	// that duplicate events are dropped by
+	BloomCapacity          int     `mapstructure:"BLOOM_CAPACITY" json:"bloom_capacity" validate:"min=1000"`
+	BloomFalsePositiveRate float64 `mapstructure:"BLOOM_FALSE_POSITIVE_RATE" json:"bloom_false_positive_rate" validate:"gt=0,lt=1"`
+	// BloomMaxFill is the share of its capacity the filter may hold before it is
+	// rebuilt twice as large, up to BloomMaxCapacity (0 = never resized)
+	BloomMaxFill     float64 `mapstructure:"BLOOM_MAX_FILL" json:"bloom_max_fill" validate:"gt=0,lte=1"`
+	BloomMaxCapacity int     `mapstructure:"BLOOM_MAX_CAPACITY" json:"bloom_max_capacity" validate:"min=0"`
+
+	// IntegrityCheckInterval is how often a revalidation run re-verifying the IDs
+	// and signatures of stored events is started (0 = only through the admin API)
+	IntegrityCheckInterval time.Duration `mapstructure:"INTEGRITY_CHECK_INTERVAL" json:"integrity_check_interval" validate:"min=0"`
+	// IntegrityCheckAction is what those runs do with corrupted events: report,
+	// quarantine or delete
+	IntegrityCheckAction string `mapstructure:"INTEGRITY_CHECK_ACTION" json:"integrity_check_action" validate:"omitempty,oneof=report quarantine delete"`
+
+	// ApproximateCountThreshold is the count from which COUNTs by kind or by
+	// author are answered from HyperLogLog sketches and flagged approximate
+	// (0 = always exact)
+	ApproximateCountThreshold int `mapstructure:"APPROXIMATE_COUNT_THRESHOLD" json:"approximate_count_threshold" validate:"min=0"`
+	// CountSketchRebuild is how often the sketches are rebuilt from the database,
+	// dropping the deleted events they still count (0 = only at startup)
+	CountSketchRebuild time.Duration `mapstructure:"COUNT_SKETCH_REBUILD" json:"count_sketch_rebuild" validate:"min=0"`
 }
@@ -0,0 +1,11 @@
+package config
+
+// HTTPLimitConfig holds per-IP rate limits and concurrency caps for the HTTP
+// endpoints (APIs, NIP-11, discovery documents and admin).
+type HTTPLimitConfig struct {
+	Enabled            bool    `mapstructure:"ENABLED"               json:"enabled"`
+	RequestsPerSecond  float64 `mapstructure:"REQUESTS_PER_SECOND"   json:"requests_per_second"    validate:"gte=0"`
+	BurstSize          int     `mapstructure:"BURST_SIZE"            json:"burst_size"             validate:"gte=0"`
+	MaxConcurrent      int     `mapstructure:"MAX_CONCURRENT"        json:"max_concurrent"         validate:"gte=0"`
+	MaxConcurrentPerIP int     `mapstructure:"MAX_CONCURRENT_PER_IP" json:"max_concurrent_per_ip"  validate:"gte=0"`
+}
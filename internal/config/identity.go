@@ -0,0 +1,15 @@
+package config
+
+// IdentityConfig holds relay identity key settings.
+type IdentityConfig struct {
+	KeyFile         string `mapstructure:"KEY_FILE"          json:"key_file"        validate:"omitempty,max=256"`
+	ImportKey       string `mapstructure:"IMPORT_KEY"        json:"-"`
+	Signer          string `mapstructure:"SIGNER"            json:"signer"          validate:"omitempty,oneof=local bunker"`
+	BunkerURL       string `mapstructure:"BUNKER_URL"        json:"bunker_url"`
+	BunkerClientKey string `mapstructure:"BUNKER_CLIENT_KEY" json:"-"`
+	Attestations    bool   `mapstructure:"ATTESTATIONS"      json:"attestations"`
+	KeyringDir      string `mapstructure:"KEYRING_DIR"       json:"keyring_dir"     validate:"omitempty,max=256"`
+	Passphrase      string `mapstructure:"PASSPHRASE"        json:"-"`
+	PassphraseFile  string `mapstructure:"PASSPHRASE_FILE"   json:"passphrase_file" validate:"omitempty,max=256"`
+	Backend         string `mapstructure:"BACKEND"           json:"backend"         validate:"omitempty,oneof=file database"`
+}
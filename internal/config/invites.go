@@ -0,0 +1,16 @@
+package config
+
+import "time"
+
+// InvitesConfig holds settings for invite code admission, a lighter alternative to
+// payments: operators generate codes through the admin API and a pubkey redeeming
+// one is admitted like a paid pubkey
+type InvitesConfig struct {
+	Enabled bool `mapstructure:"ENABLED" json:"enabled"`
+	// DefaultMaxUses is how many pubkeys may redeem a generated code (0 = unlimited)
+	DefaultMaxUses int `mapstructure:"DEFAULT_MAX_USES" json:"default_max_uses" validate:"min=0"`
+	// DefaultExpiry is how long a generated code can be redeemed (0 = never expires)
+	DefaultExpiry time.Duration `mapstructure:"DEFAULT_EXPIRY" json:"default_expiry" validate:"min=0"`
+	// DefaultPeriod is how long a redemption admits its pubkey (0 = for good)
+	DefaultPeriod time.Duration `mapstructure:"DEFAULT_PERIOD" json:"default_period" validate:"min=0"`
+}
@@ -4,4 +4,14 @@ package config
 type MetricsConfig struct {
 	Enabled bool `mapstructure:"ENABLED" json:"enabled" validate:"required"`
 	Port    int  `mapstructure:"PORT"    json:"port"    validate:"required,min=1024,max=65535"`
+	// Address is the interface the metrics listener binds to, localhost by
+	// default; empty binds all interfaces
+	Address string `mapstructure:"ADDRESS" json:"address" validate:"omitempty,hostname|ip"`
+	// AuthToken, when set, is required as a bearer token on scrape requests
+	AuthToken string `mapstructure:"AUTH_TOKEN" json:"-" validate:"omitempty,min=16"`
+	// TLSCert and TLSKey serve metrics over HTTPS; ClientCA additionally requires
+	// scrapers to present a client certificate signed by it (mTLS)
+	TLSCert  string `mapstructure:"TLS_CERT"  json:"tls_cert"`
+	TLSKey   string `mapstructure:"TLS_KEY"   json:"tls_key"`
+	ClientCA string `mapstructure:"CLIENT_CA" json:"client_ca"`
 }
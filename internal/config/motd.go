@@ -0,0 +1,43 @@
+package config
+
+import (
+	"text/template"
+	"time"
+)
+
+// MOTDConfig sends messages of the day to WebSocket clients as NOTICEs, for
+// policy reminders and maintenance notices. A client gets each message once,
+// when it connects or when the message's window opens while it is connected,
+// and again every REPEAT if set. Deliveries are remembered for MaxClients
+// clients, the least recently seen forgotten first.
+type MOTDConfig struct {
+	Enabled    bool          `mapstructure:"ENABLED"     json:"enabled"`
+	Messages   []MOTDMessage `mapstructure:"MESSAGES"    json:"messages"    validate:"omitempty,dive"`
+	MaxClients int           `mapstructure:"MAX_CLIENTS" json:"max_clients" validate:"min=1"`
+}
+
+// MOTDMessage is one message of the day
+type MOTDMessage struct {
+	// Text is a text/template rendered with the relay's Name and Contact and the
+	// message's From and Until
+	Text string `mapstructure:"TEXT" json:"text" validate:"required,max=2000"`
+	// From and Until bound when the message is sent, RFC 3339 times; always
+	// when empty
+	From  string `mapstructure:"FROM"  json:"from"  validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	Until string `mapstructure:"UNTIL" json:"until" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	// Repeat sends the message to a client again this long after it last got
+	// it, 0 for once
+	Repeat time.Duration `mapstructure:"REPEAT" json:"repeat" validate:"min=0"`
+}
+
+// Window returns when the message is sent, zero bounds being open
+func (m MOTDMessage) Window() (from, until time.Time) {
+	from, _ = time.Parse(time.RFC3339, m.From)
+	until, _ = time.Parse(time.RFC3339, m.Until)
+	return from, until
+}
+
+// Template parses the message text
+func (m MOTDMessage) Template() (*template.Template, error) {
+	return template.New("motd").Option("missingkey=error").Parse(m.Text)
+}
@@ -0,0 +1,117 @@
+package config
+
+import "time"
+
+// PaymentsConfig holds settings for paid relay admission. Fees are advertised in
+// NIP-11; pubkeys that paid are tracked in the database.
+type PaymentsConfig struct {
+	Enabled bool `mapstructure:"ENABLED" json:"enabled"`
+	// URL is the payment page advertised as NIP-11 payments_url and pointed to
+	// when unpaid writes are rejected
+	URL  string      `mapstructure:"URL"  json:"url"  validate:"omitempty,url"`
+	Fees FeeSchedule `mapstructure:"FEES" json:"fees"`
+	// RefreshInterval is how often paid pubkeys are reloaded from the database, so
+	// payments recorded on other nodes take effect
+	RefreshInterval time.Duration `mapstructure:"REFRESH_INTERVAL" json:"refresh_interval" validate:"min=0"`
+	// Lightning creates and verifies invoices for admission and top-ups
+	Lightning LightningConfig `mapstructure:"LIGHTNING" json:"lightning"`
+	// Zaps credits NIP-57 zaps to the relay as top-ups
+	Zaps ZapConfig `mapstructure:"ZAPS" json:"zaps"`
+	// Cashu accepts ecash tokens and NIP-61 nutzaps
+	Cashu CashuConfig `mapstructure:"CASHU" json:"cashu"`
+	// Tiers are time-limited memberships with their own rate limits, bought by
+	// requesting an invoice for the tier's name as plan
+	Tiers []TierConfig `mapstructure:"TIERS" json:"tiers" validate:"omitempty,dive"`
+	// RenewalNotice is how long before a membership lapses its authenticated
+	// connections are sent a renewal NOTICE (0 disables)
+	RenewalNotice time.Duration `mapstructure:"RENEWAL_NOTICE" json:"renewal_notice" validate:"min=0"`
+	// GracePeriod is how long a lapsed membership keeps its admission, so members
+	// renewing late aren't locked out in between (0 = lapse immediately)
+	GracePeriod time.Duration `mapstructure:"GRACE_PERIOD" json:"grace_period" validate:"min=0"`
+	// Webhook notifies an external billing system of admissions and lapses
+	Webhook WebhookConfig `mapstructure:"WEBHOOK" json:"webhook"`
+}
+
+// WebhookConfig sends signed notifications of payment events (admission granted,
+// membership about to lapse, membership lapsed) to an operator's endpoint
+type WebhookConfig struct {
+	// URL receives the notifications as JSON POSTs; empty disables them
+	URL string `mapstructure:"URL" json:"url" validate:"omitempty,url"`
+	// Secret keys the HMAC-SHA256 signature sent in X-Relay-Signature
+	Secret string `mapstructure:"SECRET" json:"-"`
+}
+
+// TierConfig is a named membership sold for a fixed period. Zero rate limits fall
+// back to the PAID profile.
+type TierConfig struct {
+	Name      string           `mapstructure:"NAME"       json:"name"       validate:"required,alphanum,max=32"`
+	Amount    int              `mapstructure:"AMOUNT"     json:"amount"     validate:"min=1"`
+	Unit      string           `mapstructure:"UNIT"       json:"unit"       validate:"oneof=msats sats"`
+	Period    time.Duration    `mapstructure:"PERIOD"     json:"period"     validate:"required"`
+	RateLimit RateLimitProfile `mapstructure:"RATE_LIMIT" json:"rate_limit"`
+}
+
+// Tier returns the tier named name, or nil when none is configured
+func (c PaymentsConfig) Tier(name string) *TierConfig {
+	for i := range c.Tiers {
+		if c.Tiers[i].Name == name {
+			return &c.Tiers[i]
+		}
+	}
+	return nil
+}
+
+// CashuConfig accepts Cashu ecash as an anonymous payment. Tokens are swapped at
+// their mint before they are credited, so only allowlisted mints are accepted.
+type CashuConfig struct {
+	Enabled bool     `mapstructure:"ENABLED" json:"enabled"`
+	Mints   []string `mapstructure:"MINTS"   json:"mints"   validate:"omitempty,dive,url"`
+	// Nutzaps redeems NIP-61 nutzaps addressed to the relay's pubkey
+	Nutzaps bool `mapstructure:"NUTZAPS" json:"nutzaps"`
+	// P2PKKey is the hex private key nutzaps are locked to, advertised in the
+	// relay's kind 10019 event. It must not be the relay's nostr key.
+	P2PKKey string `mapstructure:"P2PK_KEY" json:"-" validate:"omitempty,hexadecimal,len=64"`
+}
+
+// ZapConfig credits zap receipts addressed to the relay's pubkey to the zapper's
+// balance, which is spent on the first SUBSCRIPTION fee, or the first ADMISSION fee
+// when no subscription is offered
+type ZapConfig struct {
+	Enabled bool `mapstructure:"ENABLED" json:"enabled"`
+	// LightningAddress is the relay's lightning address; its zap provider's
+	// nostrPubkey is looked up unless ProviderPubkey is set
+	LightningAddress string `mapstructure:"LIGHTNING_ADDRESS" json:"lightning_address" validate:"omitempty,email"`
+	// ProviderPubkey is the pubkey that signs zap receipts for the lightning address
+	ProviderPubkey string `mapstructure:"PROVIDER_PUBKEY" json:"provider_pubkey" validate:"omitempty,pubkey"`
+}
+
+// LightningConfig selects the lightning node or wallet that issues admission invoices
+type LightningConfig struct {
+	// Backend is "lnd" (REST), "cln" (clnrest) or "lnbits"; empty disables invoices
+	Backend string `mapstructure:"BACKEND" json:"backend" validate:"omitempty,oneof=lnd cln lnbits"`
+	URL     string `mapstructure:"URL"     json:"url"     validate:"omitempty,url"`
+	// AuthToken is the LND invoice macaroon (hex), CLN rune or LNbits invoice key
+	AuthToken string `mapstructure:"AUTH_TOKEN" json:"-"`
+	// TLSCert is a certificate file to trust for nodes with self-signed certificates
+	TLSCert       string        `mapstructure:"TLS_CERT"       json:"tls_cert"`
+	InvoiceExpiry time.Duration `mapstructure:"INVOICE_EXPIRY" json:"invoice_expiry" validate:"min=0"`
+	// PollInterval is how often pending invoices are checked against the backend
+	PollInterval time.Duration `mapstructure:"POLL_INTERVAL" json:"poll_interval" validate:"min=0"`
+	// WebhookSecret, when set, must be sent as X-Webhook-Secret on payment webhooks
+	WebhookSecret string `mapstructure:"WEBHOOK_SECRET" json:"-"`
+}
+
+// FeeSchedule lists the NIP-11 fees of the relay
+type FeeSchedule struct {
+	Admission    []Fee `mapstructure:"ADMISSION"    json:"admission"    validate:"omitempty,dive"`
+	Subscription []Fee `mapstructure:"SUBSCRIPTION" json:"subscription" validate:"omitempty,dive"`
+	Publication  []Fee `mapstructure:"PUBLICATION"  json:"publication"  validate:"omitempty,dive"`
+}
+
+// Fee is one NIP-11 fee entry. Period applies to subscriptions, Kinds to publication fees.
+type Fee struct {
+	Amount int           `mapstructure:"AMOUNT" json:"amount" validate:"min=1"`
+	Unit   string        `mapstructure:"UNIT"   json:"unit"   validate:"oneof=msats sats"`
+	Period time.Duration `mapstructure:"PERIOD" json:"period" validate:"min=0"`
+	Kinds  []int         `mapstructure:"KINDS"  json:"kinds"  validate:"omitempty,dive,min=0,max=65535"`
+}
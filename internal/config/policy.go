@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 // RelayPolicyConfig holds policy settings.
 type RelayPolicyConfig struct {
 	Blacklist struct {
@@ -8,4 +10,190 @@ type RelayPolicyConfig struct {
 	Whitelist struct {
 		PubKeys []string `mapstructure:"PUBKEYS" json:"pubkeys" validate:"omitempty,dive,pubkey"`
 	} `mapstructure:"WHITELIST"`
+	// Private requires NIP-42 AUTH as a whitelisted pubkey to read or write
+	Private bool `mapstructure:"PRIVATE" json:"private"`
+	// WritePolicy restricts who may publish: "open", "authenticated" (any NIP-42
+	// authenticated client), "paid" (whitelisted or paying authors) or "whitelist"
+	WritePolicy string `mapstructure:"WRITE_POLICY" json:"write_policy" validate:"omitempty,oneof=open authenticated paid whitelist"`
+	// FreeDailyEvents is the daily event quota of authors that are neither
+	// whitelisted nor paying. Past it they are pointed to payment or invites; on a
+	// "paid" relay it lets them try the relay before paying. It is counted per
+	// author, authenticated pubkey and client address. 0 disables the quota.
+	FreeDailyEvents int `mapstructure:"FREE_DAILY_EVENTS" json:"free_daily_events" validate:"min=0"`
+	// Expiration bounds the NIP-40 expiration tags accepted; zero disables a bound
+	Expiration struct {
+		MaxHorizon  time.Duration `mapstructure:"MAX_HORIZON"  json:"max_horizon"  validate:"min=0"`
+		MinDuration time.Duration `mapstructure:"MIN_DURATION" json:"min_duration" validate:"min=0"`
+	} `mapstructure:"EXPIRATION"`
+	// CreatedAt bounds how far event timestamps may be from the time they arrive
+	CreatedAt CreatedAtPolicy `mapstructure:"CREATED_AT" json:"created_at"`
+	// ReadRestricted limits who may query the kinds it lists
+	ReadRestricted []KindReadPolicy `mapstructure:"READ_RESTRICTED" json:"read_restricted" validate:"omitempty,dive"`
+	// HideDeletedInteractions stops serving reactions, reposts and replies to
+	// events removed by NIP-09 deletion requests
+	HideDeletedInteractions bool `mapstructure:"HIDE_DELETED_INTERACTIONS" json:"hide_deleted_interactions"`
+	// HonorVanishRequests deletes everything the author of a NIP-62 request to
+	// vanish published up to it, and the gift wraps sent to them, and refuses
+	// those events from then on
+	HonorVanishRequests bool `mapstructure:"HONOR_VANISH_REQUESTS" json:"honor_vanish_requests"`
+	// MinPowDifficulty is the NIP-13 proof of work, in leading zero bits of the
+	// event ID, every event must carry and commit to in its nonce tag (0 = none)
+	MinPowDifficulty int `mapstructure:"MIN_POW_DIFFICULTY" json:"min_pow_difficulty" validate:"min=0,max=32"`
+	// Metadata is the ruleset kind 0 metadata is checked against
+	Metadata MetadataPolicy `mapstructure:"METADATA" json:"metadata"`
+	// URLBlocklist screens the URLs in event content and imeta tags
+	URLBlocklist URLBlocklistPolicy `mapstructure:"URL_BLOCKLIST" json:"url_blocklist"`
+	// IPAccess screens client addresses before the WebSocket upgrade
+	IPAccess IPAccessPolicy `mapstructure:"IP_ACCESS" json:"ip_access"`
+	// BlocklistFeeds are remote lists of blocked pubkeys, event IDs and domains
+	BlocklistFeeds BlocklistFeedsPolicy `mapstructure:"BLOCKLIST_FEEDS" json:"blocklist_feeds"`
+	// MuteLists applies the operators' NIP-51 mute lists as blacklist entries
+	MuteLists MuteListPolicy `mapstructure:"MUTE_LISTS" json:"mute_lists"`
+	// Moderation queues NIP-56 reports for review and acts on reported pubkeys
+	Moderation ModerationPolicy `mapstructure:"MODERATION" json:"moderation"`
+}
+
+// MuteListPolicy refuses the pubkeys and events muted by the kind 10000 mute
+// lists of PubKeys, so operators moderate the relay from their Nostr clients.
+// The lists stored on this relay are read every minute; with Relays set, newer
+// ones are also fetched from them every RefreshInterval.
+type MuteListPolicy struct {
+	PubKeys         []string      `mapstructure:"PUBKEYS"          json:"pubkeys"          validate:"omitempty,dive,pubkey"`
+	Relays          []string      `mapstructure:"RELAYS"           json:"relays"           validate:"omitempty,dive,url"`
+	RefreshInterval time.Duration `mapstructure:"REFRESH_INTERVAL" json:"refresh_interval" validate:"min=0"`
+}
+
+// ModerationPolicy queues the NIP-56 reports (kind 1984) stored on the main
+// relay for review through the admin API. Pubkeys reported, directly or through
+// their events, by ShadowBanThreshold or BlacklistThreshold distinct pubkeys in
+// open reports are shadow-banned or suspended (0 = never). Only the reports of
+// Reporters count toward the thresholds.
+type ModerationPolicy struct {
+	Enabled            bool     `mapstructure:"ENABLED"              json:"enabled"`
+	ShadowBanThreshold int      `mapstructure:"SHADOW_BAN_THRESHOLD" json:"shadow_ban_threshold" validate:"min=0"`
+	BlacklistThreshold int      `mapstructure:"BLACKLIST_THRESHOLD"  json:"blacklist_threshold"  validate:"min=0"`
+	Reporters          []string `mapstructure:"REPORTERS"            json:"reporters"            validate:"omitempty,dive,pubkey"`
+}
+
+// BlocklistFeedsPolicy lists the blocklist feeds synced every RefreshInterval.
+// What they list is refused like RELAY_POLICY.BLACKLIST, domains like
+// URL_BLOCKLIST.DOMAINS.
+type BlocklistFeedsPolicy struct {
+	RefreshInterval time.Duration   `mapstructure:"REFRESH_INTERVAL" json:"refresh_interval" validate:"min=0"`
+	Feeds           []BlocklistFeed `mapstructure:"FEEDS"            json:"feeds"            validate:"omitempty,dive"`
+}
+
+// BlocklistFeed is either a list downloaded from URL, one entry per line, or the
+// NIP-51 list event of Author fetched from Relays, whose "p" and "e" tags are
+// the blocked pubkeys and event IDs.
+type BlocklistFeed struct {
+	// Name tells the feed's entries apart from other feeds'
+	Name string `mapstructure:"NAME" json:"name" validate:"required,max=64"`
+	URL  string `mapstructure:"URL"  json:"url"  validate:"omitempty,url,startswith=https://"`
+	// Type is what the hex and plain entries of a URL feed are: "pubkey", "event"
+	// or "domain". npub, nprofile, note and nevent entries are read as such.
+	Type   string   `mapstructure:"TYPE"   json:"type"   validate:"omitempty,oneof=pubkey event domain"`
+	Relays []string `mapstructure:"RELAYS" json:"relays" validate:"omitempty,dive,url"`
+	Author string   `mapstructure:"AUTHOR" json:"author" validate:"omitempty,pubkey"`
+	// Kind is the list's kind, 10000 (mute list) when unset; D names the list
+	// among an addressable kind's, such as a 30000 follow set
+	Kind int    `mapstructure:"KIND" json:"kind" validate:"min=0,max=65535"`
+	D    string `mapstructure:"D"    json:"d"`
+}
+
+// ListKind returns the kind of the feed's list event
+func (f BlocklistFeed) ListKind() int {
+	if f.Kind == 0 {
+		return 10000
+	}
+	return f.Kind
+}
+
+// IPAccessPolicy lists CIDR ranges or single addresses, IPv4 or IPv6, clients may
+// or may not connect from. Deny wins over Allow; a non-empty Allow refuses every
+// address outside it. Unlike rate-limit bans these never expire.
+type IPAccessPolicy struct {
+	Allow []string `mapstructure:"ALLOW" json:"allow" validate:"omitempty,dive,cidr|ip"`
+	Deny  []string `mapstructure:"DENY"  json:"deny"  validate:"omitempty,dive,cidr|ip"`
+}
+
+// URLBlocklistPolicy blocks events linking to listed domains and their
+// subdomains. Feeds are remote lists (plain domains, hosts files or adblock
+// rules) synced every RefreshInterval.
+type URLBlocklistPolicy struct {
+	// Action is "reject" to refuse such events or "flag" to accept and log them
+	Action          string        `mapstructure:"ACTION"           json:"action"           validate:"omitempty,oneof=reject flag"`
+	Domains         []string      `mapstructure:"DOMAINS"          json:"domains"          validate:"omitempty,dive,required"`
+	Feeds           []string      `mapstructure:"FEEDS"            json:"feeds"            validate:"omitempty,dive,url"`
+	RefreshInterval time.Duration `mapstructure:"REFRESH_INTERVAL" json:"refresh_interval" validate:"min=0"`
+}
+
+// MetadataPolicy checks the fields of kind 0 metadata. In "strict" mode any
+// broken rule rejects the event; in "lenient" mode only fields over their
+// MaxLength do, values of the wrong type or format being let through.
+type MetadataPolicy struct {
+	Mode   string          `mapstructure:"MODE"   json:"mode"   validate:"omitempty,oneof=strict lenient"`
+	Fields []MetadataField `mapstructure:"FIELDS" json:"fields" validate:"omitempty,dive"`
+}
+
+// MetadataField is the rule for one metadata field. Format is what its value
+// must be: "string" (any string), "url" (http or https URL), "nip05" or "lud16"
+// (name@domain). MaxLength counts characters, 0 leaving the length unbounded.
+type MetadataField struct {
+	Name      string `mapstructure:"NAME"       json:"name"       validate:"required"`
+	Format    string `mapstructure:"FORMAT"     json:"format"     validate:"omitempty,oneof=string url nip05 lud16"`
+	MaxLength int    `mapstructure:"MAX_LENGTH" json:"max_length" validate:"min=0"`
+}
+
+// Strict reports whether metadata breaking any rule is rejected
+func (p MetadataPolicy) Strict() bool {
+	return p.Mode == "strict"
+}
+
+// KindReadPolicy restricts querying the listed kinds to "authenticated" (any
+// NIP-42 authenticated client) or "whitelisted" clients
+type KindReadPolicy struct {
+	Kinds  []int  `mapstructure:"KINDS"  json:"kinds"  validate:"required,dive,min=0,max=65535"`
+	Access string `mapstructure:"ACCESS" json:"access" validate:"oneof=authenticated whitelisted"`
+}
+
+// ReadAccess returns the access required to query events of kind, or "" when
+// anyone may. The first restriction listing kind takes precedence.
+func (c RelayPolicyConfig) ReadAccess(kind int) string {
+	for _, r := range c.ReadRestricted {
+		for _, k := range r.Kinds {
+			if k == kind {
+				return r.Access
+			}
+		}
+	}
+	return ""
+}
+
+// CreatedAtPolicy bounds event created_at relative to the current time; zero
+// disables a bound. Kinds overrides both bounds for the kinds it lists.
+type CreatedAtPolicy struct {
+	MaxPast   time.Duration     `mapstructure:"MAX_PAST"   json:"max_past"   validate:"min=0"`
+	MaxFuture time.Duration     `mapstructure:"MAX_FUTURE" json:"max_future" validate:"min=0"`
+	Kinds     []CreatedAtBounds `mapstructure:"KINDS"      json:"kinds"      validate:"omitempty,dive"`
+}
+
+// CreatedAtBounds are the created_at bounds of the listed kinds
+type CreatedAtBounds struct {
+	Kinds     []int         `mapstructure:"KINDS"      json:"kinds"      validate:"required,dive,min=0,max=65535"`
+	MaxPast   time.Duration `mapstructure:"MAX_PAST"   json:"max_past"   validate:"min=0"`
+	MaxFuture time.Duration `mapstructure:"MAX_FUTURE" json:"max_future" validate:"min=0"`
+}
+
+// Bounds returns how far in the past and future events of kind may be dated,
+// the first override listing kind taking precedence
+func (p CreatedAtPolicy) Bounds(kind int) (maxPast, maxFuture time.Duration) {
+	for _, b := range p.Kinds {
+		for _, k := range b.Kinds {
+			if k == kind {
+				return b.MaxPast, b.MaxFuture
+			}
+		}
+	}
+	return p.MaxPast, p.MaxFuture
 }
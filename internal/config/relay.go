@@ -8,24 +8,92 @@ type RelayConfig struct {
 	Description      string           `mapstructure:"DESCRIPTION"       json:"description"       validate:"omitempty,max=200"`
 	Contact          string           `mapstructure:"CONTACT"           json:"contact"           validate:"omitempty,email"`
 	PublicKey        string           `mapstructure:"PUBLIC_KEY"        json:"public_key"        validate:"omitempty,pubkey"`
+	OperatorPubKey   string           `mapstructure:"OPERATOR_PUBKEY"   json:"operator_pubkey"   validate:"omitempty,pubkey"`
+	OperatorNIP05    string           `mapstructure:"OPERATOR_NIP05"    json:"operator_nip05"    validate:"omitempty,max=320"`
 	Icon             string           `mapstructure:"ICON"              json:"icon"              validate:"omitempty,url"`
 	Banner           string           `mapstructure:"BANNER"            json:"banner"            validate:"omitempty,url"`
 	WSAddr           string           `mapstructure:"WS_ADDR"           json:"ws_addr"           validate:"required,wsaddr"`
 	PublicURL        string           `mapstructure:"PUBLIC_URL"        json:"public_url"        validate:"omitempty,url"`
 	IdleTimeout      time.Duration    `mapstructure:"IDLE_TIMEOUT"      json:"idle_timeout"      validate:"required,reasonable_duration"`
+	QueryTimeout     time.Duration    `mapstructure:"QUERY_TIMEOUT"     json:"query_timeout"     validate:"omitempty,timeout_duration"`
+	LiveWindow       time.Duration    `mapstructure:"LIVE_WINDOW"       json:"live_window"       validate:"omitempty,timeout_duration"`
 	WriteTimeout     time.Duration    `mapstructure:"WRITE_TIMEOUT"     json:"write_timeout"     validate:"required,timeout_duration"`
 	SendBufferSize   int              `mapstructure:"SEND_BUFFER_SIZE"  json:"send_buffer_size"  validate:"required,buffer_size"`
 	EventCacheSize   int              `mapstructure:"EVENT_CACHE_SIZE"  json:"event_cache_size"  validate:"required,min=100,max=1000000"`
+	DurableWrites    bool             `mapstructure:"DURABLE_WRITES"    json:"durable_writes"`
+	AuthDMs          bool             `mapstructure:"AUTH_DMS"          json:"auth_dms"`
+	TLSCert          string           `mapstructure:"TLS_CERT"          json:"tls_cert"`
+	TLSKey           string           `mapstructure:"TLS_KEY"           json:"tls_key"`
+	HTTP2            bool             `mapstructure:"HTTP2"             json:"http2"`
+	Resume           ResumeConfig     `mapstructure:"RESUME"            json:"resume"`
+	Sessions         SessionsConfig   `mapstructure:"SESSIONS"          json:"sessions"`
 	ThrottlingConfig ThrottlingConfig `mapstructure:"THROTTLING"        json:"throttling"        validate:"required"`
+
+	// ReusePort binds the listeners with SO_REUSEPORT, so a new relay binary can
+	// start on the same ports while the old one drains
+	ReusePort bool `mapstructure:"REUSE_PORT" json:"reuse_port"`
+	// DrainPeriod is how long a shutting down relay takes to close its WebSocket
+	// connections, spreading their reconnects to the process taking over
+	DrainPeriod time.Duration `mapstructure:"DRAIN_PERIOD" json:"drain_period" validate:"min=0"`
+	// TrustedProxies are the reverse proxies, CIDR ranges or single addresses,
+	// whose X-Real-IP and X-Forwarded-For headers name the client; from anyone
+	// else the peer address is the client's
+	TrustedProxies []string `mapstructure:"TRUSTED_PROXIES" json:"trusted_proxies" validate:"omitempty,dive,cidr|ip"`
+
+	// EventPipeline bounds the EVENTs of a connection waiting to be validated;
+	// once as many wait, more are refused as rate-limited
+	EventPipeline int `mapstructure:"EVENT_PIPELINE" json:"event_pipeline" validate:"min=1,max=1000"`
+	// ValidationWorkers bounds the events validated at once across all
+	// connections, 0 for twice the CPUs
+	ValidationWorkers int `mapstructure:"VALIDATION_WORKERS" json:"validation_workers" validate:"min=0"`
 }
 
 // ThrottlingConfig holds rate limiting settings.
 type ThrottlingConfig struct {
-	RateLimit      RateLimitConfig `mapstructure:"RATE_LIMIT"         json:"rate_limit"`
-	MaxContentLen  int             `mapstructure:"MAX_CONTENT_LENGTH" json:"max_content_length" validate:"required,min=100,max=65536"`
-	MaxConnections int             `mapstructure:"MAX_CONNECTIONS"    json:"max_connections"    validate:"required,min=1,max=100000"`
-	BanThreshold   int             `mapstructure:"BAN_THRESHOLD"      json:"ban_threshold"      validate:"required,min=1,max=1000"`
-	BanDuration    int             `mapstructure:"BAN_DURATION"       json:"ban_duration"       validate:"required,min=1,max=86400"`
+	RateLimit      RateLimitConfig   `mapstructure:"RATE_LIMIT"         json:"rate_limit"`
+	Profiles       RateLimitProfiles `mapstructure:"PROFILES"           json:"profiles"`
+	MaxContentLen  int               `mapstructure:"MAX_CONTENT_LENGTH" json:"max_content_length" validate:"required,min=100,max=65536"`
+	MaxConnections int               `mapstructure:"MAX_CONNECTIONS"    json:"max_connections"    validate:"required,min=1,max=100000"`
+	BanThreshold   int               `mapstructure:"BAN_THRESHOLD"      json:"ban_threshold"      validate:"required,min=1,max=1000"`
+	BanDuration    int               `mapstructure:"BAN_DURATION"       json:"ban_duration"       validate:"required,min=1,max=86400"`
+	Challenge      ChallengeConfig   `mapstructure:"CHALLENGE"          json:"challenge"`
+}
+
+// ChallengeConfig makes unauthenticated clients from unknown addresses prove
+// work before publishing while the relay is under load: their first event must
+// carry NIP-13 proof of work of Difficulty bits, unless they AUTH first. The
+// relay is under load once EventsPerSecond or ConnectionsPerSecond is reached;
+// 0 ignores a rate, and with both 0 clients are always challenged. Addresses
+// that passed aren't challenged again for KnownFor.
+type ChallengeConfig struct {
+	Enabled              bool          `mapstructure:"ENABLED"                json:"enabled"`
+	Difficulty           int           `mapstructure:"DIFFICULTY"             json:"difficulty"             validate:"min=0,max=32"`
+	EventsPerSecond      float64       `mapstructure:"EVENTS_PER_SECOND"      json:"events_per_second"      validate:"min=0"`
+	ConnectionsPerSecond float64       `mapstructure:"CONNECTIONS_PER_SECOND" json:"connections_per_second" validate:"min=0"`
+	KnownFor             time.Duration `mapstructure:"KNOWN_FOR"              json:"known_for"              validate:"min=0"`
+}
+
+// ResumeConfig lets clients keep their subscriptions across a short disconnect.
+// A client asks for a token with ["RESUME"] and, after reconnecting to the same
+// node within Window, sends ["RESUME", token] to get its subscriptions back along
+// with the events they matched meanwhile. Past MaxEvents missed events the
+// session is dropped and the client has to send its REQs again. At most
+// MaxSessions disconnected clients are kept, MaxPerIP of them per address.
+type ResumeConfig struct {
+	Enabled     bool          `mapstructure:"ENABLED"      json:"enabled"`
+	Window      time.Duration `mapstructure:"WINDOW"       json:"window"       validate:"min=0"`
+	MaxEvents   int           `mapstructure:"MAX_EVENTS"   json:"max_events"   validate:"min=0,max=100000"`
+	MaxSessions int           `mapstructure:"MAX_SESSIONS" json:"max_sessions" validate:"min=0"`
+	MaxPerIP    int           `mapstructure:"MAX_PER_IP"   json:"max_per_ip"   validate:"min=0"`
+}
+
+// SessionsConfig tracks client sessions: the connections of one address and
+// authenticated pubkey, counted together across reconnects. Sessions without
+// connections are kept for Retention, and at most MaxSessions are tracked.
+type SessionsConfig struct {
+	Enabled     bool          `mapstructure:"ENABLED"      json:"enabled"`
+	Retention   time.Duration `mapstructure:"RETENTION"    json:"retention"    validate:"min=0"`
+	MaxSessions int           `mapstructure:"MAX_SESSIONS" json:"max_sessions" validate:"min=0,max=10000000"`
 }
 
 // RateLimitConfig holds rate limiting settings.
@@ -39,3 +107,22 @@ type RateLimitConfig struct {
 	BanDuration          time.Duration `mapstructure:"BAN_DURATION"          json:"ban_duration"            validate:"reasonable_duration"`
 	MaxBanDuration       time.Duration `mapstructure:"MAX_BAN_DURATION"      json:"max_ban_duration"        validate:"reasonable_duration"`
 }
+
+// RateLimitProfiles holds per client class rate limits. Connections start in the
+// anonymous profile and are moved to another one after NIP-42 AUTH.
+type RateLimitProfiles struct {
+	Anonymous     RateLimitProfile `mapstructure:"ANONYMOUS"     json:"anonymous"`
+	Authenticated RateLimitProfile `mapstructure:"AUTHENTICATED" json:"authenticated"`
+	Whitelisted   RateLimitProfile `mapstructure:"WHITELISTED"   json:"whitelisted"`
+	Paid          RateLimitProfile `mapstructure:"PAID"          json:"paid"`
+	// Onion applies to unauthenticated connections through the Tor onion service
+	Onion RateLimitProfile `mapstructure:"ONION" json:"onion"`
+}
+
+// RateLimitProfile holds the limits applied to one client class.
+// Zero values fall back to the global RATE_LIMIT settings.
+type RateLimitProfile struct {
+	MaxEventsPerSecond   int `mapstructure:"MAX_EVENTS_PER_SECOND"   json:"max_events_per_second"   validate:"min=0,max=10000"`
+	MaxRequestsPerSecond int `mapstructure:"MAX_REQUESTS_PER_SECOND" json:"max_requests_per_second" validate:"min=0,max=50000"`
+	BurstSize            int `mapstructure:"BURST_SIZE"              json:"burst_size"              validate:"min=0,max=1000"`
+}
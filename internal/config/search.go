@@ -0,0 +1,21 @@
+package config
+
+import "time"
+
+// SearchConfig holds settings for the NIP-50 search extensions. The language and
+// NSFW flag of new events are always indexed; the domain: extension needs the
+// NIP-05 identifiers of profile authors verified.
+type SearchConfig struct {
+	// VerifyDomains checks the NIP-05 identifier of every new profile (kind 0),
+	// so domain: matches the authors whose identifier verified. Anyone publishing
+	// a profile makes the relay fetch from the domain it names; only public
+	// addresses are dialed.
+	VerifyDomains bool `mapstructure:"VERIFY_DOMAINS" json:"verify_domains"`
+	// DomainTimeout bounds fetching one nostr.json
+	DomainTimeout time.Duration `mapstructure:"DOMAIN_TIMEOUT" json:"domain_timeout" validate:"min=1s"`
+	// SpamReports leaves events out of search results once as many pubkeys
+	// reported them, or their author, as spam (NIP-56); include:spam keeps them.
+	// Anyone can report, so a few throwaway keys hide what they like: only turn it
+	// on where publishing is restricted. 0 turns spam filtering off.
+	SpamReports int `mapstructure:"SPAM_REPORTS" json:"spam_reports" validate:"min=0"`
+}
@@ -0,0 +1,18 @@
+package config
+
+import "time"
+
+// SelfTestConfig holds settings for the checks run once the relay has started,
+// whose report is logged and shown on the dashboard and /api/admin/selftest
+type SelfTestConfig struct {
+	Enabled bool `mapstructure:"ENABLED" json:"enabled"`
+	// Delay is how long after startup the checks run, for the listeners to come up
+	Delay time.Duration `mapstructure:"DELAY" json:"delay" validate:"min=0"`
+	// Timeout bounds each check
+	Timeout time.Duration `mapstructure:"TIMEOUT" json:"timeout" validate:"min=1s"`
+	// MinFreeDisk is the free space in bytes the relay's directories need
+	MinFreeDisk int64 `mapstructure:"MIN_FREE_DISK" json:"min_free_disk" validate:"min=0"`
+	// OutboundHosts are dialed, as host:port, to check outbound connectivity; the
+	// check passes when any of them answers and is skipped when empty
+	OutboundHosts []string `mapstructure:"OUTBOUND_HOSTS" json:"outbound_hosts" validate:"omitempty,dive,hostname_port"`
+}
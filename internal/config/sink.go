@@ -0,0 +1,50 @@
+package config
+
+import "time"
+
+// Event sink modes
+const (
+	SinkForwarder  = "forwarder"
+	SinkChangefeed = "changefeed"
+)
+
+// SinkConfig delivers accepted events to an external system, such as a search
+// indexer or an analytics pipeline, independently of the live dispatcher
+type SinkConfig struct {
+	Enabled bool `mapstructure:"ENABLED" json:"enabled"`
+	// Mode is "forwarder", each node POSTing the events it stored to URL in
+	// batches, or "changefeed", a CockroachDB changefeed the cluster runs into URL
+	Mode string `mapstructure:"MODE" json:"mode" validate:"oneof=forwarder changefeed"`
+	// URL is the HTTP endpoint of the forwarder, or any CockroachDB sink URI
+	// (webhook-https://, kafka://, gs://, s3://...) of the changefeed
+	URL string `mapstructure:"URL" json:"-"`
+	// Secret keys the HMAC-SHA256 signature of forwarded batches, sent in
+	// X-Relay-Signature; unsigned when empty
+	Secret string `mapstructure:"SECRET" json:"-"`
+	// Kinds restricts the events delivered to these kinds, all kinds when empty
+	Kinds []int `mapstructure:"KINDS" json:"kinds" validate:"omitempty,dive,min=0"`
+	// BatchSize bounds the events the forwarder POSTs at once
+	BatchSize int `mapstructure:"BATCH_SIZE" json:"batch_size" validate:"min=1,max=10000"`
+	// FlushInterval is the longest the forwarder holds events before POSTing them
+	FlushInterval time.Duration `mapstructure:"FLUSH_INTERVAL" json:"flush_interval" validate:"min=10ms"`
+	// QueueSize bounds the events waiting to be forwarded; past it events are
+	// dropped rather than slowing down storage
+	QueueSize int `mapstructure:"QUEUE_SIZE" json:"queue_size" validate:"min=1"`
+	// Timeout bounds one POST
+	Timeout time.Duration `mapstructure:"TIMEOUT" json:"timeout" validate:"min=1s"`
+	// MaxAttempts is how many times a batch is POSTed before it is dropped
+	MaxAttempts int `mapstructure:"MAX_ATTEMPTS" json:"max_attempts" validate:"min=1"`
+}
+
+// Forwards reports whether kind is delivered to the sink
+func (c SinkConfig) Forwards(kind int) bool {
+	if len(c.Kinds) == 0 {
+		return true
+	}
+	for _, k := range c.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TenantIDPattern is the form of tenant IDs: lowercase letters, digits and dashes
+var TenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// reservedTenantID names the main relay's identity in the keyring and on the
+// identity command line, so no virtual relay can take it
+const reservedTenantID = "default"
+
+// reservedTenantPaths are the paths served by the main relay, which virtual
+// relays can't be routed on
+var reservedTenantPaths = []string{"/api", "/static", "/.well-known", "/health", "/subscribe", "/upload", "/list"}
+
+// TenantConfig is a virtual relay hosted by the same process, reached on its own
+// hosts, its own path or both. Its clients only see each other's events, and the
+// policies it sets replace the main relay's; unset ones fall back to them.
+type TenantConfig struct {
+	ID string `mapstructure:"ID" json:"id" validate:"required,tenantid"`
+	// Hosts are the host names routed to the tenant, any host when empty
+	Hosts []string `mapstructure:"HOSTS" json:"hosts" validate:"omitempty,dive,hostname_rfc1123"`
+	// Path is the URL path routed to the tenant, e.g. "/community-a"; empty
+	// routes every path of its hosts
+	Path string `mapstructure:"PATH" json:"path" validate:"omitempty,startswith=/,excludesall=?#"`
+	// WritePolicy restricts who may publish: "open", "authenticated" or
+	// "whitelist"; empty follows RELAY_POLICY.WRITE_POLICY
+	WritePolicy string `mapstructure:"WRITE_POLICY" json:"write_policy" validate:"omitempty,oneof=open authenticated whitelist"`
+	// Private requires NIP-42 AUTH as one of Whitelist to read or write
+	Private bool `mapstructure:"PRIVATE" json:"private"`
+	// Whitelist are the tenant's members, which replace RELAY_POLICY.WHITELIST
+	Whitelist []string `mapstructure:"WHITELIST" json:"whitelist" validate:"omitempty,dive,pubkey"`
+	// Kinds are the only kinds the tenant accepts, any kind when empty
+	Kinds []int `mapstructure:"KINDS" json:"kinds" validate:"omitempty,dive,min=0,max=65535"`
+	// Info is the tenant's NIP-11 relay information
+	Info TenantInfo `mapstructure:"INFO" json:"info"`
+	// Quota bounds what the tenant may use of the relay
+	Quota TenantQuota `mapstructure:"QUOTA" json:"quota"`
+	// Suspended stops serving the tenant without deleting it or its events
+	Suspended bool `mapstructure:"SUSPENDED" json:"suspended"`
+}
+
+// TenantQuota bounds a tenant's resources; 0 leaves a resource unbounded
+type TenantQuota struct {
+	// MaxEvents is the number of events the tenant may store, checked against
+	// a count taken every minute
+	MaxEvents int64 `mapstructure:"MAX_EVENTS" json:"max_events" validate:"min=0"`
+	// MaxConnections is the number of WebSocket connections the tenant may hold
+	// on each node
+	MaxConnections int `mapstructure:"MAX_CONNECTIONS" json:"max_connections" validate:"min=0"`
+}
+
+// TenantInfo is what a tenant's NIP-11 document says about it. Unset fields are
+// taken from RELAY, except the fees, which only the tenant advertises.
+type TenantInfo struct {
+	Name        string `mapstructure:"NAME"        json:"name"        validate:"omitempty,max=30"`
+	Description string `mapstructure:"DESCRIPTION" json:"description" validate:"omitempty,max=200"`
+	Contact     string `mapstructure:"CONTACT"     json:"contact"     validate:"omitempty,email"`
+	// PubKey is the tenant operator's pubkey
+	PubKey string `mapstructure:"PUBKEY" json:"pubkey" validate:"omitempty,pubkey"`
+	Icon   string `mapstructure:"ICON"   json:"icon"   validate:"omitempty,url"`
+	Banner string `mapstructure:"BANNER" json:"banner" validate:"omitempty,url"`
+	// PaymentsURL is where the tenant's fees are paid; setting it advertises the
+	// tenant as payment_required
+	PaymentsURL string      `mapstructure:"PAYMENTS_URL" json:"payments_url" validate:"omitempty,url"`
+	Fees        FeeSchedule `mapstructure:"FEES"         json:"fees"`
+}
+
+// ValidateTenant checks a single tenant definition, including one created at
+// runtime, without comparing it to the other tenants
+func ValidateTenant(t TenantConfig) error {
+	if err := validate.Struct(t); err != nil {
+		return fmt.Errorf("invalid tenant %q: %w", t.ID, err)
+	}
+	if t.ID == reservedTenantID {
+		return fmt.Errorf("tenant ID %q is reserved for the main relay", t.ID)
+	}
+	if len(t.Hosts) == 0 && t.Path == "" {
+		return fmt.Errorf("tenant %q needs HOSTS or a PATH to be routed on", t.ID)
+	}
+	if t.Path != "" {
+		path := strings.TrimSuffix(t.Path, "/")
+		if path == "" {
+			return fmt.Errorf("tenant %q can't be routed on the root path, give it HOSTS instead", t.ID)
+		}
+		for _, reserved := range reservedTenantPaths {
+			if path == reserved || strings.HasPrefix(path, reserved+"/") {
+				return fmt.Errorf("tenant %q path %s is served by the main relay", t.ID, t.Path)
+			}
+		}
+	}
+	if (t.Private || t.WritePolicy == "whitelist") && len(t.Whitelist) == 0 {
+		return fmt.Errorf("tenant %q is private or whitelist-only but has no WHITELIST", t.ID)
+	}
+	return nil
+}
+
+// Routes returns the host and path pairs the tenant is reached on, with an
+// empty host standing for any host
+func (t TenantConfig) Routes() []string {
+	path := strings.TrimSuffix(t.Path, "/")
+	if len(t.Hosts) == 0 {
+		return []string{path}
+	}
+	routes := make([]string, len(t.Hosts))
+	for i, host := range t.Hosts {
+		routes[i] = strings.ToLower(host) + path
+	}
+	return routes
+}
+
+// Allows reports whether the tenant accepts events of kind
+func (t TenantConfig) Allows(kind int) bool {
+	if len(t.Kinds) == 0 {
+		return true
+	}
+	for _, k := range t.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,19 @@
+package config
+
+// TorConfig publishes the relay as a Tor onion service. Onion clients reach the
+// relay on ListenAddr, where they get the ONION rate limit profile. With
+// ControlAddr set the relay creates the service through tor's control port and
+// keeps its key in KeyFile; otherwise the service is configured in torrc
+// (HiddenServicePort 80 ListenAddr) and OnionAddress names it.
+type TorConfig struct {
+	Enabled    bool   `mapstructure:"ENABLED"     json:"enabled"`
+	ListenAddr string `mapstructure:"LISTEN_ADDR" json:"listen_addr" validate:"omitempty,wsaddr"`
+	// ControlAddr is tor's control port, host:port
+	ControlAddr string `mapstructure:"CONTROL_ADDR" json:"control_addr" validate:"omitempty,hostname_port"`
+	// ControlPassword authenticates to a control port protected by
+	// HashedControlPassword; without it cookie or no authentication is used
+	ControlPassword string `mapstructure:"CONTROL_PASSWORD" json:"-"`
+	KeyFile         string `mapstructure:"KEY_FILE"         json:"key_file"`
+	// OnionAddress is the host of an onion service configured in torrc
+	OnionAddress string `mapstructure:"ONION_ADDRESS" json:"onion_address" validate:"omitempty,endswith=.onion"`
+}
@@ -0,0 +1,9 @@
+package config
+
+// WellKnownConfig holds the documents served under /.well-known/.
+type WellKnownConfig struct {
+	Enabled         bool              `mapstructure:"ENABLED"          json:"enabled"`
+	Names           map[string]string `mapstructure:"NAMES"            json:"names"            validate:"omitempty,dive,keys,max=64,endkeys,pubkey"`
+	Lnurlp          map[string]string `mapstructure:"LNURLP"           json:"lnurlp"           validate:"omitempty,dive,keys,max=64,endkeys,email"`
+	SecurityContact string            `mapstructure:"SECURITY_CONTACT" json:"security_contact" validate:"omitempty,max=320"`
+}
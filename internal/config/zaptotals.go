@@ -0,0 +1,14 @@
+package config
+
+import "time"
+
+// ZapTotalsConfig sums NIP-57 zap receipts for /api/zaps. Anyone can publish a
+// receipt, so one only counts once its signer is found to be the zap provider
+// of the recipient's lightning address, which means fetching the LNURL-pay
+// document the recipient's profile (kind 0) names; only public addresses are
+// dialed.
+type ZapTotalsConfig struct {
+	Enabled bool `mapstructure:"ENABLED" json:"enabled"`
+	// ProviderTimeout bounds fetching one LNURL-pay document
+	ProviderTimeout time.Duration `mapstructure:"PROVIDER_TIMEOUT" json:"provider_timeout" validate:"min=1s"`
+}
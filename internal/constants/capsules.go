@@ -4,6 +4,10 @@ package constants
 const (
 	// KindTimeCapsule is for time-lock encrypted messages
 	KindTimeCapsule = 1041
+	// KindUnlockShare is a witness's key share for a threshold time capsule
+	KindUnlockShare = 11991
+	// KindShareDistribution is the capsule author's witness list and share threshold
+	KindShareDistribution = 11992
 	// KindSeal is for NIP-59 sealed events (rumor wrapped in NIP-44 encryption)
 	KindSeal = 13
 	// KindGiftWrap is for NIP-59 gift wrapped events (seal wrapped in ephemeral encryption)
@@ -18,6 +22,13 @@ const (
 	TagAlt = "alt"
 	// TagP contains recipient public key (for routing gift wraps)
 	TagP = "p"
+	// TagE references the time capsule a share event belongs to
+	TagE = "e"
+	// TagThreshold declares the number of witness shares needed to unlock: ["threshold", "<t>"]
+	TagThreshold = "threshold"
+	// FilterTagUnlocked is the vendor REQ filter ("#unlocked": ["true"]) selecting
+	// capsules whose drand round has been reached
+	FilterTagUnlocked = "unlocked"
 )
 
 // NIP-44 constants
@@ -62,4 +73,7 @@ const (
 	ErrEmptyTags                = "seal event must have empty tags"
 	ErrMissingSealContent       = "seal event missing content"
 	ErrMissingGiftWrapRecipient = "gift wrap missing recipient tag"
+	ErrMissingCapsuleReference  = "missing capsule e tag"
+	ErrInvalidThreshold         = "invalid threshold tag"
+	ErrInvalidWitness           = "invalid witness p tag"
 )
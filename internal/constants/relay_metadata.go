@@ -41,6 +41,7 @@ var DefaultSupportedNIPs = []interface{}{
 	28, // NIP-28: Public Chat
 	33, // NIP-33: Addressable Events
 	40, // NIP-40: Expiration Timestamp
+	42, // NIP-42: Authentication of clients to relays
 	44, // NIP-44: Encrypted Payloads (Versioned)
 	45, // NIP-45: Counting Events
 	47, // NIP-47: Nostr Wallet Connect (NWC)
@@ -57,6 +58,7 @@ var DefaultSupportedNIPs = []interface{}{
 	65, // NIP-65: Relay List Metadata
 	72, // NIP-72: Moderated Communities
 	78, // NIP-78: Application-specific data
+	89, // NIP-89: Recommended Application Handlers
 
 }
 
@@ -153,27 +155,178 @@ func DefaultRelayMetadata(cfg *config.Config) nip11.RelayInformationDocument {
 		maxContentLength = MaxContentLength // fallback to default constant
 	}
 
+	// Private relays require AUTH, restricted write policies limit who may publish
+	authRequired := AuthRequired || cfg.RelayPolicy.Private
+	restrictWrite := RestrictedWrites || cfg.RelayPolicy.Private ||
+		(cfg.RelayPolicy.WritePolicy != "" && cfg.RelayPolicy.WritePolicy != "open")
+	paymentRequired := PaymentRequired || cfg.Payments.Enabled
+
+	// Paid relays advertise where and how much to pay
+	var paymentsURL string
+	var fees *nip11.RelayFeesDocument
+	if cfg.Payments.Enabled {
+		paymentsURL = cfg.Payments.URL
+		fees = relayFees(cfg.Payments.Fees, cfg.Payments.Tiers)
+	}
+
+	// The default created_at window; RELAY_POLICY.CREATED_AT.KINDS may override it
+	createdAtLower := int64(cfg.RelayPolicy.CreatedAt.MaxPast.Seconds())
+	createdAtUpper := int64(cfg.RelayPolicy.CreatedAt.MaxFuture.Seconds())
+
+	// Invite codes are redeemed with NIP-43 join requests
+	supportedNIPs := DefaultSupportedNIPs
+	if cfg.Invites.Enabled {
+		supportedNIPs = withNIP(supportedNIPs, 43)
+	}
+	// NIP-13 proof of work is required from every event
+	if cfg.RelayPolicy.MinPowDifficulty > 0 {
+		supportedNIPs = withNIP(supportedNIPs, 13)
+	}
+	// NIP-62 vanish requests purge their author's events when honored
+	if cfg.RelayPolicy.HonorVanishRequests {
+		supportedNIPs = withNIP(supportedNIPs, 62)
+	}
+
 	return nip11.RelayInformationDocument{
 		Name:          relayName,
 		Description:   relayDescription,
 		Contact:       relayContact,
 		PubKey:        relayIdentity.PublicKey,
-		SupportedNIPs: DefaultSupportedNIPs,
+		SupportedNIPs: supportedNIPs,
 		Software:      DefaultRelaySoftware,
 		Version:       config.Version,
 		Icon:          relayIcon,
 		Banner:        relayBanner,
+		PaymentsURL:   paymentsURL,
+		Fees:          fees,
 		Limitation: &nip11.RelayLimitationDocument{
-			MaxMessageLength: maxContentLength, // Use actual configured content length
-			MaxSubscriptions: MaxSubscriptions, // Use constant (configurable via config if needed)
-			MaxLimit:         MaxLimit,         // Use constant (configurable via config if needed)
-			MaxSubidLength:   MaxSubIDLength,   // Use constant (configurable via config if needed)
-			MaxEventTags:     MaxEventTags,     // Use constant (configurable via config if needed)
-			MaxContentLength: maxContentLength, // Use actual configured content length
-			MinPowDifficulty: MinPowDifficulty, // Use constant (configurable via config if needed)
-			AuthRequired:     AuthRequired,     // Use constant (configurable via config if needed)
-			PaymentRequired:  PaymentRequired,  // Use constant (configurable via config if needed)
-			RestrictedWrites: RestrictedWrites, // Use constant (configurable via config if needed)
+			MaxMessageLength:    maxContentLength, // Use actual configured content length
+			MaxSubscriptions:    MaxSubscriptions, // Use constant (configurable via config if needed)
+			MaxLimit:            MaxLimit,         // Use constant (configurable via config if needed)
+			MaxSubidLength:      MaxSubIDLength,   // Use constant (configurable via config if needed)
+			MaxEventTags:        MaxEventTags,     // Use constant (configurable via config if needed)
+			MaxContentLength:    maxContentLength, // Use actual configured content length
+			MinPowDifficulty:    max(MinPowDifficulty, cfg.RelayPolicy.MinPowDifficulty), // Constant, or raised by the relay policy
+			AuthRequired:        authRequired,     // Constant, or forced on for private relays
+			PaymentRequired:     paymentRequired,  // Constant, or forced on when payments are enabled
+			RestrictedWrites:    restrictWrite,    // Constant, or forced on by the write policy
+			CreatedAtLowerLimit: createdAtLower,   // Configured seconds into the past, 0 for no limit
+			CreatedAtUpperLimit: createdAtUpper,   // Configured seconds into the future, 0 for no limit
 		},
 	}
 }
+
+// TenantRelayMetadata returns the metadata document of a virtual relay: its own
+// information and fees over the main relay's, with the limitations its policies
+// imply. Without a configured pubkey it advertises its key from the keyring,
+// and the main relay's only when it has none.
+func TenantRelayMetadata(cfg *config.Config, t config.TenantConfig) nip11.RelayInformationDocument {
+	doc := DefaultRelayMetadata(cfg)
+	info := t.Info
+	if info.Name != "" {
+		doc.Name = info.Name
+	}
+	if info.Description != "" {
+		doc.Description = info.Description
+	}
+	if info.Contact != "" {
+		doc.Contact = info.Contact
+	}
+	if info.PubKey != "" {
+		doc.PubKey = info.PubKey
+	} else if pubkey, ok := tenantPublicKey(t.ID); ok {
+		doc.PubKey = pubkey
+	}
+	if info.Icon != "" {
+		doc.Icon = info.Icon
+	}
+	if info.Banner != "" {
+		doc.Banner = info.Banner
+	}
+
+	// A tenant following the main relay's write policy is paid for there;
+	// otherwise only the tenant's own fees apply
+	if t.WritePolicy != "" || info.PaymentsURL != "" {
+		doc.PaymentsURL = info.PaymentsURL
+		doc.Fees = nil
+		if info.PaymentsURL != "" {
+			doc.Fees = relayFees(info.Fees, nil)
+		}
+	}
+
+	writePolicy := t.WritePolicy
+	if writePolicy == "" {
+		writePolicy = cfg.RelayPolicy.WritePolicy
+	}
+	limitation := *doc.Limitation
+	limitation.AuthRequired = AuthRequired || t.Private
+	limitation.PaymentRequired = PaymentRequired || doc.PaymentsURL != ""
+	limitation.RestrictedWrites = RestrictedWrites || t.Private || (writePolicy != "" && writePolicy != "open")
+	doc.Limitation = &limitation
+	return doc
+}
+
+// relayFees converts the configured fee schedule to the NIP-11 fees document.
+// Membership tiers are advertised as subscriptions.
+func relayFees(schedule config.FeeSchedule, tiers []config.TierConfig) *nip11.RelayFeesDocument {
+	fees := &nip11.RelayFeesDocument{}
+	for _, fee := range schedule.Admission {
+		fees.Admission = append(fees.Admission, struct {
+			Amount int    `json:"amount"`
+			Unit   string `json:"unit"`
+		}{Amount: fee.Amount, Unit: fee.Unit})
+	}
+	for _, fee := range schedule.Subscription {
+		fees.Subscription = append(fees.Subscription, struct {
+			Amount int    `json:"amount"`
+			Unit   string `json:"unit"`
+			Period int    `json:"period"`
+		}{Amount: fee.Amount, Unit: fee.Unit, Period: int(fee.Period.Seconds())})
+	}
+	for _, tier := range tiers {
+		fees.Subscription = append(fees.Subscription, struct {
+			Amount int    `json:"amount"`
+			Unit   string `json:"unit"`
+			Period int    `json:"period"`
+		}{Amount: tier.Amount, Unit: tier.Unit, Period: int(tier.Period.Seconds())})
+	}
+	for _, fee := range schedule.Publication {
+		fees.Publication = append(fees.Publication, struct {
+			Kinds  []int  `json:"kinds"`
+			Amount int    `json:"amount"`
+			Unit   string `json:"unit"`
+		}{Kinds: fee.Kinds, Amount: fee.Amount, Unit: fee.Unit})
+	}
+	return fees
+}
+
+// withNIP returns a copy of nips with nip inserted in ascending order
+func withNIP(nips []interface{}, nip int) []interface{} {
+	result := make([]interface{}, 0, len(nips)+1)
+	inserted := false
+	for _, n := range nips {
+		if v, ok := n.(int); ok && !inserted && v > nip {
+			result = append(result, nip)
+			inserted = true
+		}
+		result = append(result, n)
+	}
+	if !inserted {
+		result = append(result, nip)
+	}
+	return result
+}
+
+// tenantPublicKey returns the public key of the tenant's identity in the keyring,
+// false when it has none
+func tenantPublicKey(tenant string) (string, bool) {
+	keyring, err := identity.DefaultKeyring()
+	if err != nil {
+		return "", false
+	}
+	pubkey, err := keyring.PublicKey(tenant)
+	if err != nil {
+		return "", false
+	}
+	return pubkey, true
+}
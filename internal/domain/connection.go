@@ -11,6 +11,8 @@ type WebSocketConnection interface {
 	SendMessage(msg []byte)
 	SendEvent(subID string, evt *nostr.Event)
 	Close()
+	// CloseForRestart closes the connection telling the client to reconnect
+	CloseForRestart()
 
 	// Subscription management
 	GetSubscriptions() map[string][]nostr.Filter
@@ -20,6 +22,13 @@ type WebSocketConnection interface {
 
 	// Remote address for logging/identification
 	RemoteAddr() string
+	// ClientID uniquely identifies the connection on this node
+	ClientID() string
+	// Tenant is the virtual relay the connection was opened on, "" for the main relay
+	Tenant() string
+	// CanReceive reports whether evt may be delivered on the connection under
+	// its read restrictions and authentication
+	CanReceive(evt *nostr.Event) bool
 }
 
 // ConnectionManager defines the interface for managing WebSocket connections
@@ -18,21 +18,78 @@ type EventHandler interface {
 	GetEventCount(ctx context.Context, filter nostr.Filter) (int64, error)
 }
 
-// ValidationResult represents the outcome of event validation
-type ValidationResult struct {
-	Valid  bool
-	Reason string
-	Error  error
+// EventStatus is how the relay settled an event submitted by a client
+type EventStatus string
+
+const (
+	// EventAccepted events were stored or broadcast
+	EventAccepted EventStatus = "accepted"
+	// EventDuplicate events were already stored and are acknowledged as is
+	EventDuplicate EventStatus = "duplicate"
+	// EventRejected events were refused by a policy or failed validation
+	EventRejected EventStatus = "rejected"
+	// EventFailed events couldn't be handled because of a relay error
+	EventFailed EventStatus = "error"
+)
+
+// EventResult is the outcome of an event submitted by a client: its status, the
+// machine-readable reason code of NIP-01 (invalid, blocked, rate-limited, ...) and
+// a human-readable message. The OK response, the metrics, the decision log and the
+// admin API all report it.
+type EventResult struct {
+	Status  EventStatus `json:"status"`
+	Code    string      `json:"code,omitempty"`
+	Message string      `json:"message,omitempty"`
+}
+
+// AcceptEvent is the result of an event stored or broadcast
+func AcceptEvent() EventResult {
+	return EventResult{Status: EventAccepted}
+}
+
+// DuplicateEvent is the result of an event that was already stored
+func DuplicateEvent() EventResult {
+	return EventResult{Status: EventDuplicate, Code: "duplicate", Message: "event already exists"}
+}
+
+// RejectEvent is the result of an event refused with the reason code and message
+func RejectEvent(code, message string) EventResult {
+	return EventResult{Status: EventRejected, Code: code, Message: message}
+}
+
+// FailEvent is the result of an event the relay failed to handle
+func FailEvent(message string) EventResult {
+	return EventResult{Status: EventFailed, Code: "error", Message: message}
+}
+
+// OK reports whether the event is acknowledged with OK true
+func (r EventResult) OK() bool {
+	return r.Status == EventAccepted || r.Status == EventDuplicate
+}
+
+// OKMessage returns the message of the OK response, "<code>: <message>"
+func (r EventResult) OKMessage() string {
+	switch {
+	case r.Code == "":
+		return r.Message
+	case r.Message == "":
+		return r.Code + ":"
+	default:
+		return r.Code + ": " + r.Message
+	}
 }
 
 // EventValidator defines the interface for validating Nostr events
 type EventValidator interface {
-	// Validate a Nostr event
-	ValidateEvent(ctx context.Context, event nostr.Event) (bool, string)
+	// Validate a Nostr event published to tenant
+	ValidateEvent(ctx context.Context, tenant string, event nostr.Event) (bool, string)
 
 	// Validate a Nostr filter
 	ValidateFilter(filter nostr.Filter) error
 
-	// Validate and process an event
-	ValidateAndProcessEvent(ctx context.Context, event nostr.Event) (bool, string, error)
+	// Validate and process an event published to tenant
+	ValidateAndProcessEvent(ctx context.Context, tenant string, event nostr.Event) EventResult
+
+	// Re-check a stored event against the current policies
+	RevalidateEvent(ctx context.Context, event nostr.Event) (bool, string)
 }
@@ -3,8 +3,17 @@ package domain
 import (
 	"time"
 	
+	"github.com/Shugur-Network/relay/internal/analytics"
+	"github.com/Shugur-Network/relay/internal/blocklist"
+	"github.com/Shugur-Network/relay/internal/capture"
 	"github.com/Shugur-Network/relay/internal/config"
+	"github.com/Shugur-Network/relay/internal/limiter"
+	"github.com/Shugur-Network/relay/internal/motd"
+	"github.com/Shugur-Network/relay/internal/payments"
+	"github.com/Shugur-Network/relay/internal/rebroadcast"
+	"github.com/Shugur-Network/relay/internal/sessions"
 	"github.com/Shugur-Network/relay/internal/storage"
+	"github.com/Shugur-Network/relay/internal/tenant"
 	nostr "github.com/nbd-wtf/go-nostr"
 )
 
@@ -23,6 +32,7 @@ type NodeInterface interface {
 	// Connection management
 	RegisterConn(conn WebSocketConnection)
 	UnregisterConn(conn WebSocketConnection)
+	Connection(clientID string) (WebSocketConnection, bool)
 	GetActiveConnectionCount() int64
 	GetConnectionCount() int        // For health checks
 	GetStartTime() time.Time        // For health checks
@@ -35,6 +45,52 @@ type NodeInterface interface {
 
 	// Event dispatcher access
 	GetEventDispatcher() *storage.EventDispatcher
+
+	// Virtual relays hosted alongside the main relay
+	Tenants() *tenant.Registry
+	TenantConnections(id string) int
+	DisconnectTenant(id string)
+	TenantMeter() *tenant.Meter
+	IPAccess() *blocklist.IPAccess
+
+	// Client classification for rate limit profiles
+	ClassifyClient(pubkey string) limiter.ClientClass
+
+	// Paid admission tracking
+	PaidAdmission(pubkey string) (storage.PaidPubkey, bool)
+	SetPaid(pubkey string, paidUntil int64, tier string)
+	RevokePaid(pubkey string)
+	// Suspended pubkeys may read but not publish
+	Suspension(pubkey string) (storage.Suspension, bool)
+	Suspend(s storage.Suspension)
+	Reinstate(pubkey string)
+	// Pubkeys that asked to vanish (NIP-62), by tenant
+	Vanished(tenant, pubkey string) (storage.Vanish, bool)
+	RecordVanish(v storage.Vanish)
+	// Start a revalidation run recorded in the database without waiting for the poll
+	ResumeRevalidation()
+	// Daily event quota of unpaid authors, nil when there is none
+	FreeQuota() *limiter.DailyQuota
+	Challenge() *limiter.Challenge
+	// Client sessions across reconnects, nil when not tracked
+	Sessions() *sessions.Tracker
+	// Frame captures of chosen clients, nil without the admin API
+	Captures() *capture.Recorder
+	// Jobs republishing stored events to other relays, nil without the admin API
+	Rebroadcasts() *rebroadcast.Manager
+	// Aggregate of the REQ filters served, nil when disabled
+	QueryAnalytics() *analytics.Recorder
+	// Messages of the day sent to clients, nil when disabled
+	MOTD() *motd.Board
+	// Closed once the node starts shutting down and its listeners stop accepting
+	Draining() <-chan struct{}
+
+	// Lightning invoices for paid admission, nil when no backend is configured
+	Payments() *payments.Service
+	// Zap top-ups, nil when zaps are not credited
+	Zaps() *payments.ZapCreditor
+	// Cashu ecash and nutzaps, nil when Cashu is not accepted
+	Cashu() *payments.CashuRedeemer
 }
 
 // EventDispatcherClient represents a client that receives real-time event notifications
@@ -0,0 +1,219 @@
+// Package drand is a minimal client for the drand HTTP API, used to check the
+// beacon chain and round referenced by time capsules.
+package drand
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultTimeout bounds a single request to a drand endpoint
+	DefaultTimeout = 5 * time.Second
+	// unknownChainTTL is how long a chain reported unknown by every endpoint stays cached
+	unknownChainTTL = 10 * time.Minute
+	// maxUnknownChains bounds the unknown chains cached, since events can name any hash
+	maxUnknownChains = 1024
+	// maxInfoSize limits the size of a chain info response
+	maxInfoSize = 64 * 1024
+)
+
+var (
+	// ErrUnknownChain is returned when no endpoint serves the requested chain
+	ErrUnknownChain = errors.New("unknown drand chain")
+	// ErrInvalidRound is returned when a round can never exist on a chain
+	ErrInvalidRound = errors.New("invalid drand round")
+	// ErrRoundNotInFuture is returned when a future round was required but the round already passed
+	ErrRoundNotInFuture = errors.New("drand round is not in the future")
+)
+
+// ChainInfo is the subset of a drand chain's /info document the relay needs
+type ChainInfo struct {
+	Hash        string `json:"hash"`
+	PublicKey   string `json:"public_key"`
+	Period      int64  `json:"period"`
+	GenesisTime int64  `json:"genesis_time"`
+	SchemeID    string `json:"schemeID"`
+}
+
+// RoundAt returns the latest round emitted at t (0 before genesis)
+func (ci *ChainInfo) RoundAt(t time.Time) int64 {
+	if ci.Period <= 0 || t.Unix() < ci.GenesisTime {
+		return 0
+	}
+	return (t.Unix()-ci.GenesisTime)/ci.Period + 1
+}
+
+// TimeOfRound returns when a round is emitted
+func (ci *ChainInfo) TimeOfRound(round int64) time.Time {
+	if round <= 1 {
+		return time.Unix(ci.GenesisTime, 0)
+	}
+	return time.Unix(ci.GenesisTime+(round-1)*ci.Period, 0)
+}
+
+// Client fetches and caches chain information from one or more drand HTTP endpoints
+type Client struct {
+	urls       []string
+	httpClient *http.Client
+
+	mu      sync.RWMutex
+	chains  map[string]*ChainInfo
+	unknown map[string]time.Time
+}
+
+// NewClient creates a client for the given drand HTTP endpoints, tried in order
+func NewClient(urls []string, timeout time.Duration) *Client {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	trimmed := make([]string, 0, len(urls))
+	for _, u := range urls {
+		trimmed = append(trimmed, strings.TrimRight(u, "/"))
+	}
+	return &Client{
+		urls:       trimmed,
+		httpClient: &http.Client{Timeout: timeout},
+		chains:     make(map[string]*ChainInfo),
+		unknown:    make(map[string]time.Time),
+	}
+}
+
+// ChainInfo returns the info of a chain, fetching it on first use. Chain info is
+// immutable so it is cached for the life of the client.
+func (c *Client) ChainInfo(ctx context.Context, chainHash string) (*ChainInfo, error) {
+	c.mu.RLock()
+	info, ok := c.chains[chainHash]
+	unknownUntil, isUnknown := c.unknown[chainHash]
+	c.mu.RUnlock()
+	if ok {
+		return info, nil
+	}
+	if isUnknown && time.Now().Before(unknownUntil) {
+		return nil, ErrUnknownChain
+	}
+
+	var lastErr error
+	notFound := 0
+	for _, base := range c.urls {
+		info, err := c.fetchChainInfo(ctx, base, chainHash)
+		if err == nil {
+			c.mu.Lock()
+			c.chains[chainHash] = info
+			delete(c.unknown, chainHash)
+			c.mu.Unlock()
+			return info, nil
+		}
+		if errors.Is(err, ErrUnknownChain) {
+			notFound++
+		}
+		lastErr = err
+	}
+
+	// Only remember a chain as unknown when every endpoint answered and none knew it
+	if len(c.urls) > 0 && notFound == len(c.urls) {
+		c.rememberUnknown(chainHash)
+		return nil, ErrUnknownChain
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no drand endpoints configured")
+	}
+	return nil, lastErr
+}
+
+// rememberUnknown caches chainHash as unknown for unknownChainTTL. Once the
+// cache is full, expired entries and then the ones expiring first make room.
+func (c *Client) rememberUnknown(chainHash string) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.unknown) >= maxUnknownChains {
+		for hash, until := range c.unknown {
+			if !now.Before(until) {
+				delete(c.unknown, hash)
+			}
+		}
+	}
+	for len(c.unknown) >= maxUnknownChains {
+		var oldest string
+		var oldestUntil time.Time
+		for hash, until := range c.unknown {
+			if oldest == "" || until.Before(oldestUntil) {
+				oldest, oldestUntil = hash, until
+			}
+		}
+		delete(c.unknown, oldest)
+	}
+	c.unknown[chainHash] = now.Add(unknownChainTTL)
+}
+
+// VerifyRound checks that chainHash is a known chain and that round is valid on it.
+// With requireFuture the round must not have been emitted yet.
+func (c *Client) VerifyRound(ctx context.Context, chainHash string, round int64, requireFuture bool) error {
+	info, err := c.ChainInfo(ctx, chainHash)
+	if err != nil {
+		return err
+	}
+	if round < 1 {
+		return fmt.Errorf("%w: %d", ErrInvalidRound, round)
+	}
+	if requireFuture {
+		if current := info.RoundAt(time.Now()); round <= current {
+			return fmt.Errorf("%w: round %d, current round %d", ErrRoundNotInFuture, round, current)
+		}
+	}
+	return nil
+}
+
+// UnlockTime returns when round is emitted on chainHash, i.e. when a capsule
+// locked to that round can be decrypted
+func (c *Client) UnlockTime(ctx context.Context, chainHash string, round int64) (time.Time, error) {
+	info, err := c.ChainInfo(ctx, chainHash)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.TimeOfRound(round), nil
+}
+
+// fetchChainInfo requests GET <base>/<chain hash>/info
+func (c *Client) fetchChainInfo(ctx context.Context, base, chainHash string) (*ChainInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/"+chainHash+"/info", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		logger.Debug("drand endpoint unreachable", zap.String("url", base), zap.Error(err))
+		return nil, fmt.Errorf("drand endpoint %s unreachable: %w", base, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrUnknownChain
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("drand endpoint %s returned %s", base, resp.Status)
+	}
+
+	var info ChainInfo
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxInfoSize)).Decode(&info); err != nil {
+		return nil, fmt.Errorf("invalid chain info from %s: %w", base, err)
+	}
+	if info.Hash != chainHash {
+		return nil, fmt.Errorf("drand endpoint %s returned info for chain %s", base, info.Hash)
+	}
+	if info.Period <= 0 {
+		return nil, fmt.Errorf("drand endpoint %s returned invalid period %d", base, info.Period)
+	}
+	return &info, nil
+}
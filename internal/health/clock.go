@@ -0,0 +1,37 @@
+package health
+
+import (
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/clock"
+)
+
+// checkClock reports the offset of the system clock from NTP, which the
+// created_at checks depend on
+func (h *HealthChecker) checkClock() *ComponentStatus {
+	status := &ComponentStatus{
+		Name:    "clock",
+		Details: make(map[string]interface{}),
+	}
+
+	offset, checkedAt, ok := clock.Offset()
+	if !ok {
+		status.Status = StatusHealthy
+		status.Message = "Clock not checked against NTP"
+		return status
+	}
+
+	status.Details["offset_ms"] = offset.Milliseconds()
+	status.Details["checked_at"] = checkedAt.UTC().Format(time.RFC3339)
+	status.Details["max_skew_ms"] = h.cfg.Clock.MaxSkew.Milliseconds()
+	status.Details["tolerance_ms"] = clock.Tolerance().Milliseconds()
+
+	if clock.Tolerance() > 0 {
+		status.Status = StatusDegraded
+		status.Message = "System clock is skewed, created_at bounds are widened"
+	} else {
+		status.Status = StatusHealthy
+		status.Message = "System clock is in sync"
+	}
+	return status
+}
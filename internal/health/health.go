@@ -111,6 +111,9 @@ func (h *HealthChecker) CheckHealth(ctx context.Context) *HealthResponse {
 	systemStatus := h.checkSystemResources()
 	components = append(components, systemStatus)
 
+	// Check the system clock against NTP
+	components = append(components, h.checkClock())
+
 	// Determine overall status
 	overallStatus := h.determineOverallStatus(components)
 
@@ -0,0 +1,227 @@
+package identity
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultTenant is the tenant of the main relay, as in storage, whose
+	// identity is the relay's primary one
+	DefaultTenant = ""
+	// DefaultTenantName names DefaultTenant on the command line and in listings
+	DefaultTenantName = "default"
+	// KeyringDirName is the default keyring directory, next to the identity file
+	KeyringDirName = "keyring"
+	// keyringFileExt is the extension of per-tenant key files
+	keyringFileExt = ".key"
+)
+
+// tenantNamePattern restricts tenant names to values that are safe as file names
+var tenantNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// keyringDir overrides the default keyring directory when set
+var keyringDir string
+
+// Keyring manages one identity per tenant (virtual relay), each stored in its
+// own key file. The DefaultTenant always resolves to the relay's primary identity.
+type Keyring struct {
+	dir        string
+	mu         sync.RWMutex
+	identities map[string]*RelayIdentity
+}
+
+var (
+	defaultKeyring     *Keyring
+	defaultKeyringOnce sync.Once
+)
+
+// NewKeyring creates a keyring backed by key files in dir
+func NewKeyring(dir string) *Keyring {
+	return &Keyring{
+		dir:        dir,
+		identities: make(map[string]*RelayIdentity),
+	}
+}
+
+// DefaultKeyring returns the process-wide keyring, stored in the configured
+// keyring directory or a "keyring" directory next to the identity file
+func DefaultKeyring() (*Keyring, error) {
+	dir := keyringDir
+	if dir == "" {
+		path, err := KeyFilePath()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(filepath.Dir(path), KeyringDirName)
+	}
+	defaultKeyringOnce.Do(func() {
+		defaultKeyring = NewKeyring(dir)
+	})
+	return defaultKeyring, nil
+}
+
+// IsDefaultTenant reports whether name stands for the main relay, by its
+// tenant ID or by DefaultTenantName
+func IsDefaultTenant(name string) bool {
+	return name == DefaultTenant || name == DefaultTenantName
+}
+
+// ValidateTenantName checks that name can be used as a keyring entry
+func ValidateTenantName(name string) error {
+	if !tenantNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid tenant name %q: use 1-63 lowercase letters, digits, '-' or '_'", name)
+	}
+	return nil
+}
+
+// Dir returns the directory holding the keyring's key files
+func (k *Keyring) Dir() string {
+	return k.dir
+}
+
+// KeyPath returns the key file location for a tenant
+func (k *Keyring) KeyPath(name string) string {
+	return filepath.Join(k.dir, name+keyringFileExt)
+}
+
+// Get returns the identity of an existing tenant
+func (k *Keyring) Get(name string) (*RelayIdentity, error) {
+	if IsDefaultTenant(name) {
+		return GetOrCreateRelayIdentity()
+	}
+	if err := ValidateTenantName(name); err != nil {
+		return nil, err
+	}
+
+	k.mu.RLock()
+	identity, ok := k.identities[name]
+	k.mu.RUnlock()
+	if ok {
+		return identity, nil
+	}
+
+	identity, err := loadRelayIdentity(k.KeyPath(name))
+	if err != nil {
+		return nil, fmt.Errorf("tenant %q: %w", name, err)
+	}
+
+	k.mu.Lock()
+	k.identities[name] = identity
+	k.mu.Unlock()
+	return identity, nil
+}
+
+// GetOrCreate returns the identity of a tenant, generating a new key if it has none
+func (k *Keyring) GetOrCreate(name string) (*RelayIdentity, error) {
+	if IsDefaultTenant(name) {
+		return GetOrCreateRelayIdentity()
+	}
+	if err := ValidateTenantName(name); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(k.KeyPath(name)); err == nil {
+		return k.Get(name)
+	}
+
+	identity, err := GenerateRelayIdentity()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate identity for tenant %q: %w", name, err)
+	}
+	return k.store(name, identity)
+}
+
+// Import stores an nsec or hex key as the identity of a tenant. An existing
+// different key is only replaced when overwrite is set.
+func (k *Keyring) Import(name, key string, overwrite bool) (*RelayIdentity, error) {
+	if IsDefaultTenant(name) {
+		return ImportRelayIdentity(key, overwrite)
+	}
+	if err := ValidateTenantName(name); err != nil {
+		return nil, err
+	}
+
+	privKeyHex, err := ParsePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := identityFromPrivateKey(privKeyHex)
+	if err != nil {
+		return nil, err
+	}
+	if !overwrite {
+		if existing, err := loadRelayIdentity(k.KeyPath(name)); err == nil && existing.PublicKey != identity.PublicKey {
+			return nil, fmt.Errorf("tenant %q already holds a different key", name)
+		}
+	}
+	return k.store(name, identity)
+}
+
+// store writes a tenant identity to disk and caches it
+func (k *Keyring) store(name string, identity *RelayIdentity) (*RelayIdentity, error) {
+	if err := saveRelayIdentity(identity, k.KeyPath(name)); err != nil {
+		return nil, fmt.Errorf("failed to save identity for tenant %q: %w", name, err)
+	}
+
+	k.mu.Lock()
+	k.identities[name] = identity
+	k.mu.Unlock()
+	return identity, nil
+}
+
+// Names lists the tenants with a key in the keyring, including DefaultTenantName
+func (k *Keyring) Names() ([]string, error) {
+	names := []string{DefaultTenantName}
+
+	entries, err := os.ReadDir(k.dir)
+	if os.IsNotExist(err) {
+		return names, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyring directory: %w", err)
+	}
+
+	var tenants []string
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), keyringFileExt)
+		if entry.IsDir() || name == entry.Name() || ValidateTenantName(name) != nil {
+			continue
+		}
+		tenants = append(tenants, name)
+	}
+	sort.Strings(tenants)
+	return append(names, tenants...), nil
+}
+
+// PublicKey returns the public key a tenant advertises in its NIP-11 document
+func (k *Keyring) PublicKey(name string) (string, error) {
+	if IsDefaultTenant(name) {
+		signer, err := ActiveSigner()
+		if err != nil {
+			return "", err
+		}
+		return signer.PublicKey(), nil
+	}
+	identity, err := k.Get(name)
+	if err != nil {
+		return "", err
+	}
+	return identity.PublicKey, nil
+}
+
+// Signer returns a signer for a tenant. DefaultTenant uses the active signer.
+func (k *Keyring) Signer(name string) (Signer, error) {
+	if IsDefaultTenant(name) {
+		return ActiveSigner()
+	}
+	identity, err := k.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewLocalSigner(identity)
+}
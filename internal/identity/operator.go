@@ -0,0 +1,69 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr/nip05"
+)
+
+// operatorVerifyTimeout bounds fetching the operator's nostr.json
+const operatorVerifyTimeout = 10 * time.Second
+
+// OperatorStatus describes the relay operator and whether their NIP-05 identifier checks out
+type OperatorStatus struct {
+	PubKey    string `json:"pubkey"`
+	NIP05     string `json:"nip05,omitempty"`
+	Verified  bool   `json:"verified"`
+	CheckedAt int64  `json:"checked_at,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+var (
+	operatorStatus   *OperatorStatus
+	operatorStatusMu sync.RWMutex
+)
+
+// VerifyOperator checks that the NIP-05 identifier resolves to the operator pubkey
+// and records the result for NIP-11 and the dashboard
+func VerifyOperator(ctx context.Context, pubkey, identifier string) OperatorStatus {
+	status := OperatorStatus{
+		PubKey:    strings.ToLower(pubkey),
+		NIP05:     identifier,
+		CheckedAt: time.Now().Unix(),
+	}
+
+	if identifier != "" {
+		verifyCtx, cancel := context.WithTimeout(ctx, operatorVerifyTimeout)
+		defer cancel()
+
+		pointer, err := nip05.QueryIdentifier(verifyCtx, identifier)
+		switch {
+		case err != nil:
+			status.Error = fmt.Sprintf("nip05 lookup failed: %v", err)
+		case !strings.EqualFold(pointer.PublicKey, pubkey):
+			status.Error = "nip05 identifier resolves to a different pubkey"
+		default:
+			status.Verified = true
+		}
+	}
+
+	operatorStatusMu.Lock()
+	operatorStatus = &status
+	operatorStatusMu.Unlock()
+	return status
+}
+
+// CurrentOperatorStatus returns the last verification result, or nil if no operator is configured
+func CurrentOperatorStatus() *OperatorStatus {
+	operatorStatusMu.RLock()
+	defer operatorStatusMu.RUnlock()
+	if operatorStatus == nil {
+		return nil
+	}
+	status := *operatorStatus
+	return &status
+}
@@ -2,11 +2,20 @@ package identity
 
 import (
 	"crypto/ed25519"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/config"
+	"github.com/btcsuite/btcd/btcec/v2"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/nbd-wtf/go-nostr/nip49"
 )
 
 const (
@@ -14,53 +23,265 @@ const (
 	RelayIDFileName = "relay_id.key"
 	// RelayIDDir is the directory where relay identity files are stored
 	RelayIDDir = ".shugur"
+	// LegacyKeySuffix names the file next to a migrated key that records the
+	// public key of the ed25519 key it was derived from
+	LegacyKeySuffix = ".ed25519"
+
+	// secp256k1KeyHexLen is the length of a hex encoded secp256k1 private key
+	secp256k1KeyHexLen = 64
+	// ed25519KeyHexLen is the length of a hex encoded legacy ed25519 private key
+	ed25519KeyHexLen = 128
+	// migrationDomain separates the derived secp256k1 key from the legacy ed25519 seed
+	migrationDomain = "shugur-relay-identity-migration-v1"
+	// encryptedKeyPrefix marks a key file encrypted with a passphrase (NIP-49 ncryptsec)
+	encryptedKeyPrefix = "ncryptsec1"
+	// encryptionLogN is the scrypt cost (2^N) used when encrypting key files
+	encryptionLogN = 16
+	// loadedStoreTTL is how long an identity loaded from a key store is reused
+	// before the store is read again
+	loadedStoreTTL = time.Minute
+)
+
+var (
+	// keyFilePath overrides the default identity file location when set
+	keyFilePath string
+	// importKey is used to seed the identity file when it does not exist yet
+	importKey string
+	// passphrase encrypts key files at rest when set
+	passphrase string
+
+	// loaded caches the primary identity, so it isn't read and decrypted on
+	// every use. A file identity is reused while the file is unchanged.
+	loadedMu      sync.Mutex
+	loaded        *RelayIdentity
+	loadedModTime time.Time
+	loadedAt      time.Time
 )
 
+// Configure sets the identity file location, an optional key (nsec or hex)
+// to import when no identity file exists, the tenant keyring directory and the
+// passphrase used to encrypt key files. Empty paths keep the defaults.
+func Configure(cfg config.IdentityConfig) error {
+	keyFilePath = cfg.KeyFile
+	importKey = cfg.ImportKey
+	keyringDir = cfg.KeyringDir
+	forgetLoadedIdentity()
+
+	passphrase = cfg.Passphrase
+	if passphrase == "" && cfg.PassphraseFile != "" {
+		content, err := os.ReadFile(filepath.Clean(cfg.PassphraseFile))
+		if err != nil {
+			return fmt.Errorf("failed to read identity passphrase file: %w", err)
+		}
+		passphrase = strings.TrimRight(string(content), "\r\n")
+		if passphrase == "" {
+			return fmt.Errorf("identity passphrase file %s is empty", cfg.PassphraseFile)
+		}
+	}
+	return nil
+}
+
+// Encrypted reports whether key files are encrypted with a passphrase
+func Encrypted() bool {
+	return passphrase != ""
+}
+
+// KeyFilePath returns the configured identity file path or the default
+// $HOME/.shugur/relay_id.key
+func KeyFilePath() (string, error) {
+	if keyFilePath != "" {
+		return keyFilePath, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, RelayIDDir, RelayIDFileName), nil
+}
+
+// ParsePrivateKey accepts an nsec or 64-character hex private key and returns it as hex
+func ParsePrivateKey(key string) (string, error) {
+	key = strings.TrimSpace(key)
+	if strings.HasPrefix(key, "nsec1") {
+		prefix, value, err := nip19.Decode(key)
+		if err != nil {
+			return "", fmt.Errorf("failed to decode nsec: %w", err)
+		}
+		if prefix != "nsec" {
+			return "", fmt.Errorf("expected nsec, got %s", prefix)
+		}
+		key = value.(string)
+	}
+
+	if len(key) != secp256k1KeyHexLen {
+		return "", fmt.Errorf("private key must be 64 hex characters or an nsec, got %d characters", len(key))
+	}
+	if _, err := hex.DecodeString(key); err != nil {
+		return "", fmt.Errorf("private key is not valid hex: %w", err)
+	}
+	return strings.ToLower(key), nil
+}
+
+// ImportRelayIdentity writes the given nsec or hex key to the identity file.
+// An existing file with a different key is only replaced when overwrite is set.
+func ImportRelayIdentity(key string, overwrite bool) (*RelayIdentity, error) {
+	privKeyHex, err := ParsePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := identityFromPrivateKey(privKeyHex)
+	if err != nil {
+		return nil, err
+	}
+	if store := currentKeyStore(); store != nil {
+		return importStoredIdentity(store, identity, overwrite)
+	}
+
+	path, err := KeyFilePath()
+	if err != nil {
+		return nil, err
+	}
+	if !overwrite {
+		if existing, err := loadRelayIdentity(path); err == nil && existing.PublicKey != identity.PublicKey {
+			return nil, fmt.Errorf("identity file %s already holds a different key", path)
+		}
+	}
+
+	if err := saveRelayIdentity(identity, path); err != nil {
+		return nil, fmt.Errorf("failed to save relay identity: %w", err)
+	}
+	forgetLoadedIdentity()
+	return identity, nil
+}
+
 // RelayIdentity holds the relay's identity information
 type RelayIdentity struct {
-	PublicKey  string `json:"public_key"`
+	PublicKey  string `json:"public_key"`            // secp256k1 x-only public key (Nostr format)
 	PrivateKey string `json:"private_key,omitempty"` // Only stored locally
 	RelayID    string `json:"relay_id"`              // Human-readable relay ID
+
+	// LegacyPublicKey is the ed25519 public key this identity was migrated from, if any
+	LegacyPublicKey string `json:"legacy_public_key,omitempty"`
 }
 
-// GenerateRelayIdentity creates a new relay identity with ed25519 keypair
+// GenerateRelayIdentity creates a new relay identity with a secp256k1 keypair
 func GenerateRelayIdentity() (*RelayIdentity, error) {
-	// Generate ed25519 keypair
-	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	return identityFromPrivateKey(nostr.GeneratePrivateKey())
+}
+
+// identityFromPrivateKey builds a relay identity from a hex encoded secp256k1 private key
+func identityFromPrivateKey(privKeyHex string) (*RelayIdentity, error) {
+	pubKeyHex, err := nostr.GetPublicKey(privKeyHex)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate keypair: %w", err)
+		return nil, fmt.Errorf("failed to derive public key: %w", err)
 	}
 
-	// Convert to nostr format
-	pubKeyHex := hex.EncodeToString(publicKey)
-	privKeyHex := hex.EncodeToString(privateKey)
-
-	// Generate a human-readable relay ID from public key (first 16 chars)
-	relayID := fmt.Sprintf("relay-%s", pubKeyHex[:16])
-
 	return &RelayIdentity{
 		PublicKey:  pubKeyHex,
 		PrivateKey: privKeyHex,
-		RelayID:    relayID,
+		RelayID:    fmt.Sprintf("relay-%s", pubKeyHex[:16]),
 	}, nil
 }
 
-// GetOrCreateRelayIdentity loads existing relay identity or creates a new one
+// Npub returns the public key in NIP-19 npub format
+func (ri *RelayIdentity) Npub() (string, error) {
+	return nip19.EncodePublicKey(ri.PublicKey)
+}
+
+// Nsec returns the private key in NIP-19 nsec format
+func (ri *RelayIdentity) Nsec() (string, error) {
+	if !ri.CanSign() {
+		return "", fmt.Errorf("relay identity has no private key")
+	}
+	return nip19.EncodePrivateKey(ri.PrivateKey)
+}
+
+// CanSign reports whether the identity holds a private key
+func (ri *RelayIdentity) CanSign() bool {
+	return ri.PrivateKey != ""
+}
+
+// SignEvent sets the event pubkey to the relay's key and signs it
+func (ri *RelayIdentity) SignEvent(evt *nostr.Event) error {
+	if !ri.CanSign() {
+		return fmt.Errorf("relay identity has no private key")
+	}
+	evt.PubKey = ri.PublicKey
+	if err := evt.Sign(ri.PrivateKey); err != nil {
+		return fmt.Errorf("failed to sign event: %w", err)
+	}
+	return nil
+}
+
+// GetOrCreateRelayIdentity loads existing relay identity or creates a new one.
+// The identity is cached, so decrypting the key isn't repeated on every call.
 func GetOrCreateRelayIdentity() (*RelayIdentity, error) {
-	homeDir, err := os.UserHomeDir()
+	store := currentKeyStore()
+	var modTime time.Time
+	if store == nil {
+		path, err := KeyFilePath()
+		if err != nil {
+			return nil, err
+		}
+		if info, err := os.Stat(path); err == nil {
+			modTime = info.ModTime()
+		}
+	}
+
+	loadedMu.Lock()
+	defer loadedMu.Unlock()
+	if loaded != nil {
+		fresh := loadedModTime.Equal(modTime)
+		if store != nil {
+			fresh = time.Since(loadedAt) < loadedStoreTTL
+		}
+		if fresh {
+			cached := *loaded
+			return &cached, nil
+		}
+	}
+
+	identity, err := loadOrCreateRelayIdentity(store)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get home directory: %w", err)
+		return nil, err
+	}
+	loaded, loadedAt = identity, time.Now()
+	if store == nil {
+		// Creating or re-encrypting the file changed it
+		if path, err := KeyFilePath(); err == nil {
+			if info, err := os.Stat(path); err == nil {
+				loadedModTime = info.ModTime()
+			}
+		}
+	}
+	cached := *identity
+	return &cached, nil
+}
+
+// forgetLoadedIdentity drops the cached primary identity after it was replaced
+func forgetLoadedIdentity() {
+	loadedMu.Lock()
+	loaded = nil
+	loadedMu.Unlock()
+}
+
+// loadOrCreateRelayIdentity reads the primary identity from store, or from the
+// identity file when store is nil, creating it when missing
+func loadOrCreateRelayIdentity(store KeyStore) (*RelayIdentity, error) {
+	if store != nil {
+		return getOrCreateStoredIdentity(store)
 	}
 
-	relayDir := filepath.Join(homeDir, RelayIDDir)
-	relayIDPath := filepath.Join(relayDir, RelayIDFileName)
+	relayIDPath, err := KeyFilePath()
+	if err != nil {
+		return nil, err
+	}
 
 	// Check if relay ID file exists
 	if _, err := os.Stat(relayIDPath); os.IsNotExist(err) {
-		// Generate new identity
-		identity, err := GenerateRelayIdentity()
+		identity, err := newRelayIdentity()
 		if err != nil {
-			return nil, fmt.Errorf("failed to generate relay identity: %w", err)
+			return nil, err
 		}
 
 		// Save the private key for future use
@@ -75,6 +296,22 @@ func GetOrCreateRelayIdentity() (*RelayIdentity, error) {
 	return loadRelayIdentity(relayIDPath)
 }
 
+// newRelayIdentity uses the configured import key, otherwise generates a new identity
+func newRelayIdentity() (*RelayIdentity, error) {
+	if importKey == "" {
+		identity, err := GenerateRelayIdentity()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate relay identity: %w", err)
+		}
+		return identity, nil
+	}
+	privKeyHex, err := ParsePrivateKey(importKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity import key: %w", err)
+	}
+	return identityFromPrivateKey(privKeyHex)
+}
+
 // saveRelayIdentity saves the relay identity to disk
 func saveRelayIdentity(identity *RelayIdentity, path string) error {
 	// Create directory if it doesn't exist
@@ -83,18 +320,45 @@ func saveRelayIdentity(identity *RelayIdentity, path string) error {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	// For security, we only store the private key as hex
-	// The public key can be derived from it
-	content := fmt.Sprintf("%s\n", identity.PrivateKey)
+	stored, err := encodeStoredKey(identity.PrivateKey)
+	if err != nil {
+		return err
+	}
+	content := fmt.Sprintf("%s\n", stored)
 
-	// Write with restricted permissions
-	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+	// Write with restricted permissions to a temporary file renamed over path, so
+	// a failed write never leaves path without a key
+	if err := writeFileAtomic(path, []byte(content), 0600); err != nil {
 		return fmt.Errorf("failed to write relay ID file: %w", err)
 	}
 
 	return nil
 }
 
+// writeFileAtomic writes data to path+".tmp", flushes it and renames it over
+// path, so path holds either its previous content or data in full
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
+
 // loadRelayIdentity loads the relay identity from disk
 func loadRelayIdentity(path string) (*RelayIdentity, error) {
 	// Validate and clean the path to prevent directory traversal attacks
@@ -113,31 +377,166 @@ func loadRelayIdentity(path string) (*RelayIdentity, error) {
 		return nil, fmt.Errorf("failed to read relay ID file: %w", err)
 	}
 
-	// Parse private key (remove any whitespace/newlines)
-	privKeyHex := string(content)
-	// Remove newline if present
-	if len(privKeyHex) > 128 {
-		privKeyHex = privKeyHex[:128]
+	privKeyHex, encrypted, err := decodeStoredKey(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("relay ID file %s: %w", cleanedPath, err)
+	}
+
+	switch len(privKeyHex) {
+	case secp256k1KeyHexLen:
+		if _, err := hex.DecodeString(privKeyHex); err != nil {
+			return nil, fmt.Errorf("failed to decode private key: %w", err)
+		}
+		identity, err := identityFromPrivateKey(privKeyHex)
+		if err != nil {
+			return nil, err
+		}
+		identity.LegacyPublicKey = loadLegacyPublicKey(cleanedPath + LegacyKeySuffix)
+
+		// Encrypt plaintext key files at rest once a passphrase is configured
+		if !encrypted && passphrase != "" {
+			if err := saveRelayIdentity(identity, cleanedPath); err != nil {
+				return nil, fmt.Errorf("failed to encrypt relay ID file: %w", err)
+			}
+		}
+		return identity, nil
+	case ed25519KeyHexLen:
+		return migrateLegacyIdentity(cleanedPath, privKeyHex)
+	default:
+		return nil, fmt.Errorf("unrecognized relay ID key length: %d", len(privKeyHex))
+	}
+}
+
+// encodeStoredKey returns the at-rest form of a hex private key: the hex itself,
+// or a NIP-49 ncryptsec when a passphrase is configured. The public key can be
+// derived from it, so only the private key is stored.
+func encodeStoredKey(privKeyHex string) (string, error) {
+	if passphrase == "" {
+		return privKeyHex, nil
+	}
+	encrypted, err := nip49.Encrypt(privKeyHex, passphrase, encryptionLogN, nip49.ClientDoesNotTrackThisData)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt relay ID: %w", err)
+	}
+	return encrypted, nil
+}
+
+// decodeStoredKey reverses encodeStoredKey and reports whether the stored key was encrypted
+func decodeStoredKey(content string) (string, bool, error) {
+	// Remove any whitespace/newlines
+	stored := strings.TrimSpace(content)
+	if !strings.HasPrefix(stored, encryptedKeyPrefix) {
+		return stored, false, nil
+	}
+	if passphrase == "" {
+		return "", true, fmt.Errorf("key is encrypted but no identity passphrase is configured")
+	}
+	privKeyHex, err := nip49.Decrypt(stored, passphrase)
+	if err != nil {
+		return "", true, fmt.Errorf("failed to decrypt key (wrong passphrase?): %w", err)
+	}
+	return privKeyHex, true, nil
+}
+
+// loadLegacyPublicKey returns the ed25519 public key recorded next to a
+// migrated key file, or "" if none. Backups that still hold the legacy private
+// key, which the current key derives from, are scrubbed down to its public key.
+func loadLegacyPublicKey(path string) string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	recorded := strings.TrimSpace(string(content))
+	legacyBytes, err := hex.DecodeString(recorded)
+	if err != nil {
+		return ""
+	}
+	switch len(legacyBytes) {
+	case ed25519.PublicKeySize:
+		return recorded
+	case ed25519.PrivateKeySize:
+		legacyPub := hex.EncodeToString(ed25519.PrivateKey(legacyBytes).Public().(ed25519.PublicKey))
+		if err := scrubFile(path); err == nil {
+			_ = os.WriteFile(path, []byte(legacyPub+"\n"), 0600)
+		}
+		return legacyPub
+	default:
+		return ""
+	}
+}
+
+// scrubFile overwrites a file holding key material with zeros and removes it
+func scrubFile(path string) error {
+	if err := zeroFile(path); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// zeroFile overwrites a file's content with zeros in place and flushes it
+func zeroFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	return zeroOpenFile(f)
+}
+
+// zeroOpenFile overwrites the content of f with zeros, flushes and closes it
+func zeroOpenFile(f *os.File) error {
+	info, err := f.Stat()
+	if err == nil {
+		_, err = f.Write(make([]byte, info.Size()))
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
 	}
+	return err
+}
 
-	privKeyBytes, err := hex.DecodeString(privKeyHex)
+// migrateLegacyIdentity converts an ed25519 relay key file into a secp256k1 one.
+// The new key is derived deterministically from the ed25519 seed so replicas
+// sharing the same legacy file end up with the same Nostr identity. Since the
+// legacy key is enough to derive the new one, it is overwritten rather than
+// kept; only its public key is recorded, with LegacyKeySuffix appended.
+func migrateLegacyIdentity(path, legacyKeyHex string) (*RelayIdentity, error) {
+	legacyBytes, err := hex.DecodeString(legacyKeyHex)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode private key: %w", err)
+		return nil, fmt.Errorf("failed to decode legacy private key: %w", err)
 	}
+	legacyKey := ed25519.PrivateKey(legacyBytes)
+	legacyPub := hex.EncodeToString(legacyKey.Public().(ed25519.PublicKey))
 
-	// Derive public key from private key
-	privateKey := ed25519.PrivateKey(privKeyBytes)
-	publicKey := privateKey.Public().(ed25519.PublicKey)
-	pubKeyHex := hex.EncodeToString(publicKey)
+	digest := sha256.Sum256(append([]byte(migrationDomain), legacyKey.Seed()...))
+	privKey, _ := btcec.PrivKeyFromBytes(digest[:])
 
-	// Generate relay ID
-	relayID := fmt.Sprintf("relay-%s", pubKeyHex[:16])
+	identity, err := identityFromPrivateKey(hex.EncodeToString(privKey.Serialize()))
+	if err != nil {
+		return nil, err
+	}
+	identity.LegacyPublicKey = legacyPub
 
-	return &RelayIdentity{
-		PublicKey:  pubKeyHex,
-		PrivateKey: privKeyHex,
-		RelayID:    relayID,
-	}, nil
+	if err := os.WriteFile(path+LegacyKeySuffix, []byte(legacyPub+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("failed to record legacy public key: %w", err)
+	}
+	// The legacy file stays open while the migrated key is renamed over it, so
+	// its content is only scrubbed once the new key is safely in place
+	legacy, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open legacy relay ID file: %w", err)
+	}
+	if err := saveRelayIdentity(identity, path); err != nil {
+		_ = legacy.Close()
+		return nil, fmt.Errorf("failed to save migrated relay identity: %w", err)
+	}
+	if err := zeroOpenFile(legacy); err != nil {
+		return nil, fmt.Errorf("failed to scrub legacy relay ID file: %w", err)
+	}
+
+	return identity, nil
 }
 
 // GetOrCreateRelayIdentityWithConfig loads existing relay identity or creates a new one,
@@ -169,6 +568,14 @@ func GetOrCreateRelayIdentityWithConfig(configuredPublicKey string) (*RelayIdent
 		}, nil
 	}
 
+	// Use the external signer's key when the private key is not kept on disk
+	if signer := externalSigner(); signer != nil {
+		return &RelayIdentity{
+			PublicKey: signer.PublicKey(),
+			RelayID:   fmt.Sprintf("relay-%s", signer.PublicKey()[:16]),
+		}, nil
+	}
+
 	// Fall back to the original behavior if no public key is configured
 	return GetOrCreateRelayIdentity()
 }
@@ -0,0 +1,199 @@
+package identity
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	nostr "github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	// KindKeyRotation is the key migration event kind (draft NIP-41) used for rotation statements
+	KindKeyRotation = 1777
+	// PreviousKeySuffix is appended to the identity file to keep the rotated-out key
+	PreviousKeySuffix = ".previous"
+	// RotationFileSuffix is appended to the identity file for the rotation record
+	RotationFileSuffix = ".rotation.json"
+	// DefaultRotationGracePeriod is how long the previous key is advertised after rotating
+	DefaultRotationGracePeriod = 30 * 24 * time.Hour
+)
+
+// KeyRotation records a relay key rotation. While the grace period lasts both keys
+// are advertised in NIP-11 and the signed statements are published by the relay.
+type KeyRotation struct {
+	PreviousPubKey string        `json:"previous_pubkey"`
+	PubKey         string        `json:"pubkey"`
+	RotatedAt      int64         `json:"rotated_at"`
+	GraceUntil     int64         `json:"grace_until"`
+	Statements     []nostr.Event `json:"statements"`
+}
+
+// Active reports whether the rotation is still within its grace period
+func (kr *KeyRotation) Active() bool {
+	return time.Now().Unix() < kr.GraceUntil
+}
+
+var (
+	keyRotation       *KeyRotation
+	keyRotationLoaded bool
+	keyRotationMu     sync.Mutex
+)
+
+// RotateRelayIdentity replaces the relay key with a newly generated one. The old key is
+// kept next to the identity file for the grace period and both keys sign a rotation
+// statement naming the other, so clients can follow the relay to its new key.
+func RotateRelayIdentity(grace time.Duration) (*KeyRotation, error) {
+	if externalSigner() != nil {
+		return nil, fmt.Errorf("key rotation is only supported for the local signer")
+	}
+	if currentKeyStore() != nil {
+		return nil, fmt.Errorf("key rotation is only supported for the file identity backend")
+	}
+
+	path, err := KeyFilePath()
+	if err != nil {
+		return nil, err
+	}
+	current, err := GetOrCreateRelayIdentity()
+	if err != nil {
+		return nil, err
+	}
+	if existing, err := loadKeyRotation(path); err == nil && existing.Active() {
+		return nil, fmt.Errorf("a key rotation is already in progress until %s",
+			time.Unix(existing.GraceUntil, 0).UTC().Format(time.RFC3339))
+	}
+
+	next, err := GenerateRelayIdentity()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate new relay identity: %w", err)
+	}
+
+	now := time.Now()
+	rotation := &KeyRotation{
+		PreviousPubKey: current.PublicKey,
+		PubKey:         next.PublicKey,
+		RotatedAt:      now.Unix(),
+		GraceUntil:     now.Add(grace).Unix(),
+	}
+
+	// The old key vouches for the new one and the new key acknowledges the old one
+	for _, s := range []struct {
+		signer *RelayIdentity
+		other  string
+		marker string
+	}{
+		{current, next.PublicKey, "successor"},
+		{next, current.PublicKey, "predecessor"},
+	} {
+		statement := nostr.Event{
+			Kind:      KindKeyRotation,
+			CreatedAt: nostr.Timestamp(now.Unix()),
+			Tags: nostr.Tags{
+				{"p", s.other, "", s.marker},
+				{"alt", "Relay identity key rotation"},
+			},
+		}
+		if err := s.signer.SignEvent(&statement); err != nil {
+			return nil, fmt.Errorf("failed to sign rotation statement: %w", err)
+		}
+		rotation.Statements = append(rotation.Statements, statement)
+	}
+
+	if err := saveRelayIdentity(current, path+PreviousKeySuffix); err != nil {
+		return nil, fmt.Errorf("failed to keep previous relay key: %w", err)
+	}
+	if err := saveKeyRotation(rotation, path); err != nil {
+		return nil, err
+	}
+	if err := saveRelayIdentity(next, path); err != nil {
+		return nil, fmt.Errorf("failed to save new relay identity: %w", err)
+	}
+	forgetLoadedIdentity()
+
+	keyRotationMu.Lock()
+	keyRotation, keyRotationLoaded = rotation, true
+	keyRotationMu.Unlock()
+	return rotation, nil
+}
+
+// CurrentKeyRotation returns the rotation in its grace period, or nil if there is none
+func CurrentKeyRotation() *KeyRotation {
+	keyRotationMu.Lock()
+	defer keyRotationMu.Unlock()
+
+	if !keyRotationLoaded {
+		keyRotationLoaded = true
+		if path, err := KeyFilePath(); err == nil {
+			keyRotation, _ = loadKeyRotation(path)
+		}
+	}
+	if keyRotation == nil || !keyRotation.Active() {
+		return nil
+	}
+	return keyRotation
+}
+
+// PreviousRelayIdentity returns the rotated-out key while the grace period lasts
+func PreviousRelayIdentity() (*RelayIdentity, error) {
+	if CurrentKeyRotation() == nil {
+		return nil, fmt.Errorf("no key rotation in progress")
+	}
+	path, err := KeyFilePath()
+	if err != nil {
+		return nil, err
+	}
+	return loadRelayIdentity(path + PreviousKeySuffix)
+}
+
+// PruneKeyRotation removes the previous key and rotation record once the grace
+// period is over. It reports whether anything was removed.
+func PruneKeyRotation() (bool, error) {
+	path, err := KeyFilePath()
+	if err != nil {
+		return false, err
+	}
+	rotation, err := loadKeyRotation(path)
+	if err != nil || rotation.Active() {
+		return false, nil
+	}
+
+	if err := os.Remove(path + PreviousKeySuffix); err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to remove previous relay key: %w", err)
+	}
+	if err := os.Remove(path + RotationFileSuffix); err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to remove rotation record: %w", err)
+	}
+
+	keyRotationMu.Lock()
+	keyRotation, keyRotationLoaded = nil, true
+	keyRotationMu.Unlock()
+	return true, nil
+}
+
+// saveKeyRotation writes the rotation record next to the identity file
+func saveKeyRotation(rotation *KeyRotation, path string) error {
+	data, err := json.MarshalIndent(rotation, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode rotation record: %w", err)
+	}
+	if err := os.WriteFile(path+RotationFileSuffix, data, 0600); err != nil {
+		return fmt.Errorf("failed to write rotation record: %w", err)
+	}
+	return nil
+}
+
+// loadKeyRotation reads the rotation record stored next to the identity file
+func loadKeyRotation(path string) (*KeyRotation, error) {
+	data, err := os.ReadFile(path + RotationFileSuffix)
+	if err != nil {
+		return nil, err
+	}
+	var rotation KeyRotation
+	if err := json.Unmarshal(data, &rotation); err != nil {
+		return nil, fmt.Errorf("failed to decode rotation record: %w", err)
+	}
+	return &rotation, nil
+}
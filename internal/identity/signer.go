@@ -0,0 +1,176 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/config"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip46"
+)
+
+const (
+	// SignerLocal signs with the key stored in the identity file
+	SignerLocal = "local"
+	// SignerBunker signs through a remote NIP-46 bunker
+	SignerBunker = "bunker"
+
+	// bunkerConnectTimeout bounds the initial NIP-46 handshake
+	bunkerConnectTimeout = 30 * time.Second
+)
+
+// Signer abstracts where the relay's private key lives, so the key can be kept
+// in an external signer instead of plaintext on disk
+type Signer interface {
+	// PublicKey returns the hex encoded secp256k1 public key of the relay
+	PublicKey() string
+	// SignEvent sets the event pubkey and signs it
+	SignEvent(ctx context.Context, evt *nostr.Event) error
+	// Kind returns the signer backend name
+	Kind() string
+}
+
+var (
+	activeSigner   Signer
+	activeSignerMu sync.RWMutex
+)
+
+// LocalSigner signs with a relay identity loaded from disk
+type LocalSigner struct {
+	identity *RelayIdentity
+}
+
+// NewLocalSigner wraps a relay identity holding a private key
+func NewLocalSigner(identity *RelayIdentity) (*LocalSigner, error) {
+	if !identity.CanSign() {
+		return nil, fmt.Errorf("relay identity has no private key")
+	}
+	return &LocalSigner{identity: identity}, nil
+}
+
+// PublicKey returns the relay public key
+func (s *LocalSigner) PublicKey() string {
+	return s.identity.PublicKey
+}
+
+// SignEvent signs evt with the local private key
+func (s *LocalSigner) SignEvent(_ context.Context, evt *nostr.Event) error {
+	return s.identity.SignEvent(evt)
+}
+
+// Kind returns SignerLocal
+func (s *LocalSigner) Kind() string {
+	return SignerLocal
+}
+
+// BunkerSigner signs through a NIP-46 remote signer
+type BunkerSigner struct {
+	client *nip46.BunkerClient
+	pubkey string
+}
+
+// NewBunkerSigner connects to a NIP-46 bunker using a bunker:// URL or NIP-05 address.
+// clientKey is the hex key this relay uses to talk to the bunker; a random one is
+// generated when empty, which may require approving the connection again after restarts.
+func NewBunkerSigner(ctx context.Context, bunkerURL, clientKey string) (*BunkerSigner, error) {
+	if clientKey == "" {
+		clientKey = nostr.GeneratePrivateKey()
+	} else {
+		parsed, err := ParsePrivateKey(clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bunker client key: %w", err)
+		}
+		clientKey = parsed
+	}
+
+	connectCtx, cancel := context.WithTimeout(ctx, bunkerConnectTimeout)
+	defer cancel()
+
+	client, err := nip46.ConnectBunker(connectCtx, clientKey, bunkerURL, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to bunker: %w", err)
+	}
+	pubkey, err := client.GetPublicKey(connectCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get public key from bunker: %w", err)
+	}
+
+	return &BunkerSigner{client: client, pubkey: pubkey}, nil
+}
+
+// PublicKey returns the relay public key held by the bunker
+func (s *BunkerSigner) PublicKey() string {
+	return s.pubkey
+}
+
+// SignEvent asks the bunker to sign evt
+func (s *BunkerSigner) SignEvent(ctx context.Context, evt *nostr.Event) error {
+	evt.PubKey = s.pubkey
+	if err := s.client.SignEvent(ctx, evt); err != nil {
+		return fmt.Errorf("bunker signing failed: %w", err)
+	}
+	return nil
+}
+
+// Kind returns SignerBunker
+func (s *BunkerSigner) Kind() string {
+	return SignerBunker
+}
+
+// InitSigner creates the signer selected in config and makes it the active one
+func InitSigner(ctx context.Context, cfg config.IdentityConfig) (Signer, error) {
+	var (
+		signer Signer
+		err    error
+	)
+
+	switch cfg.Signer {
+	case SignerBunker:
+		signer, err = NewBunkerSigner(ctx, cfg.BunkerURL, cfg.BunkerClientKey)
+	case SignerLocal, "":
+		var relayIdentity *RelayIdentity
+		relayIdentity, err = GetOrCreateRelayIdentity()
+		if err == nil {
+			signer, err = NewLocalSigner(relayIdentity)
+		}
+	default:
+		err = fmt.Errorf("unknown signer %q", cfg.Signer)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	activeSignerMu.Lock()
+	activeSigner = signer
+	activeSignerMu.Unlock()
+	return signer, nil
+}
+
+// ActiveSigner returns the signer set up by InitSigner, falling back to the
+// local identity file when none was initialized
+func ActiveSigner() (Signer, error) {
+	activeSignerMu.RLock()
+	signer := activeSigner
+	activeSignerMu.RUnlock()
+	if signer != nil {
+		return signer, nil
+	}
+
+	relayIdentity, err := GetOrCreateRelayIdentity()
+	if err != nil {
+		return nil, err
+	}
+	return NewLocalSigner(relayIdentity)
+}
+
+// externalSigner returns the active signer if it does not use the local key file
+func externalSigner() Signer {
+	activeSignerMu.RLock()
+	defer activeSignerMu.RUnlock()
+	if activeSigner != nil && activeSigner.Kind() != SignerLocal {
+		return activeSigner
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// BackendFile keeps the relay key in the identity file
+	BackendFile = "file"
+	// BackendDatabase keeps the relay key in the relay database
+	BackendDatabase = "database"
+
+	// primaryKeyName is the key store entry holding the relay's primary identity
+	primaryKeyName = DefaultTenantName
+	// keyStoreTimeout bounds a single key store operation
+	keyStoreTimeout = 10 * time.Second
+)
+
+// ErrKeyNotFound is returned by a KeyStore when no key is stored under a name
+var ErrKeyNotFound = errors.New("relay key not found")
+
+// errStorePassphrase refuses keeping the relay key in a key store unencrypted
+var errStorePassphrase = errors.New("the database identity backend requires IDENTITY.PASSPHRASE or PASSPHRASE_FILE")
+
+// KeyStore persists relay keys NIP-49 encrypted with the identity passphrase
+// outside the filesystem, e.g. in the relay database
+type KeyStore interface {
+	// LoadKey returns the stored key or ErrKeyNotFound
+	LoadKey(ctx context.Context, name string) (string, error)
+	// SaveKey stores a key. Without overwrite an existing key is kept unchanged.
+	SaveKey(ctx context.Context, name, stored string, overwrite bool) error
+}
+
+var (
+	keyStore   KeyStore
+	keyStoreMu sync.RWMutex
+)
+
+// UseKeyStore keeps the relay's primary identity in store instead of the identity file
+func UseKeyStore(store KeyStore) {
+	keyStoreMu.Lock()
+	keyStore = store
+	keyStoreMu.Unlock()
+	forgetLoadedIdentity()
+}
+
+// currentKeyStore returns the configured key store, or nil for the identity file
+func currentKeyStore() KeyStore {
+	keyStoreMu.RLock()
+	defer keyStoreMu.RUnlock()
+	return keyStore
+}
+
+// getOrCreateStoredIdentity loads the primary identity from the key store, creating it
+// when missing. Concurrent first starts converge on whichever key was stored first.
+func getOrCreateStoredIdentity(store KeyStore) (*RelayIdentity, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), keyStoreTimeout)
+	defer cancel()
+
+	if passphrase == "" {
+		return nil, errStorePassphrase
+	}
+
+	stored, err := store.LoadKey(ctx, primaryKeyName)
+	if errors.Is(err, ErrKeyNotFound) {
+		identity, err := seedStoredIdentity()
+		if err != nil {
+			return nil, err
+		}
+		encoded, err := encodeStoredKey(identity.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		if err := store.SaveKey(ctx, primaryKeyName, encoded, false); err != nil {
+			return nil, fmt.Errorf("failed to save relay identity: %w", err)
+		}
+		stored, err = store.LoadKey(ctx, primaryKeyName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reload relay identity: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load relay identity: %w", err)
+	}
+
+	privKeyHex, encrypted, err := decodeStoredKey(stored)
+	if err != nil {
+		return nil, fmt.Errorf("stored relay identity: %w", err)
+	}
+	if len(privKeyHex) != secp256k1KeyHexLen {
+		return nil, fmt.Errorf("unrecognized stored relay key length: %d", len(privKeyHex))
+	}
+	identity, err := identityFromPrivateKey(privKeyHex)
+	if err != nil {
+		return nil, err
+	}
+
+	// Encrypt plaintext keys at rest once a passphrase is configured
+	if !encrypted && passphrase != "" {
+		if err := saveStoredIdentity(ctx, store, identity); err != nil {
+			return nil, fmt.Errorf("failed to encrypt stored relay identity: %w", err)
+		}
+	}
+	return identity, nil
+}
+
+// seedStoredIdentity returns the identity a key store starts with: the import
+// key, else the key of the identity file so moving to the database keeps the
+// relay's identity, else a new one
+func seedStoredIdentity() (*RelayIdentity, error) {
+	if importKey == "" {
+		path, err := KeyFilePath()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(path); err == nil {
+			identity, err := loadRelayIdentity(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to import relay identity file: %w", err)
+			}
+			return identity, nil
+		}
+	}
+	return newRelayIdentity()
+}
+
+// importStoredIdentity writes identity to the key store as the primary identity
+func importStoredIdentity(store KeyStore, identity *RelayIdentity, overwrite bool) (*RelayIdentity, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), keyStoreTimeout)
+	defer cancel()
+
+	if !overwrite {
+		if stored, err := store.LoadKey(ctx, primaryKeyName); err == nil {
+			if privKeyHex, _, err := decodeStoredKey(stored); err != nil || privKeyHex != identity.PrivateKey {
+				return nil, fmt.Errorf("the database already holds a different relay key")
+			}
+		}
+	}
+	if err := saveStoredIdentity(ctx, store, identity); err != nil {
+		return nil, fmt.Errorf("failed to save relay identity: %w", err)
+	}
+	forgetLoadedIdentity()
+	return identity, nil
+}
+
+// saveStoredIdentity replaces the primary identity in the key store
+func saveStoredIdentity(ctx context.Context, store KeyStore, identity *RelayIdentity) error {
+	if passphrase == "" {
+		return errStorePassphrase
+	}
+	encoded, err := encodeStoredKey(identity.PrivateKey)
+	if err != nil {
+		return err
+	}
+	return store.SaveKey(ctx, primaryKeyName, encoded, true)
+}
@@ -0,0 +1,71 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/config"
+)
+
+// Challenge decides when unverified clients must prove work before publishing
+// and remembers the sessions that did. Sessions are kept in memory, so each
+// node knows only the clients it challenged.
+type Challenge struct {
+	cfg config.ChallengeConfig
+
+	mu sync.Mutex
+	// known holds when each session that passed a challenge stops being known
+	known   map[string]time.Time
+	sweptAt time.Time
+}
+
+// NewChallenge creates a challenge with the THROTTLING.CHALLENGE settings
+func NewChallenge(cfg config.ChallengeConfig) *Challenge {
+	return &Challenge{cfg: cfg, known: make(map[string]time.Time), sweptAt: time.Now()}
+}
+
+// Difficulty returns the NIP-13 proof of work, in leading zero bits, an event
+// must carry to pass the challenge
+func (c *Challenge) Difficulty() int {
+	return c.cfg.Difficulty
+}
+
+// Active reports whether the load calls for challenges: either rate at or past
+// its threshold, or always when no threshold is set
+func (c *Challenge) Active(eventsPerSecond, connectionsPerSecond float64) bool {
+	if c.cfg.EventsPerSecond == 0 && c.cfg.ConnectionsPerSecond == 0 {
+		return true
+	}
+	return (c.cfg.EventsPerSecond > 0 && eventsPerSecond >= c.cfg.EventsPerSecond) ||
+		(c.cfg.ConnectionsPerSecond > 0 && connectionsPerSecond >= c.cfg.ConnectionsPerSecond)
+}
+
+// Known reports whether session passed a challenge within KNOWN_FOR
+func (c *Challenge) Known(session string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	until, ok := c.known[session]
+	return ok && time.Now().Before(until)
+}
+
+// Remember records that session passed a challenge
+func (c *Challenge) Remember(session string) {
+	if c.cfg.KnownFor <= 0 {
+		return
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.known[session] = now.Add(c.cfg.KnownFor)
+
+	// Drop the expired sessions once per KNOWN_FOR
+	if now.Sub(c.sweptAt) < c.cfg.KnownFor {
+		return
+	}
+	c.sweptAt = now
+	for key, until := range c.known {
+		if now.After(until) {
+			delete(c.known, key)
+		}
+	}
+}
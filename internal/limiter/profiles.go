@@ -0,0 +1,66 @@
+package limiter
+
+import (
+	"github.com/Shugur-Network/relay/internal/config"
+)
+
+// ClientClass identifies which rate limit profile applies to a connection
+type ClientClass string
+
+const (
+	// ClassAnonymous is used for connections that have not authenticated
+	ClassAnonymous ClientClass = "anonymous"
+	// ClassAuthenticated is used after a successful NIP-42 AUTH
+	ClassAuthenticated ClientClass = "authenticated"
+	// ClassWhitelisted is used when the authenticated pubkey is whitelisted
+	ClassWhitelisted ClientClass = "whitelisted"
+	// ClassPaid is used when the authenticated pubkey has paid for access
+	ClassPaid ClientClass = "paid"
+	// ClassOnion is used for unauthenticated connections through the onion service
+	ClassOnion ClientClass = "onion"
+)
+
+// ResolveProfile returns the effective limits for a client class, filling
+// unset values from the global rate limit settings
+func ResolveProfile(cfg config.ThrottlingConfig, class ClientClass) config.RateLimitProfile {
+	var profile config.RateLimitProfile
+	switch class {
+	case ClassAuthenticated:
+		profile = cfg.Profiles.Authenticated
+	case ClassWhitelisted:
+		profile = cfg.Profiles.Whitelisted
+	case ClassPaid:
+		profile = cfg.Profiles.Paid
+	case ClassOnion:
+		profile = cfg.Profiles.Onion
+	default:
+		profile = cfg.Profiles.Anonymous
+	}
+
+	if profile.MaxEventsPerSecond == 0 {
+		profile.MaxEventsPerSecond = cfg.RateLimit.MaxEventsPerSecond
+	}
+	if profile.MaxRequestsPerSecond == 0 {
+		profile.MaxRequestsPerSecond = cfg.RateLimit.MaxRequestsPerSecond
+	}
+	if profile.BurstSize == 0 {
+		profile.BurstSize = cfg.RateLimit.BurstSize
+	}
+	return profile
+}
+
+// ResolveTierProfile returns the effective limits for a paid pubkey in a
+// membership tier: the tier's limits over the PAID profile
+func ResolveTierProfile(cfg config.ThrottlingConfig, tier config.RateLimitProfile) config.RateLimitProfile {
+	profile := ResolveProfile(cfg, ClassPaid)
+	if tier.MaxEventsPerSecond != 0 {
+		profile.MaxEventsPerSecond = tier.MaxEventsPerSecond
+	}
+	if tier.MaxRequestsPerSecond != 0 {
+		profile.MaxRequestsPerSecond = tier.MaxRequestsPerSecond
+	}
+	if tier.BurstSize != 0 {
+		profile.BurstSize = tier.BurstSize
+	}
+	return profile
+}
@@ -0,0 +1,75 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// maxQuotaKeys bounds the keys a DailyQuota tracks in a day
+const maxQuotaKeys = 100000
+
+// DailyQuota counts actions per key within the current UTC day. Counts are kept
+// in memory, so each node enforces the quota on its own, and expire at midnight
+// UTC.
+type DailyQuota struct {
+	limit int
+	day   int64
+	used  map[string]int
+	mutex sync.Mutex
+}
+
+// NewDailyQuota creates a quota allowing limit actions per key and day
+func NewDailyQuota(limit int) *DailyQuota {
+	return &DailyQuota{limit: limit, used: make(map[string]int)}
+}
+
+// Limit returns the actions allowed per key and day
+func (q *DailyQuota) Limit() int {
+	return q.limit
+}
+
+// Allowed reports whether every one of keys has an action left today. Once
+// maxQuotaKeys keys are tracked, keys not seen yet today have none.
+func (q *DailyQuota) Allowed(keys ...string) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.rollover()
+	for _, key := range keys {
+		used, seen := q.used[key]
+		if used >= q.limit || (!seen && len(q.used) >= maxQuotaKeys) {
+			return false
+		}
+	}
+	return true
+}
+
+// Charge consumes one action for each of keys
+func (q *DailyQuota) Charge(keys ...string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.rollover()
+	for _, key := range keys {
+		if _, seen := q.used[key]; seen || len(q.used) < maxQuotaKeys {
+			q.used[key]++
+		}
+	}
+}
+
+// Used returns the actions key consumed today
+func (q *DailyQuota) Used(key string) int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.rollover()
+	return q.used[key]
+}
+
+// rollover drops the counts of past days; counts reset at midnight UTC
+func (q *DailyQuota) rollover() {
+	if day := time.Now().Unix() / 86400; day != q.day {
+		q.day = day
+		q.used = make(map[string]int)
+	}
+}
@@ -216,6 +216,12 @@ func New(component string) *zap.Logger {
 |  6. Convenience wrappers                                            |
 * -------------------------------------------------------------------*/
 
+// DebugEnabled reports whether debug entries are logged, so hot paths can skip
+// building their fields
+func DebugEnabled() bool {
+	return active && root.Core().Enabled(zap.DebugLevel)
+}
+
 func Debug(msg string, fields ...zap.Field) {
 	if active {
 		root.Debug(msg, fields...)
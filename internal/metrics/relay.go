@@ -268,6 +268,25 @@ var (
 		Buckets: prometheus.ExponentialBuckets(0.001, 10, 5), // 0.001, 0.01, 0.1, 1, 10
 	}, []string{"type"})
 
+	// Subscription metrics
+	SubscriptionEOSEDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "nostr_relay_subscription_eose_seconds",
+		Help:    "Time from accepting a REQ to sending its EOSE, by the read path that answered it",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 8), // 0.001, 0.004, 0.016, ..., 16.384
+	}, []string{"source"})
+
+	SubscriptionEventsReturned = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "nostr_relay_subscription_events_returned",
+		Help:    "Stored events sent for a REQ before its EOSE",
+		Buckets: []float64{0, 1, 5, 10, 50, 100, 250, 500},
+	})
+
+	LiveDeliveryLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "nostr_relay_live_delivery_seconds",
+		Help:    "Time from this node accepting an event to writing it to a subscribed client",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 8), // 0.001, 0.004, 0.016, ..., 16.384
+	})
+
 	// Event metrics
 	EventsProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "nostr_relay_events_processed_total",
@@ -284,6 +303,53 @@ var (
 		Help: "The total number of duplicate events received",
 	})
 
+	EventResults = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nostr_relay_event_results_total",
+		Help: "The total number of events answered by status and reason code",
+	}, []string{"status", "code"}) // status "accepted", "duplicate", "rejected", "error"
+
+	// Time capsule metrics
+	CapsulesStored = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nostr_relay_capsules_stored_total",
+		Help: "The total number of time capsules stored",
+	})
+
+	CapsulesUnlocked = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nostr_relay_capsules_unlocked_total",
+		Help: "The total number of stored time capsules flagged unlocked by the scheduler",
+	})
+
+	CapsulesRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nostr_relay_capsules_rejected_total",
+		Help: "The total number of time capsules rejected by reason",
+	}, []string{"reason"}) // "invalid", "chain", "beacon", "quota_count", "quota_bytes"
+
+	CapsuleSharesReceived = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nostr_relay_capsule_shares_received_total",
+		Help: "The total number of witness unlock shares recorded for time capsules",
+	})
+
+	CapsuleThresholdsMet = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nostr_relay_capsule_share_thresholds_met_total",
+		Help: "The total number of time capsules whose witness share threshold was reached",
+	})
+
+	// Ephemeral event metrics
+	EphemeralEventsRouted = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nostr_relay_ephemeral_events_routed_total",
+		Help: "The total number of ephemeral events fanned out without being stored",
+	})
+
+	EphemeralEventsDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nostr_relay_ephemeral_events_dropped_total",
+		Help: "The total number of ephemeral events dropped because the broadcast buffer was full",
+	})
+
+	EphemeralDeliveries = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nostr_relay_ephemeral_deliveries_total",
+		Help: "The total number of ephemeral events handed to client connections",
+	})
+
 	// HTTP metrics
 	HTTPRequests = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "nostr_relay_http_requests_total",
@@ -296,6 +362,27 @@ var (
 		Buckets: prometheus.ExponentialBuckets(0.01, 10, 5), // 0.01, 0.1, 1, 10, 100
 	})
 
+	HTTPRequestsLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nostr_relay_http_requests_limited_total",
+		Help: "The total number of HTTP requests rejected with 429 by endpoint group and reason",
+	}, []string{"group", "reason"}) // "rate", "concurrency", "ip_concurrency"
+
+	HTTPRequestsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "nostr_relay_http_requests_in_flight",
+		Help: "The number of rate limited HTTP requests currently being served",
+	})
+
+	// Blossom metrics
+	BlossomUploads = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nostr_relay_blossom_uploads_total",
+		Help: "The total number of blobs uploaded through the Blossom endpoints",
+	})
+
+	BlossomUploadBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nostr_relay_blossom_upload_bytes_total",
+		Help: "The total size in bytes of blobs uploaded through the Blossom endpoints",
+	})
+
 	// Error metrics
 	ErrorsCount = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "nostr_relay_errors_total",
@@ -317,6 +404,207 @@ var (
 		Name: "nostr_relay_db_operations_total",
 		Help: "Total number of database operations by type",
 	}, []string{"operation"})
+
+	DBQueriesInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "nostr_relay_db_queries_in_flight",
+		Help: "The weight of REQ and COUNT queries currently running against the database",
+	})
+
+	DBQueriesRejected = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nostr_relay_db_queries_rejected_total",
+		Help: "The total number of REQ and COUNT queries rejected because too many were running",
+	})
+
+	DBCircuitOpen = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "nostr_relay_db_circuit_open",
+		Help: "Whether the database circuit breaker is open, failing storage operations at once",
+	})
+
+	DBCircuitTrips = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nostr_relay_db_circuit_trips_total",
+		Help: "The total number of times the database circuit breaker opened",
+	})
+
+	DBCircuitRejected = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nostr_relay_db_circuit_rejected_total",
+		Help: "The total number of storage operations failed at once while the database circuit breaker was open",
+	})
+
+	RecentCacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nostr_relay_recent_cache_hits_total",
+		Help: "The total number of REQ queries answered from the recent events cache",
+	})
+
+	RecentCacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nostr_relay_recent_cache_misses_total",
+		Help: "The total number of REQ queries for cached kinds that had to go to the database",
+	})
+
+	LiveRingHits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nostr_relay_live_ring_hits_total",
+		Help: "The total number of REQ queries answered from recently ingested events without the database",
+	})
+
+	EventQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "nostr_relay_event_queue_depth",
+		Help: "The number of events waiting to be stored",
+	})
+
+	EventQueueCapacity = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "nostr_relay_event_queue_capacity",
+		Help: "The number of waiting events currently admitted before new ones are dropped",
+	})
+
+	EventQueueDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nostr_relay_event_queue_dropped_total",
+		Help: "The total number of events dropped because the storage queue was full",
+	})
+
+	EventQueueSaturations = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nostr_relay_event_queue_saturations_total",
+		Help: "The total number of times the storage queue filled up and started dropping events",
+	})
+
+	EventWorkers = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "nostr_relay_event_workers",
+		Help: "The number of workers storing queued events",
+	})
+
+	EventWriteLatency = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "nostr_relay_event_write_latency_seconds",
+		Help: "The moving average of the time to store an event",
+	})
+
+	ClockOffset = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "nostr_relay_clock_offset_seconds",
+		Help: "The offset of the system clock from NTP, positive when it is behind",
+	})
+
+	BlockedURLEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nostr_relay_blocked_url_events_total",
+		Help: "The total number of events linking to a blocked domain by action taken",
+	}, []string{"action"}) // "rejected", "flagged"
+
+	BlockedDomains = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "nostr_relay_blocked_domains",
+		Help: "The number of blocked domains, configured and synced from feeds",
+	})
+
+	BlocklistFeedEntries = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "nostr_relay_blocklist_feed_entries",
+		Help: "The number of pubkeys and event IDs blocked by blocklist feeds",
+	})
+
+	BlocklistFeedSyncs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nostr_relay_blocklist_feed_syncs_total",
+		Help: "The total number of blocklist feed syncs by feed and result",
+	}, []string{"feed", "result"}) // result: "success", "failure"
+
+	Challenges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nostr_relay_challenges_total",
+		Help: "The total number of events from unverified clients by challenge outcome",
+	}, []string{"result"}) // "required", "passed"
+
+	ClientSessions = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "nostr_relay_client_sessions",
+		Help: "The number of client sessions tracked on this node",
+	})
+
+	ResumeSessions = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "nostr_relay_resume_sessions",
+		Help: "The number of disconnected clients whose subscriptions are kept for them to resume",
+	})
+
+	Resumes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nostr_relay_resumes_total",
+		Help: "The total number of attempts to resume subscriptions by result",
+	}, []string{"result"}) // "resumed", "expired", "overflowed", "refused"
+
+	ResumeDetachRefused = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nostr_relay_resume_detach_refused_total",
+		Help: "The total number of disconnected clients whose subscriptions weren't kept, as too many were kept already",
+	})
+
+	ResumeReplayedEvents = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nostr_relay_resume_replayed_events_total",
+		Help: "The total number of missed events sent to clients resuming their subscriptions",
+	})
+
+	IPAccessDenied = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nostr_relay_ip_access_denied_total",
+		Help: "The total number of WebSocket connections refused by the IP allow and deny lists",
+	}, []string{"reason"}) // "denied", "not_allowed"
+
+	BloomFilterCapacity = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "nostr_relay_bloom_filter_capacity",
+		Help: "The number of event IDs the duplicate filter is sized for",
+	})
+
+	BloomFilterEntries = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "nostr_relay_bloom_filter_entries",
+		Help: "The approximate number of event IDs in the duplicate filter",
+	})
+
+	BloomFilterFillRatio = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "nostr_relay_bloom_filter_fill_ratio",
+		Help: "The estimated share of the duplicate filter's bits that are set",
+	})
+
+	BloomFilterFalsePositiveRate = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "nostr_relay_bloom_filter_false_positive_rate",
+		Help: "The estimated chance that the duplicate filter drops a new event as stored",
+	})
+
+	BloomFilterUnconfirmed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nostr_relay_bloom_filter_unconfirmed_total",
+		Help: "The total number of events the duplicate filter took for stored that were left to the database to decide",
+	})
+
+	SelfTestFailures = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "nostr_relay_selftest_failures",
+		Help: "The number of checks that failed in the startup self-test",
+	})
+
+	BloomFilterResizes = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nostr_relay_bloom_filter_resizes_total",
+		Help: "The total number of times the duplicate filter was rebuilt larger",
+	})
+
+	CorruptedEvents = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nostr_relay_corrupted_events_total",
+		Help: "The total number of stored events found with a wrong ID or signature by integrity checks",
+	})
+
+	RebroadcastEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nostr_relay_rebroadcast_events_total",
+		Help: "The total number of stored events republished to other relays by result",
+	}, []string{"result"}) // "accepted", "duplicate", "rejected", "failed"
+
+	SinkEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nostr_relay_sink_events_total",
+		Help: "The total number of stored events handed to the external event sink by result",
+	}, []string{"result"}) // "forwarded", "dropped", "failed"
+
+	// Virtual relay (tenant) usage metrics
+	TenantEventsStored = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nostr_relay_tenant_events_stored_total",
+		Help: "The total number of new events stored by virtual relay",
+	}, []string{"tenant"})
+
+	TenantBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nostr_relay_tenant_bytes_total",
+		Help: "The total WebSocket message bytes by virtual relay and direction",
+	}, []string{"tenant", "direction"}) // "in", "out"
+
+	TenantConnectionSeconds = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nostr_relay_tenant_connection_seconds_total",
+		Help: "The total time clients were connected, by virtual relay",
+	}, []string{"tenant"})
+
+	TenantConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nostr_relay_tenant_connections",
+		Help: "The number of clients connected, by virtual relay",
+	}, []string{"tenant"})
 )
 
 // RegisterMetrics ensures all metrics are registered with Prometheus
@@ -343,6 +631,49 @@ func RegisterMetrics() {
 		ErrorsCount.WithLabelValues(errType)
 	}
 
+	// Pre-register capsule rejection reasons
+	capsuleRejections := []string{"invalid", "chain", "beacon", "quota_count", "quota_bytes"}
+	for _, reason := range capsuleRejections {
+		CapsulesRejected.WithLabelValues(reason)
+	}
+
+	// Pre-register challenge outcomes
+	for _, result := range []string{"required", "passed"} {
+		Challenges.WithLabelValues(result)
+	}
+
+	// Pre-register the read paths answering REQs
+	for _, source := range []string{"live", "cache", "database"} {
+		SubscriptionEOSEDuration.WithLabelValues(source)
+	}
+
+	// Pre-register resume results
+	for _, result := range []string{"resumed", "expired", "overflowed", "refused"} {
+		Resumes.WithLabelValues(result)
+	}
+
+	// Pre-register IP access refusal reasons
+	for _, reason := range []string{"denied", "not_allowed"} {
+		IPAccessDenied.WithLabelValues(reason)
+	}
+
+	// Pre-register rebroadcast results
+	for _, result := range []string{"accepted", "duplicate", "rejected", "failed"} {
+		RebroadcastEvents.WithLabelValues(result)
+	}
+
+	// Pre-register event sink results
+	for _, result := range []string{"forwarded", "dropped", "failed"} {
+		SinkEvents.WithLabelValues(result)
+	}
+
+	// Pre-register HTTP limit groups and reasons
+	for _, group := range []string{"api", "nip11", "admin", "blossom"} {
+		for _, reason := range []string{"rate", "concurrency", "ip_concurrency"} {
+			HTTPRequestsLimited.WithLabelValues(group, reason)
+		}
+	}
+
 	// Pre-register DB connection statuses
 	dbStatuses := []string{"success", "failure", "closed"}
 	for _, status := range dbStatuses {
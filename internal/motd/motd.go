@@ -0,0 +1,149 @@
+// Package motd decides which messages of the day a client is due, remembering
+// what each client was sent so a message reaches it once, or once every repeat,
+// however often it reconnects.
+package motd
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"io"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/config"
+)
+
+// message is a configured message of the day
+type message struct {
+	text   *template.Template
+	from   time.Time
+	until  time.Time
+	repeat time.Duration
+}
+
+// active reports whether the message is sent at now
+func (m *message) active(now time.Time) bool {
+	return (m.from.IsZero() || !now.Before(m.from)) && (m.until.IsZero() || now.Before(m.until))
+}
+
+// templateData is what message texts are rendered with
+type templateData struct {
+	Name    string
+	Contact string
+	From    string
+	Until   string
+}
+
+// client is what was sent to one client
+type client struct {
+	key string
+	// sent holds when each message was last sent, by index
+	sent map[int]time.Time
+}
+
+// Board holds the messages of the day and what each client was sent
+type Board struct {
+	messages []message
+	name     string
+	contact  string
+
+	mu      sync.Mutex
+	clients map[string]*list.Element
+	// recent orders clients from the most to the least recently seen, for the
+	// least recently seen to be forgotten past maxClients
+	recent     *list.List
+	maxClients int
+}
+
+// NewBoard returns a board of the messages in cfg, rendered with the relay's
+// name and contact
+func NewBoard(cfg config.MOTDConfig, name, contact string) (*Board, error) {
+	b := &Board{
+		name:       name,
+		contact:    contact,
+		clients:    make(map[string]*list.Element),
+		recent:     list.New(),
+		maxClients: cfg.MaxClients,
+	}
+	for i, m := range cfg.Messages {
+		text, err := m.Template()
+		if err != nil {
+			return nil, fmt.Errorf("message %d: %w", i, err)
+		}
+		if err := text.Execute(io.Discard, templateData{}); err != nil {
+			return nil, fmt.Errorf("message %d: %w", i, err)
+		}
+		from, until := m.Window()
+		b.messages = append(b.messages, message{text: text, from: from, until: until, repeat: m.Repeat})
+	}
+	return b, nil
+}
+
+// Due returns the rendered messages clientKey is due at now and records them as
+// sent. A nil board has none.
+func (b *Board) Due(clientKey string, now time.Time) []string {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	c := b.client(clientKey)
+
+	var due []*message
+	for i := range b.messages {
+		m := &b.messages[i]
+		if !m.active(now) {
+			continue
+		}
+		if last, ok := c.sent[i]; ok && (m.repeat <= 0 || now.Sub(last) < m.repeat) {
+			continue
+		}
+		c.sent[i] = now
+		due = append(due, m)
+	}
+	b.mu.Unlock()
+
+	texts := make([]string, 0, len(due))
+	for _, m := range due {
+		if text := b.render(m); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return texts
+}
+
+// render returns the text of m, empty when it fails to render
+func (b *Board) render(m *message) string {
+	data := templateData{Name: b.name, Contact: b.contact}
+	if !m.from.IsZero() {
+		data.From = m.from.UTC().Format(time.RFC3339)
+	}
+	if !m.until.IsZero() {
+		data.Until = m.until.UTC().Format(time.RFC3339)
+	}
+	var buf bytes.Buffer
+	if err := m.text.Execute(&buf, data); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+// client returns what was sent to clientKey, marking it the most recently seen
+// and forgetting the least recently seen client when there are too many; b.mu
+// must be held
+func (b *Board) client(clientKey string) *client {
+	if elem, ok := b.clients[clientKey]; ok {
+		b.recent.MoveToFront(elem)
+		return elem.Value.(*client)
+	}
+	if b.recent.Len() >= b.maxClients {
+		if oldest := b.recent.Back(); oldest != nil {
+			b.recent.Remove(oldest)
+			delete(b.clients, oldest.Value.(*client).key)
+		}
+	}
+	c := &client{key: clientKey, sent: make(map[int]time.Time)}
+	b.clients[clientKey] = b.recent.PushFront(c)
+	return c
+}
@@ -0,0 +1,35 @@
+package motd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/config"
+)
+
+func TestBoardForgetsLeastRecentlySeen(t *testing.T) {
+	b, err := NewBoard(config.MOTDConfig{
+		MaxClients: 2,
+		Messages:   []config.MOTDMessage{{Text: "Welcome to {{.Name}}"}},
+	}, "relay", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	if got := b.Due("a", now); len(got) != 1 || got[0] != "Welcome to relay" {
+		t.Fatalf("Due(a) = %q", got)
+	}
+	b.Due("b", now)
+	if got := b.Due("a", now); len(got) != 0 {
+		t.Errorf("Due(a) again = %q, want nothing", got)
+	}
+	// a was seen more recently than b, so b is forgotten for c
+	b.Due("c", now)
+	if got := b.Due("a", now); len(got) != 0 {
+		t.Errorf("Due(a) after c = %q, want nothing", got)
+	}
+	if got := b.Due("b", now); len(got) != 1 {
+		t.Errorf("Due(b) after it was forgotten = %q, want the message", got)
+	}
+}
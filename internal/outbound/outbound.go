@@ -0,0 +1,60 @@
+// Package outbound makes HTTP requests to hosts named by untrusted input, like
+// the domain of a NIP-05 identifier, refusing to connect to the relay's own
+// machine or network.
+package outbound
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrNonPublicAddress is returned when a host resolves to an address outside
+// the public internet
+var ErrNonPublicAddress = errors.New("address is not public")
+
+// Public reports whether addr is on the public internet: not loopback,
+// private, link-local, multicast or unspecified
+func Public(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() && addr.IsGlobalUnicast() && !addr.IsPrivate() &&
+		// Shared address space of carrier-grade NATs (RFC 6598)
+		!netip.MustParsePrefix("100.64.0.0/10").Contains(addr)
+}
+
+// NewClient returns a client that only connects to public addresses. The check
+// runs on the address dialed, after DNS resolution, so a name resolving to an
+// internal address can't get around it. Proxies from the environment aren't
+// used and redirects aren't followed.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("%w: %s", ErrNonPublicAddress, address)
+			}
+			if !Public(ap.Addr()) {
+				return fmt.Errorf("%w: %s", ErrNonPublicAddress, ap.Addr())
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        16,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,53 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestPublic(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"1.1.1.1", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := Public(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("Public(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestClientRefusesLoopback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, srv.URL, nil)
+	resp, err := NewClient(time.Second).Do(req)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("request to a loopback server succeeded")
+	}
+	if !errors.Is(err, ErrNonPublicAddress) {
+		t.Errorf("err = %v, want ErrNonPublicAddress", err)
+	}
+}
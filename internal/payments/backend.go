@@ -0,0 +1,119 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/config"
+)
+
+// backendTimeout bounds a single request to the lightning backend
+const backendTimeout = 15 * time.Second
+
+// maxBackendResponse caps the size of a lightning backend response
+const maxBackendResponse = 1 << 20
+
+// Invoice is an invoice issued by a lightning backend
+type Invoice struct {
+	PaymentHash string
+	Bolt11      string
+}
+
+// Backend creates invoices on a lightning node or wallet and reports whether they settled
+type Backend interface {
+	CreateInvoice(ctx context.Context, amountMsats int64, memo string, expiry time.Duration) (*Invoice, error)
+	InvoiceSettled(ctx context.Context, paymentHash string) (bool, error)
+}
+
+// NewBackend returns the backend selected by cfg.Backend
+func NewBackend(cfg config.LightningConfig) (Backend, error) {
+	client, err := backendClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	baseURL := strings.TrimSuffix(cfg.URL, "/")
+
+	switch cfg.Backend {
+	case "lnd":
+		return &lndBackend{client: client, baseURL: baseURL, macaroon: cfg.AuthToken}, nil
+	case "cln":
+		return &clnBackend{client: client, baseURL: baseURL, rune: cfg.AuthToken}, nil
+	case "lnbits":
+		return &lnbitsBackend{client: client, baseURL: baseURL, apiKey: cfg.AuthToken}, nil
+	default:
+		return nil, fmt.Errorf("unknown lightning backend %q", cfg.Backend)
+	}
+}
+
+// backendClient returns an HTTP client trusting cfg.TLSCert in addition to the
+// system roots, for nodes serving self-signed certificates
+func backendClient(cfg config.LightningConfig) (*http.Client, error) {
+	client := &http.Client{Timeout: backendTimeout}
+	if cfg.TLSCert == "" {
+		return client, nil
+	}
+
+	pem, err := os.ReadFile(cfg.TLSCert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lightning TLS certificate: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", cfg.TLSCert)
+	}
+	client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}}
+	return client, nil
+}
+
+// doJSON sends body as JSON (when non-nil) and decodes the JSON response into out
+func doJSON(ctx context.Context, client *http.Client, method, url string, headers map[string]string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBackendResponse))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("lightning backend returned %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("invalid lightning backend response: %w", err)
+	}
+	return nil
+}
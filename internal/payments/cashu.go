@@ -0,0 +1,302 @@
+package payments
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/config"
+	"github.com/Shugur-Network/relay/internal/identity"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/storage"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+// ErrMintNotAllowed is returned for tokens from a mint missing from CASHU.MINTS
+var ErrMintNotAllowed = errors.New("mint is not accepted by this relay")
+
+// CashuPayment is the outcome of a redeemed Cashu payment
+type CashuPayment struct {
+	PubKey string `json:"pubkey"`
+	// AmountMsats is the amount credited after the mint's fee
+	AmountMsats int64 `json:"amount_msats"`
+	FeeSats     int64 `json:"fee_sats"`
+	// SpentMsats is the part of the balance spent on admission, PaidUntil the
+	// resulting admission (0 for admission that never lapses)
+	SpentMsats int64 `json:"spent_msats"`
+	PaidUntil  int64 `json:"paid_until"`
+}
+
+// CashuRedeemer redeems Cashu tokens and nutzaps: the proofs are swapped at
+// their mint for fresh ones held by the relay, then credited to the payer's
+// ledger balance, which is spent on admission
+type CashuRedeemer struct {
+	cfg     config.CashuConfig
+	fees    config.FeeSchedule
+	db      *storage.DB
+	mints   *mintClient
+	allowed map[string]bool
+	// p2pkKey unlocks nutzaps, nil when nutzaps are disabled
+	p2pkKey *btcec.PrivateKey
+	// onPaid is called with the credited pubkey, its new paid_until and the tier bought
+	onPaid func(pubkey string, paidUntil int64, tier string)
+}
+
+var _ storage.PaymentEventHandler = (*CashuRedeemer)(nil)
+
+// NewCashuRedeemer creates a redeemer for the configured mints
+func NewCashuRedeemer(cfg config.PaymentsConfig, db *storage.DB, onPaid func(pubkey string, paidUntil int64, tier string)) (*CashuRedeemer, error) {
+	c := &CashuRedeemer{
+		cfg:     cfg.Cashu,
+		fees:    cfg.Fees,
+		db:      db,
+		mints:   newMintClient(&http.Client{Timeout: backendTimeout}),
+		allowed: make(map[string]bool, len(cfg.Cashu.Mints)),
+		onPaid:  onPaid,
+	}
+	for _, mint := range cfg.Cashu.Mints {
+		c.allowed[strings.TrimSuffix(mint, "/")] = true
+	}
+	if cfg.Cashu.Nutzaps {
+		raw, err := hex.DecodeString(cfg.Cashu.P2PKKey)
+		if err != nil || len(raw) != 32 {
+			return nil, fmt.Errorf("invalid CASHU.P2PK_KEY")
+		}
+		c.p2pkKey, _ = btcec.PrivKeyFromBytes(raw)
+	}
+	return c, nil
+}
+
+// Redeem redeems a serialized token and credits it to pubkey
+func (c *CashuRedeemer) Redeem(ctx context.Context, pubkey, serialized string) (*CashuPayment, error) {
+	token, err := DecodeCashuToken(serialized)
+	if err != nil {
+		return nil, err
+	}
+
+	// The mint rejects a second swap of the same proofs, so the secrets identify the payment
+	secrets := make([]string, 0, len(token.Proofs))
+	for _, p := range token.Proofs {
+		secrets = append(secrets, p.Secret)
+	}
+	sort.Strings(secrets)
+	reference := sha256.Sum256([]byte(strings.Join(secrets, "\n")))
+	return c.redeem(ctx, pubkey, token, storage.LedgerCashu, hex.EncodeToString(reference[:]))
+}
+
+// redeem swaps the token's proofs at the mint and credits the result to pubkey
+func (c *CashuRedeemer) redeem(ctx context.Context, pubkey string, token *CashuToken, entryType, reference string) (*CashuPayment, error) {
+	if !c.allowed[token.Mint] {
+		return nil, ErrMintNotAllowed
+	}
+	if token.Unit != "sat" {
+		return nil, fmt.Errorf("%w: unsupported unit %q", ErrInvalidToken, token.Unit)
+	}
+
+	keysets, err := c.mints.keysets(ctx, token.Mint)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]mintKeyset, len(keysets))
+	var active *mintKeyset
+	for i, ks := range keysets {
+		byID[ks.ID] = ks
+		if ks.Active && ks.Unit == "sat" && (active == nil || ks.InputFeePPK < active.InputFeePPK) {
+			active = &keysets[i]
+		}
+	}
+	if active == nil {
+		return nil, fmt.Errorf("mint has no active sat keyset")
+	}
+
+	// Input fees are charged per proof in parts per thousand, rounded up (NUT-02)
+	var feePPK int64
+	for _, p := range token.Proofs {
+		ks, ok := byID[p.KeysetID]
+		if !ok || ks.Unit != "sat" {
+			return nil, fmt.Errorf("%w: unknown keyset %s", ErrInvalidToken, p.KeysetID)
+		}
+		feePPK += ks.InputFeePPK
+	}
+	fee := (feePPK + 999) / 1000
+	amount := token.Amount() - fee
+	if amount <= 0 {
+		return nil, fmt.Errorf("%w: token does not cover the mint fee", ErrInvalidToken)
+	}
+
+	keys, err := c.mints.keysetKeys(ctx, token.Mint, active.ID)
+	if err != nil {
+		return nil, err
+	}
+	var outputs []blindedMessage
+	var blinded []*blindedSecret
+	for _, part := range splitAmount(amount) {
+		if _, ok := keys[part]; !ok {
+			return nil, fmt.Errorf("mint keyset has no key for amount %d", part)
+		}
+		bs, err := blindSecret()
+		if err != nil {
+			return nil, err
+		}
+		blinded = append(blinded, bs)
+		outputs = append(outputs, blindedMessage{Amount: part, KeysetID: active.ID, B: bs.blinded})
+	}
+
+	signatures, err := c.mints.swap(ctx, token.Mint, token.Proofs, outputs)
+	if err != nil {
+		return nil, err
+	}
+	proofs := make([]storage.CashuProof, 0, len(signatures))
+	for i, sig := range signatures {
+		if sig.Amount != outputs[i].Amount || sig.KeysetID != active.ID {
+			return nil, fmt.Errorf("mint signed a different output than requested")
+		}
+		proofC, err := blinded[i].unblind(sig.C, keys[sig.Amount])
+		if err != nil {
+			return nil, err
+		}
+		proofs = append(proofs, storage.CashuProof{
+			Mint:     token.Mint,
+			KeysetID: active.ID,
+			Amount:   sig.Amount,
+			Secret:   blinded[i].secret,
+			C:        proofC,
+		})
+	}
+
+	// The swapped proofs only exist here now, so store them even if the request is gone
+	storeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	price := balancePrice(c.fees)
+	result, err := c.db.StoreCashuPayment(storeCtx, proofs, storage.LedgerEntry{
+		EntryType:   entryType,
+		Reference:   reference,
+		PubKey:      pubkey,
+		AmountMsats: amount * 1000,
+		CreatedAt:   time.Now().Unix(),
+	}, price)
+	if err != nil {
+		logger.Error("Failed to store redeemed cashu proofs",
+			zap.String("mint", token.Mint), zap.Int64("amount", amount), zap.Error(err))
+		return nil, err
+	}
+
+	logger.Info("Redeemed cashu payment",
+		zap.String("pubkey", pubkey),
+		zap.String("mint", token.Mint),
+		zap.String("type", entryType),
+		zap.Int64("amount_sats", amount),
+		zap.Int64("fee_sats", fee))
+	if result.Spent > 0 && c.onPaid != nil {
+		c.onPaid(pubkey, result.PaidUntil, price.Plan)
+	}
+	return &CashuPayment{
+		PubKey:      pubkey,
+		AmountMsats: amount * 1000,
+		FeeSats:     fee,
+		SpentMsats:  result.Spent,
+		PaidUntil:   result.PaidUntil,
+	}, nil
+}
+
+// p2pkPubKey returns the x-only public key nutzaps are locked to
+func (c *CashuRedeemer) p2pkPubKey() string {
+	return hex.EncodeToString(schnorr.SerializePubKey(c.p2pkKey.PubKey()))
+}
+
+// IsNutzap reports whether evt is a nutzap (NIP-61) to the relay from an allowlisted mint
+func (c *CashuRedeemer) IsNutzap(evt *nostr.Event) bool {
+	if c.p2pkKey == nil || evt.Kind != nostr.KindNutZap {
+		return false
+	}
+	mint := evt.Tags.GetFirst([]string{"u", ""})
+	if mint == nil || !c.allowed[strings.TrimSuffix((*mint)[1], "/")] {
+		return false
+	}
+	signer, err := identity.ActiveSigner()
+	if err != nil {
+		return false
+	}
+	recipient := evt.Tags.GetFirst([]string{"p", ""})
+	return recipient != nil && (*recipient)[1] == signer.PublicKey()
+}
+
+// HandlePaymentEvent redeems a stored nutzap and credits its author
+func (c *CashuRedeemer) HandlePaymentEvent(ctx context.Context, evt nostr.Event) {
+	if !c.IsNutzap(&evt) {
+		return
+	}
+	mint := evt.Tags.GetFirst([]string{"u", ""})
+	token := &CashuToken{Mint: strings.TrimSuffix((*mint)[1], "/"), Unit: "sat"}
+
+	for _, tag := range evt.Tags {
+		if len(tag) < 2 || tag[0] != "proof" || len(token.Proofs) == maxTokenProofs {
+			continue
+		}
+		var proof CashuProof
+		if err := json.Unmarshal([]byte(tag[1]), &proof); err != nil {
+			logger.Warn("Ignoring malformed nutzap proof", zap.String("event_id", evt.ID), zap.Error(err))
+			continue
+		}
+		// Senders lock to the advertised x-only key with a "02" prefix (NIP-61)
+		locked, sigInputs := p2pkLock(proof.Secret)
+		if locked = strings.ToLower(locked); len(locked) == 66 && strings.HasPrefix(locked, "02") {
+			locked = locked[2:]
+		}
+		if locked != c.p2pkPubKey() || !sigInputs {
+			logger.Warn("Ignoring nutzap proof not locked to the relay", zap.String("event_id", evt.ID))
+			continue
+		}
+		witness, err := p2pkWitness(c.p2pkKey, proof.Secret)
+		if err != nil {
+			logger.Warn("Failed to sign nutzap proof", zap.String("event_id", evt.ID), zap.Error(err))
+			continue
+		}
+		proof.Witness = witness
+		token.Proofs = append(token.Proofs, proof)
+	}
+	if len(token.Proofs) == 0 {
+		return
+	}
+
+	redeemCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if _, err := c.redeem(redeemCtx, strings.ToLower(evt.PubKey), token, storage.LedgerNutzap, evt.ID); err != nil {
+		logger.Warn("Failed to redeem nutzap", zap.String("event_id", evt.ID), zap.Error(err))
+	}
+}
+
+// NutzapInfo returns the relay's signed nutzap informational event (kind 10019)
+// naming the accepted mints and the key nutzaps must be locked to
+func (c *CashuRedeemer) NutzapInfo(ctx context.Context, relayURL string) (*nostr.Event, error) {
+	if c.p2pkKey == nil {
+		return nil, errors.New("nutzaps are not enabled")
+	}
+	evt := &nostr.Event{Kind: nostr.KindNutZapInfo, CreatedAt: nostr.Now()}
+	if relayURL != "" {
+		evt.Tags = append(evt.Tags, nostr.Tag{"relay", relayURL})
+	}
+	for _, mint := range c.cfg.Mints {
+		evt.Tags = append(evt.Tags, nostr.Tag{"mint", strings.TrimSuffix(mint, "/"), "sat"})
+	}
+	evt.Tags = append(evt.Tags, nostr.Tag{"pubkey", c.p2pkPubKey()})
+
+	signer, err := identity.ActiveSigner()
+	if err != nil {
+		return nil, err
+	}
+	if err := signer.SignEvent(ctx, evt); err != nil {
+		return nil, fmt.Errorf("failed to sign nutzap info: %w", err)
+	}
+	return evt, nil
+}
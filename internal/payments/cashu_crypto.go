@@ -0,0 +1,131 @@
+package payments
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+)
+
+// hashToCurveDomain separates Cashu's hash_to_curve from other uses of SHA-256 (NUT-00)
+const hashToCurveDomain = "Secp256k1_HashToCurve_Cashu_"
+
+// hashToCurve maps a proof secret to the curve point Y (NUT-00)
+func hashToCurve(secret []byte) (btcec.JacobianPoint, error) {
+	msgHash := sha256.Sum256(append([]byte(hashToCurveDomain), secret...))
+	var counter [4]byte
+	for i := uint32(0); i < 1<<16; i++ {
+		binary.LittleEndian.PutUint32(counter[:], i)
+		hash := sha256.Sum256(append(msgHash[:], counter[:]...))
+		if point, err := btcec.ParseJacobian(append([]byte{0x02}, hash[:]...)); err == nil {
+			return point, nil
+		}
+	}
+	return btcec.JacobianPoint{}, errors.New("no valid point found for secret")
+}
+
+// blindedSecret is an output's secret with the blinding factor used to request
+// its signature from the mint
+type blindedSecret struct {
+	secret  string
+	r       btcec.ModNScalar
+	blinded string
+}
+
+// blindSecret creates a random secret and its blinded message B_ = Y + rG
+func blindSecret() (*blindedSecret, error) {
+	var raw [32]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return nil, err
+	}
+	r, err := btcec.NewPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return blindSecretWith(hex.EncodeToString(raw[:]), r)
+}
+
+// blindSecretWith blinds secret with the blinding factor r
+func blindSecretWith(secret string, r *btcec.PrivateKey) (*blindedSecret, error) {
+	y, err := hashToCurve([]byte(secret))
+	if err != nil {
+		return nil, err
+	}
+	var rG, b btcec.JacobianPoint
+	btcec.ScalarBaseMultNonConst(&r.Key, &rG)
+	btcec.AddNonConst(&y, &rG, &b)
+	return &blindedSecret{secret: secret, r: r.Key, blinded: hex.EncodeToString(btcec.JacobianToByteSlice(b))}, nil
+}
+
+// unblind computes the proof signature C = C_ - rK from the mint's blind
+// signature C_ and its public key K for the output amount
+func (bs *blindedSecret) unblind(blindSig, mintKey string) (string, error) {
+	cBytes, err := hex.DecodeString(blindSig)
+	if err != nil {
+		return "", fmt.Errorf("invalid blind signature: %w", err)
+	}
+	kBytes, err := hex.DecodeString(mintKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid mint key: %w", err)
+	}
+	c, err := btcec.ParseJacobian(cBytes)
+	if err != nil {
+		return "", fmt.Errorf("invalid blind signature: %w", err)
+	}
+	k, err := btcec.ParseJacobian(kBytes)
+	if err != nil {
+		return "", fmt.Errorf("invalid mint key: %w", err)
+	}
+
+	var rK, result btcec.JacobianPoint
+	btcec.ScalarMultNonConst(&bs.r, &k, &rK)
+	rK.Y.Negate(1).Normalize()
+	btcec.AddNonConst(&c, &rK, &result)
+	return hex.EncodeToString(btcec.JacobianToByteSlice(result)), nil
+}
+
+// p2pkSecret is the NUT-10 well-known secret of a proof locked to a public key (NUT-11)
+type p2pkSecret struct {
+	Data string     `json:"data"`
+	Tags [][]string `json:"tags"`
+}
+
+// p2pkLock returns the public key a proof is locked to and whether the lock only
+// signs inputs, or "" when the proof isn't P2PK locked
+func p2pkLock(secret string) (string, bool) {
+	var parts []json.RawMessage
+	if err := json.Unmarshal([]byte(secret), &parts); err != nil || len(parts) != 2 {
+		return "", false
+	}
+	var kind string
+	var lock p2pkSecret
+	if json.Unmarshal(parts[0], &kind) != nil || kind != "P2PK" || json.Unmarshal(parts[1], &lock) != nil {
+		return "", false
+	}
+	for _, tag := range lock.Tags {
+		if len(tag) == 2 && tag[0] == "sigflag" && tag[1] != "SIG_INPUTS" {
+			return lock.Data, false
+		}
+	}
+	return lock.Data, true
+}
+
+// p2pkWitness signs a P2PK locked proof's secret with key (NUT-11)
+func p2pkWitness(key *btcec.PrivateKey, secret string) (string, error) {
+	hash := sha256.Sum256([]byte(secret))
+	sig, err := schnorr.Sign(key, hash[:])
+	if err != nil {
+		return "", err
+	}
+	witness, err := json.Marshal(map[string][]string{"signatures": {hex.EncodeToString(sig.Serialize())}})
+	if err != nil {
+		return "", err
+	}
+	return string(witness), nil
+}
@@ -0,0 +1,124 @@
+package payments
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// Test vectors from NUT-00: https://github.com/cashubtc/nuts/blob/main/tests/00-tests.md
+
+func TestHashToCurve(t *testing.T) {
+	tests := []struct {
+		secret string
+		want   string
+	}{
+		{"0000000000000000000000000000000000000000000000000000000000000000", "024cce997d3b518f739663b757deaec95bcd9473c30a14ac2fd04023a739d1a725"},
+		{"0000000000000000000000000000000000000000000000000000000000000001", "022e7158e11c9506f1aa4248bf531298daa7febd6194f003edcd9b93ade6253acf"},
+		{"0000000000000000000000000000000000000000000000000000000000000002", "026cdbe15362df59cd1dd3c9c11de8aedac2106eca69236ecd9fbe117af897be4f"},
+	}
+	for _, tt := range tests {
+		secret, err := hex.DecodeString(tt.secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		y, err := hashToCurve(secret)
+		if err != nil {
+			t.Fatalf("hashToCurve(%s): %v", tt.secret, err)
+		}
+		if got := hex.EncodeToString(btcec.JacobianToByteSlice(y)); got != tt.want {
+			t.Errorf("hashToCurve(%s) = %s, want %s", tt.secret, got, tt.want)
+		}
+	}
+}
+
+func TestBlindSecretWith(t *testing.T) {
+	tests := []struct {
+		secret string
+		r      string
+		want   string
+	}{
+		{"test_message", "0000000000000000000000000000000000000000000000000000000000000001", "025cc16fe33b953e2ace39653efb3e7a7049711ae1d8a2f7a9108753f1cdea742b"},
+	}
+	for _, tt := range tests {
+		bs, err := blindSecretWith(tt.secret, privateKey(t, tt.r))
+		if err != nil {
+			t.Fatalf("blindSecretWith(%q): %v", tt.secret, err)
+		}
+		if bs.blinded != tt.want {
+			t.Errorf("blindSecretWith(%q) = %s, want %s", tt.secret, bs.blinded, tt.want)
+		}
+	}
+}
+
+func TestUnblind(t *testing.T) {
+	// The mint signs B_ with k; unblinding must yield C = kY
+	k := privateKey(t, "7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f")
+	bs, err := blindSecretWith("test_message", privateKey(t, "6d7e0abffc83267de28ed8ecc8760f17697e51252e13333ba69b4ddad1f95d05"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blinded := parsePoint(t, bs.blinded)
+	var blindSig btcec.JacobianPoint
+	btcec.ScalarMultNonConst(&k.Key, &blinded, &blindSig)
+
+	got, err := bs.unblind(hex.EncodeToString(btcec.JacobianToByteSlice(blindSig)), hex.EncodeToString(k.PubKey().SerializeCompressed()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	y, err := hashToCurve([]byte("test_message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want btcec.JacobianPoint
+	btcec.ScalarMultNonConst(&k.Key, &y, &want)
+	if wantHex := hex.EncodeToString(btcec.JacobianToByteSlice(want)); got != wantHex {
+		t.Errorf("unblind = %s, want %s", got, wantHex)
+	}
+}
+
+func TestP2PKLock(t *testing.T) {
+	const pubkey = "0249098aa8b9d2fbec49ff8598feb17b592b986e62319a4fa488a3dc36387157a7"
+	tests := []struct {
+		secret     string
+		wantKey    string
+		wantInputs bool
+	}{
+		{`["P2PK",{"nonce":"859d4935c4907062a6297cf4e663e2835d90d97ecdd510745d32f6816323a41f","data":"` + pubkey + `","tags":[["sigflag","SIG_INPUTS"]]}]`, pubkey, true},
+		{`["P2PK",{"nonce":"859d4935c4907062a6297cf4e663e2835d90d97ecdd510745d32f6816323a41f","data":"` + pubkey + `","tags":[["sigflag","SIG_ALL"]]}]`, pubkey, false},
+		{`["HTLC",{"data":"` + pubkey + `"}]`, "", false},
+		{"407915bc212be61a77e3e6d2aeb4c727980bda51cd06a6afc29e2861768a7837", "", false},
+	}
+	for _, tt := range tests {
+		key, inputs := p2pkLock(tt.secret)
+		if key != tt.wantKey || inputs != tt.wantInputs {
+			t.Errorf("p2pkLock(%s) = %q, %v, want %q, %v", tt.secret, key, inputs, tt.wantKey, tt.wantInputs)
+		}
+	}
+}
+
+func privateKey(t *testing.T, hexKey string) *btcec.PrivateKey {
+	t.Helper()
+	raw, err := hex.DecodeString(hexKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := btcec.PrivKeyFromBytes(raw)
+	return key
+}
+
+func parsePoint(t *testing.T, hexPoint string) btcec.JacobianPoint {
+	t.Helper()
+	raw, err := hex.DecodeString(hexPoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	point, err := btcec.ParseJacobian(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return point
+}
@@ -0,0 +1,160 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// mintCodeTokenSpent is the NUT error code for already spent proofs
+const mintCodeTokenSpent = 11001
+
+// ErrTokenSpent is returned when the mint reports the token's proofs as spent
+var ErrTokenSpent = errors.New("cashu token was already spent")
+
+// mintKeyset describes one keyset of a mint (NUT-02)
+type mintKeyset struct {
+	ID          string `json:"id"`
+	Unit        string `json:"unit"`
+	Active      bool   `json:"active"`
+	InputFeePPK int64  `json:"input_fee_ppk"`
+}
+
+// blindedMessage is an output sent to the mint for signing (NUT-00)
+type blindedMessage struct {
+	Amount   int64  `json:"amount"`
+	KeysetID string `json:"id"`
+	B        string `json:"B_"`
+}
+
+// blindSignature is the mint's signature on a blinded message (NUT-00)
+type blindSignature struct {
+	Amount   int64  `json:"amount"`
+	KeysetID string `json:"id"`
+	C        string `json:"C_"`
+}
+
+// mintClient talks to Cashu mints over their HTTP API
+type mintClient struct {
+	client *http.Client
+
+	// keys caches mint public keys per keyset id; keysets never change their keys
+	keysMu sync.Mutex
+	keys   map[string]map[int64]string
+}
+
+func newMintClient(client *http.Client) *mintClient {
+	return &mintClient{client: client, keys: make(map[string]map[int64]string)}
+}
+
+// keysets returns the keysets of a mint (GET /v1/keysets)
+func (m *mintClient) keysets(ctx context.Context, mint string) ([]mintKeyset, error) {
+	var resp struct {
+		Keysets []mintKeyset `json:"keysets"`
+	}
+	if err := doJSON(ctx, m.client, http.MethodGet, mint+"/v1/keysets", nil, nil, &resp); err != nil {
+		return nil, fmt.Errorf("mint keysets: %w", err)
+	}
+	return resp.Keysets, nil
+}
+
+// keysetKeys returns the public key per amount of a keyset (GET /v1/keys/{id})
+func (m *mintClient) keysetKeys(ctx context.Context, mint, keysetID string) (map[int64]string, error) {
+	cacheKey := mint + "/" + keysetID
+	m.keysMu.Lock()
+	keys, ok := m.keys[cacheKey]
+	m.keysMu.Unlock()
+	if ok {
+		return keys, nil
+	}
+
+	var resp struct {
+		Keysets []struct {
+			ID   string            `json:"id"`
+			Keys map[string]string `json:"keys"`
+		} `json:"keysets"`
+	}
+	if err := doJSON(ctx, m.client, http.MethodGet, mint+"/v1/keys/"+keysetID, nil, nil, &resp); err != nil {
+		return nil, fmt.Errorf("mint keys: %w", err)
+	}
+	if len(resp.Keysets) != 1 || resp.Keysets[0].ID != keysetID {
+		return nil, fmt.Errorf("mint returned keys for the wrong keyset")
+	}
+
+	keys = make(map[int64]string, len(resp.Keysets[0].Keys))
+	for amount, key := range resp.Keysets[0].Keys {
+		value, err := strconv.ParseInt(amount, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("mint returned invalid key amount %q", amount)
+		}
+		keys[value] = key
+	}
+	m.keysMu.Lock()
+	m.keys[cacheKey] = keys
+	m.keysMu.Unlock()
+	return keys, nil
+}
+
+// swap exchanges proofs for signatures on new outputs (POST /v1/swap)
+func (m *mintClient) swap(ctx context.Context, mint string, inputs []CashuProof, outputs []blindedMessage) ([]blindSignature, error) {
+	body, err := json.Marshal(map[string]interface{}{"inputs": inputs, "outputs": outputs})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, mint+"/v1/swap", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("mint swap: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBackendResponse))
+	if err != nil {
+		return nil, fmt.Errorf("mint swap: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var mintErr struct {
+			Detail string `json:"detail"`
+			Code   int    `json:"code"`
+		}
+		_ = json.Unmarshal(data, &mintErr) // nolint:errcheck // falls back to the status code
+		if mintErr.Code == mintCodeTokenSpent {
+			return nil, ErrTokenSpent
+		}
+		return nil, fmt.Errorf("mint swap returned %d: %s", resp.StatusCode, mintErr.Detail)
+	}
+
+	var result struct {
+		Signatures []blindSignature `json:"signatures"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("invalid mint swap response: %w", err)
+	}
+	if len(result.Signatures) != len(outputs) {
+		return nil, fmt.Errorf("mint returned %d signatures for %d outputs", len(result.Signatures), len(outputs))
+	}
+	return result.Signatures, nil
+}
+
+// splitAmount splits amount into powers of two, smallest first (NUT-00)
+func splitAmount(amount int64) []int64 {
+	var parts []int64
+	for bit := int64(1); amount > 0; bit <<= 1 {
+		if amount&bit != 0 {
+			parts = append(parts, bit)
+			amount &^= bit
+		}
+	}
+	return parts
+}
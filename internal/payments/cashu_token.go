@@ -0,0 +1,147 @@
+package payments
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidToken is returned for a Cashu token that can't be decoded
+var ErrInvalidToken = errors.New("invalid cashu token")
+
+// maxTokenProofs bounds the proofs redeemed from one token
+const maxTokenProofs = 64
+
+// CashuProof is one ecash proof (NUT-00)
+type CashuProof struct {
+	Amount   int64  `json:"amount"`
+	KeysetID string `json:"id"`
+	Secret   string `json:"secret"`
+	C        string `json:"C"`
+	Witness  string `json:"witness,omitempty"`
+}
+
+// CashuToken is a decoded token: proofs from a single mint in one unit
+type CashuToken struct {
+	Mint   string
+	Unit   string
+	Proofs []CashuProof
+}
+
+// Amount returns the sum of the token's proofs
+func (t *CashuToken) Amount() int64 {
+	var total int64
+	for _, p := range t.Proofs {
+		total += p.Amount
+	}
+	return total
+}
+
+// DecodeCashuToken decodes a serialized V3 (cashuA, JSON) or V4 (cashuB, CBOR)
+// token. Tokens spanning several mints are rejected.
+func DecodeCashuToken(serialized string) (*CashuToken, error) {
+	serialized = strings.TrimSpace(strings.TrimPrefix(serialized, "cashu:"))
+	if len(serialized) < 6 {
+		return nil, ErrInvalidToken
+	}
+	payload, err := decodeTokenBase64(serialized[6:])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var token *CashuToken
+	switch serialized[:6] {
+	case "cashuA":
+		token, err = decodeTokenV3(payload)
+	case "cashuB":
+		token, err = decodeTokenV4(payload)
+	default:
+		return nil, fmt.Errorf("%w: unsupported version", ErrInvalidToken)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if len(token.Proofs) == 0 || len(token.Proofs) > maxTokenProofs {
+		return nil, fmt.Errorf("%w: token must hold 1 to %d proofs", ErrInvalidToken, maxTokenProofs)
+	}
+	for _, p := range token.Proofs {
+		if p.Amount <= 0 || p.Secret == "" || p.C == "" || p.KeysetID == "" {
+			return nil, fmt.Errorf("%w: malformed proof", ErrInvalidToken)
+		}
+	}
+	if token.Unit == "" {
+		token.Unit = "sat"
+	}
+	token.Mint = strings.TrimSuffix(token.Mint, "/")
+	return token, nil
+}
+
+// decodeTokenBase64 accepts URL-safe and standard base64, padded or not
+func decodeTokenBase64(s string) ([]byte, error) {
+	s = strings.TrimRight(s, "=")
+	if data, err := base64.RawURLEncoding.DecodeString(s); err == nil {
+		return data, nil
+	}
+	return base64.RawStdEncoding.DecodeString(s)
+}
+
+// decodeTokenV3 decodes the JSON body of a cashuA token
+func decodeTokenV3(payload []byte) (*CashuToken, error) {
+	var v3 struct {
+		Token []struct {
+			Mint   string       `json:"mint"`
+			Proofs []CashuProof `json:"proofs"`
+		} `json:"token"`
+		Unit string `json:"unit"`
+	}
+	if err := json.Unmarshal(payload, &v3); err != nil {
+		return nil, err
+	}
+	if len(v3.Token) != 1 {
+		return nil, errors.New("token must hold proofs from exactly one mint")
+	}
+	return &CashuToken{Mint: v3.Token[0].Mint, Unit: v3.Unit, Proofs: v3.Token[0].Proofs}, nil
+}
+
+// decodeTokenV4 decodes the CBOR body of a cashuB token
+func decodeTokenV4(payload []byte) (*CashuToken, error) {
+	value, err := decodeCBOR(payload)
+	if err != nil {
+		return nil, err
+	}
+	root, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("token must be a map")
+	}
+	token := &CashuToken{}
+	token.Mint, _ = root["m"].(string)
+	token.Unit, _ = root["u"].(string)
+
+	keysets, _ := root["t"].([]interface{})
+	for _, ks := range keysets {
+		keyset, _ := ks.(map[string]interface{})
+		id, _ := keyset["i"].([]byte)
+		proofs, _ := keyset["p"].([]interface{})
+		for _, p := range proofs {
+			proof, _ := p.(map[string]interface{})
+			amount, _ := proof["a"].(uint64)
+			secret, _ := proof["s"].(string)
+			c, _ := proof["c"].([]byte)
+			witness, _ := proof["w"].(string)
+			if amount > 1<<53 {
+				return nil, errors.New("proof amount out of range")
+			}
+			token.Proofs = append(token.Proofs, CashuProof{
+				Amount:   int64(amount),
+				KeysetID: hex.EncodeToString(id),
+				Secret:   secret,
+				C:        hex.EncodeToString(c),
+				Witness:  witness,
+			})
+		}
+	}
+	return token, nil
+}
@@ -0,0 +1,81 @@
+package payments
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// Example tokens from NUT-00: https://github.com/cashubtc/nuts/blob/main/00.md
+
+func TestDecodeCashuToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+		want  *CashuToken
+	}{
+		{
+			name:  "v4",
+			token: "cashuBpGF0gaJhaUgArSaMTR9YJmFwgaNhYQFhc3hAOWE2ZGJiODQ3YmQyMzJiYTc2ZGIwZGYxOTcyMTZiMjlkM2I4Y2MxNDU1M2NkMjc4MjdmYzFjYzk0MmZlZGI0ZWFjWCEDhhhUP_trhpXfStS6vN6So0qWvc2X3O4NfM-Y1HISZ5JhZGlUaGFuayB5b3VhbXVodHRwOi8vbG9jYWxob3N0OjMzMzhhdWNzYXQ=",
+			want: &CashuToken{
+				Mint: "http://localhost:3338",
+				Unit: "sat",
+				Proofs: []CashuProof{{
+					Amount:   1,
+					KeysetID: "00ad268c4d1f5826",
+					Secret:   "9a6dbb847bd232ba76db0df197216b29d3b8cc14553cd27827fc1cc942fedb4e",
+					C:        "038618543ffb6b8695df4ad4babcde92a34a96bdcd97dcee0d7ccf98d472126792",
+				}},
+			},
+		},
+		{
+			name:  "v3",
+			token: "cashuAeyJ0b2tlbiI6W3sibWludCI6Imh0dHBzOi8vODMzMy5zcGFjZTozMzM4IiwicHJvb2ZzIjpbeyJhbW91bnQiOjIsImlkIjoiMDA5YTFmMjkzMjUzZTQxZSIsInNlY3JldCI6IjQwNzkxNWJjMjEyYmU2MWE3N2UzZTZkMmFlYjRjNzI3OTgwYmRhNTFjZDA2YTZhZmMyOWUyODYxNzY4YTc4MzciLCJDIjoiMDJiYzkwOTc5OTdkODFhZmIyY2M3MzQ2YjVlNDM0NWE5MzQ2YmQyYTUwNmViNzk1ODU5OGE3MmYwY2Y4NTE2M2VhIn0seyJhbW91bnQiOjgsImlkIjoiMDA5YTFmMjkzMjUzZTQxZSIsInNlY3JldCI6ImZlMTUxMDkzMTRlNjFkNzc1NmIwZjhlZTBmMjNhNjI0YWNhYTNmNGUwNDJmNjE0MzNjNzI4YzcwNTdiOTMxYmUiLCJDIjoiMDI5ZThlNTA1MGI4OTBhN2Q2YzA5NjhkYjE2YmMxZDVkNWZhMDQwZWExZGUyODRmNmVjNjlkNjEyOTlmNjcxMDU5In1dfV0sInVuaXQiOiJzYXQiLCJtZW1vIjoiVGhhbmsgeW91LiJ9",
+			want: &CashuToken{
+				Mint: "https://8333.space:3338",
+				Unit: "sat",
+				Proofs: []CashuProof{
+					{
+						Amount:   2,
+						KeysetID: "009a1f293253e41e",
+						Secret:   "407915bc212be61a77e3e6d2aeb4c727980bda51cd06a6afc29e2861768a7837",
+						C:        "02bc9097997d81afb2cc7346b5e4345a9346bd2a506eb7958598a72f0cf85163ea",
+					},
+					{
+						Amount:   8,
+						KeysetID: "009a1f293253e41e",
+						Secret:   "fe15109314e61d7756b0f8ee0f23a624acaa3f4e042f61433c728c7057b931be",
+						C:        "029e8e5050b890a7d6c0968db16bc1d5d5fa040ea1de284f6ec69d61299f671059",
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeCashuToken(tt.token)
+			if err != nil {
+				t.Fatalf("DecodeCashuToken: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeCashuToken = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCashuTokenInvalid(t *testing.T) {
+	for _, token := range []string{
+		"",
+		"cashuC",
+		"cashuA!!!",
+		"cashuAeyJ0b2tlbiI6W119",    // {"token":[]}
+		"cashuBoWF0gA",              // {"t":[]}, no proofs
+		"cashuBv2F0gP8",             // indefinite length map
+		"cashuBpGF0gaJhaUgArSaMTR9", // truncated
+	} {
+		if _, err := DecodeCashuToken(token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("DecodeCashuToken(%q) error = %v, want ErrInvalidToken", token, err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package payments
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// maxCBORDepth bounds nesting when decoding untrusted CBOR
+const maxCBORDepth = 16
+
+var errCBORTruncated = errors.New("cbor: unexpected end of data")
+
+// decodeCBOR decodes the subset of CBOR (RFC 8949) used by Cashu V4 tokens:
+// definite length integers, byte and text strings, arrays, maps with text keys,
+// booleans and null
+func decodeCBOR(data []byte) (interface{}, error) {
+	value, rest, err := decodeCBORItem(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("cbor: trailing data")
+	}
+	return value, nil
+}
+
+func decodeCBORItem(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > maxCBORDepth {
+		return nil, nil, errors.New("cbor: nesting too deep")
+	}
+	if len(data) == 0 {
+		return nil, nil, errCBORTruncated
+	}
+	major, info := data[0]>>5, data[0]&0x1f
+	data = data[1:]
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, data, nil
+		case 21:
+			return true, data, nil
+		case 22, 23:
+			return nil, data, nil
+		default:
+			return nil, nil, fmt.Errorf("cbor: unsupported simple value %d", info)
+		}
+	}
+
+	var arg uint64
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		size := 1 << (info - 24)
+		if len(data) < size {
+			return nil, nil, errCBORTruncated
+		}
+		buf := make([]byte, 8)
+		copy(buf[8-size:], data[:size])
+		arg = binary.BigEndian.Uint64(buf)
+		data = data[size:]
+	default:
+		return nil, nil, errors.New("cbor: indefinite lengths are not supported")
+	}
+
+	switch major {
+	case 0:
+		return arg, data, nil
+	case 1:
+		return -1 - int64(arg), data, nil
+	case 2, 3:
+		if arg > uint64(len(data)) {
+			return nil, nil, errCBORTruncated
+		}
+		if major == 2 {
+			return append([]byte(nil), data[:arg]...), data[arg:], nil
+		}
+		return string(data[:arg]), data[arg:], nil
+	case 4:
+		// Every item takes at least one byte
+		if arg > uint64(len(data)) {
+			return nil, nil, errCBORTruncated
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			var item interface{}
+			var err error
+			if item, data, err = decodeCBORItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, data, nil
+	case 5:
+		if arg > uint64(len(data))/2 {
+			return nil, nil, errCBORTruncated
+		}
+		entries := make(map[string]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, rest, err := decodeCBORItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, nil, errors.New("cbor: map keys must be text")
+			}
+			var value interface{}
+			if value, data, err = decodeCBORItem(rest, depth+1); err != nil {
+				return nil, nil, err
+			}
+			entries[name] = value
+		}
+		return entries, data, nil
+	default:
+		return nil, nil, fmt.Errorf("cbor: unsupported major type %d", major)
+	}
+}
@@ -0,0 +1,74 @@
+package payments
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+// Examples from RFC 8949 Appendix A
+func TestDecodeCBOR(t *testing.T) {
+	tests := []struct {
+		data string
+		want interface{}
+	}{
+		{"00", uint64(0)},
+		{"17", uint64(23)},
+		{"1818", uint64(24)},
+		{"190100", uint64(256)},
+		{"1a000f4240", uint64(1000000)},
+		{"1b000000e8d4a51000", uint64(1000000000000)},
+		{"20", int64(-1)},
+		{"3903e7", int64(-1000)},
+		{"40", []byte(nil)},
+		{"4401020304", []byte{1, 2, 3, 4}},
+		{"60", ""},
+		{"6449455446", "IETF"},
+		{"62c3bc", "ü"},
+		{"f4", false},
+		{"f5", true},
+		{"f6", nil},
+		{"80", []interface{}{}},
+		{"83010203", []interface{}{uint64(1), uint64(2), uint64(3)}},
+		{"8301820203820405", []interface{}{uint64(1), []interface{}{uint64(2), uint64(3)}, []interface{}{uint64(4), uint64(5)}}},
+		{"a0", map[string]interface{}{}},
+		{"a26161016162820203", map[string]interface{}{"a": uint64(1), "b": []interface{}{uint64(2), uint64(3)}}},
+	}
+	for _, tt := range tests {
+		data, err := hex.DecodeString(tt.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := decodeCBOR(data)
+		if err != nil {
+			t.Errorf("decodeCBOR(%s): %v", tt.data, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("decodeCBOR(%s) = %#v, want %#v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeCBORInvalid(t *testing.T) {
+	for _, data := range []string{
+		"",                                     // empty
+		"19",                                   // truncated argument
+		"64494554",                             // truncated text
+		"83010203" + "00",                      // trailing data
+		"9f01ff",                               // indefinite length array
+		"a10102",                               // integer map key
+		"c11a514b67b0",                         // tag
+		"f97c00",                               // float
+		"9b00000000ffffffff",                   // array longer than the data
+		"818181818181818181818181818181818181", // nested too deep
+	} {
+		raw, err := hex.DecodeString(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := decodeCBOR(raw); err == nil {
+			t.Errorf("decodeCBOR(%s) succeeded, want error", data)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/config"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/storage"
+	"go.uber.org/zap"
+)
+
+// Plans an invoice can be issued for
+const (
+	PlanAdmission    = "admission"
+	PlanSubscription = "subscription"
+)
+
+const (
+	// defaultInvoiceExpiry is used when LIGHTNING.INVOICE_EXPIRY is unset
+	defaultInvoiceExpiry = time.Hour
+	// defaultPollInterval is used when LIGHTNING.POLL_INTERVAL is unset
+	defaultPollInterval = 15 * time.Second
+	// pollBatch bounds the pending invoices checked per poll
+	pollBatch = 100
+)
+
+// ErrUnknownPlan is returned for a plan that has no fee configured
+var ErrUnknownPlan = errors.New("no fee is configured for this plan")
+
+// Service issues lightning invoices for paid admission and credits pubkeys once
+// the invoices settle, whether reported by webhook or found by polling
+type Service struct {
+	cfg     config.PaymentsConfig
+	db      *storage.DB
+	backend Backend
+	// onPaid is called with the credited pubkey, its new paid_until and the tier bought
+	onPaid func(pubkey string, paidUntil int64, tier string)
+}
+
+// NewService creates a payment service using the configured lightning backend
+func NewService(cfg config.PaymentsConfig, db *storage.DB, onPaid func(pubkey string, paidUntil int64, tier string)) (*Service, error) {
+	backend, err := NewBackend(cfg.Lightning)
+	if err != nil {
+		return nil, err
+	}
+	return &Service{cfg: cfg, db: db, backend: backend, onPaid: onPaid}, nil
+}
+
+// price returns the fee in msats charged for plan, a fee schedule plan or the name
+// of a membership tier, and the admission period it buys
+func (s *Service) price(plan string) (int64, time.Duration, error) {
+	if tier := s.cfg.Tier(plan); tier != nil {
+		return feeMsats(tier.Amount, tier.Unit), tier.Period, nil
+	}
+	return planPrice(s.cfg.Fees, plan)
+}
+
+// planPrice returns the fee in msats charged for plan and the admission period it
+// buys, 0 meaning admission that never lapses
+func planPrice(fees config.FeeSchedule, plan string) (int64, time.Duration, error) {
+	var fee config.Fee
+	var period time.Duration
+	switch {
+	case plan == PlanAdmission && len(fees.Admission) > 0:
+		fee = fees.Admission[0]
+	case plan == PlanSubscription && len(fees.Subscription) > 0:
+		fee = fees.Subscription[0]
+		period = fee.Period
+	default:
+		return 0, 0, ErrUnknownPlan
+	}
+
+	return feeMsats(fee.Amount, fee.Unit), period, nil
+}
+
+// feeMsats converts a configured fee amount in unit ("msats" or "sats") to msats
+func feeMsats(amount int, unit string) int64 {
+	if unit == "sats" {
+		return int64(amount) * 1000
+	}
+	return int64(amount)
+}
+
+// balancePrice returns what top-up balances are spent on: the first subscription
+// fee, or the first admission fee when no subscription is offered. Without either
+// the balance is left unspent.
+func balancePrice(fees config.FeeSchedule) storage.AdmissionPrice {
+	for _, plan := range []string{PlanSubscription, PlanAdmission} {
+		if feeMsats, period, err := planPrice(fees, plan); err == nil {
+			return storage.AdmissionPrice{Plan: plan, FeeMsats: feeMsats, Period: int64(period.Seconds())}
+		}
+	}
+	return storage.AdmissionPrice{}
+}
+
+// CreateInvoice issues an invoice for pubkey to pay for plan
+func (s *Service) CreateInvoice(ctx context.Context, pubkey, plan string) (*storage.PaymentInvoice, error) {
+	amountMsats, period, err := s.price(plan)
+	if err != nil {
+		return nil, err
+	}
+	expiry := s.cfg.Lightning.InvoiceExpiry
+	if expiry <= 0 {
+		expiry = defaultInvoiceExpiry
+	}
+
+	memo := fmt.Sprintf("Relay %s for %s", plan, pubkey)
+	issued, err := s.backend.CreateInvoice(ctx, amountMsats, memo, expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	inv := &storage.PaymentInvoice{
+		PaymentHash: issued.PaymentHash,
+		PubKey:      pubkey,
+		Plan:        plan,
+		AmountMsats: amountMsats,
+		Period:      int64(period.Seconds()),
+		Bolt11:      issued.Bolt11,
+		CreatedAt:   now.Unix(),
+		ExpiresAt:   now.Add(expiry).Unix(),
+	}
+	if err := s.db.InsertInvoice(ctx, inv); err != nil {
+		return nil, err
+	}
+	logger.Info("Issued invoice",
+		zap.String("payment_hash", inv.PaymentHash),
+		zap.String("pubkey", pubkey),
+		zap.String("plan", plan),
+		zap.Int64("amount_msats", amountMsats))
+	return inv, nil
+}
+
+// Reconcile checks a pending or expired invoice against the backend and, when
+// it settled, credits its pubkey. It returns the invoice in its current state.
+func (s *Service) Reconcile(ctx context.Context, paymentHash string) (*storage.PaymentInvoice, error) {
+	inv, err := s.db.GetInvoice(ctx, paymentHash)
+	if err != nil || (inv.Status != storage.InvoicePending && inv.Status != storage.InvoiceExpired) {
+		return inv, err
+	}
+
+	settled, err := s.backend.InvoiceSettled(ctx, paymentHash)
+	if err != nil || !settled {
+		return inv, err
+	}
+
+	paidAt := time.Now().Unix()
+	credited, pubkey, paidUntil, err := s.db.MarkInvoicePaid(ctx, paymentHash, paidAt)
+	if err != nil {
+		return inv, err
+	}
+	if credited {
+		logger.Info("Invoice paid",
+			zap.String("payment_hash", paymentHash),
+			zap.String("pubkey", pubkey),
+			zap.Int64("paid_until", paidUntil))
+		if s.onPaid != nil {
+			s.onPaid(pubkey, paidUntil, inv.Plan)
+		}
+	}
+	return s.db.GetInvoice(ctx, paymentHash)
+}
+
+// Run polls pending invoices until ctx is done, crediting settled ones and
+// expiring the rest once they can no longer be paid
+func (s *Service) Run(ctx context.Context) {
+	interval := s.cfg.Lightning.PollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.poll(ctx)
+		}
+	}
+}
+
+// poll runs one reconciliation pass over pending invoices
+func (s *Service) poll(ctx context.Context) {
+	now := time.Now().Unix()
+	pending, err := s.db.GetPendingInvoices(ctx, now, pollBatch)
+	if err != nil {
+		logger.Warn("Failed to load pending invoices", zap.Error(err))
+		return
+	}
+	for _, inv := range pending {
+		if _, err := s.Reconcile(ctx, inv.PaymentHash); err != nil {
+			logger.Warn("Failed to reconcile invoice", zap.String("payment_hash", inv.PaymentHash), zap.Error(err))
+		}
+	}
+
+	// Overdue invoices are only expired once the backend says they weren't paid
+	overdue, err := s.db.GetOverdueInvoices(ctx, now, pollBatch)
+	if err != nil {
+		logger.Warn("Failed to load overdue invoices", zap.Error(err))
+		return
+	}
+	var expired int
+	for _, inv := range overdue {
+		reconciled, err := s.Reconcile(ctx, inv.PaymentHash)
+		if err != nil {
+			logger.Warn("Failed to reconcile overdue invoice", zap.String("payment_hash", inv.PaymentHash), zap.Error(err))
+			continue
+		}
+		if reconciled.Status != storage.InvoicePending {
+			continue
+		}
+		if ok, err := s.db.ExpireInvoice(ctx, inv.PaymentHash, now); err != nil {
+			logger.Warn("Failed to expire invoice", zap.String("payment_hash", inv.PaymentHash), zap.Error(err))
+		} else if ok {
+			expired++
+		}
+	}
+	if expired > 0 {
+		logger.Debug("Expired unpaid invoices", zap.Int("count", expired))
+	}
+}
@@ -0,0 +1,229 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/config"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/storage"
+	"go.uber.org/zap"
+)
+
+// Payment webhook event types
+const (
+	WebhookAdmissionGranted = "admission.granted"
+	WebhookBalanceLow       = "balance.low"
+	WebhookTierExpired      = "tier.expired"
+)
+
+const (
+	// webhookInterval is how often due webhooks are delivered
+	webhookInterval = 10 * time.Second
+	// lapseScanInterval is how often admissions are scanned for lapses
+	lapseScanInterval = time.Minute
+	// webhookTimeout bounds one delivery attempt
+	webhookTimeout = 10 * time.Second
+	// webhookBatch bounds the deliveries attempted per interval
+	webhookBatch = 50
+	// webhookMaxAttempts is how many deliveries are tried before a webhook is dropped
+	webhookMaxAttempts = 10
+	// webhookRetryBase is the first retry delay, doubled on every further attempt
+	webhookRetryBase = 30 * time.Second
+	// webhookRetryMax caps the retry delay
+	webhookRetryMax = time.Hour
+	// lapseLookback is how far back lapsed admissions are still reported, so a
+	// relay that was down when they lapsed catches up
+	lapseLookback = 24 * time.Hour
+	// defaultLowWindow is used for balance.low when PAYMENTS.RENEWAL_NOTICE is unset
+	defaultLowWindow = 72 * time.Hour
+)
+
+// WebhookEvent is the JSON body of a payment webhook
+type WebhookEvent struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	CreatedAt int64  `json:"created_at"`
+	PubKey    string `json:"pubkey"`
+	// PaidUntil is the unix time admission lapses, 0 for no expiry
+	PaidUntil int64  `json:"paid_until"`
+	Tier      string `json:"tier,omitempty"`
+}
+
+// WebhookNotifier queues payment events in the database and delivers them to the
+// operator's endpoint, signed with HMAC-SHA256 over "<timestamp>.<body>" in
+// X-Relay-Signature. Deliveries are retried with backoff, and events found by
+// scanning (lapses) are keyed so only one node of a cluster queues them.
+type WebhookNotifier struct {
+	cfg    config.PaymentsConfig
+	db     *storage.DB
+	client *http.Client
+}
+
+// NewWebhookNotifier creates a notifier for cfg.Webhook
+func NewWebhookNotifier(cfg config.PaymentsConfig, db *storage.DB) *WebhookNotifier {
+	return &WebhookNotifier{cfg: cfg, db: db, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+// AdmissionGranted queues an admission.granted webhook for a pubkey that was
+// admitted or had its admission extended
+func (n *WebhookNotifier) AdmissionGranted(ctx context.Context, pubkey string, paidUntil int64, tier string) {
+	ref := make([]byte, 8)
+	if _, err := rand.Read(ref); err != nil {
+		logger.Warn("Failed to generate webhook id", zap.Error(err))
+		return
+	}
+	n.enqueue(ctx, WebhookEvent{
+		ID:        WebhookAdmissionGranted + ":" + pubkey + ":" + hex.EncodeToString(ref),
+		Type:      WebhookAdmissionGranted,
+		PubKey:    pubkey,
+		PaidUntil: paidUntil,
+		Tier:      tier,
+	})
+}
+
+// enqueue stamps and stores evt for delivery
+func (n *WebhookNotifier) enqueue(ctx context.Context, evt WebhookEvent) {
+	evt.CreatedAt = time.Now().Unix()
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		logger.Error("Failed to encode webhook", zap.String("id", evt.ID), zap.Error(err))
+		return
+	}
+	if _, err := n.db.EnqueueWebhook(ctx, storage.WebhookDelivery{
+		ID:        evt.ID,
+		EventType: evt.Type,
+		Payload:   string(payload),
+		CreatedAt: evt.CreatedAt,
+	}); err != nil {
+		logger.Warn("Failed to queue webhook", zap.String("id", evt.ID), zap.Error(err))
+	}
+}
+
+// Run scans for lapsing admissions and delivers queued webhooks until ctx is done
+func (n *WebhookNotifier) Run(ctx context.Context) {
+	deliverTicker := time.NewTicker(webhookInterval)
+	defer deliverTicker.Stop()
+	scanTicker := time.NewTicker(lapseScanInterval)
+	defer scanTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-scanTicker.C:
+			n.scanLapses(ctx)
+		case <-deliverTicker.C:
+			n.deliverDue(ctx)
+		}
+	}
+}
+
+// scanLapses queues balance.low for admissions lapsing within the renewal window
+// and tier.expired for admissions that lapsed. Each is keyed by pubkey and
+// paid_until, so it is queued once per admission period.
+func (n *WebhookNotifier) scanLapses(ctx context.Context) {
+	now := time.Now()
+	window := n.cfg.RenewalNotice
+	if window <= 0 {
+		window = defaultLowWindow
+	}
+
+	scans := []struct {
+		eventType string
+		from, to  time.Time
+	}{
+		{WebhookBalanceLow, now, now.Add(window)},
+		{WebhookTierExpired, now.Add(-lapseLookback), now},
+	}
+	for _, scan := range scans {
+		lapsing, err := n.db.GetLapsingPaidPubkeys(ctx, scan.from.Unix(), scan.to.Unix())
+		if err != nil {
+			logger.Warn("Failed to scan lapsing admissions", zap.String("type", scan.eventType), zap.Error(err))
+			continue
+		}
+		for _, p := range lapsing {
+			n.enqueue(ctx, WebhookEvent{
+				ID:        scan.eventType + ":" + p.PubKey + ":" + strconv.FormatInt(p.PaidUntil, 10),
+				Type:      scan.eventType,
+				PubKey:    p.PubKey,
+				PaidUntil: p.PaidUntil,
+				Tier:      p.Tier,
+			})
+		}
+	}
+}
+
+// deliverDue sends the webhooks whose next attempt is due
+func (n *WebhookNotifier) deliverDue(ctx context.Context) {
+	now := time.Now()
+	due, err := n.db.ClaimDueWebhooks(ctx, now.Unix(), now.Add(webhookTimeout*2).Unix(), webhookBatch)
+	if err != nil {
+		logger.Warn("Failed to load due webhooks", zap.Error(err))
+		return
+	}
+
+	for _, d := range due {
+		if err := n.deliver(ctx, d.Payload); err != nil {
+			attempts := d.Attempts + 1
+			delay := webhookRetryBase << (attempts - 1)
+			if delay > webhookRetryMax || delay <= 0 {
+				delay = webhookRetryMax
+			}
+			failed := attempts >= webhookMaxAttempts
+			logger.Warn("Failed to deliver webhook",
+				zap.String("id", d.ID),
+				zap.Int("attempts", attempts),
+				zap.Bool("dropped", failed),
+				zap.Error(err))
+			if err := n.db.RetryWebhook(ctx, d.ID, time.Now().Add(delay).Unix(), failed); err != nil {
+				logger.Warn("Failed to reschedule webhook", zap.String("id", d.ID), zap.Error(err))
+			}
+			continue
+		}
+		if err := n.db.MarkWebhookDelivered(ctx, d.ID); err != nil {
+			logger.Warn("Failed to mark webhook delivered", zap.String("id", d.ID), zap.Error(err))
+		}
+	}
+}
+
+// deliver POSTs one signed webhook body
+func (n *WebhookNotifier) deliver(ctx context.Context, payload string) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.cfg.Webhook.URL, bytes.NewReader([]byte(payload)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Relay-Timestamp", timestamp)
+	req.Header.Set("X-Relay-Signature", "sha256="+webhookSignature(n.cfg.Webhook.Secret, timestamp, payload))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxBackendResponse))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// webhookSignature returns the hex HMAC-SHA256 of "<timestamp>.<payload>" keyed
+// with secret. Receivers recompute it and reject stale timestamps to stop replays.
+func webhookSignature(secret, timestamp, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,142 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/storage"
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	nostr "github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	// zapProviderTTL is how long the zap provider of a pubkey is remembered,
+	// or the failure to find one
+	zapProviderTTL = 10 * time.Minute
+	// maxZapProviders bounds the zap providers remembered
+	maxZapProviders = 10000
+)
+
+// zapProvider is a remembered lookup
+type zapProvider struct {
+	pubkey  string
+	err     error
+	expires time.Time
+}
+
+// ZapProviders finds who signs the zap receipts of a pubkey: the nostrPubkey of
+// the LNURL-pay document behind the lightning address (lud16, or lud06) of its
+// latest stored profile
+type ZapProviders struct {
+	db     *storage.DB
+	client *http.Client
+
+	mu     sync.Mutex
+	lookup map[string]zapProvider
+}
+
+// NewZapProviders returns a lookup fetching LNURL-pay documents with client,
+// which must refuse internal addresses: profiles name any host
+func NewZapProviders(db *storage.DB, client *http.Client) *ZapProviders {
+	return &ZapProviders{db: db, client: client, lookup: make(map[string]zapProvider)}
+}
+
+// Resolve returns the zap provider of pubkey's profile stored for tenant
+func (z *ZapProviders) Resolve(ctx context.Context, tenant, pubkey string) (string, error) {
+	key := storage.DedupKey(tenant, pubkey)
+	now := time.Now()
+	z.mu.Lock()
+	cached, ok := z.lookup[key]
+	z.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.pubkey, cached.err
+	}
+
+	provider, err := z.fetch(ctx, tenant, pubkey)
+	if ctx.Err() != nil {
+		// Timing out says nothing about the provider
+		return "", err
+	}
+	z.mu.Lock()
+	if len(z.lookup) >= maxZapProviders {
+		for k, p := range z.lookup {
+			if now.After(p.expires) {
+				delete(z.lookup, k)
+			}
+		}
+		if len(z.lookup) >= maxZapProviders {
+			clear(z.lookup)
+		}
+	}
+	z.lookup[key] = zapProvider{pubkey: provider, err: err, expires: now.Add(zapProviderTTL)}
+	z.mu.Unlock()
+	return provider, err
+}
+
+// fetch reads the zap provider from the LNURL-pay document of pubkey's profile
+func (z *ZapProviders) fetch(ctx context.Context, tenant, pubkey string) (string, error) {
+	profiles, err := z.db.GetEvents(ctx, tenant, nostr.Filter{
+		Kinds:   []int{nostr.KindProfileMetadata},
+		Authors: []string{pubkey},
+		Limit:   1,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(profiles) == 0 {
+		return "", fmt.Errorf("no profile stored for %s", pubkey)
+	}
+
+	var metadata struct {
+		LUD16 string `json:"lud16"`
+		LUD06 string `json:"lud06"`
+	}
+	if err := json.Unmarshal([]byte(profiles[0].Content), &metadata); err != nil {
+		return "", fmt.Errorf("invalid profile: %w", err)
+	}
+	url, err := lnurlpURL(strings.TrimSpace(metadata.LUD16), strings.TrimSpace(metadata.LUD06))
+	if err != nil {
+		return "", err
+	}
+	return lnurlpProvider(ctx, z.client, url)
+}
+
+// lnurlpURL returns the LNURL-pay endpoint of a lightning address, or else of
+// a bech32 lnurl
+func lnurlpURL(address, lnurl string) (string, error) {
+	if name, domain, ok := strings.Cut(address, "@"); ok && name != "" && domain != "" {
+		return "https://" + domain + "/.well-known/lnurlp/" + name, nil
+	}
+	if lnurl == "" {
+		return "", fmt.Errorf("profile has no lightning address")
+	}
+	hrp, data, err := bech32.DecodeNoLimit(strings.ToLower(lnurl))
+	if err != nil || hrp != "lnurl" {
+		return "", fmt.Errorf("invalid lnurl")
+	}
+	decoded, err := bech32.ConvertBits(data, 5, 8, false)
+	if err != nil || !strings.HasPrefix(string(decoded), "https://") {
+		return "", fmt.Errorf("invalid lnurl")
+	}
+	return string(decoded), nil
+}
+
+// lnurlpProvider reads nostrPubkey from the LNURL-pay document at url
+func lnurlpProvider(ctx context.Context, client *http.Client, url string) (string, error) {
+	var doc struct {
+		AllowsNostr bool   `json:"allowsNostr"`
+		NostrPubkey string `json:"nostrPubkey"`
+	}
+	if err := doJSON(ctx, client, http.MethodGet, url, nil, nil, &doc); err != nil {
+		return "", err
+	}
+	if !doc.AllowsNostr || !nostr.IsValidPublicKey(doc.NostrPubkey) {
+		return "", fmt.Errorf("lightning address does not support zaps")
+	}
+	return strings.ToLower(doc.NostrPubkey), nil
+}
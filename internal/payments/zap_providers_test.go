@@ -0,0 +1,32 @@
+package payments
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+)
+
+func TestLnurlpURL(t *testing.T) {
+	data, _ := bech32.ConvertBits([]byte("https://pay.example/lnurlp/alice"), 8, 5, true)
+	lnurl, _ := bech32.Encode("lnurl", data)
+	insecure, _ := bech32.ConvertBits([]byte("http://pay.example/lnurlp/alice"), 8, 5, true)
+	insecureLnurl, _ := bech32.Encode("lnurl", insecure)
+
+	tests := []struct {
+		name, address, lnurl, want string
+	}{
+		{"lightning address", "alice@pay.example", "", "https://pay.example/.well-known/lnurlp/alice"},
+		{"lightning address first", "alice@pay.example", lnurl, "https://pay.example/.well-known/lnurlp/alice"},
+		{"lnurl", "", lnurl, "https://pay.example/lnurlp/alice"},
+		{"uppercase lnurl", "", "LNURL" + lnurl[5:], "https://pay.example/lnurlp/alice"},
+		{"plain http lnurl", "", insecureLnurl, ""},
+		{"no address", "", "", ""},
+		{"bare name", "alice", "", ""},
+	}
+	for _, tt := range tests {
+		got, err := lnurlpURL(tt.address, tt.lnurl)
+		if (err != nil) != (tt.want == "") || got != tt.want {
+			t.Errorf("%s: lnurlpURL = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/config"
+	"github.com/Shugur-Network/relay/internal/identity"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/relay/nips"
+	"github.com/Shugur-Network/relay/internal/storage"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+// providerRetryInterval is how often a failed zap provider lookup is retried
+const providerRetryInterval = time.Minute
+
+// ZapCreditor credits zap receipts addressed to the relay to the zapper's ledger
+// balance and spends the balance on admission
+type ZapCreditor struct {
+	cfg    config.ZapConfig
+	fees   config.FeeSchedule
+	db     *storage.DB
+	client *http.Client
+	// onPaid is called with the credited pubkey, its new paid_until and the tier bought
+	onPaid func(pubkey string, paidUntil int64, tier string)
+
+	mu       sync.RWMutex
+	provider string
+}
+
+var _ storage.PaymentEventHandler = (*ZapCreditor)(nil)
+
+// NewZapCreditor creates a zap creditor. The provider pubkey is taken from config
+// or looked up by Run.
+func NewZapCreditor(cfg config.PaymentsConfig, db *storage.DB, onPaid func(pubkey string, paidUntil int64, tier string)) *ZapCreditor {
+	return &ZapCreditor{
+		cfg:      cfg.Zaps,
+		fees:     cfg.Fees,
+		db:       db,
+		client:   &http.Client{Timeout: backendTimeout},
+		onPaid:   onPaid,
+		provider: strings.ToLower(cfg.Zaps.ProviderPubkey),
+	}
+}
+
+// Run looks up the zap provider pubkey of the lightning address, retrying until
+// it succeeds or ctx is done. It returns at once when the pubkey is configured.
+func (z *ZapCreditor) Run(ctx context.Context) {
+	ticker := time.NewTicker(providerRetryInterval)
+	defer ticker.Stop()
+
+	for z.Provider() == "" {
+		provider, err := z.lookupProvider(ctx)
+		if err == nil {
+			z.mu.Lock()
+			z.provider = provider
+			z.mu.Unlock()
+			logger.Info("Resolved zap provider",
+				zap.String("lightning_address", z.cfg.LightningAddress),
+				zap.String("provider_pubkey", provider))
+			return
+		}
+		logger.Warn("Failed to look up zap provider, zaps are not credited yet",
+			zap.String("lightning_address", z.cfg.LightningAddress), zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// lookupProvider reads nostrPubkey from the LNURL-pay document of the lightning address
+func (z *ZapCreditor) lookupProvider(ctx context.Context) (string, error) {
+	name, domain, ok := strings.Cut(z.cfg.LightningAddress, "@")
+	if !ok {
+		return "", fmt.Errorf("invalid lightning address %q", z.cfg.LightningAddress)
+	}
+
+	return lnurlpProvider(ctx, z.client, "https://"+domain+"/.well-known/lnurlp/"+name)
+}
+
+// Provider returns the pubkey that signs the relay's zap receipts, "" until known
+func (z *ZapCreditor) Provider() string {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	return z.provider
+}
+
+// IsReceipt reports whether evt is a zap receipt for the relay signed by its zap provider
+func (z *ZapCreditor) IsReceipt(evt *nostr.Event) bool {
+	if evt.Kind != nostr.KindZap || evt.PubKey != z.Provider() {
+		return false
+	}
+	signer, err := identity.ActiveSigner()
+	if err != nil {
+		return false
+	}
+	recipient := evt.Tags.GetFirst([]string{"p", ""})
+	return recipient != nil && (*recipient)[1] == signer.PublicKey()
+}
+
+// HandlePaymentEvent credits a stored zap receipt to the zapper's balance
+func (z *ZapCreditor) HandlePaymentEvent(ctx context.Context, evt nostr.Event) {
+	if !z.IsReceipt(&evt) {
+		return
+	}
+	receipt, err := nips.ParseZapReceipt(&evt)
+	if err != nil {
+		logger.Warn("Ignoring invalid zap receipt", zap.String("event_id", evt.ID), zap.Error(err))
+		return
+	}
+
+	creditCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	price := balancePrice(z.fees)
+	result, err := z.db.CreditLedger(creditCtx, storage.LedgerEntry{
+		EntryType:   storage.LedgerZap,
+		Reference:   evt.ID,
+		PubKey:      strings.ToLower(receipt.Sender),
+		AmountMsats: receipt.AmountMsats,
+		CreatedAt:   time.Now().Unix(),
+	}, price)
+	if err != nil {
+		logger.Error("Failed to credit zap", zap.String("event_id", evt.ID), zap.Error(err))
+		return
+	}
+	if !result.Credited {
+		return
+	}
+
+	logger.Info("Credited zap",
+		zap.String("event_id", evt.ID),
+		zap.String("pubkey", receipt.Sender),
+		zap.Int64("amount_msats", receipt.AmountMsats),
+		zap.Int64("spent_msats", result.Spent))
+	if result.Spent > 0 && z.onPaid != nil {
+		z.onPaid(strings.ToLower(receipt.Sender), result.PaidUntil, price.Plan)
+	}
+}
@@ -0,0 +1,468 @@
+// Package rebroadcast republishes stored events to other relays, to seed a
+// backup relay or move a community to another relay. A job pages through the
+// events matching a filter, newest first, and publishes each to every target
+// relay at a bounded rate, counting the OK each relay answers with.
+package rebroadcast
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/metrics"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// DefaultRate is the events per second published to each relay when a job
+	// doesn't set its rate
+	DefaultRate = 10
+	// MaxRate bounds the events per second a job publishes to each relay
+	MaxRate = 1000
+	// MaxRelays bounds the relays a job publishes to
+	MaxRelays = 20
+	// pageSize is how many stored events are read at a time
+	pageSize = 500
+	// publishTimeout bounds connecting to a relay and waiting for its OK
+	publishTimeout = 10 * time.Second
+	// maxFailures is how many events in a row may fail on a relay before the job
+	// gives up on it
+	maxFailures = 10
+	// maxKept is how many jobs, running or finished, are listed
+	maxKept = 100
+)
+
+// Job statuses
+const (
+	StatusRunning  = "running"
+	StatusDone     = "done"
+	StatusCanceled = "canceled"
+	StatusFailed   = "failed"
+)
+
+var (
+	// ErrNoRelays is returned for a job that names no target relay
+	ErrNoRelays = errors.New("rebroadcast needs at least one relay")
+	// ErrTooManyRelays is returned for a job naming more than MaxRelays relays
+	ErrTooManyRelays = fmt.Errorf("rebroadcast takes at most %d relays", MaxRelays)
+	// ErrInvalidRate is returned for a rate outside 0 to MaxRate
+	ErrInvalidRate = fmt.Errorf("rate must be between 0 and %d events per second", MaxRate)
+)
+
+// Query returns the stored events of tenant matching filter, as the storage
+// layer answers REQs
+type Query func(ctx context.Context, tenant string, filter nostr.Filter) ([]nostr.Event, error)
+
+// Request describes a job
+type Request struct {
+	// Tenant is the virtual relay whose events are read, the main relay when empty
+	Tenant string       `json:"tenant,omitempty"`
+	Filter nostr.Filter `json:"filter"`
+	// Relays are the websocket URLs of the relays to publish to
+	Relays []string `json:"relays"`
+	// Rate is the events per second published to each relay, DefaultRate when 0
+	Rate float64 `json:"rate,omitempty"`
+}
+
+// Validate checks the relays and rate of r, filling in the default rate
+func (r *Request) Validate() error {
+	if len(r.Relays) == 0 {
+		return ErrNoRelays
+	}
+	if len(r.Relays) > MaxRelays {
+		return ErrTooManyRelays
+	}
+	seen := make(map[string]struct{}, len(r.Relays))
+	for i, relay := range r.Relays {
+		relay = nostr.NormalizeURL(relay)
+		u, err := url.Parse(relay)
+		if err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+			return fmt.Errorf("invalid relay URL %q", r.Relays[i])
+		}
+		if _, dup := seen[relay]; dup {
+			return fmt.Errorf("relay %q is listed twice", r.Relays[i])
+		}
+		seen[relay] = struct{}{}
+		r.Relays[i] = relay
+	}
+	if r.Rate < 0 || r.Rate > MaxRate {
+		return ErrInvalidRate
+	}
+	if r.Rate == 0 {
+		r.Rate = DefaultRate
+	}
+	return nil
+}
+
+// RelayResult counts the OKs a relay answered a job's events with. Relays that
+// accept a duplicate with a true OK count it as accepted.
+type RelayResult struct {
+	Accepted  int64 `json:"accepted"`
+	Duplicate int64 `json:"duplicate"`
+	Rejected  int64 `json:"rejected"`
+	// Failed counts events that got no OK: the relay couldn't be reached, didn't
+	// answer in time or was given up on
+	Failed    int64  `json:"failed"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Info describes a job
+type Info struct {
+	ID string `json:"id"`
+	Request
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// Events is the number of stored events read so far
+	Events  int64                   `json:"events"`
+	Results map[string]*RelayResult `json:"results"`
+}
+
+// job is a running or finished job
+type job struct {
+	mu     sync.Mutex
+	info   Info
+	cancel context.CancelFunc
+}
+
+// snapshot returns what describes j
+func (j *job) snapshot() Info {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	info := j.info
+	info.Results = make(map[string]*RelayResult, len(j.info.Results))
+	for relay, result := range j.info.Results {
+		copied := *result
+		info.Results[relay] = &copied
+	}
+	return info
+}
+
+// Manager runs the rebroadcast jobs of this node
+type Manager struct {
+	// ctx ends the running jobs when the node stops
+	ctx   context.Context
+	query Query
+	mu    sync.Mutex
+	jobs  map[string]*job
+}
+
+// NewManager returns a manager reading stored events through query, whose jobs
+// run until ctx is done
+func NewManager(ctx context.Context, query Query) *Manager {
+	return &Manager{ctx: ctx, query: query, jobs: make(map[string]*job)}
+}
+
+// Start validates req and runs it as a job in the background until it is done
+// or canceled
+func (m *Manager) Start(req Request) (Info, error) {
+	if err := req.Validate(); err != nil {
+		return Info{}, err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Info{}, fmt.Errorf("failed to generate rebroadcast ID: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	j := &job{
+		info: Info{
+			ID:        hex.EncodeToString(id),
+			Request:   req,
+			Status:    StatusRunning,
+			StartedAt: time.Now().UTC(),
+			Results:   make(map[string]*RelayResult, len(req.Relays)),
+		},
+		cancel: cancel,
+	}
+	for _, relay := range req.Relays {
+		j.info.Results[relay] = &RelayResult{}
+	}
+
+	m.mu.Lock()
+	m.jobs[j.info.ID] = j
+	m.prune()
+	m.mu.Unlock()
+
+	info := j.snapshot()
+	go m.run(ctx, j)
+	return info, nil
+}
+
+// Cancel stops the job with id
+func (m *Manager) Cancel(id string) (Info, bool) {
+	m.mu.Lock()
+	j, ok := m.jobs[id]
+	m.mu.Unlock()
+	if !ok {
+		return Info{}, false
+	}
+	j.mu.Lock()
+	if j.info.Status == StatusRunning {
+		j.info.Status = StatusCanceled
+	}
+	j.mu.Unlock()
+	j.cancel()
+	return j.snapshot(), true
+}
+
+// Get returns the job with id
+func (m *Manager) Get(id string) (Info, bool) {
+	m.mu.Lock()
+	j, ok := m.jobs[id]
+	m.mu.Unlock()
+	if !ok {
+		return Info{}, false
+	}
+	return j.snapshot(), true
+}
+
+// List returns the jobs, newest first
+func (m *Manager) List() []Info {
+	m.mu.Lock()
+	infos := make([]Info, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		infos = append(infos, j.snapshot())
+	}
+	m.mu.Unlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].StartedAt.After(infos[j].StartedAt) })
+	return infos
+}
+
+// prune forgets the oldest finished jobs past maxKept; m.mu must be held
+func (m *Manager) prune() {
+	if len(m.jobs) <= maxKept {
+		return
+	}
+	finished := make([]Info, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		if info := j.snapshot(); info.Status != StatusRunning {
+			finished = append(finished, info)
+		}
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].StartedAt.Before(finished[j].StartedAt) })
+	for _, info := range finished {
+		if len(m.jobs) <= maxKept {
+			return
+		}
+		delete(m.jobs, info.ID)
+	}
+}
+
+// run reads the job's events and hands them to a publisher per relay, then
+// records how the job ended
+func (m *Manager) run(ctx context.Context, j *job) {
+	defer j.cancel()
+	req := j.info.Request
+
+	var wg sync.WaitGroup
+	queues := make([]chan nostr.Event, len(req.Relays))
+	for i, relay := range req.Relays {
+		queues[i] = make(chan nostr.Event, pageSize)
+		p := &publisher{job: j, url: relay, limiter: rate.NewLimiter(rate.Limit(req.Rate), 1)}
+		wg.Add(1)
+		go func(events <-chan nostr.Event) {
+			defer wg.Done()
+			p.run(ctx, events)
+		}(queues[i])
+	}
+
+	err := m.read(ctx, req, func(evt nostr.Event) bool {
+		j.mu.Lock()
+		j.info.Events++
+		j.mu.Unlock()
+		for _, queue := range queues {
+			select {
+			case queue <- evt:
+			case <-ctx.Done():
+				return false
+			}
+		}
+		return true
+	})
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now().UTC()
+	j.info.FinishedAt = &now
+	switch {
+	case j.info.Status != StatusRunning:
+	case err != nil && ctx.Err() == nil:
+		j.info.Status = StatusFailed
+		j.info.Error = err.Error()
+	case ctx.Err() != nil:
+		j.info.Status = StatusCanceled
+	default:
+		j.info.Status = StatusDone
+	}
+}
+
+// read passes the stored events matching req.Filter to emit, newest first, until
+// emit returns false. A filter limit bounds the events read in all.
+func (m *Manager) read(ctx context.Context, req Request, emit func(nostr.Event) bool) error {
+	total := req.Filter.Limit
+	until := req.Filter.Until
+	// seen holds the IDs of the events read at boundary, the created_at the next
+	// page is read up to, so those events aren't read twice
+	seen := make(map[string]struct{})
+	var boundary nostr.Timestamp
+	read := 0
+
+	for {
+		page := req.Filter
+		page.Until = until
+		page.Limit = pageSize
+		events, err := m.query(ctx, req.Tenant, page)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		fresh := 0
+		for i := len(events) - 1; i >= 0; i-- {
+			if _, ok := seen[events[i].ID]; ok {
+				continue
+			}
+			fresh++
+			if !emit(events[i]) {
+				return ctx.Err()
+			}
+			read++
+			if total > 0 && read >= total {
+				return nil
+			}
+		}
+
+		oldest := events[0].CreatedAt
+		if fresh == 0 {
+			// A whole page shares one created_at; the events of that second past
+			// the page can't be told apart, so the job moves on to older ones
+			oldest--
+		}
+		if oldest != boundary {
+			seen = make(map[string]struct{})
+			boundary = oldest
+		}
+		for _, evt := range events {
+			if evt.CreatedAt == oldest {
+				seen[evt.ID] = struct{}{}
+			}
+		}
+		until = &oldest
+	}
+}
+
+// publisher publishes a job's events to one relay
+type publisher struct {
+	job      *job
+	url      string
+	limiter  *rate.Limiter
+	relay    *nostr.Relay
+	failures int
+}
+
+// run publishes the events from events until they run out or ctx is done, then
+// closes the connection. Once the relay fails maxFailures events in a row the
+// remaining events are counted as failed without being sent.
+func (p *publisher) run(ctx context.Context, events <-chan nostr.Event) {
+	defer func() {
+		if p.relay != nil {
+			_ = p.relay.Close()
+		}
+	}()
+
+	for evt := range events {
+		if ctx.Err() != nil {
+			continue
+		}
+		if p.failures >= maxFailures {
+			p.record("failed", "")
+			continue
+		}
+		if err := p.limiter.Wait(ctx); err != nil {
+			continue
+		}
+		result, reason := p.publish(ctx, evt)
+		if result == "failed" {
+			p.failures++
+			if p.failures == maxFailures {
+				reason = fmt.Sprintf("gave up after %d failures in a row: %s", maxFailures, reason)
+			}
+		} else {
+			p.failures = 0
+		}
+		p.record(result, reason)
+	}
+}
+
+// publish sends evt, connecting first when needed, and returns how the relay
+// answered: "accepted", "duplicate", "rejected" or "failed", with the reason of
+// the last two
+func (p *publisher) publish(ctx context.Context, evt nostr.Event) (string, string) {
+	ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+
+	if p.relay == nil || !p.relay.IsConnected() {
+		if p.relay != nil {
+			_ = p.relay.Close()
+			p.relay = nil
+		}
+		relay, err := nostr.RelayConnect(ctx, p.url)
+		if err != nil {
+			return "failed", err.Error()
+		}
+		p.relay = relay
+	}
+
+	err := p.relay.Publish(ctx, evt)
+	switch {
+	case err == nil:
+		return "accepted", ""
+	case strings.HasPrefix(err.Error(), "msg: "):
+		// go-nostr reports a false OK as "msg: <reason>"
+		reason := strings.TrimPrefix(err.Error(), "msg: ")
+		if strings.HasPrefix(reason, "duplicate:") {
+			return "duplicate", ""
+		}
+		return "rejected", reason
+	default:
+		return "failed", err.Error()
+	}
+}
+
+// record counts an event published with result
+func (p *publisher) record(result, reason string) {
+	metrics.RebroadcastEvents.WithLabelValues(result).Inc()
+	p.job.mu.Lock()
+	defer p.job.mu.Unlock()
+	r := p.job.info.Results[p.url]
+	switch result {
+	case "accepted":
+		r.Accepted++
+	case "duplicate":
+		r.Duplicate++
+	case "rejected":
+		r.Rejected++
+	default:
+		r.Failed++
+	}
+	if reason != "" {
+		r.LastError = reason
+	}
+}
@@ -0,0 +1,257 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/identity"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/selftest"
+	"github.com/Shugur-Network/relay/internal/storage"
+	"github.com/Shugur-Network/relay/internal/web"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+// KindPinnedNotes is the NIP-51 pinned notes list kind
+const KindPinnedNotes = 10001
+
+// announcementBroadcastTimeout bounds publishing an announcement to one peer relay
+const announcementBroadcastTimeout = 10 * time.Second
+
+// announcementRequest is the body accepted by POST /api/admin/announcements
+type announcementRequest struct {
+	Content   string     `json:"content"`
+	Tags      nostr.Tags `json:"tags,omitempty"`
+	Pinned    bool       `json:"pinned"`
+	Broadcast bool       `json:"broadcast"`
+}
+
+// announcementResponse reports the published announcement and broadcast results
+type announcementResponse struct {
+	Event     *nostr.Event      `json:"event"`
+	Pinned    bool              `json:"pinned"`
+	Broadcast map[string]string `json:"broadcast,omitempty"`
+}
+
+// handleAdmin routes authenticated admin API requests
+func (s *Server) handleAdmin(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/admin/")
+	switch {
+	case path == "announcements":
+		s.handleAdminAnnouncements(w, r)
+	case path == "paid":
+		s.handleAdminPaid(w, r)
+	case strings.HasPrefix(path, "paid/"):
+		s.handleAdminPaidPubkey(w, r, strings.TrimPrefix(path, "paid/"))
+	case path == "invites":
+		s.handleAdminInvites(w, r)
+	case strings.HasPrefix(path, "invites/"):
+		s.handleAdminInvite(w, r, strings.TrimPrefix(path, "invites/"))
+	case path == "report":
+		s.handleAdminReport(w, r)
+	case path == "suspensions":
+		s.handleAdminSuspensions(w, r)
+	case strings.HasPrefix(path, "suspensions/"):
+		s.handleAdminSuspension(w, r, strings.TrimPrefix(path, "suspensions/"))
+	case path == "reports":
+		s.handleAdminReports(w, r)
+	case strings.HasPrefix(path, "reports/"):
+		s.handleAdminReportTarget(w, r, strings.TrimPrefix(path, "reports/"))
+	case path == "revalidation":
+		s.handleAdminRevalidation(w, r)
+	case path == "quarantine":
+		s.handleAdminQuarantine(w, r)
+	case path == "decisions":
+		s.handleAdminDecisions(w, r)
+	case path == "tenants":
+		s.handleAdminTenants(w, r)
+	case strings.HasPrefix(path, "tenants/"):
+		s.handleAdminTenant(w, r, strings.TrimPrefix(path, "tenants/"))
+	case path == "tenant-usage":
+		s.handleAdminTenantUsage(w, r)
+	case path == "blocklist-feeds":
+		s.handleAdminBlocklistFeeds(w, r)
+	case path == "captures":
+		s.handleAdminCaptures(w, r)
+	case strings.HasPrefix(path, "captures/"):
+		s.handleAdminCapture(w, r, strings.TrimPrefix(path, "captures/"))
+	case path == "sessions":
+		s.handleAdminSessions(w, r)
+	case strings.HasPrefix(path, "sessions/"):
+		s.handleAdminSession(w, r, strings.TrimPrefix(path, "sessions/"))
+	case path == "query-analytics":
+		s.handleAdminQueryAnalytics(w, r)
+	case path == "rebroadcasts":
+		s.handleAdminRebroadcasts(w, r)
+	case path == "selftest":
+		s.handleAdminSelfTest(w, r)
+	case strings.HasPrefix(path, "rebroadcasts/"):
+		s.handleAdminRebroadcast(w, r, strings.TrimPrefix(path, "rebroadcasts/"))
+	default:
+		web.WriteAdminError(w, http.StatusNotFound, "unknown admin endpoint")
+	}
+}
+
+// handleAdminSelfTest reports (GET) the startup self-test, answering 503 with a
+// pending status until it ran
+func (s *Server) handleAdminSelfTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	report := selftest.Latest()
+	if report == nil {
+		web.WriteAdminJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "pending"})
+		return
+	}
+	web.WriteAdminJSON(w, http.StatusOK, report)
+}
+
+// handleAdminAnnouncements lists (GET) or publishes (POST) relay-authored announcements
+func (s *Server) handleAdminAnnouncements(w http.ResponseWriter, r *http.Request) {
+	signer, err := identity.ActiveSigner()
+	if err != nil {
+		web.WriteAdminError(w, http.StatusServiceUnavailable, "relay identity is not available for signing")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		limit := 50
+		if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 && v <= 500 {
+			limit = v
+		}
+		events, err := s.node.DB().GetEvents(r.Context(), storage.DefaultTenant, nostr.Filter{
+			Kinds:   []int{nostr.KindTextNote},
+			Authors: []string{signer.PublicKey()},
+			Limit:   limit,
+		})
+		if err != nil {
+			web.WriteAdminError(w, http.StatusInternalServerError, "failed to load announcements")
+			return
+		}
+		web.WriteAdminJSON(w, http.StatusOK, events)
+
+	case http.MethodPost:
+		var req announcementRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			web.WriteAdminError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		if strings.TrimSpace(req.Content) == "" {
+			web.WriteAdminError(w, http.StatusBadRequest, "content is required")
+			return
+		}
+
+		evt := nostr.Event{
+			Kind:      nostr.KindTextNote,
+			CreatedAt: nostr.Now(),
+			Tags:      req.Tags,
+			Content:   req.Content,
+		}
+		if evt.Tags == nil {
+			evt.Tags = nostr.Tags{}
+		}
+		if err := s.publishRelayEvent(r.Context(), signer, &evt); err != nil {
+			web.WriteAdminError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		resp := announcementResponse{Event: &evt}
+		if req.Pinned {
+			if err := s.pinRelayNote(r.Context(), signer, evt.ID); err != nil {
+				logger.Warn("Failed to pin announcement", zap.String("event_id", evt.ID), zap.Error(err))
+			} else {
+				resp.Pinned = true
+			}
+		}
+		if req.Broadcast {
+			resp.Broadcast = s.broadcastToPeers(r.Context(), evt)
+		}
+
+		logger.Info("Published relay announcement",
+			zap.String("event_id", evt.ID),
+			zap.Bool("pinned", resp.Pinned),
+			zap.Int("broadcast_targets", len(resp.Broadcast)))
+		web.WriteAdminJSON(w, http.StatusCreated, resp)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// publishRelayEvent signs evt with the relay identity and stores it locally
+func (s *Server) publishRelayEvent(ctx context.Context, signer identity.Signer, evt *nostr.Event) error {
+	if err := signer.SignEvent(ctx, evt); err != nil {
+		return err
+	}
+	if valid, msg := s.node.GetValidator().ValidateEvent(ctx, storage.DefaultTenant, *evt); !valid {
+		return fmt.Errorf("event rejected by relay policy: %s", msg)
+	}
+	if !s.node.GetEventProcessor().QueueEvent(storage.DefaultTenant, *evt) {
+		return fmt.Errorf("event queue is full, try again")
+	}
+	return nil
+}
+
+// pinRelayNote adds eventID to the relay's NIP-51 pinned notes list. Updates
+// are serialized and stored before returning, so concurrent pins each build on
+// the list the previous one stored.
+func (s *Server) pinRelayNote(ctx context.Context, signer identity.Signer, eventID string) error {
+	s.pinMu.Lock()
+	defer s.pinMu.Unlock()
+
+	tags := nostr.Tags{}
+	createdAt := nostr.Now()
+	if existing, err := s.node.DB().GetReplaceableEvent(ctx, storage.DefaultTenant, signer.PublicKey(), KindPinnedNotes); err == nil {
+		tags = existing.Tags
+		// A list no newer than the stored one would be dropped as stale
+		if existing.CreatedAt >= createdAt {
+			createdAt = existing.CreatedAt + 1
+		}
+	}
+	tags = tags.AppendUnique(nostr.Tag{"e", eventID})
+
+	list := nostr.Event{
+		Kind:      KindPinnedNotes,
+		CreatedAt: createdAt,
+		Tags:      tags,
+	}
+	if err := signer.SignEvent(ctx, &list); err != nil {
+		return err
+	}
+	if valid, msg := s.node.GetValidator().ValidateEvent(ctx, storage.DefaultTenant, list); !valid {
+		return fmt.Errorf("event rejected by relay policy: %s", msg)
+	}
+	return s.node.GetEventProcessor().StoreEventSync(ctx, storage.DefaultTenant, list)
+}
+
+// broadcastToPeers publishes evt to the configured announce relays and reports the outcome per relay
+func (s *Server) broadcastToPeers(ctx context.Context, evt nostr.Event) map[string]string {
+	results := make(map[string]string, len(s.fullCfg.Admin.AnnounceRelays))
+	for _, url := range s.fullCfg.Admin.AnnounceRelays {
+		pubCtx, cancel := context.WithTimeout(ctx, announcementBroadcastTimeout)
+		peer, err := nostr.RelayConnect(pubCtx, url)
+		if err != nil {
+			results[url] = "connect failed: " + err.Error()
+			cancel()
+			continue
+		}
+		if err := peer.Publish(pubCtx, evt); err != nil {
+			results[url] = "publish failed: " + err.Error()
+		} else {
+			results[url] = "ok"
+		}
+		_ = peer.Close()
+		cancel()
+	}
+	return results
+}
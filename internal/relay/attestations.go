@@ -0,0 +1,123 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Shugur-Network/relay/internal/identity"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/storage"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+// KindStorageAttestation is the NIP-78 application data kind used for storage attestations
+const KindStorageAttestation = 30078
+
+// attestationContent is the JSON content of a storage attestation event
+type attestationContent struct {
+	EventID    string `json:"event_id"`
+	ReceivedAt int64  `json:"received_at"`
+	Relay      string `json:"relay,omitempty"`
+}
+
+// handleAttestation serves GET /api/attestations/<event id>: an event signed by the
+// relay identity stating when the relay accepted the given event on the tenant
+// the request came in through. It is signed on the first request and stored
+// with the receipt, so later requests are served the stored copy without
+// reaching the signer again.
+func (s *Server) handleAttestation(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.fullCfg.Identity.Attestations {
+		http.NotFound(w, r)
+		return
+	}
+
+	eventID := strings.TrimPrefix(r.URL.Path, "/api/attestations/")
+	tenant := requestTenantID(r)
+	receipt, err := s.node.DB().GetEventReceipt(r.Context(), tenant, eventID)
+	if errors.Is(err, storage.ErrReceiptNotFound) {
+		http.Error(w, "No attestation for this event", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to load event receipt", zap.String("event_id", eventID), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if receipt.Attestation != nil {
+		writeAttestation(w, receipt.Attestation)
+		return
+	}
+	receivedAt := receipt.ReceivedAt
+
+	signer, err := identity.ActiveSigner()
+	if err != nil {
+		http.Error(w, "Relay identity is not available for signing", http.StatusServiceUnavailable)
+		return
+	}
+
+	content, err := json.Marshal(attestationContent{
+		EventID:    eventID,
+		ReceivedAt: receivedAt,
+		Relay:      s.fullCfg.Relay.PublicURL,
+	})
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// created_at is the receive time so repeated requests attest to the same event ID
+	att := nostr.Event{
+		Kind:      KindStorageAttestation,
+		CreatedAt: nostr.Timestamp(receivedAt),
+		Tags: nostr.Tags{
+			{"d", "attestation:" + eventID},
+			{"e", eventID},
+			{"received_at", fmt.Sprintf("%d", receivedAt)},
+		},
+		Content: string(content),
+	}
+	if err := signer.SignEvent(r.Context(), &att); err != nil {
+		logger.Error("Failed to sign attestation", zap.String("event_id", eventID), zap.Error(err))
+		http.Error(w, "Failed to sign attestation", http.StatusServiceUnavailable)
+		return
+	}
+
+	signed, err := json.Marshal(att)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	stored, err := s.node.DB().StoreEventAttestation(r.Context(), tenant, eventID, signed)
+	if errors.Is(err, storage.ErrReceiptNotFound) {
+		// The event was deleted while its attestation was being signed
+		http.Error(w, "No attestation for this event", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		// Serve the signed copy anyway; the next request signs again
+		logger.Warn("Failed to store attestation", zap.String("event_id", eventID), zap.Error(err))
+		stored = signed
+	}
+	writeAttestation(w, stored)
+}
+
+// writeAttestation writes a signed attestation event
+func writeAttestation(w http.ResponseWriter, att []byte) {
+	if _, err := w.Write(append(att, '\n')); err != nil {
+		logger.Error("Failed to write attestation", zap.Error(err))
+	}
+}
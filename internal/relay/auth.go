@@ -0,0 +1,396 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/config"
+	"github.com/Shugur-Network/relay/internal/constants"
+	"github.com/Shugur-Network/relay/internal/limiter"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/relay/nips"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// sendAuthChallenge sends the NIP-42 ["AUTH", <challenge>] message to the client
+func (c *WsConnection) sendAuthChallenge() {
+	c.sendMessage("AUTH", c.authChallenge)
+}
+
+// handleAuth processes ["AUTH", <signed event>] commands (NIP-42)
+func (c *WsConnection) handleAuth(arr []interface{}) {
+	if len(arr) < 2 {
+		c.sendNotice("invalid: AUTH message missing event")
+		return
+	}
+
+	eventData, err := json.Marshal(arr[1])
+	if err != nil {
+		c.sendNotice("invalid: " + err.Error())
+		return
+	}
+
+	var evt nostr.Event
+	if err := json.Unmarshal(eventData, &evt); err != nil {
+		c.sendNotice("invalid: " + err.Error())
+		return
+	}
+
+	if err := nips.ValidateAuthEvent(&evt, c.authChallenge, c.authRelayURL()); err != nil {
+		logger.Debug("AUTH rejected",
+			zap.String("client", c.RemoteAddr()),
+			zap.String("pubkey", evt.PubKey),
+			zap.Error(err))
+		c.sendOK(evt.ID, false, nips.FormatErrorMessage(nips.ErrorCodeRestricted, err.Error()))
+		return
+	}
+
+	c.authMu.Lock()
+	c.authedPubkey = evt.PubKey
+	c.authMu.Unlock()
+
+	c.applyRateLimitProfile(c.node.ClassifyClient(evt.PubKey))
+	c.bindSession(evt.PubKey)
+	c.sendMOTD(time.Now())
+
+	logger.Debug("Client authenticated",
+		zap.String("client", c.RemoteAddr()),
+		zap.String("pubkey", evt.PubKey),
+		zap.String("session_id", c.SessionID()),
+		zap.String("class", string(c.ClientClass())))
+
+	c.sendOK(evt.ID, true, "")
+}
+
+// isAuthGatedKind reports whether events of kind are only delivered to their
+// authenticated author or recipients
+func (c *WsConnection) isAuthGatedKind(kind int) bool {
+	return authGatedKind(c.node.Config(), kind)
+}
+
+// authGatedKind reports whether cfg restricts events of kind to their
+// authenticated author or recipients (RELAY.AUTH_DMS, CAPSULES.AUTH_PRIVATE)
+func authGatedKind(cfg *config.Config, kind int) bool {
+	if cfg.Relay.AuthDMs {
+		switch kind {
+		case nostr.KindEncryptedDirectMessage, nostr.KindDirectMessage, nostr.KindGiftWrap:
+			return true
+		}
+	}
+	capsules := cfg.Capsules
+	if !capsules.Enabled || !capsules.AuthPrivate {
+		return false
+	}
+	return kind == nostr.KindGiftWrap || kind == constants.KindShareDistribution
+}
+
+// canReceive reports whether evt may be delivered on this connection. Direct
+// messages, private capsule gift wraps and share distributions carry encrypted
+// payloads for specific pubkeys, so they only go to a client authenticated as the
+// author or a p-tagged recipient/witness.
+func (c *WsConnection) canReceive(evt *nostr.Event) bool {
+	if !c.canReadKind(evt.Kind) {
+		return false
+	}
+	if !c.isAuthGatedKind(evt.Kind) {
+		return true
+	}
+	pubkey := c.AuthedPubkey()
+	if pubkey == "" {
+		return false
+	}
+	if evt.PubKey == pubkey {
+		return true
+	}
+	for _, tag := range evt.Tags {
+		if len(tag) >= 2 && tag[0] == constants.TagP && tag[1] == pubkey {
+			return true
+		}
+	}
+	return false
+}
+
+// CanReceive implements domain.WebSocketConnection
+func (c *WsConnection) CanReceive(evt *nostr.Event) bool {
+	return c.canReceive(evt)
+}
+
+// requiresAuth reports whether a filter only asks for auth-gated kinds while the
+// client hasn't authenticated, so the REQ can be answered with auth-required
+func (c *WsConnection) requiresAuth(f nostr.Filter) bool {
+	if len(f.Kinds) == 0 || c.AuthedPubkey() != "" {
+		return false
+	}
+	for _, kind := range f.Kinds {
+		if !c.isAuthGatedKind(kind) {
+			return false
+		}
+	}
+	return true
+}
+
+// isForeignPrivateQuery reports whether an authenticated client asks only for
+// auth-gated kinds without restricting the filter to its own pubkey as author or
+// p-tagged recipient, so the REQ can be answered with restricted
+func (c *WsConnection) isForeignPrivateQuery(f nostr.Filter) bool {
+	pubkey := c.AuthedPubkey()
+	if len(f.Kinds) == 0 || pubkey == "" {
+		return false
+	}
+	for _, kind := range f.Kinds {
+		if !c.isAuthGatedKind(kind) {
+			return false
+		}
+	}
+	return !isOwnFilter(f, pubkey)
+}
+
+// isOwnFilter reports whether f is restricted to pubkey as author or p-tagged
+// recipient
+func isOwnFilter(f nostr.Filter, pubkey string) bool {
+	if len(f.Authors) == 1 && f.Authors[0] == pubkey {
+		return true
+	}
+	recipients := f.Tags[constants.TagP]
+	return len(recipients) == 1 && recipients[0] == pubkey
+}
+
+// privateCountDenial returns the machine-readable rejection for a COUNT filter
+// asking for any auth-gated kind, or "" when it may be counted. Counts can't
+// leave out the events the client may not receive, so unlike REQ a single
+// auth-gated kind requires the filter to be restricted to the client's own pubkey.
+func (c *WsConnection) privateCountDenial(f nostr.Filter) string {
+	gated := false
+	for _, kind := range f.Kinds {
+		if c.isAuthGatedKind(kind) {
+			gated = true
+			break
+		}
+	}
+	if !gated {
+		return ""
+	}
+	pubkey := c.AuthedPubkey()
+	if pubkey == "" {
+		return nips.FormatErrorMessage(nips.ErrorCodeAuthRequired, "authenticate to count private messages")
+	}
+	if !isOwnFilter(f, pubkey) {
+		return nips.FormatErrorMessage(nips.ErrorCodeRestricted, "private messages are only counted for their author or recipient")
+	}
+	return ""
+}
+
+// authGatedKinds returns the kinds only delivered to their authenticated author
+// or recipients, for counts of any kind to leave out
+func (c *WsConnection) authGatedKinds() []int {
+	var kinds []int
+	for _, kind := range []int{nostr.KindEncryptedDirectMessage, nostr.KindDirectMessage, nostr.KindGiftWrap, constants.KindShareDistribution} {
+		if c.isAuthGatedKind(kind) {
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds
+}
+
+// canReadKind reports whether the client may query events of kind under
+// RELAY_POLICY.READ_RESTRICTED
+func (c *WsConnection) canReadKind(kind int) bool {
+	switch c.node.Config().RelayPolicy.ReadAccess(kind) {
+	case "authenticated":
+		return c.AuthedPubkey() != ""
+	case "whitelisted":
+		return c.isMember(c.AuthedPubkey())
+	default:
+		return true
+	}
+}
+
+// unreadableKinds returns the kinds under RELAY_POLICY.READ_RESTRICTED the
+// client may not query
+func (c *WsConnection) unreadableKinds() []int {
+	var kinds []int
+	for _, r := range c.node.Config().RelayPolicy.ReadRestricted {
+		for _, kind := range r.Kinds {
+			if !c.canReadKind(kind) {
+				kinds = append(kinds, kind)
+			}
+		}
+	}
+	return kinds
+}
+
+// kindReadDenial returns the machine-readable rejection for a filter asking for
+// kinds the client may not query, or "" when it may query them. With all set,
+// every kind asked for must be denied, as the events of the others are still
+// delivered; otherwise any one denied kind rejects the filter.
+func (c *WsConnection) kindReadDenial(f nostr.Filter, all bool) string {
+	denied := 0
+	for _, kind := range f.Kinds {
+		if !c.canReadKind(kind) {
+			denied++
+		}
+	}
+	if denied == 0 || (all && denied < len(f.Kinds)) {
+		return ""
+	}
+	if c.AuthedPubkey() == "" {
+		return nips.FormatErrorMessage(nips.ErrorCodeAuthRequired, "authenticate to query these kinds")
+	}
+	return nips.FormatErrorMessage(nips.ErrorCodeRestricted, "these kinds are only served to whitelisted pubkeys")
+}
+
+// privateAccessDenial returns the machine-readable rejection for a client that may
+// not use a private relay (RELAY_POLICY.PRIVATE or the tenant's PRIVATE), or ""
+// when access is allowed
+func (c *WsConnection) privateAccessDenial() string {
+	if !c.isPrivate() {
+		return ""
+	}
+	if c.AuthedPubkey() == "" {
+		return nips.FormatErrorMessage(nips.ErrorCodeAuthRequired, "this relay is private, authenticate to continue")
+	}
+	if !c.isMember(c.AuthedPubkey()) {
+		return nips.FormatErrorMessage(nips.ErrorCodeRestricted, "this relay is private and your pubkey is not a member")
+	}
+	return ""
+}
+
+// writePolicyDenial returns the machine-readable rejection for an event whose
+// author may not publish under RELAY_POLICY.WRITE_POLICY, or the tenant's, or ""
+// when it may. Suspended authors are always refused, unless shadow-banned;
+// authors that are neither whitelisted nor paying publish within the free quota,
+// and the quota keys to charge once the event is accepted are returned.
+func (c *WsConnection) writePolicyDenial(evt *nostr.Event) ([]string, string) {
+	cfg := c.node.Config()
+	if s, suspended := c.node.Suspension(evt.PubKey); suspended && !s.Shadow {
+		return nil, nips.FormatErrorMessage(nips.ErrorCodeRestricted, suspensionDenial(cfg, s))
+	}
+	quota := c.node.FreeQuota()
+	whitelisted := c.isMember(evt.PubKey)
+	member := whitelisted || c.node.ClassifyClient(evt.PubKey) == limiter.ClassPaid
+
+	switch c.writePolicy() {
+	case "authenticated":
+		if c.AuthedPubkey() == "" {
+			return nil, nips.FormatErrorMessage(nips.ErrorCodeAuthRequired, "authenticate to publish on this relay")
+		}
+	case "paid":
+		// Zap receipts and nutzaps to the relay pay for admission
+		if zaps := c.node.Zaps(); zaps != nil && zaps.IsReceipt(evt) {
+			return nil, ""
+		}
+		if cashu := c.node.Cashu(); cashu != nil && cashu.IsNutzap(evt) {
+			return nil, ""
+		}
+		if !member && quota == nil {
+			return nil, nips.FormatErrorMessage(nips.ErrorCodeRestricted, admissionDenial(cfg, "publish on this relay"))
+		}
+	case "whitelist":
+		if !whitelisted {
+			return nil, nips.FormatErrorMessage(nips.ErrorCodeRestricted, "only whitelisted pubkeys may publish on this relay")
+		}
+		return nil, ""
+	}
+
+	if quota == nil || member {
+		return nil, ""
+	}
+	keys := c.freeQuotaKeys(evt)
+	if !quota.Allowed(keys...) {
+		return nil, nips.FormatErrorMessage(nips.ErrorCodeRestricted, freeQuotaDenial(cfg, quota.Limit()))
+	}
+	return keys, ""
+}
+
+// freeQuotaKeys returns the keys the free quota charges for evt: its author, the
+// authenticated pubkey and the client's address, so rotating keys doesn't renew
+// the quota. Onion clients share an address, so it isn't charged for them.
+func (c *WsConnection) freeQuotaKeys(evt *nostr.Event) []string {
+	keys := []string{evt.PubKey}
+	if authed := c.AuthedPubkey(); authed != "" && authed != evt.PubKey {
+		keys = append(keys, authed)
+	}
+	if c.realClientIP != onionClientIP {
+		keys = append(keys, "ip:"+c.realClientIP)
+	}
+	return keys
+}
+
+// freeQuotaDenial returns the rejection for an author past the free daily quota,
+// pointing it to payment or invites when enabled
+func freeQuotaDenial(cfg *config.Config, limit int) string {
+	msg := fmt.Sprintf("free quota of %d events per day used up", limit)
+	if ways := admissionWays(cfg); ways != "" {
+		msg += ", " + ways + " to publish more"
+	}
+	return msg
+}
+
+// admissionDenial returns the rejection for a pubkey that wasn't admitted to a
+// paid relay, pointing it to the payment page and invite codes when enabled
+func admissionDenial(cfg *config.Config, action string) string {
+	members := "paying members"
+	if cfg.Invites.Enabled && !cfg.Payments.Enabled {
+		members = "members"
+	}
+	if ways := admissionWays(cfg); ways != "" {
+		return "only " + members + " may " + action + ", " + ways
+	}
+	return "only " + members + " may " + action
+}
+
+// admissionWays returns how a pubkey can gain admission, e.g. "pay at <url> or
+// redeem an invite code", or "" when neither payments nor invites are enabled
+func admissionWays(cfg *config.Config) string {
+	var ways []string
+	if cfg.Payments.Enabled && cfg.Payments.URL != "" {
+		ways = append(ways, "pay at "+cfg.Payments.URL)
+	}
+	if cfg.Invites.Enabled {
+		ways = append(ways, "redeem an invite code")
+	}
+	return strings.Join(ways, " or ")
+}
+
+// AuthedPubkey returns the pubkey the client authenticated as, or "" if none
+func (c *WsConnection) AuthedPubkey() string {
+	c.authMu.RLock()
+	defer c.authMu.RUnlock()
+	return c.authedPubkey
+}
+
+// ClientClass returns the rate limit class currently applied to the connection
+func (c *WsConnection) ClientClass() limiter.ClientClass {
+	c.authMu.RLock()
+	defer c.authMu.RUnlock()
+	return c.clientClass
+}
+
+// applyRateLimitProfile switches the connection's limiters to the profile for
+// class, or to the membership tier's profile when a paid pubkey has one
+func (c *WsConnection) applyRateLimitProfile(class limiter.ClientClass) {
+	cfg := c.node.Config()
+	profile := limiter.ResolveProfile(cfg.Relay.ThrottlingConfig, class)
+	var tier string
+	if class == limiter.ClassPaid {
+		paid, _ := c.node.PaidAdmission(c.AuthedPubkey())
+		tier = paid.Tier
+		if t := cfg.Payments.Tier(tier); t != nil {
+			profile = limiter.ResolveTierProfile(cfg.Relay.ThrottlingConfig, t.RateLimit)
+		}
+	}
+
+	c.authMu.Lock()
+	c.clientClass = class
+	c.paidTier = tier
+	c.authMu.Unlock()
+
+	c.limiter.SetLimit(rate.Limit(profile.MaxEventsPerSecond))
+	c.limiter.SetBurst(profile.BurstSize)
+	c.reqLimiter.SetLimit(rate.Limit(profile.MaxRequestsPerSecond))
+	c.reqLimiter.SetBurst(profile.BurstSize)
+}
@@ -0,0 +1,22 @@
+package relay
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/domain"
+	"github.com/Shugur-Network/relay/internal/relay/nips"
+)
+
+// queueFullRejection refuses an event the storage queue had no room for, with a
+// hint of when to retry. The first refusal of a saturation episode also gets a
+// NOTICE so clients back off instead of retrying at once.
+func (c *WsConnection) queueFullRejection() domain.EventResult {
+	processor := c.node.GetEventProcessor()
+	retryAfter := int(processor.RetryAfter() / time.Second)
+
+	if episode := processor.Saturation(); episode != 0 && c.saturationNoticed.Swap(episode) != episode {
+		c.sendNotice(fmt.Sprintf("relay is saturated and dropping events, slow down and retry after %ds", retryAfter))
+	}
+	return domain.RejectEvent(nips.ErrorCodeRateLimited, fmt.Sprintf("relay is busy, retry after %ds", retryAfter))
+}
@@ -0,0 +1,40 @@
+package relay
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/web"
+	"go.uber.org/zap"
+)
+
+// handleAdminBlocklistFeeds serves GET /api/admin/blocklist-feeds: the count of
+// each feed's stored entries by type and when it was last synced, or with
+// ?value= the feeds listing a pubkey, event ID or domain
+func (s *Server) handleAdminBlocklistFeeds(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if value := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("value"))); value != "" {
+		entries, err := s.node.DB().FindBlocklistEntries(r.Context(), value)
+		if err != nil {
+			logger.Error("Failed to look up blocklist entry", zap.Error(err))
+			web.WriteAdminError(w, http.StatusInternalServerError, "failed to look up blocklist entry")
+			return
+		}
+		web.WriteAdminJSON(w, http.StatusOK, entries)
+		return
+	}
+
+	summaries, err := s.node.DB().GetBlocklistFeedSummaries(r.Context())
+	if err != nil {
+		logger.Error("Failed to summarize blocklist feeds", zap.Error(err))
+		web.WriteAdminError(w, http.StatusInternalServerError, "failed to load blocklist feeds")
+		return
+	}
+	web.WriteAdminJSON(w, http.StatusOK, summaries)
+}
@@ -0,0 +1,246 @@
+package relay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/limiter"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/metrics"
+	"github.com/Shugur-Network/relay/internal/relay/nips"
+	"github.com/Shugur-Network/relay/internal/storage"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+// handleBlossom routes the Blossom media endpoints: PUT /upload, GET /list/<pubkey>
+// and GET, HEAD or DELETE /<sha256>
+func (s *Server) handleBlossom(w http.ResponseWriter, r *http.Request) {
+	if !s.fullCfg.Blossom.Enabled {
+		http.NotFound(w, r)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	switch {
+	case path == "upload":
+		if r.Method != http.MethodPut {
+			blossomError(w, http.StatusMethodNotAllowed, "use PUT to upload blobs")
+			return
+		}
+		s.handleBlossomUpload(w, r)
+	case strings.HasPrefix(path, "list/"):
+		if r.Method != http.MethodGet {
+			blossomError(w, http.StatusMethodNotAllowed, "use GET to list blobs")
+			return
+		}
+		s.handleBlossomList(w, r, strings.TrimPrefix(path, "list/"))
+	default:
+		hash, _, _ := strings.Cut(path, ".")
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			s.handleBlossomGet(w, r, hash)
+		case http.MethodDelete:
+			s.handleBlossomDelete(w, r, hash)
+		default:
+			blossomError(w, http.StatusMethodNotAllowed, "unsupported method")
+		}
+	}
+}
+
+// handleBlossomUpload stores the request body as a blob (BUD-02 PUT /upload)
+func (s *Server) handleBlossomUpload(w http.ResponseWriter, r *http.Request) {
+	maxSize := s.fullCfg.Blossom.MaxBlobSize
+	if r.ContentLength > maxSize {
+		blossomError(w, http.StatusRequestEntityTooLarge, "blob exceeds the size limit")
+		return
+	}
+
+	authEvt, reason := blossomAuthorization(r, "upload")
+	if authEvt == nil {
+		blossomError(w, http.StatusUnauthorized, reason)
+		return
+	}
+	if reason := s.blossomUploadDenial(authEvt.PubKey); reason != "" {
+		blossomError(w, http.StatusForbidden, reason)
+		return
+	}
+
+	// Uploads get their own deadlines instead of the server's 15s timeouts
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(s.fullCfg.Blossom.UploadTimeout)
+	_ = rc.SetReadDeadline(deadline)  // nolint:errcheck // unsupported writers keep the server timeouts
+	_ = rc.SetWriteDeadline(deadline) // nolint:errcheck // unsupported writers keep the server timeouts
+
+	content, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSize))
+	if err != nil {
+		blossomError(w, http.StatusRequestEntityTooLarge, "blob exceeds the size limit")
+		return
+	}
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	if err := nips.ValidateBlossomAuth(authEvt, "upload", hash); err != nil {
+		blossomError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	mimeType := r.Header.Get("Content-Type")
+	if mimeType == "" {
+		mimeType = http.DetectContentType(content)
+	}
+	desc, err := s.node.DB().PutMediaBlob(r.Context(), hash, content, mimeType, authEvt.PubKey, time.Now().Unix())
+	if err != nil {
+		logger.Error("Failed to store blob", zap.String("sha256", hash), zap.Error(err))
+		blossomError(w, http.StatusInternalServerError, "failed to store blob")
+		return
+	}
+	metrics.BlossomUploads.Inc()
+	metrics.BlossomUploadBytes.Add(float64(len(content)))
+
+	desc.URL = s.blossomURL(r, hash)
+	writeBlossomJSON(w, desc)
+}
+
+// handleBlossomGet serves a blob by its sha256 (BUD-01 GET and HEAD /<sha256>)
+func (s *Server) handleBlossomGet(w http.ResponseWriter, r *http.Request, hash string) {
+	desc, content, err := s.node.DB().GetMediaBlob(r.Context(), hash)
+	if errors.Is(err, storage.ErrBlobNotFound) {
+		blossomError(w, http.StatusNotFound, "blob not found")
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to load blob", zap.String("sha256", hash), zap.Error(err))
+		blossomError(w, http.StatusInternalServerError, "failed to load blob")
+		return
+	}
+
+	// Content addressed, so the blob behind a URL never changes
+	w.Header().Set("Content-Type", desc.Type)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", `"`+hash+`"`)
+	http.ServeContent(w, r, "", time.Unix(desc.Uploaded, 0), bytes.NewReader(content))
+}
+
+// handleBlossomList lists the blobs uploaded by a pubkey (BUD-02 GET /list/<pubkey>)
+func (s *Server) handleBlossomList(w http.ResponseWriter, r *http.Request, pubkey string) {
+	var since, until int64
+	for name, bound := range map[string]*int64{"since": &since, "until": &until} {
+		if v := r.URL.Query().Get(name); v != "" {
+			parsed, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || parsed < 0 {
+				blossomError(w, http.StatusBadRequest, "invalid "+name+" parameter")
+				return
+			}
+			*bound = parsed
+		}
+	}
+
+	blobs, err := s.node.DB().ListMediaBlobs(r.Context(), pubkey, since, until)
+	if err != nil {
+		logger.Error("Failed to list blobs", zap.String("pubkey", pubkey), zap.Error(err))
+		blossomError(w, http.StatusInternalServerError, "failed to list blobs")
+		return
+	}
+	for i := range blobs {
+		blobs[i].URL = s.blossomURL(r, blobs[i].SHA256)
+	}
+	writeBlossomJSON(w, blobs)
+}
+
+// handleBlossomDelete removes the authorizing pubkey's copy of a blob (BUD-02 DELETE /<sha256>)
+func (s *Server) handleBlossomDelete(w http.ResponseWriter, r *http.Request, hash string) {
+	authEvt, reason := blossomAuthorization(r, "delete")
+	if authEvt == nil {
+		blossomError(w, http.StatusUnauthorized, reason)
+		return
+	}
+	if err := nips.ValidateBlossomAuth(authEvt, "delete", hash); err != nil {
+		blossomError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	err := s.node.DB().DeleteMediaBlob(r.Context(), hash, authEvt.PubKey)
+	if errors.Is(err, storage.ErrBlobNotFound) {
+		blossomError(w, http.StatusNotFound, "blob not found")
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to delete blob", zap.String("sha256", hash), zap.Error(err))
+		blossomError(w, http.StatusInternalServerError, "failed to delete blob")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// blossomAuthorization decodes and checks the request's authorization event for
+// verb. It returns nil and the reason when the request isn't authorized.
+func blossomAuthorization(r *http.Request, verb string) (*nostr.Event, string) {
+	evt, err := nips.ParseBlossomAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		return nil, err.Error()
+	}
+	if err := nips.ValidateBlossomAuth(evt, verb, ""); err != nil {
+		return nil, err.Error()
+	}
+	return evt, ""
+}
+
+// blossomUploadDenial returns why pubkey may not upload blobs under the relay's
+// access and write policy, or "" when it may
+func (s *Server) blossomUploadDenial(pubkey string) string {
+	policy := s.fullCfg.RelayPolicy
+	class := s.node.ClassifyClient(pubkey)
+	if suspension, suspended := s.node.Suspension(pubkey); suspended {
+		return suspensionDenial(s.fullCfg, suspension)
+	}
+	switch {
+	case (policy.Private || policy.WritePolicy == "whitelist") && class != limiter.ClassWhitelisted:
+		return "only whitelisted pubkeys may upload to this server"
+	case policy.WritePolicy == "paid" && class != limiter.ClassWhitelisted && class != limiter.ClassPaid:
+		return admissionDenial(s.fullCfg, "upload to this server")
+	}
+	return ""
+}
+
+// blossomURL returns the public URL of a blob, derived from RELAY.PUBLIC_URL when
+// set and from the request otherwise
+func (s *Server) blossomURL(r *http.Request, hash string) string {
+	base := url.URL{Scheme: "http", Host: r.Host}
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		base.Scheme = "https"
+	}
+	if publicURL, err := url.Parse(s.fullCfg.Relay.PublicURL); err == nil && publicURL.Host != "" {
+		base.Host = publicURL.Host
+		switch publicURL.Scheme {
+		case "wss", "https":
+			base.Scheme = "https"
+		default:
+			base.Scheme = "http"
+		}
+	}
+	base.Path = "/" + hash
+	return base.String()
+}
+
+// blossomError writes a Blossom error response with the reason in X-Reason
+func blossomError(w http.ResponseWriter, status int, reason string) {
+	w.Header().Set("X-Reason", reason)
+	http.Error(w, reason, status)
+}
+
+// writeBlossomJSON writes a blob descriptor or descriptor list
+func writeBlossomJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.Error("Failed to encode blob descriptor", zap.Error(err))
+	}
+}
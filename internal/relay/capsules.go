@@ -0,0 +1,133 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultScheduleWindow is the unlock window returned when "until" is omitted
+	defaultScheduleWindow = 7 * 24 * time.Hour
+	// defaultScheduleLimit and maxScheduleLimit bound the capsules per schedule response
+	defaultScheduleLimit = 100
+	maxScheduleLimit     = 500
+)
+
+// capsuleSharesResponse is the body returned by GET /api/capsules/<id>/shares
+type capsuleSharesResponse struct {
+	*storage.ShareProgress
+	ReceivedCount int  `json:"received_count"`
+	ThresholdMet  bool `json:"threshold_met"`
+}
+
+// capsuleScheduleResponse is the body returned by GET /api/capsules/upcoming
+type capsuleScheduleResponse struct {
+	Since    int64                      `json:"since"`
+	Until    int64                      `json:"until"`
+	Capsules []storage.ScheduledCapsule `json:"capsules"`
+}
+
+// handleCapsules routes the time capsule API under /api/capsules/
+func (s *Server) handleCapsules(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.fullCfg.Capsules.Enabled {
+		http.NotFound(w, r)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/capsules/")
+	switch {
+	case path == "upcoming":
+		s.handleCapsuleSchedule(w, r)
+	case strings.HasSuffix(path, "/shares"):
+		s.handleCapsuleShares(w, r, strings.TrimSuffix(path, "/shares"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleCapsuleShares serves GET /api/capsules/<capsule id>/shares: the witness
+// shares received for a threshold time capsule against its required threshold.
+func (s *Server) handleCapsuleShares(w http.ResponseWriter, r *http.Request, capsuleID string) {
+	progress, err := s.node.DB().GetShareProgress(r.Context(), requestTenantID(r), capsuleID)
+	if errors.Is(err, storage.ErrShareDistributionNotFound) {
+		http.Error(w, "No share distribution for this capsule", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to load capsule share progress", zap.String("capsule_id", capsuleID), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := capsuleSharesResponse{
+		ShareProgress: progress,
+		ReceivedCount: len(progress.Received),
+		ThresholdMet:  progress.Met(),
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Error("Failed to encode capsule share progress", zap.Error(err))
+	}
+}
+
+// handleCapsuleSchedule serves GET /api/capsules/upcoming?since=&until=&limit=:
+// capsules unlocking within the window, soonest first, from the unlock time index.
+func (s *Server) handleCapsuleSchedule(w http.ResponseWriter, r *http.Request) {
+	if !s.fullCfg.Capsules.UnlockScheduler {
+		http.Error(w, "Capsule unlock index is not enabled", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	since := time.Now().Unix()
+	if v := query.Get("since"); v != "" {
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid since parameter", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+	until := since + int64(defaultScheduleWindow.Seconds())
+	if v := query.Get("until"); v != "" {
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || parsed < since {
+			http.Error(w, "Invalid until parameter", http.StatusBadRequest)
+			return
+		}
+		until = parsed
+	}
+	limit := defaultScheduleLimit
+	if v, err := strconv.Atoi(query.Get("limit")); err == nil && v > 0 && v <= maxScheduleLimit {
+		limit = v
+	}
+
+	capsules, err := s.node.DB().GetCapsuleSchedule(r.Context(), requestTenantID(r), since, until, limit)
+	if err != nil {
+		logger.Error("Failed to load capsule schedule", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := capsuleScheduleResponse{Since: since, Until: until, Capsules: capsules}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Error("Failed to encode capsule schedule", zap.Error(err))
+	}
+}
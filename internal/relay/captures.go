@@ -0,0 +1,138 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/capture"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/web"
+	"go.uber.org/zap"
+)
+
+// captureRequest is the body accepted by POST /api/admin/captures. One of
+// ClientID, Session and PubKey names the clients to capture.
+type captureRequest struct {
+	capture.Target
+	// Duration is how many seconds the capture runs, ADMIN.CAPTURE.MAX_DURATION
+	// when omitted
+	Duration int64 `json:"duration,omitempty"`
+	// MaxBytes bounds the capture file, ADMIN.CAPTURE.MAX_BYTES when omitted
+	MaxBytes int64 `json:"max_bytes,omitempty"`
+}
+
+// captureFrame records a frame exchanged with the client when a capture names it
+func (c *WsConnection) captureFrame(direction string, data []byte) {
+	captures := c.node.Captures()
+	if !captures.Active() {
+		return
+	}
+	captures.Record(capture.Client{
+		ClientID: c.clientID,
+		Session:  c.SessionID(),
+		PubKey:   c.AuthedPubkey(),
+		IP:       c.realClientIP,
+	}, direction, data)
+}
+
+// handleAdminCaptures lists (GET) or starts (POST) frame captures on this node
+func (s *Server) handleAdminCaptures(w http.ResponseWriter, r *http.Request) {
+	captures := s.node.Captures()
+	switch r.Method {
+	case http.MethodGet:
+		web.WriteAdminJSON(w, http.StatusOK, captures.List())
+
+	case http.MethodPost:
+		var req captureRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			web.WriteAdminError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		if req.PubKey != "" && !pubkeyPattern.MatchString(req.PubKey) {
+			web.WriteAdminError(w, http.StatusBadRequest, "pubkey must be 64 hex characters")
+			return
+		}
+		if req.Duration < 0 || req.MaxBytes < 0 {
+			web.WriteAdminError(w, http.StatusBadRequest, "duration and max_bytes must not be negative")
+			return
+		}
+
+		info, err := captures.Start(req.Target, time.Duration(req.Duration)*time.Second, req.MaxBytes)
+		switch {
+		case errors.Is(err, capture.ErrNoTarget):
+			web.WriteAdminError(w, http.StatusBadRequest, err.Error())
+			return
+		case errors.Is(err, capture.ErrTooManyCaptures):
+			web.WriteAdminError(w, http.StatusConflict, err.Error())
+			return
+		case err != nil:
+			logger.Error("Failed to start capture", zap.Error(err))
+			web.WriteAdminError(w, http.StatusInternalServerError, "failed to start capture")
+			return
+		}
+
+		logger.Info("Started frame capture",
+			zap.String("capture_id", info.ID),
+			zap.String("client_id", info.ClientID),
+			zap.String("session_id", info.Session),
+			zap.String("pubkey", info.PubKey),
+			zap.Time("expires_at", info.ExpiresAt),
+			zap.String("file", info.File))
+		web.WriteAdminJSON(w, http.StatusCreated, info)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleAdminCapture describes (GET) or stops (DELETE) a capture, and serves its
+// file on GET /api/admin/captures/<id>/file
+func (s *Server) handleAdminCapture(w http.ResponseWriter, r *http.Request, path string) {
+	captures := s.node.Captures()
+	id, sub, _ := strings.Cut(path, "/")
+	info, ok := captures.Get(id)
+	if !ok {
+		web.WriteAdminError(w, http.StatusNotFound, "capture not found")
+		return
+	}
+
+	switch {
+	case sub == "file" && r.Method == http.MethodGet:
+		file, err := os.Open(info.File)
+		if err != nil {
+			web.WriteAdminError(w, http.StatusNotFound, "capture file not found")
+			return
+		}
+		defer file.Close()
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="capture-`+info.ID+`.jsonl"`)
+		http.ServeContent(w, r, "", time.Time{}, file)
+
+	case sub == "" && r.Method == http.MethodGet:
+		web.WriteAdminJSON(w, http.StatusOK, info)
+
+	case sub == "" && r.Method == http.MethodDelete:
+		info, _ = captures.Stop(id)
+		logger.Info("Stopped frame capture",
+			zap.String("capture_id", info.ID),
+			zap.Int64("frames", info.Frames),
+			zap.Int64("bytes", info.Bytes))
+		web.WriteAdminJSON(w, http.StatusOK, info)
+
+	case sub == "file":
+		w.Header().Set("Allow", "GET")
+		web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+	case sub == "":
+		w.Header().Set("Allow", "GET, DELETE")
+		web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+	default:
+		web.WriteAdminError(w, http.StatusNotFound, "unknown admin endpoint")
+	}
+}
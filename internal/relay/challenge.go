@@ -0,0 +1,54 @@
+package relay
+
+import (
+	"fmt"
+
+	"github.com/Shugur-Network/relay/internal/metrics"
+	"github.com/Shugur-Network/relay/internal/relay/nips"
+	"github.com/Shugur-Network/relay/internal/sessions"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip13"
+)
+
+// challengeDenial returns the rejection for an event from a client that must
+// prove work before publishing, and whether the event is that proof. Clients
+// that authenticated, passed the challenge on this connection or in the same
+// session earlier aren't challenged, nor is anyone while the load is low. The
+// work must be committed to in the nonce tag, as NIP-13 describes.
+func (c *WsConnection) challengeDenial(evt *nostr.Event) (bool, string) {
+	challenge := c.node.Challenge()
+	if challenge == nil || c.challengePassed.Load() || c.AuthedPubkey() != "" || challenge.Known(c.challengeKey()) {
+		return false, ""
+	}
+	if !challenge.Active(metrics.GetEventsPerSecond(), metrics.GetConnectionsPerSecond()) {
+		return false, ""
+	}
+
+	difficulty := challenge.Difficulty()
+	if nip13.Difficulty(evt.ID) >= difficulty && nip13.CommittedDifficulty(evt) >= difficulty {
+		return true, ""
+	}
+	metrics.Challenges.WithLabelValues("required").Inc()
+	return false, nips.FormatErrorMessage(nips.ErrorCodePowerLevels,
+		fmt.Sprintf("the relay is under load, add proof of work of difficulty %d or authenticate to publish", difficulty))
+}
+
+// passChallenge stops challenging the connection and its session, once the
+// event carrying its proof of work was accepted. Onion clients share an
+// address, so only the connection is let through.
+func (c *WsConnection) passChallenge() {
+	if c.challengePassed.Swap(true) {
+		return
+	}
+	if c.realClientIP != onionClientIP {
+		c.node.Challenge().Remember(c.challengeKey())
+	}
+	metrics.Challenges.WithLabelValues("passed").Inc()
+}
+
+// challengeKey is the session a passed challenge is remembered for: the
+// unauthenticated session of the client's peer address, as found by
+// web.ClientIPs, which only believes forwarded addresses from trusted proxies
+func (c *WsConnection) challengeKey() string {
+	return sessions.ID(c.realClientIP, "")
+}
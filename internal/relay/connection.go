@@ -6,18 +6,21 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"net"
 	"net/http"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/Shugur-Network/relay/internal/capture"
 	"github.com/Shugur-Network/relay/internal/config"
 	"github.com/Shugur-Network/relay/internal/domain"
 	"github.com/Shugur-Network/relay/internal/errors"
+	"github.com/Shugur-Network/relay/internal/limiter"
 	"github.com/Shugur-Network/relay/internal/logger"
 	"github.com/Shugur-Network/relay/internal/metrics"
+	"github.com/Shugur-Network/relay/internal/relay/nips"
+	"github.com/Shugur-Network/relay/internal/sessions"
+	"github.com/Shugur-Network/relay/internal/storage"
 	"github.com/gorilla/websocket"
 	nostr "github.com/nbd-wtf/go-nostr"
 	"go.uber.org/zap"
@@ -31,66 +34,6 @@ var (
 	clientExceededCount = make(map[string]int)
 )
 
-// extractRealClientIP extracts the real client IP from request headers when behind a proxy
-func extractRealClientIP(r *http.Request) string {
-	var extractedIP string
-	var source string
-
-	// Try X-Real-IP first (set by Caddy)
-	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
-		extractedIP = strings.TrimSpace(realIP)
-		return extractedIP
-	}
-
-	// Try X-Forwarded-For (contains comma-separated list of IPs)
-	if forwardedFor := r.Header.Get("X-Forwarded-For"); forwardedFor != "" {
-		// Take the first IP in the chain (the original client)
-		parts := strings.Split(forwardedFor, ",")
-		if len(parts) > 0 {
-			extractedIP = strings.TrimSpace(parts[0])
-			source = "X-Forwarded-For"
-			logger.Debug("Client IP extracted from X-Forwarded-For header",
-				zap.String("forwarded_ip", extractedIP),
-				zap.String("source", source),
-				zap.String("full_header", forwardedFor),
-				zap.String("raw_remote_addr", r.RemoteAddr))
-			return extractedIP
-		}
-	}
-
-	// Fallback to RemoteAddr (direct connection)
-	extractedIP = normalizeIP(r.RemoteAddr)
-	source = "RemoteAddr"
-	logger.Debug("No proxy headers found, using RemoteAddr",
-		zap.String("client_ip", extractedIP),
-		zap.String("source", source),
-		zap.String("x_real_ip", r.Header.Get("X-Real-IP")),
-		zap.String("x_forwarded_for", r.Header.Get("X-Forwarded-For")))
-
-	return extractedIP
-}
-
-// normalizeIP converts a network address to a normalized IP string
-func normalizeIP(addr string) string {
-	// Extract the IP portion (remove port)
-	host, _, err := net.SplitHostPort(addr)
-	if err != nil {
-		// If splitting fails, assume addr is already an IP
-		host = addr
-	}
-
-	// Normalize IPv4-mapped IPv6 addresses
-	ip := net.ParseIP(host)
-	if ip != nil {
-		if ipv4 := ip.To4(); ipv4 != nil {
-			return ipv4.String()
-		}
-		return ip.String()
-	}
-
-	return host
-}
-
 // generateClientID generates a unique client ID for event dispatcher
 func generateClientID() string {
 	bytes := make([]byte, 8)
@@ -139,14 +82,25 @@ func cleanExpiredBans() {
 }
 
 // handleWebSocketConnection handles the upgrade of an HTTP connection to WebSocket
-func handleWebSocketConnection(ctx context.Context, w http.ResponseWriter, r *http.Request, upgrader websocket.Upgrader, node domain.NodeInterface, relayConfig config.RelayConfig) {
-	clientIP := extractRealClientIP(r)
+func handleWebSocketConnection(ctx context.Context, w http.ResponseWriter, r *http.Request, upgrader websocket.Upgrader, node domain.NodeInterface, relayConfig config.RelayConfig, clientIP string) {
 
 	logger.Debug("New WebSocket connection attempt",
 		zap.String("client_ip", clientIP),
 		zap.String("user_agent", r.Header.Get("User-Agent")),
 		zap.String("origin", r.Header.Get("Origin")))
 
+	// Refuse addresses outside the configured allow and deny lists; onion
+	// clients have no address to check
+	if reason := node.IPAccess().Check(clientIP); reason != "" && !isOnionRequest(r) {
+		metrics.IPAccessDenied.WithLabelValues(reason).Inc()
+		logger.Debug("WebSocket connection refused by IP access lists",
+			zap.String("client_ip", clientIP),
+			zap.String("reason", reason))
+		errors.HandleHTTPError(w, r, errors.New(errors.ErrorTypeAuthorization, "IP_DENIED", fmt.Sprintf("Client address refused: %s", reason)).
+			WithUserMessage("Connections from your network are not accepted by this relay."))
+		return
+	}
+
 	// Check if client is banned
 	banListMutex.Lock()
 	banExpiry, banned := clientBanList[clientIP]
@@ -175,6 +129,11 @@ func handleWebSocketConnection(ctx context.Context, w http.ResponseWriter, r *ht
 		errors.HandleHTTPError(w, r, limitErr)
 		return
 	}
+	// Suspended and full virtual relays take no connections
+	if denial := tenantConnectionDenial(node, r); denial != nil {
+		errors.HandleHTTPError(w, r, denial)
+		return
+	}
 	// Ensure we decrement on error
 	connectionSuccess := false
 	defer func() {
@@ -202,11 +161,16 @@ func handleWebSocketConnection(ctx context.Context, w http.ResponseWriter, r *ht
 	connectionSuccess = true
 
 	// Create new connection and register it
-	conn := NewWsConnection(ctx, wsConn, node, relayConfig, clientIP)
+	conn := NewWsConnection(ctx, wsConn, node, relayConfig, clientIP, requestTenantID(r), r.Host)
+	if isOnionRequest(r) {
+		conn.applyRateLimitProfile(limiter.ClassOnion)
+	}
 	node.RegisterConn(conn)
+	node.TenantMeter().Connected(conn.tenant)
 
 	logger.Debug("WebSocket connection established successfully",
 		zap.String("client_ip", clientIP),
+		zap.String("session_id", conn.SessionID()),
 		zap.Int64("active_connections", metrics.GetActiveConnectionsCount()))
 
 	// Handle messages in a goroutine
@@ -218,6 +182,8 @@ type WsConnection struct {
 	ws           *websocket.Conn
 	node         domain.NodeInterface
 	realClientIP string // Real client IP (extracted from proxy headers)
+	tenant       string // Virtual relay the client connected to, DefaultTenant for the main relay
+	host         string // Host the client connected to
 	lastActivity time.Time
 	idleTimeout  time.Duration
 	maxLifetime  time.Duration // Maximum lifetime of a connection
@@ -227,22 +193,51 @@ type WsConnection struct {
 
 	subMu         sync.RWMutex
 	subscriptions map[string][]nostr.Filter
+	// queries holds the stored-events queries still running, by subscription
+	queries map[string]*pendingQuery
 
 	writeMu            sync.Mutex
 	closeMu            sync.Once
 	limiter            *rate.Limiter
+	reqLimiter         *rate.Limiter
 	isClosed           atomic.Bool
 	metricsDecremented atomic.Bool // Flag to prevent double-decrementing metrics
 	closeReason        string
+	// restarting closes the connection with the service restart code, for the
+	// client to reconnect to the process taking over
+	restarting atomic.Bool
 
 	exceededLimitCount int
 	backpressureChan   chan struct{} // Channel for backpressure handling
 
 	// Event dispatcher integration
 	clientID    string
-	eventChan   chan *nostr.Event
+	eventChan   chan storage.LiveEvent
 	eventCtx    context.Context
 	eventCancel context.CancelFunc
+
+	// NIP-42 authentication state
+	authMu        sync.RWMutex
+	authChallenge string
+	authedPubkey  string
+	clientClass   limiter.ClientClass
+	// paidTier is the membership tier whose profile is applied; renewalNoticed
+	// and graceNoticed the paid_until a renewal or grace period NOTICE was last
+	// sent for
+	paidTier       string
+	renewalNoticed int64
+	graceNoticed   int64
+
+	// saturationNoticed is the queue saturation episode a NOTICE was last sent for
+	saturationNoticed atomic.Uint64
+	// challengePassed is set once an event with the proof of work asked under
+	// load was accepted
+	challengePassed atomic.Bool
+	// resume is the session the client asked a resume token for, nil until it does
+	resume atomic.Pointer[resumeSession]
+	// session counts the client's activity across reconnects, nil when sessions
+	// aren't tracked
+	session atomic.Pointer[sessions.Session]
 }
 
 // Ensure WsConnection implements domain.WebSocketConnection
@@ -255,12 +250,13 @@ func NewWsConnection(
 	node domain.NodeInterface,
 	cfg config.RelayConfig,
 	realClientIP string,
+	tenant string,
+	host string,
 ) *WsConnection {
-	// Basic rate limiter
-	limiter := rate.NewLimiter(
-		rate.Limit(cfg.ThrottlingConfig.RateLimit.MaxEventsPerSecond),
-		cfg.ThrottlingConfig.RateLimit.BurstSize,
-	)
+	// Rate limiters start with the anonymous profile until the client authenticates
+	profile := limiter.ResolveProfile(cfg.ThrottlingConfig, limiter.ClassAnonymous)
+	eventLimiter := rate.NewLimiter(rate.Limit(profile.MaxEventsPerSecond), profile.BurstSize)
+	reqLimiter := rate.NewLimiter(rate.Limit(profile.MaxRequestsPerSecond), profile.BurstSize)
 
 	// Create context for event handling
 	eventCtx, eventCancel := context.WithCancel(ctx)
@@ -269,23 +265,33 @@ func NewWsConnection(
 		ws:               ws,
 		node:             node,
 		realClientIP:     realClientIP,
+		tenant:           tenant,
+		host:             host,
 		idleTimeout:      cfg.IdleTimeout,
 		maxLifetime:      24 * time.Hour, // Maximum connection lifetime
 		startTime:        time.Now(),
 		lastActivity:     time.Now(),
 		subscriptions:    make(map[string][]nostr.Filter),
+		queries:          make(map[string]*pendingQuery),
 		pingTicker:       time.NewTicker(15 * time.Second),
-		limiter:          limiter,
+		limiter:          eventLimiter,
+		reqLimiter:       reqLimiter,
 		backpressureChan: make(chan struct{}, 100), // Buffer for backpressure
 		// Event dispatcher integration
 		clientID:    generateClientID(),
 		eventCtx:    eventCtx,
 		eventCancel: eventCancel,
+		// NIP-42
+		authChallenge: nips.GenerateAuthChallenge(),
+		clientClass:   limiter.ClassAnonymous,
 	}
 
+	// Count the connection on the client's session until it authenticates
+	conn.session.Store(node.Sessions().Connect(realClientIP, ""))
+
 	// Register with event dispatcher for real-time notifications
 	if eventDispatcher := node.GetEventDispatcher(); eventDispatcher != nil {
-		conn.eventChan = eventDispatcher.AddClient(conn.clientID)
+		conn.eventChan = eventDispatcher.AddClient(conn.clientID, tenant)
 		// Start processing events from dispatcher
 		go conn.processDispatcherEvents()
 	}
@@ -328,6 +334,11 @@ func (c *WsConnection) RemoteAddr() string {
 	return c.realClientIP
 }
 
+// ClientID returns the ID identifying the connection on this node
+func (c *WsConnection) ClientID() string {
+	return c.clientID
+}
+
 // SendMessage handles backpressure and rate limiting
 func (c *WsConnection) SendMessage(msg []byte) {
 	c.sendMessageInternal(msg, true)
@@ -385,6 +396,9 @@ func (c *WsConnection) sendMessageInternal(msg []byte, applyRateLimit bool) {
 	// Update metrics
 	metrics.IncrementMessagesSent()
 	metrics.MessageSizeBytesSent.Observe(float64(len(msg)))
+	c.node.TenantMeter().BytesOut(c.tenant, len(msg))
+	c.session.Load().Add(sessions.BytesOut, int64(len(msg)))
+	c.captureFrame(capture.Outbound, msg)
 }
 
 // sendMessage marshals a top-level array like ["NOTICE", "xyz"] or ["CLOSED", subID, reason].
@@ -406,24 +420,22 @@ func (c *WsConnection) sendMessage(msgType string, args ...interface{}) {
 
 // sendNotice is a convenience for sending ["NOTICE", <message>].
 func (c *WsConnection) sendNotice(message string) {
-	c.sendMessage("NOTICE", message)
+	c.SendMessage(encodeStrings("NOTICE", message))
 }
 
 // sendClosed is a convenience for sending ["CLOSED", <subID>, <reason>].
 func (c *WsConnection) sendClosed(subID, reason string) {
-	c.sendMessage("CLOSED", subID, reason)
+	c.SendMessage(encodeStrings("CLOSED", subID, reason))
 }
 
 // sendOK sends an OK response for an event with status and message
 func (c *WsConnection) sendOK(eventID string, accepted bool, message string) {
-	msg := []interface{}{"OK", eventID, accepted, message}
-	data, _ := json.Marshal(msg)
-	c.SendMessage(data)
+	c.SendMessage(encodeOK(eventID, accepted, message))
 }
 
 // sendEOSE sends an EOSE (End of Stored Events) message
 func (c *WsConnection) sendEOSE(subID string) {
-	c.sendMessage("EOSE", subID)
+	c.SendMessage(encodeStrings("EOSE", subID))
 }
 
 // HandleMessages processes incoming messages from the client
@@ -483,6 +495,17 @@ func (c *WsConnection) HandleMessages(ctx context.Context, cfg config.RelayConfi
 	connCtx, cancel := context.WithTimeout(ctx, 24*time.Hour)
 	defer cancel()
 
+	// EVENTs are validated and stored off the read loop, so CLOSE and REQ are
+	// read while they are
+	pipeline := c.startEventPipeline(ctx, cfg)
+	defer pipeline.close()
+
+	// Offer NIP-42 authentication up front
+	c.sendAuthChallenge()
+
+	// Greet the client with the messages of the day
+	c.sendMOTD(time.Now())
+
 	for {
 		select {
 		case <-connCtx.Done():
@@ -520,24 +543,49 @@ func (c *WsConnection) HandleMessages(ctx context.Context, cfg config.RelayConfi
 		metrics.IncrementMessagesProcessed() // This handles both counter and local tracking
 		messageSize := float64(len(rawMsg))
 		metrics.MessageSizeBytes.Observe(messageSize)
+		c.node.TenantMeter().BytesIn(c.tenant, len(rawMsg))
+		session := c.session.Load()
+		session.Add(sessions.Messages, 1)
+		session.Add(sessions.BytesIn, int64(len(rawMsg)))
+		c.captureFrame(capture.Inbound, rawMsg)
 
 		_ = c.ws.SetReadDeadline(time.Time{}) // nolint:errcheck // deadline reset is non-critical
 		c.lastActivity = time.Now()
 
+		// EVENT frames are decoded once, straight into the event, and REQ frames
+		// are only split so the filter is decoded once; other commands go through
+		// the generic decode
 		var arr []interface{}
-		if err := json.Unmarshal(rawMsg, &arr); err != nil {
-			c.sendNotice("invalid: malformed JSON from client")
-			continue
-		}
-		if len(arr) == 0 {
-			c.sendNotice("invalid: empty command array")
-			continue
-		}
+		var frame []json.RawMessage
+		var evt nostr.Event
+		cmdType := frameLabel(rawMsg)
+		switch cmdType {
+		case "EVENT":
+			if err := decodeEventFrame(rawMsg, &evt); err != nil {
+				c.sendNotice("Invalid event: " + err.Error())
+				continue
+			}
+		case "REQ":
+			if err := json.Unmarshal(rawMsg, &frame); err != nil {
+				c.sendNotice("invalid: malformed JSON from client")
+				continue
+			}
+		default:
+			if err := json.Unmarshal(rawMsg, &arr); err != nil {
+				c.sendNotice("invalid: malformed JSON from client")
+				continue
+			}
+			if len(arr) == 0 {
+				c.sendNotice("invalid: empty command array")
+				continue
+			}
 
-		cmdType, ok := arr[0].(string)
-		if !ok {
-			c.sendNotice("invalid: command must be a string")
-			continue
+			var ok bool
+			cmdType, ok = arr[0].(string)
+			if !ok {
+				c.sendNotice("invalid: command must be a string")
+				continue
+			}
 		}
 
 		if cmdType == "EVENT" {
@@ -547,9 +595,11 @@ func (c *WsConnection) HandleMessages(ctx context.Context, cfg config.RelayConfi
 				clientExceededCount[clientIP]++
 				count := clientExceededCount[clientIP]
 				banListMutex.Unlock()
+				c.session.Load().Add(sessions.RateLimited, 1)
 
 				logger.Debug("Client rate limit violation",
 					zap.String("client_ip", clientIP),
+					zap.String("session_id", c.SessionID()),
 					zap.Int("violation_count", count),
 					zap.Int("ban_threshold", cfg.ThrottlingConfig.BanThreshold),
 					zap.String("real_client_ip", c.realClientIP),
@@ -561,6 +611,7 @@ func (c *WsConnection) HandleMessages(ctx context.Context, cfg config.RelayConfi
 					banDuration := time.Duration(cfg.ThrottlingConfig.BanDuration) * time.Second
 					logger.Warn("BANNING CLIENT due to repeated rate limit violations",
 						zap.String("client_ip", clientIP),
+						zap.String("session_id", c.SessionID()),
 						zap.Int("violation_count", count),
 						zap.Duration("ban_duration", banDuration),
 						zap.String("real_client_ip", c.realClientIP),
@@ -581,27 +632,77 @@ func (c *WsConnection) HandleMessages(ctx context.Context, cfg config.RelayConfi
 			c.exceededLimitCount = 0
 		}
 
+		subID := ""
+		if len(arr) > 1 {
+			subID, _ = arr[1].(string)
+		} else if len(frame) > 1 {
+			_ = json.Unmarshal(frame[1], &subID)
+		}
+		if (cmdType == "REQ" || cmdType == "COUNT") && !c.reqLimiter.Allow() {
+			c.session.Load().Add(sessions.RateLimited, 1)
+			c.sendClosed(subID, nips.FormatErrorMessage(nips.ErrorCodeRateLimited, "too many requests"))
+			continue
+		}
+
 		// Update command metrics
 		metrics.CommandsReceived.WithLabelValues(cmdType).Inc()
 
-		// Process the command
-		start := time.Now()
+		// Process the command. A full pipeline is answered rather than waited on,
+		// so the read loop never stalls behind the client's own EVENTs.
 		switch cmdType {
 		case "EVENT":
-			c.handleEvent(ctx, arr)
-		case "REQ":
-			c.handleRequest(ctx, arr)
-		case "COUNT":
-			c.handleCountRequest(ctx, arr)
+			if !pipeline.submit(evt) {
+				c.session.Load().Add(sessions.RateLimited, 1)
+				c.finishEvent(&evt, domain.RejectEvent(nips.ErrorCodeRateLimited, "too many events in flight, slow down"))
+			}
+		case "REQ", "COUNT":
+			// Reads wait for the EVENTs sent before them to be stored
+			reqID := subID
+			if cmdType == "COUNT" {
+				reqID = ""
+			}
+			if !pipeline.after(reqID, func() { c.handleCommand(ctx, cmdType, arr, frame) }) {
+				c.session.Load().Add(sessions.RateLimited, 1)
+				c.sendClosed(subID, nips.FormatErrorMessage(nips.ErrorCodeRateLimited, "too many events in flight, slow down"))
+			}
 		case "CLOSE":
-			c.handleClose(arr)
+			// Closes wait for the REQ they close, so it can't open after them
+			pipeline.closeAfter(subID, func(droppedReq bool) {
+				if droppedReq && !c.hasSubscription(subID) {
+					c.sendClosed(subID, "")
+					return
+				}
+				c.handleCommand(ctx, cmdType, arr, frame)
+			})
 		default:
-			c.sendNotice("invalid: unknown command '" + cmdType + "'")
+			c.handleCommand(ctx, cmdType, arr, frame)
 		}
-		metrics.CommandProcessingDuration.WithLabelValues(cmdType).Observe(time.Since(start).Seconds())
 	}
 }
 
+// handleCommand handles a command other than EVENT, decoded as arr or, for a
+// REQ, split into frame
+func (c *WsConnection) handleCommand(ctx context.Context, cmdType string, arr []interface{}, frame []json.RawMessage) {
+	start := time.Now()
+	switch cmdType {
+	case "REQ":
+		c.session.Load().Add(sessions.Requests, 1)
+		c.handleRequest(ctx, frame)
+	case "COUNT":
+		c.session.Load().Add(sessions.Requests, 1)
+		c.handleCountRequest(ctx, arr)
+	case "CLOSE":
+		c.handleClose(arr)
+	case "AUTH":
+		c.handleAuth(arr)
+	case "RESUME":
+		c.handleResume(arr)
+	default:
+		c.sendNotice("invalid: unknown command '" + cmdType + "'")
+	}
+	metrics.CommandProcessingDuration.WithLabelValues(cmdType).Observe(time.Since(start).Seconds())
+}
+
 // processDispatcherEvents handles real-time events from the event dispatcher
 func (c *WsConnection) processDispatcherEvents() {
 	if c.eventChan == nil {
@@ -612,38 +713,56 @@ func (c *WsConnection) processDispatcherEvents() {
 		select {
 		case <-c.eventCtx.Done():
 			return
-		case event := <-c.eventChan:
-			if event == nil {
+		case live, ok := <-c.eventChan:
+			if !ok || live.Event == nil {
 				return // Channel closed
 			}
+			event := live.Event
 
 			// Check if connection is still active
 			if c.isClosed.Load() {
 				return
 			}
 
+			// Private capsules and share distributions go only to authenticated recipients
+			if !c.canReceive(event) {
+				continue
+			}
+
 			// Check if any subscription matches this event
+			delivered := false
 			c.subMu.RLock()
 			for subID, filters := range c.subscriptions {
 				for _, filter := range filters {
-					if c.eventMatchesFilter(event, filter) {
+					if eventMatchesFilter(event, filter) {
 						// Send event to client
-						c.sendMessage("EVENT", subID, event)
-						logger.Debug("Sent real-time event to client",
-							zap.String("sub_id", subID),
-							zap.String("event_id", event.ID),
-							zap.String("client", c.RemoteAddr()))
+						c.SendMessageNoRateLimit(encodeLiveEvent(subID, live))
+						delivered = true
+						if logger.DebugEnabled() {
+							logger.Debug("Sent real-time event to client",
+								zap.String("sub_id", subID),
+								zap.String("event_id", event.ID),
+								zap.String("client", c.RemoteAddr()))
+						}
 						break // Only send once per subscription
 					}
 				}
 			}
 			c.subMu.RUnlock()
+			if delivered && !live.IngestedAt.IsZero() {
+				metrics.LiveDeliveryLatency.Observe(time.Since(live.IngestedAt).Seconds())
+			}
 		}
 	}
 }
 
 // eventMatchesFilter checks if an event matches a subscription filter
-func (c *WsConnection) eventMatchesFilter(event *nostr.Event, filter nostr.Filter) bool {
+func eventMatchesFilter(event *nostr.Event, filter nostr.Filter) bool {
+	// "#unlocked" subscriptions are fed by the capsule unlock scheduler, not at publish time
+	if nips.WantsUnlockedCapsules(filter) {
+		return false
+	}
+
 	// Check IDs
 	if len(filter.IDs) > 0 {
 		found := false
@@ -719,6 +838,11 @@ func (c *WsConnection) eventMatchesFilter(event *nostr.Event, filter nostr.Filte
 		}
 	}
 
+	// Check search terms; the extensions are only applied to stored events
+	if filter.Search != "" && !nips.ParseSearch(filter.Search).MatchesContent(event.Content) {
+		return false
+	}
+
 	return true
 }
 
@@ -730,11 +854,15 @@ func (c *WsConnection) Close() {
 		if c.closeReason != "" {
 			logger.Debug("WebSocket connection closed",
 				zap.String("reason", c.closeReason),
+				zap.String("session_id", c.SessionID()),
 				zap.String("client_ip", c.RemoteAddr()),
 				zap.String("real_client_ip", c.realClientIP),
 				zap.Duration("connection_duration", time.Since(c.startTime)))
 		}
 
+		// Keep the subscriptions of clients holding a resume token
+		c.detachResume()
+
 		// Stop event dispatcher processing
 		if c.eventCancel != nil {
 			c.eventCancel()
@@ -755,6 +883,8 @@ func (c *WsConnection) Close() {
 		if !c.metricsDecremented.Swap(true) {
 			metrics.ActiveSubscriptions.Sub(float64(oldSubs))
 			metrics.DecrementActiveConnections()
+			c.node.TenantMeter().Disconnected(c.tenant)
+			c.node.Sessions().Disconnect(c.session.Load())
 		}
 
 		if c.pingTicker != nil {
@@ -767,7 +897,11 @@ func (c *WsConnection) Close() {
 
 		closeChan := make(chan struct{})
 		go func() {
-			msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, c.closeReason)
+			code := websocket.CloseNormalClosure
+			if c.restarting.Load() {
+				code = websocket.CloseServiceRestart
+			}
+			msg := websocket.FormatCloseMessage(code, c.closeReason)
 			c.writeMu.Lock()
 			_ = c.ws.SetWriteDeadline(time.Now().Add(time.Second))
 			_ = c.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
@@ -793,6 +927,17 @@ func (c *WsConnection) Close() {
 	})
 }
 
+// CloseForRestart closes the connection telling the client the relay is
+// restarting, so it reconnects rather than giving up
+func (c *WsConnection) CloseForRestart() {
+	if c.isClosed.Load() {
+		return
+	}
+	c.restarting.Store(true)
+	c.closeReason = "relay restarting"
+	c.Close()
+}
+
 // monitorConnection handles connection timeouts and cleanup
 func (c *WsConnection) monitorConnection(ctx context.Context) {
 	ticker := time.NewTicker(1 * time.Minute)
@@ -851,6 +996,12 @@ func (c *WsConnection) monitorConnection(ctx context.Context) {
 			}
 
 			c.writeMu.Unlock()
+
+			// Follow paid membership expiry and renewals
+			c.checkMembership(now)
+
+			// Messages of the day whose window opened since
+			c.sendMOTD(now)
 		}
 	}
 }
@@ -881,60 +1032,106 @@ func (c *WsConnection) RemoveSubscription(subID string) {
 		delete(c.subscriptions, subID)
 		metrics.DecrementActiveSubscriptions()
 	}
+	if query := c.queries[subID]; query != nil {
+		query.cancel()
+		delete(c.queries, subID)
+	}
 }
 
 // handleEvent processes EVENT commands
-func (c *WsConnection) handleEvent(ctx context.Context, arr []interface{}) {
-	if len(arr) < 2 {
-		c.sendNotice("Invalid event message: not enough elements")
+func (c *WsConnection) handleEvent(ctx context.Context, evt nostr.Event) {
+	// Private relays only accept events from authenticated members
+	if denial := c.privateAccessDenial(); denial != "" {
+		c.finishEvent(&evt, rejection(denial))
 		return
 	}
-
-	// Marshal the event data back to JSON
-	eventData, err := json.Marshal(arr[1])
-	if err != nil {
-		c.sendNotice("Invalid event: " + err.Error())
+	// NIP-62 requests to vanish delete their author's events before being stored
+	if evt.Kind == nips.KindVanishRequest {
+		c.finishEvent(&evt, c.handleVanishRequest(ctx, &evt))
 		return
 	}
-
-	var evt nostr.Event
-	if err := json.Unmarshal(eventData, &evt); err != nil {
-		c.sendNotice("Invalid event: " + err.Error())
+	// NIP-43 join requests redeem invite codes and are never stored
+	if evt.Kind == nips.KindJoinRequest && c.node.Config().Invites.Enabled {
+		c.finishEvent(&evt, c.handleJoinRequest(ctx, &evt))
 		return
 	}
+	c.finishEvent(&evt, c.acceptEvent(ctx, evt))
+}
+
+// acceptEvent runs an event past the write policies and validation, then stores
+// or broadcasts it
+func (c *WsConnection) acceptEvent(ctx context.Context, evt nostr.Event) domain.EventResult {
+	proving, denial := c.challengeDenial(&evt)
+	if denial != "" {
+		return rejection(denial)
+	}
+	quotaKeys, denial := c.writePolicyDenial(&evt)
+	if denial != "" {
+		return rejection(denial)
+	}
+	if denial := c.tenantDenial(&evt); denial != "" {
+		return rejection(denial)
+	}
+	if denial := c.vanishDenial(&evt); denial != "" {
+		return rejection(denial)
+	}
+	// Nothing can be checked for duplicates or stored while the database is down;
+	// ephemeral events need neither and keep being delivered
+	if !nips.IsEphemeral(evt.Kind) && !c.node.DB().Available() {
+		return rejection(nips.ErrDatabaseUnavailable)
+	}
 
 	// Use ValidateAndProcessEvent for comprehensive validation
-	valid, msg, err := c.node.GetValidator().ValidateAndProcessEvent(ctx, evt)
-	if err != nil {
-		c.sendOK(evt.ID, false, "error: "+err.Error())
-		return
+	result := c.node.GetValidator().ValidateAndProcessEvent(ctx, c.tenant, evt)
+	if result.Status != domain.EventAccepted {
+		return result
 	}
-	if !valid {
-		c.sendOK(evt.ID, false, msg)
-		return
+	// Shadow-banned authors are told their events were accepted, but nobody sees them
+	if s, suspended := c.node.Suspension(evt.PubKey); suspended && s.Shadow {
+		logger.Debug("Dropped event of shadow-banned pubkey",
+			zap.String("event_id", evt.ID),
+			zap.String("pubkey", evt.PubKey))
+		return result
 	}
 
-	// Queue the event for processing
-	if ok := c.node.GetEventProcessor().QueueEvent(evt); !ok {
-		c.sendOK(evt.ID, false, "server busy, try again")
-		return
+	if nips.IsEphemeral(evt.Kind) {
+		// Ephemeral events skip the processor and database and go straight to subscribers
+		if dispatcher := c.node.GetEventDispatcher(); dispatcher != nil && !dispatcher.BroadcastEphemeral(c.tenant, &evt) {
+			return domain.RejectEvent(nips.ErrorCodeRateLimited, "server busy, try again")
+		}
+	} else if c.node.Config().Relay.DurableWrites {
+		// Store synchronously so OK true is only sent for committed events
+		if err := c.node.GetEventProcessor().StoreEventSync(ctx, c.tenant, evt); err != nil {
+			logger.Warn("Failed to store event",
+				zap.String("event_id", evt.ID),
+				zap.Error(err))
+			return domain.FailEvent("failed to store event")
+		}
+	} else if ok := c.node.GetEventProcessor().QueueEvent(c.tenant, evt); !ok {
+		// Queue the event for processing
+		return c.queueFullRejection()
 	}
 
 	// Update metrics for successful event
 	metrics.EventsProcessed.WithLabelValues(fmt.Sprintf("%d", evt.Kind)).Inc()
-
-	// Send successful response
-	c.sendOK(evt.ID, true, "")
+	if quotaKeys != nil {
+		c.node.FreeQuota().Charge(quotaKeys...)
+	}
+	if proving {
+		c.passChallenge()
+	}
+	return result
 }
 
-// QueryEvents reads events from storage that match a given Nostr filter.
-func (c *WsConnection) QueryEvents(ctx context.Context, f nostr.Filter) ([]nostr.Event, error) {
+// QueryEvents reads events from storage that match a given Nostr filter,
+// reporting whether the recent events cache answered it.
+func (c *WsConnection) QueryEvents(ctx context.Context, f nostr.Filter) ([]nostr.Event, bool, error) {
 	logger.Debug("QueryEvents called with filter", zap.Any("filter", f))
 
-	results, err := c.node.DB().GetEvents(ctx, f)
+	results, cached, err := c.node.DB().ServeEvents(ctx, c.tenant, f)
 	if err != nil {
 		logger.Error("Error retrieving events from storage", zap.Error(err))
-		return nil, err
+		return nil, false, err
 	}
-	return results, nil
+	return results, cached, nil
 }
@@ -0,0 +1,147 @@
+package relay
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/domain"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/metrics"
+	"github.com/Shugur-Network/relay/internal/relay/nips"
+	"github.com/Shugur-Network/relay/internal/sessions"
+	"github.com/Shugur-Network/relay/internal/web"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+// decisionLogSize is how many refused events the decision log keeps
+const decisionLogSize = 1000
+
+// EventDecision is an event the relay refused or failed to handle, as kept in
+// the decision log
+type EventDecision struct {
+	domain.EventResult
+	EventID string `json:"event_id"`
+	PubKey  string `json:"pubkey"`
+	Kind    int    `json:"kind"`
+	Client  string `json:"client"`
+	Session string `json:"session,omitempty"`
+	At      int64  `json:"at"`
+}
+
+// decisionLog is a ring of the most recent decisions, oldest overwritten first
+type decisionLog struct {
+	mu      sync.Mutex
+	entries []EventDecision
+	next    int
+}
+
+// decisions is the decision log shared by every connection of this node
+var decisions = &decisionLog{entries: make([]EventDecision, 0, decisionLogSize)}
+
+// add records d, overwriting the oldest entry once the log is full
+func (l *decisionLog) add(d EventDecision) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.entries) < cap(l.entries) {
+		l.entries = append(l.entries, d)
+		return
+	}
+	l.entries[l.next] = d
+	l.next = (l.next + 1) % len(l.entries)
+}
+
+// recent returns up to limit decisions, newest first, keeping only those with the
+// given status when it isn't empty
+func (l *decisionLog) recent(limit int, status domain.EventStatus) []EventDecision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := []EventDecision{}
+	for i := 0; i < len(l.entries) && len(out) < limit; i++ {
+		// Walk back from the newest entry, just before next
+		d := l.entries[(l.next-1-i+2*len(l.entries))%len(l.entries)]
+		if status == "" || d.Status == status {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// rejection turns a reason in the NIP-01 "<code>: <message>" form into a result.
+// Reasons without a standard code are taken as invalid events.
+func rejection(reason string) domain.EventResult {
+	code, message, ok := strings.Cut(reason, ": ")
+	switch {
+	case !ok || !nips.IsStandardErrorCode(code):
+		return domain.RejectEvent(nips.ErrorCodeInvalidEvent, reason)
+	case code == nips.ErrorCodeDatabaseError:
+		return domain.FailEvent(message)
+	default:
+		return domain.RejectEvent(code, message)
+	}
+}
+
+// finishEvent answers an EVENT with its result: the OK response, the results
+// metric and, unless the event was taken, the decision log
+func (c *WsConnection) finishEvent(evt *nostr.Event, result domain.EventResult) {
+	c.sendOK(evt.ID, result.OK(), result.OKMessage())
+	metrics.EventResults.WithLabelValues(string(result.Status), result.Code).Inc()
+	if result.OK() {
+		c.session.Load().Add(sessions.EventsAccepted, 1)
+		return
+	}
+	c.session.Load().Add(sessions.EventsRejected, 1)
+
+	decision := EventDecision{
+		EventResult: result,
+		EventID:     evt.ID,
+		PubKey:      evt.PubKey,
+		Kind:        evt.Kind,
+		Client:      c.RemoteAddr(),
+		Session:     c.SessionID(),
+		At:          time.Now().Unix(),
+	}
+	decisions.add(decision)
+
+	if result.Status == domain.EventFailed {
+		logger.Warn("Event failed",
+			zap.String("event_id", evt.ID),
+			zap.Int("kind", evt.Kind),
+			zap.String("client", decision.Client),
+			zap.String("message", result.Message))
+	} else if logger.DebugEnabled() {
+		logger.Debug("Event rejected",
+			zap.String("event_id", evt.ID),
+			zap.Int("kind", evt.Kind),
+			zap.String("client", decision.Client),
+			zap.String("code", result.Code),
+			zap.String("message", result.Message))
+	}
+}
+
+// handleAdminDecisions lists (GET) the events recently refused or failed on this
+// node, newest first, up to limit (default 50, at most 1000), optionally only
+// those with the given status ("rejected" or "error")
+func (s *Server) handleAdminDecisions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	limit := 50
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 && v <= decisionLogSize {
+		limit = v
+	}
+	status := domain.EventStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "", domain.EventRejected, domain.EventFailed:
+	default:
+		web.WriteAdminError(w, http.StatusBadRequest, "status must be rejected or error")
+		return
+	}
+	web.WriteAdminJSON(w, http.StatusOK, decisions.recent(limit, status))
+}
@@ -0,0 +1,170 @@
+package relay
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/config"
+	"github.com/Shugur-Network/relay/internal/metrics"
+	nostr "github.com/nbd-wtf/go-nostr"
+)
+
+var (
+	validationOnce sync.Once
+	// validationSlots bounds the events validated at once across connections
+	validationSlots chan struct{}
+)
+
+// eventPipeline validates and stores a connection's EVENTs off the read loop,
+// one at a time so OKs are sent in the order the events came in. REQs and
+// COUNTs sent while EVENTs are in flight wait in the pipeline behind them, so a
+// client reads what it wrote before.
+type eventPipeline struct {
+	queue chan *pipelineJob
+	// pending counts the jobs queued or running; only the read loop adds to it
+	pending atomic.Int64
+
+	mu sync.Mutex
+	// waiting holds the queued REQs by subscription ID, for a CLOSE to drop
+	// them before they run
+	waiting map[string]*pipelineJob
+}
+
+// pipelineJob is an EVENT to validate and store, or a command run in its turn
+type pipelineJob struct {
+	evt     nostr.Event
+	command func()
+	subID   string
+	dropped atomic.Bool
+}
+
+// startEventPipeline starts the connection's pipeline. Its queue holds up to
+// RELAY.EVENT_PIPELINE jobs; what doesn't fit is refused rather than waited
+// for, so the read loop keeps reading CLOSEs. Closing it lets the events still
+// queued finish, so events sent right before a disconnect aren't lost.
+func (c *WsConnection) startEventPipeline(ctx context.Context, cfg config.RelayConfig) *eventPipeline {
+	validationOnce.Do(func() {
+		workers := cfg.ValidationWorkers
+		if workers <= 0 {
+			workers = 2 * runtime.NumCPU()
+		}
+		validationSlots = make(chan struct{}, workers)
+	})
+
+	p := &eventPipeline{
+		queue:   make(chan *pipelineJob, max(cfg.EventPipeline, 1)),
+		waiting: make(map[string]*pipelineJob),
+	}
+	go func() {
+		for job := range p.queue {
+			if job.command != nil {
+				p.forget(job)
+				if !job.dropped.Load() && !c.isClosed.Load() {
+					job.command()
+				}
+				p.pending.Add(-1)
+				continue
+			}
+			validationSlots <- struct{}{}
+			start := time.Now()
+			c.handleEvent(ctx, job.evt)
+			<-validationSlots
+			metrics.CommandProcessingDuration.WithLabelValues("EVENT").Observe(time.Since(start).Seconds())
+			p.pending.Add(-1)
+		}
+	}()
+	return p
+}
+
+// submit queues evt, false when the queue is full
+func (p *eventPipeline) submit(evt nostr.Event) bool {
+	return p.enqueue(&pipelineJob{evt: evt})
+}
+
+// after runs command once the jobs queued before it are done, right away when
+// there are none. subID names the subscription of a REQ, empty for a COUNT. It
+// returns false when the queue is full.
+func (p *eventPipeline) after(subID string, command func()) bool {
+	if p.pending.Load() == 0 {
+		command()
+		return true
+	}
+	job := &pipelineJob{command: command, subID: subID}
+	if subID != "" {
+		p.mu.Lock()
+		if previous := p.waiting[subID]; previous != nil {
+			// A REQ replaces the subscription of the one before it
+			previous.dropped.Store(true)
+		}
+		p.waiting[subID] = job
+		p.mu.Unlock()
+	}
+	if !p.enqueue(job) {
+		p.forget(job)
+		return false
+	}
+	return true
+}
+
+// closeAfter runs the CLOSE of subID once the jobs queued before it are done,
+// right away when there are none, so it never runs between a REQ leaving the
+// queue and its subscription being opened. A REQ of subID still queued is
+// dropped instead of run, and command is told so, as the client asked for that
+// subscription and sees it closed. When the queue is full the CLOSE runs right
+// away after dropping the queued REQ.
+func (p *eventPipeline) closeAfter(subID string, command func(droppedReq bool)) {
+	if p.pending.Load() == 0 {
+		command(false)
+		return
+	}
+	dropped := p.drop(subID)
+	if !p.enqueue(&pipelineJob{command: func() { command(dropped) }}) {
+		command(dropped)
+	}
+}
+
+// drop keeps the queued REQ of subID from running, for a CLOSE sent after it,
+// and reports whether there was one
+func (p *eventPipeline) drop(subID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	job := p.waiting[subID]
+	if job == nil {
+		return false
+	}
+	job.dropped.Store(true)
+	delete(p.waiting, subID)
+	return true
+}
+
+// forget removes job from the queued REQs
+func (p *eventPipeline) forget(job *pipelineJob) {
+	if job.subID == "" {
+		return
+	}
+	p.mu.Lock()
+	if p.waiting[job.subID] == job {
+		delete(p.waiting, job.subID)
+	}
+	p.mu.Unlock()
+}
+
+// enqueue queues job without waiting, false when the queue is full
+func (p *eventPipeline) enqueue(job *pipelineJob) bool {
+	p.pending.Add(1)
+	select {
+	case p.queue <- job:
+		return true
+	default:
+		p.pending.Add(-1)
+		return false
+	}
+}
+
+// close stops taking jobs; those queued still run
+func (p *eventPipeline) close() {
+	close(p.queue)
+}
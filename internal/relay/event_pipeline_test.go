@@ -0,0 +1,65 @@
+package relay
+
+import (
+	"testing"
+
+	nostr "github.com/nbd-wtf/go-nostr"
+)
+
+func TestEventPipelineOrdersReads(t *testing.T) {
+	p := &eventPipeline{queue: make(chan *pipelineJob, 2), waiting: make(map[string]*pipelineJob)}
+
+	ran := 0
+	if !p.after("sub", func() { ran++ }) || ran != 1 {
+		t.Fatal("a REQ with nothing in flight didn't run right away")
+	}
+
+	if !p.submit(nostr.Event{ID: "a"}) {
+		t.Fatal("an EVENT was refused with room in the queue")
+	}
+	if !p.after("sub", func() { ran++ }) || ran != 1 {
+		t.Fatal("a REQ ran before the EVENT sent ahead of it")
+	}
+	if p.submit(nostr.Event{ID: "b"}) {
+		t.Error("an EVENT was queued past the queue size")
+	}
+	if p.after("other", func() {}) {
+		t.Error("a REQ was queued past the queue size")
+	}
+
+	// A CLOSE keeps the queued REQ from running
+	if !p.drop("sub") {
+		t.Error("CLOSE found no queued REQ to drop")
+	}
+	<-p.queue
+	if job := <-p.queue; job.command == nil || !job.dropped.Load() {
+		t.Error("the queued REQ was not dropped by CLOSE")
+	}
+}
+
+func TestEventPipelineOrdersCloses(t *testing.T) {
+	p := &eventPipeline{queue: make(chan *pipelineJob, 3), waiting: make(map[string]*pipelineJob)}
+
+	var closes []bool
+	closeSub := func(droppedReq bool) { closes = append(closes, droppedReq) }
+	p.closeAfter("sub", closeSub)
+	if len(closes) != 1 || closes[0] {
+		t.Fatal("a CLOSE with nothing in flight didn't run right away")
+	}
+
+	p.submit(nostr.Event{ID: "a"})
+	p.after("sub", func() { t.Error("a REQ closed while queued ran") })
+	p.closeAfter("sub", closeSub)
+	if len(closes) != 1 {
+		t.Fatal("a CLOSE ran before the REQ queued ahead of it")
+	}
+	<-p.queue
+	if job := <-p.queue; !job.dropped.Load() {
+		t.Error("the queued REQ was not dropped by CLOSE")
+	}
+	job := <-p.queue
+	job.command()
+	if len(closes) != 2 || !closes[1] {
+		t.Error("the queued CLOSE wasn't told it dropped the REQ")
+	}
+}
@@ -14,41 +14,31 @@ import (
 func parseFilterFromRaw(raw interface{}) (nostr.Filter, error) {
 	var f nostr.Filter
 
-	// Step 1: Marshal the raw interface{} to JSON
-	data, err := json.Marshal(raw)
-	if err != nil {
-		return f, fmt.Errorf("failed to encode filter: %w", err)
+	// Step 1: Frames decoded lazily hand over the filter's JSON as is, anything
+	// else is marshaled back to JSON
+	var data []byte
+	switch v := raw.(type) {
+	case json.RawMessage:
+		data = v
+	default:
+		var err error
+		if data, err = json.Marshal(raw); err != nil {
+			return f, fmt.Errorf("failed to encode filter: %w", err)
+		}
 	}
 
-	// Step 2: Unmarshal into standard Filter struct
-	if err = json.Unmarshal(data, &f); err != nil {
+	// Step 2: Unmarshal into the Filter struct, which also collects the #tag
+	// fields into Tags
+	if err := f.UnmarshalJSON(data); err != nil {
 		return f, fmt.Errorf("failed to decode filter: %w", err)
 	}
 
-	// Step 3: Unmarshal into a map to extract #tag fields
-	var partial map[string]json.RawMessage
-	if err = json.Unmarshal(data, &partial); err != nil {
-		return f, fmt.Errorf("failed to decode partial: %w", err)
-	}
-
 	// Initialize Tags map if not already present
 	if f.Tags == nil {
 		f.Tags = make(map[string][]string)
 	}
 
-	// Step 4: Process each key that starts with "#" (e.g., "#p", "#e")
-	for k, v := range partial {
-		if len(k) > 1 && k[0] == '#' {
-			tagKey := k[1:] // Extract tag name (e.g., "#p" -> "p")
-			var arrVals []string
-			if err2 := json.Unmarshal(v, &arrVals); err2 == nil {
-				// Add tag values to the filter's Tags map
-				f.Tags[tagKey] = arrVals
-			}
-		}
-	}
-
-	// Step 5: Apply filter normalization
+	// Step 3: Apply filter normalization
 	normalizeFilter(&f)
 
 	return f, nil
@@ -0,0 +1,128 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"unsafe"
+
+	"github.com/Shugur-Network/relay/internal/storage"
+	"github.com/mailru/easyjson/jwriter"
+	nostr "github.com/nbd-wtf/go-nostr"
+)
+
+// jsonSpace is the whitespace allowed between JSON tokens
+const jsonSpace = " \t\r\n"
+
+// frameLabel returns the command label of a client frame, its first array
+// element, without decoding the frame. Escaped labels are decoded, so they
+// dispatch like plain ones. It returns "" when the frame doesn't start with a
+// string label, leaving it to the generic decode.
+func frameLabel(raw []byte) string {
+	rest := bytes.TrimLeft(raw, jsonSpace)
+	if len(rest) == 0 || rest[0] != '[' {
+		return ""
+	}
+	rest = bytes.TrimLeft(rest[1:], jsonSpace)
+	if len(rest) == 0 || rest[0] != '"' {
+		return ""
+	}
+	escaped := false
+	for i := 1; i < len(rest); i++ {
+		switch rest[i] {
+		case '\\':
+			escaped = true
+			i++
+		case '"':
+			if !escaped {
+				return string(rest[1:i])
+			}
+			var label string
+			if err := json.Unmarshal(rest[:i+1], &label); err != nil {
+				return ""
+			}
+			return label
+		}
+	}
+	return ""
+}
+
+// decodeEventFrame decodes the event of a client EVENT frame in a single pass
+func decodeEventFrame(raw []byte, evt *nostr.Event) error {
+	if len(raw) == 0 {
+		return errors.New("empty frame")
+	}
+
+	// Frames aren't modified once read and the decoder copies what it keeps, so
+	// the frame is parsed in place
+	var env nostr.EventEnvelope
+	if err := env.FromJSON(unsafe.String(unsafe.SliceData(raw), len(raw))); err != nil {
+		return err
+	}
+	if env.SubscriptionID != nil {
+		return errors.New("EVENT takes only the event")
+	}
+	*evt = env.Event
+	return nil
+}
+
+// encodeEvent encodes ["EVENT", subID, evt] without going through reflection
+func encodeEvent(subID string, evt *nostr.Event) []byte {
+	w := jwriter.Writer{NoEscapeHTML: true}
+	w.RawString(`["EVENT",`)
+	w.String(subID)
+	w.RawByte(',')
+	evt.MarshalEasyJSON(&w)
+	w.RawByte(']')
+	return buildFrame(&w)
+}
+
+// encodeLiveEvent encodes ["EVENT", subID, evt] for a dispatched event, around
+// the encoding of the event shared by every client it was dispatched to
+func encodeLiveEvent(subID string, live storage.LiveEvent) []byte {
+	if live.Raw == nil {
+		return encodeEvent(subID, live.Event)
+	}
+	// Sized up front, the frame is built in a single allocation
+	w := jwriter.Writer{NoEscapeHTML: true}
+	w.Buffer.Buf = make([]byte, 0, len(`["EVENT",`)+2*len(subID)+len(live.Raw)+4)
+	w.RawString(`["EVENT",`)
+	w.String(subID)
+	w.RawByte(',')
+	w.Raw(live.Raw, nil)
+	w.RawByte(']')
+	return buildFrame(&w)
+}
+
+// encodeOK encodes ["OK", eventID, accepted, message]
+func encodeOK(eventID string, accepted bool, message string) []byte {
+	w := jwriter.Writer{NoEscapeHTML: true}
+	w.RawString(`["OK",`)
+	w.String(eventID)
+	w.RawByte(',')
+	w.Bool(accepted)
+	w.RawByte(',')
+	w.String(message)
+	w.RawByte(']')
+	return buildFrame(&w)
+}
+
+// encodeStrings encodes a frame of label followed by string arguments, like
+// ["NOTICE", message] or ["CLOSED", subID, reason]
+func encodeStrings(label string, args ...string) []byte {
+	w := jwriter.Writer{NoEscapeHTML: true}
+	w.RawByte('[')
+	w.String(label)
+	for _, arg := range args {
+		w.RawByte(',')
+		w.String(arg)
+	}
+	w.RawByte(']')
+	return buildFrame(&w)
+}
+
+// buildFrame returns what w encoded; writing to memory can't fail
+func buildFrame(w *jwriter.Writer) []byte {
+	raw, _ := w.BuildBytes()
+	return raw
+}
@@ -0,0 +1,190 @@
+package relay
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Shugur-Network/relay/internal/storage"
+	nostr "github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	benchEventJSON  = `{"id":"a9f4bbd1d4e4a0ca4e2a4f6c0e6c1b9d8e2e5c3e7b0e5f4a3e2d1c0b9a8f7e6d","pubkey":"79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798","created_at":1700000000,"kind":1,"tags":[["e","5c83da77af1dec6d7289834998ad7aafbd9e2191396d75ec3cc27f5a77226f36"],["p","79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"],["t","nostr"]],"content":"hello from the benchmark","sig":"2d7b4c8a6e1f0a3b5c7d9e1f2a4b6c8d0e2f4a6b8c0d2e4f6a8b0c2d4e6f8a0b2d7b4c8a6e1f0a3b5c7d9e1f2a4b6c8d0e2f4a6b8c0d2e4f6a8b0c2d4e6f8a0b"}`
+	benchFilterJSON = `{"kinds":[1,6,7],"authors":["79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"],"#t":["nostr"],"since":1690000000,"limit":100}`
+)
+
+var (
+	benchEventFrame = []byte(`["EVENT",` + benchEventJSON + `]`)
+	benchReqFrame   = []byte(`["REQ","feed",` + benchFilterJSON + `]`)
+)
+
+// Allocation budgets of the hot message path; a change that goes over one
+// should be a deliberate trade-off, not an accident
+const (
+	budgetFrameLabel       = 1
+	budgetDecodeEventFrame = 14
+	budgetParseReqFrame    = 18
+	budgetEncodeEvent      = 5
+	budgetEncodeLiveEvent  = 1
+	budgetMatchFilter      = 0
+)
+
+func TestFrameLabel(t *testing.T) {
+	tests := []struct {
+		frame string
+		want  string
+	}{
+		{`["EVENT",{}]`, "EVENT"},
+		{" \n[ \t\"REQ\",\"sub\",{}]", "REQ"},
+		{`["\u0045VENT",{}]`, "EVENT"},
+		{`["R\u0045Q","sub",{}]`, "REQ"},
+		{`["CL\"OSE"]`, `CL"OSE`},
+		{`["\\"]`, `\`},
+		{`["\x"]`, ""},
+		{`["EVENT`, ""},
+		{`[1,"EVENT"]`, ""},
+		{`{"EVENT":1}`, ""},
+		{``, ""},
+	}
+	for _, tt := range tests {
+		if got := frameLabel([]byte(tt.frame)); got != tt.want {
+			t.Errorf("frameLabel(%q) = %q, want %q", tt.frame, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeLiveEvent(t *testing.T) {
+	var evt nostr.Event
+	if err := decodeEventFrame(benchEventFrame, &evt); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := evt.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := string(encodeEvent("sub", &evt))
+	if got := string(encodeLiveEvent("sub", storage.LiveEvent{Event: &evt, Raw: raw})); got != want {
+		t.Errorf("encodeLiveEvent = %s, want %s", got, want)
+	}
+	if got := string(encodeLiveEvent("sub", storage.LiveEvent{Event: &evt})); got != want {
+		t.Errorf("encodeLiveEvent without Raw = %s, want %s", got, want)
+	}
+}
+
+func TestHotPathAllocations(t *testing.T) {
+	var evt nostr.Event
+	if err := decodeEventFrame(benchEventFrame, &evt); err != nil {
+		t.Fatal(err)
+	}
+	filter, err := parseFilterFromRaw(json.RawMessage(benchFilterJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := evt.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := storage.LiveEvent{Event: &evt, Raw: raw}
+
+	tests := []struct {
+		name   string
+		budget float64
+		run    func()
+	}{
+		{"frameLabel", budgetFrameLabel, func() { frameLabel(benchEventFrame) }},
+		{"decodeEventFrame", budgetDecodeEventFrame, func() {
+			var e nostr.Event
+			_ = decodeEventFrame(benchEventFrame, &e)
+		}},
+		{"parseReqFrame", budgetParseReqFrame, func() { parseReqFrame(benchReqFrame) }},
+		{"encodeEvent", budgetEncodeEvent, func() { encodeEvent("feed", &evt) }},
+		{"encodeLiveEvent", budgetEncodeLiveEvent, func() { encodeLiveEvent("feed", live) }},
+		{"eventMatchesFilter", budgetMatchFilter, func() { eventMatchesFilter(&evt, filter) }},
+	}
+	for _, tt := range tests {
+		if allocs := testing.AllocsPerRun(100, tt.run); allocs > tt.budget {
+			t.Errorf("%s allocates %.0f times, budget %.0f", tt.name, allocs, tt.budget)
+		}
+	}
+}
+
+// parseReqFrame splits a REQ frame and decodes its filter, as HandleMessages and
+// handleRequest do
+func parseReqFrame(raw []byte) (string, nostr.Filter) {
+	var frame []json.RawMessage
+	if err := json.Unmarshal(raw, &frame); err != nil || len(frame) < 3 {
+		return "", nostr.Filter{}
+	}
+	var subID string
+	_ = json.Unmarshal(frame[1], &subID)
+	f, _ := parseFilterFromRaw(frame[2])
+	return subID, f
+}
+
+func BenchmarkFrameLabel(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		frameLabel(benchEventFrame)
+	}
+}
+
+func BenchmarkDecodeEventFrame(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchEventFrame)))
+	for i := 0; i < b.N; i++ {
+		var evt nostr.Event
+		if err := decodeEventFrame(benchEventFrame, &evt); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseReqFrame(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchReqFrame)))
+	for i := 0; i < b.N; i++ {
+		parseReqFrame(benchReqFrame)
+	}
+}
+
+func BenchmarkEncodeEvent(b *testing.B) {
+	var evt nostr.Event
+	if err := decodeEventFrame(benchEventFrame, &evt); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		encodeEvent("feed", &evt)
+	}
+}
+
+func BenchmarkEncodeLiveEvent(b *testing.B) {
+	var evt nostr.Event
+	if err := decodeEventFrame(benchEventFrame, &evt); err != nil {
+		b.Fatal(err)
+	}
+	raw, err := evt.MarshalJSON()
+	if err != nil {
+		b.Fatal(err)
+	}
+	live := storage.LiveEvent{Event: &evt, Raw: raw}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		encodeLiveEvent("feed", live)
+	}
+}
+
+func BenchmarkEventMatchesFilter(b *testing.B) {
+	var evt nostr.Event
+	if err := decodeEventFrame(benchEventFrame, &evt); err != nil {
+		b.Fatal(err)
+	}
+	filter, err := parseFilterFromRaw(json.RawMessage(benchFilterJSON))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		eventMatchesFilter(&evt, filter)
+	}
+}
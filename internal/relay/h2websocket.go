@@ -0,0 +1,176 @@
+package relay
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// h2WebSocketsEnabled reports whether the HTTP/2 server advertises RFC 8441
+// extended CONNECT, which Go only does with GODEBUG=http2xconnect=1 set when the
+// process starts
+func h2WebSocketsEnabled() bool {
+	return strings.Contains(os.Getenv("GODEBUG"), "http2xconnect=1")
+}
+
+// isExtendedConnect reports whether r opens a WebSocket on an HTTP/2 stream with
+// an RFC 8441 extended CONNECT
+func isExtendedConnect(r *http.Request) bool {
+	return r.ProtoMajor == 2 && r.Method == http.MethodConnect &&
+		strings.EqualFold(r.Header.Get(":protocol"), "websocket")
+}
+
+// serveH2WebSocket serves an extended CONNECT with upgrade, the handler of
+// HTTP/1.1 WebSocket upgrades. The request is presented as an HTTP/1.1 upgrade
+// and the stream as the hijacked connection; the stream stays open until the
+// WebSocket closes.
+func serveH2WebSocket(w http.ResponseWriter, r *http.Request, upgrade http.HandlerFunc) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	upgradeReq := r.Clone(r.Context())
+	upgradeReq.Method = http.MethodGet
+	upgradeReq.Header.Del(":protocol")
+	upgradeReq.Header.Set("Connection", "Upgrade")
+	upgradeReq.Header.Set("Upgrade", "websocket")
+	// The accept key derived from it is never sent: HTTP/2 answers with 200
+	upgradeReq.Header.Set("Sec-WebSocket-Key", base64.StdEncoding.EncodeToString(key))
+
+	hw := &h2Hijacker{ResponseWriter: w, r: r}
+	upgrade(hw, upgradeReq)
+	if hw.conn != nil {
+		<-hw.conn.closed
+	}
+}
+
+// h2Hijacker hands out the HTTP/2 stream of an extended CONNECT as a hijacked
+// connection
+type h2Hijacker struct {
+	http.ResponseWriter
+	r    *http.Request
+	conn *h2Conn
+}
+
+// Hijack returns the stream as a connection; the handshake response written to
+// it becomes the stream's 200 response
+func (h *h2Hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h.conn != nil {
+		return nil, nil, errors.New("stream already hijacked")
+	}
+	h.conn = &h2Conn{
+		w:      h.ResponseWriter,
+		body:   h.r.Body,
+		rc:     http.NewResponseController(h.ResponseWriter),
+		remote: h2Addr(h.r.RemoteAddr),
+		closed: make(chan struct{}),
+	}
+	if addr, ok := h.r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		h.conn.local = addr
+	}
+	return h.conn, bufio.NewReadWriter(bufio.NewReader(h.conn), bufio.NewWriter(h.conn)), nil
+}
+
+// h2Conn is an HTTP/2 stream used as a net.Conn: reads come from the request
+// body and writes go to the response, flushed as they are written
+type h2Conn struct {
+	w      http.ResponseWriter
+	body   io.ReadCloser
+	rc     *http.ResponseController
+	local  net.Addr
+	remote net.Addr
+
+	writeMu   sync.Mutex
+	responded bool
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// h2ResponseHeaders are the handshake headers that carry over to the HTTP/2
+// response; the others only make sense on an HTTP/1.1 upgrade
+var h2ResponseHeaders = map[string]bool{
+	"Sec-Websocket-Protocol":   true,
+	"Sec-Websocket-Extensions": true,
+}
+
+func (c *h2Conn) Read(p []byte) (int, error) {
+	return c.body.Read(p)
+}
+
+func (c *h2Conn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if !c.responded {
+		// The first write is the HTTP/1.1 handshake response
+		c.responded = true
+		tp := textproto.NewReader(bufio.NewReader(bytes.NewReader(p)))
+		if _, err := tp.ReadLine(); err != nil {
+			return 0, err
+		}
+		header, err := tp.ReadMIMEHeader()
+		if err != nil {
+			return 0, err
+		}
+		for name, values := range header {
+			if h2ResponseHeaders[name] {
+				c.w.Header()[name] = values
+			}
+		}
+		c.w.WriteHeader(http.StatusOK)
+		if err := c.rc.Flush(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	n, err := c.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, c.rc.Flush()
+}
+
+func (c *h2Conn) Close() error {
+	c.closeOnce.Do(func() {
+		_ = c.body.Close()
+		close(c.closed)
+	})
+	return nil
+}
+
+func (c *h2Conn) LocalAddr() net.Addr  { return c.local }
+func (c *h2Conn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *h2Conn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+func (c *h2Conn) SetReadDeadline(t time.Time) error {
+	return c.rc.SetReadDeadline(t)
+}
+
+func (c *h2Conn) SetWriteDeadline(t time.Time) error {
+	return c.rc.SetWriteDeadline(t)
+}
+
+// h2Addr is the peer address of an HTTP/2 stream
+type h2Addr string
+
+func (a h2Addr) Network() string { return "tcp" }
+func (a h2Addr) String() string  { return string(a) }
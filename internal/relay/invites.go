@@ -0,0 +1,290 @@
+package relay
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/domain"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/relay/nips"
+	"github.com/Shugur-Network/relay/internal/storage"
+	"github.com/Shugur-Network/relay/internal/web"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+const (
+	// inviteCodeBytes is the entropy of a generated invite code, 16 base32 characters
+	inviteCodeBytes = 10
+	// maxInviteBatch bounds the codes generated by one admin request
+	maxInviteBatch = 100
+	// maxInviteNote bounds the operator note stored with a code
+	maxInviteNote = 256
+)
+
+// inviteEncoding renders invite codes without padding so they are easy to type
+var inviteEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// inviteRedeemRequest is the body accepted by POST /api/invites/redeem
+type inviteRedeemRequest struct {
+	Code   string `json:"code"`
+	PubKey string `json:"pubkey"`
+}
+
+// inviteRedeemResponse is the body returned by POST /api/invites/redeem
+type inviteRedeemResponse struct {
+	PubKey string `json:"pubkey"`
+	// PaidUntil is the unix time admission lapses, 0 for no expiry
+	PaidUntil int64 `json:"paid_until"`
+}
+
+// inviteCreateRequest is the body accepted by POST /api/admin/invites. Omitted
+// fields fall back to the INVITES defaults.
+type inviteCreateRequest struct {
+	// Count is how many codes to generate, 1 when omitted
+	Count int `json:"count,omitempty"`
+	// MaxUses is how many pubkeys may redeem each code, 0 for any number
+	MaxUses *int64 `json:"max_uses,omitempty"`
+	// ExpiresIn is how many seconds the codes can be redeemed, 0 for never
+	ExpiresIn *int64 `json:"expires_in,omitempty"`
+	// Period is how many seconds a redemption admits its pubkey, 0 for good
+	Period *int64 `json:"period,omitempty"`
+	Note   string `json:"note,omitempty"`
+}
+
+// handleInvites routes the public invite API under /api/invites/
+func (s *Server) handleInvites(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if !s.fullCfg.Invites.Enabled {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch strings.TrimPrefix(r.URL.Path, "/api/invites/") {
+	case "redeem":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.handleRedeemInvite(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleRedeemInvite serves POST /api/invites/redeem: spends one use of an invite
+// code to admit the pubkey
+func (s *Server) handleRedeemInvite(w http.ResponseWriter, r *http.Request) {
+	var req inviteRedeemRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPaymentRequestBody)).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if !pubkeyPattern.MatchString(req.PubKey) {
+		http.Error(w, "pubkey must be 64 hex characters", http.StatusBadRequest)
+		return
+	}
+
+	pubkey := strings.ToLower(req.PubKey)
+	until, err := redeemInvite(r.Context(), s.node, req.Code, pubkey)
+	switch {
+	case errors.Is(err, storage.ErrInviteNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, storage.ErrInviteExpired), errors.Is(err, storage.ErrInviteExhausted):
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	case errors.Is(err, storage.ErrInviteRedeemed):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(inviteRedeemResponse{PubKey: pubkey, PaidUntil: until}); err != nil {
+		logger.Error("Failed to encode invite redemption", zap.Error(err))
+	}
+}
+
+// handleJoinRequest redeems the invite code claimed by a NIP-43 join request for
+// its author. The request carries the code, so it is never stored or broadcast.
+func (c *WsConnection) handleJoinRequest(ctx context.Context, evt *nostr.Event) domain.EventResult {
+	code, err := nips.JoinRequestClaim(evt)
+	if err != nil {
+		return domain.RejectEvent(nips.ErrorCodeInvalidEvent, err.Error())
+	}
+
+	_, err = redeemInvite(ctx, c.node, code, evt.PubKey)
+	switch {
+	case errors.Is(err, storage.ErrInviteNotFound), errors.Is(err, storage.ErrInviteExpired),
+		errors.Is(err, storage.ErrInviteExhausted), errors.Is(err, storage.ErrInviteRedeemed):
+		return domain.RejectEvent(nips.ErrorCodeRestricted, err.Error())
+	case err != nil:
+		return domain.FailEvent("failed to redeem invite code")
+	}
+
+	// An author already authenticated on this connection gets the paid profile now
+	if c.AuthedPubkey() == evt.PubKey {
+		c.applyRateLimitProfile(c.node.ClassifyClient(evt.PubKey))
+	}
+	return domain.AcceptEvent()
+}
+
+// redeemInvite spends one use of code on pubkey and admits it on this node; other
+// nodes pick the admission up on their next paid pubkey refresh
+func redeemInvite(ctx context.Context, node domain.NodeInterface, code, pubkey string) (int64, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	until, err := node.DB().RedeemInvite(ctx, code, pubkey, time.Now().Unix())
+	if err != nil {
+		if !errors.Is(err, storage.ErrInviteNotFound) && !errors.Is(err, storage.ErrInviteExpired) &&
+			!errors.Is(err, storage.ErrInviteExhausted) && !errors.Is(err, storage.ErrInviteRedeemed) {
+			logger.Error("Failed to redeem invite code", zap.String("pubkey", pubkey), zap.Error(err))
+		}
+		return 0, err
+	}
+	// Invites extend admission without changing the pubkey's tier
+	current, _ := node.PaidAdmission(pubkey)
+	node.SetPaid(pubkey, until, current.Tier)
+
+	logger.Info("Redeemed invite code", zap.String("pubkey", pubkey), zap.Int64("paid_until", until))
+	return until, nil
+}
+
+// handleAdminInvites lists (GET) or generates (POST) invite codes
+func (s *Server) handleAdminInvites(w http.ResponseWriter, r *http.Request) {
+	if !s.fullCfg.Invites.Enabled {
+		web.WriteAdminError(w, http.StatusNotFound, "invites are not enabled")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		invites, err := s.node.DB().ListInvites(r.Context())
+		if err != nil {
+			web.WriteAdminError(w, http.StatusInternalServerError, "failed to load invite codes")
+			return
+		}
+		web.WriteAdminJSON(w, http.StatusOK, invites)
+
+	case http.MethodPost:
+		var req inviteCreateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			web.WriteAdminError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		invites, err := s.newInvites(req)
+		if err != nil {
+			web.WriteAdminError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := s.node.DB().CreateInvites(r.Context(), invites); err != nil {
+			web.WriteAdminError(w, http.StatusInternalServerError, "failed to record invite codes")
+			return
+		}
+
+		logger.Info("Generated invite codes", zap.Int("count", len(invites)), zap.String("note", req.Note))
+		web.WriteAdminJSON(w, http.StatusCreated, invites)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleAdminInvite revokes (DELETE) an invite code
+func (s *Server) handleAdminInvite(w http.ResponseWriter, r *http.Request, code string) {
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", "DELETE")
+		web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	code = strings.ToUpper(code)
+	err := s.node.DB().DeleteInvite(r.Context(), code)
+	if errors.Is(err, storage.ErrInviteNotFound) {
+		web.WriteAdminError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		web.WriteAdminError(w, http.StatusInternalServerError, "failed to revoke invite code")
+		return
+	}
+
+	logger.Info("Revoked invite code", zap.String("code", code))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// newInvites generates the codes described by req, filling omitted fields from
+// the INVITES defaults
+func (s *Server) newInvites(req inviteCreateRequest) ([]storage.InviteCode, error) {
+	defaults := s.fullCfg.Invites
+	if req.Count == 0 {
+		req.Count = 1
+	}
+	if req.Count < 0 || req.Count > maxInviteBatch {
+		return nil, fmt.Errorf("count must be between 1 and %d", maxInviteBatch)
+	}
+	if len(req.Note) > maxInviteNote {
+		return nil, fmt.Errorf("note must be at most %d characters", maxInviteNote)
+	}
+
+	maxUses := int64(defaults.DefaultMaxUses)
+	if req.MaxUses != nil {
+		maxUses = *req.MaxUses
+	}
+	expiresIn := int64(defaults.DefaultExpiry.Seconds())
+	if req.ExpiresIn != nil {
+		expiresIn = *req.ExpiresIn
+	}
+	period := int64(defaults.DefaultPeriod.Seconds())
+	if req.Period != nil {
+		period = *req.Period
+	}
+	if maxUses < 0 || expiresIn < 0 || period < 0 {
+		return nil, fmt.Errorf("max_uses, expires_in and period must not be negative")
+	}
+
+	now := time.Now().Unix()
+	var expiresAt int64
+	if expiresIn > 0 {
+		expiresAt = now + expiresIn
+	}
+	invites := make([]storage.InviteCode, 0, req.Count)
+	for i := 0; i < req.Count; i++ {
+		code, err := generateInviteCode()
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, storage.InviteCode{
+			Code:      code,
+			MaxUses:   maxUses,
+			ExpiresAt: expiresAt,
+			Period:    period,
+			Note:      req.Note,
+			CreatedAt: now,
+		})
+	}
+	return invites, nil
+}
+
+// generateInviteCode returns a random, unguessable invite code
+func generateInviteCode() (string, error) {
+	b := make([]byte, inviteCodeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate invite code: %w", err)
+	}
+	return inviteEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,73 @@
+package relay
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/limiter"
+)
+
+// checkMembership keeps an authenticated client's rate limit profile in line with
+// its paid admission, so a lapsed membership falls back to the authenticated
+// profile and a renewed or changed tier takes effect. One renewal NOTICE is sent
+// once the membership is within PAYMENTS.RENEWAL_NOTICE of lapsing, and one more
+// when it lapses into PAYMENTS.GRACE_PERIOD.
+func (c *WsConnection) checkMembership(now time.Time) {
+	pubkey := c.AuthedPubkey()
+	if pubkey == "" {
+		return
+	}
+	cfg := c.node.Config()
+	class := c.node.ClassifyClient(pubkey)
+	paid, active := c.node.PaidAdmission(pubkey)
+
+	c.authMu.RLock()
+	previous, tier := c.clientClass, c.paidTier
+	renewalNoticed, graceNoticed := c.renewalNoticed, c.graceNoticed
+	c.authMu.RUnlock()
+
+	if class != previous || (class == limiter.ClassPaid && paid.Tier != tier) {
+		c.applyRateLimitProfile(class)
+		if previous == limiter.ClassPaid && class == limiter.ClassAuthenticated {
+			msg := "your membership has lapsed"
+			if ways := admissionWays(cfg); ways != "" {
+				msg += ", " + ways + " to renew"
+			}
+			c.sendNotice(msg)
+		}
+	}
+
+	if class != limiter.ClassPaid || !active || paid.PaidUntil == 0 {
+		return
+	}
+	lapse := time.Unix(paid.PaidUntil, 0)
+	membership := "membership"
+	if cfg.Payments.Tier(paid.Tier) != nil {
+		membership = paid.Tier + " membership"
+	}
+
+	var msg string
+	switch window := cfg.Payments.RenewalNotice; {
+	case !now.Before(lapse):
+		if paid.PaidUntil == graceNoticed {
+			return
+		}
+		c.authMu.Lock()
+		c.graceNoticed = paid.PaidUntil
+		c.authMu.Unlock()
+		grace := lapse.Add(cfg.Payments.GracePeriod)
+		msg = fmt.Sprintf("your %s lapsed at %s, you may keep publishing until %s",
+			membership, lapse.UTC().Format(time.RFC3339), grace.UTC().Format(time.RFC3339))
+	case window > 0 && lapse.Sub(now) <= window && paid.PaidUntil != renewalNoticed:
+		c.authMu.Lock()
+		c.renewalNoticed = paid.PaidUntil
+		c.authMu.Unlock()
+		msg = fmt.Sprintf("your %s expires at %s", membership, lapse.UTC().Format(time.RFC3339))
+	default:
+		return
+	}
+	if ways := admissionWays(cfg); ways != "" {
+		msg += ", " + ways + " to renew"
+	}
+	c.sendNotice(msg)
+}
@@ -0,0 +1,75 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/Shugur-Network/relay/internal/config"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"go.uber.org/zap"
+)
+
+// internetIdentifierPattern matches NIP-05 identifiers and lightning addresses,
+// name@domain
+var internetIdentifierPattern = regexp.MustCompile(`^[a-zA-Z0-9._+-]+@([a-zA-Z0-9-]+\.)+[a-zA-Z0-9-]{2,}$`)
+
+// checkMetadata checks kind 0 metadata content against the ruleset of policy
+func checkMetadata(content string, policy config.MetadataPolicy) error {
+	var metadata map[string]interface{}
+	if err := json.Unmarshal([]byte(content), &metadata); err != nil {
+		return fmt.Errorf("metadata must be a valid JSON object: %w", err)
+	}
+
+	for _, field := range policy.Fields {
+		raw, ok := metadata[field.Name]
+		if !ok || raw == nil {
+			continue
+		}
+		value, ok := raw.(string)
+		if !ok {
+			if policy.Strict() {
+				return fmt.Errorf("%s field must be a string", field.Name)
+			}
+			continue
+		}
+
+		if field.MaxLength > 0 && utf8.RuneCountInString(value) > field.MaxLength {
+			return fmt.Errorf("%s field too long (max %d characters)", field.Name, field.MaxLength)
+		}
+		if err := checkMetadataFormat(value, field.Format); err != nil {
+			if policy.Strict() {
+				return fmt.Errorf("%s field %w", field.Name, err)
+			}
+			logger.Debug("Accepting metadata with a malformed field",
+				zap.String("field", field.Name),
+				zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// checkMetadataFormat checks a non-empty metadata value against format
+func checkMetadataFormat(value, format string) error {
+	if value == "" {
+		return nil
+	}
+	switch format {
+	case "url":
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("must be an http or https URL")
+		}
+	case "nip05":
+		if !internetIdentifierPattern.MatchString(value) {
+			return fmt.Errorf("must be a NIP-05 identifier (name@domain)")
+		}
+	case "lud16":
+		if !internetIdentifierPattern.MatchString(value) {
+			return fmt.Errorf("must be a lightning address (name@domain)")
+		}
+	}
+	return nil
+}
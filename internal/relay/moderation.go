@@ -0,0 +1,155 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/storage"
+	"github.com/Shugur-Network/relay/internal/web"
+	"go.uber.org/zap"
+)
+
+// maxReportsListed bounds the targets and reports one moderation request lists
+const maxReportsListed = 1000
+
+// reportResolutionRequest is the body accepted by POST /api/admin/reports/<target>
+type reportResolutionRequest struct {
+	// Action is "dismiss", or "shadow-ban" or "blacklist" to suspend the
+	// reported pubkey, the author of a reported event
+	Action string `json:"action"`
+	// Note is kept with the resolution, and sent to a blacklisted pubkey as
+	// the reason of its suspension
+	Note string `json:"note,omitempty"`
+}
+
+// reportsLimit reads the limit query parameter of the moderation endpoints
+func reportsLimit(r *http.Request) int {
+	limit := 100
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 && v <= maxReportsListed {
+		limit = v
+	}
+	return limit
+}
+
+// handleAdminReports lists (GET) the targets with open NIP-56 reports
+func (s *Server) handleAdminReports(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !s.fullCfg.RelayPolicy.Moderation.Enabled {
+		web.WriteAdminError(w, http.StatusNotFound, "moderation is not enabled")
+		return
+	}
+
+	queue, err := s.node.DB().GetReportQueue(r.Context(), reportsLimit(r))
+	if err != nil {
+		web.WriteAdminError(w, http.StatusInternalServerError, "failed to load report queue")
+		return
+	}
+	web.WriteAdminJSON(w, http.StatusOK, queue)
+}
+
+// handleAdminReportTarget lists (GET) the reports of an event or pubkey, or
+// resolves them (POST)
+func (s *Server) handleAdminReportTarget(w http.ResponseWriter, r *http.Request, target string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !s.fullCfg.RelayPolicy.Moderation.Enabled {
+		web.WriteAdminError(w, http.StatusNotFound, "moderation is not enabled")
+		return
+	}
+	if !pubkeyPattern.MatchString(target) {
+		web.WriteAdminError(w, http.StatusBadRequest, "target must be an event id or pubkey of 64 hex characters")
+		return
+	}
+	target = strings.ToLower(target)
+
+	if r.Method == http.MethodGet {
+		reports, err := s.node.DB().GetReports(r.Context(), target, reportsLimit(r))
+		if err != nil {
+			web.WriteAdminError(w, http.StatusInternalServerError, "failed to load reports")
+			return
+		}
+		web.WriteAdminJSON(w, http.StatusOK, reports)
+		return
+	}
+
+	var req reportResolutionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.WriteAdminError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.Action != "dismiss" && req.Action != "shadow-ban" && req.Action != "blacklist" {
+		web.WriteAdminError(w, http.StatusBadRequest, `action must be "dismiss", "shadow-ban" or "blacklist"`)
+		return
+	}
+	if len(req.Note) > maxSuspensionReason {
+		web.WriteAdminError(w, http.StatusBadRequest, fmt.Sprintf("note must be at most %d characters", maxSuspensionReason))
+		return
+	}
+
+	// A pubkey is the target of its own reports; an event, of its stored author's
+	var pubkey string
+	if req.Action != "dismiss" {
+		var err error
+		pubkey, err = s.node.DB().GetReportedPubkey(r.Context(), target)
+		switch {
+		case errors.Is(err, storage.ErrReportsNotFound):
+			web.WriteAdminError(w, http.StatusNotFound, err.Error())
+			return
+		case errors.Is(err, storage.ErrReportedEventNotFound):
+			web.WriteAdminError(w, http.StatusConflict, err.Error())
+			return
+		case err != nil:
+			web.WriteAdminError(w, http.StatusInternalServerError, "failed to load reported pubkey")
+			return
+		}
+	}
+
+	resolution := storage.ReportResolution{
+		Target:     target,
+		Action:     req.Action,
+		Note:       strings.TrimSpace(req.Note),
+		ResolvedAt: time.Now().Unix(),
+	}
+	err := s.node.DB().ResolveReports(r.Context(), resolution)
+	if errors.Is(err, storage.ErrReportsNotFound) {
+		web.WriteAdminError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		web.WriteAdminError(w, http.StatusInternalServerError, "failed to resolve reports")
+		return
+	}
+
+	if req.Action != "dismiss" {
+		suspension := storage.Suspension{
+			PubKey:      pubkey,
+			Reason:      resolution.Note,
+			SuspendedAt: resolution.ResolvedAt,
+			Shadow:      req.Action == "shadow-ban",
+		}
+		if err := s.node.DB().SuspendPubkey(r.Context(), suspension); err != nil {
+			web.WriteAdminError(w, http.StatusInternalServerError, "failed to record suspension")
+			return
+		}
+		s.node.Suspend(suspension)
+	}
+
+	logger.Info("Resolved reports",
+		zap.String("target", resolution.Target),
+		zap.String("action", resolution.Action),
+		zap.String("note", resolution.Note))
+	web.WriteAdminJSON(w, http.StatusOK, resolution)
+}
@@ -0,0 +1,16 @@
+package relay
+
+import (
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/sessions"
+)
+
+// sendMOTD sends the client the messages of the day its session is due, so
+// reconnecting doesn't repeat them. Clients behind one address are told apart
+// once they authenticate; until then they share the session of the address.
+func (c *WsConnection) sendMOTD(now time.Time) {
+	for _, text := range c.node.MOTD().Due(sessions.ID(c.realClientIP, c.AuthedPubkey()), now) {
+		c.sendNotice(text)
+	}
+}
@@ -0,0 +1,71 @@
+package nips
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	nostr "github.com/nbd-wtf/go-nostr"
+)
+
+// KindBlossomAuth is the kind of Blossom (BUD-01) authorization events
+const KindBlossomAuth = 24242
+
+// ParseBlossomAuthHeader decodes the event carried in an "Authorization: Nostr
+// <base64 event>" header
+func ParseBlossomAuthHeader(header string) (*nostr.Event, error) {
+	encoded, ok := strings.CutPrefix(header, "Nostr ")
+	if !ok {
+		return nil, fmt.Errorf("missing Nostr authorization")
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		if raw, err = base64.RawURLEncoding.DecodeString(strings.TrimSpace(encoded)); err != nil {
+			return nil, fmt.Errorf("authorization is not valid base64")
+		}
+	}
+	var evt nostr.Event
+	if err := json.Unmarshal(raw, &evt); err != nil {
+		return nil, fmt.Errorf("authorization is not a valid event")
+	}
+	return &evt, nil
+}
+
+// ValidateBlossomAuth validates a Blossom authorization event for the verb ("upload",
+// "delete", "list", "get"). When sha256 is set the event must carry a matching x tag.
+func ValidateBlossomAuth(evt *nostr.Event, verb, sha256 string) error {
+	if evt.Kind != KindBlossomAuth {
+		return fmt.Errorf("invalid event kind for authorization: %d", evt.Kind)
+	}
+	if ok, err := evt.CheckSignature(); err != nil || !ok {
+		return fmt.Errorf("invalid signature")
+	}
+
+	now := time.Now()
+	if time.Unix(int64(evt.CreatedAt), 0).After(now.Add(AuthMaxClockSkew)) {
+		return fmt.Errorf("created_at is in the future")
+	}
+	expTag := evt.Tags.Find("expiration")
+	if expTag == nil {
+		return fmt.Errorf("missing expiration tag")
+	}
+	if exp, err := strconv.ParseInt(expTag[1], 10, 64); err != nil || exp <= now.Unix() {
+		return fmt.Errorf("authorization has expired")
+	}
+
+	if tTag := evt.Tags.Find("t"); tTag == nil || tTag[1] != verb {
+		return fmt.Errorf("authorization is not for %s", verb)
+	}
+	if sha256 == "" {
+		return nil
+	}
+	for _, tag := range evt.Tags {
+		if len(tag) >= 2 && tag[0] == "x" && tag[1] == sha256 {
+			return nil
+		}
+	}
+	return fmt.Errorf("authorization does not cover blob %s", sha256)
+}
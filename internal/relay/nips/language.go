@@ -0,0 +1,137 @@
+package nips
+
+import (
+	"strings"
+	"unicode"
+)
+
+// minLanguageLetters is how many letters a text needs for its language to be told
+const minLanguageLetters = 8
+
+// scriptLanguages are scripts written in one main language
+var scriptLanguages = []struct {
+	script   *unicode.RangeTable
+	language string
+}{
+	{unicode.Hangul, "ko"},
+	{unicode.Thai, "th"},
+	{unicode.Greek, "el"},
+	{unicode.Hebrew, "he"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Bengali, "bn"},
+	{unicode.Tamil, "ta"},
+	{unicode.Georgian, "ka"},
+	{unicode.Armenian, "hy"},
+}
+
+// stopWords are frequent words of the languages written in Latin script, told
+// apart by which of them a text uses most
+var stopWords = map[string][]string{
+	"en": {"the", "and", "is", "are", "was", "of", "to", "that", "it", "for", "with", "this", "you", "not", "have", "be"},
+	"es": {"el", "los", "las", "que", "y", "es", "por", "para", "con", "una", "del", "pero", "muy", "como", "está"},
+	"pt": {"os", "que", "e", "não", "em", "um", "uma", "para", "com", "é", "mas", "você", "muito", "do", "da"},
+	"fr": {"le", "les", "des", "et", "est", "que", "un", "une", "pour", "pas", "dans", "ce", "je", "vous", "qui", "avec"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ich", "du", "ein", "eine", "zu", "mit", "den", "auf", "sich", "auch"},
+	"it": {"il", "gli", "di", "che", "è", "un", "una", "per", "non", "con", "sono", "della", "ma", "anche", "questo"},
+	"nl": {"het", "een", "en", "van", "is", "dat", "niet", "ik", "je", "op", "te", "met", "zijn", "voor", "maar", "ook"},
+}
+
+// stopWordLanguages maps each stop word to the languages using it
+var stopWordLanguages = func() map[string][]string {
+	index := make(map[string][]string)
+	for language, words := range stopWords {
+		for _, word := range words {
+			index[word] = append(index[word], language)
+		}
+	}
+	return index
+}()
+
+// DetectLanguage returns the ISO 639-1 code of the language text is written in,
+// empty when the text is too short or its language unclear. Languages with a
+// script of their own are told by script, Latin script languages by their most
+// frequent words.
+func DetectLanguage(text string) string {
+	var letters, kana, han, cyrillic, arabic, latin int
+	scripts := make([]int, len(scriptLanguages))
+	ukrainian, persian := false, false
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+			ukrainian = ukrainian || strings.ContainsRune("іїєґІЇЄҐ", r)
+		case unicode.Is(unicode.Arabic, r):
+			arabic++
+			persian = persian || strings.ContainsRune("پچژگ", r)
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		default:
+			for i, s := range scriptLanguages {
+				if unicode.Is(s.script, r) {
+					scripts[i]++
+					break
+				}
+			}
+		}
+	}
+	if letters < minLanguageLetters {
+		return ""
+	}
+
+	dominant := func(count int) bool { return count*2 >= letters }
+	switch {
+	case kana > 0 && dominant(kana+han):
+		return "ja"
+	case dominant(han):
+		return "zh"
+	case dominant(cyrillic) && ukrainian:
+		return "uk"
+	case dominant(cyrillic):
+		return "ru"
+	case dominant(arabic) && persian:
+		return "fa"
+	case dominant(arabic):
+		return "ar"
+	case dominant(latin):
+		return latinLanguage(text)
+	}
+	for i, s := range scriptLanguages {
+		if dominant(scripts[i]) {
+			return s.language
+		}
+	}
+	return ""
+}
+
+// latinLanguage tells the language of a Latin script text by its stop words,
+// requiring two of them and a clear lead over the next language
+func latinLanguage(text string) string {
+	scores := make(map[string]int)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		for _, language := range stopWordLanguages[word] {
+			scores[language]++
+		}
+	}
+
+	best, bestScore, runnerUp := "", 0, 0
+	for language, score := range scores {
+		switch {
+		case score > bestScore:
+			best, bestScore, runnerUp = language, score, bestScore
+		case score > runnerUp:
+			runnerUp = score
+		}
+	}
+	if bestScore < 2 || bestScore == runnerUp {
+		return ""
+	}
+	return best
+}
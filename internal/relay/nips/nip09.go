@@ -2,6 +2,8 @@ package nips
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/Shugur-Network/relay/internal/logger"
 	"github.com/Shugur-Network/relay/internal/relay/nips/common"
@@ -20,12 +22,12 @@ func ValidateEventDeletion(evt *nostr.Event) error {
 		5,                // Expected event kind
 		"event deletion", // Event name for logging
 		func(helper *common.ValidationHelper, event *nostr.Event) error {
-			// Must have at least one "e" tag referencing the event(s) to delete
-			if err := helper.ValidateRequiredTag(event, "e"); err != nil {
-				return helper.ErrorFormatter.FormatError("deletion event must reference at least one event with 'e' tag")
+			// Must reference at least one event ("e") or address ("a") to delete
+			if !helper.HasTag(event, "e") && !helper.HasTag(event, "a") {
+				return helper.ErrorFormatter.FormatError("deletion event must reference at least one event with 'e' tag or address with 'a' tag")
 			}
 
-			// Validate event ID format in "e" tags and count them
+			// Validate event ID format in "e" tags, address format in "a" tags and count them
 			eventCount := 0
 			for _, tag := range event.Tags {
 				if len(tag) >= 2 && tag[0] == "e" {
@@ -37,6 +39,12 @@ func ValidateEventDeletion(evt *nostr.Event) error {
 						return helper.FormatTagError("e", "invalid event ID: %v", err)
 					}
 				}
+				if len(tag) >= 2 && tag[0] == "a" {
+					eventCount++
+					if _, _, _, err := ParseDeletionAddress(tag[1]); err != nil {
+						return helper.FormatTagError("a", "%v", err)
+					}
+				}
 			}
 
 			// Log the count of target events for debugging
@@ -50,7 +58,8 @@ func ValidateEventDeletion(evt *nostr.Event) error {
 }
 
 // ValidateDeletionAuth returns an error if any "e"‑tagged event in `tags`
-// is ALREADY KNOWN (lookup(id) ⇒ author) and its author differs from `deleter`.
+// is ALREADY KNOWN (lookup(id) ⇒ author) and its author differs from `deleter`,
+// or if any "a"‑tagged address belongs to another pubkey.
 func ValidateDeletionAuth(
 	tags []nostr.Tag,
 	deleter string,
@@ -63,10 +72,61 @@ func ValidateDeletionAuth(
 				return fmt.Errorf("unauthorized delete of %s", id)
 			}
 		}
+		if len(t) >= 2 && t[0] == "a" {
+			if _, pubkey, _, err := ParseDeletionAddress(t[1]); err == nil && pubkey != deleter {
+				return fmt.Errorf("unauthorized delete of %s", t[1])
+			}
+		}
 	}
 	return nil
 }
 
+// ParseDeletionAddress splits an "a" tag value (<kind>:<pubkey>:<d-tag>) of a
+// deletion event. Only replaceable and addressable kinds can be addressed.
+func ParseDeletionAddress(addr string) (kind int, pubkey string, d string, err error) {
+	parts := strings.SplitN(addr, ":", 3)
+	if len(parts) != 3 {
+		return 0, "", "", fmt.Errorf("address must have format kind:pubkey:d-tag")
+	}
+
+	kind, err = strconv.Atoi(parts[0])
+	if err != nil || (!IsReplaceable(kind) && !common.IsParameterizedReplaceableKind(kind)) {
+		return 0, "", "", fmt.Errorf("address kind must be replaceable or addressable")
+	}
+	if len(parts[1]) != 64 || !common.IsHexString(parts[1]) {
+		return 0, "", "", fmt.Errorf("invalid pubkey in address")
+	}
+
+	return kind, parts[1], parts[2], nil
+}
+
 func IsDeletionEvent(evt nostr.Event) bool {
 	return evt.Kind == 5
 }
+
+// InteractionTargets returns the ids of the events evt reacts to (kind 7),
+// reposts (6, 16) or replies to (1, 1111), so interactions with deleted events
+// can be told apart. Mentions in text notes are not replies and aren't returned.
+func InteractionTargets(evt *nostr.Event) []string {
+	var ids []string
+	for _, tag := range evt.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch evt.Kind {
+		case 6, 7, 16:
+			if tag[0] == "e" {
+				ids = append(ids, tag[1])
+			}
+		case 1:
+			if tag[0] == "e" && (len(tag) < 4 || tag[3] != "mention") {
+				ids = append(ids, tag[1])
+			}
+		case 1111:
+			if tag[0] == "e" || tag[0] == "E" {
+				ids = append(ids, tag[1])
+			}
+		}
+	}
+	return ids
+}
@@ -1,54 +1,260 @@
 package nips
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/Shugur-Network/relay/internal/config"
 	"github.com/Shugur-Network/relay/internal/constants"
+	"github.com/Shugur-Network/relay/internal/identity"
+	"github.com/Shugur-Network/relay/internal/tor"
 	nip11 "github.com/nbd-wtf/go-nostr/nip11"
 )
 
 // CustomRelayInformationDocument extends the standard NIP-11 document with NIP-XX Time Capsules capability
 type CustomRelayInformationDocument struct {
 	nip11.RelayInformationDocument
-	TimeCapsules *TimeCapsuleCapability `json:"time_capsules,omitempty"`
+	TimeCapsules *TimeCapsuleCapability   `json:"time_capsules,omitempty"`
+	Operator     *identity.OperatorStatus `json:"operator,omitempty"`
+	KeyRotation  *identity.KeyRotation    `json:"key_rotation,omitempty"`
+	Expiration   *ExpirationPolicy        `json:"expiration,omitempty"`
+	Resume       *ResumePolicy            `json:"resume,omitempty"`
+	// Onion is the relay's URL on its Tor onion service
+	Onion string `json:"onion,omitempty"`
+	// Retention replaces the embedded document's, which can't say a kind isn't
+	// stored at all
+	Retention []RetentionRule `json:"retention,omitempty"`
+}
+
+// RetentionRule is a NIP-11 retention entry: events of Kinds, single kinds or
+// [first, last] ranges, are kept for Time seconds, not at all when it is 0, or
+// the newest Count of them are kept
+type RetentionRule struct {
+	Kinds []interface{} `json:"kinds,omitempty"`
+	Time  *int64        `json:"time,omitempty"`
+	Count int           `json:"count,omitempty"`
+}
+
+// ExpirationPolicy advertises the NIP-40 expiration bounds the relay accepts, so
+// clients know how long expiring events can be kept at most
+type ExpirationPolicy struct {
+	MaxHorizon  int64 `json:"max_horizon_seconds,omitempty"`
+	MinDuration int64 `json:"min_duration_seconds,omitempty"`
+}
+
+// ResumePolicy advertises the RESUME command, telling clients how long their
+// subscriptions are kept after a disconnect and how many missed events are held
+type ResumePolicy struct {
+	Window    int64 `json:"window_seconds"`
+	MaxEvents int   `json:"max_events"`
 }
 
 // TimeCapsuleCapability represents the NIP-XX Time Capsules capability
 type TimeCapsuleCapability struct {
 	Version         string   `json:"version"`
+	Kinds           []int    `json:"kinds"`
 	Modes           []string `json:"modes"`
 	MaxTlockBlob    int      `json:"max_tlock_blob_bytes"`
 	MaxContent      int      `json:"max_content_bytes"`
 	SupportedChains []string `json:"supported_drand_chains"`
 }
 
-// Nip11Handler handles NIP-11 requests
+// nip11CacheTTL bounds how long a built NIP-11 document is served before it is
+// rebuilt, so operator verification and key rotation changes show up
+const nip11CacheTTL = time.Minute
+
+// nip11Document is a serialized NIP-11 document with its validators
+type nip11Document struct {
+	cfg *config.Config
+	// tenant is the virtual relay the document describes, nil for the main relay
+	tenant   *config.TenantConfig
+	body     []byte
+	gzipped  []byte
+	etag     string
+	modified time.Time
+	built    time.Time
+}
+
+var (
+	nip11Mu sync.Mutex
+	// nip11Cached holds the documents by tenant ID, "" for the main relay
+	nip11Cached = make(map[string]*nip11Document)
+)
+
+// Nip11Handler handles NIP-11 requests, serving a cached document with ETag,
+// Last-Modified and gzip support. CORS headers are set by the caller's policy.
 func Nip11Handler(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
-	baseMetadata := constants.DefaultRelayMetadata(cfg)
+	serveNip11(w, r, cfg, nil)
+}
+
+// TenantNip11Handler handles NIP-11 requests for the virtual relay t
+func TenantNip11Handler(w http.ResponseWriter, r *http.Request, cfg *config.Config, t config.TenantConfig) {
+	serveNip11(w, r, cfg, &t)
+}
+
+// serveNip11 serves the document of tenant, or of the main relay when nil
+func serveNip11(w http.ResponseWriter, r *http.Request, cfg *config.Config, tenant *config.TenantConfig) {
+	doc, err := cachedNip11Document(cfg, tenant)
+	if err != nil {
+		http.Error(w, "Failed to encode metadata", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/nostr+json")
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(nip11CacheTTL.Seconds())))
+	w.Header().Add("Vary", "Accept")
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	body, etag := doc.body, doc.etag
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		w.Header().Set("Content-Encoding", "gzip")
+		body, etag = doc.gzipped, strings.TrimSuffix(doc.etag, `"`)+`-gzip"`
+	}
+	w.Header().Set("ETag", etag)
+
+	// Handles If-None-Match, If-Modified-Since and HEAD
+	http.ServeContent(w, r, "", doc.modified, bytes.NewReader(body))
+}
+
+// cachedNip11Document returns the serialized NIP-11 document for cfg and tenant,
+// rebuilding it when either changed or the cached copy is older than
+// nip11CacheTTL. Last-Modified only moves when the content actually changed.
+func cachedNip11Document(cfg *config.Config, tenant *config.TenantConfig) (*nip11Document, error) {
+	nip11Mu.Lock()
+	defer nip11Mu.Unlock()
+
+	var key string
+	if tenant != nil {
+		key = tenant.ID
+	}
+	cached := nip11Cached[key]
+	now := time.Now()
+	if cached != nil && cached.cfg == cfg && reflect.DeepEqual(cached.tenant, tenant) && now.Sub(cached.built) < nip11CacheTTL {
+		return cached, nil
+	}
+
+	body, err := json.Marshal(buildNip11Document(cfg, tenant))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	if _, err := zw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	modified := now.Truncate(time.Second)
+	if cached != nil && cached.etag == etag {
+		modified = cached.modified
+	}
+	nip11Cached[key] = &nip11Document{
+		cfg:      cfg,
+		tenant:   tenant,
+		body:     body,
+		gzipped:  gz.Bytes(),
+		etag:     etag,
+		modified: modified,
+		built:    now,
+	}
+	return nip11Cached[key], nil
+}
+
+// buildNip11Document assembles the NIP-11 document with the relay's extensions.
+// Virtual relays have their own operator, so the relay identity's operator
+// verification and key rotation are only advertised by the main relay.
+func buildNip11Document(cfg *config.Config, tenant *config.TenantConfig) CustomRelayInformationDocument {
+	var baseMetadata nip11.RelayInformationDocument
+	if tenant != nil {
+		baseMetadata = constants.TenantRelayMetadata(cfg, *tenant)
+	} else {
+		baseMetadata = constants.DefaultRelayMetadata(cfg)
+	}
 
 	// Create custom metadata with NIP-XX Time Capsules capability
 	customMetadata := CustomRelayInformationDocument{
 		RelayInformationDocument: baseMetadata,
 		TimeCapsules: &TimeCapsuleCapability{
 			Version:         "1",
+			Kinds:           TimeCapsuleKinds(),
 			Modes:           []string{"public", "private"},
 			MaxTlockBlob:    constants.MaxTlockBlobSize,
 			MaxContent:      constants.MaxContentSize,
-			SupportedChains: []string{}, // Empty - relay doesn't validate chains
+			SupportedChains: supportedChains(cfg), // Empty - any chain is accepted
 		},
+		Expiration: expirationPolicy(cfg),
+		Resume:     resumePolicy(cfg),
+		Retention:  retentionPolicy(),
+	}
+	if tenant == nil {
+		customMetadata.Operator = identity.CurrentOperatorStatus()
+		customMetadata.KeyRotation = identity.CurrentKeyRotation()
+		if onion := tor.Address(); onion != "" {
+			customMetadata.Onion = "ws://" + onion
+		}
 	}
 
-	ServeCustomRelayMetadata(w, customMetadata)
+	return customMetadata
+}
+
+// supportedChains returns the drand chain allowlist advertised in NIP-11
+func supportedChains(cfg *config.Config) []string {
+	if len(cfg.Capsules.DrandChains) == 0 {
+		return []string{}
+	}
+	return cfg.Capsules.DrandChains
+}
+
+// expirationPolicy returns the advertised expiration bounds, or nil when unbounded
+func expirationPolicy(cfg *config.Config) *ExpirationPolicy {
+	bounds := cfg.RelayPolicy.Expiration
+	if bounds.MaxHorizon <= 0 && bounds.MinDuration <= 0 {
+		return nil
+	}
+	return &ExpirationPolicy{
+		MaxHorizon:  int64(bounds.MaxHorizon.Seconds()),
+		MinDuration: int64(bounds.MinDuration.Seconds()),
+	}
+}
+
+// resumePolicy returns the advertised RESUME bounds, or nil when it is disabled
+func resumePolicy(cfg *config.Config) *ResumePolicy {
+	resume := cfg.Relay.Resume
+	if !resume.Enabled {
+		return nil
+	}
+	return &ResumePolicy{
+		Window:    int64(resume.Window.Seconds()),
+		MaxEvents: resume.MaxEvents,
+	}
+}
+
+// retentionPolicy returns the advertised retention: ephemeral events are only
+// fanned out, never stored
+func retentionPolicy() []RetentionRule {
+	notStored := int64(0)
+	return []RetentionRule{
+		{Kinds: []interface{}{[]int{20000, 29999}}, Time: &notStored},
+	}
 }
 
 // ServeRelayMetadata serves the relay metadata document
 func ServeRelayMetadata(w http.ResponseWriter, metadata nip11.RelayInformationDocument) {
 	w.Header().Set("Content-Type", "application/nostr+json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 
 	if err := json.NewEncoder(w).Encode(metadata); err != nil {
 		http.Error(w, "Failed to encode metadata", http.StatusInternalServerError)
@@ -59,9 +265,6 @@ func ServeRelayMetadata(w http.ResponseWriter, metadata nip11.RelayInformationDo
 // ServeCustomRelayMetadata serves the custom relay metadata document with Time Capsules capability
 func ServeCustomRelayMetadata(w http.ResponseWriter, metadata CustomRelayInformationDocument) {
 	w.Header().Set("Content-Type", "application/nostr+json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 
 	if err := json.NewEncoder(w).Encode(metadata); err != nil {
 		http.Error(w, "Failed to encode metadata", http.StatusInternalServerError)
@@ -3,6 +3,7 @@ package nips
 import (
 	"fmt"
 
+	"github.com/Shugur-Network/relay/internal/constants"
 	nostr "github.com/nbd-wtf/go-nostr"
 )
 
@@ -17,11 +18,17 @@ func IsEphemeral(kind int) bool {
 func IsReplaceable(kind int) bool {
 	// According to NIP-01: events are replaceable for kind n such that:
 	// 10000 <= n < 20000 || n == 0 || n == 3
+	// Time capsule witness shares and share distributions are kept per
+	// capsule, not one per author
+	if kind == constants.KindUnlockShare || kind == constants.KindShareDistribution {
+		return false
+	}
 	if kind >= 10000 && kind < 20000 {
 		return true
 	}
+	// Kind 41 channel metadata is kept per channel (NIP-28), not one per author
 	switch kind {
-	case 0, 3, 41: // 41 is replaceable per NIP-28: "Only the most recent kind 41 per e tag value MAY be available"
+	case 0, 3:
 		return true
 	}
 	return false
@@ -97,6 +97,7 @@ const (
 	MsgBlacklisted          = "event/author is blocked"
 	MsgRestricted           = "operation restricted"
 	MsgDatabaseError        = "database operation failed"
+	MsgDatabaseUnavailable  = "database unavailable, try again later"
 	MsgInvalidFilter        = "filter not supported"
 	MsgSubscriptionEnd      = "subscription ended"
 	MsgInvalidPubkey        = "invalid pubkey"
@@ -107,17 +108,18 @@ const (
 
 // Pre-formatted error messages
 var (
-	ErrInvalidEvent    = FormatErrorMessage(ErrorCodeInvalidEvent, MsgInvalidEvent)
-	ErrPowerLevels     = FormatErrorMessage(ErrorCodePowerLevels, MsgPowerLevels)
-	ErrRateLimited     = FormatErrorMessage(ErrorCodeRateLimited, MsgRateLimited)
-	ErrForbidden       = FormatErrorMessage(ErrorCodeForbidden, MsgForbidden)
-	ErrExpired         = FormatErrorMessage(ErrorCodeExpired, MsgExpired)
-	ErrDuplicate       = FormatErrorMessage(ErrorCodeDuplicate, MsgDuplicate)
-	ErrBlacklisted     = FormatErrorMessage(ErrorCodeBlacklisted, MsgBlacklisted)
-	ErrRestricted      = FormatErrorMessage(ErrorCodeRestricted, MsgRestricted)
-	ErrDatabaseError   = FormatErrorMessage(ErrorCodeDatabaseError, MsgDatabaseError)
-	ErrInvalidFilter   = FormatErrorMessage(ErrorCodeInvalidFilter, MsgInvalidFilter)
-	ErrSubscriptionEnd = FormatErrorMessage(ErrorCodeSubscriptionEnd, MsgSubscriptionEnd)
+	ErrInvalidEvent        = FormatErrorMessage(ErrorCodeInvalidEvent, MsgInvalidEvent)
+	ErrPowerLevels         = FormatErrorMessage(ErrorCodePowerLevels, MsgPowerLevels)
+	ErrRateLimited         = FormatErrorMessage(ErrorCodeRateLimited, MsgRateLimited)
+	ErrForbidden           = FormatErrorMessage(ErrorCodeForbidden, MsgForbidden)
+	ErrExpired             = FormatErrorMessage(ErrorCodeExpired, MsgExpired)
+	ErrDuplicate           = FormatErrorMessage(ErrorCodeDuplicate, MsgDuplicate)
+	ErrBlacklisted         = FormatErrorMessage(ErrorCodeBlacklisted, MsgBlacklisted)
+	ErrRestricted          = FormatErrorMessage(ErrorCodeRestricted, MsgRestricted)
+	ErrDatabaseError       = FormatErrorMessage(ErrorCodeDatabaseError, MsgDatabaseError)
+	ErrDatabaseUnavailable = FormatErrorMessage(ErrorCodeDatabaseError, MsgDatabaseUnavailable)
+	ErrInvalidFilter       = FormatErrorMessage(ErrorCodeInvalidFilter, MsgInvalidFilter)
+	ErrSubscriptionEnd     = FormatErrorMessage(ErrorCodeSubscriptionEnd, MsgSubscriptionEnd)
 )
 
 // IsStandardErrorCode checks if the error code is a standard NIP-20 error code
@@ -133,7 +135,8 @@ func IsStandardErrorCode(code string) bool {
 		ErrorCodeRestricted,
 		ErrorCodeDatabaseError,
 		ErrorCodeInvalidFilter,
-		ErrorCodeSubscriptionEnd:
+		ErrorCodeSubscriptionEnd,
+		ErrorCodeAuthRequired:
 		return true
 	default:
 		return false
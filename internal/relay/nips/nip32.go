@@ -0,0 +1,25 @@
+package nips
+
+import nostr "github.com/nbd-wtf/go-nostr"
+
+// LanguageNamespace is the NIP-32 namespace of ISO 639-1 language labels
+const LanguageNamespace = "ISO-639-1"
+
+// Labels returns the values of the NIP-32 "l" tags of evt in namespace. Label
+// tags without a mark belong to the "ugc" namespace.
+func Labels(evt nostr.Event, namespace string) []string {
+	var labels []string
+	for _, tag := range evt.Tags {
+		if len(tag) < 2 || tag[0] != "l" || tag[1] == "" {
+			continue
+		}
+		mark := "ugc"
+		if len(tag) >= 3 {
+			mark = tag[2]
+		}
+		if mark == namespace {
+			labels = append(labels, tag[1])
+		}
+	}
+	return labels
+}
@@ -0,0 +1,30 @@
+package nips
+
+import (
+	"strings"
+
+	nostr "github.com/nbd-wtf/go-nostr"
+)
+
+// IsSensitive reports whether evt is marked as sensitive content: a NIP-36
+// content-warning tag or label, or an #nsfw hashtag
+func IsSensitive(evt nostr.Event) bool {
+	for _, tag := range evt.Tags {
+		if len(tag) == 0 {
+			continue
+		}
+		switch tag[0] {
+		case "content-warning":
+			return true
+		case "L":
+			if len(tag) >= 2 && tag[1] == "content-warning" {
+				return true
+			}
+		case "t":
+			if len(tag) >= 2 && strings.EqualFold(tag[1], "nsfw") {
+				return true
+			}
+		}
+	}
+	return false
+}
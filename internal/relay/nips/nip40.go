@@ -1,6 +1,7 @@
 package nips
 
 import (
+	"fmt"
 	"strconv"
 	"time"
 
@@ -45,3 +46,15 @@ func ValidateExpirationTag(evt nostr.Event) error {
 	}
 	return nil
 }
+
+// ValidateExpirationBounds checks an expiration time against the relay's policy:
+// at least minDuration and at most maxHorizon after now. Zero disables a bound.
+func ValidateExpirationBounds(expTime, now time.Time, minDuration, maxHorizon time.Duration) error {
+	if maxHorizon > 0 && expTime.After(now.Add(maxHorizon)) {
+		return fmt.Errorf("expiration is more than %s in the future", maxHorizon)
+	}
+	if minDuration > 0 && expTime.Before(now.Add(minDuration)) {
+		return fmt.Errorf("expiration must be at least %s in the future", minDuration)
+	}
+	return nil
+}
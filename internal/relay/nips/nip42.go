@@ -0,0 +1,73 @@
+package nips
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	nostr "github.com/nbd-wtf/go-nostr"
+)
+
+// KindClientAuthentication is the ephemeral kind used by NIP-42 AUTH events
+const KindClientAuthentication = 22242
+
+// AuthMaxClockSkew is the maximum allowed difference between an AUTH event's
+// created_at and the relay clock
+const AuthMaxClockSkew = 10 * time.Minute
+
+// ErrorCodeAuthRequired is the NIP-42 machine-readable prefix for unauthenticated clients
+const ErrorCodeAuthRequired = "auth-required"
+
+// GenerateAuthChallenge returns a random challenge string for a new connection
+func GenerateAuthChallenge() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// ValidateAuthEvent validates a NIP-42 client authentication event against the
+// challenge issued on this connection and the relay's public URL
+func ValidateAuthEvent(evt *nostr.Event, challenge, relayURL string) error {
+	if evt.Kind != KindClientAuthentication {
+		return fmt.Errorf("invalid event kind for auth: %d", evt.Kind)
+	}
+
+	if ok, err := evt.CheckSignature(); err != nil || !ok {
+		return fmt.Errorf("invalid signature")
+	}
+
+	created := time.Unix(int64(evt.CreatedAt), 0)
+	if skew := time.Since(created); skew > AuthMaxClockSkew || skew < -AuthMaxClockSkew {
+		return fmt.Errorf("created_at is too far from current time")
+	}
+
+	challengeTag := evt.Tags.Find("challenge")
+	if challengeTag == nil || challengeTag[1] != challenge {
+		return fmt.Errorf("challenge mismatch")
+	}
+
+	relayTag := evt.Tags.Find("relay")
+	if relayTag == nil {
+		return fmt.Errorf("missing relay tag")
+	}
+	if relayURL != "" && !sameRelayHost(relayTag[1], relayURL) {
+		return fmt.Errorf("relay tag does not match this relay")
+	}
+
+	return nil
+}
+
+// sameRelayHost compares two relay URLs by host, ignoring scheme and trailing slashes
+func sameRelayHost(a, b string) bool {
+	ua, errA := url.Parse(strings.TrimSpace(a))
+	ub, errB := url.Parse(strings.TrimSpace(b))
+	if errA != nil || errB != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Host, ub.Host)
+}
@@ -0,0 +1,38 @@
+package nips
+
+import (
+	"fmt"
+	"time"
+
+	nostr "github.com/nbd-wtf/go-nostr"
+)
+
+// KindJoinRequest is the NIP-43 event a pubkey sends to claim membership with an
+// invite code
+const KindJoinRequest = 28934
+
+// JoinRequestClaim validates a NIP-43 join request and returns the invite code in
+// its claim tag. Join requests are checked like AUTH events: signed by their
+// author and created within AuthMaxClockSkew, so an old request can't be replayed.
+func JoinRequestClaim(evt *nostr.Event) (string, error) {
+	if evt.Kind != KindJoinRequest {
+		return "", fmt.Errorf("invalid event kind for join request: %d", evt.Kind)
+	}
+	if !evt.CheckID() {
+		return "", fmt.Errorf("invalid event id")
+	}
+	if ok, err := evt.CheckSignature(); err != nil || !ok {
+		return "", fmt.Errorf("invalid signature")
+	}
+
+	created := time.Unix(int64(evt.CreatedAt), 0)
+	if skew := time.Since(created); skew > AuthMaxClockSkew || skew < -AuthMaxClockSkew {
+		return "", fmt.Errorf("created_at is too far from current time")
+	}
+
+	claim := evt.Tags.Find("claim")
+	if len(claim) < 2 || claim[1] == "" {
+		return "", fmt.Errorf("missing claim tag")
+	}
+	return claim[1], nil
+}
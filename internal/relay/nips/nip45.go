@@ -27,6 +27,8 @@ type CountCommand struct {
 // CountResponse represents the response to a COUNT command
 type CountResponse struct {
 	Count int64 `json:"count"`
+	// Approximate is set when Count is an estimate
+	Approximate bool `json:"approximate,omitempty"`
 }
 
 // ParseCountCommand parses a COUNT command from raw message array
@@ -2,6 +2,7 @@ package nips
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	nostr "github.com/nbd-wtf/go-nostr"
@@ -77,6 +78,107 @@ func BuildSearchQuery(search string, opts SearchOptions) (string, []string, erro
 	return "(" + strings.Join(queryParts, " AND ") + ")", escapedTerms, nil
 }
 
+// Search extensions defined by NIP-50. Only language, domain, nsfw and
+// include:spam change results; the others are dropped from the search text.
+var searchExtensions = map[string]bool{
+	"include":   true,
+	"domain":    true,
+	"language":  true,
+	"sentiment": true,
+	"nsfw":      true,
+}
+
+// SearchQuery is a search string split into its text and the extensions the
+// relay applies
+type SearchQuery struct {
+	// Text is what is left of the search string once extensions are taken out
+	Text string
+	// Language is the ISO 639-1 code of language:, empty when not given
+	Language string
+	// Domain is the NIP-05 domain of domain:, empty when not given
+	Domain string
+	// NSFW is the value of nsfw:, nil when not given; only false narrows results
+	NSFW *bool
+	// IncludeSpam is set by include:spam, which turns off spam filtering
+	IncludeSpam bool
+}
+
+// ParseSearch takes the NIP-50 extensions, key:value words with a known key,
+// out of search
+func ParseSearch(search string) SearchQuery {
+	var q SearchQuery
+	var text []string
+	for _, word := range strings.Fields(search) {
+		key, value, ok := strings.Cut(word, ":")
+		key = strings.ToLower(key)
+		if !ok || value == "" || !searchExtensions[key] {
+			text = append(text, word)
+			continue
+		}
+		value = strings.ToLower(value)
+		switch key {
+		case "language":
+			q.Language = value
+		case "domain":
+			q.Domain = value
+		case "nsfw":
+			if nsfw, err := strconv.ParseBool(value); err == nil {
+				q.NSFW = &nsfw
+			}
+		case "include":
+			if value == "spam" {
+				q.IncludeSpam = true
+			}
+		}
+	}
+	q.Text = strings.Join(text, " ")
+	return q
+}
+
+// Terms returns the words of the search text; an event matches when its content
+// contains each of them, in any case
+func (q SearchQuery) Terms() []string {
+	return strings.Fields(q.Text)
+}
+
+// MatchesContent reports whether content contains every term of the query
+func (q SearchQuery) MatchesContent(content string) bool {
+	content = strings.ToLower(content)
+	for _, term := range q.Terms() {
+		if !strings.Contains(content, strings.ToLower(term)) {
+			return false
+		}
+	}
+	return true
+}
+
+// ExcludesNSFW reports whether the query asks for NSFW events to be left out
+func (q SearchQuery) ExcludesNSFW() bool {
+	return q.NSFW != nil && !*q.NSFW
+}
+
+// SearchLanguage returns the ISO 639-1 code of the language of evt: the one its
+// NIP-32 labels give, else the one its text content reads as, empty when unsure
+func SearchLanguage(evt nostr.Event) string {
+	if labels := Labels(evt, LanguageNamespace); len(labels) > 0 {
+		return strings.ToLower(labels[0])
+	}
+	if !hasTextContent(evt.Kind) {
+		return ""
+	}
+	return DetectLanguage(evt.Content)
+}
+
+// hasTextContent reports whether events of kind carry prose in their content
+func hasTextContent(kind int) bool {
+	switch kind {
+	case 1, 11, 20, 21, 22, 1111, 9802, 30023, 30024:
+		return true
+	default:
+		return false
+	}
+}
+
 // IsSearchableKind checks if an event kind should be included in search results
 func IsSearchableKind(kind int) bool {
 	// By default, only text notes (kind 1) are searchable
@@ -385,4 +385,82 @@ func validateNIP32LabelRelationships(lTags []nostr.Tag, lNamespaces []string) er
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// SpamReportTargets returns the event ids and pubkeys a report (kind 1984)
+// reports as spam
+func SpamReportTargets(evt *nostr.Event) []string {
+	if evt.Kind != 1984 {
+		return nil
+	}
+	var targets []string
+	for _, tag := range evt.Tags {
+		if len(tag) >= 3 && (tag[0] == "e" || tag[0] == "p") && tag[2] == "spam" && len(tag[1]) == 64 {
+			targets = append(targets, strings.ToLower(tag[1]))
+		}
+	}
+	return targets
+}
+
+// ReportTarget is an event or pubkey reported by a report (kind 1984)
+type ReportTarget struct {
+	// ID is the reported event's id, or the reported pubkey
+	ID string
+	// Event is set when ID is an event id
+	Event bool
+	// PubKey is the reported pubkey; empty for an event, as the report's p tag
+	// can name anyone and only the stored event tells its author
+	PubKey     string
+	ReportType string
+}
+
+// ReportTargets returns what a report (kind 1984) reports: the events of its e
+// tags, or the pubkeys of its p tags when it names no event
+func ReportTargets(evt *nostr.Event) []ReportTarget {
+	if evt.Kind != 1984 {
+		return nil
+	}
+	var author nostr.Tag
+	for _, tag := range evt.Tags {
+		if len(tag) >= 2 && tag[0] == "p" && len(tag[1]) == 64 {
+			author = tag
+			break
+		}
+	}
+	if author == nil {
+		return nil
+	}
+
+	var targets []ReportTarget
+	seen := make(map[string]bool)
+	for _, tag := range evt.Tags {
+		if len(tag) < 2 || tag[0] != "e" || len(tag[1]) != 64 || seen[strings.ToLower(tag[1])] {
+			continue
+		}
+		target := ReportTarget{ID: strings.ToLower(tag[1]), Event: true}
+		if len(tag) >= 3 && tag[2] != "" {
+			target.ReportType = tag[2]
+		} else if len(author) >= 3 {
+			target.ReportType = author[2]
+		}
+		seen[target.ID] = true
+		targets = append(targets, target)
+	}
+	if len(targets) > 0 {
+		return targets
+	}
+
+	for _, tag := range evt.Tags {
+		if len(tag) < 2 || tag[0] != "p" || len(tag[1]) != 64 || seen[strings.ToLower(tag[1])] {
+			continue
+		}
+		pubkey := strings.ToLower(tag[1])
+		target := ReportTarget{ID: pubkey, PubKey: pubkey}
+		if len(tag) >= 3 {
+			target.ReportType = tag[2]
+		}
+		seen[pubkey] = true
+		targets = append(targets, target)
+	}
+	return targets
+}
@@ -0,0 +1,26 @@
+package nips
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestReportTargets(t *testing.T) {
+	victim := strings.Repeat("a", 64)
+	event := strings.Repeat("b", 64)
+
+	// The p tag of an event report can name anyone, so it isn't the author
+	report := &nostr.Event{Kind: 1984, Tags: nostr.Tags{{"e", event, "spam"}, {"p", victim}}}
+	targets := ReportTargets(report)
+	if len(targets) != 1 || targets[0].ID != event || !targets[0].Event || targets[0].PubKey != "" || targets[0].ReportType != "spam" {
+		t.Errorf("ReportTargets(event report) = %+v", targets)
+	}
+
+	report = &nostr.Event{Kind: 1984, Tags: nostr.Tags{{"p", victim, "impersonation"}}}
+	targets = ReportTargets(report)
+	if len(targets) != 1 || targets[0].ID != victim || targets[0].Event || targets[0].PubKey != victim {
+		t.Errorf("ReportTargets(pubkey report) = %+v", targets)
+	}
+}
@@ -1,12 +1,16 @@
 package nips
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
 
 	"github.com/Shugur-Network/relay/internal/relay/nips/common"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil/bech32"
 	"github.com/nbd-wtf/go-nostr"
 )
 
@@ -204,6 +208,11 @@ func validateZapReceiptTags(helper *common.ValidationHelper, event *nostr.Event)
 		return fmt.Errorf("zap receipt must include 'description' tag with JSON-encoded zap request")
 	}
 
+	// The invoice, the zap request and the receipt must describe the same zap
+	if _, _, err := checkZapReceipt(event); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -481,3 +490,220 @@ func validatePreimageTag(tag nostr.Tag) error {
 
 	return nil
 }
+
+// ZapReceipt is the payment described by a zap receipt
+type ZapReceipt struct {
+	// Sender is the pubkey that signed the zap request
+	Sender string
+	// Recipient is the pubkey the zap was addressed to
+	Recipient string
+	// EventID and Address are the event zapped, empty for zaps of a profile
+	EventID     string
+	Address     string
+	AmountMsats int64
+}
+
+// ParseZapReceipt extracts the payment from a zap receipt (kind 9735). The
+// embedded zap request must be signed, name the same recipient and, when it has
+// an amount tag, match the invoice amount. Whether the receipt was signed by the
+// recipient's zap provider is left to the caller.
+func ParseZapReceipt(event *nostr.Event) (*ZapReceipt, error) {
+	if event.Kind != 9735 {
+		return nil, fmt.Errorf("not a zap receipt: kind %d", event.Kind)
+	}
+	request, amount, err := checkZapReceipt(event)
+	if err != nil {
+		return nil, err
+	}
+	receipt := &ZapReceipt{Sender: request.PubKey, AmountMsats: amount}
+	receipt.Recipient, _ = zapTag(event, "p")
+	receipt.EventID, _ = zapTag(event, "e")
+	receipt.Address, _ = zapTag(event, "a")
+	return receipt, nil
+}
+
+// checkZapReceipt returns the zap request embedded in a zap receipt and the
+// amount of its invoice, once it checked they agree with each other and with
+// the receipt: the request must be signed and zap the recipient, event and
+// address the receipt names, the invoice must be signed and commit to the
+// request with its description hash and be for the requested amount, when one
+// is given.
+func checkZapReceipt(event *nostr.Event) (*nostr.Event, int64, error) {
+	bolt11, _ := zapTag(event, "bolt11")
+	description, _ := zapTag(event, "description")
+	recipient, _ := zapTag(event, "p")
+	if bolt11 == "" || description == "" || recipient == "" {
+		return nil, 0, fmt.Errorf("zap receipt must include bolt11, description and p tags")
+	}
+
+	var request nostr.Event
+	if err := json.Unmarshal([]byte(description), &request); err != nil {
+		return nil, 0, fmt.Errorf("description must be a valid nostr event: %w", err)
+	}
+	if request.Kind != 9734 {
+		return nil, 0, fmt.Errorf("description must contain a kind 9734 zap request, got kind %d", request.Kind)
+	}
+	if ok, err := request.CheckSignature(); err != nil || !ok {
+		return nil, 0, fmt.Errorf("zap request has an invalid signature")
+	}
+	if requested, _ := zapTag(&request, "p"); requested != recipient {
+		return nil, 0, fmt.Errorf("zap request and receipt name different recipients")
+	}
+	for _, name := range []string{"e", "a"} {
+		requested, _ := zapTag(&request, name)
+		if zapped, _ := zapTag(event, name); requested != zapped {
+			return nil, 0, fmt.Errorf("zap request and receipt have different '%s' tags", name)
+		}
+	}
+
+	if _, err := Bolt11Payee(bolt11); err != nil {
+		return nil, 0, err
+	}
+	hash, err := Bolt11DescriptionHash(bolt11)
+	if err != nil {
+		return nil, 0, err
+	}
+	if sum := sha256.Sum256([]byte(description)); !bytes.Equal(hash, sum[:]) {
+		return nil, 0, fmt.Errorf("bolt11 description hash does not match the zap request")
+	}
+
+	amount, err := Bolt11AmountMsats(bolt11)
+	if err != nil {
+		return nil, 0, err
+	}
+	if requested, ok := zapTag(&request, "amount"); ok && requested != strconv.FormatInt(amount, 10) {
+		return nil, 0, fmt.Errorf("invoice amount %d msats differs from the requested %s", amount, requested)
+	}
+
+	return &request, amount, nil
+}
+
+// zapTag returns the value of the first name tag of event
+func zapTag(event *nostr.Event, name string) (string, bool) {
+	if tag := event.Tags.GetFirst([]string{name, ""}); tag != nil {
+		return (*tag)[1], true
+	}
+	return "", false
+}
+
+// bolt11DescriptionHashField is the type of the BOLT-11 tagged field holding
+// the SHA-256 of the invoice description ('h')
+const bolt11DescriptionHashField = 23
+
+// Bolt11DescriptionHash returns the description hash of a BOLT-11 invoice
+func Bolt11DescriptionHash(invoice string) ([]byte, error) {
+	_, data, err := bech32.DecodeNoLimit(strings.ToLower(invoice))
+	if err != nil {
+		return nil, fmt.Errorf("malformed bolt11 invoice: %w", err)
+	}
+	// A 35-bit timestamp, the tagged fields, then a 520-bit signature
+	if len(data) < 7+104 {
+		return nil, fmt.Errorf("malformed bolt11 invoice")
+	}
+	fields := data[7 : len(data)-104]
+	for len(fields) >= 3 {
+		kind, size := fields[0], int(fields[1])<<5|int(fields[2])
+		if len(fields) < 3+size {
+			return nil, fmt.Errorf("malformed bolt11 invoice")
+		}
+		if kind == bolt11DescriptionHashField && size == 52 {
+			return bech32.ConvertBits(fields[3:3+size], 5, 8, false)
+		}
+		fields = fields[3+size:]
+	}
+	return nil, fmt.Errorf("bolt11 invoice has no description hash")
+}
+
+// bolt11PayeeField is the type of the BOLT-11 tagged field holding the payee
+// node's public key ('n')
+const bolt11PayeeField = 19
+
+// Bolt11Payee checks the signature of a BOLT-11 invoice and returns the public
+// key of the node that signed it: the payee named by its 'n' field, or else the
+// key the signature recovers to.
+func Bolt11Payee(invoice string) ([]byte, error) {
+	hrp, data, err := bech32.DecodeNoLimit(strings.ToLower(invoice))
+	if err != nil {
+		return nil, fmt.Errorf("malformed bolt11 invoice: %w", err)
+	}
+	if len(data) < 7+104 {
+		return nil, fmt.Errorf("malformed bolt11 invoice")
+	}
+
+	// The signature covers the human-readable part and the data before it,
+	// zero-padded to a byte boundary
+	signed, err := bech32.ConvertBits(data[:len(data)-104], 5, 8, true)
+	if err != nil {
+		return nil, fmt.Errorf("malformed bolt11 invoice: %w", err)
+	}
+	hash := sha256.Sum256(append([]byte(hrp), signed...))
+	sig, err := bech32.ConvertBits(data[len(data)-104:], 5, 8, false)
+	if err != nil || len(sig) != 65 || sig[64] > 3 {
+		return nil, fmt.Errorf("malformed bolt11 signature")
+	}
+	// Compact signatures lead with the recovery id, offset for a compressed key
+	compact := append([]byte{27 + 4 + sig[64]}, sig[:64]...)
+	key, _, err := ecdsa.RecoverCompact(compact, hash[:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid bolt11 signature: %w", err)
+	}
+	recovered := key.SerializeCompressed()
+
+	fields := data[7 : len(data)-104]
+	for len(fields) >= 3 {
+		kind, size := fields[0], int(fields[1])<<5|int(fields[2])
+		if len(fields) < 3+size {
+			return nil, fmt.Errorf("malformed bolt11 invoice")
+		}
+		if kind == bolt11PayeeField && size == 53 {
+			payee, err := bech32.ConvertBits(fields[3:3+size], 5, 8, false)
+			if err != nil || !bytes.Equal(payee, recovered) {
+				return nil, fmt.Errorf("bolt11 invoice is not signed by its payee")
+			}
+			break
+		}
+		fields = fields[3+size:]
+	}
+	return recovered, nil
+}
+
+// bolt11Multipliers converts an amount in BTC with the BOLT-11 multiplier to msats
+var bolt11Multipliers = map[byte]struct{ mul, div int64 }{
+	'm': {100_000_000, 1},
+	'u': {100_000, 1},
+	'n': {100, 1},
+	'p': {1, 10},
+}
+
+// Bolt11AmountMsats returns the amount encoded in the human-readable part of a
+// BOLT-11 invoice, in msats
+func Bolt11AmountMsats(invoice string) (int64, error) {
+	invoice = strings.ToLower(invoice)
+	sep := strings.LastIndexByte(invoice, '1')
+	if !strings.HasPrefix(invoice, "ln") || sep < 0 {
+		return 0, fmt.Errorf("malformed bolt11 invoice")
+	}
+
+	// Skip the currency prefix (bc, tb, bcrt, ...) up to the first digit
+	hrp := invoice[2:sep]
+	start := strings.IndexFunc(hrp, func(r rune) bool { return r >= '0' && r <= '9' })
+	if start < 0 {
+		return 0, fmt.Errorf("bolt11 invoice has no amount")
+	}
+	digits := hrp[start:]
+
+	multiplier, ok := bolt11Multipliers[digits[len(digits)-1]]
+	if ok {
+		digits = digits[:len(digits)-1]
+	} else {
+		multiplier = struct{ mul, div int64 }{100_000_000_000, 1}
+	}
+	amount, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || amount <= 0 {
+		return 0, fmt.Errorf("invalid bolt11 amount %q", hrp[start:])
+	}
+	if amount%multiplier.div != 0 || amount > (1<<62)/multiplier.mul {
+		return 0, fmt.Errorf("invalid bolt11 amount %q", hrp[start:])
+	}
+	return amount * multiplier.mul / multiplier.div, nil
+}
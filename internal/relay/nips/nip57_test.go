@@ -0,0 +1,126 @@
+package nips
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// bolt11NodeKey is the node key of the BOLT-11 examples
+const bolt11NodeKey = "e126f68f7eafcc8b74f54d269fe206be715000f94dac067d1c04a8ca3b2db734"
+
+// signInvoice returns a BOLT-11 invoice for hrp with a description hash of
+// description and, when payee is set, an 'n' field naming it, signed by key
+func signInvoice(t *testing.T, key *btcec.PrivateKey, hrp, description string, payee []byte) string {
+	t.Helper()
+	data := []byte{1, 2, 3, 4, 5, 6, 7} // timestamp
+	field := func(kind byte, value []byte) {
+		groups, err := bech32.ConvertBits(value, 8, 5, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, kind, byte(len(groups)>>5), byte(len(groups)&31))
+		data = append(data, groups...)
+	}
+	sum := sha256.Sum256([]byte(description))
+	field(bolt11DescriptionHashField, sum[:])
+	if payee != nil {
+		field(bolt11PayeeField, payee)
+	}
+
+	signed, err := bech32.ConvertBits(data, 5, 8, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256(append([]byte(hrp), signed...))
+	compact := ecdsa.SignCompact(key, hash[:], true)
+	// BOLT-11 puts the recovery id after the signature
+	sig := append(compact[1:], compact[0]-27-4)
+	groups, err := bech32.ConvertBits(sig, 8, 5, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invoice, err := bech32.Encode(hrp, append(data, groups...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return invoice
+}
+
+func TestBolt11Payee(t *testing.T) {
+	raw, _ := hex.DecodeString(bolt11NodeKey)
+	key, pub := btcec.PrivKeyFromBytes(raw)
+	other, _ := btcec.NewPrivateKey()
+
+	invoice := signInvoice(t, key, "lnbc2500u", "coffee", nil)
+	payee, err := Bolt11Payee(invoice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(payee); got != "03e7156ae33b0a208d0744199163177e909e80176e55d97a2f221ede0f934dd9ad" {
+		t.Errorf("payee = %s, want the example node key", got)
+	}
+
+	if _, err := Bolt11Payee(signInvoice(t, key, "lnbc2500u", "coffee", pub.SerializeCompressed())); err != nil {
+		t.Errorf("invoice naming its signer: %v", err)
+	}
+	if _, err := Bolt11Payee(signInvoice(t, other, "lnbc2500u", "coffee", pub.SerializeCompressed())); err == nil {
+		t.Error("invoice signed by another node than its payee was accepted")
+	}
+
+	// Raising the amount after signing changes the key the signature recovers to
+	hrp, data, _ := bech32.DecodeNoLimit(invoice)
+	tampered, _ := bech32.Encode(hrp[:len(hrp)-2]+"0m", data)
+	if payee, err := Bolt11Payee(tampered); err == nil && bytes.Equal(payee, pub.SerializeCompressed()) {
+		t.Error("tampered invoice still recovers to the node key")
+	}
+}
+
+func TestParseZapReceipt(t *testing.T) {
+	raw, _ := hex.DecodeString(bolt11NodeKey)
+	node, _ := btcec.PrivKeyFromBytes(raw)
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+
+	request := nostr.Event{Kind: 9734, CreatedAt: nostr.Now(), Tags: nostr.Tags{
+		{"p", recipientPub}, {"amount", "250000000"}, {"relays", "wss://relay.example"},
+	}}
+	if err := request.Sign(nostr.GeneratePrivateKey()); err != nil {
+		t.Fatal(err)
+	}
+	description := request.String()
+
+	receipt := func(invoice string) *nostr.Event {
+		return &nostr.Event{Kind: 9735, Tags: nostr.Tags{
+			{"p", recipientPub}, {"bolt11", invoice}, {"description", description},
+		}}
+	}
+
+	parsed, err := ParseZapReceipt(receipt(signInvoice(t, node, "lnbc2500u", description, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.AmountMsats != 250000000 || parsed.Sender != request.PubKey || parsed.Recipient != recipientPub {
+		t.Errorf("ParseZapReceipt = %+v", parsed)
+	}
+
+	if _, err := ParseZapReceipt(receipt(signInvoice(t, node, "lnbc2500u", "something else", nil))); err == nil {
+		t.Error("receipt whose invoice commits to another description was accepted")
+	}
+	if _, err := ParseZapReceipt(receipt(signInvoice(t, node, "lnbc1m", description, nil))); err == nil {
+		t.Error("receipt whose invoice is for another amount was accepted")
+	}
+	// Corrupting r leaves no point to recover a key from, or another key
+	hrp, data, _ := bech32.DecodeNoLimit(signInvoice(t, node, "lnbc2500u", description, nil))
+	data[len(data)-104] ^= 31
+	broken, _ := bech32.Encode(hrp, data)
+	if payee, err := Bolt11Payee(broken); err == nil && bytes.Equal(payee, node.PubKey().SerializeCompressed()) {
+		t.Error("invoice with a corrupted signature still recovers to the node key")
+	}
+}
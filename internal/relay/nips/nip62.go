@@ -0,0 +1,61 @@
+package nips
+
+import (
+	"github.com/Shugur-Network/relay/internal/relay/nips/common"
+	nostr "github.com/nbd-wtf/go-nostr"
+)
+
+// NIP-62: Request to Vanish
+// https://github.com/nostr-protocol/nips/blob/master/62.md
+
+// KindVanishRequest asks relays to delete everything its author published up
+// to its created_at
+const KindVanishRequest = 62
+
+// VanishAllRelays is the relay tag value addressing a vanish request to every relay
+const VanishAllRelays = "ALL_RELAYS"
+
+// ValidateVanishRequest validates NIP-62 vanish requests (kind 62)
+func ValidateVanishRequest(evt *nostr.Event) error {
+	return common.ValidateEventWithCallback(
+		evt,
+		"62",                // NIP number
+		KindVanishRequest,   // Expected event kind
+		"request to vanish", // Event name for logging
+		func(helper *common.ValidationHelper, event *nostr.Event) error {
+			for _, tag := range event.Tags {
+				if len(tag) >= 2 && tag[0] == "relay" && tag[1] != "" {
+					return nil
+				}
+			}
+			return helper.ErrorFormatter.FormatError("request to vanish must name a relay or ALL_RELAYS in a 'relay' tag")
+		},
+	)
+}
+
+// VanishRequestFor reports whether the vanish request evt is addressed to the
+// relay at relayURL, or to all relays. Any relay tag matches when relayURL is
+// unknown.
+func VanishRequestFor(evt *nostr.Event, relayURL string) bool {
+	for _, tag := range evt.Tags {
+		if len(tag) < 2 || tag[0] != "relay" {
+			continue
+		}
+		if tag[1] == VanishAllRelays || relayURL == "" || sameRelayHost(tag[1], relayURL) {
+			return true
+		}
+	}
+	return false
+}
+
+// GiftWrapRecipient returns the pubkey a gift wrap (kind 1059) is addressed to,
+// since a request to vanish also removes the wraps sent to its author
+func GiftWrapRecipient(evt *nostr.Event) (string, bool) {
+	if evt.Kind != 1059 {
+		return "", false
+	}
+	if p := evt.Tags.Find("p"); len(p) >= 2 {
+		return p[1], true
+	}
+	return "", false
+}
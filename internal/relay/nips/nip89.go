@@ -0,0 +1,123 @@
+package nips
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Shugur-Network/relay/internal/relay/nips/common"
+	nostr "github.com/nbd-wtf/go-nostr"
+)
+
+// NIP-89: Recommended Application Handlers
+// https://github.com/nostr-protocol/nips/blob/master/89.md
+//
+// Event Kinds:
+//   - 31989: Handler recommendation, its d tag the kind recommended for
+//   - 31990: Handler information, its k tags the kinds handled
+//
+// Both are addressable. Clients look handlers up by kind with
+// {"kinds":[31989],"#d":["<kind>"]} and {"kinds":[31990],"#k":["<kind>"]}, so
+// the kind values must be written the one way those filters match.
+
+const (
+	KindHandlerRecommendation = 31989
+	KindHandlerInformation    = 31990
+)
+
+// ValidateHandlerRecommendation validates a handler recommendation (kind 31989)
+func ValidateHandlerRecommendation(evt *nostr.Event) error {
+	return common.ValidateEventWithCallback(
+		evt,
+		"89",                      // NIP number
+		KindHandlerRecommendation, // Expected event kind
+		"handler recommendation",  // Event name for logging
+		func(helper *common.ValidationHelper, event *nostr.Event) error {
+			d := helper.GetTagValue(event, "d")
+			if err := validateHandledKind(d); err != nil {
+				return helper.FormatTagError("d", "%v", err)
+			}
+
+			handlers := 0
+			for _, tag := range event.Tags {
+				if len(tag) < 2 || tag[0] != "a" {
+					continue
+				}
+				handlers++
+				if err := validateHandlerAddress(tag[1]); err != nil {
+					return helper.FormatTagError("a", "%v", err)
+				}
+				if len(tag) >= 3 && tag[2] != "" {
+					if err := helper.ValidateURL(tag[2]); err != nil {
+						return helper.FormatTagError("a", "invalid relay hint: %v", err)
+					}
+				}
+			}
+			if handlers == 0 {
+				return helper.FormatMissingTagError("a")
+			}
+			return nil
+		},
+	)
+}
+
+// ValidateHandlerInformation validates a handler information event (kind 31990)
+func ValidateHandlerInformation(evt *nostr.Event) error {
+	return common.ValidateEventWithCallback(
+		evt,
+		"89",                   // NIP number
+		KindHandlerInformation, // Expected event kind
+		"handler information",  // Event name for logging
+		func(helper *common.ValidationHelper, event *nostr.Event) error {
+			if helper.GetTagValue(event, "d") == "" {
+				return helper.FormatMissingTagError("d")
+			}
+
+			kinds := 0
+			for _, tag := range event.Tags {
+				if len(tag) < 2 || tag[0] != "k" {
+					continue
+				}
+				kinds++
+				if err := validateHandledKind(tag[1]); err != nil {
+					return helper.FormatTagError("k", "%v", err)
+				}
+			}
+			if kinds == 0 {
+				return helper.FormatMissingTagError("k")
+			}
+
+			// The content, when set, is the handler's kind 0 style metadata
+			if strings.TrimSpace(event.Content) != "" {
+				var metadata map[string]interface{}
+				if err := json.Unmarshal([]byte(event.Content), &metadata); err != nil {
+					return helper.ErrorFormatter.FormatError("content must be a JSON metadata object")
+				}
+			}
+			return nil
+		},
+	)
+}
+
+// validateHandledKind checks a kind named in a d or k tag is a kind number
+// written without sign or leading zeros
+func validateHandledKind(value string) error {
+	kind, err := strconv.Atoi(value)
+	if err != nil || kind < 0 || kind > 65535 || strconv.Itoa(kind) != value {
+		return fmt.Errorf("%q is not a kind number", value)
+	}
+	return nil
+}
+
+// validateHandlerAddress checks an a tag points at a handler information event
+func validateHandlerAddress(addr string) error {
+	parts := strings.SplitN(addr, ":", 3)
+	if len(parts) != 3 || parts[0] != strconv.Itoa(KindHandlerInformation) {
+		return fmt.Errorf("address must have format 31990:pubkey:d-tag")
+	}
+	if len(parts[1]) != 64 || !common.IsHexString(parts[1]) || parts[2] == "" {
+		return fmt.Errorf("address must have format 31990:pubkey:d-tag")
+	}
+	return nil
+}
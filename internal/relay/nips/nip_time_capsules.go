@@ -10,13 +10,39 @@ import (
 	nostr "github.com/nbd-wtf/go-nostr"
 )
 
+// timeCapsuleKinds holds the event kinds accepted as public time capsules (CAPSULES.KINDS)
+var timeCapsuleKinds = []int{constants.KindTimeCapsule}
+
+// SetTimeCapsuleKinds replaces the kinds treated as public time capsules.
+// Must be called at startup, before events are validated.
+func SetTimeCapsuleKinds(kinds []int) {
+	if len(kinds) > 0 {
+		timeCapsuleKinds = append([]int(nil), kinds...)
+	}
+}
+
+// TimeCapsuleKinds returns the kinds treated as public time capsules
+func TimeCapsuleKinds() []int {
+	return timeCapsuleKinds
+}
+
+// IsTimeCapsuleKind reports whether kind is one of the configured time capsule kinds
+func IsTimeCapsuleKind(kind int) bool {
+	for _, k := range timeCapsuleKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
 // ValidateTimeCapsuleEvent validates time capsule events according to NIP-XX
 // Public time capsules: content is Base64 of binary age v1 ciphertext with exactly one tlock recipient
 // Private time capsules are delivered via NIP-59 (kinds 13, 1059) and validated separately
 func ValidateTimeCapsuleEvent(evt *nostr.Event) error {
-	// Must be kind 1041
-	if evt.Kind != constants.KindTimeCapsule {
-		return fmt.Errorf("invalid kind: expected %d, got %d", constants.KindTimeCapsule, evt.Kind)
+	// Must be a configured time capsule kind (1041 by default)
+	if !IsTimeCapsuleKind(evt.Kind) {
+		return fmt.Errorf("invalid kind: expected one of %v, got %d", timeCapsuleKinds, evt.Kind)
 	}
 
 	// Validate content is valid base64
@@ -46,7 +72,7 @@ func ValidateTimeCapsuleEvent(evt *nostr.Event) error {
 		return fmt.Errorf("invalid tlock tag: %w", err)
 	}
 
-	// For public capsules, inner 1041 MUST NOT contain p tags
+	// For public capsules, the inner capsule MUST NOT contain p tags
 	if hasRecipientTag(evt.Tags) {
 		return fmt.Errorf("public time capsule must not contain p tags (use NIP-59 for private capsules)")
 	}
@@ -132,8 +158,124 @@ func hasRecipientTag(tags nostr.Tags) bool {
 	return false
 }
 
+// ValidateShareDistributionEvent validates a kind 11992 share distribution:
+// ["e", <capsule id>], ["threshold", "<t>"] and one p tag per witness, with
+// 1 <= t <= witnesses <= maxWitnesses
+func ValidateShareDistributionEvent(evt *nostr.Event, maxWitnesses int) error {
+	if evt.Kind != constants.KindShareDistribution {
+		return fmt.Errorf("invalid kind: expected %d, got %d", constants.KindShareDistribution, evt.Kind)
+	}
+
+	if _, err := ExtractCapsuleReference(evt); err != nil {
+		return err
+	}
+
+	threshold, witnesses, err := ExtractShareThreshold(evt)
+	if err != nil {
+		return err
+	}
+	if len(witnesses) == 0 {
+		return fmt.Errorf("%s: at least one witness is required", constants.ErrInvalidWitness)
+	}
+	if len(witnesses) > maxWitnesses {
+		return fmt.Errorf("too many witnesses: %d exceeds %d limit", len(witnesses), maxWitnesses)
+	}
+	if threshold > len(witnesses) {
+		return fmt.Errorf("%s: threshold %d exceeds %d witnesses", constants.ErrInvalidThreshold, threshold, len(witnesses))
+	}
+
+	return nil
+}
+
+// ValidateUnlockShareEvent validates a kind 11991 unlock share: ["e", <capsule id>]
+// and a non-empty share in the content
+func ValidateUnlockShareEvent(evt *nostr.Event) error {
+	if evt.Kind != constants.KindUnlockShare {
+		return fmt.Errorf("invalid kind: expected %d, got %d", constants.KindUnlockShare, evt.Kind)
+	}
+
+	if _, err := ExtractCapsuleReference(evt); err != nil {
+		return err
+	}
+
+	if evt.Content == "" {
+		return fmt.Errorf("unlock share content must not be empty")
+	}
+	if len(evt.Content) > constants.MaxTlockBlobSize {
+		return fmt.Errorf("unlock share too large: %d bytes exceeds %d limit", len(evt.Content), constants.MaxTlockBlobSize)
+	}
+
+	return nil
+}
+
 // Helper functions for clients (optional to use)
 
+// ExtractCapsuleReference returns the capsule ID from the single e tag of a share event
+func ExtractCapsuleReference(evt *nostr.Event) (string, error) {
+	capsuleID := ""
+	for _, tag := range evt.Tags {
+		if len(tag) < 2 || tag[0] != constants.TagE {
+			continue
+		}
+		if capsuleID != "" {
+			return "", fmt.Errorf("share event must reference exactly one capsule")
+		}
+		capsuleID = tag[1]
+	}
+	if capsuleID == "" {
+		return "", fmt.Errorf(constants.ErrMissingCapsuleReference)
+	}
+	if !isLowerHex64(capsuleID) {
+		return "", fmt.Errorf("%s: capsule id must be 64 lowercase hex characters", constants.ErrMissingCapsuleReference)
+	}
+	return capsuleID, nil
+}
+
+// ExtractShareThreshold returns the threshold and the distinct witness pubkeys of a
+// share distribution event
+func ExtractShareThreshold(evt *nostr.Event) (int, []string, error) {
+	threshold := 0
+	var witnesses []string
+	seen := make(map[string]bool)
+
+	for _, tag := range evt.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case constants.TagThreshold:
+			if threshold != 0 {
+				return 0, nil, fmt.Errorf("%s: duplicate threshold tag", constants.ErrInvalidThreshold)
+			}
+			t, err := strconv.Atoi(tag[1])
+			if err != nil || t < 1 {
+				return 0, nil, fmt.Errorf("%s: must be a positive integer", constants.ErrInvalidThreshold)
+			}
+			threshold = t
+		case constants.TagP:
+			if !isLowerHex64(tag[1]) {
+				return 0, nil, fmt.Errorf("%s: pubkey must be 64 lowercase hex characters", constants.ErrInvalidWitness)
+			}
+			if seen[tag[1]] {
+				return 0, nil, fmt.Errorf("%s: duplicate witness %s", constants.ErrInvalidWitness, tag[1])
+			}
+			seen[tag[1]] = true
+			witnesses = append(witnesses, tag[1])
+		}
+	}
+
+	if threshold == 0 {
+		return 0, nil, fmt.Errorf("%s: missing threshold tag", constants.ErrInvalidThreshold)
+	}
+	return threshold, witnesses, nil
+}
+
+// isLowerHex64 reports whether s is a 64 character lowercase hex string
+func isLowerHex64(s string) bool {
+	matched, _ := regexp.MatchString("^[0-9a-f]{64}$", s)
+	return matched
+}
+
 // ExtractDrandParameters extracts drand chain hash and round from tlock tag (new format)
 func ExtractDrandParameters(evt *nostr.Event) (chainHash string, round int64, err error) {
 	tlockTag := findTlockTag(evt.Tags)
@@ -157,6 +299,28 @@ func ExtractDrandParameters(evt *nostr.Event) (chainHash string, round int64, er
 	return chainHash, round, nil
 }
 
+// WantsUnlockedCapsules reports whether a filter uses the "#unlocked" vendor filter
+func WantsUnlockedCapsules(f nostr.Filter) bool {
+	values, ok := f.Tags[constants.FilterTagUnlocked]
+	return ok && len(values) > 0
+}
+
+// WithoutUnlockedFilter returns a copy of f without the "#unlocked" vendor filter,
+// so the remaining conditions can be matched against events normally
+func WithoutUnlockedFilter(f nostr.Filter) nostr.Filter {
+	if !WantsUnlockedCapsules(f) {
+		return f
+	}
+	tags := make(nostr.TagMap, len(f.Tags)-1)
+	for name, values := range f.Tags {
+		if name != constants.FilterTagUnlocked {
+			tags[name] = values
+		}
+	}
+	f.Tags = tags
+	return f
+}
+
 // GetFirstRecipientPubkey extracts the first recipient pubkey from p tags
 func GetFirstRecipientPubkey(tags nostr.Tags) string {
 	for _, tag := range tags {
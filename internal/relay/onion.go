@@ -0,0 +1,76 @@
+package relay
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/web"
+	"go.uber.org/zap"
+)
+
+// onionClientIP stands for the address of clients reaching the relay through the
+// onion service. Tor hides their address and every one of them arrives from the
+// local tor daemon, so they share it for bans and connection limits.
+const onionClientIP = "onion"
+
+// onionKey is the request context key marking requests made through the onion
+// service
+type onionKey struct{}
+
+// isOnionRequest reports whether r reached the relay through the onion service
+func isOnionRequest(r *http.Request) bool {
+	onion, _ := r.Context().Value(onionKey{}).(bool)
+	return onion
+}
+
+// clientIP returns the address of the client behind r, onionClientIP for onion
+// clients
+func (s *Server) clientIP(r *http.Request) string {
+	if isOnionRequest(r) {
+		return onionClientIP
+	}
+	return s.clientIPs.ClientIP(r)
+}
+
+// serveOnion serves the relay on TOR.LISTEN_ADDR, where tor forwards the onion
+// service, until ctx is done or the node drains
+func (s *Server) serveOnion(ctx context.Context) {
+	addr := s.fullCfg.Tor.ListenAddr
+	srv := &http.Server{
+		Addr: addr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = r.WithContext(context.WithValue(r.Context(), onionKey{}, true))
+			// Tor connects from localhost, so proxy headers of onion clients
+			// would pass for those of a trusted proxy
+			r.Header.Del("X-Real-IP")
+			r.Header.Del("X-Forwarded-For")
+			http.DefaultServeMux.ServeHTTP(w, r)
+		}),
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+
+	ln, err := web.Listen(ctx, addr, s.cfg.ReusePort)
+	if err != nil {
+		logger.Error("Onion service listener error", zap.String("address", addr), zap.Error(err))
+		return
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-s.node.Draining():
+		}
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("Onion service listener started", zap.String("address", addr))
+	if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+		logger.Error("Onion service listener error", zap.String("address", addr), zap.Error(err))
+	}
+}
@@ -0,0 +1,350 @@
+package relay
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/payments"
+	"github.com/Shugur-Network/relay/internal/storage"
+	"github.com/Shugur-Network/relay/internal/web"
+	"go.uber.org/zap"
+)
+
+// pubkeyPattern matches a 64 character hex pubkey
+var pubkeyPattern = regexp.MustCompile(`^[a-fA-F0-9]{64}$`)
+
+// ledgerEntryLimit bounds the entries returned with a ledger balance
+const ledgerEntryLimit = 100
+
+// ledgerResponse is the body returned by GET /api/payments/ledger/<pubkey>
+type ledgerResponse struct {
+	PubKey       string                `json:"pubkey"`
+	BalanceMsats int64                 `json:"balance_msats"`
+	Entries      []storage.LedgerEntry `json:"entries"`
+}
+
+// maxPaymentRequestBody caps the JSON body of the payment endpoints
+const maxPaymentRequestBody = 4096
+
+// maxCashuRequestBody caps the JSON body of POST /api/payments/cashu, which
+// carries a token of up to 64 proofs
+const maxCashuRequestBody = 64 * 1024
+
+// paymentHashPattern matches a 64 character hex payment hash
+var paymentHashPattern = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// invoiceRequest is the body accepted by POST /api/payments/invoice
+type invoiceRequest struct {
+	PubKey string `json:"pubkey"`
+	// Plan is "admission", "subscription" or a tier name, "admission" when empty
+	Plan string `json:"plan,omitempty"`
+}
+
+// cashuRequest is the body accepted by POST /api/payments/cashu
+type cashuRequest struct {
+	PubKey string `json:"pubkey"`
+	Token  string `json:"token"`
+}
+
+// paymentWebhook is the body accepted by POST /api/payments/webhook. Only the
+// payment hash is used; settlement is always confirmed with the backend.
+type paymentWebhook struct {
+	PaymentHash string `json:"payment_hash"`
+}
+
+// handlePayments routes the lightning invoice, Cashu and zap ledger API under /api/payments/
+func (s *Server) handlePayments(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/payments/")
+	if strings.HasPrefix(path, "ledger/") {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.handleLedger(w, r, strings.TrimPrefix(path, "ledger/"))
+		return
+	}
+	if path == "cashu" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.handleCashuPayment(w, r)
+		return
+	}
+
+	service := s.node.Payments()
+	if service == nil {
+		http.NotFound(w, r)
+		return
+	}
+	switch {
+	case path == "invoice":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.handleCreateInvoice(w, r, service)
+	case strings.HasPrefix(path, "invoice/"):
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.handleInvoiceStatus(w, r, service, strings.TrimPrefix(path, "invoice/"))
+	case path == "webhook":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.handlePaymentWebhook(w, r, service)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleLedger serves GET /api/payments/ledger/<pubkey>: the pubkey's zap and
+// Cashu top-up balance and its recent credits and debits
+func (s *Server) handleLedger(w http.ResponseWriter, r *http.Request, pubkey string) {
+	if s.node.Zaps() == nil && s.node.Cashu() == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	balance, entries, err := s.node.DB().GetLedger(r.Context(), pubkey, ledgerEntryLimit)
+	if err != nil {
+		logger.Error("Failed to load payment ledger", zap.String("pubkey", pubkey), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := ledgerResponse{PubKey: pubkey, BalanceMsats: balance, Entries: entries}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Error("Failed to encode payment ledger", zap.Error(err))
+	}
+}
+
+// handleCashuPayment serves POST /api/payments/cashu: redeems a Cashu token at
+// its mint and credits it to the pubkey, which needn't be the payer's
+func (s *Server) handleCashuPayment(w http.ResponseWriter, r *http.Request) {
+	cashu := s.node.Cashu()
+	if cashu == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var req cashuRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCashuRequestBody)).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if !pubkeyPattern.MatchString(req.PubKey) {
+		http.Error(w, "pubkey must be 64 hex characters", http.StatusBadRequest)
+		return
+	}
+
+	payment, err := cashu.Redeem(r.Context(), strings.ToLower(req.PubKey), req.Token)
+	switch {
+	case errors.Is(err, payments.ErrInvalidToken), errors.Is(err, payments.ErrMintNotAllowed):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, payments.ErrTokenSpent):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		logger.Warn("Failed to redeem cashu token", zap.String("pubkey", req.PubKey), zap.Error(err))
+		http.Error(w, "Failed to redeem token", http.StatusBadGateway)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(payment); err != nil {
+		logger.Error("Failed to encode cashu payment", zap.Error(err))
+	}
+}
+
+// handleCreateInvoice serves POST /api/payments/invoice: issues a lightning
+// invoice that admits the pubkey once paid
+func (s *Server) handleCreateInvoice(w http.ResponseWriter, r *http.Request, service *payments.Service) {
+	var req invoiceRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPaymentRequestBody)).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if !pubkeyPattern.MatchString(req.PubKey) {
+		http.Error(w, "pubkey must be 64 hex characters", http.StatusBadRequest)
+		return
+	}
+	if req.Plan == "" {
+		req.Plan = payments.PlanAdmission
+	}
+
+	inv, err := service.CreateInvoice(r.Context(), strings.ToLower(req.PubKey), req.Plan)
+	if errors.Is(err, payments.ErrUnknownPlan) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to create invoice", zap.String("pubkey", req.PubKey), zap.Error(err))
+		http.Error(w, "Failed to create invoice", http.StatusBadGateway)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(inv); err != nil {
+		logger.Error("Failed to encode invoice", zap.Error(err))
+	}
+}
+
+// handleInvoiceStatus serves GET /api/payments/invoice/<payment hash>, checking a
+// pending invoice with the backend so clients can poll for admission
+func (s *Server) handleInvoiceStatus(w http.ResponseWriter, r *http.Request, service *payments.Service, paymentHash string) {
+	inv, err := service.Reconcile(r.Context(), paymentHash)
+	if errors.Is(err, storage.ErrInvoiceNotFound) {
+		http.Error(w, "Invoice not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Warn("Failed to check invoice", zap.String("payment_hash", paymentHash), zap.Error(err))
+		if inv == nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := json.NewEncoder(w).Encode(inv); err != nil {
+		logger.Error("Failed to encode invoice", zap.Error(err))
+	}
+}
+
+// handlePaymentWebhook serves POST /api/payments/webhook, the settlement
+// callback of the lightning backend. The named invoice is reconciled with the
+// backend, so a forged webhook can't credit an unpaid invoice.
+func (s *Server) handlePaymentWebhook(w http.ResponseWriter, r *http.Request, service *payments.Service) {
+	if secret := s.fullCfg.Payments.Lightning.WebhookSecret; secret != "" &&
+		subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Webhook-Secret")), []byte(secret)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var hook paymentWebhook
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPaymentRequestBody)).Decode(&hook); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	hook.PaymentHash = strings.ToLower(hook.PaymentHash)
+	if !paymentHashPattern.MatchString(hook.PaymentHash) {
+		http.Error(w, "payment_hash must be 64 hex characters", http.StatusBadRequest)
+		return
+	}
+
+	inv, err := service.Reconcile(r.Context(), hook.PaymentHash)
+	if errors.Is(err, storage.ErrInvoiceNotFound) {
+		http.Error(w, "Invoice not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Warn("Failed to reconcile invoice from webhook", zap.String("payment_hash", hook.PaymentHash), zap.Error(err))
+		http.Error(w, "Failed to confirm payment", http.StatusBadGateway)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(map[string]string{"status": inv.Status}); err != nil {
+		logger.Error("Failed to encode webhook response", zap.Error(err))
+	}
+}
+
+// paidRequest is the body accepted by POST /api/admin/paid
+type paidRequest struct {
+	PubKey string `json:"pubkey"`
+	// PaidUntil is the unix time admission lapses, 0 for no expiry
+	PaidUntil int64 `json:"paid_until"`
+	// Source notes how the payment was made, "admin" when empty
+	Source string `json:"source,omitempty"`
+	// Tier is the membership tier granted, which selects its rate limits
+	Tier string `json:"tier,omitempty"`
+}
+
+// handleAdminPaid lists (GET) or records (POST) paid pubkeys
+func (s *Server) handleAdminPaid(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		paid, err := s.node.DB().GetPaidPubkeys(r.Context(), time.Now().Add(-s.fullCfg.Payments.GracePeriod).Unix())
+		if err != nil {
+			web.WriteAdminError(w, http.StatusInternalServerError, "failed to load paid pubkeys")
+			return
+		}
+		web.WriteAdminJSON(w, http.StatusOK, paid)
+
+	case http.MethodPost:
+		var req paidRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			web.WriteAdminError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		if !pubkeyPattern.MatchString(req.PubKey) {
+			web.WriteAdminError(w, http.StatusBadRequest, "pubkey must be 64 hex characters")
+			return
+		}
+		if req.PaidUntil < 0 || (req.PaidUntil != 0 && req.PaidUntil <= time.Now().Unix()) {
+			web.WriteAdminError(w, http.StatusBadRequest, "paid_until must be 0 or in the future")
+			return
+		}
+		if req.Source == "" {
+			req.Source = "admin"
+		}
+		if req.Tier != "" && s.fullCfg.Payments.Tier(req.Tier) == nil {
+			web.WriteAdminError(w, http.StatusBadRequest, "unknown tier")
+			return
+		}
+
+		pubkey := strings.ToLower(req.PubKey)
+		if err := s.node.DB().SetPaidPubkey(r.Context(), pubkey, req.PaidUntil, req.Source, req.Tier, time.Now().Unix()); err != nil {
+			web.WriteAdminError(w, http.StatusInternalServerError, "failed to record paid pubkey")
+			return
+		}
+		s.node.SetPaid(pubkey, req.PaidUntil, req.Tier)
+
+		logger.Info("Recorded paid pubkey",
+			zap.String("pubkey", pubkey),
+			zap.Int64("paid_until", req.PaidUntil),
+			zap.String("source", req.Source),
+			zap.String("tier", req.Tier))
+		web.WriteAdminJSON(w, http.StatusCreated, req)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleAdminPaidPubkey revokes (DELETE) a pubkey's paid admission
+func (s *Server) handleAdminPaidPubkey(w http.ResponseWriter, r *http.Request, pubkey string) {
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", "DELETE")
+		web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !pubkeyPattern.MatchString(pubkey) {
+		web.WriteAdminError(w, http.StatusBadRequest, "pubkey must be 64 hex characters")
+		return
+	}
+
+	pubkey = strings.ToLower(pubkey)
+	if err := s.node.DB().DeletePaidPubkey(r.Context(), pubkey); err != nil {
+		web.WriteAdminError(w, http.StatusInternalServerError, "failed to revoke paid pubkey")
+		return
+	}
+	s.node.RevokePaid(pubkey)
+
+	logger.Info("Revoked paid pubkey", zap.String("pubkey", pubkey))
+	w.WriteHeader(http.StatusNoContent)
+}
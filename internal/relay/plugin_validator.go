@@ -2,18 +2,24 @@ package relay
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
+	"github.com/Shugur-Network/relay/internal/blocklist"
+	"github.com/Shugur-Network/relay/internal/clock"
 	"github.com/Shugur-Network/relay/internal/config"
+	"github.com/Shugur-Network/relay/internal/constants"
 	"github.com/Shugur-Network/relay/internal/domain"
+	"github.com/Shugur-Network/relay/internal/drand"
 	"github.com/Shugur-Network/relay/internal/logger"
 	"github.com/Shugur-Network/relay/internal/metrics"
 	"github.com/Shugur-Network/relay/internal/relay/nips"
 	"github.com/Shugur-Network/relay/internal/storage"
+	"github.com/jackc/pgx/v5"
 	nostr "github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip13"
 	"go.uber.org/zap"
 )
 
@@ -29,8 +35,6 @@ type ValidationLimits struct {
 	MaxMetadataLength int
 	AllowedKinds      map[int]bool
 	RequiredTags      map[int][]string
-	MaxCreatedAt      int64
-	MinCreatedAt      int64
 }
 
 // PluginValidator implements EventValidator
@@ -41,6 +45,15 @@ type PluginValidator struct {
 
 	verifiedPubkeys map[string]time.Time
 	db              *storage.DB
+
+	// drand verifies time capsule beacon references when CAPSULES.DRAND_VERIFY is set
+	drand *drand.Client
+
+	// urlBlocklist screens linked URLs, nil when no blocklist is in use
+	urlBlocklist *blocklist.Domains
+	// feedBlocklist holds the pubkeys and events blocked by blocklist feeds, nil
+	// when no feed is configured
+	feedBlocklist *blocklist.Entries
 }
 
 // Ensure PluginValidator implements domain.EventValidator
@@ -59,7 +72,7 @@ func NewPluginValidator(cfg *config.Config, database *storage.DB) *PluginValidat
 		MaxTagsLength:     10000,
 		MaxTagsPerEvent:   256,
 		MaxTagElements:    16,
-		MaxFutureSeconds:  300,
+		MaxFutureSeconds:  int(cfg.RelayPolicy.CreatedAt.MaxFuture.Seconds()),
 		OldestEventTime:   1609459200, // Jan 1, 2021
 		RelayStartupTime:  time.Now(),
 		MaxMetadataLength: 10000,
@@ -67,8 +80,9 @@ func NewPluginValidator(cfg *config.Config, database *storage.DB) *PluginValidat
 			0: true, 1: true, 2: true, 3: true, 4: true, 5: true,
 			6: true, 7: true, 40: true, 41: true, 42: true, 43: true, 44: true,
 			14: true, 15: true, 1059: true, 10050: true,
-			1984: true, 9734: true, 9735: true, 10002: true, 30023: true, 31989: true,
+			1984: true, 9734: true, 9735: true, 10002: true, 30023: true, 31989: true, 31990: true,
 			1111: true, // NIP-22: Comment
+			62:   true, // NIP-62: Request to Vanish
 			// NIP-20 Command Results
 			24133: true,
 			// NIP-16 Ephemeral Events (20000-29999)
@@ -110,7 +124,8 @@ func NewPluginValidator(cfg *config.Config, database *storage.DB) *PluginValidat
 			// Other NIPs
 			8:     true, // NIP-58: Badge Award
 			1040:  true, // NIP-03 OpenTimestamps attestation
-			1041:  true, // NIP-XX Time-Lock Encrypted Messages
+			11991: true, // NIP-XX Time capsule unlock share
+			11992: true, // NIP-XX Time capsule share distribution
 			13194: true, // NIP-59 Wallet Connect events
 			30008: true, // NIP-58: Profile Badges
 			30009: true, // NIP-58: Badge Definition
@@ -143,7 +158,6 @@ func NewPluginValidator(cfg *config.Config, database *storage.DB) *PluginValidat
 			4550:  true, // Moderation Approval
 		},
 		RequiredTags: map[int][]string{
-			5:     {"e"},      // Deletion events must have an "e" tag
 			7:     {"e", "p"}, // Reaction events require "e" and "p" tags
 			8:     {"a", "p"}, // NIP-58: Badge Award requires "a" and "p" tags
 			41:    {"e"},      // NIP-28: Channel Metadata requires "e" tag
@@ -171,13 +185,17 @@ func NewPluginValidator(cfg *config.Config, database *storage.DB) *PluginValidat
 			1021:  {"e"},      // Bid events require "e" tag
 			1022:  {"e"},      // Bid confirmation events require "e" tag
 			1040:  {"e"},      // OpenTimestamps attestation requires "e" tag
-			1041:  {"tlock"},  // NIP-XX Time capsule requires "tlock" tag
 			30078: {"p"},      // NIP-78: Application-specific Data requires "p" tag
+			31989: {"d", "a"}, // NIP-89: Handler recommendation requires "d" and "a" tags
+			31990: {"d", "k"}, // NIP-89: Handler information requires "d" and "k" tags
 			// NIP-52 Calendar Events
 			31922: {"d", "title", "start"}, // Date-based Calendar Event requires "d", "title", and "start" tags
 			31923: {"d", "title", "start"}, // Time-based Calendar Event requires "d", "title", and "start" tags
 			31924: {"d", "title"},          // Calendar requires "d" and "title" tags
 			31925: {"d", "a", "status"},    // Calendar Event RSVP requires "d", "a", and "status" tags
+			// NIP-XX Time capsule witness shares
+			11991: {"e"},              // Unlock share requires the capsule "e" tag
+			11992: {"e", "threshold"}, // Share distribution requires "e" and "threshold" tags
 			// NIP-53 Live Activities
 			30311: {"d"},                    // Live Streaming Event requires "d" tag
 			1311:  {"a"},                    // Live Chat Message requires "a" tag
@@ -194,27 +212,152 @@ func NewPluginValidator(cfg *config.Config, database *storage.DB) *PluginValidat
 			34550: {"d"},                    // Community Definition requires "d" tag
 			4550:  {"a", "p", "k"},          // Moderation Approval requires community, author, and kind tags (e tag only for non-replaceable events)
 		},
-		MaxCreatedAt: time.Now().Unix() + 300,    // 5 minutes in future
-		MinCreatedAt: time.Now().Unix() - 172800, // 2 days in past
 	}
 
-	return &PluginValidator{
+	// NIP-XX Time capsules use the configured kinds (CAPSULES.KINDS, 1041 by default)
+	for _, kind := range nips.TimeCapsuleKinds() {
+		defaultLimits.AllowedKinds[kind] = true
+		defaultLimits.RequiredTags[kind] = []string{constants.TagTlock}
+	}
+
+	pv := &PluginValidator{
 		config:          cfg,
 		blacklist:       make(map[string]bool),
 		limits:          defaultLimits,
 		verifiedPubkeys: make(map[string]time.Time),
 		db:              database,
 	}
+	if cfg.Capsules.DrandVerify {
+		pv.drand = drand.NewClient(cfg.Capsules.DrandURLs, cfg.Capsules.DrandTimeout)
+	}
+	return pv
 }
 
-// ValidateEvent checks an event thoroughly
-func (pv *PluginValidator) ValidateEvent(ctx context.Context, event nostr.Event) (bool, string) {
+// ValidateEvent checks an event published to tenant thoroughly
+func (pv *PluginValidator) ValidateEvent(ctx context.Context, tenant string, event nostr.Event) (bool, string) {
 
 	// Check context cancellation at strategic points
 	if ctx.Err() != nil {
 		return false, "operation canceled"
 	}
 
+	// 1-4. Structure, kind, blacklist and ID checks
+	if ok, reason := pv.checkIdentity(&event); !ok {
+		return false, reason
+	}
+
+	// NIP-13: Proof of work, which must be committed to in the nonce tag
+	if minPow := pv.config.RelayPolicy.MinPowDifficulty; minPow > 0 {
+		if work := nip13.Difficulty(event.ID); work < minPow {
+			return false, nips.FormatErrorMessage(nips.ErrorCodePowerLevels,
+				fmt.Sprintf("difficulty %d is less than %d", work, minPow))
+		}
+		if committed := nip13.CommittedDifficulty(&event); committed < minPow {
+			return false, nips.FormatErrorMessage(nips.ErrorCodePowerLevels,
+				fmt.Sprintf("nonce tag must commit to a difficulty of at least %d", minPow))
+		}
+	}
+
+	// 5. Check timestamps against the kind's window around the current time
+	now := time.Now().Unix()
+	createdAt := int64(event.CreatedAt)
+	maxPast, maxFuture := pv.config.RelayPolicy.CreatedAt.Bounds(event.Kind)
+	// A clock found skewed widens the bounds by its offset
+	if slack := clock.Tolerance(); slack > 0 {
+		if maxPast > 0 {
+			maxPast += slack
+		}
+		if maxFuture > 0 {
+			maxFuture += slack
+		}
+	}
+
+	if maxFuture > 0 && createdAt > now+int64(maxFuture.Seconds()) {
+		return false, fmt.Sprintf("event timestamp is too far in the future (max %d seconds)", int64(maxFuture.Seconds()))
+	}
+
+	if createdAt < pv.limits.OldestEventTime {
+		return false, "event timestamp is too old"
+	}
+	if maxPast > 0 && createdAt < now-int64(maxPast.Seconds()) {
+		return false, fmt.Sprintf("event timestamp is too old (max %d seconds)", int64(maxPast.Seconds()))
+	}
+
+	// 6. NIP-40: Check expiration timestamp
+	if expTime, hasExpiration := nips.GetExpirationTime(event); hasExpiration {
+		if time.Now().After(expTime) {
+			return false, "event has expired"
+		}
+		// Validate expiration tag format
+		if err := nips.ValidateExpirationTag(event); err != nil {
+			return false, fmt.Sprintf("invalid expiration tag: %v", err)
+		}
+		// Enforce the operator's expiration bounds (RELAY_POLICY.EXPIRATION)
+		bounds := pv.config.RelayPolicy.Expiration
+		if err := nips.ValidateExpirationBounds(expTime, time.Now(), bounds.MinDuration, bounds.MaxHorizon); err != nil {
+			return false, fmt.Sprintf("invalid: %v", err)
+		}
+	}
+
+	// 6-8. Content, tags and kind-specific required tags
+	if ok, reason := pv.checkShape(&event); !ok {
+		return false, reason
+	}
+
+	// Links to blocked domains
+	if ok, reason := pv.screenURLs(&event); !ok {
+		return false, reason
+	}
+
+	// Deletions may only target the deleter's own events
+	if event.Kind == 5 {
+		if err := nips.ValidateDeletionAuth(event.Tags, event.PubKey, func(id string) (nostr.Event, bool) {
+			target, err := pv.db.GetEventByID(ctx, tenant, id)
+			if err != nil {
+				return nostr.Event{}, false
+			}
+			return target, target.ID != ""
+		}); err != nil {
+			logger.Warn("Unauthorized deletion attempt blocked",
+				zap.String("deletion_event_id", event.ID),
+				zap.String("deleter_pubkey", event.PubKey),
+				zap.Error(err))
+			return false, nips.FormatErrorMessage(nips.ErrorCodeRestricted, "only the event author can delete their events")
+		}
+	}
+
+	// NIP-specific validation using dedicated validators
+	if err := pv.validateWithDedicatedNIPs(&event); err != nil {
+		return false, fmt.Sprintf("NIP validation failed: %v", err)
+	}
+
+	return true, ""
+}
+
+// RevalidateEvent checks a stored event against the current policies. What only
+// applies when an event arrives is left out: its timestamps, its expiration and
+// the authorization of deletions against the events stored at the time.
+func (pv *PluginValidator) RevalidateEvent(ctx context.Context, event nostr.Event) (bool, string) {
+	if ctx.Err() != nil {
+		return false, "operation canceled"
+	}
+	if ok, reason := pv.checkIdentity(&event); !ok {
+		return false, reason
+	}
+	if ok, reason := pv.checkShape(&event); !ok {
+		return false, reason
+	}
+	if ok, reason := pv.screenURLs(&event); !ok {
+		return false, reason
+	}
+	if err := pv.validateWithDedicatedNIPs(&event); err != nil {
+		return false, fmt.Sprintf("NIP validation failed: %v", err)
+	}
+	return true, ""
+}
+
+// checkIdentity checks the event's structure, kind, author and ID
+func (pv *PluginValidator) checkIdentity(event *nostr.Event) (bool, string) {
 	// 1. Basic structure checks
 	if len(event.ID) != 64 || !isHexString(event.ID) {
 		return false, "invalid event ID format"
@@ -240,7 +383,7 @@ func (pv *PluginValidator) ValidateEvent(ctx context.Context, event nostr.Event)
 
 	// 3. Check blacklist (case-insensitive)
 	if pv.blacklist[strings.ToLower(event.PubKey)] {
-		return false, "pubkey is blacklisted"
+		return false, nips.FormatErrorMessage(nips.ErrorCodeBlacklisted, "pubkey is blacklisted")
 	}
 
 	// 4. Verify event ID matches content
@@ -249,29 +392,27 @@ func (pv *PluginValidator) ValidateEvent(ctx context.Context, event nostr.Event)
 		return false, "event ID does not match content"
 	}
 
-	// 5. Check timestamps
-	now := time.Now().Unix()
-	maxFutureTime := now + int64(pv.limits.MaxFutureSeconds)
-
-	if event.CreatedAt.Time().Unix() > maxFutureTime {
-		return false, fmt.Sprintf("event timestamp is too far in the future (max %d seconds)", pv.limits.MaxFutureSeconds)
-	}
-
-	if event.CreatedAt.Time().Unix() < pv.limits.OldestEventTime {
-		return false, "event timestamp is too old"
-	}
-
-	// 6. NIP-40: Check expiration timestamp
-	if expTime, hasExpiration := nips.GetExpirationTime(event); hasExpiration {
-		if time.Now().After(expTime) {
-			return false, "event has expired"
+	// 4a. Check the pubkeys and events listed by blocklist feeds
+	if pv.feedBlocklist != nil {
+		if feed, blocked := pv.feedBlocklist.PubKey(event.PubKey); blocked {
+			logger.Debug("Event author listed by blocklist feed",
+				zap.String("event_id", event.ID),
+				zap.String("feed", feed))
+			return false, nips.FormatErrorMessage(nips.ErrorCodeBlacklisted, "pubkey is blacklisted")
 		}
-		// Validate expiration tag format
-		if err := nips.ValidateExpirationTag(event); err != nil {
-			return false, fmt.Sprintf("invalid expiration tag: %v", err)
+		if feed, blocked := pv.feedBlocklist.Event(event.ID); blocked {
+			logger.Debug("Event listed by blocklist feed",
+				zap.String("event_id", event.ID),
+				zap.String("feed", feed))
+			return false, nips.FormatErrorMessage(nips.ErrorCodeBlacklisted, "event is blocked")
 		}
 	}
 
+	return true, ""
+}
+
+// checkShape checks the event's content and tags against the limits
+func (pv *PluginValidator) checkShape(event *nostr.Event) (bool, string) {
 	// 6. Content length check
 	if len(event.Content) > pv.limits.MaxContentLength {
 		return false, fmt.Sprintf("content exceeds maximum length of %d bytes", pv.limits.MaxContentLength)
@@ -315,35 +456,54 @@ func (pv *PluginValidator) ValidateEvent(ctx context.Context, event nostr.Event)
 		}
 	}
 
-	// Special handling for deletion events (kind 5)
-	if event.Kind == 5 {
-		// Validate deletion authorization
-		for _, tag := range event.Tags {
-			if len(tag) >= 2 && tag[0] == "e" {
-				targetEvent, err := pv.db.GetEventByID(context.Background(), tag[1])
-				if err == nil && targetEvent.ID != "" && targetEvent.PubKey != event.PubKey {
-					logger.Warn("Unauthorized deletion attempt blocked",
-						zap.String("deletion_event_id", event.ID),
-						zap.String("deleter_pubkey", event.PubKey),
-						zap.String("target_event_id", tag[1]),
-						zap.String("target_event_pubkey", targetEvent.PubKey))
-					return false, "unauthorized: only the event author can delete their events"
-				}
-			}
-		}
-	}
+	return true, ""
+}
 
-	// NIP-specific validation using dedicated validators
-	if err := pv.validateWithDedicatedNIPs(&event); err != nil {
-		return false, fmt.Sprintf("NIP validation failed: %v", err)
+// UseURLBlocklist screens the URLs events link to against domains, as
+// RELAY_POLICY.URL_BLOCKLIST.ACTION says
+func (pv *PluginValidator) UseURLBlocklist(domains *blocklist.Domains) {
+	pv.urlBlocklist = domains
+}
+
+// UseFeedBlocklist refuses the pubkeys and events listed by blocklist feeds
+func (pv *PluginValidator) UseFeedBlocklist(entries *blocklist.Entries) {
+	pv.feedBlocklist = entries
+}
+
+// screenURLs rejects an event linking to a blocked domain, or only logs it when
+// the blocklist flags such events
+func (pv *PluginValidator) screenURLs(event *nostr.Event) (bool, string) {
+	if pv.urlBlocklist == nil {
+		return true, ""
+	}
+	domain, blocked := pv.urlBlocklist.BlockedIn(event)
+	if !blocked {
+		return true, ""
 	}
 
-	return true, ""
+	action := pv.config.RelayPolicy.URLBlocklist.Action
+	if action == "flag" {
+		metrics.BlockedURLEvents.WithLabelValues("flagged").Inc()
+		logger.Warn("Event links to a blocked domain",
+			zap.String("event_id", event.ID),
+			zap.String("pubkey", event.PubKey),
+			zap.String("domain", domain))
+		return true, ""
+	}
+	metrics.BlockedURLEvents.WithLabelValues("rejected").Inc()
+	return false, nips.FormatErrorMessage(nips.ErrorCodeBlacklisted, fmt.Sprintf("links to blocked domain %s", domain))
 }
 
 // validateWithDedicatedNIPs validates events using dedicated NIP validation functions
 func (pv *PluginValidator) validateWithDedicatedNIPs(event *nostr.Event) error {
+	// Time capsule kinds are configurable, so they can't be switch cases
+	if nips.IsTimeCapsuleKind(event.Kind) {
+		return nips.ValidateTimeCapsuleEvent(event)
+	}
+
 	switch event.Kind {
+	case 0:
+		return pv.validateMetadataEvent(*event)
 	case 3:
 		return nips.ValidateFollowList(event)
 	case 4:
@@ -360,6 +520,8 @@ func (pv *PluginValidator) validateWithDedicatedNIPs(event *nostr.Event) error {
 		return nips.ValidatePublicChat(event)
 	case 1040:
 		return nips.ValidateOpenTimestampsAttestation(event)
+	case 62:
+		return nips.ValidateVanishRequest(event)
 	case 1984:
 		return nips.ValidateReport(event)
 	case 9734:
@@ -378,12 +540,18 @@ func (pv *PluginValidator) validateWithDedicatedNIPs(event *nostr.Event) error {
 		return nips.ValidateLongFormContent(event)
 	case 30078:
 		return nips.ValidateApplicationSpecificData(event)
+	case 31989:
+		return nips.ValidateHandlerRecommendation(event)
+	case 31990:
+		return nips.ValidateHandlerInformation(event)
 	case 13194:
 		return nips.ValidateGiftWrapEvent(event)
 	case 10002:
 		return nips.ValidateKind10002(*event)
-	case 1041:
-		return nips.ValidateTimeCapsuleEvent(event)
+	case 11991:
+		return nips.ValidateUnlockShareEvent(event)
+	case 11992:
+		return nips.ValidateShareDistributionEvent(event, pv.config.Capsules.MaxWitnesses)
 	case 1059:
 		return nips.ValidateGiftWrapEvent(event)
 	// NIP-51 Lists validation
@@ -479,7 +647,7 @@ func (pv *PluginValidator) ValidateFilter(f nostr.Filter) error {
 	// Don't allow queries too far in the future
 	now := time.Now().Unix()
 	maxFutureTime := now + int64(pv.limits.MaxFutureSeconds)
-	if f.Until != nil && f.Until.Time().Unix() > maxFutureTime {
+	if pv.limits.MaxFutureSeconds > 0 && f.Until != nil && f.Until.Time().Unix() > maxFutureTime {
 		return fmt.Errorf("'until' timestamp is too far in the future")
 	}
 
@@ -522,22 +690,21 @@ func (pv *PluginValidator) RemoveBlacklistedPubkey(pubkey string) {
 	delete(pv.blacklist, strings.ToLower(pubkey))
 }
 
-// ValidateAndProcessEvent performs validation and processing of incoming events
-func (pv *PluginValidator) ValidateAndProcessEvent(ctx context.Context, event nostr.Event) (bool, string, error) {
-	// Check event size using configured limit
-	if len(event.Content) > pv.limits.MaxContentLength {
-		return false, fmt.Sprintf("invalid: event content too large (max %d bytes)", pv.limits.MaxContentLength), nil
-	}
-
+// ValidateAndProcessEvent performs validation and processing of incoming events.
+// Duplicates of stored events come back as EventDuplicate and are not stored again.
+// ValidateEvent runs every check the event passes; only what needs the
+// signature or the state of time capsules is added here.
+func (pv *PluginValidator) ValidateAndProcessEvent(ctx context.Context, tenant string, event nostr.Event) domain.EventResult {
 	// Create a timeout context for database operations
 	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	// Direct database check for duplicates with retry
+	// Direct database check for duplicates with retry. Ephemeral events are
+	// never stored, so they don't touch the database.
 	var exists bool
 	var err error
-	for i := 0; i < 3; i++ {
-		exists, err = pv.db.EventExists(dbCtx, event.ID)
+	for i := 0; i < 3 && !nips.IsEphemeral(event.Kind); i++ {
+		exists, err = pv.db.EventExists(dbCtx, tenant, event.ID)
 		if err == nil {
 			break
 		}
@@ -545,95 +712,198 @@ func (pv *PluginValidator) ValidateAndProcessEvent(ctx context.Context, event no
 			time.Sleep(100 * time.Millisecond)
 			continue
 		}
-		return false, "error checking event existence", fmt.Errorf("database error after retries: %w", err)
+		logger.Warn("Failed to check event existence",
+			zap.String("event_id", event.ID),
+			zap.Error(err))
+		return domain.FailEvent("failed to check event existence")
 	}
 
 	if exists {
 		metrics.DuplicateEvents.Inc()
-		return true, "duplicate: event already exists", nil
+		return domain.DuplicateEvent()
 	}
 
-	// Verify event ID matches content (prevents ID spoofing)
-	computedID := event.GetID()
-	if computedID != event.ID {
-		return false, "invalid: event ID does not match content", nil
+	// Perform base validation, which also checks the ID matches the content
+	if valid, reason := pv.ValidateEvent(dbCtx, tenant, event); !valid {
+		if nips.IsTimeCapsuleKind(event.Kind) {
+			metrics.CapsulesRejected.WithLabelValues("invalid").Inc()
+		}
+		return rejection(reason)
 	}
 
 	// Verify signature (important for security)
 	valid, err := event.CheckSignature()
 	if err != nil || !valid {
-		return false, "invalid: signature verification failed", nil
+		return domain.RejectEvent(nips.ErrorCodeInvalidEvent, "signature verification failed")
 	}
 
-	// Perform base validation
-	valid, reason := pv.ValidateEvent(dbCtx, event)
-	if !valid {
-		return false, reason, nil
+	// Events their author deleted (NIP-09) aren't stored again when republished
+	if !nips.IsEphemeral(event.Kind) && event.Kind != nostr.KindDeletion {
+		deleted, err := pv.db.WasDeleted(dbCtx, tenant, event)
+		if err != nil {
+			logger.Warn("Failed to check event deletions",
+				zap.String("event_id", event.ID),
+				zap.Error(err))
+			return domain.FailEvent("failed to check event deletions")
+		}
+		if deleted {
+			return domain.RejectEvent(nips.ErrorCodeBlacklisted, "event was deleted by its author")
+		}
 	}
 
-	// Special handling for specific event kinds
-	switch event.Kind {
-	case 5: // deletion
-		if err := nips.ValidateDeletionAuth(
-			event.Tags,
-			event.PubKey,
-			func(id string) (nostr.Event, bool) {
-				evt, err := pv.db.GetEventByID(dbCtx, id)
-				if err != nil {
-					logger.Error("Error fetching event for deletion validation",
-						zap.String("event_id", id),
-						zap.Error(err))
-					return nostr.Event{}, false
-				}
-				return evt, true
-			},
-		); err != nil {
-			return false, err.Error(), nil
+	// NIP-XX Time capsule (configurable kinds)
+	if nips.IsTimeCapsuleKind(event.Kind) {
+		if err := pv.checkCapsuleChain(&event); err != nil {
+			metrics.CapsulesRejected.WithLabelValues("chain").Inc()
+			return domain.RejectEvent(nips.ErrorCodeInvalidEvent, fmt.Sprintf("invalid time capsule: %s", err.Error()))
 		}
-	case 0: // Metadata
-		if err := pv.validateMetadataEvent(event); err != nil {
-			return false, err.Error(), nil
+		if err := pv.verifyCapsuleBeacon(dbCtx, &event); err != nil {
+			metrics.CapsulesRejected.WithLabelValues("beacon").Inc()
+			return domain.RejectEvent(nips.ErrorCodeInvalidEvent, fmt.Sprintf("invalid time capsule: %s", err.Error()))
 		}
-
-	case 1041: // NIP-XX Time capsule
-		if err := nips.ValidateTimeCapsuleEvent(&event); err != nil {
-			return false, fmt.Sprintf("invalid time capsule: %s", err.Error()), nil
+		if reason, msg := pv.checkCapsuleQuota(dbCtx, tenant, &event); reason != "" {
+			metrics.CapsulesRejected.WithLabelValues(reason).Inc()
+			return rejection(msg)
 		}
-	case 1059: // NIP-59 Gift wrap (for private time capsules)
-		if err := nips.ValidateGiftWrapEvent(&event); err != nil {
-			return false, fmt.Sprintf("invalid gift wrap: %s", err.Error()), nil
+	}
+
+	// Witness shares are checked against the capsules they belong to
+	if event.Kind == 11991 || event.Kind == 11992 {
+		if err := pv.verifyCapsuleShare(dbCtx, tenant, &event); err != nil {
+			return domain.RejectEvent(nips.ErrorCodeInvalidEvent, fmt.Sprintf("invalid capsule share: %s", err.Error()))
 		}
 	}
 
 	// Check if delegation is being used (NIP-26)
 	if delegationTag := nips.ExtractDelegationTag(event); delegationTag != nil {
 		if err := nips.ValidateDelegation(&event, delegationTag); err != nil {
-			return false, fmt.Sprintf("invalid delegation: %s", err.Error()), nil
+			return domain.RejectEvent(nips.ErrorCodeInvalidEvent, fmt.Sprintf("invalid delegation: %s", err.Error()))
 		}
 		logger.Debug("Event with valid delegation accepted",
 			zap.String("event_id", event.ID),
 			zap.String("delegator", delegationTag.MasterPubkey))
 	}
 
-	return true, "", nil
+	return domain.AcceptEvent()
 }
 
-// validateMetadataEvent validates a metadata event (kind 0)
-func (pv *PluginValidator) validateMetadataEvent(event nostr.Event) error {
-	// Ensure content is valid JSON
-	var metadata map[string]interface{}
-	if err := json.Unmarshal([]byte(event.Content), &metadata); err != nil {
-		return fmt.Errorf("metadata must be valid JSON: %w", err)
+// checkCapsuleChain rejects capsules locked to a drand chain outside the
+// CAPSULES.DRAND_CHAINS allowlist, since the relay can't vouch they will ever unlock
+func (pv *PluginValidator) checkCapsuleChain(event *nostr.Event) error {
+	allowed := pv.config.Capsules.DrandChains
+	if len(allowed) == 0 {
+		return nil
 	}
+	chainHash, _, err := nips.ExtractDrandParameters(event)
+	if err != nil {
+		return err
+	}
+	for _, chain := range allowed {
+		if chain == chainHash {
+			return nil
+		}
+	}
+	return fmt.Errorf("drand chain %s is not accepted by this relay", chainHash)
+}
 
-	// Validate common metadata fields
-	if name, ok := metadata["name"].(string); ok && len(name) > 100 {
-		return fmt.Errorf("name field too long (max 100 characters)")
+// verifyCapsuleBeacon checks the capsule's drand chain and round against a drand
+// endpoint. Unreachable endpoints don't block ingestion; only answers that prove
+// the reference bogus (unknown chain, past round when required) reject the event.
+func (pv *PluginValidator) verifyCapsuleBeacon(ctx context.Context, event *nostr.Event) error {
+	if pv.drand == nil {
+		return nil
+	}
+	chainHash, round, err := nips.ExtractDrandParameters(event)
+	if err != nil {
+		return err
 	}
 
-	if about, ok := metadata["about"].(string); ok && len(about) > 500 {
-		return fmt.Errorf("about field too long (max 500 characters)")
+	err = pv.drand.VerifyRound(ctx, chainHash, round, pv.config.Capsules.DrandRequireFutureRound)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, drand.ErrUnknownChain), errors.Is(err, drand.ErrInvalidRound), errors.Is(err, drand.ErrRoundNotInFuture):
+		return err
+	default:
+		logger.Warn("drand verification unavailable, accepting capsule unverified",
+			zap.String("event_id", event.ID),
+			zap.String("chain", chainHash),
+			zap.Error(err))
+		return nil
+	}
+}
+
+// checkCapsuleQuota enforces the per-author capsule count and payload byte limits
+// on tenant. It returns the rejection reason label and message, or an empty reason if allowed.
+func (pv *PluginValidator) checkCapsuleQuota(ctx context.Context, tenant string, event *nostr.Event) (string, string) {
+	maxCount := pv.config.Capsules.MaxPerPubkey
+	maxBytes := pv.config.Capsules.MaxBytesPerPubkey
+	if maxCount <= 0 && maxBytes <= 0 {
+		return "", ""
 	}
 
+	count, bytes, err := pv.db.GetCapsuleUsage(ctx, tenant, event.PubKey)
+	if err != nil {
+		logger.Warn("Failed to check capsule quota, accepting capsule",
+			zap.String("pubkey", event.PubKey),
+			zap.Error(err))
+		return "", ""
+	}
+
+	if maxCount > 0 && count >= int64(maxCount) {
+		return "quota_count", fmt.Sprintf("blocked: capsule limit reached (%d per pubkey)", maxCount)
+	}
+	if maxBytes > 0 && bytes+int64(len(event.Content)) > maxBytes {
+		return "quota_bytes", fmt.Sprintf("blocked: capsule storage limit reached (%d bytes per pubkey)", maxBytes)
+	}
+	return "", ""
+}
+
+// verifyCapsuleShare checks share events against stored state when share tracking
+// is enabled: a distribution must come from the author of a stored capsule, and an
+// unlock share from one of the witnesses listed in the capsule's distribution.
+func (pv *PluginValidator) verifyCapsuleShare(ctx context.Context, tenant string, event *nostr.Event) error {
+	if !pv.config.Capsules.Enabled {
+		return nil
+	}
+	capsuleID, err := nips.ExtractCapsuleReference(event)
+	if err != nil {
+		return err
+	}
+
+	switch event.Kind {
+	case constants.KindShareDistribution:
+		capsule, err := pv.db.GetEventByID(ctx, tenant, capsuleID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("unknown capsule %s", capsuleID)
+		}
+		if err != nil {
+			return fmt.Errorf("error loading capsule")
+		}
+		if !nips.IsTimeCapsuleKind(capsule.Kind) {
+			return fmt.Errorf("referenced event is not a time capsule")
+		}
+		if capsule.PubKey != event.PubKey {
+			return fmt.Errorf("share distribution must be published by the capsule author")
+		}
+
+	case constants.KindUnlockShare:
+		progress, err := pv.db.GetShareProgress(ctx, tenant, capsuleID)
+		if errors.Is(err, storage.ErrShareDistributionNotFound) {
+			return fmt.Errorf("no share distribution for capsule %s", capsuleID)
+		}
+		if err != nil {
+			return fmt.Errorf("error loading share distribution")
+		}
+		if !progress.HasWitness(event.PubKey) {
+			return fmt.Errorf("pubkey is not a witness of this capsule")
+		}
+	}
 	return nil
 }
+
+// validateMetadataEvent validates a metadata event (kind 0) against the
+// RELAY_POLICY.METADATA ruleset
+func (pv *PluginValidator) validateMetadataEvent(event nostr.Event) error {
+	return checkMetadata(event.Content, pv.config.RelayPolicy.Metadata)
+}
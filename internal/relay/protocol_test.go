@@ -0,0 +1,280 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/capture"
+	"github.com/Shugur-Network/relay/internal/config"
+	"github.com/Shugur-Network/relay/internal/constants"
+	"github.com/Shugur-Network/relay/internal/domain"
+	"github.com/Shugur-Network/relay/internal/limiter"
+	"github.com/Shugur-Network/relay/internal/storage"
+	"github.com/Shugur-Network/relay/internal/tenant"
+	"github.com/gorilla/websocket"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"golang.org/x/time/rate"
+)
+
+const testPubkey = "79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+
+// protocolNode is the part of a node the checks ahead of storage use; anything
+// else panics
+type protocolNode struct {
+	domain.NodeInterface
+	cfg       *config.Config
+	validator domain.EventValidator
+}
+
+func (n *protocolNode) Config() *config.Config                    { return n.cfg }
+func (n *protocolNode) GetValidator() domain.EventValidator       { return n.validator }
+func (n *protocolNode) ClassifyClient(string) limiter.ClientClass { return limiter.ClassAnonymous }
+func (n *protocolNode) TenantMeter() *tenant.Meter                { return nil }
+func (n *protocolNode) Captures() *capture.Recorder               { return nil }
+func (n *protocolNode) Suspension(string) (storage.Suspension, bool) {
+	return storage.Suspension{}, false
+}
+
+// protocolClient is a relay connection under test and the client end of its
+// WebSocket
+type protocolClient struct {
+	conn   *WsConnection
+	client *websocket.Conn
+}
+
+func newProtocolClient(t *testing.T, cfg *config.Config) *protocolClient {
+	t.Helper()
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conns <- ws
+	}))
+	t.Cleanup(srv.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	ws := <-conns
+	t.Cleanup(func() { _ = ws.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return &protocolClient{
+		conn: &WsConnection{
+			ws:               ws,
+			node:             &protocolNode{cfg: cfg, validator: NewPluginValidator(cfg, nil)},
+			realClientIP:     "192.0.2.1",
+			tenant:           storage.DefaultTenant,
+			subscriptions:    make(map[string][]nostr.Filter),
+			queries:          make(map[string]*pendingQuery),
+			limiter:          rate.NewLimiter(rate.Inf, 0),
+			reqLimiter:       rate.NewLimiter(rate.Inf, 0),
+			backpressureChan: make(chan struct{}, 16),
+			eventCtx:         ctx,
+			eventCancel:      cancel,
+		},
+		client: client,
+	}
+}
+
+// req sends a REQ frame of the given elements after the label
+func (p *protocolClient) req(t *testing.T, elems ...string) {
+	t.Helper()
+	var frame []json.RawMessage
+	if err := json.Unmarshal([]byte(`["REQ"`+joinElems(elems)+`]`), &frame); err != nil {
+		t.Fatal(err)
+	}
+	p.conn.handleRequest(context.Background(), frame)
+}
+
+// count sends a COUNT frame of the given elements after the label
+func (p *protocolClient) count(t *testing.T, elems ...string) {
+	t.Helper()
+	var arr []interface{}
+	if err := json.Unmarshal([]byte(`["COUNT"`+joinElems(elems)+`]`), &arr); err != nil {
+		t.Fatal(err)
+	}
+	p.conn.handleCountRequest(context.Background(), arr)
+}
+
+func joinElems(elems []string) string {
+	var b strings.Builder
+	for _, e := range elems {
+		b.WriteString(",")
+		b.WriteString(e)
+	}
+	return b.String()
+}
+
+// read returns the next frame the relay sent
+func (p *protocolClient) read(t *testing.T) []string {
+	t.Helper()
+	_ = p.client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, raw, err := p.client.ReadMessage()
+	if err != nil {
+		t.Fatalf("reading frame: %v", err)
+	}
+	var frame []string
+	if err := json.Unmarshal(raw, &frame); err != nil {
+		t.Fatalf("frame %s: %v", raw, err)
+	}
+	return frame
+}
+
+// expectClosed reads a CLOSED for subID and checks its reason has the
+// machine-readable prefix
+func (p *protocolClient) expectClosed(t *testing.T, subID, prefix string) {
+	t.Helper()
+	frame := p.read(t)
+	if len(frame) != 3 || frame[0] != "CLOSED" || frame[1] != subID {
+		t.Fatalf("got %q, want CLOSED for %q", frame, subID)
+	}
+	if !strings.HasPrefix(frame[2], prefix+": ") {
+		t.Errorf("CLOSED reason %q, want prefix %q", frame[2], prefix+":")
+	}
+}
+
+func TestReqFailuresAreClosed(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Relay.AuthDMs = true
+	cfg.RelayPolicy.ReadRestricted = []config.KindReadPolicy{{Kinds: []int{30078}, Access: "authenticated"}}
+
+	tests := []struct {
+		name   string
+		elems  []string
+		prefix string
+	}{
+		{"subscription ID too long", []string{`"` + strings.Repeat("s", 65) + `"`, `{}`}, "invalid"},
+		{"missing filter", []string{`"sub"`}, "invalid"},
+		{"malformed filter", []string{`"sub"`, `"kinds"`}, "invalid"},
+		{"since after until", []string{`"sub"`, `{"kinds":[1],"since":1700000000,"until":1600000000}`}, "unsupported"},
+		{"direct messages without auth", []string{`"sub"`, `{"kinds":[4]}`}, "auth-required"},
+		{"restricted kinds without auth", []string{`"sub"`, `{"kinds":[30078]}`}, "auth-required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newProtocolClient(t, cfg)
+			p.req(t, tt.elems...)
+			var subID string
+			_ = json.Unmarshal([]byte(tt.elems[0]), &subID)
+			p.expectClosed(t, subID, tt.prefix)
+		})
+	}
+}
+
+func TestCountFailuresAreClosed(t *testing.T) {
+	tests := []struct {
+		name   string
+		elems  []string
+		prefix string
+	}{
+		{"missing filter", []string{`"sub"`}, "invalid"},
+		{"malformed filter", []string{`"sub"`, `"kinds"`}, "invalid"},
+		{"too many kinds", []string{`"sub"`, `{"kinds":[1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20,21]}`}, "unsupported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newProtocolClient(t, &config.Config{})
+			p.count(t, tt.elems...)
+			p.expectClosed(t, "sub", tt.prefix)
+		})
+	}
+}
+
+func TestCloseReplies(t *testing.T) {
+	p := newProtocolClient(t, &config.Config{})
+	p.conn.handleClose([]interface{}{"CLOSE", "unknown"})
+	p.expectClosed(t, "unknown", "invalid")
+
+	p.conn.subscriptions["sub"] = []nostr.Filter{{}}
+	p.conn.handleClose([]interface{}{"CLOSE", "sub"})
+	if frame := p.read(t); len(frame) != 3 || frame[0] != "CLOSED" || frame[1] != "sub" || frame[2] != "" {
+		t.Fatalf("got %q, want CLOSED for \"sub\" with an empty reason", frame)
+	}
+}
+
+func TestReqWithoutSubscriptionIDIsNotice(t *testing.T) {
+	p := newProtocolClient(t, &config.Config{})
+	p.req(t, `1`, `{}`)
+	if frame := p.read(t); len(frame) != 2 || frame[0] != "NOTICE" {
+		t.Fatalf("got %q, want NOTICE", frame)
+	}
+}
+
+func TestReqPrivateRelay(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.RelayPolicy.Private = true
+	p := newProtocolClient(t, cfg)
+	p.req(t, `"sub"`, `{"kinds":[1]}`)
+	p.expectClosed(t, "sub", "auth-required")
+
+	p.conn.authedPubkey = testPubkey
+	p.req(t, `"sub"`, `{"kinds":[1]}`)
+	p.expectClosed(t, "sub", "restricted")
+}
+
+func TestReqTooManySubscriptions(t *testing.T) {
+	p := newProtocolClient(t, &config.Config{})
+	for i := 0; i < constants.MaxSubscriptions; i++ {
+		p.conn.subscriptions[fmt.Sprintf("sub%d", i)] = []nostr.Filter{{}}
+	}
+	p.req(t, `"one-more"`, `{"kinds":[1]}`)
+	p.expectClosed(t, "one-more", "rate-limited")
+}
+
+func TestCountRestrictedKinds(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.RelayPolicy.ReadRestricted = []config.KindReadPolicy{{Kinds: []int{30078}, Access: "whitelisted"}}
+	p := newProtocolClient(t, cfg)
+	p.count(t, `"sub"`, `{"kinds":[1,30078]}`)
+	p.expectClosed(t, "sub", "auth-required")
+
+	p.conn.authedPubkey = testPubkey
+	p.count(t, `"sub"`, `{"kinds":[30078]}`)
+	p.expectClosed(t, "sub", "restricted")
+}
+
+func TestCountDirectMessages(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Relay.AuthDMs = true
+	p := newProtocolClient(t, cfg)
+	victim := strings.Repeat("b", 64)
+	p.count(t, `"sub"`, `{"kinds":[1,4],"#p":["`+victim+`"]}`)
+	p.expectClosed(t, "sub", "auth-required")
+
+	p.conn.authedPubkey = testPubkey
+	p.count(t, `"sub"`, `{"kinds":[4],"#p":["`+victim+`"]}`)
+	p.expectClosed(t, "sub", "restricted")
+
+	if got := fmt.Sprint(p.conn.authGatedKinds()); got != "[4 14 1059]" {
+		t.Errorf("authGatedKinds = %s, want [4 14 1059]", got)
+	}
+}
+
+func TestUnreadableKinds(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.RelayPolicy.ReadRestricted = []config.KindReadPolicy{
+		{Kinds: []int{4, 1059}, Access: "authenticated"},
+		{Kinds: []int{30078}, Access: "whitelisted"},
+	}
+	p := newProtocolClient(t, cfg)
+	if got := fmt.Sprint(p.conn.unreadableKinds()); got != "[4 1059 30078]" {
+		t.Errorf("unreadableKinds without auth = %s, want [4 1059 30078]", got)
+	}
+	p.conn.authedPubkey = testPubkey
+	if got := fmt.Sprint(p.conn.unreadableKinds()); got != "[30078]" {
+		t.Errorf("unreadableKinds with auth = %s, want [30078]", got)
+	}
+}
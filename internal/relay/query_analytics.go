@@ -0,0 +1,48 @@
+package relay
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/web"
+)
+
+// maxAnalyticsListed bounds the kinds, authors and filters listed by GET
+// /api/admin/query-analytics
+const maxAnalyticsListed = 1000
+
+// handleAdminQueryAnalytics reports (GET) the REQ filters this node served since
+// it started or was last reset: the limit (default 20) most requested kinds,
+// authors and filter shapes, how selective the filters were and how often the
+// in-memory read paths answered them. DELETE resets the counts.
+func (s *Server) handleAdminQueryAnalytics(w http.ResponseWriter, r *http.Request) {
+	recorder := s.node.QueryAnalytics()
+	if recorder == nil {
+		web.WriteAdminError(w, http.StatusNotFound, "query analytics are disabled")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		limit := 20
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxAnalyticsListed {
+				web.WriteAdminError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxAnalyticsListed))
+				return
+			}
+			limit = n
+		}
+		web.WriteAdminJSON(w, http.StatusOK, recorder.Report(limit))
+
+	case http.MethodDelete:
+		recorder.Reset()
+		logger.Info("Query analytics reset by operator")
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,82 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/rebroadcast"
+	"github.com/Shugur-Network/relay/internal/storage"
+	"github.com/Shugur-Network/relay/internal/web"
+	"go.uber.org/zap"
+)
+
+// handleAdminRebroadcasts lists (GET) or starts (POST) jobs republishing stored
+// events to other relays. POST takes a rebroadcast.Request, e.g.
+// {"filter": {"kinds": [1]}, "relays": ["wss://backup.example"], "rate": 20}.
+func (s *Server) handleAdminRebroadcasts(w http.ResponseWriter, r *http.Request) {
+	rebroadcasts := s.node.Rebroadcasts()
+	switch r.Method {
+	case http.MethodGet:
+		web.WriteAdminJSON(w, http.StatusOK, rebroadcasts.List())
+
+	case http.MethodPost:
+		var req rebroadcast.Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			web.WriteAdminError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		if req.Tenant != storage.DefaultTenant {
+			if _, ok := s.node.Tenants().Get(req.Tenant); !ok {
+				web.WriteAdminError(w, http.StatusNotFound, fmt.Sprintf("tenant %q not found", req.Tenant))
+				return
+			}
+		}
+
+		info, err := rebroadcasts.Start(req)
+		if err != nil {
+			web.WriteAdminError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		logger.Info("Started rebroadcast",
+			zap.String("rebroadcast_id", info.ID),
+			zap.String("tenant", info.Tenant),
+			zap.String("filter", info.Filter.String()),
+			zap.Strings("relays", info.Relays),
+			zap.Float64("rate", info.Rate))
+		web.WriteAdminJSON(w, http.StatusCreated, info)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleAdminRebroadcast reports the progress of (GET) or cancels (DELETE) a
+// rebroadcast job
+func (s *Server) handleAdminRebroadcast(w http.ResponseWriter, r *http.Request, id string) {
+	rebroadcasts := s.node.Rebroadcasts()
+	if _, ok := rebroadcasts.Get(id); !ok {
+		web.WriteAdminError(w, http.StatusNotFound, "rebroadcast not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		info, _ := rebroadcasts.Get(id)
+		web.WriteAdminJSON(w, http.StatusOK, info)
+
+	case http.MethodDelete:
+		info, _ := rebroadcasts.Cancel(id)
+		logger.Info("Canceled rebroadcast",
+			zap.String("rebroadcast_id", info.ID),
+			zap.Int64("events", info.Events))
+		web.WriteAdminJSON(w, http.StatusOK, info)
+
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
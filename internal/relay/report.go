@@ -0,0 +1,184 @@
+package relay
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/storage"
+	"github.com/Shugur-Network/relay/internal/web"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultReportRange is reported when the request has no from
+	defaultReportRange = 30 * 24 * time.Hour
+	// maxReportRange bounds the range of one report
+	maxReportRange = 366 * 24 * time.Hour
+	// reportDateLayout is the day format accepted for from and to
+	reportDateLayout = "2006-01-02"
+)
+
+// usageReport is the JSON body returned by GET /api/admin/report
+type usageReport struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+	// FreeDailyEvents is RELAY_POLICY.FREE_DAILY_EVENTS, 0 when there is no quota
+	FreeDailyEvents int           `json:"free_daily_events"`
+	PubKeys         []pubkeyUsage `json:"pubkeys"`
+}
+
+// pubkeyUsage adds this node's free quota consumption to a pubkey's usage. Quota
+// is counted in memory per node, so it is only known for today.
+type pubkeyUsage struct {
+	storage.PubkeyUsage
+	FreeQuotaUsedToday int `json:"free_quota_used_today"`
+}
+
+// usageCSVHeader names the columns of the CSV report
+var usageCSVHeader = []string{
+	"pubkey", "tier", "paid_until",
+	"invoiced_msats", "credited_msats", "spent_msats", "balance_msats",
+	"events", "event_bytes", "blobs", "blob_bytes", "free_quota_used_today",
+}
+
+// handleAdminReport serves GET /api/admin/report: per-pubkey payments, balances,
+// quota consumption and storage usage over [from, to) for operator accounting.
+// from and to are unix seconds or UTC dates (to inclusive) and default to the
+// last 30 days; pubkey restricts the report to one pubkey and format=csv returns
+// CSV instead of JSON.
+func (s *Server) handleAdminReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	query := r.URL.Query()
+	from, to, err := reportRange(query.Get("from"), query.Get("to"), time.Now())
+	if err != nil {
+		web.WriteAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	pubkey := query.Get("pubkey")
+	if pubkey != "" && !pubkeyPattern.MatchString(pubkey) {
+		web.WriteAdminError(w, http.StatusBadRequest, "pubkey must be 64 hex characters")
+		return
+	}
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		web.WriteAdminError(w, http.StatusBadRequest, "format must be json or csv")
+		return
+	}
+
+	usage, err := s.node.DB().GetUsageReport(r.Context(), from.Unix(), to.Unix(), strings.ToLower(pubkey))
+	if err != nil {
+		logger.Error("Failed to build usage report", zap.Error(err))
+		web.WriteAdminError(w, http.StatusInternalServerError, "failed to build usage report")
+		return
+	}
+
+	report := usageReport{From: from.Unix(), To: to.Unix(), PubKeys: make([]pubkeyUsage, 0, len(usage))}
+	quota := s.node.FreeQuota()
+	if quota != nil {
+		report.FreeDailyEvents = quota.Limit()
+	}
+	for _, u := range usage {
+		row := pubkeyUsage{PubkeyUsage: u}
+		if quota != nil {
+			row.FreeQuotaUsedToday = quota.Used(u.PubKey)
+		}
+		report.PubKeys = append(report.PubKeys, row)
+	}
+
+	if format != "csv" {
+		web.WriteAdminJSON(w, http.StatusOK, report)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="usage-%s-%s.csv"`,
+		from.UTC().Format(reportDateLayout), to.UTC().Format(reportDateLayout)))
+	if err := writeUsageCSV(w, report.PubKeys); err != nil {
+		logger.Error("Failed to write usage report", zap.Error(err))
+	}
+}
+
+// reportRange parses the from and to parameters of a report
+func reportRange(fromParam, toParam string, now time.Time) (time.Time, time.Time, error) {
+	to := now
+	if toParam != "" {
+		t, err := parseReportTime(toParam, true)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %w", err)
+		}
+		to = t
+	}
+	from := to.Add(-defaultReportRange)
+	if fromParam != "" {
+		t, err := parseReportTime(fromParam, false)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %w", err)
+		}
+		from = t
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must be before to")
+	}
+	if to.Sub(from) > maxReportRange {
+		return time.Time{}, time.Time{}, fmt.Errorf("range must be at most %d days", int(maxReportRange.Hours()/24))
+	}
+	return from, to, nil
+}
+
+// parseReportTime parses unix seconds or a UTC date. A date used as the end of the
+// range includes that whole day.
+func parseReportTime(value string, end bool) (time.Time, error) {
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	day, err := time.Parse(reportDateLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected unix seconds or YYYY-MM-DD")
+	}
+	if end {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
+
+// writeUsageCSV writes rows with usageCSVHeader
+func writeUsageCSV(w http.ResponseWriter, rows []pubkeyUsage) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(usageCSVHeader); err != nil {
+		return err
+	}
+	for _, u := range rows {
+		paidUntil := ""
+		if u.PaidUntil != nil {
+			paidUntil = strconv.FormatInt(*u.PaidUntil, 10)
+		}
+		record := []string{
+			u.PubKey, u.Tier, paidUntil,
+			strconv.FormatInt(u.InvoicedMsats, 10),
+			strconv.FormatInt(u.CreditedMsats, 10),
+			strconv.FormatInt(u.SpentMsats, 10),
+			strconv.FormatInt(u.BalanceMsats, 10),
+			strconv.FormatInt(u.Events, 10),
+			strconv.FormatInt(u.EventBytes, 10),
+			strconv.FormatInt(u.Blobs, 10),
+			strconv.FormatInt(u.BlobBytes, 10),
+			strconv.Itoa(u.FreeQuotaUsedToday),
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,290 @@
+package relay
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+
+	"github.com/Shugur-Network/relay/internal/constants"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/metrics"
+	"github.com/Shugur-Network/relay/internal/relay/nips"
+	"github.com/Shugur-Network/relay/internal/storage"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+// resumeSession is the subscriptions of a client that asked for a resume token.
+// While the client is connected the session only holds its token; once it
+// disconnects the session keeps its subscriptions and the events they match
+// until the client resumes or RELAY.RESUME.WINDOW passes.
+type resumeSession struct {
+	token  string
+	tenant string
+	// ip is the address of the client, counted against RELAY.RESUME.MAX_PER_IP
+	ip string
+	// pubkey is the pubkey the client had authenticated as, which a resuming
+	// client must authenticate as too
+	pubkey        string
+	subscriptions map[string][]nostr.Filter
+	// missed and overflowed are written by the buffering goroutine only, and
+	// read once done is closed
+	missed     []*nostr.Event
+	overflowed bool
+	stop       context.CancelFunc
+	done       chan struct{}
+}
+
+var (
+	resumeMu sync.Mutex
+	// detachedSessions holds the sessions of disconnected clients by token
+	detachedSessions = make(map[string]*resumeSession)
+	// detachedPerIP counts the detached sessions of each client address
+	detachedPerIP = make(map[string]int)
+)
+
+// newResumeToken returns a random resume token
+func newResumeToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// claimDetachedSession removes and returns the detached session with token for a
+// client of tenant authenticated as pubkey. When it can't be claimed it returns
+// why: "expired" when there is no such session, "refused" when the client isn't
+// authenticated as the pubkey the session was opened with.
+func claimDetachedSession(token, tenant, pubkey string) (*resumeSession, string) {
+	resumeMu.Lock()
+	defer resumeMu.Unlock()
+	session := detachedSessions[token]
+	if session == nil || session.tenant != tenant {
+		return nil, "expired"
+	}
+	if session.pubkey != "" && session.pubkey != pubkey {
+		return nil, "refused"
+	}
+	removeDetachedSession(session)
+	return session, ""
+}
+
+// putDetachedSession keeps session for its client to resume, unless maxSessions
+// are kept already or maxPerIP for the client's address. Onion clients share an
+// address, so only the overall cap applies to them.
+func putDetachedSession(session *resumeSession, maxSessions, maxPerIP int) bool {
+	resumeMu.Lock()
+	defer resumeMu.Unlock()
+	if len(detachedSessions) >= maxSessions {
+		return false
+	}
+	if session.ip != onionClientIP && detachedPerIP[session.ip] >= maxPerIP {
+		return false
+	}
+	detachedSessions[session.token] = session
+	detachedPerIP[session.ip]++
+	metrics.ResumeSessions.Inc()
+	return true
+}
+
+// removeDetachedSession drops session from the detached sessions; resumeMu
+// must be held
+func removeDetachedSession(session *resumeSession) {
+	delete(detachedSessions, session.token)
+	if detachedPerIP[session.ip]--; detachedPerIP[session.ip] <= 0 {
+		delete(detachedPerIP, session.ip)
+	}
+	metrics.ResumeSessions.Dec()
+}
+
+// matches reports whether evt matches one of the session's subscriptions
+func (s *resumeSession) matches(evt *nostr.Event) bool {
+	for _, filters := range s.subscriptions {
+		for _, f := range filters {
+			if eventMatchesFilter(evt, f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// buffer keeps the events from events that match the session until ctx is done.
+// Past maxEvents the buffer is dropped and the session only waits out its
+// window, so a resuming client learns it has to send its REQs again.
+func (s *resumeSession) buffer(ctx context.Context, events <-chan storage.LiveEvent, maxEvents int, unsubscribe func()) {
+	defer close(s.done)
+	defer func() {
+		if events != nil {
+			unsubscribe()
+		}
+		resumeMu.Lock()
+		if detachedSessions[s.token] == s {
+			removeDetachedSession(s)
+		}
+		resumeMu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case live, ok := <-events:
+			evt := live.Event
+			if !ok || evt == nil {
+				events = nil
+				continue
+			}
+			if !s.matches(evt) {
+				continue
+			}
+			if len(s.missed) >= maxEvents {
+				s.overflowed = true
+				s.missed = nil
+				unsubscribe()
+				events = nil
+				continue
+			}
+			s.missed = append(s.missed, evt)
+		}
+	}
+}
+
+// handleResume handles ["RESUME"], which asks for a resume token for the
+// connection, and ["RESUME", <token>], which takes back the subscriptions of the
+// disconnected client holding token. Both are answered with
+// ["RESUME", <token>, <true|false>, <message>].
+func (c *WsConnection) handleResume(arr []interface{}) {
+	cfg := c.node.Config().Relay.Resume
+	if !cfg.Enabled {
+		c.sendMessage("RESUME", "", false, nips.FormatErrorMessage(nips.ErrorCodeInvalidFilter, "resuming subscriptions is not enabled on this relay"))
+		return
+	}
+
+	if len(arr) < 2 {
+		session := c.resume.Load()
+		if session == nil {
+			token, err := newResumeToken()
+			if err != nil {
+				logger.Warn("Failed to generate resume token", zap.Error(err))
+				c.sendMessage("RESUME", "", false, nips.FormatErrorMessage(nips.ErrorCodeDatabaseError, "failed to create a resume token"))
+				return
+			}
+			session = &resumeSession{token: token, tenant: c.tenant}
+			c.resume.Store(session)
+		}
+		c.sendMessage("RESUME", session.token, true, "")
+		return
+	}
+
+	token, ok := arr[1].(string)
+	if !ok || token == "" {
+		c.sendMessage("RESUME", "", false, nips.FormatErrorMessage(nips.ErrorCodeInvalidEvent, "resume token must be a string"))
+		return
+	}
+	if c.subscriptionCount() > 0 || c.resume.Load() != nil {
+		c.sendMessage("RESUME", token, false, nips.FormatErrorMessage(nips.ErrorCodeInvalidEvent, "resume before opening subscriptions or asking for a token"))
+		return
+	}
+	if denial := c.privateAccessDenial(); denial != "" {
+		c.sendMessage("RESUME", token, false, denial)
+		return
+	}
+
+	session, reason := claimDetachedSession(token, c.tenant, c.AuthedPubkey())
+	switch reason {
+	case "expired":
+		metrics.Resumes.WithLabelValues(reason).Inc()
+		c.sendMessage("RESUME", token, false, nips.FormatErrorMessage(nips.ErrorCodeExpired, "no subscriptions to resume, send your REQs again"))
+		return
+	case "refused":
+		metrics.Resumes.WithLabelValues(reason).Inc()
+		c.sendMessage("RESUME", token, false, nips.FormatErrorMessage(nips.ErrorCodeAuthRequired, "authenticate as the pubkey the subscriptions were opened with"))
+		return
+	}
+
+	session.stop()
+	<-session.done
+	if session.overflowed {
+		metrics.Resumes.WithLabelValues("overflowed").Inc()
+		c.sendMessage("RESUME", token, false, nips.FormatErrorMessage(nips.ErrorCodeRateLimited, "too many events were missed, send your REQs again"))
+		return
+	}
+
+	c.restoreSession(session)
+	metrics.Resumes.WithLabelValues("resumed").Inc()
+	c.sendMessage("RESUME", token, true, "")
+}
+
+// restoreSession reopens the subscriptions of session on the connection, sends
+// the events they missed and hands the session over to the connection
+func (c *WsConnection) restoreSession(session *resumeSession) {
+	restored := 0
+	for subID, filters := range session.subscriptions {
+		if restored >= constants.MaxSubscriptions {
+			break
+		}
+		c.addSubscription(subID, filters)
+		restored++
+	}
+	metrics.ActiveSubscriptions.Add(float64(restored))
+
+	subscriptions := c.GetSubscriptions()
+	for _, evt := range session.missed {
+		if !c.canReceive(evt) {
+			continue
+		}
+		for subID, filters := range subscriptions {
+			for _, f := range filters {
+				if eventMatchesFilter(evt, f) {
+					c.SendMessageNoRateLimit(encodeEvent(subID, evt))
+					metrics.ResumeReplayedEvents.Inc()
+					break
+				}
+			}
+		}
+	}
+
+	logger.Debug("Subscriptions resumed",
+		zap.String("client", c.RemoteAddr()),
+		zap.Int("subscriptions", restored),
+		zap.Int("missed_events", len(session.missed)))
+
+	c.resume.Store(&resumeSession{token: session.token, tenant: session.tenant})
+}
+
+// detachResume keeps the connection's subscriptions for its client to resume,
+// when it asked for a resume token. It runs as the connection closes, before
+// its subscriptions are cleared.
+func (c *WsConnection) detachResume() {
+	session := c.resume.Swap(nil)
+	if session == nil {
+		return
+	}
+	dispatcher := c.node.GetEventDispatcher()
+	subscriptions := c.GetSubscriptions()
+	if dispatcher == nil || len(subscriptions) == 0 {
+		return
+	}
+
+	cfg := c.node.Config().Relay.Resume
+	session.ip = c.realClientIP
+	session.pubkey = c.AuthedPubkey()
+	session.subscriptions = subscriptions
+	session.done = make(chan struct{})
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Window)
+	session.stop = cancel
+
+	if !putDetachedSession(session, cfg.MaxSessions, cfg.MaxPerIP) {
+		cancel()
+		metrics.ResumeDetachRefused.Inc()
+		logger.Debug("Too many disconnected clients kept, subscriptions not kept for resuming",
+			zap.String("client", c.RemoteAddr()))
+		return
+	}
+	clientID := "resume-" + generateClientID()
+	events := dispatcher.AddClient(clientID, session.tenant)
+	go session.buffer(ctx, events, cfg.MaxEvents, func() { dispatcher.RemoveClient(clientID) })
+}
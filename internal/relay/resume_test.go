@@ -0,0 +1,48 @@
+package relay
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDetachedSessionCaps(t *testing.T) {
+	t.Cleanup(func() {
+		resumeMu.Lock()
+		for _, s := range detachedSessions {
+			removeDetachedSession(s)
+		}
+		resumeMu.Unlock()
+	})
+
+	put := func(token, ip string) bool {
+		return putDetachedSession(&resumeSession{token: token, ip: ip}, 4, 2)
+	}
+
+	if !put("a1", "192.0.2.1") || !put("a2", "192.0.2.1") {
+		t.Fatal("sessions under the per-address cap were refused")
+	}
+	if put("a3", "192.0.2.1") {
+		t.Error("a session past the per-address cap was kept")
+	}
+	// Onion clients share an address, only the overall cap applies
+	if !put("o1", onionClientIP) || !put("o2", onionClientIP) {
+		t.Fatal("onion sessions under the overall cap were refused")
+	}
+	if put("b1", "192.0.2.2") {
+		t.Error("a session past the overall cap was kept")
+	}
+
+	// Claiming a session frees its slots
+	if session, reason := claimDetachedSession("a1", "", ""); session == nil {
+		t.Fatalf("claimDetachedSession = %q", reason)
+	}
+	if !put("a3", "192.0.2.1") {
+		t.Error("a session was refused after one of its address was claimed")
+	}
+
+	resumeMu.Lock()
+	defer resumeMu.Unlock()
+	if got := fmt.Sprint(len(detachedSessions), detachedPerIP["192.0.2.1"]); got != "4 2" {
+		t.Errorf("sessions, per address = %s, want 4 2", got)
+	}
+}
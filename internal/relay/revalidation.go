@@ -0,0 +1,133 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/storage"
+	"github.com/Shugur-Network/relay/internal/web"
+	"go.uber.org/zap"
+)
+
+// revalidationRequest is the body accepted by POST /api/admin/revalidation
+type revalidationRequest struct {
+	// Action is what happens to events that no longer pass: "report" only counts
+	// them, "quarantine" moves them to quarantined_events, "delete" deletes them
+	Action string `json:"action"`
+	// Mode is what events are checked against: "policies", the default, runs the
+	// current validation policies; "integrity" only verifies IDs and signatures
+	Mode string `json:"mode,omitempty"`
+	// Kinds restricts the run to these kinds, all kinds when empty
+	Kinds []int `json:"kinds,omitempty"`
+}
+
+// handleAdminRevalidation lists (GET), starts (POST) or cancels (DELETE) runs
+// re-checking the stored events against the current policies or for corruption
+func (s *Server) handleAdminRevalidation(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		runs, err := s.node.DB().ListRevalidationRuns(r.Context(), 20)
+		if err != nil {
+			web.WriteAdminError(w, http.StatusInternalServerError, "failed to load revalidation runs")
+			return
+		}
+		web.WriteAdminJSON(w, http.StatusOK, runs)
+
+	case http.MethodPost:
+		var req revalidationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			web.WriteAdminError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		switch req.Action {
+		case storage.RevalidateReport, storage.RevalidateQuarantine, storage.RevalidateDelete:
+		default:
+			web.WriteAdminError(w, http.StatusBadRequest, "action must be report, quarantine or delete")
+			return
+		}
+		switch req.Mode {
+		case "":
+			req.Mode = storage.RevalidatePolicies
+		case storage.RevalidatePolicies, storage.RevalidateIntegrity:
+		default:
+			web.WriteAdminError(w, http.StatusBadRequest, "mode must be policies or integrity")
+			return
+		}
+		for _, kind := range req.Kinds {
+			if kind < 0 || kind > 65535 {
+				web.WriteAdminError(w, http.StatusBadRequest, "kinds must be between 0 and 65535")
+				return
+			}
+		}
+
+		// The run is left unclaimed so the runner picks it up from the database
+		now := time.Now()
+		run := storage.RevalidationRun{
+			ID:        strconv.FormatInt(now.UnixNano(), 36),
+			Action:    req.Action,
+			Mode:      req.Mode,
+			Kinds:     req.Kinds,
+			Status:    storage.RevalidationRunning,
+			StartedAt: now.Unix(),
+		}
+		err := s.node.DB().CreateRevalidationRun(r.Context(), run)
+		if errors.Is(err, storage.ErrRevalidationRunning) {
+			web.WriteAdminError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if err != nil {
+			web.WriteAdminError(w, http.StatusInternalServerError, "failed to record revalidation run")
+			return
+		}
+		s.node.ResumeRevalidation()
+
+		logger.Info("Revalidation run requested",
+			zap.String("run_id", run.ID),
+			zap.String("action", run.Action),
+			zap.String("mode", run.Mode),
+			zap.Ints("kinds", run.Kinds))
+		web.WriteAdminJSON(w, http.StatusAccepted, run)
+
+	case http.MethodDelete:
+		err := s.node.DB().CancelRevalidationRun(r.Context(), time.Now().Unix())
+		if errors.Is(err, storage.ErrRevalidationNotFound) {
+			web.WriteAdminError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			web.WriteAdminError(w, http.StatusInternalServerError, "failed to cancel revalidation run")
+			return
+		}
+		logger.Info("Revalidation run canceled by operator")
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleAdminQuarantine lists (GET) the events revalidation runs quarantined,
+// newest first, up to limit (default 50, at most 500)
+func (s *Server) handleAdminQuarantine(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	limit := 50
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 && v <= 500 {
+		limit = v
+	}
+	quarantined, err := s.node.DB().ListQuarantinedEvents(r.Context(), limit)
+	if err != nil {
+		web.WriteAdminError(w, http.StatusInternalServerError, "failed to load quarantined events")
+		return
+	}
+	web.WriteAdminJSON(w, http.StatusOK, quarantined)
+}
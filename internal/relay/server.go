@@ -4,15 +4,15 @@ import (
 	"context"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Shugur-Network/relay/internal/config"
-	"github.com/Shugur-Network/relay/internal/constants"
 	"github.com/Shugur-Network/relay/internal/domain"
 	"github.com/Shugur-Network/relay/internal/health"
 	"github.com/Shugur-Network/relay/internal/logger"
 	"github.com/Shugur-Network/relay/internal/metrics"
-	"github.com/Shugur-Network/relay/internal/relay/nips"
 	"github.com/Shugur-Network/relay/internal/storage"
 	"github.com/Shugur-Network/relay/internal/web"
 	"github.com/gorilla/websocket"
@@ -26,6 +26,12 @@ type Server struct {
 	node          domain.NodeInterface
 	webHandler    *web.Handler
 	healthChecker *health.HealthChecker
+	httpLimiter   *web.HTTPLimiter
+	clientIPs     *web.ClientIPs
+	// pinMu serializes updates of the relay's pinned notes list
+	pinMu sync.Mutex
+	// sseStreams counts the open Server-Sent Events streams
+	sseStreams atomic.Int64
 }
 
 // NewServer constructs a new Server with the given RelayConfig and NodeInterface.
@@ -45,12 +51,21 @@ func NewServer(relayCfg config.RelayConfig, node domain.NodeInterface, fullCfg *
 		config.Version,
 	)
 
+	clientIPs, err := web.NewClientIPs(relayCfg.TrustedProxies)
+	if err != nil {
+		// Config validation rejects invalid entries; trust no proxy otherwise
+		logger.Warn("Ignoring trusted proxies", zap.Error(err))
+		clientIPs = &web.ClientIPs{}
+	}
+
 	return &Server{
 		cfg:           relayCfg,
 		fullCfg:       fullCfg,
 		node:          node,
 		webHandler:    webHandler,
 		healthChecker: healthChecker,
+		httpLimiter:   web.NewHTTPLimiter(fullCfg.HTTPLimits, clientIPs),
+		clientIPs:     clientIPs,
 	}
 }
 
@@ -76,9 +91,17 @@ func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
 			metrics.HTTPRequestDuration.Observe(time.Since(start).Seconds())
 		}()
 
-		if isWebSocketRequest(r) {
+		// Virtual relays are routed by host and path before anything else
+		r = s.routeTenant(r)
+
+		if isExtendedConnect(r) {
+			// Handle as relay WebSocket connection over an HTTP/2 stream
+			serveH2WebSocket(w, r, func(w http.ResponseWriter, r *http.Request) {
+				handleWebSocketConnection(ctx, w, r, upgrader, s.node, s.cfg, s.clientIP(r))
+			})
+		} else if isWebSocketRequest(r) {
 			// Handle as relay WebSocket connection
-			handleWebSocketConnection(ctx, w, r, upgrader, s.node, s.cfg)
+			handleWebSocketConnection(ctx, w, r, upgrader, s.node, s.cfg, s.clientIP(r))
 		} else {
 			// Handle HTTP requests with input validation
 			switch {
@@ -90,8 +113,7 @@ func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
 				apiHeaders := web.APISecurityHeaders()
 				apiHeaders.Apply(w)
 				// Serve NIP-11 metadata for Nostr clients
-				metadata := constants.DefaultRelayMetadata(s.fullCfg)
-				nips.ServeRelayMetadata(w, metadata)
+				s.httpLimiter.HandlerFunc("nip11", web.CORSHandlerFunc(s.fullCfg.CORS.NIP11, s.serveRelayInfo))(w, r)
 			case strings.HasPrefix(r.URL.Path, "/static/"):
 				// Serve static files with validation
 				web.SecureValidatedHandlerFunc(s.webHandler.HandleStatic)(w, r)
@@ -100,22 +122,46 @@ func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
 				apiHeaders := web.APISecurityHeaders()
 				apiHeaders.Apply(w)
 				// Serve relay info API with validation
-				web.ValidatedHandlerFunc(web.APIInputValidation(), func(w http.ResponseWriter, r *http.Request) {
-					metadata := constants.DefaultRelayMetadata(s.fullCfg)
+				s.httpLimiter.HandlerFunc("api", web.CORSHandlerFunc(s.fullCfg.CORS.API, web.ValidatedHandlerFunc(web.APIInputValidation(), func(w http.ResponseWriter, r *http.Request) {
 					w.Header().Set("Content-Type", "application/json")
-					w.Header().Set("Access-Control-Allow-Origin", "*")
-					w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-					nips.ServeRelayMetadata(w, metadata)
-				})(w, r)
+					s.serveRelayInfo(w, r)
+				})))(w, r)
 			case r.URL.Path == "/api/stats":
 				// Serve relay statistics API with validation
-				web.SecureValidatedAPIHandlerFunc(s.webHandler.HandleStatsAPI)(w, r)
+				s.httpLimiter.HandlerFunc("api", web.CORSHandlerFunc(s.fullCfg.CORS.API, web.SecureValidatedAPIHandlerFunc(s.webHandler.HandleStatsAPI)))(w, r)
 			case r.URL.Path == "/api/metrics":
 				// Serve real-time metrics API with validation
-				web.SecureValidatedAPIHandlerFunc(s.webHandler.HandleMetricsAPI)(w, r)
+				s.httpLimiter.HandlerFunc("api", web.CORSHandlerFunc(s.fullCfg.CORS.API, web.SecureValidatedAPIHandlerFunc(s.webHandler.HandleMetricsAPI)))(w, r)
 			case r.URL.Path == "/api/cluster":
 				// Serve cluster information API with validation
-				web.SecureValidatedAPIHandlerFunc(s.webHandler.HandleClusterAPI)(w, r)
+				s.httpLimiter.HandlerFunc("api", web.CORSHandlerFunc(s.fullCfg.CORS.API, web.SecureValidatedAPIHandlerFunc(s.webHandler.HandleClusterAPI)))(w, r)
+			case strings.HasPrefix(r.URL.Path, "/api/attestations/"):
+				// Serve relay-signed storage attestations with validation
+				s.httpLimiter.HandlerFunc("api", web.CORSHandlerFunc(s.fullCfg.CORS.API, web.SecureValidatedAPIHandlerFunc(s.handleAttestation)))(w, r)
+			case strings.HasPrefix(r.URL.Path, "/api/capsules/"):
+				// Serve time capsule share progress and unlock schedule with validation
+				s.httpLimiter.HandlerFunc("api", web.CORSHandlerFunc(s.fullCfg.CORS.API, web.SecureValidatedAPIHandlerFunc(s.handleCapsules)))(w, r)
+			case strings.HasPrefix(r.URL.Path, "/api/payments/"):
+				// Serve lightning invoices, Cashu payments and top-up balances with validation
+				s.httpLimiter.HandlerFunc("api", web.CORSHandlerFunc(s.fullCfg.CORS.API, web.SecureValidatedAPIHandlerFunc(s.handlePayments)))(w, r)
+			case strings.HasPrefix(r.URL.Path, "/api/invites/"):
+				// Serve invite code redemption with validation
+				s.httpLimiter.HandlerFunc("api", web.CORSHandlerFunc(s.fullCfg.CORS.API, web.SecureValidatedAPIHandlerFunc(s.handleInvites)))(w, r)
+			case r.URL.Path == "/api/zaps":
+				// Serve zap totals of a pubkey, event or address with validation
+				s.httpLimiter.HandlerFunc("api", web.CORSHandlerFunc(s.fullCfg.CORS.API, web.SecureValidatedAPIHandlerFunc(s.handleZapTotals)))(w, r)
+			case strings.HasPrefix(r.URL.Path, "/.well-known/"):
+				// Serve NIP-05, lnurlp and security.txt discovery documents with validation
+				s.httpLimiter.HandlerFunc("nip11", web.CORSHandlerFunc(s.fullCfg.CORS.NIP11, web.SecureValidatedAPIHandlerFunc(s.handleWellKnown)))(w, r)
+			case r.URL.Path == "/subscribe":
+				// Serve read-only Server-Sent Events stream with validation
+				s.httpLimiter.RateHandlerFunc("api", web.CORSHandlerFunc(s.fullCfg.CORS.API, web.SecureValidatedAPIHandlerFunc(s.handleSubscribe)))(w, r)
+			case strings.HasPrefix(r.URL.Path, "/api/admin/"):
+				// Serve admin API with token authentication
+				s.httpLimiter.HandlerFunc("admin", web.CORSHandlerFunc(s.fullCfg.CORS.Admin, web.SecureAdminHandlerFunc(s.fullCfg.Admin, s.handleAdmin)))(w, r)
+			case web.IsBlossomPath(r.URL.Path):
+				// Serve Blossom media blobs with validation
+				s.httpLimiter.HandlerFunc("blossom", web.CORSHandlerFunc(s.fullCfg.CORS.Blossom, web.SecureBlossomHandlerFunc(s.handleBlossom)))(w, r)
 			case r.URL.Path == "/health":
 				// Serve health check endpoint - no validation needed for basic health checks
 				s.healthChecker.HandleHealth(w, r)
@@ -136,18 +182,54 @@ func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	configureHTTP2(httpSrv, s.cfg)
+
+	// Serve onion clients on their own listener
+	if s.fullCfg.Tor.Enabled {
+		go s.serveOnion(ctx)
+	}
+
+	ln, err := web.Listen(ctx, addr, s.cfg.ReusePort)
+	if err != nil {
+		return err
+	}
 
-	// Graceful shutdown when context is canceled
+	// Stop accepting connections once the node drains, leaving the open ones to it
 	go func() {
-		<-ctx.Done()
+		select {
+		case <-ctx.Done():
+		case <-s.node.Draining():
+		}
 		logger.Info("Shutting down WebSocket server...")
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
 		_ = httpSrv.Shutdown(shutdownCtx)
 	}()
 
-	logger.Info("Relay WebSocket server listening", zap.String("address", addr))
-	return httpSrv.ListenAndServe()
+	if s.cfg.TLSCert != "" {
+		logger.Info("Relay WebSocket server listening",
+			zap.String("address", addr),
+			zap.Bool("tls", true),
+			zap.Bool("http2", s.cfg.HTTP2),
+			zap.Bool("http2_websockets", s.cfg.HTTP2 && h2WebSocketsEnabled()),
+			zap.Bool("reuse_port", s.cfg.ReusePort))
+		return httpSrv.ServeTLS(ln, s.cfg.TLSCert, s.cfg.TLSKey)
+	}
+
+	logger.Info("Relay WebSocket server listening", zap.String("address", addr), zap.Bool("reuse_port", s.cfg.ReusePort))
+	return httpSrv.Serve(ln)
+}
+
+// configureHTTP2 sets the protocols negotiated on the native TLS listener. With
+// HTTP/2 on, NIP-11, dashboard and API requests are multiplexed over h2 while
+// clients fall back to HTTP/1.1 through ALPN. WebSockets open over h2 with RFC
+// 8441 extended CONNECT when the process runs with GODEBUG=http2xconnect=1, and
+// over HTTP/1.1 otherwise.
+func configureHTTP2(srv *http.Server, cfg config.RelayConfig) {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(cfg.HTTP2)
+	srv.Protocols = protocols
 }
 
 // isWebSocketRequest checks if the request is a WebSocket upgrade request
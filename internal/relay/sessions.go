@@ -0,0 +1,93 @@
+package relay
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Shugur-Network/relay/internal/sessions"
+	"github.com/Shugur-Network/relay/internal/web"
+)
+
+// maxSessionsListed bounds the sessions returned by GET /api/admin/sessions
+const maxSessionsListed = 1000
+
+// SessionID returns the ID of the client session the connection counts toward,
+// "" when sessions aren't tracked
+func (c *WsConnection) SessionID() string {
+	return c.session.Load().ID()
+}
+
+// bindSession moves the connection to the session of its address and pubkey
+// once the client authenticates, leaving what it did before on the session of
+// its address alone
+func (c *WsConnection) bindSession(pubkey string) {
+	tracker := c.node.Sessions()
+	current := c.session.Load()
+	if tracker == nil || current.ID() == sessions.ID(c.realClientIP, pubkey) {
+		return
+	}
+	c.session.Store(tracker.Connect(c.realClientIP, pubkey))
+	tracker.Disconnect(current)
+}
+
+// handleAdminSessions lists (GET) the client sessions tracked on this node, the
+// most recently seen first or by the counter named in sort, highest first. They
+// can be narrowed to an ip, a pubkey or, with active=true, the sessions with
+// open connections; limit defaults to 100.
+func (s *Server) handleAdminSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	tracker := s.node.Sessions()
+	if tracker == nil {
+		web.WriteAdminError(w, http.StatusNotFound, "client sessions are not tracked")
+		return
+	}
+
+	query := r.URL.Query()
+	q := sessions.Query{
+		IP:         query.Get("ip"),
+		PubKey:     query.Get("pubkey"),
+		ActiveOnly: query.Get("active") == "true",
+		Limit:      100,
+	}
+	if q.PubKey != "" && !pubkeyPattern.MatchString(q.PubKey) {
+		web.WriteAdminError(w, http.StatusBadRequest, "pubkey must be 64 hex characters")
+		return
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxSessionsListed {
+			web.WriteAdminError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxSessionsListed))
+			return
+		}
+		q.Limit = limit
+	}
+	if v := query.Get("sort"); v != "" {
+		counter, ok := sessions.ParseCounter(v)
+		if !ok {
+			web.WriteAdminError(w, http.StatusBadRequest, "unknown sort counter "+strconv.Quote(v))
+			return
+		}
+		q.SortBy = &counter
+	}
+	web.WriteAdminJSON(w, http.StatusOK, tracker.List(q))
+}
+
+// handleAdminSession returns (GET) the client session with id
+func (s *Server) handleAdminSession(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	stats, ok := s.node.Sessions().Get(strings.ToLower(id))
+	if !ok {
+		web.WriteAdminError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	web.WriteAdminJSON(w, http.StatusOK, stats)
+}
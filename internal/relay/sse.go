@@ -0,0 +1,152 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/metrics"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+const (
+	// sseKeepAlive is the interval between comment lines keeping idle streams open
+	sseKeepAlive = 30 * time.Second
+	// maxSSELimit caps the stored events replayed before the live stream starts
+	maxSSELimit = 500
+)
+
+// handleSubscribe serves GET /subscribe?filter=<json filter>: a read-only
+// Server-Sent Events stream of the stored events matching the filter, an "eose"
+// event, then new matching events as the dispatcher broadcasts them.
+func (s *Server) handleSubscribe(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// Private relays only serve NIP-42 authenticated members over WebSocket
+	private := s.fullCfg.RelayPolicy.Private
+	if t, ok := requestTenant(r); ok {
+		private = t.Private
+	}
+	if private {
+		http.Error(w, "Relay is private", http.StatusForbidden)
+		return
+	}
+
+	dispatcher := s.node.GetEventDispatcher()
+	if dispatcher == nil {
+		http.Error(w, "Live events are not available", http.StatusServiceUnavailable)
+		return
+	}
+	// Streams are capped like WebSocket connections, by MAX_CONNECTIONS
+	if s.sseStreams.Add(1) > int64(s.cfg.ThrottlingConfig.MaxConnections) {
+		s.sseStreams.Add(-1)
+		http.Error(w, "Too many open streams", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.sseStreams.Add(-1)
+
+	raw := r.URL.Query().Get("filter")
+	if raw == "" || !json.Valid([]byte(raw)) {
+		http.Error(w, "Invalid filter parameter", http.StatusBadRequest)
+		return
+	}
+	f, err := parseFilterFromRaw(json.RawMessage(raw))
+	if err != nil {
+		http.Error(w, "Invalid filter parameter", http.StatusBadRequest)
+		return
+	}
+	if f.Limit <= 0 || f.Limit > maxSSELimit {
+		f.Limit = maxSSELimit
+	}
+	if err := s.node.GetValidator().ValidateFilter(f); err != nil {
+		http.Error(w, "Invalid filter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Streams outlive the server write timeout
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{}) // nolint:errcheck // unsupported writers keep the server timeout
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Register before reading storage so events published meanwhile aren't missed
+	clientID := "sse-" + generateClientID()
+	events := dispatcher.AddClient(clientID, requestTenantID(r))
+	defer dispatcher.RemoveClient(clientID)
+
+	ctx := r.Context()
+	stored, err := s.node.DB().GetEvents(ctx, requestTenantID(r), f)
+	if err != nil {
+		logger.Error("Failed to load events for SSE stream", zap.Error(err))
+		return
+	}
+	stored = s.node.DB().WithoutDeletedInteractions(ctx, requestTenantID(r), stored)
+	for i := range stored {
+		if !s.writeSSEEvent(w, &stored[i]) {
+			return
+		}
+	}
+	if _, err := fmt.Fprint(w, "event: eose\ndata: {}\n\n"); err != nil {
+		return
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case live, ok := <-events:
+			if !ok || live.Event == nil {
+				return
+			}
+			if !eventMatchesFilter(live.Event, f) {
+				continue
+			}
+			if !s.writeSSEEvent(w, live.Event) {
+				return
+			}
+			if !live.IngestedAt.IsZero() {
+				metrics.LiveDeliveryLatency.Observe(time.Since(live.IngestedAt).Seconds())
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeSSEEvent writes evt as an SSE message unless it is only delivered to
+// authenticated clients. Returns false when the client went away.
+func (s *Server) writeSSEEvent(w http.ResponseWriter, evt *nostr.Event) bool {
+	if authGatedKind(s.fullCfg, evt.Kind) || s.fullCfg.RelayPolicy.ReadAccess(evt.Kind) != "" {
+		return true
+	}
+	data, err := json.Marshal(evt)
+	if err != nil {
+		return true
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: event\ndata: %s\n\n", evt.ID, data)
+	return err == nil
+}
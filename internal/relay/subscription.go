@@ -2,31 +2,32 @@ package relay
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 
+	"github.com/Shugur-Network/relay/internal/analytics"
+	"github.com/Shugur-Network/relay/internal/constants"
 	"github.com/Shugur-Network/relay/internal/logger"
 	"github.com/Shugur-Network/relay/internal/metrics"
 	"github.com/Shugur-Network/relay/internal/relay/nips"
+	"github.com/Shugur-Network/relay/internal/storage"
 	nostr "github.com/nbd-wtf/go-nostr"
 	"go.uber.org/zap"
 )
 
-func (c *WsConnection) handleRequest(ctx context.Context, arr []interface{}) {
+func (c *WsConnection) handleRequest(ctx context.Context, frame []json.RawMessage) {
 	// Log the start of request processing
-	logger.Debug("Processing REQ command",
-		zap.String("client", c.RemoteAddr()))
-
-	// Validate array length
-	if len(arr) < 3 {
-		logger.Warn("Invalid REQ command: missing subscription ID or filter",
+	if logger.DebugEnabled() {
+		logger.Debug("Processing REQ command",
 			zap.String("client", c.RemoteAddr()))
-		c.sendNotice("REQ command missing subscription ID or filter")
-		return
 	}
 
-	// Extract subscription ID
-	subID, ok := arr[1].(string)
-	if !ok || subID == "" {
+	// Extract subscription ID; without one the failure can only be a NOTICE, every
+	// later one is answered with CLOSED
+	var subID string
+	if len(frame) < 2 || json.Unmarshal(frame[1], &subID) != nil || subID == "" {
 		logger.Warn("Invalid REQ command: subscription ID must be a string",
 			zap.String("client", c.RemoteAddr()))
 		c.sendNotice("REQ command subscription ID must be a string")
@@ -35,33 +36,44 @@ func (c *WsConnection) handleRequest(ctx context.Context, arr []interface{}) {
 
 	// Validate subscription ID length
 	if len(subID) > 64 {
-		c.sendNotice("Subscription ID too long (max 64 chars)")
+		c.sendClosed(subID, nips.FormatErrorMessage(nips.ErrorCodeInvalidEvent, "subscription ID too long (max 64 chars)"))
+		return
+	}
+
+	// Validate array length
+	if len(frame) < 3 {
+		c.sendClosed(subID, nips.FormatErrorMessage(nips.ErrorCodeInvalidEvent, "REQ command missing filter"))
 		return
 	}
 
-	// Remove existing subscription if present
+	// Private relays only serve authenticated members
+	if denial := c.privateAccessDenial(); denial != "" {
+		c.sendClosed(subID, denial)
+		return
+	}
+
+	// Remove existing subscription if present, otherwise the new one must fit
+	// within the advertised limit
 	if c.hasSubscription(subID) {
 		logger.Debug("Replacing existing subscription",
 			zap.String("sub_id", subID),
 			zap.String("client", c.RemoteAddr()))
 		c.removeSubscription(subID)
+		metrics.ActiveSubscriptions.Dec()
+	} else if c.subscriptionCount() >= constants.MaxSubscriptions {
+		c.sendClosed(subID, nips.FormatErrorMessage(nips.ErrorCodeRateLimited,
+			fmt.Sprintf("too many open subscriptions (max %d)", constants.MaxSubscriptions)))
+		return
 	}
 
 	// Parse the filter with support for #tag syntax
-	var f nostr.Filter
-	if len(arr) >= 3 {
-		filter, err := parseFilterFromRaw(arr[2])
-		if err != nil {
-			logger.Warn("Failed to parse filter",
-				zap.String("sub_id", subID),
-				zap.Error(err),
-				zap.String("client", c.RemoteAddr()))
-			c.sendNotice("Invalid filter: " + err.Error())
-			return
-		}
-		f = filter
-	} else {
-		c.sendNotice("REQ command missing filter")
+	f, err := parseFilterFromRaw(frame[2])
+	if err != nil {
+		logger.Warn("Failed to parse filter",
+			zap.String("sub_id", subID),
+			zap.Error(err),
+			zap.String("client", c.RemoteAddr()))
+		c.sendClosed(subID, nips.FormatErrorMessage(nips.ErrorCodeInvalidEvent, err.Error()))
 		return
 	}
 
@@ -99,6 +111,24 @@ func (c *WsConnection) handleRequest(ctx context.Context, arr []interface{}) {
 		}
 	}
 
+	// Direct messages, private capsules and share distributions are only served to
+	// authenticated authors and recipients
+	if c.requiresAuth(f) {
+		c.sendClosed(subID, nips.FormatErrorMessage(nips.ErrorCodeAuthRequired, "authenticate to receive private messages"))
+		return
+	}
+	if c.isForeignPrivateQuery(f) {
+		c.sendClosed(subID, nips.FormatErrorMessage(nips.ErrorCodeRestricted, "private messages are only served to their author or recipient"))
+		return
+	}
+
+	// Kinds restricted by RELAY_POLICY.READ_RESTRICTED are left out on delivery,
+	// so only a REQ for nothing but those kinds is refused
+	if denial := c.kindReadDenial(f, true); denial != "" {
+		c.sendClosed(subID, denial)
+		return
+	}
+
 	// Store subscription
 	c.addSubscription(subID, []nostr.Filter{f})
 
@@ -106,33 +136,108 @@ func (c *WsConnection) handleRequest(ctx context.Context, arr []interface{}) {
 	metrics.ActiveSubscriptions.Inc()
 
 	// Query DB and send events in a goroutine
-	go c.processSubscription(ctx, subID, f)
+	queryCtx, query := c.startQuery(subID)
+	go c.processSubscription(queryCtx, query, subID, f)
+}
+
+// pendingQuery is a stored-events query still running for a subscription
+type pendingQuery struct {
+	cancel context.CancelFunc
+	// started is when the REQ was accepted, for its time to EOSE
+	started time.Time
+}
+
+// queryTimeout returns RELAY.QUERY_TIMEOUT, or the storage default when unset
+func (c *WsConnection) queryTimeout() time.Duration {
+	if timeout := c.node.Config().Relay.QueryTimeout; timeout > 0 {
+		return timeout
+	}
+	return storage.DefaultQueryTimeout
+}
+
+// startQuery returns the context of subID's stored-events query. It times out
+// after RELAY.QUERY_TIMEOUT and is canceled by CLOSE, by a REQ replacing subID and
+// when the connection closes, so abandoned queries stop running in the database.
+func (c *WsConnection) startQuery(subID string) (context.Context, *pendingQuery) {
+	ctx, cancel := context.WithTimeout(c.eventCtx, c.queryTimeout())
+	query := &pendingQuery{cancel: cancel, started: time.Now()}
+
+	c.subMu.Lock()
+	if previous := c.queries[subID]; previous != nil {
+		previous.cancel()
+	}
+	c.queries[subID] = query
+	c.subMu.Unlock()
+	return ctx, query
+}
+
+// finishQuery releases query once subID's stored events are sent or abandoned
+func (c *WsConnection) finishQuery(subID string, query *pendingQuery) {
+	query.cancel()
+	c.subMu.Lock()
+	if c.queries[subID] == query {
+		delete(c.queries, subID)
+	}
+	c.subMu.Unlock()
 }
 
 // processSubscription handles the database query and sending events to the client
-func (c *WsConnection) processSubscription(ctx context.Context, subID string, f nostr.Filter) {
-	// Create a context with timeout for the query
-	_, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
+func (c *WsConnection) processSubscription(ctx context.Context, query *pendingQuery, subID string, f nostr.Filter) {
+	defer c.finishQuery(subID, query)
 
-	// Query events from the database
+	// Filters starting within the live window are answered from recently ingested
+	// events, the rest from the database
 	start := time.Now()
-	events, err := c.QueryEvents(ctx, f)
+	events, live := c.node.DB().LiveEvents(c.tenant, f)
+	source := analytics.Live
+	var err error
+	if !live {
+		var cached bool
+		events, cached, err = c.QueryEvents(ctx, f)
+		source = analytics.Database
+		if cached {
+			source = analytics.Cache
+		}
+	}
 	duration := time.Since(start)
+	c.node.QueryAnalytics().Record(f, source)
 
 	// Log query performance
-	logger.Debug("Query execution completed",
-		zap.String("sub_id", subID),
-		zap.Duration("duration", duration),
-		zap.Int("events_count", len(events)),
-		zap.String("client", c.RemoteAddr()))
+	if logger.DebugEnabled() {
+		logger.Debug("Query execution completed",
+			zap.String("sub_id", subID),
+			zap.Duration("duration", duration),
+			zap.Int("events_count", len(events)),
+			zap.Bool("live", live),
+			zap.String("client", c.RemoteAddr()))
+	}
 
+	// CLOSE, a replacing REQ or a disconnect abandoned the query
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		logger.Debug("Query timed out",
+			zap.String("sub_id", subID),
+			zap.Duration("timeout", c.queryTimeout()),
+			zap.String("client", c.RemoteAddr()))
+		c.closeSubscription(subID, nips.FormatErrorMessage(nips.ErrorCodeDatabaseError, "query timed out, try a narrower filter"))
+		return
+	}
+	if errors.Is(err, storage.ErrQueriesBusy) {
+		c.closeSubscription(subID, nips.FormatErrorMessage(nips.ErrorCodeRateLimited, "relay is busy, try again shortly"))
+		return
+	}
+	if errors.Is(err, storage.ErrDatabaseUnavailable) {
+		c.closeSubscription(subID, nips.ErrDatabaseUnavailable)
+		return
+	}
 	if err != nil {
 		logger.Error("Failed to query events",
 			zap.String("sub_id", subID),
 			zap.Error(err),
 			zap.String("client", c.RemoteAddr()))
-		c.sendNotice(nips.ErrDatabaseError)
+		c.closeSubscription(subID, nips.ErrDatabaseError)
 		return
 	}
 
@@ -140,6 +245,7 @@ func (c *WsConnection) processSubscription(ctx context.Context, subID string, f
 	if c.isClosed.Load() {
 		return
 	}
+	events = c.node.DB().WithoutDeletedInteractions(ctx, c.tenant, events)
 
 	// Apply special validation for specific event kinds
 	if len(f.Kinds) == 1 {
@@ -172,19 +278,28 @@ func (c *WsConnection) processSubscription(ctx context.Context, subID string, f
 			}
 		}
 
+		// Private capsules and share distributions go only to authenticated recipients
+		if !c.canReceive(&evt) {
+			continue
+		}
+
 		// Send the event
 		c.SendEvent(subID, &evt)
 		sentCount++
 	}
 
-	logger.Debug("Subscription events sent",
-		zap.String("sub_id", subID),
-		zap.Int("sent_count", sentCount),
-		zap.String("client", c.RemoteAddr()))
+	if logger.DebugEnabled() {
+		logger.Debug("Subscription events sent",
+			zap.String("sub_id", subID),
+			zap.Int("sent_count", sentCount),
+			zap.String("client", c.RemoteAddr()))
+	}
 
 	// Send EOSE (End of Stored Events)
 	if !c.isClosed.Load() {
 		c.sendEOSE(subID)
+		metrics.SubscriptionEOSEDuration.WithLabelValues(source.String()).Observe(time.Since(query.started).Seconds())
+		metrics.SubscriptionEventsReturned.Observe(float64(sentCount))
 	}
 }
 
@@ -254,7 +369,7 @@ func (c *WsConnection) handleClose(arr []interface{}) {
 		logger.Debug("Attempted to close non-existent subscription",
 			zap.String("sub_id", subID),
 			zap.String("client", c.RemoteAddr()))
-		c.sendClosed(subID, "subscription not found")
+		c.sendClosed(subID, nips.FormatErrorMessage(nips.ErrorCodeInvalidEvent, "subscription not found"))
 		return
 	}
 
@@ -263,9 +378,9 @@ func (c *WsConnection) handleClose(arr []interface{}) {
 		zap.String("sub_id", subID),
 		zap.String("client", c.RemoteAddr()))
 
-	// Remove subscription and send confirmation
+	// Remove subscription and confirm with an empty reason, as the client asked
 	c.removeSubscription(subID)
-	c.sendClosed(subID, "subscription closed")
+	c.sendClosed(subID, "")
 
 	// Update metrics
 	metrics.ActiveSubscriptions.Dec()
@@ -282,13 +397,27 @@ func (c *WsConnection) handleCountRequest(ctx context.Context, arr []interface{}
 	logger.Debug("Starting count request processing",
 		zap.String("client", c.RemoteAddr()))
 
-	// Parse the COUNT command using NIP-45 module
+	// Without a subscription ID the failure can only be a NOTICE, every later one
+	// is answered with CLOSED like REQ
+	var subID string
+	if len(arr) >= 2 {
+		subID, _ = arr[1].(string)
+	}
+	if subID == "" {
+		logger.Warn("Invalid COUNT command: subscription ID must be a string",
+			zap.String("client", c.RemoteAddr()))
+		c.sendNotice("COUNT command subscription ID must be a string")
+		return
+	}
 	countCmd, err := nips.ParseCountCommand(arr)
 	if err != nil {
-		logger.Warn("Invalid COUNT command",
-			zap.Error(err),
-			zap.String("client", c.RemoteAddr()))
-		c.sendNotice("Invalid COUNT command: " + err.Error())
+		c.sendClosed(subID, nips.FormatErrorMessage(nips.ErrorCodeInvalidEvent, err.Error()))
+		return
+	}
+
+	// Private relays only serve authenticated members
+	if denial := c.privateAccessDenial(); denial != "" {
+		c.sendClosed(countCmd.SubID, denial)
 		return
 	}
 
@@ -300,19 +429,36 @@ func (c *WsConnection) handleCountRequest(ctx context.Context, arr []interface{}
 				zap.String("sub_id", countCmd.SubID),
 				zap.Error(err),
 				zap.String("client", c.RemoteAddr()))
-			c.sendNotice("Invalid filter: " + err.Error())
+			c.sendClosed(countCmd.SubID, nips.FormatErrorMessage(nips.ErrorCodeInvalidEvent, err.Error()))
 			return
 		}
 		countCmd.Filter = filter
 	} else {
-		c.sendNotice("COUNT command missing filter")
+		c.sendClosed(countCmd.SubID, nips.FormatErrorMessage(nips.ErrorCodeInvalidEvent, "COUNT command missing filter"))
 		return
 	}
 
+	// Counts can't leave out restricted kinds, so counting any of them is refused;
+	// counts of any kind leave out those the client may not query
+	if denial := c.kindReadDenial(countCmd.Filter, false); denial != "" {
+		c.sendClosed(countCmd.SubID, denial)
+		return
+	}
+	// Direct messages, private capsules and share distributions are only counted
+	// for their authenticated author or recipient, and never in counts of any kind
+	if denial := c.privateCountDenial(countCmd.Filter); denial != "" {
+		c.sendClosed(countCmd.SubID, denial)
+		return
+	}
+	var excludeKinds []int
+	if len(countCmd.Filter.Kinds) == 0 {
+		excludeKinds = append(c.unreadableKinds(), c.authGatedKinds()...)
+	}
+
 	// Process count in a goroutine
 	go func() {
-		// Create a context with timeout for the count operation
-		countCtx, cancel := context.WithTimeout(ctx, nips.CountTimeout)
+		// Bound the count like stored-events queries and stop it on disconnect
+		countCtx, cancel := context.WithTimeout(c.eventCtx, c.queryTimeout())
 		defer cancel()
 
 		// Validate the filter using NIP-45
@@ -322,13 +468,13 @@ func (c *WsConnection) handleCountRequest(ctx context.Context, arr []interface{}
 				zap.String("sub_id", countCmd.SubID),
 				zap.Error(err),
 				zap.String("client", c.RemoteAddr()))
-			c.sendNotice("Invalid COUNT filter: " + err.Error())
+			c.sendClosed(countCmd.SubID, nips.FormatErrorMessage(nips.ErrorCodeInvalidFilter, err.Error()))
 			return
 		}
 
 		// Get count from database
 		start := time.Now()
-		count, err := c.node.DB().GetEventCount(countCtx, countCmd.Filter)
+		count, approximate, err := c.node.DB().ServeEventCount(countCtx, c.tenant, countCmd.Filter, excludeKinds)
 		duration := time.Since(start)
 
 		// Check if client is still connected
@@ -337,12 +483,28 @@ func (c *WsConnection) handleCountRequest(ctx context.Context, arr []interface{}
 		}
 
 		// Handle error
+		if errors.Is(countCtx.Err(), context.DeadlineExceeded) {
+			logger.Debug("Count timed out",
+				zap.String("sub_id", countCmd.SubID),
+				zap.Duration("timeout", c.queryTimeout()),
+				zap.String("client", c.RemoteAddr()))
+			c.sendClosed(countCmd.SubID, nips.FormatErrorMessage(nips.ErrorCodeDatabaseError, "query timed out, try a narrower filter"))
+			return
+		}
+		if errors.Is(err, storage.ErrQueriesBusy) {
+			c.sendClosed(countCmd.SubID, nips.FormatErrorMessage(nips.ErrorCodeRateLimited, "relay is busy, try again shortly"))
+			return
+		}
+		if errors.Is(err, storage.ErrDatabaseUnavailable) {
+			c.sendClosed(countCmd.SubID, nips.ErrDatabaseUnavailable)
+			return
+		}
 		if err != nil {
 			logger.Error("COUNT request failed",
 				zap.String("sub_id", countCmd.SubID),
 				zap.Error(err),
 				zap.String("client", c.RemoteAddr()))
-			c.sendNotice("error: count operation failed")
+			c.sendClosed(countCmd.SubID, nips.ErrDatabaseError)
 			return
 		}
 
@@ -351,10 +513,11 @@ func (c *WsConnection) handleCountRequest(ctx context.Context, arr []interface{}
 			zap.String("sub_id", countCmd.SubID),
 			zap.Duration("duration", duration),
 			zap.Int64("count", count),
+			zap.Bool("approximate", approximate),
 			zap.String("client", c.RemoteAddr()))
 
 		// Send the count response (NIP-45 format)
-		response := &nips.CountResponse{Count: count}
+		response := &nips.CountResponse{Count: count, Approximate: approximate}
 		c.sendMessage("COUNT", countCmd.SubID, response)
 	}()
 }
@@ -367,6 +530,22 @@ func (c *WsConnection) hasSubscription(subID string) bool {
 	return ok
 }
 
+func (c *WsConnection) subscriptionCount() int {
+	c.subMu.RLock()
+	defer c.subMu.RUnlock()
+	return len(c.subscriptions)
+}
+
+// closeSubscription drops subID while it is still open and tells the client why
+// with CLOSED
+func (c *WsConnection) closeSubscription(subID, reason string) {
+	if c.hasSubscription(subID) {
+		c.removeSubscription(subID)
+		metrics.ActiveSubscriptions.Dec()
+	}
+	c.sendClosed(subID, reason)
+}
+
 func (c *WsConnection) addSubscription(subID string, filters []nostr.Filter) {
 	c.subMu.Lock()
 	defer c.subMu.Unlock()
@@ -377,6 +556,10 @@ func (c *WsConnection) removeSubscription(subID string) {
 	c.subMu.Lock()
 	defer c.subMu.Unlock()
 	delete(c.subscriptions, subID)
+	if query := c.queries[subID]; query != nil {
+		query.cancel()
+		delete(c.queries, subID)
+	}
 }
 
 func (c *WsConnection) getSubscriptionFilters(subID string) []nostr.Filter {
@@ -410,7 +593,7 @@ func (c *WsConnection) SendEvent(subID string, evt *nostr.Event) {
 	}
 
 	// Send the event
-	c.sendMessage("EVENT", subID, evt)
+	c.SendMessageNoRateLimit(encodeEvent(subID, evt))
 }
 
 // containsKind checks if a slice of kinds contains a specific kind
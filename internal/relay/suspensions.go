@@ -0,0 +1,119 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/config"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/storage"
+	"github.com/Shugur-Network/relay/internal/web"
+	"go.uber.org/zap"
+)
+
+// maxSuspensionReason bounds the reason shown to a suspended pubkey
+const maxSuspensionReason = 256
+
+// suspensionRequest is the body accepted by POST /api/admin/suspensions
+type suspensionRequest struct {
+	PubKey string `json:"pubkey"`
+	// Reason is sent to the pubkey with every refused event or upload
+	Reason string `json:"reason,omitempty"`
+	// Shadow acknowledges the pubkey's events without storing them
+	Shadow bool `json:"shadow,omitempty"`
+}
+
+// suspensionDenial returns the rejection for a suspended pubkey, with the
+// operator's reason and the relay contact when configured
+func suspensionDenial(cfg *config.Config, s storage.Suspension) string {
+	msg := "your pubkey is suspended from publishing on this relay"
+	if s.Reason != "" {
+		msg += ": " + s.Reason
+	}
+	if contact := cfg.Relay.Contact; contact != "" {
+		msg += fmt.Sprintf(" (contact %s to appeal)", contact)
+	}
+	return msg
+}
+
+// handleAdminSuspensions lists (GET) or records (POST) suspended pubkeys
+func (s *Server) handleAdminSuspensions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		suspensions, err := s.node.DB().GetSuspensions(r.Context())
+		if err != nil {
+			web.WriteAdminError(w, http.StatusInternalServerError, "failed to load suspensions")
+			return
+		}
+		web.WriteAdminJSON(w, http.StatusOK, suspensions)
+
+	case http.MethodPost:
+		var req suspensionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			web.WriteAdminError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		if !pubkeyPattern.MatchString(req.PubKey) {
+			web.WriteAdminError(w, http.StatusBadRequest, "pubkey must be 64 hex characters")
+			return
+		}
+		if len(req.Reason) > maxSuspensionReason {
+			web.WriteAdminError(w, http.StatusBadRequest, fmt.Sprintf("reason must be at most %d characters", maxSuspensionReason))
+			return
+		}
+
+		suspension := storage.Suspension{
+			PubKey:      strings.ToLower(req.PubKey),
+			Reason:      strings.TrimSpace(req.Reason),
+			SuspendedAt: time.Now().Unix(),
+			Shadow:      req.Shadow,
+		}
+		if err := s.node.DB().SuspendPubkey(r.Context(), suspension); err != nil {
+			web.WriteAdminError(w, http.StatusInternalServerError, "failed to record suspension")
+			return
+		}
+		s.node.Suspend(suspension)
+
+		logger.Info("Suspended pubkey",
+			zap.String("pubkey", suspension.PubKey),
+			zap.String("reason", suspension.Reason),
+			zap.Bool("shadow", suspension.Shadow))
+		web.WriteAdminJSON(w, http.StatusCreated, suspension)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleAdminSuspension reinstates (DELETE) a suspended pubkey
+func (s *Server) handleAdminSuspension(w http.ResponseWriter, r *http.Request, pubkey string) {
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", "DELETE")
+		web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !pubkeyPattern.MatchString(pubkey) {
+		web.WriteAdminError(w, http.StatusBadRequest, "pubkey must be 64 hex characters")
+		return
+	}
+
+	pubkey = strings.ToLower(pubkey)
+	err := s.node.DB().ReinstatePubkey(r.Context(), pubkey)
+	if errors.Is(err, storage.ErrSuspensionNotFound) {
+		web.WriteAdminError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		web.WriteAdminError(w, http.StatusInternalServerError, "failed to reinstate pubkey")
+		return
+	}
+	s.node.Reinstate(pubkey)
+
+	logger.Info("Reinstated pubkey", zap.String("pubkey", pubkey))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,272 @@
+package relay
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/config"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/storage"
+	"github.com/Shugur-Network/relay/internal/web"
+	"go.uber.org/zap"
+)
+
+// tenantUsageCSVHeader names the columns of the CSV tenant usage report
+var tenantUsageCSVHeader = []string{"tenant", "events", "bytes_in", "bytes_out", "connection_hours"}
+
+// tenantUsageReport is the JSON body returned by GET /api/admin/tenant-usage
+type tenantUsageReport struct {
+	// From and To are the UTC days covered, from the midnight starting the first
+	From    int64         `json:"from"`
+	To      int64         `json:"to"`
+	Tenants []tenantUsage `json:"tenants"`
+}
+
+// tenantUsage is a tenant's usage with its connection time in hours
+type tenantUsage struct {
+	storage.TenantUsage
+	ConnectionHours float64 `json:"connection_hours"`
+}
+
+// tenantStatus is a tenant as reported by the admin API
+type tenantStatus struct {
+	config.TenantConfig
+	// Configured tenants come from TENANTS and can't be changed through the API
+	Configured bool `json:"configured"`
+	// StoredEvents is the last count checked against the quota
+	StoredEvents int64 `json:"stored_events"`
+	// Connections are the tenant's clients on this node
+	Connections int `json:"connections"`
+}
+
+// tenantStatusOf reports t with its usage
+func (s *Server) tenantStatusOf(t config.TenantConfig) tenantStatus {
+	registry := s.node.Tenants()
+	return tenantStatus{
+		TenantConfig: t,
+		Configured:   registry.Configured(t.ID),
+		StoredEvents: registry.StoredEvents(t.ID),
+		Connections:  s.node.TenantConnections(t.ID),
+	}
+}
+
+// handleAdminTenants lists (GET) or creates (POST) virtual relays
+func (s *Server) handleAdminTenants(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		tenants := s.node.Tenants().List()
+		statuses := make([]tenantStatus, len(tenants))
+		for i, t := range tenants {
+			statuses[i] = s.tenantStatusOf(t)
+		}
+		web.WriteAdminJSON(w, http.StatusOK, statuses)
+
+	case http.MethodPost:
+		var t config.TenantConfig
+		if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+			web.WriteAdminError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		if _, exists := s.node.Tenants().Get(t.ID); exists {
+			web.WriteAdminError(w, http.StatusConflict, fmt.Sprintf("tenant %q already exists", t.ID))
+			return
+		}
+		if !s.putTenant(w, r, t, nil) {
+			return
+		}
+		logger.Info("Created tenant", zap.String("tenant", t.ID), zap.Strings("routes", t.Routes()))
+		web.WriteAdminJSON(w, http.StatusCreated, s.tenantStatusOf(t))
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleAdminTenant shows (GET), replaces (PUT) or deletes (DELETE) a virtual
+// relay, and suspends (POST .../suspend) or resumes (POST .../resume) it
+func (s *Server) handleAdminTenant(w http.ResponseWriter, r *http.Request, path string) {
+	id, action, _ := strings.Cut(path, "/")
+	current, ok := s.node.Tenants().Get(id)
+	if !ok {
+		web.WriteAdminError(w, http.StatusNotFound, fmt.Sprintf("tenant %q not found", id))
+		return
+	}
+
+	switch action {
+	case "":
+	case "suspend", "resume":
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		updated := current
+		updated.Suspended = action == "suspend"
+		if !s.putTenant(w, r, updated, &current) {
+			return
+		}
+		if updated.Suspended {
+			s.node.DisconnectTenant(id)
+		}
+		logger.Info("Changed tenant suspension", zap.String("tenant", id), zap.Bool("suspended", updated.Suspended))
+		web.WriteAdminJSON(w, http.StatusOK, s.tenantStatusOf(updated))
+		return
+	default:
+		web.WriteAdminError(w, http.StatusNotFound, "unknown admin endpoint")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		web.WriteAdminJSON(w, http.StatusOK, s.tenantStatusOf(current))
+
+	case http.MethodPut:
+		var updated config.TenantConfig
+		if err := json.NewDecoder(r.Body).Decode(&updated); err != nil {
+			web.WriteAdminError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		if updated.ID != "" && updated.ID != id {
+			web.WriteAdminError(w, http.StatusBadRequest, "tenant id can't be changed")
+			return
+		}
+		updated.ID = id
+		if !s.putTenant(w, r, updated, &current) {
+			return
+		}
+		if updated.Suspended {
+			s.node.DisconnectTenant(id)
+		}
+		logger.Info("Updated tenant", zap.String("tenant", id), zap.Strings("routes", updated.Routes()))
+		web.WriteAdminJSON(w, http.StatusOK, s.tenantStatusOf(updated))
+
+	case http.MethodDelete:
+		if s.node.Tenants().Configured(id) {
+			web.WriteAdminError(w, http.StatusConflict, fmt.Sprintf("tenant %q is configured in TENANTS", id))
+			return
+		}
+		err := s.node.DB().DeleteTenant(r.Context(), id)
+		if err != nil && !errors.Is(err, storage.ErrTenantNotFound) {
+			web.WriteAdminError(w, http.StatusInternalServerError, "failed to delete tenant")
+			return
+		}
+		s.node.Tenants().Remove(id)
+		s.node.DisconnectTenant(id)
+		s.node.TenantMeter().Forget(id)
+
+		logger.Info("Deleted tenant", zap.String("tenant", id))
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// putTenant validates t, installs it in the registry and stores it, restoring
+// previous (or removing t when nil) if it can't be stored. It writes the error
+// response and reports false on failure.
+func (s *Server) putTenant(w http.ResponseWriter, r *http.Request, t config.TenantConfig, previous *config.TenantConfig) bool {
+	if err := config.ValidateTenant(t); err != nil {
+		web.WriteAdminError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	registry := s.node.Tenants()
+	if err := registry.Put(t); err != nil {
+		web.WriteAdminError(w, http.StatusConflict, err.Error())
+		return false
+	}
+	if err := s.node.DB().SaveTenant(r.Context(), t, time.Now().Unix()); err != nil {
+		if previous != nil {
+			_ = registry.Put(*previous)
+		} else {
+			registry.Remove(t.ID)
+		}
+		web.WriteAdminError(w, http.StatusInternalServerError, "failed to save tenant")
+		return false
+	}
+	return true
+}
+
+// handleAdminTenantUsage serves GET /api/admin/tenant-usage: the events stored,
+// bandwidth and connection time of each virtual relay over the UTC days of
+// [from, to), for billing hosted relays. from and to are read like those of
+// /api/admin/report; tenant restricts the report to one tenant and format=csv
+// returns CSV instead of JSON. Usage is recorded every minute.
+func (s *Server) handleAdminTenantUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		web.WriteAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	query := r.URL.Query()
+	from, to, err := reportRange(query.Get("from"), query.Get("to"), time.Now())
+	if err != nil {
+		web.WriteAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	from = from.UTC().Truncate(24 * time.Hour)
+	id := query.Get("tenant")
+	if id != "" && !config.TenantIDPattern.MatchString(id) {
+		web.WriteAdminError(w, http.StatusBadRequest, "invalid tenant id")
+		return
+	}
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		web.WriteAdminError(w, http.StatusBadRequest, "format must be json or csv")
+		return
+	}
+
+	usage, err := s.node.DB().GetTenantUsage(r.Context(), from.Unix(), to.Unix(), id)
+	if err != nil {
+		logger.Error("Failed to build tenant usage report", zap.Error(err))
+		web.WriteAdminError(w, http.StatusInternalServerError, "failed to build tenant usage report")
+		return
+	}
+	report := tenantUsageReport{From: from.Unix(), To: to.Unix(), Tenants: make([]tenantUsage, len(usage))}
+	for i, u := range usage {
+		report.Tenants[i] = tenantUsage{TenantUsage: u, ConnectionHours: u.ConnectionSeconds / 3600}
+	}
+
+	if format != "csv" {
+		web.WriteAdminJSON(w, http.StatusOK, report)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="tenant-usage-%s-%s.csv"`,
+		from.Format(reportDateLayout), to.UTC().Format(reportDateLayout)))
+	if err := writeTenantUsageCSV(w, report.Tenants); err != nil {
+		logger.Error("Failed to write tenant usage report", zap.Error(err))
+	}
+}
+
+// writeTenantUsageCSV writes rows with tenantUsageCSVHeader
+func writeTenantUsageCSV(w http.ResponseWriter, rows []tenantUsage) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(tenantUsageCSVHeader); err != nil {
+		return err
+	}
+	for _, u := range rows {
+		record := []string{
+			u.Tenant,
+			strconv.FormatInt(u.Events, 10),
+			strconv.FormatInt(u.BytesIn, 10),
+			strconv.FormatInt(u.BytesOut, 10),
+			strconv.FormatFloat(u.ConnectionHours, 'f', 3, 64),
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,154 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Shugur-Network/relay/internal/config"
+	"github.com/Shugur-Network/relay/internal/domain"
+	"github.com/Shugur-Network/relay/internal/errors"
+	"github.com/Shugur-Network/relay/internal/limiter"
+	"github.com/Shugur-Network/relay/internal/relay/nips"
+	"github.com/Shugur-Network/relay/internal/storage"
+	nostr "github.com/nbd-wtf/go-nostr"
+)
+
+// tenantKey is the request context key of the virtual relay a request is routed to
+type tenantKey struct{}
+
+// routeTenant attaches the virtual relay r is routed to by its host and path, if
+// any. A tenant's path is served as the root, so the WebSocket endpoint and
+// relay information document of the tenant are found there.
+func (s *Server) routeTenant(r *http.Request) *http.Request {
+	t, ok := s.node.Tenants().Resolve(r.Host, r.URL.Path)
+	if !ok {
+		return r
+	}
+	r = r.Clone(context.WithValue(r.Context(), tenantKey{}, t))
+	if t.Path != "" {
+		r.URL.Path = "/"
+		r.URL.RawPath = ""
+	}
+	return r
+}
+
+// serveRelayInfo serves the NIP-11 document of the relay r was routed to
+func (s *Server) serveRelayInfo(w http.ResponseWriter, r *http.Request) {
+	if t, ok := requestTenant(r); ok {
+		nips.TenantNip11Handler(w, r, s.fullCfg, t)
+		return
+	}
+	nips.Nip11Handler(w, r, s.fullCfg)
+}
+
+// requestTenant returns the virtual relay r was routed to
+func requestTenant(r *http.Request) (config.TenantConfig, bool) {
+	t, ok := r.Context().Value(tenantKey{}).(config.TenantConfig)
+	return t, ok
+}
+
+// requestTenantID returns the ID of the virtual relay r was routed to, the
+// default tenant for the main relay
+func requestTenantID(r *http.Request) string {
+	if t, ok := requestTenant(r); ok {
+		return t.ID
+	}
+	return storage.DefaultTenant
+}
+
+// tenantConnectionDenial returns why a WebSocket connection to the virtual relay
+// r was routed to is refused, or nil when it isn't
+func tenantConnectionDenial(node domain.NodeInterface, r *http.Request) error {
+	t, ok := requestTenant(r)
+	if !ok {
+		return nil
+	}
+	if t.Suspended {
+		return errors.New(errors.ErrorTypeAuthorization, "TENANT_SUSPENDED", fmt.Sprintf("Tenant suspended: %s", t.ID)).
+			WithUserMessage("This relay is suspended.")
+	}
+	if max := t.Quota.MaxConnections; max > 0 {
+		if count := node.TenantConnections(t.ID); count >= max {
+			return errors.ConnectionLimitError(count, max)
+		}
+	}
+	return nil
+}
+
+// Tenant returns the ID of the virtual relay the connection was opened on
+func (c *WsConnection) Tenant() string {
+	return c.tenant
+}
+
+// tenantConfig returns the virtual relay the connection was opened on, false
+// for the main relay
+func (c *WsConnection) tenantConfig() (config.TenantConfig, bool) {
+	if c.tenant == storage.DefaultTenant {
+		return config.TenantConfig{}, false
+	}
+	return c.node.Tenants().Get(c.tenant)
+}
+
+// isMember reports whether pubkey is whitelisted on the relay the connection is
+// on: in the tenant's WHITELIST on a virtual relay, RELAY_POLICY.WHITELIST otherwise
+func (c *WsConnection) isMember(pubkey string) bool {
+	if pubkey == "" {
+		return false
+	}
+	if t, ok := c.tenantConfig(); ok {
+		for _, member := range t.Whitelist {
+			if strings.EqualFold(member, pubkey) {
+				return true
+			}
+		}
+		return false
+	}
+	return c.node.ClassifyClient(pubkey) == limiter.ClassWhitelisted
+}
+
+// isPrivate reports whether the relay the connection is on only serves members
+func (c *WsConnection) isPrivate() bool {
+	if t, ok := c.tenantConfig(); ok {
+		return t.Private
+	}
+	return c.node.Config().RelayPolicy.Private
+}
+
+// writePolicy returns the write policy of the relay the connection is on
+func (c *WsConnection) writePolicy() string {
+	if t, ok := c.tenantConfig(); ok && t.WritePolicy != "" {
+		return t.WritePolicy
+	}
+	return c.node.Config().RelayPolicy.WritePolicy
+}
+
+// tenantDenial returns the machine-readable rejection for an event the virtual
+// relay the connection is on doesn't accept, or "" when it does or the
+// connection is on the main relay
+func (c *WsConnection) tenantDenial(evt *nostr.Event) string {
+	if c.tenant == storage.DefaultTenant {
+		return ""
+	}
+	t, ok := c.tenantConfig()
+	if !ok || t.Suspended {
+		return nips.FormatErrorMessage(nips.ErrorCodeRestricted, "this relay is not accepting events")
+	}
+	if !t.Allows(evt.Kind) {
+		return nips.FormatErrorMessage(nips.ErrorCodeBlacklisted, fmt.Sprintf("kind %d is not accepted on this relay", evt.Kind))
+	}
+	if max := t.Quota.MaxEvents; max > 0 && c.node.Tenants().StoredEvents(t.ID) >= max {
+		return nips.FormatErrorMessage(nips.ErrorCodeBlacklisted, "this relay has reached its storage quota")
+	}
+	return ""
+}
+
+// authRelayURL returns the relay URL NIP-42 AUTH events must name. Virtual relays
+// on their own hosts are named by the host the client connected to.
+func (c *WsConnection) authRelayURL() string {
+	if t, ok := c.tenantConfig(); ok && len(t.Hosts) > 0 {
+		return "wss://" + c.host
+	}
+	return c.node.Config().Relay.PublicURL
+}
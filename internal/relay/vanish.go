@@ -0,0 +1,81 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/domain"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/relay/nips"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+// maxVanishReasonLogged bounds the part of a vanish request's content logged
+const maxVanishReasonLogged = 256
+
+// handleVanishRequest carries out a NIP-62 request to vanish: once it is valid
+// and addressed to this relay, everything its author published here up to it is
+// deleted. Write policies don't apply, so authors can always take back what they
+// published.
+func (c *WsConnection) handleVanishRequest(ctx context.Context, evt *nostr.Event) domain.EventResult {
+	if !c.node.Config().RelayPolicy.HonorVanishRequests {
+		return domain.RejectEvent(nips.ErrorCodeRestricted, "requests to vanish are not honored on this relay")
+	}
+	if !c.node.DB().Available() {
+		return rejection(nips.ErrDatabaseUnavailable)
+	}
+	if result := c.node.GetValidator().ValidateAndProcessEvent(ctx, c.tenant, *evt); result.Status != domain.EventAccepted {
+		return result
+	}
+	if !nips.VanishRequestFor(evt, c.authRelayURL()) {
+		return domain.RejectEvent(nips.ErrorCodeInvalidEvent, "request to vanish is addressed to another relay")
+	}
+	if v, ok := c.node.Vanished(c.tenant, evt.PubKey); ok && int64(evt.CreatedAt) <= v.VanishedAt {
+		return domain.DuplicateEvent()
+	}
+
+	vanishCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	v, err := c.node.DB().PersistVanish(vanishCtx, c.tenant, *evt)
+	if err != nil {
+		logger.Error("Failed to carry out request to vanish",
+			zap.String("event_id", evt.ID),
+			zap.String("pubkey", evt.PubKey),
+			zap.Error(err))
+		return domain.FailEvent("failed to carry out request to vanish")
+	}
+	c.node.RecordVanish(v)
+
+	reason := evt.Content
+	if len(reason) > maxVanishReasonLogged {
+		reason = reason[:maxVanishReasonLogged]
+	}
+	logger.Info("Honored request to vanish",
+		zap.String("event_id", evt.ID),
+		zap.String("pubkey", v.PubKey),
+		zap.String("tenant", v.Tenant),
+		zap.Int64("vanished_at", v.VanishedAt),
+		zap.Int64("purged_events", v.PurgedEvents),
+		zap.String("client_ip", c.realClientIP),
+		zap.String("reason", reason))
+	return domain.AcceptEvent()
+}
+
+// vanishDenial returns the rejection for an event a request to vanish deleted,
+// or "" for any other: events of a vanished author up to its request, and gift
+// wraps sent to it until then
+func (c *WsConnection) vanishDenial(evt *nostr.Event) string {
+	pubkeys := []string{evt.PubKey}
+	if recipient, ok := nips.GiftWrapRecipient(evt); ok {
+		pubkeys = append(pubkeys, recipient)
+	}
+	for _, pubkey := range pubkeys {
+		if v, ok := c.node.Vanished(c.tenant, pubkey); ok && int64(evt.CreatedAt) <= v.VanishedAt {
+			return nips.FormatErrorMessage(nips.ErrorCodeBlacklisted,
+				fmt.Sprintf("this pubkey asked to vanish, events up to %d are not accepted", v.VanishedAt))
+		}
+	}
+	return ""
+}
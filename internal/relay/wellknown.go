@@ -0,0 +1,140 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	// lnurlpTimeout bounds a passthrough request to the lightning address provider
+	lnurlpTimeout = 5 * time.Second
+	// maxLnurlpResponse caps the provider response relayed back to the client
+	maxLnurlpResponse = 64 * 1024
+)
+
+// lnurlpClient fetches LNURL-pay documents from lightning address providers
+var lnurlpClient = &http.Client{Timeout: lnurlpTimeout}
+
+// nip05Response is the body returned by GET /.well-known/nostr.json
+type nip05Response struct {
+	Names  map[string]string   `json:"names"`
+	Relays map[string][]string `json:"relays,omitempty"`
+}
+
+// handleWellKnown routes the discovery documents under /.well-known/
+func (s *Server) handleWellKnown(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.fullCfg.WellKnown.Enabled {
+		http.NotFound(w, r)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/.well-known/")
+	switch {
+	case path == "nostr.json":
+		s.handleNostrJSON(w, r)
+	case path == "security.txt":
+		s.handleSecurityTxt(w)
+	case strings.HasPrefix(path, "lnurlp/"):
+		s.handleLnurlp(w, r, strings.TrimPrefix(path, "lnurlp/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleNostrJSON serves NIP-05 identifiers: every configured name, or only the
+// one asked for with ?name=, along with the relay URL for each pubkey
+func (s *Server) handleNostrJSON(w http.ResponseWriter, r *http.Request) {
+	names := s.fullCfg.WellKnown.Names
+	resp := nip05Response{Names: make(map[string]string)}
+
+	if name := strings.ToLower(r.URL.Query().Get("name")); name != "" {
+		if pubkey, ok := names[name]; ok {
+			resp.Names[name] = pubkey
+		}
+	} else {
+		for name, pubkey := range names {
+			resp.Names[name] = pubkey
+		}
+	}
+
+	if publicURL := s.fullCfg.Relay.PublicURL; publicURL != "" && len(resp.Names) > 0 {
+		resp.Relays = make(map[string][]string)
+		for _, pubkey := range resp.Names {
+			resp.Relays[pubkey] = []string{publicURL}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Error("Failed to encode nostr.json", zap.Error(err))
+	}
+}
+
+// handleSecurityTxt serves an RFC 9116 security.txt pointing at the configured contact
+func (s *Server) handleSecurityTxt(w http.ResponseWriter) {
+	contact := s.fullCfg.WellKnown.SecurityContact
+	if contact == "" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	// Expires is required; the document is generated, so it stays a year ahead
+	expires := time.Now().UTC().AddDate(1, 0, 0).Truncate(24 * time.Hour)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = fmt.Fprintf(w, "Contact: %s\nExpires: %s\n", contact, expires.Format(time.RFC3339)) // nolint:errcheck // client may have gone away
+}
+
+// handleLnurlp relays the LNURL-pay document of the lightning address configured
+// for name, so user@<relay domain> can receive zaps without another web server
+func (s *Server) handleLnurlp(w http.ResponseWriter, r *http.Request, name string) {
+	address, ok := s.fullCfg.WellKnown.Lnurlp[strings.ToLower(name)]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	user, domain, found := strings.Cut(address, "@")
+	if !found {
+		http.Error(w, "Invalid lightning address", http.StatusInternalServerError)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, "https://"+domain+"/.well-known/lnurlp/"+user, nil)
+	if err != nil {
+		http.Error(w, "Invalid lightning address", http.StatusInternalServerError)
+		return
+	}
+	resp, err := lnurlpClient.Do(req)
+	if err != nil {
+		logger.Warn("Lightning address provider unreachable", zap.String("address", address), zap.Error(err))
+		http.Error(w, "Lightning address provider unreachable", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxLnurlpResponse))
+	if err != nil {
+		http.Error(w, "Lightning address provider unreachable", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.StatusCode)
+	_, _ = w.Write(body) // nolint:errcheck // client may have gone away
+}
@@ -0,0 +1,93 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/storage"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+// zapTotalsResponse is the body returned by GET /api/zaps
+type zapTotalsResponse struct {
+	Tag   string `json:"tag"`
+	Value string `json:"value"`
+	storage.ZapTotal
+}
+
+// handleZapTotals serves GET /api/zaps?p=<pubkey>, ?e=<event id> or
+// ?a=<kind:pubkey:d>: the count and sum of the zap receipts stored for it on the
+// tenant the request came in through that were signed by the recipient's zap
+// provider
+func (s *Server) handleZapTotals(w http.ResponseWriter, r *http.Request) {
+	if !s.fullCfg.ZapTotals.Enabled {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var tag, value string
+	query := r.URL.Query()
+	for _, name := range []string{"p", "e", "a"} {
+		if v := query.Get(name); v != "" {
+			if tag != "" {
+				http.Error(w, "Give one of p, e or a", http.StatusBadRequest)
+				return
+			}
+			tag, value = name, v
+		}
+	}
+	// Addresses end with a d tag, which is case sensitive
+	if tag != "a" {
+		value = strings.ToLower(value)
+	}
+	if !validZapTarget(tag, value) {
+		http.Error(w, "Give a pubkey in p, an event id in e or an address in a", http.StatusBadRequest)
+		return
+	}
+
+	total, err := s.node.DB().GetZapTotals(r.Context(), requestTenantID(r), tag, value)
+	if errors.Is(err, storage.ErrDatabaseUnavailable) {
+		http.Error(w, "Database unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to sum zap receipts", zap.String(tag, value), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(zapTotalsResponse{Tag: tag, Value: value, ZapTotal: total}); err != nil {
+		logger.Error("Failed to encode zap totals", zap.Error(err))
+	}
+}
+
+// validZapTarget checks value is what a zap receipt's tag names
+func validZapTarget(tag, value string) bool {
+	switch tag {
+	case "p", "e":
+		return nostr.IsValid32ByteHex(value)
+	case "a":
+		parts := strings.SplitN(value, ":", 3)
+		if len(parts) != 3 || !nostr.IsValid32ByteHex(parts[1]) {
+			return false
+		}
+		_, err := strconv.Atoi(parts[0])
+		return err == nil
+	}
+	return false
+}
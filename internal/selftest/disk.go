@@ -0,0 +1,22 @@
+package selftest
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// existingDir returns dir, or its nearest ancestor that exists when dir hasn't
+// been created yet
+func existingDir(dir string) string {
+	dir = filepath.Clean(dir)
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
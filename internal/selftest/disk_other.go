@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd
+
+package selftest
+
+// freeSpace isn't measured on other platforms
+func freeSpace(dir string) (uint64, error) {
+	return 0, errUnsupported
+}
@@ -0,0 +1,168 @@
+// Package selftest runs the checks a relay makes at boot to catch a misconfigured
+// deployment right away, and keeps the last report for the dashboard and
+// /api/admin/selftest to show.
+package selftest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Status is the outcome of a check
+type Status string
+
+// Check outcomes, from best to worst
+const (
+	StatusPass Status = "pass"
+	StatusSkip Status = "skip"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+)
+
+// errUnsupported is returned by freeSpace where free space can't be measured
+var errUnsupported = errors.New("not supported on this platform")
+
+// Result is the outcome of one check
+type Result struct {
+	Name     string                 `json:"name"`
+	Status   Status                 `json:"status"`
+	Message  string                 `json:"message"`
+	Details  map[string]interface{} `json:"details,omitempty"`
+	Duration time.Duration          `json:"duration_ns"`
+}
+
+// Report is the outcome of a self-test run. Its status is that of its worst
+// check, skipped checks aside.
+type Report struct {
+	Status     Status    `json:"status"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Results    []Result  `json:"results"`
+}
+
+// Check is a named check returning its status and a message, with details
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) (Status, string, map[string]interface{})
+}
+
+// latest is the last report published
+var latest atomic.Pointer[Report]
+
+// Latest returns the last report published, nil before the self-test ran
+func Latest() *Report {
+	return latest.Load()
+}
+
+// Run runs checks one after another, each bounded by timeout, and publishes the
+// report
+func Run(ctx context.Context, checks []Check, timeout time.Duration) *Report {
+	report := &Report{Status: StatusPass, StartedAt: time.Now().UTC(), Results: make([]Result, 0, len(checks))}
+	for _, check := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		status, message, details := check.Run(checkCtx)
+		cancel()
+
+		report.Results = append(report.Results, Result{
+			Name:     check.Name,
+			Status:   status,
+			Message:  message,
+			Details:  details,
+			Duration: time.Since(start),
+		})
+		if worse(status, report.Status) {
+			report.Status = status
+		}
+	}
+	report.FinishedAt = time.Now().UTC()
+	latest.Store(report)
+	return report
+}
+
+// Summary returns a copy of the report with only the name and status of each
+// check, for pages anyone can see: messages and details name hosts, paths and
+// keys of the deployment
+func (r *Report) Summary() *Report {
+	summary := *r
+	summary.Results = make([]Result, len(r.Results))
+	for i, result := range r.Results {
+		summary.Results[i] = Result{Name: result.Name, Status: result.Status, Duration: result.Duration}
+	}
+	return &summary
+}
+
+// worse reports whether a is worse than b, skipped checks counting as passed
+func worse(a, b Status) bool {
+	rank := map[Status]int{StatusPass: 0, StatusSkip: 0, StatusWarn: 1, StatusFail: 2}
+	return rank[a] > rank[b]
+}
+
+// Listening checks that something accepts connections on addr, dialing its
+// loopback address when its host is empty
+func Listening(ctx context.Context, addr string) (Status, string, map[string]interface{}) {
+	target := addr
+	if host, port, err := net.SplitHostPort(addr); err == nil && (host == "" || host == "0.0.0.0" || host == "::") {
+		target = net.JoinHostPort("127.0.0.1", port)
+	}
+	details := map[string]interface{}{"address": addr}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", target)
+	if err != nil {
+		return StatusFail, fmt.Sprintf("Nothing accepts connections on %s: %v", addr, err), details
+	}
+	_ = conn.Close()
+	return StatusPass, fmt.Sprintf("Listening on %s", addr), details
+}
+
+// Reachable checks that the relay can open connections to the outside world,
+// passing when any of hosts, as host:port, accepts a connection
+func Reachable(ctx context.Context, hosts []string) (Status, string, map[string]interface{}) {
+	if len(hosts) == 0 {
+		return StatusSkip, "No outbound hosts configured", nil
+	}
+	details := make(map[string]interface{}, len(hosts))
+	var dialer net.Dialer
+	for _, host := range hosts {
+		conn, err := dialer.DialContext(ctx, "tcp", host)
+		if err != nil {
+			details[host] = err.Error()
+			continue
+		}
+		_ = conn.Close()
+		details[host] = "ok"
+		return StatusPass, fmt.Sprintf("Reached %s", host), details
+	}
+	return StatusFail, "No outbound host could be reached, check DNS, firewall and proxy settings", details
+}
+
+// DiskSpace checks that each of dirs, or the nearest existing directory above it,
+// has at least minFree bytes free
+func DiskSpace(dirs []string, minFree uint64) (Status, string, map[string]interface{}) {
+	details := make(map[string]interface{}, len(dirs))
+	status := StatusPass
+	message := "Enough free disk space"
+	for _, dir := range dirs {
+		free, err := freeSpace(existingDir(dir))
+		if errors.Is(err, errUnsupported) {
+			return StatusSkip, "Free disk space can't be measured on this platform", nil
+		}
+		if err != nil {
+			details[dir] = err.Error()
+			if worse(StatusWarn, status) {
+				status, message = StatusWarn, fmt.Sprintf("Failed to measure free space of %s", dir)
+			}
+			continue
+		}
+		details[dir] = free
+		if free < minFree && worse(StatusFail, status) {
+			status, message = StatusFail, fmt.Sprintf("Only %d MB free for %s", free>>20, dir)
+		}
+	}
+	return status, message, details
+}
@@ -0,0 +1,274 @@
+// Package sessions correlates the connections of a client across reconnects. A
+// session is the client's address together with the pubkey it authenticated
+// as, so the same client gets the same session ID on every connection and every
+// node, and its activity is counted across them.
+package sessions
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/metrics"
+)
+
+// Counter is an activity counted for each session
+type Counter int
+
+// Counted activities
+const (
+	Messages Counter = iota
+	BytesIn
+	BytesOut
+	EventsAccepted
+	EventsRejected
+	Requests
+	RateLimited
+	numCounters
+)
+
+// counterNames are the names counters are reported under
+var counterNames = [numCounters]string{
+	Messages:       "messages",
+	BytesIn:        "bytes_in",
+	BytesOut:       "bytes_out",
+	EventsAccepted: "events_accepted",
+	EventsRejected: "events_rejected",
+	Requests:       "requests",
+	RateLimited:    "rate_limited",
+}
+
+// ParseCounter returns the counter named name
+func ParseCounter(name string) (Counter, bool) {
+	for c, n := range counterNames {
+		if n == name {
+			return Counter(c), true
+		}
+	}
+	return 0, false
+}
+
+// ID returns the session ID of a client at ip authenticated as pubkey, "" for
+// an unauthenticated client
+func ID(ip, pubkey string) string {
+	sum := sha256.Sum256([]byte(ip + "\n" + strings.ToLower(pubkey)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Session counts what a client did across its connections. A nil session counts
+// nothing, so connections can use one whether tracking is enabled or not.
+type Session struct {
+	id        string
+	ip        string
+	pubkey    string
+	firstSeen time.Time
+	// lastSeen is the unix time in nanoseconds of the client's last activity
+	lastSeen    atomic.Int64
+	active      atomic.Int64
+	connections atomic.Int64
+	counts      [numCounters]atomic.Int64
+}
+
+// ID returns the session ID, "" for a nil session
+func (s *Session) ID() string {
+	if s == nil {
+		return ""
+	}
+	return s.id
+}
+
+// Add counts n of c
+func (s *Session) Add(c Counter, n int64) {
+	if s == nil {
+		return
+	}
+	s.counts[c].Add(n)
+	s.lastSeen.Store(time.Now().UnixNano())
+}
+
+// Stats is a snapshot of a session
+type Stats struct {
+	ID          string           `json:"id"`
+	IP          string           `json:"ip"`
+	PubKey      string           `json:"pubkey,omitempty"`
+	FirstSeen   time.Time        `json:"first_seen"`
+	LastSeen    time.Time        `json:"last_seen"`
+	Active      int64            `json:"active_connections"`
+	Connections int64            `json:"connections"`
+	Counts      map[string]int64 `json:"counts"`
+}
+
+// Stats returns a snapshot of the session
+func (s *Session) Stats() Stats {
+	stats := Stats{
+		ID:          s.id,
+		IP:          s.ip,
+		PubKey:      s.pubkey,
+		FirstSeen:   s.firstSeen,
+		LastSeen:    time.Unix(0, s.lastSeen.Load()).UTC(),
+		Active:      s.active.Load(),
+		Connections: s.connections.Load(),
+		Counts:      make(map[string]int64, numCounters),
+	}
+	for c := range s.counts {
+		stats.Counts[counterNames[c]] = s.counts[c].Load()
+	}
+	return stats
+}
+
+// Tracker holds the sessions of this node's clients. Sessions without open
+// connections are forgotten once idle for retention, and the least recently
+// seen of them are dropped first when max sessions are tracked.
+type Tracker struct {
+	mu        sync.Mutex
+	sessions  map[string]*Session
+	retention time.Duration
+	max       int
+}
+
+// NewTracker returns a tracker keeping idle sessions for retention, up to max
+// sessions
+func NewTracker(retention time.Duration, max int) *Tracker {
+	return &Tracker{
+		sessions:  make(map[string]*Session),
+		retention: retention,
+		max:       max,
+	}
+}
+
+// Connect returns the session of a client at ip authenticated as pubkey and
+// counts a connection opened on it. A nil tracker returns a nil session.
+func (t *Tracker) Connect(ip, pubkey string) *Session {
+	if t == nil {
+		return nil
+	}
+	id := ID(ip, pubkey)
+	now := time.Now()
+
+	t.mu.Lock()
+	s, ok := t.sessions[id]
+	if !ok {
+		if len(t.sessions) >= t.max {
+			t.evictOldest()
+		}
+		s = &Session{id: id, ip: ip, pubkey: strings.ToLower(pubkey), firstSeen: now.UTC()}
+		t.sessions[id] = s
+		metrics.ClientSessions.Set(float64(len(t.sessions)))
+	}
+	t.mu.Unlock()
+
+	s.active.Add(1)
+	s.connections.Add(1)
+	s.lastSeen.Store(now.UnixNano())
+	return s
+}
+
+// Disconnect counts a connection of s closed
+func (t *Tracker) Disconnect(s *Session) {
+	if t == nil || s == nil {
+		return
+	}
+	s.active.Add(-1)
+	s.lastSeen.Store(time.Now().UnixNano())
+}
+
+// evictOldest drops the least recently seen session without open connections;
+// t.mu must be held
+func (t *Tracker) evictOldest() {
+	var oldest *Session
+	for _, s := range t.sessions {
+		if s.active.Load() > 0 {
+			continue
+		}
+		if oldest == nil || s.lastSeen.Load() < oldest.lastSeen.Load() {
+			oldest = s
+		}
+	}
+	if oldest != nil {
+		delete(t.sessions, oldest.id)
+	}
+}
+
+// Sweep forgets the sessions without open connections idle for the retention
+func (t *Tracker) Sweep() {
+	if t == nil {
+		return
+	}
+	cutoff := time.Now().Add(-t.retention).UnixNano()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, s := range t.sessions {
+		if s.active.Load() <= 0 && s.lastSeen.Load() < cutoff {
+			delete(t.sessions, id)
+		}
+	}
+	metrics.ClientSessions.Set(float64(len(t.sessions)))
+}
+
+// Get returns a snapshot of the session with id
+func (t *Tracker) Get(id string) (Stats, bool) {
+	if t == nil {
+		return Stats{}, false
+	}
+	t.mu.Lock()
+	s, ok := t.sessions[id]
+	t.mu.Unlock()
+	if !ok {
+		return Stats{}, false
+	}
+	return s.Stats(), true
+}
+
+// Query selects and orders sessions
+type Query struct {
+	// IP and PubKey keep only the sessions of that address or pubkey
+	IP     string
+	PubKey string
+	// ActiveOnly keeps only sessions with open connections
+	ActiveOnly bool
+	// SortBy orders sessions by a counter, highest first; otherwise the most
+	// recently seen come first
+	SortBy *Counter
+	Limit  int
+}
+
+// List returns snapshots of the sessions selected by q
+func (t *Tracker) List(q Query) []Stats {
+	if t == nil {
+		return []Stats{}
+	}
+	t.mu.Lock()
+	selected := make([]*Session, 0, len(t.sessions))
+	for _, s := range t.sessions {
+		if (q.IP != "" && s.ip != q.IP) || (q.PubKey != "" && s.pubkey != strings.ToLower(q.PubKey)) {
+			continue
+		}
+		if q.ActiveOnly && s.active.Load() <= 0 {
+			continue
+		}
+		selected = append(selected, s)
+	}
+	t.mu.Unlock()
+
+	stats := make([]Stats, len(selected))
+	for i, s := range selected {
+		stats[i] = s.Stats()
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if q.SortBy != nil {
+			name := counterNames[*q.SortBy]
+			if stats[i].Counts[name] != stats[j].Counts[name] {
+				return stats[i].Counts[name] > stats[j].Counts[name]
+			}
+		}
+		return stats[i].LastSeen.After(stats[j].LastSeen)
+	})
+	if q.Limit > 0 && len(stats) > q.Limit {
+		stats = stats[:q.Limit]
+	}
+	return stats
+}
@@ -0,0 +1,205 @@
+// Package sink forwards the events a relay accepts to an external HTTP endpoint,
+// such as a search indexer or an analytics pipeline, independently of the live
+// dispatcher that streams them to subscribers.
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/config"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/metrics"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+const (
+	// retryBase is the delay before a batch is POSTed again, doubled on every
+	// further attempt
+	retryBase = time.Second
+	// retryMax caps the retry delay
+	retryMax = time.Minute
+	// maxResponse bounds the response body read from the endpoint
+	maxResponse = 64 << 10
+)
+
+// Delivery is a stored event as forwarded
+type Delivery struct {
+	// Tenant is the virtual relay the event was published to, empty for the main relay
+	Tenant   string      `json:"tenant,omitempty"`
+	Event    nostr.Event `json:"event"`
+	StoredAt int64       `json:"stored_at"`
+}
+
+// Batch is the JSON body of a POST to the endpoint
+type Batch struct {
+	SentAt int64      `json:"sent_at"`
+	Events []Delivery `json:"events"`
+}
+
+// Forwarder POSTs the events this node stores to SINK.URL in batches, signed
+// with HMAC-SHA256 over "<timestamp>.<body>" in X-Relay-Signature when a secret
+// is set. Each node forwards only the events it stored itself, so a cluster
+// delivers every event once. Events are held in memory: a batch the endpoint
+// keeps refusing is dropped after SINK.MAX_ATTEMPTS, and events arriving while
+// the queue is full are dropped, so use the changefeed mode where every event
+// must arrive.
+type Forwarder struct {
+	cfg    config.SinkConfig
+	client *http.Client
+	queue  chan Delivery
+}
+
+// NewForwarder creates a forwarder for cfg
+func NewForwarder(cfg config.SinkConfig) *Forwarder {
+	return &Forwarder{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		queue:  make(chan Delivery, cfg.QueueSize),
+	}
+}
+
+// EventStored queues a new event of tenant for forwarding, dropping it when the
+// queue is full rather than holding up storage
+func (f *Forwarder) EventStored(tenant string, evt nostr.Event) {
+	if !f.cfg.Forwards(evt.Kind) {
+		return
+	}
+	select {
+	case f.queue <- Delivery{Tenant: tenant, Event: evt, StoredAt: time.Now().Unix()}:
+	default:
+		metrics.SinkEvents.WithLabelValues("dropped").Inc()
+	}
+}
+
+// Run POSTs queued events until ctx is done, then sends what is left once
+func (f *Forwarder) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Delivery, 0, f.cfg.BatchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			f.drain(batch)
+			return
+		case d := <-f.queue:
+			batch = append(batch, d)
+			if len(batch) < f.cfg.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		f.send(ctx, batch)
+		batch = batch[:0]
+	}
+}
+
+// drain sends batch and the events still queued, one attempt each, bounded by
+// the POST timeout
+func (f *Forwarder) drain(batch []Delivery) {
+	ctx, cancel := context.WithTimeout(context.Background(), f.cfg.Timeout)
+	defer cancel()
+	for {
+		for len(batch) < f.cfg.BatchSize && len(f.queue) > 0 {
+			batch = append(batch, <-f.queue)
+		}
+		if len(batch) == 0 {
+			return
+		}
+		if err := f.post(ctx, batch); err != nil {
+			metrics.SinkEvents.WithLabelValues("failed").Add(float64(len(batch) + len(f.queue)))
+			logger.Warn("Failed to forward events on shutdown",
+				zap.Int("events", len(batch)+len(f.queue)),
+				zap.Error(err))
+			return
+		}
+		metrics.SinkEvents.WithLabelValues("forwarded").Add(float64(len(batch)))
+		batch = batch[:0]
+	}
+}
+
+// send POSTs batch, retrying with backoff up to SINK.MAX_ATTEMPTS times
+func (f *Forwarder) send(ctx context.Context, batch []Delivery) {
+	var err error
+	for attempt := 1; attempt <= f.cfg.MaxAttempts; attempt++ {
+		if err = f.post(ctx, batch); err == nil {
+			metrics.SinkEvents.WithLabelValues("forwarded").Add(float64(len(batch)))
+			return
+		}
+		if attempt == f.cfg.MaxAttempts {
+			break
+		}
+		delay := retryBase << (attempt - 1)
+		if delay > retryMax || delay <= 0 {
+			delay = retryMax
+		}
+		logger.Debug("Failed to forward events, retrying",
+			zap.Int("events", len(batch)),
+			zap.Int("attempt", attempt),
+			zap.Duration("delay", delay),
+			zap.Error(err))
+		select {
+		case <-ctx.Done():
+			f.drain(batch)
+			return
+		case <-time.After(delay):
+		}
+	}
+	metrics.SinkEvents.WithLabelValues("failed").Add(float64(len(batch)))
+	logger.Warn("Failed to forward events to the sink, dropping them",
+		zap.Int("events", len(batch)),
+		zap.Int("attempts", f.cfg.MaxAttempts),
+		zap.Error(err))
+}
+
+// post sends one batch
+func (f *Forwarder) post(ctx context.Context, batch []Delivery) error {
+	timestamp := time.Now().Unix()
+	body, err := json.Marshal(Batch{SentAt: timestamp, Events: batch})
+	if err != nil {
+		return fmt.Errorf("failed to encode batch: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if f.cfg.Secret != "" {
+		ts := strconv.FormatInt(timestamp, 10)
+		req.Header.Set("X-Relay-Timestamp", ts)
+		req.Header.Set("X-Relay-Signature", "sha256="+signature(f.cfg.Secret, ts, body))
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponse))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("sink endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// signature returns the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with secret
+func signature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
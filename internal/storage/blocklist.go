@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// BlocklistEntry is a pubkey, event ID or domain listed by a blocklist feed
+type BlocklistEntry struct {
+	Feed     string `json:"feed"`
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+	SyncedAt int64  `json:"synced_at"`
+}
+
+// BlocklistFeedSummary counts the stored entries of a blocklist feed by type
+type BlocklistFeedSummary struct {
+	Feed     string `json:"feed"`
+	PubKeys  int64  `json:"pubkeys"`
+	Events   int64  `json:"events"`
+	Domains  int64  `json:"domains"`
+	SyncedAt int64  `json:"synced_at"`
+}
+
+// ReplaceBlocklistFeed replaces the stored entries of feed with entries, the
+// values of each entry type
+func (db *DB) ReplaceBlocklistFeed(ctx context.Context, feed string, entries map[string][]string, syncedAt int64) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil && !errors.Is(rollbackErr, pgx.ErrTxClosed) {
+			db.recordError(fmt.Errorf("rollback failed: %w", rollbackErr))
+		}
+	}()
+
+	if _, err := tx.Exec(ctx, `DELETE FROM blocklist_entries WHERE feed = $1`, feed); err != nil {
+		return fmt.Errorf("failed to clear blocklist feed: %w", err)
+	}
+	for entryType, values := range entries {
+		if len(values) == 0 {
+			continue
+		}
+		_, err := tx.Exec(ctx,
+			`INSERT INTO blocklist_entries (feed, type, value, synced_at)
+			 SELECT $1, $2, value, $3 FROM unnest($4::STRING[]) AS value
+			 ON CONFLICT DO NOTHING`,
+			feed, entryType, syncedAt, values)
+		if err != nil {
+			return fmt.Errorf("failed to store blocklist feed: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit blocklist feed: %w", err)
+	}
+	return nil
+}
+
+// PruneBlocklistFeeds deletes the entries of every feed not in keep
+func (db *DB) PruneBlocklistFeeds(ctx context.Context, keep []string) error {
+	if keep == nil {
+		keep = []string{}
+	}
+	_, err := db.Pool.Exec(ctx, `DELETE FROM blocklist_entries WHERE feed <> ALL($1::STRING[])`, keep)
+	if err != nil {
+		return fmt.Errorf("failed to prune blocklist feeds: %w", err)
+	}
+	return nil
+}
+
+// GetBlocklistEntries returns the stored entries of every feed
+func (db *DB) GetBlocklistEntries(ctx context.Context) ([]BlocklistEntry, error) {
+	return db.queryBlocklistEntries(ctx, `SELECT feed, type, value, synced_at FROM blocklist_entries`)
+}
+
+// FindBlocklistEntries returns the entries listing value, one per feed and type
+func (db *DB) FindBlocklistEntries(ctx context.Context, value string) ([]BlocklistEntry, error) {
+	return db.queryBlocklistEntries(ctx,
+		`SELECT feed, type, value, synced_at FROM blocklist_entries WHERE value = $1 ORDER BY feed ASC, type ASC`,
+		value)
+}
+
+// queryBlocklistEntries runs a query selecting blocklist entries
+func (db *DB) queryBlocklistEntries(ctx context.Context, query string, args ...any) ([]BlocklistEntry, error) {
+	rows, err := db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load blocklist entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []BlocklistEntry{}
+	for rows.Next() {
+		var e BlocklistEntry
+		if err := rows.Scan(&e.Feed, &e.Type, &e.Value, &e.SyncedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan blocklist entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// GetBlocklistFeedSummaries counts the stored entries of each feed, ordered by feed
+func (db *DB) GetBlocklistFeedSummaries(ctx context.Context) ([]BlocklistFeedSummary, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT feed,
+		        count(*) FILTER (WHERE type = 'pubkey'),
+		        count(*) FILTER (WHERE type = 'event'),
+		        count(*) FILTER (WHERE type = 'domain'),
+		        max(synced_at)
+		 FROM blocklist_entries GROUP BY feed ORDER BY feed ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize blocklist feeds: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := []BlocklistFeedSummary{}
+	for rows.Next() {
+		var s BlocklistFeedSummary
+		if err := rows.Scan(&s.Feed, &s.PubKeys, &s.Events, &s.Domains, &s.SyncedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan blocklist feed summary: %w", err)
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, rows.Err()
+}
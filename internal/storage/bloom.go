@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"math"
+	"sync"
+
+	"github.com/Shugur-Network/relay/internal/metrics"
+	"github.com/willf/bloom"
+)
+
+// Default sizing of the duplicate filter until SizeBloomFilter is called
+const (
+	DefaultBloomCapacity          = 10_000_000
+	DefaultBloomFalsePositiveRate = 0.01
+)
+
+// recentIDCount is how many of the latest stored event IDs are remembered
+// exactly, to confirm the filter's positives
+const recentIDCount = 100_000
+
+// DedupFilter is the bloom filter of stored event IDs that duplicate events are
+// dropped by before reaching the database. A false positive would drop a new
+// event, so positives are only trusted for recently stored IDs, and the filter
+// counts the IDs it holds to tell how saturated it is.
+type DedupFilter struct {
+	mu                sync.RWMutex
+	filter            *bloom.BloomFilter
+	capacity          uint
+	falsePositiveRate float64
+	// entries is the number of distinct IDs added, as far as the filter can tell
+	entries uint
+	// recent holds the latest IDs added, nil in a filter being rebuilt
+	recent *idRing
+	// next is the filter being rebuilt, which takes every ID added meanwhile too
+	next *DedupFilter
+	// rebuilding serializes rebuilds
+	rebuilding sync.Mutex
+}
+
+// DedupKey is what the filter holds for the event id stored on tenant: events
+// are unique per tenant, and main relay events are held by their bare ID
+func DedupKey(tenant, id string) string {
+	if tenant == DefaultTenant {
+		return id
+	}
+	return tenant + "/" + id
+}
+
+// NewDedupFilter returns an empty filter sized for capacity IDs at
+// falsePositiveRate
+func NewDedupFilter(capacity uint, falsePositiveRate float64) *DedupFilter {
+	return &DedupFilter{
+		filter:            bloom.NewWithEstimates(capacity, falsePositiveRate),
+		capacity:          capacity,
+		falsePositiveRate: falsePositiveRate,
+		recent:            newIDRing(recentIDCount),
+	}
+}
+
+// Test reports whether data may be a stored event ID
+func (f *DedupFilter) Test(data []byte) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.filter.Test(data)
+}
+
+// Known reports whether the event with id is certainly stored: the filter holds
+// id and it is one of the recently stored IDs. Events the filter holds but that
+// weren't stored recently are left to the database's unique constraint, as the
+// filter may be wrong about them.
+func (f *DedupFilter) Known(id string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if !f.filter.TestString(id) {
+		return false
+	}
+	if f.recent.has(id) {
+		return true
+	}
+	metrics.BloomFilterUnconfirmed.Inc()
+	return false
+}
+
+// AddString adds the event ID id
+func (f *DedupFilter) AddString(id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.filter.TestAndAddString(id) {
+		f.entries++
+	}
+	if f.recent != nil {
+		f.recent.add(id)
+	}
+	if f.next != nil {
+		f.next.AddString(id)
+	}
+}
+
+// DedupFilterStats describes how saturated the filter is
+type DedupFilterStats struct {
+	Capacity uint `json:"capacity"`
+	Entries  uint `json:"entries"`
+	// FillRatio is the estimated share of the filter's bits that are set
+	FillRatio float64 `json:"fill_ratio"`
+	// FalsePositiveRate is the estimated chance a new ID tests as stored
+	FalsePositiveRate float64 `json:"false_positive_rate"`
+}
+
+// Stats estimates the filter's saturation from the IDs it holds
+func (f *DedupFilter) Stats() DedupFilterStats {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	m, k := float64(f.filter.Cap()), float64(f.filter.K())
+	fill := 1 - math.Exp(-k*float64(f.entries)/m)
+	return DedupFilterStats{
+		Capacity:          f.capacity,
+		Entries:           f.entries,
+		FillRatio:         fill,
+		FalsePositiveRate: math.Pow(fill, k),
+	}
+}
+
+// Capacity returns the number of IDs the filter is sized for
+func (f *DedupFilter) Capacity() uint {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.capacity
+}
+
+// startRebuild returns an empty filter of capacity that takes every ID added to
+// f from now on, for the rebuild to fill in the stored ones
+func (f *DedupFilter) startRebuild(capacity uint) *DedupFilter {
+	next := &DedupFilter{
+		filter:            bloom.NewWithEstimates(capacity, f.falsePositiveRate),
+		capacity:          capacity,
+		falsePositiveRate: f.falsePositiveRate,
+	}
+	f.mu.Lock()
+	f.next = next
+	f.mu.Unlock()
+	return next
+}
+
+// endRebuild stops copying IDs to the filter being rebuilt, and takes its place
+// when it was filled in completely
+func (f *DedupFilter) endRebuild(complete bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	next := f.next
+	f.next = nil
+	if !complete || next == nil {
+		return
+	}
+	next.mu.RLock()
+	defer next.mu.RUnlock()
+	f.filter = next.filter
+	f.capacity = next.capacity
+	f.entries = next.entries
+}
+
+// idRing remembers the latest IDs added to it, forgetting the oldest past its
+// size
+type idRing struct {
+	ids  map[string]struct{}
+	ring []string
+	pos  int
+}
+
+// newIDRing returns an empty ring of size IDs
+func newIDRing(size int) *idRing {
+	return &idRing{ids: make(map[string]struct{}, size), ring: make([]string, size)}
+}
+
+// add remembers id in place of the oldest ID
+func (r *idRing) add(id string) {
+	if _, ok := r.ids[id]; ok {
+		return
+	}
+	if oldest := r.ring[r.pos]; oldest != "" {
+		delete(r.ids, oldest)
+	}
+	r.ring[r.pos] = id
+	r.ids[id] = struct{}{}
+	r.pos = (r.pos + 1) % len(r.ring)
+}
+
+// has reports whether id is remembered
+func (r *idRing) has(id string) bool {
+	_, ok := r.ids[id]
+	return ok
+}
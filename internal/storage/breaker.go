@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/metrics"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+// ErrDatabaseUnavailable is returned without reaching the database while the
+// circuit breaker is open
+var ErrDatabaseUnavailable = errors.New("database unavailable")
+
+// circuitBreaker stops storage operations from waiting on a database that went
+// away. Once threshold operations in a row failed to reach it and a ping
+// confirms it is down, the circuit opens: reads are answered from memory where
+// possible and everything else fails at once, until a probe reaches the
+// database again.
+type circuitBreaker struct {
+	threshold     int32
+	probeInterval time.Duration
+	failures      atomic.Int32
+	open          atomic.Bool
+	// tripping is set while a ping confirms an outage
+	tripping atomic.Bool
+}
+
+// EnableCircuitBreaker opens the circuit after threshold storage operations in a
+// row failed to reach the database, and probes it every probeInterval until it
+// answers again. Must be called before operations run.
+func (db *DB) EnableCircuitBreaker(threshold int, probeInterval time.Duration) {
+	db.breaker = &circuitBreaker{threshold: int32(threshold), probeInterval: probeInterval}
+}
+
+// Available reports whether storage operations reach the database, false while
+// the circuit breaker is open
+func (db *DB) Available() bool {
+	return db.breaker == nil || !db.breaker.open.Load()
+}
+
+// allow returns ErrDatabaseUnavailable while the circuit is open
+func (db *DB) allow() error {
+	if db.Available() {
+		return nil
+	}
+	metrics.DBCircuitRejected.Inc()
+	return ErrDatabaseUnavailable
+}
+
+// observe counts the outcome of a storage operation toward opening the circuit.
+// Errors the database answered with prove it is up; errors of the caller's own
+// making, like a canceled request or a full query queue, say nothing about it.
+func (db *DB) observe(err error) {
+	b := db.breaker
+	if b == nil || b.open.Load() {
+		return
+	}
+	var pgErr *pgconn.PgError
+	switch {
+	case err == nil, errors.As(err, &pgErr):
+		b.failures.Store(0)
+		return
+	case errors.Is(err, context.Canceled), errors.Is(err, ErrQueriesBusy),
+		errors.Is(err, ErrDuplicateEvent), errors.Is(err, ErrStaleReplaceable),
+		errors.Is(err, ErrDatabaseUnavailable):
+		return
+	}
+	if b.failures.Add(1) >= b.threshold && b.tripping.CompareAndSwap(false, true) {
+		go db.trip(err)
+	}
+}
+
+// trip opens the circuit unless a ping shows the failures were the queries' own,
+// like scans timing out on a healthy database
+func (db *DB) trip(cause error) {
+	b := db.breaker
+	defer b.tripping.Store(false)
+	if db.Ping() == nil {
+		b.failures.Store(0)
+		return
+	}
+	if !b.open.CompareAndSwap(false, true) {
+		return
+	}
+	metrics.DBCircuitOpen.Set(1)
+	metrics.DBCircuitTrips.Inc()
+	logger.Error("Database unreachable, opening circuit breaker",
+		zap.Int32("failures", b.failures.Load()),
+		zap.Duration("probe_interval", b.probeInterval),
+		zap.Error(cause))
+	go db.probe()
+}
+
+// probe pings the database every probe interval while the circuit is open, and
+// closes it once the database answers
+func (db *DB) probe() {
+	b := db.breaker
+	ticker := time.NewTicker(b.probeInterval)
+	defer ticker.Stop()
+	opened := time.Now()
+	for range ticker.C {
+		if !db.isConnected() {
+			return
+		}
+		if err := db.Ping(); err != nil {
+			logger.Debug("Database still unreachable", zap.Error(err))
+			continue
+		}
+		b.failures.Store(0)
+		b.open.Store(false)
+		metrics.DBCircuitOpen.Set(0)
+		logger.Info("Database reachable again, closing circuit breaker",
+			zap.Duration("outage", time.Since(opened)))
+		return
+	}
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/relay/nips"
+	nostr "github.com/nbd-wtf/go-nostr"
+)
+
+// EnableCapsuleBlobOffload makes InsertEvent keep time capsule payloads of at
+// least threshold bytes in capsule_blobs instead of the events row.
+// Must be called before events are inserted.
+func (db *DB) EnableCapsuleBlobOffload(threshold int) {
+	db.blobThreshold = threshold
+}
+
+// offloadCapsuleBlob stores a large capsule payload in capsule_blobs and clears it
+// from evt, so only an empty content column lands in the events table
+func (db *DB) offloadCapsuleBlob(ctx context.Context, evt *nostr.Event) error {
+	if db.blobThreshold <= 0 || len(evt.Content) < db.blobThreshold || !nips.IsTimeCapsuleKind(evt.Kind) {
+		return nil
+	}
+	_, err := db.Pool.Exec(ctx,
+		`INSERT INTO capsule_blobs (event_id, content, created_at)
+		 VALUES ($1, $2, $3)
+		 ON CONFLICT (event_id) DO NOTHING`,
+		evt.ID, evt.Content, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to store capsule blob: %w", err)
+	}
+	evt.Content = ""
+	return nil
+}
+
+// hydrateCapsuleBlobs restores offloaded payloads into capsules read from the
+// events table. Capsules stored inline are left untouched. When the payloads
+// can't be read none are restored, so no capsule is mistaken for an empty one.
+func (db *DB) hydrateCapsuleBlobs(ctx context.Context, events []nostr.Event) error {
+	var ids []string
+	for i := range events {
+		if events[i].Content == "" && nips.IsTimeCapsuleKind(events[i].Kind) {
+			ids = append(ids, events[i].ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows, err := db.Pool.Query(ctx, `SELECT event_id, content FROM capsule_blobs WHERE event_id = ANY($1)`, ids)
+	if err != nil {
+		return fmt.Errorf("failed to load capsule blobs: %w", err)
+	}
+	defer rows.Close()
+
+	blobs := make(map[string]string, len(ids))
+	for rows.Next() {
+		var id, content string
+		if err := rows.Scan(&id, &content); err != nil {
+			return fmt.Errorf("failed to scan capsule blob: %w", err)
+		}
+		blobs[id] = content
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load capsule blobs: %w", err)
+	}
+
+	for i := range events {
+		if content, ok := blobs[events[i].ID]; ok {
+			events[i].Content = content
+		}
+	}
+	return nil
+}
+
+// hydrateCapsuleBlob restores the offloaded payload of a single event
+func (db *DB) hydrateCapsuleBlob(ctx context.Context, evt *nostr.Event) error {
+	events := []nostr.Event{*evt}
+	if err := db.hydrateCapsuleBlobs(ctx, events); err != nil {
+		return err
+	}
+	evt.Content = events[0].Content
+	return nil
+}
+
+// DeleteOrphanedCapsuleBlobs deletes blobs created before cutoff whose event is no
+// longer stored
+func (db *DB) DeleteOrphanedCapsuleBlobs(ctx context.Context, cutoff int64) (int64, error) {
+	var total int64
+	for {
+		tag, err := db.Pool.Exec(ctx,
+			`DELETE FROM capsule_blobs b
+			 WHERE b.created_at < $1
+			   AND NOT EXISTS (SELECT 1 FROM events e WHERE e.id = b.event_id)
+			 LIMIT $2`,
+			cutoff, capsuleGCBatch)
+		if err != nil {
+			return total, fmt.Errorf("failed to delete orphaned capsule blobs: %w", err)
+		}
+		total += tag.RowsAffected()
+		if tag.RowsAffected() < capsuleGCBatch {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/constants"
+	"github.com/Shugur-Network/relay/internal/drand"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/relay/nips"
+	"go.uber.org/zap"
+)
+
+const (
+	// capsuleGCBatch bounds the rows deleted per collector statement
+	capsuleGCBatch = 1000
+	// orphanShareGrace keeps share events and blobs whose capsule is missing for a
+	// while, so rows racing the capsule insert aren't collected
+	orphanShareGrace = time.Hour
+)
+
+// CapsuleRetention configures time capsule garbage collection. Zero durations
+// disable the corresponding rule.
+type CapsuleRetention struct {
+	// Unlocked deletes capsules this long after they unlocked
+	Unlocked time.Duration
+	// Unresolvable retries resolving the unlock time of unindexed capsules older
+	// than this (needs the unlock index); they are never deleted
+	Unresolvable time.Duration
+}
+
+// CapsuleGCStats counts what one collector pass removed, and the capsules it
+// indexed
+type CapsuleGCStats struct {
+	Unlocked     int64
+	Resolved     int64
+	OrphanShares int64
+	OrphanBlobs  int64
+}
+
+// DeleteUnlockedCapsules deletes capsules that unlocked before cutoff along with
+// their unlock index rows
+func (db *DB) DeleteUnlockedCapsules(ctx context.Context, cutoff int64) (int64, error) {
+	var total int64
+	for {
+		tag, err := db.Pool.Exec(ctx,
+			`WITH gone AS (
+			   DELETE FROM capsule_unlocks
+			   WHERE unlocked = true AND unlock_at < $1
+			   LIMIT $2
+			   RETURNING tenant, event_id
+			 )
+			 DELETE FROM events WHERE (tenant, id) IN (SELECT tenant, event_id FROM gone)`,
+			cutoff, capsuleGCBatch)
+		if err != nil {
+			return total, fmt.Errorf("failed to delete unlocked capsules: %w", err)
+		}
+		total += tag.RowsAffected()
+		if tag.RowsAffected() < capsuleGCBatch {
+			return total, nil
+		}
+	}
+}
+
+// DeleteOrphanedShares deletes unlock share and share distribution events created
+// before cutoff whose capsule is no longer stored on their tenant, and their share
+// accounting rows
+func (db *DB) DeleteOrphanedShares(ctx context.Context, cutoff int64) (int64, error) {
+	var total int64
+	for {
+		tag, err := db.Pool.Exec(ctx,
+			`DELETE FROM events e
+			 WHERE e.kind IN ($1, $2) AND e.created_at < $3
+			   AND NOT EXISTS (
+			     SELECT 1 FROM jsonb_array_elements(e.tags) AS tag
+			     JOIN events c ON c.tenant = e.tenant AND c.id = tag->>1
+			     WHERE tag->>0 = 'e'
+			   )
+			 LIMIT $4`,
+			constants.KindUnlockShare, constants.KindShareDistribution, cutoff, capsuleGCBatch)
+		if err != nil {
+			return total, fmt.Errorf("failed to delete orphaned shares: %w", err)
+		}
+		total += tag.RowsAffected()
+		if tag.RowsAffected() < capsuleGCBatch {
+			break
+		}
+	}
+
+	if _, err := db.Pool.Exec(ctx,
+		`DELETE FROM capsule_shares s
+		 WHERE NOT EXISTS (SELECT 1 FROM events c WHERE c.tenant = s.tenant AND c.id = s.capsule_id)`); err != nil {
+		return total, fmt.Errorf("failed to delete orphaned share records: %w", err)
+	}
+	if _, err := db.Pool.Exec(ctx,
+		`DELETE FROM capsule_share_thresholds t
+		 WHERE NOT EXISTS (SELECT 1 FROM events c WHERE c.tenant = t.tenant AND c.id = t.capsule_id)`); err != nil {
+		return total, fmt.Errorf("failed to delete orphaned share distributions: %w", err)
+	}
+	return total, nil
+}
+
+// resolveUnindexedCapsules retries unlock time resolution for unindexed capsules
+// created before cutoff and indexes those that resolve. Capsules that still don't
+// resolve are kept for a later pass: their drand chain may be served again.
+func (ep *EventProcessor) resolveUnindexedCapsules(ctx context.Context, cutoff int64) (int64, error) {
+	var resolved int64
+	var afterTenant, afterID string
+	for {
+		batch, err := ep.db.GetUnindexedCapsules(ctx, nips.TimeCapsuleKinds(), afterTenant, afterID, capsuleBackfillBatch)
+		if err != nil {
+			return resolved, err
+		}
+
+		for _, tc := range batch {
+			evt := tc.Event
+			if int64(evt.CreatedAt) >= cutoff {
+				continue
+			}
+			chainHash, round, err := nips.ExtractDrandParameters(&evt)
+			if err == nil {
+				_, err = ep.unlockResolver.UnlockTime(ctx, chainHash, round)
+			}
+			if err != nil {
+				logger.Debug("Capsule unlock time still unresolved",
+					zap.String("event_id", evt.ID),
+					zap.Bool("permanent", errors.Is(err, drand.ErrUnknownChain) || errors.Is(err, drand.ErrInvalidRound)),
+					zap.Error(err))
+				continue
+			}
+			if ep.indexCapsule(tc.Tenant, evt) {
+				resolved++
+			}
+		}
+
+		if len(batch) < capsuleBackfillBatch {
+			return resolved, nil
+		}
+		afterTenant, afterID = batch[len(batch)-1].Tenant, batch[len(batch)-1].Event.ID
+	}
+}
+
+// CollectCapsules runs one garbage collection pass over stored time capsules
+func (ep *EventProcessor) CollectCapsules(ctx context.Context, retention CapsuleRetention) (CapsuleGCStats, error) {
+	var stats CapsuleGCStats
+	var err error
+	now := time.Now()
+
+	if retention.Unlocked > 0 {
+		if stats.Unlocked, err = ep.db.DeleteUnlockedCapsules(ctx, now.Add(-retention.Unlocked).Unix()); err != nil {
+			return stats, err
+		}
+	}
+	if retention.Unresolvable > 0 && ep.unlockResolver != nil {
+		if stats.Resolved, err = ep.resolveUnindexedCapsules(ctx, now.Add(-retention.Unresolvable).Unix()); err != nil {
+			return stats, err
+		}
+	}
+	// Runs last so shares of capsules deleted above are collected once their grace passes
+	if stats.OrphanShares, err = ep.db.DeleteOrphanedShares(ctx, now.Add(-orphanShareGrace).Unix()); err != nil {
+		return stats, err
+	}
+	if stats.OrphanBlobs, err = ep.db.DeleteOrphanedCapsuleBlobs(ctx, now.Add(-orphanShareGrace).Unix()); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+// StartCapsuleCollector starts a background goroutine running capsule garbage
+// collection periodically
+func (ep *EventProcessor) StartCapsuleCollector(ctx context.Context, interval time.Duration, retention CapsuleRetention) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				stats, err := ep.CollectCapsules(ctx, retention)
+				if err != nil {
+					logger.Error("Failed to collect time capsules", zap.Error(err))
+				}
+				if stats.Unlocked > 0 || stats.Resolved > 0 || stats.OrphanShares > 0 || stats.OrphanBlobs > 0 {
+					logger.Info("Collected time capsules",
+						zap.Int64("unlocked", stats.Unlocked),
+						zap.Int64("resolved", stats.Resolved),
+						zap.Int64("orphan_shares", stats.OrphanShares),
+						zap.Int64("orphan_blobs", stats.OrphanBlobs))
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/constants"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/metrics"
+	"github.com/Shugur-Network/relay/internal/relay/nips"
+	"github.com/jackc/pgx/v5"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+// ErrShareDistributionNotFound is returned when a capsule has no recorded share distribution
+var ErrShareDistributionNotFound = errors.New("share distribution not found")
+
+// ShareProgress reports received witness shares against a capsule's threshold
+type ShareProgress struct {
+	CapsuleID string   `json:"capsule_id"`
+	Author    string   `json:"author"`
+	Threshold int      `json:"threshold"`
+	Witnesses []string `json:"witnesses"`
+	Received  []string `json:"received"`
+	MetAt     int64    `json:"met_at,omitempty"`
+}
+
+// Met reports whether enough shares have been received to unlock the capsule
+func (p *ShareProgress) Met() bool {
+	return p.MetAt != 0
+}
+
+// HasWitness reports whether pubkey is one of the capsule's witnesses
+func (p *ShareProgress) HasWitness(pubkey string) bool {
+	for _, w := range p.Witnesses {
+		if w == pubkey {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordShareDistribution stores the witness list and threshold of a capsule
+// stored on tenant. The first distribution wins so share accounting can't be
+// reset by a later one.
+func (db *DB) RecordShareDistribution(ctx context.Context, tenant, capsuleID, author, distributionID string, threshold int, witnesses []string) error {
+	_, err := db.Pool.Exec(ctx,
+		`INSERT INTO capsule_share_thresholds (tenant, capsule_id, author, distribution_id, threshold, witnesses)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 ON CONFLICT (tenant, capsule_id) DO NOTHING`,
+		tenant, capsuleID, author, distributionID, threshold, witnesses)
+	if err != nil {
+		return fmt.Errorf("failed to record share distribution: %w", err)
+	}
+	return nil
+}
+
+// RecordUnlockShare stores a witness's share for a capsule stored on tenant and
+// reports whether this share brought the capsule to its threshold. Shares from
+// pubkeys that aren't listed witnesses of the capsule are ignored.
+func (db *DB) RecordUnlockShare(ctx context.Context, tenant, capsuleID, witness, eventID string, receivedAt int64) (bool, error) {
+	_, err := db.Pool.Exec(ctx,
+		`INSERT INTO capsule_shares (tenant, capsule_id, witness, event_id, received_at)
+		 SELECT tenant, capsule_id, $3, $4, $5 FROM capsule_share_thresholds
+		 WHERE tenant = $1 AND capsule_id = $2 AND $3 = ANY(witnesses)
+		 ON CONFLICT (tenant, capsule_id, witness) DO NOTHING`,
+		tenant, capsuleID, witness, eventID, receivedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to record unlock share: %w", err)
+	}
+
+	tag, err := db.Pool.Exec(ctx,
+		`UPDATE capsule_share_thresholds SET met_at = $3
+		 WHERE tenant = $1 AND capsule_id = $2 AND met_at IS NULL
+		   AND threshold <= (SELECT count(*) FROM capsule_shares WHERE tenant = $1 AND capsule_id = $2)`,
+		tenant, capsuleID, receivedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to update share threshold: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetShareProgress returns the share distribution of a capsule stored on tenant
+// and the witnesses whose shares have been received
+func (db *DB) GetShareProgress(ctx context.Context, tenant, capsuleID string) (*ShareProgress, error) {
+	progress := &ShareProgress{CapsuleID: capsuleID}
+	var metAt *int64
+	err := db.Pool.QueryRow(ctx,
+		`SELECT author, threshold, witnesses, met_at FROM capsule_share_thresholds WHERE tenant = $1 AND capsule_id = $2`,
+		tenant, capsuleID).Scan(&progress.Author, &progress.Threshold, &progress.Witnesses, &metAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrShareDistributionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load share distribution: %w", err)
+	}
+	if metAt != nil {
+		progress.MetAt = *metAt
+	}
+
+	rows, err := db.Pool.Query(ctx,
+		`SELECT witness FROM capsule_shares WHERE tenant = $1 AND capsule_id = $2 ORDER BY received_at ASC`,
+		tenant, capsuleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load unlock shares: %w", err)
+	}
+	defer rows.Close()
+
+	progress.Received = []string{}
+	for rows.Next() {
+		var witness string
+		if err := rows.Scan(&witness); err != nil {
+			return nil, fmt.Errorf("failed to scan unlock share: %w", err)
+		}
+		progress.Received = append(progress.Received, witness)
+	}
+	return progress, rows.Err()
+}
+
+// EnableShareTracking makes the processor account witness shares of time capsules.
+// Must be called before events are queued.
+func (ep *EventProcessor) EnableShareTracking() {
+	ep.trackShares = true
+}
+
+// recordCapsuleShare updates share accounting for a share event newly stored on tenant
+func (ep *EventProcessor) recordCapsuleShare(tenant string, evt nostr.Event) {
+	capsuleID, err := nips.ExtractCapsuleReference(&evt)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ep.ctx, 3*time.Second)
+	defer cancel()
+
+	switch evt.Kind {
+	case constants.KindShareDistribution:
+		threshold, witnesses, err := nips.ExtractShareThreshold(&evt)
+		if err != nil {
+			return
+		}
+		if err := ep.db.RecordShareDistribution(ctx, tenant, capsuleID, evt.PubKey, evt.ID, threshold, witnesses); err != nil {
+			logger.Warn("Failed to record share distribution",
+				zap.String("event_id", evt.ID),
+				zap.String("capsule_id", capsuleID),
+				zap.Error(err))
+		}
+
+	case constants.KindUnlockShare:
+		met, err := ep.db.RecordUnlockShare(ctx, tenant, capsuleID, evt.PubKey, evt.ID, time.Now().Unix())
+		if err != nil {
+			logger.Warn("Failed to record unlock share",
+				zap.String("event_id", evt.ID),
+				zap.String("capsule_id", capsuleID),
+				zap.Error(err))
+			return
+		}
+		metrics.CapsuleSharesReceived.Inc()
+		if met {
+			metrics.CapsuleThresholdsMet.Inc()
+			logger.Info("Capsule share threshold met", zap.String("capsule_id", capsuleID))
+		}
+	}
+}
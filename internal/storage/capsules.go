@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/relay/nips"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+// capsuleBackfillBatch bounds the capsules loaded per backfill query
+const capsuleBackfillBatch = 500
+
+// UnlockTimeResolver converts a capsule's drand chain and round to the wall-clock unlock time
+type UnlockTimeResolver interface {
+	UnlockTime(ctx context.Context, chainHash string, round int64) (time.Time, error)
+}
+
+// IndexCapsule records when a time capsule stored on tenant becomes unlockable
+func (db *DB) IndexCapsule(ctx context.Context, tenant, eventID, chainHash string, round, unlockAt int64) error {
+	_, err := db.Pool.Exec(ctx,
+		`INSERT INTO capsule_unlocks (tenant, event_id, chain_hash, round, unlock_at, unlocked)
+		 VALUES ($1, $2, $3, $4, $5, false)
+		 ON CONFLICT (tenant, event_id) DO NOTHING`,
+		tenant, eventID, chainHash, round, unlockAt)
+	if err != nil {
+		return fmt.Errorf("failed to index capsule: %w", err)
+	}
+	return nil
+}
+
+// MarkCapsulesUnlocked flags every capsule whose unlock time has passed as unlocked,
+// making it visible to the "#unlocked" vendor filter
+func (db *DB) MarkCapsulesUnlocked(ctx context.Context, now int64) (int64, error) {
+	tag, err := db.Pool.Exec(ctx,
+		`UPDATE capsule_unlocks SET unlocked = true WHERE unlocked = false AND unlock_at <= $1`, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark capsules unlocked: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// GetCapsulesUnlockedBetween returns capsules whose unlock time is in (after, until],
+// oldest first, along with the unlock time of the last one
+func (db *DB) GetCapsulesUnlockedBetween(ctx context.Context, after, until int64, limit int) ([]TenantEvent, int64, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT c.tenant, e.id, e.pubkey, e.kind, e.created_at, e.content, e.tags, e.sig, c.unlock_at
+		 FROM capsule_unlocks c JOIN events e ON e.tenant = c.tenant AND e.id = c.event_id
+		 WHERE c.unlock_at > $1 AND c.unlock_at <= $2
+		 ORDER BY c.unlock_at ASC
+		 LIMIT $3`,
+		after, until, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query unlocked capsules: %w", err)
+	}
+	defer rows.Close()
+
+	var capsules []TenantEvent
+	var lastUnlockAt int64
+	for rows.Next() {
+		var tc TenantEvent
+		var createdAt int64
+		var rawTags []byte
+		if err := rows.Scan(&tc.Tenant, &tc.Event.ID, &tc.Event.PubKey, &tc.Event.Kind, &createdAt, &tc.Event.Content, &rawTags, &tc.Event.Sig, &lastUnlockAt); err != nil {
+			logger.Warn("Row scan failed", zap.Error(err))
+			continue
+		}
+		tc.Event.CreatedAt = nostr.Timestamp(createdAt)
+		if len(rawTags) > 0 {
+			if err := json.Unmarshal(rawTags, &tc.Event.Tags); err != nil {
+				tc.Event.Tags = nostr.Tags{}
+			}
+		}
+		capsules = append(capsules, tc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	events := make([]nostr.Event, len(capsules))
+	for i := range capsules {
+		events[i] = capsules[i].Event
+	}
+	if err := db.hydrateCapsuleBlobs(ctx, events); err != nil {
+		return nil, 0, err
+	}
+	for i := range capsules {
+		capsules[i].Event = events[i]
+	}
+	return capsules, lastUnlockAt, nil
+}
+
+// ScheduledCapsule is a stored time capsule with its resolved unlock time
+type ScheduledCapsule struct {
+	Event     nostr.Event `json:"event"`
+	ChainHash string      `json:"chain"`
+	Round     int64       `json:"round"`
+	UnlockAt  int64       `json:"unlock_at"`
+}
+
+// GetCapsuleSchedule returns capsules of tenant whose unlock time is in
+// [since, until], soonest first, using the unlock time index
+func (db *DB) GetCapsuleSchedule(ctx context.Context, tenant string, since, until int64, limit int) ([]ScheduledCapsule, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT e.id, e.pubkey, e.kind, e.created_at, e.content, e.tags, e.sig, c.chain_hash, c.round, c.unlock_at
+		 FROM capsule_unlocks c JOIN events e ON e.tenant = c.tenant AND e.id = c.event_id
+		 WHERE c.unlock_at >= $1 AND c.unlock_at <= $2 AND c.tenant = $4
+		 ORDER BY c.unlock_at ASC
+		 LIMIT $3`,
+		since, until, limit, tenant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query capsule schedule: %w", err)
+	}
+	defer rows.Close()
+
+	capsules := []ScheduledCapsule{}
+	for rows.Next() {
+		var sc ScheduledCapsule
+		var createdAt int64
+		var rawTags []byte
+		if err := rows.Scan(&sc.Event.ID, &sc.Event.PubKey, &sc.Event.Kind, &createdAt, &sc.Event.Content, &rawTags, &sc.Event.Sig,
+			&sc.ChainHash, &sc.Round, &sc.UnlockAt); err != nil {
+			logger.Warn("Row scan failed", zap.Error(err))
+			continue
+		}
+		sc.Event.CreatedAt = nostr.Timestamp(createdAt)
+		if len(rawTags) > 0 {
+			if err := json.Unmarshal(rawTags, &sc.Event.Tags); err != nil {
+				sc.Event.Tags = nostr.Tags{}
+			}
+		}
+		capsules = append(capsules, sc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range capsules {
+		if err := db.hydrateCapsuleBlob(ctx, &capsules[i].Event); err != nil {
+			return nil, err
+		}
+	}
+	return capsules, nil
+}
+
+// GetUnindexedCapsules returns stored events of the given kinds with no unlock time
+// recorded, ordered by tenant and ID and starting after (afterTenant, afterID)
+func (db *DB) GetUnindexedCapsules(ctx context.Context, kinds []int, afterTenant, afterID string, limit int) ([]TenantEvent, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT e.tenant, e.id, e.pubkey, e.kind, e.created_at, e.content, e.tags, e.sig
+		 FROM events e
+		 WHERE e.kind = ANY($1) AND (e.tenant, e.id) > ($2, $3)
+		   AND NOT EXISTS (SELECT 1 FROM capsule_unlocks c WHERE c.tenant = e.tenant AND c.event_id = e.id)
+		 ORDER BY e.tenant ASC, e.id ASC
+		 LIMIT $4`,
+		kinds, afterTenant, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unindexed capsules: %w", err)
+	}
+	defer rows.Close()
+
+	var capsules []TenantEvent
+	for rows.Next() {
+		var tc TenantEvent
+		var createdAt int64
+		var rawTags []byte
+		if err := rows.Scan(&tc.Tenant, &tc.Event.ID, &tc.Event.PubKey, &tc.Event.Kind, &createdAt, &tc.Event.Content, &rawTags, &tc.Event.Sig); err != nil {
+			logger.Warn("Row scan failed", zap.Error(err))
+			continue
+		}
+		tc.Event.CreatedAt = nostr.Timestamp(createdAt)
+		if len(rawTags) > 0 {
+			if err := json.Unmarshal(rawTags, &tc.Event.Tags); err != nil {
+				tc.Event.Tags = nostr.Tags{}
+			}
+		}
+		capsules = append(capsules, tc)
+	}
+	return capsules, rows.Err()
+}
+
+// GetCapsuleUsage returns how many time capsules a pubkey has stored on tenant and
+// their total content size in bytes
+func (db *DB) GetCapsuleUsage(ctx context.Context, tenant, pubkey string) (count int64, bytes int64, err error) {
+	err = db.Pool.QueryRow(ctx,
+		`SELECT count(*), COALESCE(sum(length(e.content) + COALESCE(length(b.content), 0)), 0)
+		 FROM events e LEFT JOIN capsule_blobs b ON b.event_id = e.id
+		 WHERE e.tenant = $1 AND e.pubkey = $2 AND e.kind = ANY($3)`,
+		tenant, pubkey, nips.TimeCapsuleKinds()).Scan(&count, &bytes)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to load capsule usage: %w", err)
+	}
+	return count, bytes, nil
+}
+
+// EnableCapsuleIndex makes the processor index stored time capsules by unlock time.
+// Must be called before events are queued.
+func (ep *EventProcessor) EnableCapsuleIndex(resolver UnlockTimeResolver) {
+	ep.unlockResolver = resolver
+}
+
+// BackfillCapsuleIndex indexes stored capsules of the configured kinds that have no
+// unlock time yet. This migrates capsules stored before the index was enabled or
+// before CAPSULES.KINDS was changed; it is idempotent, so every node may run it.
+// Returns the number of capsules indexed.
+func (ep *EventProcessor) BackfillCapsuleIndex(ctx context.Context) (int, error) {
+	if ep.unlockResolver == nil {
+		return 0, nil
+	}
+
+	indexed := 0
+	var afterTenant, afterID string
+	for {
+		batch, err := ep.db.GetUnindexedCapsules(ctx, nips.TimeCapsuleKinds(), afterTenant, afterID, capsuleBackfillBatch)
+		if err != nil {
+			return indexed, err
+		}
+		for _, tc := range batch {
+			if ep.indexCapsule(tc.Tenant, tc.Event) {
+				indexed++
+			}
+		}
+		if len(batch) < capsuleBackfillBatch {
+			return indexed, nil
+		}
+		afterTenant, afterID = batch[len(batch)-1].Tenant, batch[len(batch)-1].Event.ID
+	}
+}
+
+// indexCapsule resolves and stores the unlock time of a capsule stored on tenant
+// and reports whether it was indexed
+func (ep *EventProcessor) indexCapsule(tenant string, evt nostr.Event) bool {
+	chainHash, round, err := nips.ExtractDrandParameters(&evt)
+	if err != nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(ep.ctx, 10*time.Second)
+	defer cancel()
+
+	unlockAt, err := ep.unlockResolver.UnlockTime(ctx, chainHash, round)
+	if err != nil {
+		logger.Warn("Failed to resolve capsule unlock time",
+			zap.String("event_id", evt.ID),
+			zap.String("chain", chainHash),
+			zap.Int64("round", round),
+			zap.Error(err))
+		return false
+	}
+	if err := ep.db.IndexCapsule(ctx, tenant, evt.ID, chainHash, round, unlockAt.Unix()); err != nil {
+		logger.Warn("Failed to index capsule", zap.String("event_id", evt.ID), zap.Error(err))
+		return false
+	}
+	return true
+}
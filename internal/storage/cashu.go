@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Ledger entry types of Cashu payment credits
+const (
+	LedgerCashu  = "cashu"
+	LedgerNutzap = "nutzap"
+)
+
+// CashuProof is ecash held by the relay after redeeming a Cashu payment
+type CashuProof struct {
+	Mint     string
+	KeysetID string
+	Amount   int64
+	Secret   string
+	C        string
+}
+
+// StoreCashuPayment stores the proofs received for a redeemed Cashu payment and
+// credits the payer's ledger at price in one transaction
+func (db *DB) StoreCashuPayment(ctx context.Context, proofs []CashuProof, entry LedgerEntry, price AdmissionPrice) (LedgerCredit, error) {
+	var result LedgerCredit
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return result, fmt.Errorf("failed to begin cashu transaction: %w", err)
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil && !errors.Is(rollbackErr, pgx.ErrTxClosed) {
+			db.recordError(fmt.Errorf("rollback failed: %w", rollbackErr))
+		}
+	}()
+
+	batch := &pgx.Batch{}
+	for _, p := range proofs {
+		batch.Queue(
+			`INSERT INTO cashu_proofs (secret, mint, keyset_id, amount, c, created_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+			p.Secret, p.Mint, p.KeysetID, p.Amount, p.C, entry.CreatedAt)
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return result, fmt.Errorf("failed to store cashu proofs: %w", err)
+	}
+
+	if result, err = creditLedger(ctx, tx, entry, price); err != nil {
+		return result, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return result, fmt.Errorf("failed to commit cashu payment: %w", err)
+	}
+	return result, nil
+}
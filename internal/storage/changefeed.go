@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/metrics"
+	"github.com/Shugur-Network/relay/internal/relay/nips"
 	nostr "github.com/nbd-wtf/go-nostr"
 	"go.uber.org/zap"
 )
@@ -53,15 +56,44 @@ func (e *EventRowData) ToNostrEvent() (*nostr.Event, error) {
 	return evt, nil
 }
 
-// EventDispatcher manages real-time event distribution across relay instances
+// LiveEvent is an event delivered to the clients subscribed to its tenant
+type LiveEvent struct {
+	Event *nostr.Event
+	// IngestedAt is when this node accepted the event, zero for events accepted
+	// by other nodes
+	IngestedAt time.Time
+	// Raw is the JSON encoding of Event, encoded once for all the clients the
+	// event goes to
+	Raw []byte
+}
+
+// dispatchedEvent is an event to deliver to the clients of tenant
+type dispatchedEvent struct {
+	tenant string
+	LiveEvent
+}
+
+// dispatchClient is a client receiving the live events of its tenant
+type dispatchClient struct {
+	tenant string
+	events chan LiveEvent
+}
+
+// EventDispatcher manages real-time event distribution across relay instances.
+// Clients only receive the events published to their own tenant.
 type EventDispatcher struct {
 	db              *DB
-	clients         map[string]chan *nostr.Event
+	clients         map[string]dispatchClient
 	clientsMu       sync.RWMutex
-	eventBuffer     chan *nostr.Event
+	eventBuffer     chan dispatchedEvent
 	ctx             context.Context
 	cancel          context.CancelFunc
 	changefeedQuery string
+
+	// syncing is set while the cross-node polling loop runs, and lastPoll is
+	// when it last completed a poll, in unix nanoseconds
+	syncing  atomic.Bool
+	lastPoll atomic.Int64
 }
 
 // NewEventDispatcher creates a new event dispatcher for real-time events
@@ -70,8 +102,8 @@ func NewEventDispatcher(db *DB) *EventDispatcher {
 
 	return &EventDispatcher{
 		db:              db,
-		clients:         make(map[string]chan *nostr.Event),
-		eventBuffer:     make(chan *nostr.Event, 1000),
+		clients:         make(map[string]dispatchClient),
+		eventBuffer:     make(chan dispatchedEvent, 1000),
 		ctx:             ctx,
 		cancel:          cancel,
 		changefeedQuery: "", // Using polling instead of sinkless changefeed
@@ -126,8 +158,8 @@ func (ed *EventDispatcher) Stop() {
 
 	// Close all client channels
 	ed.clientsMu.Lock()
-	for clientID, clientChan := range ed.clients {
-		close(clientChan)
+	for clientID, client := range ed.clients {
+		close(client.events)
 		delete(ed.clients, clientID)
 	}
 	ed.clientsMu.Unlock()
@@ -136,15 +168,17 @@ func (ed *EventDispatcher) Stop() {
 	logger.Info("✅ Event dispatcher stopped")
 }
 
-// AddClient registers a new client for event notifications
-func (ed *EventDispatcher) AddClient(clientID string) chan *nostr.Event {
+// AddClient registers a new client for the event notifications of tenant
+func (ed *EventDispatcher) AddClient(clientID, tenant string) chan LiveEvent {
 	ed.clientsMu.Lock()
 	defer ed.clientsMu.Unlock()
 
-	clientChan := make(chan *nostr.Event, 100)
-	ed.clients[clientID] = clientChan
+	clientChan := make(chan LiveEvent, 100)
+	ed.clients[clientID] = dispatchClient{tenant: tenant, events: clientChan}
 
-	logger.Debug("Added event dispatcher client", zap.String("client_id", clientID))
+	logger.Debug("Added event dispatcher client",
+		zap.String("client_id", clientID),
+		zap.String("tenant", tenant))
 	return clientChan
 }
 
@@ -153,13 +187,36 @@ func (ed *EventDispatcher) RemoveClient(clientID string) {
 	ed.clientsMu.Lock()
 	defer ed.clientsMu.Unlock()
 
-	if clientChan, exists := ed.clients[clientID]; exists {
-		close(clientChan)
+	if client, exists := ed.clients[clientID]; exists {
+		close(client.events)
 		delete(ed.clients, clientID)
 		logger.Debug("Removed event dispatcher client", zap.String("client_id", clientID))
 	}
 }
 
+// BroadcastEphemeral fans an ephemeral event out to the local clients of tenant
+// without storing it. Returns false when the broadcast buffer is full and the
+// event was dropped.
+func (ed *EventDispatcher) BroadcastEphemeral(tenant string, evt *nostr.Event) bool {
+	return ed.broadcastEphemeral(tenant, LiveEvent{Event: evt, IngestedAt: time.Now()})
+}
+
+// broadcastEphemeral is BroadcastEphemeral for an event accepted at live.IngestedAt
+func (ed *EventDispatcher) broadcastEphemeral(tenant string, live LiveEvent) bool {
+	evt := live.Event
+	select {
+	case ed.eventBuffer <- dispatchedEvent{tenant: tenant, LiveEvent: live}:
+		metrics.EphemeralEventsRouted.Inc()
+		return true
+	default:
+		metrics.EphemeralEventsDropped.Inc()
+		logger.Warn("Local broadcast buffer full, dropping ephemeral event",
+			zap.String("event_id", evt.ID),
+			zap.Int("kind", evt.Kind))
+		return false
+	}
+}
+
 // GetClientCount returns the number of active clients
 func (ed *EventDispatcher) GetClientCount() int {
 	ed.clientsMu.RLock()
@@ -182,6 +239,8 @@ func (ed *EventDispatcher) verifyChangefeedSupport() error {
 
 // listenToChangefeed starts the cross-node synchronization listener
 func (ed *EventDispatcher) listenToChangefeed() {
+	ed.syncing.Store(true)
+	defer ed.syncing.Store(false)
 	defer func() {
 		if r := recover(); r != nil {
 			logger.Error("Cross-node sync listener crashed", zap.Any("error", r))
@@ -230,7 +289,7 @@ func (ed *EventDispatcher) runChangefeed() error {
 			currentTime := time.Now().Unix()
 
 			query := `
-				SELECT id, pubkey, kind, created_at, content, tags, sig 
+				SELECT id, pubkey, kind, created_at, content, tags, sig, tenant
 				FROM events 
 				WHERE created_at > $1 AND created_at <= $2
 				ORDER BY created_at ASC`
@@ -244,6 +303,7 @@ func (ed *EventDispatcher) runChangefeed() error {
 			newEventsCount := 0
 			for rows.Next() {
 				var eventData EventRowData
+				var tenant string
 				err := rows.Scan(
 					&eventData.ID,
 					&eventData.PubKey,
@@ -252,6 +312,7 @@ func (ed *EventDispatcher) runChangefeed() error {
 					&eventData.Content,
 					&eventData.Tags,
 					&eventData.Sig,
+					&tenant,
 				)
 				if err != nil {
 					logger.Error("Failed to scan event row", zap.Error(err))
@@ -264,6 +325,11 @@ func (ed *EventDispatcher) runChangefeed() error {
 					logger.Warn("Failed to convert event to Nostr event", zap.Error(err))
 					continue
 				}
+				if err := ed.db.hydrateCapsuleBlob(ed.ctx, event); err != nil {
+					logger.Warn("Failed to restore capsule payload", zap.String("event_id", event.ID), zap.Error(err))
+					continue
+				}
+				ed.db.remember(tenant, *event)
 
 				logger.Debug("Found new cross-node event",
 					zap.String("event_id", event.ID),
@@ -273,13 +339,18 @@ func (ed *EventDispatcher) runChangefeed() error {
 
 				// Send to event buffer for processing
 				select {
-				case ed.eventBuffer <- event:
+				case ed.eventBuffer <- dispatchedEvent{tenant: tenant, LiveEvent: LiveEvent{Event: event}}:
 					newEventsCount++
 				default:
 					logger.Warn("Event buffer full, dropping cross-node event", zap.String("event_id", event.ID))
 				}
 			}
 			rows.Close()
+			if err := rows.Err(); err != nil {
+				logger.Error("Failed to read new events", zap.Error(err))
+				continue
+			}
+			ed.lastPoll.Store(time.Now().UnixNano())
 
 			if newEventsCount > 0 {
 				logger.Info("Synchronized cross-node events",
@@ -298,7 +369,7 @@ func (ed *EventDispatcher) processEvents() {
 	ticker := time.NewTicker(10 * time.Millisecond)
 	defer ticker.Stop()
 
-	var batch []*nostr.Event
+	var batch []dispatchedEvent
 
 	for {
 		select {
@@ -315,28 +386,67 @@ func (ed *EventDispatcher) processEvents() {
 	}
 }
 
-// broadcastEvents sends events to all registered clients
-func (ed *EventDispatcher) broadcastEvents(events []*nostr.Event) {
+// broadcastEvents sends events to the registered clients of their tenant
+func (ed *EventDispatcher) broadcastEvents(batch []dispatchedEvent) {
+	// Interactions with deleted events of their tenant aren't delivered when
+	// they are hidden
+	byTenant := make(map[string][]*nostr.Event)
+	if ed.db.hideDeletedInteractions {
+		for _, dispatched := range batch {
+			byTenant[dispatched.tenant] = append(byTenant[dispatched.tenant], dispatched.Event)
+		}
+	}
+	deleted := make(map[string]map[string]bool)
+	for tenant, events := range byTenant {
+		if ids := ed.db.deletedTargets(ed.ctx, tenant, events); len(ids) > 0 {
+			deleted[tenant] = ids
+		}
+	}
+	if len(deleted) > 0 {
+		kept := make([]dispatchedEvent, 0, len(batch))
+		for _, dispatched := range batch {
+			if !interactsWithDeleted(dispatched.Event, deleted[dispatched.tenant]) {
+				kept = append(kept, dispatched)
+			}
+		}
+		batch = kept
+	}
+
+	for i := range batch {
+		if raw, err := batch[i].Event.MarshalJSON(); err == nil {
+			batch[i].Raw = raw
+		}
+	}
+
 	ed.clientsMu.RLock()
 	clientCount := len(ed.clients)
 	ed.clientsMu.RUnlock()
 
-	if len(events) > 0 {
+	if len(batch) > 0 {
 		logger.Info("Broadcasting events to clients",
-			zap.Int("event_count", len(events)),
+			zap.Int("event_count", len(batch)),
 			zap.Int("client_count", clientCount))
 	}
 
 	ed.clientsMu.RLock()
 	defer ed.clientsMu.RUnlock()
 
-	for clientID, clientChan := range ed.clients {
-		for _, event := range events {
+	for clientID, client := range ed.clients {
+		for _, dispatched := range batch {
+			if dispatched.tenant != client.tenant {
+				continue
+			}
+			event := dispatched.Event
 			select {
-			case clientChan <- event:
-				logger.Debug("Event sent to client successfully",
-					zap.String("client_id", clientID),
-					zap.String("event_id", event.ID))
+			case client.events <- dispatched.LiveEvent:
+				if nips.IsEphemeral(event.Kind) {
+					metrics.EphemeralDeliveries.Inc()
+				}
+				if logger.DebugEnabled() {
+					logger.Debug("Event sent to client successfully",
+						zap.String("client_id", clientID),
+						zap.String("event_id", event.ID))
+				}
 			default:
 				// Client buffer is full, drop the event
 				logger.Warn("Dropped event for client - buffer full",
@@ -0,0 +1,324 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/relay/nips"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+const (
+	// hllPrecision gives sketches 2^12 registers, a standard error of about 1.6%
+	hllPrecision = 12
+	hllRegisters = 1 << hllPrecision
+	// hllSparseMax is how many registers a sketch keeps in a map before it
+	// switches to an array of all of them
+	hllSparseMax = hllRegisters / 16
+)
+
+// hllSketch is a HyperLogLog sketch of distinct events. Sketches of few events
+// keep only their set registers.
+type hllSketch struct {
+	sparse map[uint16]uint8
+	dense  []uint8
+}
+
+func newHLLSketch() *hllSketch {
+	return &hllSketch{sparse: make(map[uint16]uint8)}
+}
+
+// add records the event hashed to h
+func (s *hllSketch) add(h uint64) {
+	idx := uint16(h >> (64 - hllPrecision))
+	rank := uint8(bits.LeadingZeros64(h<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if s.dense != nil {
+		if rank > s.dense[idx] {
+			s.dense[idx] = rank
+		}
+		return
+	}
+	if rank <= s.sparse[idx] {
+		return
+	}
+	s.sparse[idx] = rank
+	if len(s.sparse) > hllSparseMax {
+		s.dense = make([]uint8, hllRegisters)
+		for i, r := range s.sparse {
+			s.dense[i] = r
+		}
+		s.sparse = nil
+	}
+}
+
+// mergeInto raises the registers in regs to those of s
+func (s *hllSketch) mergeInto(regs []uint8) {
+	if s.dense != nil {
+		for i, r := range s.dense {
+			regs[i] = max(regs[i], r)
+		}
+		return
+	}
+	for i, r := range s.sparse {
+		regs[i] = max(regs[i], r)
+	}
+}
+
+// hllEstimate estimates the distinct events recorded in regs
+func hllEstimate(regs []uint8) float64 {
+	m := float64(len(regs))
+	sum, zeros := 0.0, 0
+	for _, r := range regs {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// Linear counting is more accurate for small counts
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return estimate
+}
+
+// sketchHash hashes evt for the sketches: by id, except that replaceable and
+// addressable events hash by coordinate, since only their newest version is kept
+func sketchHash(evt nostr.Event) uint64 {
+	if nips.IsReplaceable(evt.Kind) || nips.IsParameterizedReplaceableKind(evt.Kind) {
+		coordinate := fmt.Sprintf("%d:%s:%s", evt.Kind, evt.PubKey, evt.Tags.GetD())
+		sum := sha256.Sum256([]byte(coordinate))
+		return binary.BigEndian.Uint64(sum[:8])
+	}
+	// Event ids are already sha256 hashes
+	if id, err := hex.DecodeString(evt.ID); err == nil && len(id) >= 8 {
+		return binary.BigEndian.Uint64(id[:8])
+	}
+	sum := sha256.Sum256([]byte(evt.ID))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// sketchSet holds a sketch for every kind, and for each author with many events
+type sketchSet struct {
+	kinds   map[int]*hllSketch
+	authors map[string]*hllSketch
+}
+
+func newSketchSet(authors map[string]*hllSketch) *sketchSet {
+	return &sketchSet{kinds: make(map[int]*hllSketch), authors: authors}
+}
+
+func (s *sketchSet) add(evt nostr.Event, h uint64) {
+	kind := s.kinds[evt.Kind]
+	if kind == nil {
+		kind = newHLLSketch()
+		s.kinds[evt.Kind] = kind
+	}
+	kind.add(h)
+	if author := s.authors[evt.PubKey]; author != nil {
+		author.add(h)
+	}
+}
+
+// countSketches answers large COUNTs of the main relay by kind or by author
+// from HyperLogLog sketches of the stored events. Deleted events stay in the
+// sketches until they are rebuilt.
+type countSketches struct {
+	mu sync.Mutex
+	// threshold is the estimate from which counts are answered approximately
+	threshold int64
+	// current is nil until the sketches were first built
+	current *sketchSet
+	// building is the set a rebuild is filling, nil when none runs
+	building *sketchSet
+}
+
+// EnableCountSketches answers COUNTs by kind or by author whose count is
+// estimated at threshold or more from HyperLogLog sketches, flagged approximate.
+// Smaller counts, and any until the sketches are built, stay exact. Must be
+// called before events are stored.
+func (db *DB) EnableCountSketches(threshold int64) {
+	db.counts = &countSketches{threshold: threshold}
+}
+
+// add records a newly stored event of the main relay
+func (c *countSketches) add(evt nostr.Event) {
+	if c == nil {
+		return
+	}
+	h := sketchHash(evt)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.current != nil {
+		c.current.add(evt, h)
+	}
+	if c.building != nil {
+		c.building.add(evt, h)
+	}
+}
+
+// estimate returns the estimated count of the events f matches, and false when
+// f isn't a plain count by kinds or by authors the sketches cover
+func (c *countSketches) estimate(f nostr.Filter) (int64, bool) {
+	if c == nil || len(f.IDs) > 0 || len(f.Tags) > 0 || f.Since != nil || f.Until != nil || f.Search != "" {
+		return 0, false
+	}
+	if (len(f.Kinds) > 0) == (len(f.Authors) > 0) {
+		return 0, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.current == nil {
+		return 0, false
+	}
+	regs := make([]uint8, hllRegisters)
+	for _, kind := range f.Kinds {
+		// Kinds without a sketch have no stored events
+		if s := c.current.kinds[kind]; s != nil {
+			s.mergeInto(regs)
+		}
+	}
+	for _, author := range f.Authors {
+		s := c.current.authors[author]
+		if s == nil {
+			return 0, false
+		}
+		s.mergeInto(regs)
+	}
+	return int64(math.Round(hllEstimate(regs))), true
+}
+
+// ServeEventCount counts the events of tenant matching filter like
+// GetEventCount, leaving out the events of excludeKinds, unless the count
+// sketches estimate it at the approximate count threshold or more; it then
+// returns the estimate and reports it approximate. Sketches can't leave kinds
+// out, so filters without kinds are counted exactly when kinds are excluded.
+func (db *DB) ServeEventCount(ctx context.Context, tenant string, filter nostr.Filter, excludeKinds []int) (int64, bool, error) {
+	if tenant == DefaultTenant && (len(excludeKinds) == 0 || len(filter.Kinds) > 0) {
+		if estimate, ok := db.counts.estimate(filter); ok && estimate >= db.counts.threshold {
+			return estimate, true, nil
+		}
+	}
+	count, err := db.countEvents(ctx, tenant, filter, excludeKinds)
+	return count, false, err
+}
+
+// BuildCountSketches rebuilds the count sketches from the events of the main
+// relay, dropping the deleted events they still count. Authors get a sketch
+// once they have as many events as the approximate count threshold.
+func (db *DB) BuildCountSketches(ctx context.Context) error {
+	c := db.counts
+	if c == nil {
+		return nil
+	}
+	if err := db.allow(); err != nil {
+		return err
+	}
+
+	rows, err := db.Pool.Query(ctx,
+		`SELECT pubkey FROM events WHERE tenant = $1 GROUP BY pubkey HAVING count(*) >= $2`,
+		DefaultTenant, c.threshold)
+	if err != nil {
+		return fmt.Errorf("failed to find prolific authors: %w", err)
+	}
+	authors := make(map[string]*hllSketch)
+	for rows.Next() {
+		var pubkey string
+		if err := rows.Scan(&pubkey); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan author: %w", err)
+		}
+		authors[pubkey] = newHLLSketch()
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to find prolific authors: %w", err)
+	}
+
+	// Events stored while the table is read are added as they come
+	set := newSketchSet(authors)
+	c.mu.Lock()
+	c.building = set
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.building = nil
+		c.mu.Unlock()
+	}()
+
+	rows, err = db.Pool.Query(ctx,
+		`SELECT id, pubkey, kind, CASE WHEN kind >= 30000 AND kind < 40000 THEN tags ELSE '[]'::JSONB END
+		 FROM events WHERE tenant = $1`,
+		DefaultTenant)
+	if err != nil {
+		return fmt.Errorf("failed to read events: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var evt nostr.Event
+		if err := rows.Scan(&evt.ID, &evt.PubKey, &evt.Kind, &evt.Tags); err != nil {
+			return fmt.Errorf("failed to scan event: %w", err)
+		}
+		h := sketchHash(evt)
+		c.mu.Lock()
+		set.add(evt, h)
+		c.mu.Unlock()
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read events: %w", err)
+	}
+
+	c.mu.Lock()
+	c.current = set
+	c.mu.Unlock()
+	logger.Info("Built count sketches",
+		zap.Int("kinds", len(set.kinds)),
+		zap.Int("authors", len(set.authors)))
+	return nil
+}
+
+// StartCountSketches builds the count sketches in the background, then
+// rebuilds them every interval (0 = never)
+func (db *DB) StartCountSketches(ctx context.Context, interval time.Duration) {
+	if db.counts == nil {
+		return
+	}
+	go func() {
+		for {
+			if err := db.BuildCountSketches(ctx); err != nil && ctx.Err() == nil {
+				logger.Warn("Failed to build count sketches", zap.Error(err))
+			}
+			built := db.counts.built()
+			if interval <= 0 && built {
+				return
+			}
+			wait := interval
+			if !built || wait <= 0 {
+				// Retry a failed first build soon
+				wait = time.Minute
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+}
+
+// built reports whether the sketches were built at least once
+func (c *countSketches) built() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.current != nil
+}
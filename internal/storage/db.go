@@ -3,7 +3,6 @@ package storage
 import (
 	"context"
 	"fmt"
-	"strings"
 	"sync"
 	"time"
 
@@ -12,7 +11,6 @@ import (
 	"github.com/Shugur-Network/relay/internal/metrics"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/willf/bloom"
 
 	"go.uber.org/zap"
 )
@@ -31,13 +29,41 @@ const (
 // DB represents the CockroachDB connection
 type DB struct {
 	Pool            *pgxpool.Pool
-	Bloom           *bloom.BloomFilter
+	Bloom           *DedupFilter
 	eventDispatcher *EventDispatcher
 	state           DBState
 	stateMu         sync.RWMutex
 	errors          chan error
 	errorCount      int32
 	errorCountMu    sync.RWMutex
+
+	// blobThreshold offloads time capsule payloads of at least this many bytes to
+	// capsule_blobs (0 keeps every payload inline)
+	blobThreshold int
+
+	// queries bounds concurrent reads, nil when they are unbounded
+	queries *queryLimiter
+
+	// breaker fails storage operations at once while the database is down, nil
+	// when disabled
+	breaker *circuitBreaker
+
+	// recent answers REQs for the latest events from memory, nil when disabled
+	recent *recentCache
+
+	// live answers REQs starting within the live window from memory, nil when disabled
+	live *liveRing
+
+	// counts answers large COUNTs approximately, nil when disabled
+	counts *countSketches
+
+	// hideDeletedInteractions drops reactions, reposts and replies to deleted
+	// events from reads and live delivery
+	hideDeletedInteractions bool
+
+	// spamReports is how many pubkeys must report an event or its author as
+	// spam for searches to leave it out, 0 to keep everything
+	spamReports int
 }
 
 // createPoolBasedOnLoad creates optimized pool configuration based on expected WebSocket load
@@ -108,7 +134,7 @@ func InitDB(ctx context.Context, dbURI string, maxWSConnections int) (*DB, error
 			// Test the actual connection
 			if err = pool.Ping(ctx); err == nil {
 				db.Pool = pool
-				db.Bloom = bloom.NewWithEstimates(10_000_000, 0.01) // 10M entries with 1% false positive rate
+				db.Bloom = NewDedupFilter(DefaultBloomCapacity, DefaultBloomFalsePositiveRate)
 				db.state = DBStateConnected
 
 				// Log pool configuration for verification
@@ -232,15 +258,34 @@ func (db *DB) ExecuteCommand(ctx context.Context, query string, args ...interfac
 	return err
 }
 
+// SizeBloomFilter replaces the Bloom filter with an empty one sized for capacity
+// event IDs at falsePositiveRate, to be filled by RebuildBloomFilter
+func (db *DB) SizeBloomFilter(capacity uint, falsePositiveRate float64) {
+	db.Bloom = NewDedupFilter(capacity, falsePositiveRate)
+}
+
 // RebuildBloomFilter fetches all event IDs from CockroachDB and updates the Bloom filter.
 func (db *DB) RebuildBloomFilter(ctx context.Context) error {
+	return db.ResizeBloomFilter(ctx, db.Bloom.Capacity())
+}
+
+// ResizeBloomFilter rebuilds the Bloom filter sized for capacity event IDs from
+// the stored events. The current filter keeps answering until the new one is
+// filled in, and events stored meanwhile are added to both.
+func (db *DB) ResizeBloomFilter(ctx context.Context, capacity uint) error {
 	if !db.isConnected() {
 		return fmt.Errorf("database is not connected")
 	}
 
-	logger.Info("Rebuilding Bloom filter from database...")
+	db.Bloom.rebuilding.Lock()
+	defer db.Bloom.rebuilding.Unlock()
+	next := db.Bloom.startRebuild(capacity)
+	complete := false
+	defer func() { db.Bloom.endRebuild(complete) }()
+
+	logger.Info("Rebuilding Bloom filter from database...", zap.Uint("capacity", capacity))
 
-	query := `SELECT id FROM events`
+	query := `SELECT tenant, id FROM events`
 	rows, err := db.Pool.Query(ctx, query)
 	if err != nil {
 		db.recordError(fmt.Errorf("failed to fetch event IDs: %w", err))
@@ -250,18 +295,17 @@ func (db *DB) RebuildBloomFilter(ctx context.Context) error {
 	defer rows.Close()
 
 	count := 0
-	db.Bloom.ClearAll()
 
 	for rows.Next() {
-		var eventID string
-		if err := rows.Scan(&eventID); err != nil {
+		var tenant, eventID string
+		if err := rows.Scan(&tenant, &eventID); err != nil {
 			db.recordError(fmt.Errorf("failed to scan event ID: %w", err))
 			logger.Debug("Failed to scan event ID",
 				zap.Error(err))
 			continue
 		}
 
-		db.Bloom.AddString(eventID)
+		next.AddString(DedupKey(tenant, eventID))
 		count++
 
 		if count%100000 == 0 {
@@ -276,8 +320,10 @@ func (db *DB) RebuildBloomFilter(ctx context.Context) error {
 		return err
 	}
 
+	complete = true
 	logger.Info("Bloom filter rebuilt successfully",
-		zap.Int("total_events", count))
+		zap.Int("total_events", count),
+		zap.Uint("capacity", capacity))
 	metrics.DBOperations.WithLabelValues("bloom_filter_rebuild_success").Inc()
 	return nil
 }
@@ -306,33 +352,6 @@ func (db *DB) recordError(err error) {
 	}
 }
 
-// Add this helper function to your DB struct
-func (db *DB) executeWithRetry(ctx context.Context, f func(context.Context) error) error {
-	retries := 3
-	var lastErr error
-
-	for i := 0; i < retries; i++ {
-		err := f(ctx)
-		if err == nil {
-			return nil
-		}
-
-		// Check if error is a timeout or deadlock (retryable)
-		if strings.Contains(err.Error(), "statement timeout") ||
-			strings.Contains(err.Error(), "deadlock") {
-			lastErr = err
-			// Exponential backoff
-			time.Sleep(time.Duration(1<<i) * 100 * time.Millisecond)
-			continue
-		}
-
-		// Not a retryable error
-		return err
-	}
-
-	return fmt.Errorf("operation failed after %d retries: %w", retries, lastErr)
-}
-
 // SetEventDispatcher sets the event dispatcher reference for immediate local broadcasting
 func (db *DB) SetEventDispatcher(ed *EventDispatcher) {
 	db.eventDispatcher = ed
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/relay/nips"
+	"github.com/jackc/pgx/v5"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+// EnableDeletedInteractionFilter hides reactions, reposts and replies to events
+// removed by NIP-09 deletion requests from reads and live delivery. NIP-09 leaves
+// it to relays whether such interactions stay visible.
+func (db *DB) EnableDeletedInteractionFilter() {
+	db.hideDeletedInteractions = true
+}
+
+// deleteReturningIDs runs a DELETE ... RETURNING id and returns the deleted ids
+func deleteReturningIDs(ctx context.Context, tx pgx.Tx, query string, args ...interface{}) ([]string, error) {
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// recordDeletedIDs remembers the ids of the events of tenant del deleted
+func recordDeletedIDs(ctx context.Context, tx pgx.Tx, tenant string, ids []string, del nostr.Event) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(ctx,
+		`UPSERT INTO deleted_events (tenant, id, deletion_id, deleted_at)
+		 SELECT $4, id, $2, $3 FROM unnest($1::STRING[]) AS id`,
+		ids, del.ID, del.CreatedAt.Time().Unix(), tenant)
+	if err != nil {
+		return fmt.Errorf("failed to record deleted events: %w", err)
+	}
+	return nil
+}
+
+// WasDeleted reports whether evt, to be stored on tenant, was removed there by
+// a NIP-09 deletion request of its author: its id was deleted or is named by a
+// stored deletion request, or its address is named by a deletion request no
+// older than it. Republishing such an event must not bring it back.
+func (db *DB) WasDeleted(ctx context.Context, tenant string, evt nostr.Event) (bool, error) {
+	eTag, _ := json.Marshal([][]string{{"e", evt.ID}})
+	query := `EXISTS (SELECT 1 FROM deleted_events WHERE tenant = $1 AND id = $2)
+		OR EXISTS (SELECT 1 FROM events WHERE tenant = $1 AND kind = $3 AND pubkey = $4 AND tags @> $5)`
+	args := []interface{}{tenant, evt.ID, nostr.KindDeletion, evt.PubKey, string(eTag)}
+
+	var addr string
+	switch {
+	case nips.IsReplaceable(evt.Kind):
+		addr = fmt.Sprintf("%d:%s:", evt.Kind, evt.PubKey)
+	case nips.IsParameterizedReplaceableKind(evt.Kind):
+		addr = fmt.Sprintf("%d:%s:%s", evt.Kind, evt.PubKey, nips.GetDTagValue(&evt))
+	}
+	if addr != "" {
+		aTag, _ := json.Marshal([][]string{{"a", addr}})
+		query += `
+		OR EXISTS (SELECT 1 FROM events WHERE tenant = $1 AND kind = $3 AND pubkey = $4 AND tags @> $6 AND created_at >= $7)`
+		args = append(args, string(aTag), int64(evt.CreatedAt))
+	}
+
+	var deleted bool
+	if err := db.Pool.QueryRow(ctx, `SELECT `+query, args...).Scan(&deleted); err != nil {
+		return false, fmt.Errorf("failed to check deletions: %w", err)
+	}
+	return deleted, nil
+}
+
+// deletedAmong returns which of the ids of tenant's events were removed by
+// deletion requests
+func (db *DB) deletedAmong(ctx context.Context, tenant string, ids []string) (map[string]bool, error) {
+	rows, err := db.Pool.Query(ctx, `SELECT id FROM deleted_events WHERE tenant = $1 AND id = ANY($2)`, tenant, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deleted events: %w", err)
+	}
+	defer rows.Close()
+
+	deleted := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan deleted event: %w", err)
+		}
+		deleted[id] = true
+	}
+	return deleted, rows.Err()
+}
+
+// deletedTargets returns which of the events of tenant events interact with
+// were deleted, nil when none were or the filter is disabled. Lookup failures
+// are logged and leave the events visible.
+func (db *DB) deletedTargets(ctx context.Context, tenant string, events []*nostr.Event) map[string]bool {
+	if !db.hideDeletedInteractions {
+		return nil
+	}
+	var targets []string
+	for _, evt := range events {
+		targets = append(targets, nips.InteractionTargets(evt)...)
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	deleted, err := db.deletedAmong(ctx, tenant, targets)
+	if err != nil {
+		logger.Warn("Failed to look up deleted interaction targets", zap.Error(err))
+		return nil
+	}
+	return deleted
+}
+
+// interactsWithDeleted reports whether evt reacts to, reposts or replies to one
+// of the deleted events
+func interactsWithDeleted(evt *nostr.Event, deleted map[string]bool) bool {
+	for _, id := range nips.InteractionTargets(evt) {
+		if deleted[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// WithoutDeletedInteractions returns events of tenant without the reactions,
+// reposts and replies to its deleted events, when they are hidden. events is
+// left untouched.
+func (db *DB) WithoutDeletedInteractions(ctx context.Context, tenant string, events []nostr.Event) []nostr.Event {
+	if !db.hideDeletedInteractions || len(events) == 0 {
+		return events
+	}
+	ptrs := make([]*nostr.Event, len(events))
+	for i := range events {
+		ptrs[i] = &events[i]
+	}
+	deleted := db.deletedTargets(ctx, tenant, ptrs)
+	if len(deleted) == 0 {
+		return events
+	}
+
+	kept := make([]nostr.Event, 0, len(events))
+	for i := range events {
+		if !interactsWithDeleted(&events[i], deleted) {
+			kept = append(kept, events[i])
+		}
+	}
+	return kept
+}
@@ -2,10 +2,12 @@ package storage
 
 import (
 	"context"
-	"runtime"
+	"errors"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/Shugur-Network/relay/internal/constants"
 	"github.com/Shugur-Network/relay/internal/logger"
 	"github.com/Shugur-Network/relay/internal/metrics"
 	"github.com/Shugur-Network/relay/internal/relay/nips"
@@ -13,76 +15,150 @@ import (
 	"go.uber.org/zap"
 )
 
+// queuedEvent is an event waiting for a worker, with the tenant it was published to
+type queuedEvent struct {
+	tenant   string
+	event    nostr.Event
+	queuedAt time.Time
+}
+
 // EventProcessor manages event processing with a worker pool
 type EventProcessor struct {
-	eventChan   chan nostr.Event
-	db          *DB
-	workerCount int
-	ctx         context.Context
-	cancel      context.CancelFunc
+	eventChan chan queuedEvent
+	db        *DB
+	ctx       context.Context
+	cancel    context.CancelFunc
+
+	// limits bounds the workers and queue, which scale between them
+	limits ProcessorLimits
+	// workers is the number of running workers
+	workers atomic.Int64
+	// retire stops one idle worker per receive
+	retire chan struct{}
+	// admitted is how many queued events are currently accepted
+	admitted atomic.Int64
+	// writeLatency is the moving average of the time to store an event, in ns
+	writeLatency atomic.Int64
+	// saturation numbers the current episode of dropping events, 0 when none
+	saturation  atomic.Uint64
+	saturations atomic.Uint64
+
+	// recordReceipts stores the time each new event was accepted (storage attestations)
+	recordReceipts bool
+	// unlockResolver indexes stored time capsules by unlock time when set
+	unlockResolver UnlockTimeResolver
+	// trackShares accounts witness shares of time capsules (kinds 11991/11992)
+	trackShares bool
+	// paymentHandlers credit stored payment events to the payment ledger, by kind
+	paymentHandlers map[int]PaymentEventHandler
+	// tenantMeter accounts new events to their virtual relay when set
+	tenantMeter TenantMeter
+	// sink delivers new events to an external system when set
+	sink EventSink
+	// domains verifies the NIP-05 identifiers of new profiles when set
+	domains *domainVerifier
+	// zaps checks the signers of new zap receipts and indexes them when set
+	zaps *zapVerifier
+	// queueReports records new NIP-56 reports of the main relay for moderation
+	queueReports bool
 }
 
-// NewEventProcessor creates a new event processor
-func NewEventProcessor(ctx context.Context, db *DB, bufferSize int) *EventProcessor {
+// NewEventProcessor creates a new event processor that scales its workers and
+// admitted queue within limits
+func NewEventProcessor(ctx context.Context, db *DB, limits ProcessorLimits) *EventProcessor {
 	ctx, cancel := context.WithCancel(ctx)
-
-	// Use CPU count to determine worker count
-	workerCount := runtime.NumCPU() * 2
+	limits = limits.withDefaults()
 
 	ep := &EventProcessor{
-		eventChan:   make(chan nostr.Event, bufferSize),
-		db:          db,
-		workerCount: workerCount,
-		ctx:         ctx,
-		cancel:      cancel,
+		eventChan: make(chan queuedEvent, limits.QueueSize),
+		db:        db,
+		ctx:       ctx,
+		cancel:    cancel,
+		limits:    limits,
+		retire:    make(chan struct{}),
 	}
+	ep.admitted.Store(int64(limits.QueueSize))
 
-	// Start worker goroutines
-	for i := 0; i < workerCount; i++ {
-		go ep.processEvents(ctx)
-	}
+	// Start the minimum of workers, more are added as the queue builds up
+	ep.addWorkers(limits.MinWorkers)
+	go ep.autoscale()
 
 	return ep
 }
 
+// EnableReceipts makes the processor record when each new event was accepted.
+// Must be called before events are queued.
+func (ep *EventProcessor) EnableReceipts() {
+	ep.recordReceipts = true
+}
+
+// EnablePaymentEvents makes the processor hand stored events of kind to handler.
+// Must be called before events are queued.
+func (ep *EventProcessor) EnablePaymentEvents(kind int, handler PaymentEventHandler) {
+	if ep.paymentHandlers == nil {
+		ep.paymentHandlers = make(map[int]PaymentEventHandler)
+	}
+	ep.paymentHandlers[kind] = handler
+}
+
 // QueueDeletion is called by the validator AFTER it has verified
 // that the deleter has the right to try.  The function will:
 //  1. delete all owned referenced events (same pubkey)
 //  2. store the deletion event itself
 //
 // It reuses the same retry / back‑pressure mechanism.
-func (ep *EventProcessor) QueueDeletion(evt nostr.Event) bool {
-	select {
-	case ep.eventChan <- evt:
+func (ep *EventProcessor) QueueDeletion(tenant string, evt nostr.Event) bool {
+	if ep.admit(tenant, evt) {
 		return true
-	default:
-		logger.Warn("Deletion queue full, dropping event",
-			zap.String("event_id", evt.ID),
-			zap.String("pubkey", evt.PubKey),
-			zap.Int("kind", evt.Kind))
-		return false
 	}
+	logger.Warn("Deletion queue full, dropping event",
+		zap.String("event_id", evt.ID),
+		zap.String("pubkey", evt.PubKey),
+		zap.Int("kind", evt.Kind))
+	return false
 }
 
-// QueueEvent adds an event to processing queue with non-blocking behavior
-func (ep *EventProcessor) QueueEvent(evt nostr.Event) bool {
-	// Check bloom filter first to avoid processing duplicates
-	if ep.db.Bloom.Test([]byte(evt.ID)) {
+// QueueEvent adds an event published to tenant to the processing queue with
+// non-blocking behavior
+func (ep *EventProcessor) QueueEvent(tenant string, evt nostr.Event) bool {
+	// Skip events certainly stored already; the insert settles the others
+	if ep.db.Bloom.Known(DedupKey(tenant, evt.ID)) {
 		return true // Already processed, consider it "queued"
 	}
 
 	// Try to add to queue non-blocking
-	select {
-	case ep.eventChan <- evt:
+	if ep.admit(tenant, evt) {
 		return true
-	default:
-		// Queue full - this is backpressure
-		logger.Warn("Event processing queue full, dropping event",
-			zap.String("event_id", evt.ID),
-			zap.String("pubkey", evt.PubKey),
-			zap.Int("kind", evt.Kind))
-		return false
 	}
+	// Queue full - this is backpressure
+	logger.Warn("Event processing queue full, dropping event",
+		zap.String("event_id", evt.ID),
+		zap.String("pubkey", evt.PubKey),
+		zap.Int("kind", evt.Kind))
+	return false
+}
+
+// admit queues evt unless as many events as currently admitted are waiting
+func (ep *EventProcessor) admit(tenant string, evt nostr.Event) bool {
+	if int64(len(ep.eventChan)) < ep.admitted.Load() {
+		select {
+		case ep.eventChan <- queuedEvent{tenant: tenant, event: evt, queuedAt: time.Now()}:
+			return true
+		default:
+		}
+	}
+
+	metrics.EventQueueDropped.Inc()
+	if ep.saturation.Load() == 0 {
+		episode := ep.saturations.Add(1)
+		if ep.saturation.CompareAndSwap(0, episode) {
+			metrics.EventQueueSaturations.Inc()
+			logger.Warn("Event queue saturated, dropping events",
+				zap.Int("queue_depth", len(ep.eventChan)),
+				zap.Int64("admitted", ep.admitted.Load()))
+		}
+	}
+	return false
 }
 
 // processEvents handles database insertion with retries
@@ -91,104 +167,151 @@ func (ep *EventProcessor) processEvents(ctx context.Context) {
 		select {
 		case <-ep.ctx.Done():
 			return
-		case evt, ok := <-ep.eventChan:
+		case <-ep.retire:
+			return
+		case queued, ok := <-ep.eventChan:
 			if !ok {
 				// Channel closed
 				return
 			}
 
-			// Process with retries and backoff
-			var err error
-			for attempt := 0; attempt < 3; attempt++ {
-				if attempt > 0 {
-					// Exponential backoff
-					backoff := time.Duration(1<<attempt) * 50 * time.Millisecond
-					time.Sleep(backoff)
+			ep.storeEvent(ctx, queued.tenant, queued.event, queued.queuedAt)
+		}
+	}
+}
+
+// StoreEventSync stores evt directly, bypassing the processing queue, and returns
+// once it is committed. Used for durable writes where OK must not be sent before commit.
+func (ep *EventProcessor) StoreEventSync(ctx context.Context, tenant string, evt nostr.Event) error {
+	return ep.storeEvent(ctx, tenant, evt, time.Now())
+}
+
+// storeEvent inserts one event, accepted at ingestedAt, with retries and runs the
+// post-insert hooks
+func (ep *EventProcessor) storeEvent(ctx context.Context, tenant string, evt nostr.Event, ingestedAt time.Time) error {
+	// Ephemeral events (NIP-16) are never stored, only fanned out
+	if nips.IsEphemeral(evt.Kind) {
+		if ep.db.eventDispatcher != nil {
+			ep.db.eventDispatcher.broadcastEphemeral(tenant, LiveEvent{Event: &evt, IngestedAt: ingestedAt})
+		}
+		return nil
+	}
+
+	// Process with retries and backoff
+	defer ep.observeWrite(time.Now())
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		if attempt > 0 {
+			// Exponential backoff
+			backoff := time.Duration(1<<attempt) * 50 * time.Millisecond
+			time.Sleep(backoff)
+		}
+
+		// Retrying is pointless while the database is known to be down
+		if err = ep.db.allow(); err != nil {
+			break
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+		switch {
+		case nips.IsDeletionEvent(evt):
+			err = ep.db.persistDeletion(ctx, tenant, evt)
+		case nips.IsReplaceable(evt.Kind):
+			err = ep.db.InsertReplaceableEvent(ctx, tenant, evt)
+		case nips.IsAddressable(evt):
+			err = ep.db.InsertAddressableEvent(ctx, tenant, evt)
+		default:
+			err = ep.db.InsertEvent(ctx, tenant, evt)
+		}
+		cancel()
+		ep.db.observe(err)
+
+		// A stale replaceable version is settled like a duplicate: nothing to store or broadcast
+		if err == nil || strings.Contains(err.Error(), "duplicate key") || errors.Is(err, ErrDuplicateEvent) || errors.Is(err, ErrStaleReplaceable) {
+			// Only add to bloom filter after successful insertion
+			ep.db.Bloom.AddString(DedupKey(tenant, evt.ID))
+
+			// Increment the stored events metric only for new events
+			if err == nil {
+				metrics.EventsStored.Inc()
+				ep.db.remember(tenant, evt)
+
+				if ep.recordReceipts {
+					ep.recordReceipt(tenant, evt.ID)
+				}
+				if ep.tenantMeter != nil {
+					ep.tenantMeter.EventStored(tenant)
+				}
+				if ep.sink != nil {
+					ep.sink.EventStored(tenant, evt)
+				}
+				ep.indexSearch(tenant, evt)
+				if evt.Kind == nostr.KindZap && ep.zaps != nil {
+					ep.indexZapReceipt(tenant, evt)
+				}
+				if ep.queueReports && evt.Kind == nostr.KindReporting && tenant == DefaultTenant {
+					ep.queueReport(evt)
+				}
+				if nips.IsTimeCapsuleKind(evt.Kind) {
+					metrics.CapsulesStored.Inc()
+					if ep.unlockResolver != nil {
+						go ep.indexCapsule(tenant, evt)
+					}
+				}
+				if ep.trackShares && (evt.Kind == constants.KindUnlockShare || evt.Kind == constants.KindShareDistribution) {
+					ep.recordCapsuleShare(tenant, evt)
+				}
+				if handler, ok := ep.paymentHandlers[evt.Kind]; ok {
+					go handler.HandlePaymentEvent(ep.ctx, evt)
 				}
 
-				ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
-				switch {
-				case nips.IsEphemeral(evt.Kind):
-					// Ephemeral events (NIP-16) should not be stored
-					logger.Debug("Skipping storage of ephemeral event",
+				// Broadcast event immediately to local clients for real-time streaming
+				// This ensures same-node clients get events instantly without waiting for changefeed
+				if ep.db.eventDispatcher != nil {
+					logger.Debug("Broadcasting event to local clients",
 						zap.String("event_id", evt.ID),
+						zap.String("pubkey", evt.PubKey),
 						zap.Int("kind", evt.Kind))
-					err = nil // No error, just don't store
-				case nips.IsDeletionEvent(evt):
-					err = ep.db.persistDeletion(ctx, evt)
-				case nips.IsReplaceable(evt.Kind):
-					err = ep.db.InsertReplaceableEvent(ctx, evt)
-				case nips.IsAddressable(evt):
-					err = ep.db.InsertAddressableEvent(ctx, evt)
-				default:
-					err = ep.db.InsertEvent(ctx, evt)
-				}
-				cancel()
-
-				if err == nil || strings.Contains(err.Error(), "duplicate key") {
-					// For ephemeral events, skip bloom filter and metrics but still broadcast
-					if nips.IsEphemeral(evt.Kind) {
-						// Broadcast ephemeral event immediately to local clients for real-time streaming
-						if ep.db.eventDispatcher != nil {
-							logger.Debug("Broadcasting ephemeral event to local clients",
-								zap.String("event_id", evt.ID),
-								zap.String("pubkey", evt.PubKey),
-								zap.Int("kind", evt.Kind))
-
-							// Send event to local event dispatcher for immediate broadcasting
-							select {
-							case ep.db.eventDispatcher.eventBuffer <- &evt:
-								logger.Debug("Ephemeral event added to local broadcast buffer", zap.String("event_id", evt.ID))
-							default:
-								logger.Warn("Local broadcast buffer full, ephemeral event may not stream immediately", zap.String("event_id", evt.ID))
-							}
-						}
-					} else {
-						// Only add to bloom filter after successful insertion for non-ephemeral events
-						ep.db.Bloom.AddString(evt.ID)
-
-						// Increment the stored events metric only for new events
-						if err == nil {
-							metrics.EventsStored.Inc()
-
-							// Broadcast event immediately to local clients for real-time streaming
-							// This ensures same-node clients get events instantly without waiting for changefeed
-							if ep.db.eventDispatcher != nil {
-								logger.Debug("Broadcasting event to local clients",
-									zap.String("event_id", evt.ID),
-									zap.String("pubkey", evt.PubKey),
-									zap.Int("kind", evt.Kind))
-
-								// Send event to local event dispatcher for immediate broadcasting
-								select {
-								case ep.db.eventDispatcher.eventBuffer <- &evt:
-									logger.Debug("Event added to local broadcast buffer", zap.String("event_id", evt.ID))
-								default:
-									logger.Warn("Local broadcast buffer full, event may not stream immediately", zap.String("event_id", evt.ID))
-								}
-							}
-						}
-					}
 
-					err = nil
-					break
+					// Send event to local event dispatcher for immediate broadcasting
+					select {
+					case ep.db.eventDispatcher.eventBuffer <- dispatchedEvent{tenant: tenant, LiveEvent: LiveEvent{Event: &evt, IngestedAt: ingestedAt}}:
+						logger.Debug("Event added to local broadcast buffer", zap.String("event_id", evt.ID))
+					default:
+						logger.Warn("Local broadcast buffer full, event may not stream immediately", zap.String("event_id", evt.ID))
+					}
 				}
 			}
 
-			if err != nil {
-				logger.Error("Failed to insert event after retries",
-					zap.String("event_id", evt.ID),
-					zap.String("pubkey", evt.PubKey),
-					zap.Int("kind", evt.Kind),
-					zap.Error(err))
-			} else {
-				logger.Debug("Event successfully processed",
-					zap.String("event_id", evt.ID),
-					zap.String("pubkey", evt.PubKey),
-					zap.Int("kind", evt.Kind))
-			}
+			err = nil
+			break
 		}
 	}
+
+	if err != nil {
+		logger.Error("Failed to insert event after retries",
+			zap.String("event_id", evt.ID),
+			zap.String("pubkey", evt.PubKey),
+			zap.Int("kind", evt.Kind),
+			zap.Error(err))
+	} else {
+		logger.Debug("Event successfully processed",
+			zap.String("event_id", evt.ID),
+			zap.String("pubkey", evt.PubKey),
+			zap.Int("kind", evt.Kind))
+	}
+	return err
+}
+
+// recordReceipt stores the receive time for an event newly stored on tenant
+func (ep *EventProcessor) recordReceipt(tenant, eventID string) {
+	ctx, cancel := context.WithTimeout(ep.ctx, 3*time.Second)
+	defer cancel()
+	if err := ep.db.RecordEventReceipt(ctx, tenant, eventID, time.Now().Unix()); err != nil {
+		logger.Warn("Failed to record event receipt",
+			zap.String("event_id", eventID),
+			zap.Error(err))
+	}
 }
 
 // Shutdown gracefully stops processing
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Shugur-Network/relay/internal/relay/nips"
 	nostr "github.com/nbd-wtf/go-nostr"
 )
 
@@ -17,24 +18,62 @@ type CompiledFilter struct {
 	Until   *time.Time
 	Tags    map[string]map[string]bool
 	Limit   int
-	Search  string
+	// Search is the NIP-50 search text, without its extensions
+	Search string
+
+	// SearchLanguage, SearchDomain and ExcludeNSFW are the NIP-50 language:,
+	// domain: and nsfw:false extensions of the search
+	SearchLanguage string
+	SearchDomain   string
+	ExcludeNSFW    bool
+	// IncludeSpam is the NIP-50 include:spam extension
+	IncludeSpam bool
+	// SpamReports leaves out search results reported as spam, or by an author
+	// reported as spam, by as many pubkeys; 0 keeps them
+	SpamReports int
+
+	// UnlockedCapsules restricts results to capsules flagged unlocked ("#unlocked" vendor filter)
+	UnlockedCapsules bool
 }
 
+// newerAddressableVersion selects a version of the outer addressable event with the
+// same (tenant, pubkey, kind, d-tag) that supersedes it: newer, or as new with a lower id
+const newerAddressableVersion = `SELECT 1 FROM events n
+  WHERE n.tenant = events.tenant AND n.pubkey = events.pubkey AND n.kind = events.kind
+    AND (jsonb_path_query_first(n.tags, '$[*]?(@[0] == "d")[1]', '{}', true)::STRING) =
+        (jsonb_path_query_first(events.tags, '$[*]?(@[0] == "d")[1]', '{}', true)::STRING)
+    AND (n.created_at > events.created_at OR (n.created_at = events.created_at AND n.id < events.id))`
+
+// likeEscaper escapes the characters special to LIKE patterns
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
 // CompileFilter pre-compiles a nostr filter for efficient matching
 func CompileFilter(f nostr.Filter) *CompiledFilter {
+	unlocked := nips.WantsUnlockedCapsules(f)
+	f = nips.WithoutUnlockedFilter(f)
+	search := nips.ParseSearch(f.Search)
+
 	cf := &CompiledFilter{
 		IDs:     make(map[string]bool),
 		Authors: make(map[string]bool),
 		Kinds:   make(map[int]bool),
 		Tags:    make(map[string]map[string]bool),
 		Limit:   f.Limit,
-		Search:  f.Search,
+		Search:  search.Text,
+
+		SearchLanguage: search.Language,
+		SearchDomain:   search.Domain,
+		ExcludeNSFW:    search.ExcludesNSFW(),
+		IncludeSpam:    search.IncludeSpam,
+
+		UnlockedCapsules: unlocked,
 	}
 
 	// Set default limit of 500 if no limit specified
 	if cf.Limit <= 0 {
 		cf.Limit = 500
 	}
+	cf.Limit = effectiveLimit(f, cf.Limit)
 
 	// Pre-compile IDs
 	for _, id := range f.IDs {
@@ -72,6 +111,22 @@ func CompileFilter(f nostr.Filter) *CompiledFilter {
 	return cf
 }
 
+// namesAddressable reports whether the filter asks for addressable kinds
+// (30000-39999). Results of filters without kinds are deduplicated after the
+// query instead, so they don't pay for the correlated subquery.
+func (cf *CompiledFilter) namesAddressable() bool {
+	if len(cf.IDs) > 0 {
+		// Lookups by ID return exactly the requested events
+		return false
+	}
+	for kind := range cf.Kinds {
+		if kind >= 30000 && kind < 40000 {
+			return true
+		}
+	}
+	return false
+}
+
 // GetBestIndex determines the most efficient index to use for the filter
 func (cf *CompiledFilter) GetBestIndex() string {
 	// If we have IDs, use the primary key index
@@ -93,8 +148,9 @@ func (cf *CompiledFilter) GetBestIndex() string {
 	return "created_at"
 }
 
-// BuildQuery constructs the SQL query using the most efficient index
-func (cf *CompiledFilter) BuildQuery() (string, []interface{}, error) {
+// BuildQuery constructs the SQL query over the events of tenant using the most
+// efficient index
+func (cf *CompiledFilter) BuildQuery(tenant string) (string, []interface{}, error) {
 	query := strings.Builder{}
 	args := make([]interface{}, 0, 10)
 	argIndex := 1
@@ -154,6 +210,12 @@ func (cf *CompiledFilter) BuildQuery() (string, []interface{}, error) {
 		query.WriteString(" WHERE true")
 	}
 
+	// Never return other tenants' events
+	tenantArg := argIndex
+	query.WriteString(fmt.Sprintf(" AND tenant = $%d", tenantArg))
+	args = append(args, tenant)
+	argIndex++
+
 	// Add time filters
 	if cf.Since != nil {
 		query.WriteString(fmt.Sprintf(" AND created_at >= $%d", argIndex))
@@ -166,12 +228,43 @@ func (cf *CompiledFilter) BuildQuery() (string, []interface{}, error) {
 		argIndex++
 	}
 
-	// Add search filter if present
-	if cf.Search != "" {
+	// Each search term must appear in the content; the trigram index on content
+	// serves these
+	for _, term := range strings.Fields(cf.Search) {
 		query.WriteString(fmt.Sprintf(" AND content ILIKE $%d", argIndex))
-		args = append(args, "%"+cf.Search+"%")
+		args = append(args, "%"+likeEscaper.Replace(term)+"%")
+		argIndex++
+	}
+	if cf.SearchLanguage != "" {
+		query.WriteString(fmt.Sprintf(" AND id IN (SELECT id FROM event_search_attrs WHERE tenant = $%d AND language = $%d)", tenantArg, argIndex))
+		args = append(args, cf.SearchLanguage)
+		argIndex++
+	}
+	if cf.SearchDomain != "" {
+		query.WriteString(fmt.Sprintf(" AND pubkey IN (SELECT pubkey FROM nip05_domains WHERE tenant = $%d AND domain = $%d)", tenantArg, argIndex))
+		args = append(args, cf.SearchDomain)
 		argIndex++
 	}
+	if cf.ExcludeNSFW {
+		query.WriteString(fmt.Sprintf(" AND id NOT IN (SELECT id FROM event_search_attrs WHERE tenant = $%d AND nsfw)", tenantArg))
+	}
+	if cf.SpamReports > 0 {
+		query.WriteString(fmt.Sprintf(
+			" AND (SELECT count(*) FROM spam_reports WHERE tenant = $%[1]d AND target = events.id) < $%[2]d"+
+				" AND (SELECT count(*) FROM spam_reports WHERE tenant = $%[1]d AND target = events.pubkey) < $%[2]d", tenantArg, argIndex))
+		args = append(args, cf.SpamReports)
+		argIndex++
+	}
+
+	// Restrict to unlocked time capsules
+	if cf.UnlockedCapsules {
+		query.WriteString(fmt.Sprintf(" AND id IN (SELECT event_id FROM capsule_unlocks WHERE tenant = $%d AND unlocked = true)", tenantArg))
+	}
+
+	// Hide superseded versions of addressable events that linger in storage
+	if cf.namesAddressable() {
+		query.WriteString(" AND NOT (kind >= 30000 AND kind < 40000 AND EXISTS (" + newerAddressableVersion + "))")
+	}
 
 	// Add tag filters
 	for tagName, tagValues := range cf.Tags {
@@ -203,3 +296,34 @@ func (cf *CompiledFilter) BuildQuery() (string, []interface{}, error) {
 
 	return query.String(), args, nil
 }
+
+// effectiveLimit caps limit at the most events f can match, so the database stops
+// scanning once they are found: one per id, one per author and kind when only
+// replaceable kinds are asked for, and one per author, kind and d tag when only
+// addressable kinds are asked for by d tag
+func effectiveLimit(f nostr.Filter, limit int) int {
+	if n := len(f.IDs); n > 0 && n < limit {
+		limit = n
+	}
+	if len(f.Authors) == 0 || len(f.Kinds) == 0 {
+		return limit
+	}
+
+	replaceable, addressable := true, true
+	for _, kind := range f.Kinds {
+		replaceable = replaceable && nips.IsReplaceable(kind)
+		addressable = addressable && nips.IsParameterizedReplaceableKind(kind)
+	}
+	n := len(f.Authors) * len(f.Kinds)
+	switch {
+	case replaceable:
+	case addressable && len(f.Tags["d"]) > 0:
+		n *= len(f.Tags["d"])
+	default:
+		return limit
+	}
+	if n < limit {
+		limit = n
+	}
+	return limit
+}
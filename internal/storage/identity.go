@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/identity"
+	"github.com/jackc/pgx/v5"
+)
+
+// Ensure DB can hold the relay identity
+var _ identity.KeyStore = (*DB)(nil)
+
+// LoadKey returns the stored relay key for name, or identity.ErrKeyNotFound
+func (db *DB) LoadKey(ctx context.Context, name string) (string, error) {
+	var stored string
+	err := db.Pool.QueryRow(ctx,
+		`SELECT key FROM relay_keys WHERE name = $1`, name).Scan(&stored)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", identity.ErrKeyNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load relay key: %w", err)
+	}
+	return stored, nil
+}
+
+// SaveKey stores a relay key (hex or NIP-49 encrypted). Without overwrite an existing
+// key is kept, so replicas starting at the same time agree on one identity.
+func (db *DB) SaveKey(ctx context.Context, name, stored string, overwrite bool) error {
+	query := `INSERT INTO relay_keys (name, key, updated_at) VALUES ($1, $2, $3)
+		 ON CONFLICT (name) DO NOTHING`
+	if overwrite {
+		query = `UPSERT INTO relay_keys (name, key, updated_at) VALUES ($1, $2, $3)`
+	}
+	if _, err := db.Pool.Exec(ctx, query, name, stored, time.Now().Unix()); err != nil {
+		return fmt.Errorf("failed to save relay key: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Invite redemption errors
+var (
+	ErrInviteNotFound  = errors.New("invite code not found")
+	ErrInviteExpired   = errors.New("invite code expired")
+	ErrInviteExhausted = errors.New("invite code has no uses left")
+	ErrInviteRedeemed  = errors.New("invite code already redeemed by this pubkey")
+)
+
+// InviteCode is an operator-generated code admitting the pubkeys that redeem it
+type InviteCode struct {
+	Code string `json:"code"`
+	// MaxUses is how many pubkeys may redeem the code, 0 for any number
+	MaxUses int64 `json:"max_uses"`
+	Uses    int64 `json:"uses"`
+	// ExpiresAt is when the code stops being redeemable, 0 for never
+	ExpiresAt int64 `json:"expires_at"`
+	// Period is the admission granted in seconds, 0 for admission that never lapses
+	Period    int64  `json:"period"`
+	Note      string `json:"note,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+const inviteColumns = `code, max_uses, uses, expires_at, period, note, created_at`
+
+// scanInvite reads one row selected with inviteColumns
+func scanInvite(row pgx.Row) (*InviteCode, error) {
+	var inv InviteCode
+	if err := row.Scan(&inv.Code, &inv.MaxUses, &inv.Uses, &inv.ExpiresAt, &inv.Period, &inv.Note, &inv.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// CreateInvites records newly generated invite codes in one batch
+func (db *DB) CreateInvites(ctx context.Context, invites []InviteCode) error {
+	batch := &pgx.Batch{}
+	for _, inv := range invites {
+		batch.Queue(
+			`INSERT INTO invite_codes (code, max_uses, uses, expires_at, period, note, created_at)
+			 VALUES ($1, $2, 0, $3, $4, $5, $6)`,
+			inv.Code, inv.MaxUses, inv.ExpiresAt, inv.Period, inv.Note, inv.CreatedAt)
+	}
+	if err := db.Pool.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to record invite codes: %w", err)
+	}
+	return nil
+}
+
+// ListInvites returns every invite code, newest first
+func (db *DB) ListInvites(ctx context.Context) ([]InviteCode, error) {
+	rows, err := db.Pool.Query(ctx, `SELECT `+inviteColumns+` FROM invite_codes ORDER BY created_at DESC, code ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load invite codes: %w", err)
+	}
+	defer rows.Close()
+
+	invites := []InviteCode{}
+	for rows.Next() {
+		inv, err := scanInvite(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invite code: %w", err)
+		}
+		invites = append(invites, *inv)
+	}
+	return invites, rows.Err()
+}
+
+// DeleteInvite revokes an invite code. Pubkeys that already redeemed it keep
+// their admission.
+func (db *DB) DeleteInvite(ctx context.Context, code string) error {
+	tag, err := db.Pool.Exec(ctx, `DELETE FROM invite_codes WHERE code = $1`, code)
+	if err != nil {
+		return fmt.Errorf("failed to delete invite code: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrInviteNotFound
+	}
+	return nil
+}
+
+// RedeemInvite spends one use of code on pubkey and credits its admission in one
+// transaction, so concurrent redemptions can't exceed the code's uses. It returns
+// the pubkey's new paid_until.
+func (db *DB) RedeemInvite(ctx context.Context, code, pubkey string, now int64) (int64, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin invite transaction: %w", err)
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil && !errors.Is(rollbackErr, pgx.ErrTxClosed) {
+			db.recordError(fmt.Errorf("rollback failed: %w", rollbackErr))
+		}
+	}()
+
+	inv, err := scanInvite(tx.QueryRow(ctx,
+		`SELECT `+inviteColumns+` FROM invite_codes WHERE code = $1 FOR UPDATE`, code))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrInviteNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to load invite code: %w", err)
+	}
+	switch {
+	case inv.ExpiresAt > 0 && inv.ExpiresAt <= now:
+		return 0, ErrInviteExpired
+	case inv.MaxUses > 0 && inv.Uses >= inv.MaxUses:
+		return 0, ErrInviteExhausted
+	}
+
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO invite_redemptions (code, pubkey, redeemed_at) VALUES ($1, $2, $3)
+		 ON CONFLICT (code, pubkey) DO NOTHING`,
+		code, pubkey, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record invite redemption: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return 0, ErrInviteRedeemed
+	}
+	if _, err := tx.Exec(ctx, `UPDATE invite_codes SET uses = uses + 1 WHERE code = $1`, code); err != nil {
+		return 0, fmt.Errorf("failed to count invite redemption: %w", err)
+	}
+
+	until, err := extendAdmission(ctx, tx, pubkey, "", inv.Period, now, "invite")
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit invite redemption: %w", err)
+	}
+	return until, nil
+}
@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Invoice statuses
+const (
+	InvoicePending = "pending"
+	InvoicePaid    = "paid"
+	InvoiceExpired = "expired"
+)
+
+// ErrInvoiceNotFound is returned when no invoice has the requested payment hash
+var ErrInvoiceNotFound = errors.New("invoice not found")
+
+// PaymentInvoice is a lightning invoice issued to a pubkey for admission or a top-up
+type PaymentInvoice struct {
+	PaymentHash string `json:"payment_hash"`
+	PubKey      string `json:"pubkey"`
+	Plan        string `json:"plan"`
+	AmountMsats int64  `json:"amount_msats"`
+	Period      int64  `json:"period"`
+	Bolt11      string `json:"bolt11"`
+	Status      string `json:"status"`
+	CreatedAt   int64  `json:"created_at"`
+	ExpiresAt   int64  `json:"expires_at"`
+	PaidAt      int64  `json:"paid_at,omitempty"`
+}
+
+const invoiceColumns = `payment_hash, pubkey, plan, amount_msats, period, bolt11, status, created_at, expires_at, paid_at`
+
+// scanInvoice reads one row selected with invoiceColumns
+func scanInvoice(row pgx.Row) (*PaymentInvoice, error) {
+	var inv PaymentInvoice
+	var paidAt *int64
+	if err := row.Scan(&inv.PaymentHash, &inv.PubKey, &inv.Plan, &inv.AmountMsats, &inv.Period,
+		&inv.Bolt11, &inv.Status, &inv.CreatedAt, &inv.ExpiresAt, &paidAt); err != nil {
+		return nil, err
+	}
+	if paidAt != nil {
+		inv.PaidAt = *paidAt
+	}
+	return &inv, nil
+}
+
+// InsertInvoice records a newly issued invoice as pending
+func (db *DB) InsertInvoice(ctx context.Context, inv *PaymentInvoice) error {
+	_, err := db.Pool.Exec(ctx,
+		`INSERT INTO payment_invoices (payment_hash, pubkey, plan, amount_msats, period, bolt11, status, created_at, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		inv.PaymentHash, inv.PubKey, inv.Plan, inv.AmountMsats, inv.Period, inv.Bolt11, InvoicePending, inv.CreatedAt, inv.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to record invoice: %w", err)
+	}
+	inv.Status = InvoicePending
+	return nil
+}
+
+// GetInvoice returns the invoice with the given payment hash
+func (db *DB) GetInvoice(ctx context.Context, paymentHash string) (*PaymentInvoice, error) {
+	inv, err := scanInvoice(db.Pool.QueryRow(ctx,
+		`SELECT `+invoiceColumns+` FROM payment_invoices WHERE payment_hash = $1`, paymentHash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInvoiceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load invoice: %w", err)
+	}
+	return inv, nil
+}
+
+// GetPendingInvoices returns pending invoices that can still be paid at now
+func (db *DB) GetPendingInvoices(ctx context.Context, now int64, limit int) ([]PaymentInvoice, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT `+invoiceColumns+` FROM payment_invoices
+		 WHERE status = $1 AND expires_at > $2
+		 ORDER BY expires_at ASC LIMIT $3`,
+		InvoicePending, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pending invoices: %w", err)
+	}
+	defer rows.Close()
+
+	var invoices []PaymentInvoice
+	for rows.Next() {
+		inv, err := scanInvoice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invoice: %w", err)
+		}
+		invoices = append(invoices, *inv)
+	}
+	return invoices, rows.Err()
+}
+
+// MarkInvoicePaid flips a pending or expired invoice to paid and credits its pubkey's
+// admission in one transaction, so a payment is credited once. An invoice with a
+// period extends the current admission (or starts it at paidAt), one without
+// grants admission that never lapses. It returns false when the invoice wasn't
+// pending or expired, along with the credited pubkey and its new paid_until.
+func (db *DB) MarkInvoicePaid(ctx context.Context, paymentHash string, paidAt int64) (bool, string, int64, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return false, "", 0, fmt.Errorf("failed to begin invoice transaction: %w", err)
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil && !errors.Is(rollbackErr, pgx.ErrTxClosed) {
+			db.recordError(fmt.Errorf("rollback failed: %w", rollbackErr))
+		}
+	}()
+
+	var pubkey, plan string
+	var period int64
+	err = tx.QueryRow(ctx,
+		`UPDATE payment_invoices SET status = $2, paid_at = $3
+		 WHERE payment_hash = $1 AND status IN ($4, $5)
+		 RETURNING pubkey, plan, period`,
+		paymentHash, InvoicePaid, paidAt, InvoicePending, InvoiceExpired).Scan(&pubkey, &plan, &period)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, "", 0, nil
+	}
+	if err != nil {
+		return false, "", 0, fmt.Errorf("failed to settle invoice: %w", err)
+	}
+
+	until, err := extendAdmission(ctx, tx, pubkey, plan, period, paidAt, "invoice")
+	if err != nil {
+		return false, "", 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, "", 0, fmt.Errorf("failed to commit invoice settlement: %w", err)
+	}
+	return true, pubkey, until, nil
+}
+
+// extendAdmission credits pubkey with period seconds of admission inside tx,
+// extending the current admission or starting it at now. A period of 0, or an
+// admission that already never lapses, yields admission that never lapses.
+// tier names the plan bought; an empty tier keeps the current one.
+// It returns the new paid_until.
+func extendAdmission(ctx context.Context, tx pgx.Tx, pubkey, tier string, period, now int64, source string) (int64, error) {
+	var current int64
+	var currentTier string
+	err := tx.QueryRow(ctx, `SELECT paid_until, tier FROM paid_pubkeys WHERE pubkey = $1`, pubkey).Scan(&current, &currentTier)
+	found := err == nil
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("failed to load paid pubkey: %w", err)
+	}
+	if tier == "" {
+		tier = currentTier
+	}
+
+	var until int64
+	switch {
+	case period == 0 || (found && current == 0):
+		until = 0
+	case current > now:
+		until = current + period
+	default:
+		until = now + period
+	}
+	if _, err := tx.Exec(ctx,
+		`UPSERT INTO paid_pubkeys (pubkey, paid_until, source, tier, updated_at) VALUES ($1, $2, $3, $4, $5)`,
+		pubkey, until, source, tier, now); err != nil {
+		return 0, fmt.Errorf("failed to credit paid pubkey: %w", err)
+	}
+	return until, nil
+}
+
+// GetOverdueInvoices returns up to limit pending invoices past their expiry, the
+// longest overdue first
+func (db *DB) GetOverdueInvoices(ctx context.Context, now int64, limit int) ([]PaymentInvoice, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT `+invoiceColumns+` FROM payment_invoices
+		 WHERE status = $1 AND expires_at <= $2
+		 ORDER BY expires_at ASC LIMIT $3`,
+		InvoicePending, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load overdue invoices: %w", err)
+	}
+	defer rows.Close()
+
+	var invoices []PaymentInvoice
+	for rows.Next() {
+		inv, err := scanInvoice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invoice: %w", err)
+		}
+		invoices = append(invoices, *inv)
+	}
+	return invoices, rows.Err()
+}
+
+// ExpireInvoice marks a pending invoice past its expiry as expired, and reports
+// whether it was
+func (db *DB) ExpireInvoice(ctx context.Context, paymentHash string, now int64) (bool, error) {
+	tag, err := db.Pool.Exec(ctx,
+		`UPDATE payment_invoices SET status = $1 WHERE payment_hash = $2 AND status = $3 AND expires_at <= $4`,
+		InvoiceExpired, paymentHash, InvoicePending, now)
+	if err != nil {
+		return false, fmt.Errorf("failed to expire invoice: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	nostr "github.com/nbd-wtf/go-nostr"
+)
+
+// LedgerZap is the entry type of zap top-up credits
+const LedgerZap = "zap"
+
+// PaymentEventHandler credits payment events (zap receipts, nutzaps) stored by the
+// event processor
+type PaymentEventHandler interface {
+	HandlePaymentEvent(ctx context.Context, evt nostr.Event)
+}
+
+// LedgerEntry is one credit (positive) or debit (negative) of a pubkey's balance
+type LedgerEntry struct {
+	EntryType   string `json:"entry_type"`
+	Reference   string `json:"reference"`
+	PubKey      string `json:"pubkey"`
+	AmountMsats int64  `json:"amount_msats"`
+	CreatedAt   int64  `json:"created_at"`
+}
+
+// AdmissionPrice is what a balance is spent on: each FeeMsats buys Period
+// seconds of admission, or admission that never lapses when Period is 0
+type AdmissionPrice struct {
+	Plan     string
+	FeeMsats int64
+	Period   int64
+}
+
+// LedgerCredit is the outcome of CreditLedger
+type LedgerCredit struct {
+	// Credited is false when the reference was already credited
+	Credited bool
+	// Spent is the amount debited for admission, PaidUntil the resulting admission
+	Spent     int64
+	PaidUntil int64
+}
+
+// CreditLedger records a credit and spends the pubkey's balance on admission at
+// price in one transaction. Credits are keyed by entry type and reference, so
+// crediting the same payment twice has no effect.
+func (db *DB) CreditLedger(ctx context.Context, entry LedgerEntry, price AdmissionPrice) (LedgerCredit, error) {
+	var result LedgerCredit
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return result, fmt.Errorf("failed to begin ledger transaction: %w", err)
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil && !errors.Is(rollbackErr, pgx.ErrTxClosed) {
+			db.recordError(fmt.Errorf("rollback failed: %w", rollbackErr))
+		}
+	}()
+
+	if result, err = creditLedger(ctx, tx, entry, price); err != nil || !result.Credited {
+		return result, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return result, fmt.Errorf("failed to commit ledger credit: %w", err)
+	}
+	return result, nil
+}
+
+// creditLedger records a credit and spends the balance inside tx
+func creditLedger(ctx context.Context, tx pgx.Tx, entry LedgerEntry, price AdmissionPrice) (LedgerCredit, error) {
+	var result LedgerCredit
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO payment_ledger (entry_type, reference, pubkey, amount_msats, created_at)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (entry_type, reference) DO NOTHING`,
+		entry.EntryType, entry.Reference, entry.PubKey, entry.AmountMsats, entry.CreatedAt)
+	if err != nil {
+		return result, fmt.Errorf("failed to record ledger credit: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return result, nil
+	}
+	result.Credited = true
+
+	if price.FeeMsats > 0 {
+		if result.Spent, result.PaidUntil, err = spendBalance(ctx, tx, entry, price); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// spendBalance buys as much admission at price as the pubkey's balance covers
+// and debits it against the credit that triggered the purchase
+func spendBalance(ctx context.Context, tx pgx.Tx, credit LedgerEntry, price AdmissionPrice) (int64, int64, error) {
+	var balance int64
+	if err := tx.QueryRow(ctx,
+		`SELECT COALESCE(SUM(amount_msats), 0) FROM payment_ledger WHERE pubkey = $1`,
+		credit.PubKey).Scan(&balance); err != nil {
+		return 0, 0, fmt.Errorf("failed to load ledger balance: %w", err)
+	}
+
+	units := balance / price.FeeMsats
+	if price.Period == 0 && units > 0 {
+		// Admission that never lapses is bought once
+		var paidUntil int64
+		err := tx.QueryRow(ctx, `SELECT paid_until FROM paid_pubkeys WHERE pubkey = $1`, credit.PubKey).Scan(&paidUntil)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return 0, 0, fmt.Errorf("failed to load paid pubkey: %w", err)
+		}
+		if err == nil && paidUntil == 0 {
+			return 0, 0, nil
+		}
+		units = 1
+	}
+	if units == 0 {
+		return 0, 0, nil
+	}
+
+	spent := units * price.FeeMsats
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO payment_ledger (entry_type, reference, pubkey, amount_msats, created_at)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		price.Plan, credit.Reference, credit.PubKey, -spent, credit.CreatedAt); err != nil {
+		return 0, 0, fmt.Errorf("failed to record ledger debit: %w", err)
+	}
+	until, err := extendAdmission(ctx, tx, credit.PubKey, price.Plan, units*price.Period, credit.CreatedAt, credit.EntryType)
+	if err != nil {
+		return 0, 0, err
+	}
+	return spent, until, nil
+}
+
+// GetLedger returns a pubkey's balance and its most recent ledger entries
+func (db *DB) GetLedger(ctx context.Context, pubkey string, limit int) (int64, []LedgerEntry, error) {
+	var balance int64
+	if err := db.Pool.QueryRow(ctx,
+		`SELECT COALESCE(SUM(amount_msats), 0) FROM payment_ledger WHERE pubkey = $1`,
+		pubkey).Scan(&balance); err != nil {
+		return 0, nil, fmt.Errorf("failed to load ledger balance: %w", err)
+	}
+
+	rows, err := db.Pool.Query(ctx,
+		`SELECT entry_type, reference, pubkey, amount_msats, created_at FROM payment_ledger
+		 WHERE pubkey = $1 ORDER BY created_at DESC LIMIT $2`,
+		pubkey, limit)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to load ledger entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []LedgerEntry{}
+	for rows.Next() {
+		var e LedgerEntry
+		if err := rows.Scan(&e.EntryType, &e.Reference, &e.PubKey, &e.AmountMsats, &e.CreatedAt); err != nil {
+			return 0, nil, fmt.Errorf("failed to scan ledger entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return balance, entries, rows.Err()
+}
@@ -0,0 +1,264 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/metrics"
+	"github.com/Shugur-Network/relay/internal/relay/nips"
+	nostr "github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	// liveRingMaxEvents bounds the live ring, the oldest events giving way first
+	liveRingMaxEvents = 100000
+	// liveFutureSkew is how far ahead of the clock events may be dated, so events
+	// stored before startup can be dated up to this far past it
+	liveFutureSkew = 5 * time.Minute
+)
+
+// liveRing holds the events ingested within the live window, oldest first. Every
+// stored event created after floor() is in events.
+type liveRing struct {
+	mu     sync.Mutex
+	window time.Duration
+	// readyAt is the created_at after which every stored event was ingested
+	// while the ring was running
+	readyAt int64
+	// dropped is the newest created_at given way to liveRingMaxEvents
+	dropped int64
+	events  []nostr.Event
+	ids     map[string]nostr.Timestamp
+	// versions maps replaceable and addressable coordinates to the id of the
+	// newest version in events
+	versions map[string]string
+}
+
+// EnableLiveRing keeps the events ingested within window in memory and answers
+// REQs whose since falls inside it without the database, so firehose clients
+// only wait for new events. Must be called before events are stored.
+func (db *DB) EnableLiveRing(window time.Duration) {
+	db.live = &liveRing{
+		window:   window,
+		readyAt:  time.Now().Add(liveFutureSkew).Unix(),
+		ids:      make(map[string]nostr.Timestamp),
+		versions: make(map[string]string),
+	}
+}
+
+// remember feeds a newly stored event of tenant to the in-memory read paths,
+// which only serve the main relay
+func (db *DB) remember(tenant string, evt nostr.Event) {
+	if tenant != DefaultTenant {
+		return
+	}
+	db.recent.add(evt)
+	db.live.add(evt)
+	db.counts.add(evt)
+}
+
+// forgetDeletion drops what del deleted, ids being its e tags, from the
+// in-memory read paths
+func (db *DB) forgetDeletion(del nostr.Event, ids []string) {
+	db.recent.forget(del.PubKey, ids)
+	db.live.forget(del, ids)
+}
+
+// forgetEvents drops events removed by the operator from the in-memory read paths
+func (db *DB) forgetEvents(events []nostr.Event) {
+	for _, evt := range events {
+		db.recent.forget(evt.PubKey, []string{evt.ID})
+		db.live.forget(nostr.Event{PubKey: evt.PubKey}, []string{evt.ID})
+	}
+}
+
+// LiveEvents answers f from the events of tenant ingested within the live window,
+// oldest first, when its since falls inside the window. It reports false when f
+// must be answered by GetEvents.
+func (db *DB) LiveEvents(tenant string, f nostr.Filter) ([]nostr.Event, bool) {
+	r := db.live
+	if r == nil || tenant != DefaultTenant || f.Since == nil || f.Search != "" || nips.WantsUnlockedCapsules(f) {
+		return nil, false
+	}
+	limit := CompileFilter(f).Limit
+	f = withoutEmptyTags(f)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.prune(time.Now())
+	if int64(*f.Since) <= r.floor(time.Now()) {
+		return nil, false
+	}
+
+	matches := []nostr.Event{}
+	for i := range r.events {
+		evt := &r.events[i]
+		if f.Matches(evt) && !nips.IsExpired(*evt) {
+			matches = append(matches, *evt)
+		}
+	}
+
+	// Since-only filters take the oldest events, the rest the newest
+	if len(matches) > limit {
+		if f.Until == nil {
+			matches = matches[:limit]
+		} else {
+			matches = matches[len(matches)-limit:]
+		}
+	}
+	metrics.LiveRingHits.Inc()
+	return matches, true
+}
+
+// floor returns the created_at after which the ring holds every stored event
+func (r *liveRing) floor(now time.Time) int64 {
+	floor := now.Add(-r.window).Unix()
+	if r.readyAt > floor {
+		floor = r.readyAt
+	}
+	if r.dropped > floor {
+		floor = r.dropped
+	}
+	return floor
+}
+
+// prune drops the events that fell out of the window. The caller must hold r.mu.
+func (r *liveRing) prune(now time.Time) {
+	cutoff := now.Add(-r.window).Unix()
+	n := sort.Search(len(r.events), func(i int) bool {
+		return int64(r.events[i].CreatedAt) > cutoff
+	})
+	r.drop(n)
+}
+
+// drop removes the n oldest events. The caller must hold r.mu.
+func (r *liveRing) drop(n int) {
+	if n == 0 {
+		return
+	}
+	for _, evt := range r.events[:n] {
+		r.untrack(evt)
+	}
+	kept := copy(r.events, r.events[n:])
+	clear(r.events[kept:])
+	r.events = r.events[:kept]
+}
+
+// add records a newly stored event, replacing older versions of replaceable and
+// addressable events
+func (r *liveRing) add(evt nostr.Event) {
+	if r == nil || nips.IsEphemeral(evt.Kind) {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.prune(now)
+	if int64(evt.CreatedAt) <= r.floor(now) {
+		return
+	}
+	if _, ok := r.ids[evt.ID]; ok {
+		return
+	}
+	if coord, ok := versionKey(evt); ok {
+		if id, ok := r.versions[coord]; ok {
+			current := r.events[r.index(id)]
+			if current.CreatedAt > evt.CreatedAt || (current.CreatedAt == evt.CreatedAt && current.ID < evt.ID) {
+				return
+			}
+			r.remove(id)
+		}
+		r.versions[coord] = evt.ID
+	}
+
+	i := sort.Search(len(r.events), func(i int) bool {
+		return r.events[i].CreatedAt > evt.CreatedAt
+	})
+	r.events = append(r.events, nostr.Event{})
+	copy(r.events[i+1:], r.events[i:])
+	r.events[i] = evt
+	r.ids[evt.ID] = evt.CreatedAt
+
+	if over := len(r.events) - liveRingMaxEvents; over > 0 {
+		r.dropped = int64(r.events[over-1].CreatedAt)
+		r.drop(sort.Search(len(r.events), func(i int) bool {
+			return int64(r.events[i].CreatedAt) > r.dropped
+		}))
+	}
+}
+
+// forget drops the events del deleted: those with ids and the versions of its a
+// tag addresses no newer than del, when owned by its author
+func (r *liveRing) forget(del nostr.Event, ids []string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, id := range ids {
+		if _, ok := r.ids[id]; ok && r.events[r.index(id)].PubKey == del.PubKey {
+			r.remove(id)
+		}
+	}
+	for _, t := range del.Tags {
+		if len(t) < 2 || t[0] != "a" {
+			continue
+		}
+		kind, pubkey, d, err := nips.ParseDeletionAddress(t[1])
+		if err != nil || pubkey != del.PubKey {
+			continue
+		}
+		if nips.IsReplaceable(kind) {
+			d = ""
+		}
+		id, ok := r.versions[fmt.Sprintf("%d:%s:%s", kind, pubkey, d)]
+		if ok && r.ids[id] <= del.CreatedAt {
+			r.remove(id)
+		}
+	}
+}
+
+// index returns the position of the event with id, which must be in the ring
+func (r *liveRing) index(id string) int {
+	createdAt := r.ids[id]
+	i := sort.Search(len(r.events), func(i int) bool {
+		return r.events[i].CreatedAt >= createdAt
+	})
+	for r.events[i].ID != id {
+		i++
+	}
+	return i
+}
+
+// remove drops the event with id, which must be in the ring
+func (r *liveRing) remove(id string) {
+	i := r.index(id)
+	r.untrack(r.events[i])
+	r.events = append(r.events[:i], r.events[i+1:]...)
+}
+
+// untrack forgets the id and version of evt
+func (r *liveRing) untrack(evt nostr.Event) {
+	delete(r.ids, evt.ID)
+	if coord, ok := versionKey(evt); ok && r.versions[coord] == evt.ID {
+		delete(r.versions, coord)
+	}
+}
+
+// versionKey returns the coordinate shared by the versions of a replaceable or
+// addressable event
+func versionKey(evt nostr.Event) (string, bool) {
+	switch {
+	case nips.IsReplaceable(evt.Kind):
+		return fmt.Sprintf("%d:%s:", evt.Kind, evt.PubKey), true
+	case nips.IsParameterizedReplaceableKind(evt.Kind):
+		return fmt.Sprintf("%d:%s:%s", evt.Kind, evt.PubKey, nips.GetTagValue(evt, "d")), true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrBlobNotFound is returned when no media blob is stored under a sha256
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobDescriptor describes a stored media blob (Blossom BUD-02). URL is filled in
+// by the HTTP layer, which knows the public address of the relay.
+type BlobDescriptor struct {
+	URL      string `json:"url"`
+	SHA256   string `json:"sha256"`
+	Size     int64  `json:"size"`
+	Type     string `json:"type"`
+	Uploaded int64  `json:"uploaded"`
+}
+
+// PutMediaBlob stores a blob under its sha256 and records owner as one of its
+// uploaders. Uploading an already stored blob only adds the owner.
+func (db *DB) PutMediaBlob(ctx context.Context, sha256 string, content []byte, mimeType, owner string, uploaded int64) (*BlobDescriptor, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin blob transaction: %w", err)
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil && !errors.Is(rollbackErr, pgx.ErrTxClosed) {
+			db.recordError(fmt.Errorf("rollback failed: %w", rollbackErr))
+		}
+	}()
+
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO media_blobs (sha256, content, size, type, uploaded)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (sha256) DO NOTHING`,
+		sha256, content, int64(len(content)), mimeType, uploaded); err != nil {
+		return nil, fmt.Errorf("failed to store blob: %w", err)
+	}
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO media_blob_owners (pubkey, sha256, uploaded)
+		 VALUES ($1, $2, $3)
+		 ON CONFLICT (pubkey, sha256) DO NOTHING`,
+		owner, sha256, uploaded); err != nil {
+		return nil, fmt.Errorf("failed to record blob owner: %w", err)
+	}
+
+	desc := &BlobDescriptor{SHA256: sha256}
+	if err := tx.QueryRow(ctx,
+		`SELECT size, type, uploaded FROM media_blobs WHERE sha256 = $1`,
+		sha256).Scan(&desc.Size, &desc.Type, &desc.Uploaded); err != nil {
+		return nil, fmt.Errorf("failed to load blob descriptor: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit blob: %w", err)
+	}
+	return desc, nil
+}
+
+// GetMediaBlob returns a stored blob and its descriptor
+func (db *DB) GetMediaBlob(ctx context.Context, sha256 string) (*BlobDescriptor, []byte, error) {
+	desc := &BlobDescriptor{SHA256: sha256}
+	var content []byte
+	err := db.Pool.QueryRow(ctx,
+		`SELECT content, size, type, uploaded FROM media_blobs WHERE sha256 = $1`,
+		sha256).Scan(&content, &desc.Size, &desc.Type, &desc.Uploaded)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load blob: %w", err)
+	}
+	return desc, content, nil
+}
+
+// ListMediaBlobs returns the blobs uploaded by pubkey within [since, until], newest
+// first. A zero bound is open.
+func (db *DB) ListMediaBlobs(ctx context.Context, pubkey string, since, until int64) ([]BlobDescriptor, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT b.sha256, b.size, b.type, o.uploaded
+		 FROM media_blob_owners o JOIN media_blobs b ON b.sha256 = o.sha256
+		 WHERE o.pubkey = $1
+		   AND ($2 = 0 OR o.uploaded >= $2)
+		   AND ($3 = 0 OR o.uploaded <= $3)
+		 ORDER BY o.uploaded DESC`,
+		pubkey, since, until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blobs: %w", err)
+	}
+	defer rows.Close()
+
+	blobs := []BlobDescriptor{}
+	for rows.Next() {
+		var desc BlobDescriptor
+		if err := rows.Scan(&desc.SHA256, &desc.Size, &desc.Type, &desc.Uploaded); err != nil {
+			return nil, fmt.Errorf("failed to scan blob: %w", err)
+		}
+		blobs = append(blobs, desc)
+	}
+	return blobs, rows.Err()
+}
+
+// DeleteMediaBlob removes owner from a blob's uploaders and deletes the blob once
+// nobody owns it. It returns ErrBlobNotFound when owner never uploaded the blob.
+func (db *DB) DeleteMediaBlob(ctx context.Context, sha256, owner string) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin blob transaction: %w", err)
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil && !errors.Is(rollbackErr, pgx.ErrTxClosed) {
+			db.recordError(fmt.Errorf("rollback failed: %w", rollbackErr))
+		}
+	}()
+
+	tag, err := tx.Exec(ctx,
+		`DELETE FROM media_blob_owners WHERE pubkey = $1 AND sha256 = $2`, owner, sha256)
+	if err != nil {
+		return fmt.Errorf("failed to delete blob owner: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrBlobNotFound
+	}
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM media_blobs
+		 WHERE sha256 = $1 AND NOT EXISTS (SELECT 1 FROM media_blob_owners WHERE sha256 = $1)`,
+		sha256); err != nil {
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit blob deletion: %w", err)
+	}
+	return nil
+}
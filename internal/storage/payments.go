@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// PaidPubkey is a pubkey admitted by payment. PaidUntil is 0 when admission never
+// lapses. Tier names the plan or membership tier last bought, if any.
+type PaidPubkey struct {
+	PubKey    string `json:"pubkey"`
+	PaidUntil int64  `json:"paid_until"`
+	Source    string `json:"source"`
+	Tier      string `json:"tier,omitempty"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// Active reports whether admission is still valid at now (unix seconds)
+func (p PaidPubkey) Active(now int64) bool {
+	return p.PaidUntil == 0 || p.PaidUntil > now
+}
+
+// SetPaidPubkey records pubkey as paid until paidUntil (0 for no expiry) in tier,
+// replacing any earlier record. source notes how the payment was made ("admin", "invoice").
+func (db *DB) SetPaidPubkey(ctx context.Context, pubkey string, paidUntil int64, source, tier string, updatedAt int64) error {
+	_, err := db.Pool.Exec(ctx,
+		`UPSERT INTO paid_pubkeys (pubkey, paid_until, source, tier, updated_at) VALUES ($1, $2, $3, $4, $5)`,
+		pubkey, paidUntil, source, tier, updatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record paid pubkey: %w", err)
+	}
+	return nil
+}
+
+// DeletePaidPubkey revokes a pubkey's paid admission
+func (db *DB) DeletePaidPubkey(ctx context.Context, pubkey string) error {
+	if _, err := db.Pool.Exec(ctx, `DELETE FROM paid_pubkeys WHERE pubkey = $1`, pubkey); err != nil {
+		return fmt.Errorf("failed to delete paid pubkey: %w", err)
+	}
+	return nil
+}
+
+// GetPaidPubkeys returns the pubkeys whose admission is valid at now
+func (db *DB) GetPaidPubkeys(ctx context.Context, now int64) ([]PaidPubkey, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT pubkey, paid_until, source, tier, updated_at FROM paid_pubkeys
+		 WHERE paid_until = 0 OR paid_until > $1
+		 ORDER BY pubkey`, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load paid pubkeys: %w", err)
+	}
+	defer rows.Close()
+
+	paid := []PaidPubkey{}
+	for rows.Next() {
+		var p PaidPubkey
+		if err := rows.Scan(&p.PubKey, &p.PaidUntil, &p.Source, &p.Tier, &p.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan paid pubkey: %w", err)
+		}
+		paid = append(paid, p)
+	}
+	return paid, rows.Err()
+}
+
+// GetLapsingPaidPubkeys returns the pubkeys whose admission lapses after from and
+// no later than to
+func (db *DB) GetLapsingPaidPubkeys(ctx context.Context, from, to int64) ([]PaidPubkey, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT pubkey, paid_until, source, tier, updated_at FROM paid_pubkeys
+		 WHERE paid_until > $1 AND paid_until <= $2
+		 ORDER BY paid_until`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load lapsing paid pubkeys: %w", err)
+	}
+	defer rows.Close()
+
+	paid := []PaidPubkey{}
+	for rows.Next() {
+		var p PaidPubkey
+		if err := rows.Scan(&p.PubKey, &p.PaidUntil, &p.Source, &p.Tier, &p.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan paid pubkey: %w", err)
+		}
+		paid = append(paid, p)
+	}
+	return paid, rows.Err()
+}
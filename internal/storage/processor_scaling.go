@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/metrics"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultQueueSize is used when ProcessorLimits.QueueSize is unset
+	defaultQueueSize = 100000
+	// defaultLatencyTarget is used when ProcessorLimits.LatencyTarget is unset
+	defaultLatencyTarget = 250 * time.Millisecond
+	// scaleInterval is how often the processor resizes its workers and queue
+	scaleInterval = time.Second
+	// scaleUpDepth is the queued events per worker that add workers
+	scaleUpDepth = 16
+	// scaleDownIdle is the consecutive intervals with an empty queue that retire a worker
+	scaleDownIdle = 10
+	// maxRetryAfter caps the retry hint given to clients of a saturated queue
+	maxRetryAfter = time.Minute
+)
+
+// ProcessorLimits bounds how the event processor scales. Zero values use the
+// defaults: NumCPU to 8x NumCPU workers, 100000 queued events and 250ms writes.
+type ProcessorLimits struct {
+	MinWorkers int
+	MaxWorkers int
+	// QueueSize is the most events queued for storage
+	QueueSize int
+	// LatencyTarget is the write latency above which no workers are added and
+	// fewer events are admitted, so a struggling database isn't loaded further
+	LatencyTarget time.Duration
+}
+
+// withDefaults fills the unset limits
+func (l ProcessorLimits) withDefaults() ProcessorLimits {
+	if l.MinWorkers <= 0 {
+		l.MinWorkers = runtime.NumCPU()
+	}
+	if l.MaxWorkers <= 0 {
+		l.MaxWorkers = runtime.NumCPU() * 8
+	}
+	if l.MaxWorkers < l.MinWorkers {
+		l.MaxWorkers = l.MinWorkers
+	}
+	if l.QueueSize <= 0 {
+		l.QueueSize = defaultQueueSize
+	}
+	if l.LatencyTarget <= 0 {
+		l.LatencyTarget = defaultLatencyTarget
+	}
+	return l
+}
+
+// addWorkers starts n more workers
+func (ep *EventProcessor) addWorkers(n int) {
+	for i := 0; i < n; i++ {
+		ep.workers.Add(1)
+		go func() {
+			defer ep.workers.Add(-1)
+			ep.processEvents(ep.ctx)
+		}()
+	}
+}
+
+// observeWrite folds the duration of a write started at start into the average
+func (ep *EventProcessor) observeWrite(start time.Time) {
+	sample := int64(time.Since(start))
+	for {
+		old := ep.writeLatency.Load()
+		avg := sample
+		if old > 0 {
+			avg = old + (sample-old)/8
+		}
+		if ep.writeLatency.CompareAndSwap(old, avg) {
+			return
+		}
+	}
+}
+
+// autoscale resizes the workers and admitted queue every scaleInterval
+func (ep *EventProcessor) autoscale() {
+	ticker := time.NewTicker(scaleInterval)
+	defer ticker.Stop()
+
+	idle := 0
+	for {
+		select {
+		case <-ep.ctx.Done():
+			return
+		case <-ticker.C:
+			idle = ep.scale(idle)
+		}
+	}
+}
+
+// scale adds workers while events queue up and writes keep within the latency
+// target, retires idle ones once the queue stays empty, and admits fewer events
+// while writes are slow. It returns the updated count of idle intervals.
+func (ep *EventProcessor) scale(idle int) int {
+	depth := len(ep.eventChan)
+	workers := int(ep.workers.Load())
+	latency := time.Duration(ep.writeLatency.Load())
+
+	// Slow writes shrink the queue in proportion so it drains within the target
+	admitted := ep.limits.QueueSize
+	if latency > ep.limits.LatencyTarget {
+		admitted = int(int64(admitted) * int64(ep.limits.LatencyTarget) / int64(latency))
+		if floor := ep.limits.QueueSize / 10; admitted < floor {
+			admitted = floor
+		}
+		if admitted < 1 {
+			admitted = 1
+		}
+	}
+	ep.admitted.Store(int64(admitted))
+
+	// Saturation ends once the queue has drained to half of what is admitted
+	if episode := ep.saturation.Load(); episode != 0 && depth <= admitted/2 {
+		if ep.saturation.CompareAndSwap(episode, 0) {
+			logger.Info("Event queue recovered from saturation", zap.Int("queue_depth", depth))
+		}
+	}
+
+	switch {
+	case depth > workers*scaleUpDepth && latency <= ep.limits.LatencyTarget && workers < ep.limits.MaxWorkers:
+		add := workers / 2
+		if add < 1 {
+			add = 1
+		}
+		if add > ep.limits.MaxWorkers-workers {
+			add = ep.limits.MaxWorkers - workers
+		}
+		ep.addWorkers(add)
+		logger.Debug("Added event workers",
+			zap.Int("workers", workers+add),
+			zap.Int("queue_depth", depth),
+			zap.Duration("write_latency", latency))
+		idle = 0
+	case depth == 0 && workers > ep.limits.MinWorkers:
+		idle++
+		if idle >= scaleDownIdle {
+			// Only a worker waiting for events takes the signal
+			select {
+			case ep.retire <- struct{}{}:
+				logger.Debug("Retired an idle event worker", zap.Int("workers", workers-1))
+			default:
+			}
+			idle = 0
+		}
+	default:
+		idle = 0
+	}
+
+	metrics.EventQueueDepth.Set(float64(depth))
+	metrics.EventQueueCapacity.Set(float64(admitted))
+	metrics.EventWorkers.Set(float64(ep.workers.Load()))
+	metrics.EventWriteLatency.Set(latency.Seconds())
+	return idle
+}
+
+// Saturation returns the number of the current episode of the queue dropping
+// events, or 0 when it is accepting them
+func (ep *EventProcessor) Saturation() uint64 {
+	return ep.saturation.Load()
+}
+
+// RetryAfter estimates how long the queued events take to store at the current
+// write latency, at least a second and at most a minute
+func (ep *EventProcessor) RetryAfter() time.Duration {
+	workers := ep.workers.Load()
+	if workers < 1 {
+		workers = 1
+	}
+	drain := time.Duration(int64(len(ep.eventChan)) * ep.writeLatency.Load() / workers)
+	switch {
+	case drain < time.Second:
+		return time.Second
+	case drain > maxRetryAfter:
+		return maxRetryAfter
+	default:
+		return drain.Round(time.Second)
+	}
+}
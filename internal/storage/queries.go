@@ -17,19 +17,50 @@ import (
 	"go.uber.org/zap"
 )
 
-// GetEvents retrieves events based on Nostr filters
-func (db *DB) GetEvents(ctx context.Context, filter nostr.Filter) ([]nostr.Event, error) {
+// DefaultQueryTimeout bounds GetEvents when the caller's context has no deadline
+const DefaultQueryTimeout = 5 * time.Second
+
+// GetEvents retrieves the events of tenant matching a Nostr filter. The query runs
+// until ctx is done, or for DefaultQueryTimeout when ctx has no deadline.
+func (db *DB) GetEvents(ctx context.Context, tenant string, filter nostr.Filter) ([]nostr.Event, error) {
+	events, _, err := db.ServeEvents(ctx, tenant, filter)
+	return events, err
+}
+
+// ServeEvents is GetEvents also reporting whether the recent events cache
+// answered the filter without the database
+func (db *DB) ServeEvents(ctx context.Context, tenant string, filter nostr.Filter) ([]nostr.Event, bool, error) {
 	// Compile the filter for efficient processing
 	cf := CompileFilter(filter)
 
+	// The latest events of common kinds are answered from memory
+	if tenant == DefaultTenant {
+		if events, ok := db.recentEvents(filter, cf); ok {
+			return events, true, nil
+		}
+	}
+
+	// Without the database only what is in memory can be served
+	if err := db.allow(); err != nil {
+		return nil, false, err
+	}
+
+	// Searches leave out spam unless asked for it
+	if filter.Search != "" && !cf.IncludeSpam {
+		cf.SpamReports = db.spamReports
+	}
+
 	// Build the optimized query
-	query, args, err := cf.BuildQuery()
+	query, args, err := cf.BuildQuery(tenant)
 	if err != nil {
-		return nil, fmt.Errorf("failed to build query: %w", err)
+		return nil, false, fmt.Errorf("failed to build query: %w", err)
 	}
 
-	// Create context with timeout
-	queryCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	// Callers without their own deadline get the default timeout
+	queryCtx, cancel := ctx, context.CancelFunc(func() {})
+	if _, ok := ctx.Deadline(); !ok {
+		queryCtx, cancel = context.WithTimeout(ctx, DefaultQueryTimeout)
+	}
 	defer cancel()
 
 	// Log the query for debugging
@@ -37,10 +68,18 @@ func (db *DB) GetEvents(ctx context.Context, filter nostr.Filter) ([]nostr.Event
 		zap.String("query", query),
 		zap.Int("arg_count", len(args)))
 
+	// Wait for a slot so bursts of reads can't exhaust the pool
+	release, err := db.acquireQuery(queryCtx, QueryWeight(filter))
+	if err != nil {
+		return nil, false, err
+	}
+	defer release()
+
 	// Execute query
 	rows, err := db.Pool.Query(queryCtx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query events: %w", err)
+		db.observe(err)
+		return nil, false, fmt.Errorf("failed to query events: %w", err)
 	}
 	defer rows.Close()
 
@@ -71,19 +110,33 @@ func (db *DB) GetEvents(ctx context.Context, filter nostr.Filter) ([]nostr.Event
 
 		events = append(events, evt)
 	}
+	// A query canceled or timed out mid-scan must not pass for a complete result
+	err = rows.Err()
+	db.observe(err)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read events: %w", err)
+	}
+
+	// Only the newest version of a replaceable or addressable event is returned
+	events = latestReplaceable(events)
+
+	// Restore capsule payloads kept in capsule_blobs
+	if err := db.hydrateCapsuleBlobs(queryCtx, events); err != nil {
+		return nil, false, err
+	}
 
 	// Reorder events in ascending order by created_at
 	sort.Slice(events, func(i, j int) bool {
 		return events[i].CreatedAt < events[j].CreatedAt
 	})
 
-	return events, nil
+	return events, false, nil
 }
 
-// GetEventByID retrieves a single event by its ID.
-func (db *DB) GetEventByID(ctx context.Context, eventID string) (nostr.Event, error) {
-	query := `SELECT id, pubkey, kind, created_at, content, tags, sig FROM events WHERE id = $1`
-	row := db.Pool.QueryRow(ctx, query, eventID)
+// GetEventByID retrieves a single event of tenant by its ID.
+func (db *DB) GetEventByID(ctx context.Context, tenant, eventID string) (nostr.Event, error) {
+	query := `SELECT id, pubkey, kind, created_at, content, tags, sig FROM events WHERE tenant = $1 AND id = $2`
+	row := db.Pool.QueryRow(ctx, query, tenant, eventID)
 
 	var evt nostr.Event
 	var createdAt int64
@@ -93,126 +146,55 @@ func (db *DB) GetEventByID(ctx context.Context, eventID string) (nostr.Event, er
 	}
 
 	evt.CreatedAt = nostr.Timestamp(createdAt) // Convert Unix timestamp to nostr.Timestamp
+	if err := db.hydrateCapsuleBlob(ctx, &evt); err != nil {
+		return nostr.Event{}, err
+	}
 
 	return evt, nil
 }
 
-// InsertEvent directly inserts a single event
-func (db *DB) InsertEvent(ctx context.Context, evt nostr.Event) error {
-
-	// Check Bloom filter first to avoid duplicate DB operations
-	if db.Bloom.Test([]byte(evt.ID)) {
-		// Already have this event
+// InsertEvent directly inserts a single event of tenant
+func (db *DB) InsertEvent(ctx context.Context, tenant string, evt nostr.Event) error {
 
-		return nil
+	// Skip events certainly stored already; the unique constraint catches the rest
+	if db.Bloom.Known(DedupKey(tenant, evt.ID)) {
+		return ErrDuplicateEvent
 	}
 	// No need to add to Bloom filter here - that should be handled by the caller
 	// so that we can control when the event is considered "processed"
 
-	_, err := db.Pool.Exec(ctx,
-		`INSERT INTO events (id, pubkey, created_at, kind, tags, content, sig)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7)
-		 ON CONFLICT (id) DO NOTHING`,
-		evt.ID, evt.PubKey, evt.CreatedAt.Time().Unix(),
-		evt.Kind, evt.Tags, evt.Content, evt.Sig)
-
-	if err != nil {
-		return fmt.Errorf("failed to insert event: %w", err)
-	}
-
-	return nil
-}
-
-// Modified EventBuffer that processes events one at a time
-
-// BatchInsertEvents optimized for CockroachDB with timeout handling
-func (db *DB) BatchInsertEvents(ctx context.Context, events []nostr.Event) error {
-	if len(events) == 0 {
-		return nil
-	}
-
-	// Use smaller batches for CockroachDB
-	const batchSize = 50
-
-	// Execute in smaller batches with retries
-	for i := 0; i < len(events); i += batchSize {
-		end := i + batchSize
-		if end > len(events) {
-			end = len(events)
-		}
-
-		batchEvents := events[i:end]
-		err := db.executeWithRetry(ctx, func(retryCtx context.Context) error {
-			return db.insertEventBatch(retryCtx, batchEvents)
-		})
-
-		if err != nil {
-			return fmt.Errorf("batch insert failed: %w", err)
-		}
+	// Keep large capsule payloads out of the hot events table
+	if err := db.offloadCapsuleBlob(ctx, &evt); err != nil {
+		return err
 	}
 
-	return nil
-}
-
-// Helper for actual batch insertion
-func (db *DB) insertEventBatch(ctx context.Context, events []nostr.Event) error {
-	tx, err := db.Pool.Begin(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer func() {
-		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil {
-			db.recordError(fmt.Errorf("rollback failed: %w", rollbackErr))
-		}
-	}()
+	tag, err := db.Pool.Exec(ctx,
+		`INSERT INTO events (id, pubkey, created_at, kind, tags, content, sig, tenant)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		 ON CONFLICT (tenant, id) DO NOTHING`,
+		evt.ID, evt.PubKey, evt.CreatedAt.Time().Unix(),
+		evt.Kind, evt.Tags, evt.Content, evt.Sig, tenant)
 
-	// Set statement timeout and priority
-	_, err = tx.Exec(ctx, "SET TRANSACTION PRIORITY HIGH")
 	if err != nil {
-		return fmt.Errorf("failed to set transaction priority: %w", err)
-	}
-
-	batch := &pgx.Batch{}
-	for _, evt := range events {
-		// Add event to bloom filter first
-		db.Bloom.AddString(evt.ID)
-
-		batch.Queue(
-			`INSERT INTO events (id, pubkey, created_at, kind, tags, content, sig)
-             VALUES ($1, $2, $3, $4, $5, $6, $7)
-             ON CONFLICT (id) DO NOTHING`,
-			evt.ID,
-			evt.PubKey,
-			evt.CreatedAt.Time().Unix(),
-			evt.Kind,
-			evt.Tags,
-			evt.Content,
-			evt.Sig,
-		)
-	}
-
-	results := tx.SendBatch(ctx, batch)
-	if err := results.Close(); err != nil {
-		return fmt.Errorf("batch execution failed: %w", err)
+		return fmt.Errorf("failed to insert event: %w", err)
 	}
-
-	if err := tx.Commit(ctx); err != nil {
-		return fmt.Errorf("transaction commit failed: %w", err)
+	if tag.RowsAffected() == 0 {
+		return ErrDuplicateEvent
 	}
 
 	return nil
 }
 
-// GetReplaceableEvent retrieves the latest replaceable event for a given pubkey and kind.
-func (db *DB) GetReplaceableEvent(ctx context.Context, pubkey string, kind int) (nostr.Event, error) {
+// GetReplaceableEvent retrieves the latest replaceable event of tenant for a given pubkey and kind.
+func (db *DB) GetReplaceableEvent(ctx context.Context, tenant, pubkey string, kind int) (nostr.Event, error) {
 	query := `
 		SELECT id, pubkey, kind, created_at, content, tags, sig
 		FROM events
-		WHERE pubkey = $1 AND kind = $2
+		WHERE pubkey = $1 AND kind = $2 AND tenant = $3
 		ORDER BY created_at DESC
 		LIMIT 1`
 
-	row, err := db.ExecuteQuery(ctx, query, pubkey, kind)
+	row, err := db.ExecuteQuery(ctx, query, pubkey, kind, tenant)
 	if err != nil {
 		return nostr.Event{}, fmt.Errorf("failed to fetch replaceable event: %w", err)
 	}
@@ -229,16 +211,16 @@ func (db *DB) GetReplaceableEvent(ctx context.Context, pubkey string, kind int)
 	return evt, nil
 }
 
-// GetAddressableEvent retrieves the latest addressable event for a given pubkey, kind, and 'd' tag.
-func (db *DB) GetAddressableEvent(ctx context.Context, pubkey string, kind int, dVal string) (nostr.Event, error) {
+// GetAddressableEvent retrieves the latest addressable event of tenant for a given pubkey, kind, and 'd' tag.
+func (db *DB) GetAddressableEvent(ctx context.Context, tenant, pubkey string, kind int, dVal string) (nostr.Event, error) {
 	query := `
 		SELECT id, pubkey, kind, created_at, content, tags, sig
 		FROM events
-		WHERE pubkey = $1 AND kind = $2 AND tags @> $3
+		WHERE pubkey = $1 AND kind = $2 AND tags @> $3 AND tenant = $4
 		ORDER BY created_at DESC
 		LIMIT 1`
 
-	row, err := db.ExecuteQuery(ctx, query, pubkey, kind, fmt.Sprintf(`[["d", "%s"]]`, dVal))
+	row, err := db.ExecuteQuery(ctx, query, pubkey, kind, fmt.Sprintf(`[["d", "%s"]]`, dVal), tenant)
 	if err != nil {
 		return nostr.Event{}, fmt.Errorf("failed to fetch addressable event: %w", err)
 	}
@@ -330,26 +312,30 @@ func (db *DB) StartExpiredEventsCleaner(ctx context.Context, interval time.Durat
 	}()
 }
 
-// GetEventCount returns the count of events matching the given filter
-func (db *DB) GetEventCount(ctx context.Context, filter nostr.Filter) (int64, error) {
+// GetEventCount returns the count of the events of tenant matching the given filter
+func (db *DB) GetEventCount(ctx context.Context, tenant string, filter nostr.Filter) (int64, error) {
+	return db.countEvents(ctx, tenant, filter, nil)
+}
+
+// countEvents is GetEventCount leaving out the events of excludeKinds
+func (db *DB) countEvents(ctx context.Context, tenant string, filter nostr.Filter, excludeKinds []int) (int64, error) {
 	// PERFORMANCE: Create a query builder with reasonable capacity
 	query := strings.Builder{}
 	query.Grow(256) // Pre-allocate string builder capacity
 	args := make([]interface{}, 0, 10)
 	argIndex := 1
 
-	// Start with base SELECT COUNT
-	query.WriteString(`SELECT COUNT(*) FROM events`)
+	// Start with base SELECT COUNT, never counting other tenants' events
+	query.WriteString(`SELECT COUNT(*) FROM events WHERE tenant = $1`)
+	args = append(args, tenant)
+	argIndex++
+
+	// The "#unlocked" vendor filter is a capsule_unlocks lookup, not a tag
+	unlockedCapsules := nips.WantsUnlockedCapsules(filter)
+	filter = nips.WithoutUnlockedFilter(filter)
 
-	// Track if we need to add WHERE
-	needsWhere := false
 	addWhere := func() {
-		if !needsWhere {
-			query.WriteString(` WHERE `)
-			needsWhere = true
-		} else {
-			query.WriteString(` AND `)
-		}
+		query.WriteString(` AND `)
 	}
 
 	// Add filters in order of index selectivity
@@ -382,6 +368,13 @@ func (db *DB) GetEventCount(ctx context.Context, filter nostr.Filter) (int64, er
 		argIndex++
 	}
 
+	if len(excludeKinds) > 0 {
+		addWhere()
+		query.WriteString(fmt.Sprintf("kind <> ALL($%d)", argIndex))
+		args = append(args, excludeKinds)
+		argIndex++
+	}
+
 	// Always apply time filters after key/author filters
 	if hasSinceFilter {
 		addWhere()
@@ -414,14 +407,31 @@ func (db *DB) GetEventCount(ctx context.Context, filter nostr.Filter) (int64, er
 		}
 	}
 
+	if unlockedCapsules {
+		addWhere()
+		query.WriteString("id IN (SELECT event_id FROM capsule_unlocks WHERE tenant = $1 AND unlocked = true)")
+	}
+
 	// Log the query for debugging
 	logger.Debug("Executing count query",
 		zap.String("query", query.String()),
 		zap.Int("arg_count", len(args)))
 
+	if err := db.allow(); err != nil {
+		return 0, err
+	}
+
+	// Wait for a slot so bursts of reads can't exhaust the pool
+	release, err := db.acquireQuery(ctx, QueryWeight(filter))
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
 	// Execute query with timeout
 	var count int64
-	err := db.Pool.QueryRow(ctx, query.String(), args...).Scan(&count)
+	err = db.Pool.QueryRow(ctx, query.String(), args...).Scan(&count)
+	db.observe(err)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
 			return 0, fmt.Errorf("count operation timed out")
@@ -432,78 +442,196 @@ func (db *DB) GetEventCount(ctx context.Context, filter nostr.Filter) (int64, er
 	return count, nil
 }
 
-func (db *DB) EventExists(ctx context.Context, eventID string) (bool, error) {
+// EventExists reports whether the event with eventID is stored on tenant
+func (db *DB) EventExists(ctx context.Context, tenant, eventID string) (bool, error) {
+	if err := db.allow(); err != nil {
+		return false, err
+	}
 	var exists bool
 	err := db.Pool.QueryRow(ctx,
-		`SELECT EXISTS(SELECT 1 FROM events WHERE id = $1)`,
-		eventID,
+		`SELECT EXISTS(SELECT 1 FROM events WHERE tenant = $1 AND id = $2)`,
+		tenant, eventID,
 	).Scan(&exists)
+	db.observe(err)
 	return exists, err
 }
 
-func (db *DB) InsertReplaceableEvent(ctx context.Context, evt nostr.Event) error {
-	// First, delete any existing replaceable event for this pubkey and kind
-	_, err := db.Pool.Exec(ctx,
+// ErrDuplicateEvent is returned when the event is already stored
+var ErrDuplicateEvent = errors.New("event already stored")
+
+// ErrStaleReplaceable is returned when a newer version of a replaceable or
+// addressable event is already stored, so the incoming one is discarded
+var ErrStaleReplaceable = errors.New("newer replaceable event already stored")
+
+// InsertReplaceableEvent stores evt as the only version for its (pubkey, kind) in
+// tenant, per NIP-01: the newest created_at wins and ties keep the lowest id.
+func (db *DB) InsertReplaceableEvent(ctx context.Context, tenant string, evt nostr.Event) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil && !errors.Is(rollbackErr, pgx.ErrTxClosed) {
+			db.recordError(fmt.Errorf("rollback failed: %w", rollbackErr))
+		}
+	}()
+
+	createdAt := evt.CreatedAt.Time().Unix()
+
+	// Keep the stored version if it supersedes the incoming one
+	var newer bool
+	err = tx.QueryRow(ctx,
+		`SELECT EXISTS (
+		   SELECT 1 FROM events
+		   WHERE pubkey = $1 AND kind = $2 AND tenant = $5
+		     AND (created_at > $3 OR (created_at = $3 AND id <= $4))
+		 )`,
+		evt.PubKey, evt.Kind, createdAt, evt.ID, tenant).Scan(&newer)
+	if err != nil {
+		return fmt.Errorf("failed to check replaceable event: %w", err)
+	}
+	if newer {
+		return ErrStaleReplaceable
+	}
+
+	// Delete the older versions for this pubkey and kind
+	_, err = tx.Exec(ctx,
 		`DELETE FROM events 
-		 WHERE pubkey = $1 AND kind = $2`,
-		evt.PubKey, evt.Kind)
+		 WHERE pubkey = $1 AND kind = $2 AND tenant = $3`,
+		evt.PubKey, evt.Kind, tenant)
 	if err != nil {
 		return fmt.Errorf("failed to delete old replaceable event: %w", err)
 	}
 
 	// Then insert the new event
-	_, err = db.Pool.Exec(ctx,
-		`INSERT INTO events (id, pubkey, created_at, kind, tags, content, sig)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
-		evt.ID, evt.PubKey, evt.CreatedAt.Time().Unix(),
-		evt.Kind, evt.Tags, evt.Content, evt.Sig)
+	_, err = tx.Exec(ctx,
+		`INSERT INTO events (id, pubkey, created_at, kind, tags, content, sig, tenant)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		evt.ID, evt.PubKey, createdAt,
+		evt.Kind, evt.Tags, evt.Content, evt.Sig, tenant)
 	if err != nil {
 		return fmt.Errorf("failed to insert new replaceable event: %w", err)
 	}
 
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
 	// Add to Bloom filter
-	db.Bloom.AddString(evt.ID)
+	db.Bloom.AddString(DedupKey(tenant, evt.ID))
 
 	return nil
 }
 
-// InsertAddressableEvent upserts (pubkey, kind, dTag) = unique
-func (db *DB) InsertAddressableEvent(ctx context.Context, evt nostr.Event) error {
+// latestReplaceable drops all but the newest version of each replaceable
+// (pubkey, kind) and addressable (pubkey, kind, d) from events, in case older
+// versions linger in storage
+func latestReplaceable(events []nostr.Event) []nostr.Event {
+	latest := make(map[string]int)
+	for i, evt := range events {
+		key, ok := versionKey(evt)
+		if !ok {
+			continue
+		}
+		j, seen := latest[key]
+		if !seen || evt.CreatedAt > events[j].CreatedAt ||
+			(evt.CreatedAt == events[j].CreatedAt && evt.ID < events[j].ID) {
+			latest[key] = i
+		}
+	}
+	if len(latest) == 0 {
+		return events
+	}
+
+	kept := events[:0]
+	for i, evt := range events {
+		if key, ok := versionKey(evt); ok && latest[key] != i {
+			continue
+		}
+		kept = append(kept, evt)
+	}
+	return kept
+}
+
+// InsertAddressableEvent upserts (pubkey, kind, dTag) = unique within tenant,
+// keeping the newest version like InsertReplaceableEvent
+func (db *DB) InsertAddressableEvent(ctx context.Context, tenant string, evt nostr.Event) error {
 	dVal := nips.GetTagValue(evt, "d")
 	if dVal == "" {
-		return db.InsertEvent(ctx, evt) // fallback
+		return db.InsertEvent(ctx, tenant, evt) // fallback
+	}
+	dTag, err := json.Marshal([][]string{{"d", dVal}})
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil && !errors.Is(rollbackErr, pgx.ErrTxClosed) {
+			db.recordError(fmt.Errorf("rollback failed: %w", rollbackErr))
+		}
+	}()
+
+	createdAt := evt.CreatedAt.Time().Unix()
+
+	var newer bool
+	err = tx.QueryRow(ctx,
+		`SELECT EXISTS (
+		   SELECT 1 FROM events
+		   WHERE pubkey = $1 AND kind = $2 AND tags @> $3 AND tenant = $6
+		     AND (created_at > $4 OR (created_at = $4 AND id <= $5))
+		 )`,
+		evt.PubKey, evt.Kind, string(dTag), createdAt, evt.ID, tenant).Scan(&newer)
+	if err != nil {
+		return fmt.Errorf("failed to check addressable event: %w", err)
+	}
+	if newer {
+		return ErrStaleReplaceable
 	}
 
-	_, err := db.Pool.Exec(ctx,
+	_, err = tx.Exec(ctx,
 		`DELETE FROM events 
-         WHERE pubkey=$1 AND kind=$2 AND tags @> $3`,
-		evt.PubKey, evt.Kind, fmt.Sprintf(`[["d","%s"]]`, dVal),
+         WHERE pubkey=$1 AND kind=$2 AND tags @> $3 AND tenant=$4`,
+		evt.PubKey, evt.Kind, string(dTag), tenant,
 	)
 	if err != nil {
 		return err
 	}
 
-	_, err = db.Pool.Exec(ctx,
-		`INSERT INTO events (id,pubkey,created_at,kind,tags,content,sig)
-         VALUES ($1,$2,$3,$4,$5,$6,$7)`,
-		evt.ID, evt.PubKey, evt.CreatedAt.Time().Unix(),
-		evt.Kind, evt.Tags, evt.Content, evt.Sig,
+	_, err = tx.Exec(ctx,
+		`INSERT INTO events (id,pubkey,created_at,kind,tags,content,sig,tenant)
+         VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`,
+		evt.ID, evt.PubKey, createdAt,
+		evt.Kind, evt.Tags, evt.Content, evt.Sig, tenant,
 	)
-	if err == nil {
-		db.Bloom.AddString(evt.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
 	}
-	return err
+	db.Bloom.AddString(DedupKey(tenant, evt.ID))
+	return nil
 }
 
-func (db *DB) persistDeletion(ctx context.Context, del nostr.Event) error {
-	var ids []string
+// persistDeletion stores the NIP-09 deletion del of tenant, deleting the events
+// it names there and nowhere else
+func (db *DB) persistDeletion(ctx context.Context, tenant string, del nostr.Event) error {
+	var ids, addrs []string
 	for _, t := range del.Tags {
 		if len(t) >= 2 && t[0] == "e" {
 			ids = append(ids, t[1])
 		}
+		if len(t) >= 2 && t[0] == "a" {
+			addrs = append(addrs, t[1])
+		}
 	}
-	if len(ids) == 0 {
-		return errors.New("deletion event without e‑tags")
+	if len(ids) == 0 && len(addrs) == 0 {
+		return errors.New("deletion event without e‑tags or a‑tags")
 	}
 
 	tx, err := db.Pool.Begin(ctx)
@@ -516,20 +644,64 @@ func (db *DB) persistDeletion(ctx context.Context, del nostr.Event) error {
 		}
 	}()
 
-	// 1) delete only events OWNED by the deleter
-	_, err = tx.Exec(ctx,
-		`DELETE FROM events WHERE id = ANY($1) AND pubkey = $2`,
-		ids, del.PubKey)
+	// 1) delete only events OWNED by the deleter; NIP-62 requests to vanish
+	// can't be taken back
+	deleted, err := deleteReturningIDs(ctx, tx,
+		`DELETE FROM events WHERE id = ANY($1) AND pubkey = $2 AND tenant = $3 AND kind <> $4 RETURNING id`,
+		ids, del.PubKey, tenant, nips.KindVanishRequest)
 	if err != nil {
 		return err
 	}
 
+	// 1b) delete every version of addressed events OWNED by the deleter
+	// that isn't newer than the deletion itself
+	for _, addr := range addrs {
+		kind, pubkey, d, err := nips.ParseDeletionAddress(addr)
+		if err != nil || pubkey != del.PubKey {
+			continue
+		}
+		var versions []string
+		if nips.IsReplaceable(kind) {
+			versions, err = deleteReturningIDs(ctx, tx,
+				`DELETE FROM events WHERE kind = $1 AND pubkey = $2 AND created_at <= $3 AND tenant = $4 RETURNING id`,
+				kind, pubkey, del.CreatedAt.Time().Unix(), tenant)
+		} else if d == "" {
+			// An addressable event without a d tag has d="" (NIP-01)
+			versions, err = deleteReturningIDs(ctx, tx,
+				`DELETE FROM events WHERE kind = $1 AND pubkey = $2
+				   AND COALESCE(jsonb_path_query_first(tags, '$[*]?(@[0] == "d")[1]') #>> '{}', '') = ''
+				   AND created_at <= $3 AND tenant = $4 RETURNING id`,
+				kind, pubkey, del.CreatedAt.Time().Unix(), tenant)
+		} else {
+			dTag, _ := json.Marshal([][]string{{"d", d}})
+			versions, err = deleteReturningIDs(ctx, tx,
+				`DELETE FROM events WHERE kind = $1 AND pubkey = $2 AND tags @> $3 AND created_at <= $4 AND tenant = $5 RETURNING id`,
+				kind, pubkey, string(dTag), del.CreatedAt.Time().Unix(), tenant)
+		}
+		if err != nil {
+			return err
+		}
+		deleted = append(deleted, versions...)
+	}
+
+	// 1c) remember what was deleted so interactions with it can be hidden, stop
+	// counting deleted spam reports and attesting deleted events
+	if err := recordDeletedIDs(ctx, tx, tenant, deleted, del); err != nil {
+		return err
+	}
+	if err := forgetSpamReports(ctx, tx, tenant, deleted); err != nil {
+		return err
+	}
+	if err := forgetEventReceipts(ctx, tx, tenant, deleted); err != nil {
+		return err
+	}
+
 	// 2) insert the deletion event itself
 	_, err = tx.Exec(ctx,
-		`INSERT INTO events (id,pubkey,created_at,kind,tags,content,sig)
-		 VALUES ($1,$2,$3,$4,$5,$6,$7)`,
+		`INSERT INTO events (id,pubkey,created_at,kind,tags,content,sig,tenant)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`,
 		del.ID, del.PubKey, del.CreatedAt.Time().Unix(),
-		del.Kind, del.Tags, del.Content, del.Sig)
+		del.Kind, del.Tags, del.Content, del.Sig, tenant)
 	if err != nil {
 		return err
 	}
@@ -537,8 +709,11 @@ func (db *DB) persistDeletion(ctx context.Context, del nostr.Event) error {
 	if err := tx.Commit(ctx); err != nil {
 		return err
 	}
+	if tenant == DefaultTenant {
+		db.forgetDeletion(del, ids)
+	}
 
-	db.Bloom.AddString(del.ID)
+	db.Bloom.AddString(DedupKey(tenant, del.ID))
 	return nil
 }
 
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/metrics"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"golang.org/x/sync/semaphore"
+)
+
+// ErrQueriesBusy is returned when a GetEvents or GetEventCount query found no
+// capacity within the queue timeout
+var ErrQueriesBusy = errors.New("too many concurrent queries")
+
+// queryLimiter bounds the weight of GetEvents and GetEventCount queries running at
+// once, so expensive reads can't take every pool connection and starve writes
+type queryLimiter struct {
+	sem          *semaphore.Weighted
+	capacity     int64
+	queueTimeout time.Duration
+}
+
+// LimitQueryConcurrency bounds the total weight (see QueryWeight) of GetEvents and
+// GetEventCount queries running at once to capacity, or to half the connection
+// pool when capacity is 0. Queries over capacity wait up to queueTimeout for a
+// slot, or are rejected at once when it is 0. Must be called before queries run.
+func (db *DB) LimitQueryConcurrency(capacity int64, queueTimeout time.Duration) {
+	if capacity <= 0 {
+		capacity = int64(db.Pool.Config().MaxConns / 2)
+	}
+	if capacity < 1 {
+		capacity = 1
+	}
+	db.queries = &queryLimiter{
+		sem:          semaphore.NewWeighted(capacity),
+		capacity:     capacity,
+		queueTimeout: queueTimeout,
+	}
+}
+
+// QueryWeight estimates the cost of a filter's query: id and author lookups use
+// an index directly, filters without either scan by kind, time or tags, and
+// full-text searches are the most expensive
+func QueryWeight(f nostr.Filter) int64 {
+	switch {
+	case f.Search != "":
+		return 3
+	case len(f.IDs) > 0 || len(f.Authors) > 0:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// acquireQuery waits for capacity to run a query of weight and returns the func
+// releasing it. It returns ErrQueriesBusy when the queue timeout passes first,
+// and ctx's error when ctx is done while waiting.
+func (db *DB) acquireQuery(ctx context.Context, weight int64) (func(), error) {
+	limiter := db.queries
+	if limiter == nil {
+		return func() {}, nil
+	}
+	if weight > limiter.capacity {
+		weight = limiter.capacity
+	}
+
+	if limiter.queueTimeout <= 0 {
+		if !limiter.sem.TryAcquire(weight) {
+			metrics.DBQueriesRejected.Inc()
+			return nil, ErrQueriesBusy
+		}
+	} else {
+		waitCtx, cancel := context.WithTimeout(ctx, limiter.queueTimeout)
+		err := limiter.sem.Acquire(waitCtx, weight)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			metrics.DBQueriesRejected.Inc()
+			return nil, ErrQueriesBusy
+		}
+	}
+
+	metrics.DBQueriesInFlight.Add(float64(weight))
+	return func() {
+		metrics.DBQueriesInFlight.Sub(float64(weight))
+		limiter.sem.Release(weight)
+	}, nil
+}
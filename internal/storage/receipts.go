@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrReceiptNotFound is returned when no receive time was recorded for an event
+var ErrReceiptNotFound = errors.New("event receipt not found")
+
+// RecordEventReceipt stores the unix time at which the relay accepted an event
+// on tenant. The first recorded time wins so attestations stay stable.
+func (db *DB) RecordEventReceipt(ctx context.Context, tenant, eventID string, receivedAt int64) error {
+	_, err := db.Pool.Exec(ctx,
+		`INSERT INTO event_receipts (tenant, event_id, received_at)
+		 VALUES ($1, $2, $3)
+		 ON CONFLICT (tenant, event_id) DO NOTHING`,
+		tenant, eventID, receivedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record event receipt: %w", err)
+	}
+	return nil
+}
+
+// EventReceipt is when the relay accepted an event, and the attestation it
+// signed for it, nil until one is requested
+type EventReceipt struct {
+	ReceivedAt  int64
+	Attestation []byte
+}
+
+// GetEventReceipt returns when the relay accepted an event on tenant
+func (db *DB) GetEventReceipt(ctx context.Context, tenant, eventID string) (EventReceipt, error) {
+	var receipt EventReceipt
+	err := db.Pool.QueryRow(ctx,
+		`SELECT received_at, attestation FROM event_receipts WHERE tenant = $1 AND event_id = $2`,
+		tenant, eventID).Scan(&receipt.ReceivedAt, &receipt.Attestation)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return EventReceipt{}, ErrReceiptNotFound
+	}
+	if err != nil {
+		return EventReceipt{}, fmt.Errorf("failed to load event receipt: %w", err)
+	}
+	return receipt, nil
+}
+
+// StoreEventAttestation keeps the attestation signed for an event on tenant
+// and returns the one stored, which is an earlier one when another request
+// signed it first
+func (db *DB) StoreEventAttestation(ctx context.Context, tenant, eventID string, attestation []byte) ([]byte, error) {
+	var stored []byte
+	err := db.Pool.QueryRow(ctx,
+		`UPDATE event_receipts SET attestation = COALESCE(attestation, $3)
+		 WHERE tenant = $1 AND event_id = $2
+		 RETURNING attestation`,
+		tenant, eventID, attestation).Scan(&stored)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrReceiptNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to store event attestation: %w", err)
+	}
+	return stored, nil
+}
+
+// forgetEventReceipts drops the receipts of the events among ids, deleted from
+// tenant, so they are no longer attested
+func forgetEventReceipts(ctx context.Context, tx pgx.Tx, tenant string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM event_receipts WHERE tenant = $1 AND event_id = ANY($2)`, tenant, ids); err != nil {
+		return fmt.Errorf("failed to forget event receipts: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+package storage
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/metrics"
+	"github.com/Shugur-Network/relay/internal/relay/nips"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+const (
+	// recentCacheKinds bounds how many kinds the recent events cache keeps, the
+	// least recently queried one giving way to a new one
+	recentCacheKinds = 16
+	// recentCacheTTL is how long a kind is served before it is reloaded, bounding
+	// how long events stored or deleted through other nodes can be missed
+	recentCacheTTL = time.Minute
+)
+
+// recentKind holds the newest events of one kind, oldest first. Every stored event
+// of the kind created after floor is in events.
+type recentKind struct {
+	events []nostr.Event
+	ids    map[string]bool
+	floor  int64
+	// loadedAt is when the kind was loaded from the database, zero while loading
+	loadedAt time.Time
+	// forgotten maps the ids deleted while loading to their owner, dropped from
+	// what is loaded
+	forgotten map[string]string
+	usedAt    time.Time
+}
+
+// recentCache answers REQs for the latest events of common kinds from memory
+type recentCache struct {
+	mu      sync.Mutex
+	perKind int
+	kinds   map[int]*recentKind
+}
+
+// EnableRecentCache keeps up to size of the newest events in memory, split across
+// the most queried kinds, and answers REQs they fully cover without the database.
+// Must be called before events are stored or queried.
+func (db *DB) EnableRecentCache(size int) {
+	perKind := size / recentCacheKinds
+	if perKind < 1 {
+		perKind = 1
+	}
+	db.recent = &recentCache{perKind: perKind, kinds: make(map[int]*recentKind)}
+}
+
+// cacheableKind reports whether events of kind can be cached: replaceable and
+// addressable versions are replaced in place, ephemeral events aren't stored and
+// time capsules are hydrated and unlocked separately
+func cacheableKind(kind int) bool {
+	return !nips.IsReplaceable(kind) && !nips.IsParameterizedReplaceableKind(kind) &&
+		!nips.IsEphemeral(kind) && !nips.IsTimeCapsuleKind(kind)
+}
+
+// recentEvents answers f from the cache, oldest first, when the cached events of
+// its kinds hold every event GetEvents would return. Kinds not cached yet are
+// loaded in the background and f is left to the database.
+func (db *DB) recentEvents(f nostr.Filter, cf *CompiledFilter) ([]nostr.Event, bool) {
+	c := db.recent
+	if c == nil || len(f.Kinds) == 0 || len(f.IDs) > 0 || f.Search != "" || cf.UnlockedCapsules {
+		return nil, false
+	}
+	for _, kind := range f.Kinds {
+		if !cacheableKind(kind) {
+			return nil, false
+		}
+	}
+
+	f = withoutEmptyTags(f)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Without the database expired kinds are served as they are, and nothing is
+	// loaded
+	now := time.Now()
+	degraded := !db.Available()
+	floor := int64(math.MinInt64)
+	kinds := make(map[int]*recentKind, len(f.Kinds))
+	ready := true
+	for _, kind := range f.Kinds {
+		rk := c.kinds[kind]
+		if rk == nil || (!degraded && !rk.loadedAt.IsZero() && now.Sub(rk.loadedAt) > recentCacheTTL) {
+			if !degraded {
+				c.load(db, kind, now)
+			}
+			ready = false
+			continue
+		}
+		rk.usedAt = now
+		if rk.loadedAt.IsZero() {
+			ready = false
+			continue
+		}
+		kinds[kind] = rk
+		if rk.floor > floor {
+			floor = rk.floor
+		}
+	}
+	if !ready {
+		metrics.RecentCacheMisses.Inc()
+		return nil, false
+	}
+
+	// Only events newer than every kind's floor are known to be complete
+	var matches []nostr.Event
+	for _, rk := range kinds {
+		for i := len(rk.events) - 1; i >= 0; i-- {
+			evt := &rk.events[i]
+			if int64(evt.CreatedAt) <= floor {
+				break
+			}
+			if f.Matches(evt) && !nips.IsExpired(*evt) {
+				matches = append(matches, *evt)
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].CreatedAt < matches[j].CreatedAt
+	})
+
+	// Since-only filters take the oldest events, the rest the newest
+	complete := f.Since != nil && int64(*f.Since) > floor
+	switch {
+	case f.Since != nil && f.Until == nil:
+		if !complete {
+			metrics.RecentCacheMisses.Inc()
+			return nil, false
+		}
+		if len(matches) > cf.Limit {
+			matches = matches[:cf.Limit]
+		}
+	case len(matches) >= cf.Limit:
+		matches = matches[len(matches)-cf.Limit:]
+	case !complete:
+		metrics.RecentCacheMisses.Inc()
+		return nil, false
+	}
+
+	metrics.RecentCacheHits.Inc()
+	if matches == nil {
+		matches = []nostr.Event{}
+	}
+	return matches, true
+}
+
+// withoutEmptyTags drops the tag lists of f that are empty, which don't restrict
+// the database query but would match nothing in nostr.Filter.Matches
+func withoutEmptyTags(f nostr.Filter) nostr.Filter {
+	tags := make(nostr.TagMap, len(f.Tags))
+	for name, values := range f.Tags {
+		if len(values) > 0 {
+			tags[name] = values
+		}
+	}
+	f.Tags = tags
+	return f
+}
+
+// load starts loading kind from the database, replacing what was cached for it.
+// The caller must hold c.mu.
+func (c *recentCache) load(db *DB, kind int, now time.Time) {
+	if _, ok := c.kinds[kind]; !ok && len(c.kinds) >= recentCacheKinds {
+		oldest := -1
+		for k, rk := range c.kinds {
+			if oldest == -1 || rk.usedAt.Before(c.kinds[oldest].usedAt) {
+				oldest = k
+			}
+		}
+		delete(c.kinds, oldest)
+	}
+
+	rk := &recentKind{
+		ids:       make(map[string]bool),
+		floor:     math.MinInt64,
+		forgotten: make(map[string]string),
+		usedAt:    now,
+	}
+	c.kinds[kind] = rk
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultQueryTimeout)
+		defer cancel()
+		events, err := db.GetEvents(ctx, DefaultTenant, nostr.Filter{Kinds: []int{kind}, Limit: c.perKind})
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.kinds[kind] != rk {
+			return
+		}
+		if err != nil {
+			logger.Debug("Failed to load recent events", zap.Int("kind", kind), zap.Error(err))
+			delete(c.kinds, kind)
+			return
+		}
+
+		// A full page may have left out older events as old as its oldest one
+		if len(events) >= c.perKind {
+			rk.floor = int64(events[0].CreatedAt)
+		}
+		for _, evt := range events {
+			if owner, ok := rk.forgotten[evt.ID]; !ok || owner != evt.PubKey {
+				rk.insert(evt)
+			}
+		}
+		rk.trim(c.perKind)
+		rk.forgotten = nil
+		rk.loadedAt = time.Now()
+	}()
+}
+
+// add caches a newly stored event when its kind is cached
+func (c *recentCache) add(evt nostr.Event) {
+	if c == nil || !cacheableKind(evt.Kind) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rk := c.kinds[evt.Kind]
+	if rk == nil || int64(evt.CreatedAt) <= rk.floor {
+		return
+	}
+	rk.insert(evt)
+	rk.trim(c.perKind)
+}
+
+// forget drops the events with ids deleted by pubkey
+func (c *recentCache) forget(pubkey string, ids []string) {
+	if c == nil || len(ids) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rk := range c.kinds {
+		for _, id := range ids {
+			if rk.forgotten != nil {
+				rk.forgotten[id] = pubkey
+			}
+			if !rk.ids[id] {
+				continue
+			}
+			for i := range rk.events {
+				if rk.events[i].ID == id && rk.events[i].PubKey == pubkey {
+					rk.events = append(rk.events[:i], rk.events[i+1:]...)
+					delete(rk.ids, id)
+					break
+				}
+			}
+		}
+	}
+}
+
+// insert adds evt in created_at order unless it is already cached
+func (rk *recentKind) insert(evt nostr.Event) {
+	if rk.ids[evt.ID] {
+		return
+	}
+	i := sort.Search(len(rk.events), func(i int) bool {
+		return rk.events[i].CreatedAt > evt.CreatedAt
+	})
+	rk.events = append(rk.events, nostr.Event{})
+	copy(rk.events[i+1:], rk.events[i:])
+	rk.events[i] = evt
+	rk.ids[evt.ID] = true
+}
+
+// trim drops events no newer than floor, then the oldest beyond limit, raising
+// floor to the newest one dropped
+func (rk *recentKind) trim(limit int) {
+	drop := sort.Search(len(rk.events), func(i int) bool {
+		return int64(rk.events[i].CreatedAt) > rk.floor
+	})
+	if over := len(rk.events) - drop - limit; over > 0 {
+		rk.floor = int64(rk.events[drop+over-1].CreatedAt)
+		drop = sort.Search(len(rk.events), func(i int) bool {
+			return int64(rk.events[i].CreatedAt) > rk.floor
+		})
+	}
+	if drop == 0 {
+		return
+	}
+	for _, evt := range rk.events[:drop] {
+		delete(rk.ids, evt.ID)
+	}
+	n := copy(rk.events, rk.events[drop:])
+	clear(rk.events[n:])
+	rk.events = rk.events[:n]
+}
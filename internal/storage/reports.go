@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/relay/nips"
+	"github.com/jackc/pgx/v5"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+// ErrReportsNotFound is returned when resolving a target nobody reported
+var ErrReportsNotFound = errors.New("target has no reports")
+
+// ErrReportedEventNotFound is returned when the author of a reported event is
+// looked up and the event isn't stored
+var ErrReportedEventNotFound = errors.New("reported event is not stored")
+
+// openReport is the condition for a report r being open: received after its
+// target, and the reported pubkey, were last resolved (rt and rp)
+const openReport = `r.received_at > COALESCE(rt.resolved_at, 0) AND r.received_at > COALESCE(rp.resolved_at, 0)`
+
+// openReportJoins joins the resolutions openReport checks
+const openReportJoins = `LEFT JOIN report_resolutions rt ON rt.target = r.target
+	LEFT JOIN report_resolutions rp ON rp.target = r.pubkey`
+
+// ReportedTarget is an event or pubkey in the moderation queue, with its open
+// reports
+type ReportedTarget struct {
+	Target string `json:"target"`
+	// Type is "event" or "pubkey"
+	Type string `json:"type"`
+	// PubKey is the reported pubkey, the author of a reported event
+	PubKey         string   `json:"pubkey"`
+	Reporters      int64    `json:"reporters"`
+	ReportTypes    []string `json:"report_types"`
+	LastReportedAt int64    `json:"last_reported_at"`
+	// Action is "shadow-ban" or "blacklist" while the reported pubkey is
+	// suspended that way
+	Action string `json:"action,omitempty"`
+}
+
+// Report is one report of a target
+type Report struct {
+	ID         string `json:"id"`
+	PubKey     string `json:"pubkey"`
+	Reporter   string `json:"reporter"`
+	ReportType string `json:"report_type,omitempty"`
+	Content    string `json:"content,omitempty"`
+	ReceivedAt int64  `json:"received_at"`
+	Open       bool   `json:"open"`
+}
+
+// ReportResolution is a moderator's decision on a reported target, closing the
+// reports received until ResolvedAt
+type ReportResolution struct {
+	Target     string `json:"target"`
+	Action     string `json:"action"`
+	Note       string `json:"note,omitempty"`
+	ResolvedAt int64  `json:"resolved_at"`
+}
+
+// EnableReportQueue makes the processor record the events and pubkeys new
+// NIP-56 reports of the main relay report, for the moderation queue. Must be
+// called before events are queued.
+func (ep *EventProcessor) EnableReportQueue() {
+	ep.queueReports = true
+}
+
+// queueReport records what a newly stored report reports
+func (ep *EventProcessor) queueReport(evt nostr.Event) {
+	targets := nips.ReportTargets(&evt)
+	if len(targets) == 0 {
+		return
+	}
+	ids := make([]string, len(targets))
+	types := make([]string, len(targets))
+	pubkeys := make([]string, len(targets))
+	reportTypes := make([]string, len(targets))
+	for i, t := range targets {
+		ids[i], pubkeys[i], reportTypes[i] = t.ID, t.PubKey, t.ReportType
+		types[i] = "pubkey"
+		if t.Event {
+			types[i] = "event"
+		}
+	}
+
+	// Reports count from when they arrive, so a backdated one can't land
+	// before the last resolution. A reported event's author is the stored
+	// event's; reports of events not stored count against nobody.
+	ctx, cancel := context.WithTimeout(ep.ctx, 3*time.Second)
+	defer cancel()
+	if _, err := ep.db.Pool.Exec(ctx,
+		`UPSERT INTO reports (report_id, target, target_type, pubkey, reporter, report_type, received_at)
+		 SELECT $1::STRING, t.target, t.target_type, COALESCE(e.pubkey, t.pubkey), $2::STRING, t.report_type, $3::INT8
+		 FROM unnest($4::STRING[], $5::STRING[], $6::STRING[], $7::STRING[]) AS t(target, target_type, pubkey, report_type)
+		 LEFT JOIN events e ON t.target_type = 'event' AND e.tenant = $8 AND e.id = t.target`,
+		evt.ID, evt.PubKey, time.Now().Unix(), ids, types, pubkeys, reportTypes, DefaultTenant); err != nil {
+		logger.Warn("Failed to queue report", zap.String("event_id", evt.ID), zap.Error(err))
+	}
+}
+
+// GetReportQueue returns up to limit targets with open reports, those reported
+// by the most pubkeys first
+func (db *DB) GetReportQueue(ctx context.Context, limit int) ([]ReportedTarget, error) {
+	if err := db.allow(); err != nil {
+		return nil, err
+	}
+	rows, err := db.Pool.Query(ctx,
+		`SELECT r.target, r.target_type, r.pubkey, count(DISTINCT r.reporter),
+		        array_agg(DISTINCT r.report_type), max(r.received_at),
+		        CASE WHEN s.pubkey IS NULL THEN '' WHEN s.shadow THEN 'shadow-ban' ELSE 'blacklist' END
+		 FROM reports r `+openReportJoins+`
+		 LEFT JOIN suspended_pubkeys s ON s.pubkey = r.pubkey
+		 WHERE `+openReport+`
+		 GROUP BY r.target, r.target_type, r.pubkey, s.pubkey, s.shadow
+		 ORDER BY 4 DESC, 6 DESC
+		 LIMIT $1`,
+		limit)
+	db.observe(err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load report queue: %w", err)
+	}
+	defer rows.Close()
+
+	queue := []ReportedTarget{}
+	for rows.Next() {
+		var t ReportedTarget
+		var reportTypes []string
+		if err := rows.Scan(&t.Target, &t.Type, &t.PubKey, &t.Reporters, &reportTypes, &t.LastReportedAt, &t.Action); err != nil {
+			return nil, fmt.Errorf("failed to scan reported target: %w", err)
+		}
+		t.ReportTypes = []string{}
+		for _, reportType := range reportTypes {
+			if reportType != "" {
+				t.ReportTypes = append(t.ReportTypes, reportType)
+			}
+		}
+		queue = append(queue, t)
+	}
+	return queue, rows.Err()
+}
+
+// GetReports returns up to limit reports of target, newest first, with the
+// report's content while the report is stored
+func (db *DB) GetReports(ctx context.Context, target string, limit int) ([]Report, error) {
+	if err := db.allow(); err != nil {
+		return nil, err
+	}
+	rows, err := db.Pool.Query(ctx,
+		`SELECT r.report_id, r.pubkey, r.reporter, r.report_type, COALESCE(e.content, ''), r.received_at, `+openReport+`
+		 FROM reports r `+openReportJoins+`
+		 LEFT JOIN events e ON e.id = r.report_id AND e.tenant = $3
+		 WHERE r.target = $1
+		 ORDER BY r.received_at DESC
+		 LIMIT $2`,
+		target, limit, DefaultTenant)
+	db.observe(err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load reports: %w", err)
+	}
+	defer rows.Close()
+
+	reports := []Report{}
+	for rows.Next() {
+		var r Report
+		if err := rows.Scan(&r.ID, &r.PubKey, &r.Reporter, &r.ReportType, &r.Content, &r.ReceivedAt, &r.Open); err != nil {
+			return nil, fmt.Errorf("failed to scan report: %w", err)
+		}
+		reports = append(reports, r)
+	}
+	return reports, rows.Err()
+}
+
+// ResolveReports records a moderator's decision on a target, closing its
+// reports received until then
+func (db *DB) ResolveReports(ctx context.Context, res ReportResolution) error {
+	tag, err := db.Pool.Exec(ctx,
+		`UPSERT INTO report_resolutions (target, action, note, resolved_at)
+		 SELECT $1::STRING, $2::STRING, $3::STRING, $4::INT8 WHERE EXISTS (SELECT 1 FROM reports WHERE target = $1 OR pubkey = $1)`,
+		res.Target, res.Action, res.Note, res.ResolvedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record resolution: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrReportsNotFound
+	}
+	return nil
+}
+
+// GetReportedPubkey returns the pubkey the reports of target report: target
+// itself for a pubkey, the stored author for an event
+func (db *DB) GetReportedPubkey(ctx context.Context, target string) (string, error) {
+	if err := db.allow(); err != nil {
+		return "", err
+	}
+	var targetType, pubkey string
+	err := db.Pool.QueryRow(ctx,
+		`SELECT r.target_type, COALESCE(e.pubkey, '')
+		 FROM reports r
+		 LEFT JOIN events e ON r.target_type = 'event' AND e.tenant = $2 AND e.id = r.target
+		 WHERE r.target = $1
+		 LIMIT 1`,
+		target, DefaultTenant).Scan(&targetType, &pubkey)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return "", ErrReportsNotFound
+	case err != nil:
+		return "", fmt.Errorf("failed to load reported pubkey: %w", err)
+	case targetType == "pubkey":
+		return target, nil
+	case pubkey == "":
+		return "", ErrReportedEventNotFound
+	}
+	return pubkey, nil
+}
+
+// GetReportedPubkeys returns the pubkeys reported, directly or through their
+// events, by minReporters or more of reporters in open reports, with how many
+// reported them
+func (db *DB) GetReportedPubkeys(ctx context.Context, minReporters int, reporters []string) (map[string]int, error) {
+	if err := db.allow(); err != nil {
+		return nil, err
+	}
+	reported := make(map[string]int)
+	if len(reporters) == 0 {
+		return reported, nil
+	}
+	rows, err := db.Pool.Query(ctx,
+		`SELECT r.pubkey, count(DISTINCT r.reporter)
+		 FROM reports r `+openReportJoins+`
+		 WHERE `+openReport+` AND r.pubkey != '' AND r.reporter = ANY($2::STRING[])
+		 GROUP BY r.pubkey
+		 HAVING count(DISTINCT r.reporter) >= $1`,
+		minReporters, reporters)
+	db.observe(err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count reports: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pubkey string
+		var count int
+		if err := rows.Scan(&pubkey, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan reported pubkey: %w", err)
+		}
+		reported[pubkey] = count
+	}
+	return reported, rows.Err()
+}
@@ -0,0 +1,338 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	nostr "github.com/nbd-wtf/go-nostr"
+)
+
+// Revalidation run actions taken on stored events that no longer pass
+const (
+	// RevalidateReport only counts the failing events
+	RevalidateReport = "report"
+	// RevalidateQuarantine moves the failing events to quarantined_events
+	RevalidateQuarantine = "quarantine"
+	// RevalidateDelete deletes the failing events
+	RevalidateDelete = "delete"
+)
+
+// Revalidation run modes, what stored events are checked against
+const (
+	// RevalidatePolicies checks events against the current validation policies
+	RevalidatePolicies = "policies"
+	// RevalidateIntegrity only recomputes event IDs and verifies signatures, to
+	// catch rows corrupted in storage or by an import
+	RevalidateIntegrity = "integrity"
+)
+
+// Revalidation run statuses
+const (
+	RevalidationRunning  = "running"
+	RevalidationDone     = "done"
+	RevalidationFailed   = "failed"
+	RevalidationCanceled = "canceled"
+)
+
+// Revalidation errors
+var (
+	ErrRevalidationRunning  = errors.New("a revalidation run is already in progress")
+	ErrRevalidationNotFound = errors.New("no revalidation run in progress")
+)
+
+// RevalidationRun is one pass re-checking the stored events, in tenant and ID
+// order. CursorTenant and Cursor are the tenant and ID of the last event checked,
+// so a run interrupted by a restart resumes where it stopped.
+type RevalidationRun struct {
+	ID     string `json:"id"`
+	Action string `json:"action"`
+	Mode   string `json:"mode"`
+	// Kinds restricts the run to these kinds, all kinds when empty
+	Kinds        []int  `json:"kinds,omitempty"`
+	CursorTenant string `json:"cursor_tenant"`
+	Cursor       string `json:"cursor"`
+	Scanned      int64  `json:"scanned"`
+	Failed       int64  `json:"failed"`
+	Status       string `json:"status"`
+	Error        string `json:"error,omitempty"`
+	// StartedAt and UpdatedAt are unix seconds; UpdatedAt is the lease of the
+	// node running the batches
+	StartedAt int64 `json:"started_at"`
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+// QuarantinedEvent is a stored event taken out of service by a revalidation run
+type QuarantinedEvent struct {
+	Event         nostr.Event `json:"event"`
+	Tenant        string      `json:"tenant"`
+	Reason        string      `json:"reason"`
+	RunID         string      `json:"run_id"`
+	QuarantinedAt int64       `json:"quarantined_at"`
+}
+
+const revalidationColumns = `id, action, mode, kinds, cursor_tenant, cursor, scanned, failed, status, error, started_at, updated_at`
+
+// scanRevalidationRun reads one row selected with revalidationColumns
+func scanRevalidationRun(row pgx.Row) (*RevalidationRun, error) {
+	var run RevalidationRun
+	if err := row.Scan(&run.ID, &run.Action, &run.Mode, &run.Kinds, &run.CursorTenant, &run.Cursor, &run.Scanned, &run.Failed,
+		&run.Status, &run.Error, &run.StartedAt, &run.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// CreateRevalidationRun records a new run unless one is in progress. Its
+// UpdatedAt should be 0 so the first node looking for work claims it.
+func (db *DB) CreateRevalidationRun(ctx context.Context, run RevalidationRun) error {
+	tag, err := db.Pool.Exec(ctx,
+		`INSERT INTO revalidation_runs (id, action, mode, kinds, cursor, scanned, failed, status, error, started_at, updated_at)
+		 SELECT $1, $2, $7, $3, '', 0, 0, $4, '', $5, $6
+		 WHERE NOT EXISTS (SELECT 1 FROM revalidation_runs WHERE status = $4)`,
+		run.ID, run.Action, run.Kinds, RevalidationRunning, run.StartedAt, run.UpdatedAt, run.Mode)
+	if err != nil {
+		return fmt.Errorf("failed to record revalidation run: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRevalidationRunning
+	}
+	return nil
+}
+
+// ListRevalidationRuns returns the most recent runs, newest first
+func (db *DB) ListRevalidationRuns(ctx context.Context, limit int) ([]RevalidationRun, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT `+revalidationColumns+` FROM revalidation_runs ORDER BY started_at DESC, id ASC LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load revalidation runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []RevalidationRun{}
+	for rows.Next() {
+		run, err := scanRevalidationRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan revalidation run: %w", err)
+		}
+		runs = append(runs, *run)
+	}
+	return runs, rows.Err()
+}
+
+// LastRevalidationRun returns the most recently started run of mode, nil when
+// there is none
+func (db *DB) LastRevalidationRun(ctx context.Context, mode string) (*RevalidationRun, error) {
+	run, err := scanRevalidationRun(db.Pool.QueryRow(ctx,
+		`SELECT `+revalidationColumns+` FROM revalidation_runs WHERE mode = $1 ORDER BY started_at DESC LIMIT 1`, mode))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load revalidation run: %w", err)
+	}
+	return run, nil
+}
+
+// ClaimRevalidationRun takes over the run in progress when its lease, UpdatedAt,
+// is older than staleBefore, renewing it to now. It returns nil when there is no
+// run or another node holds it.
+func (db *DB) ClaimRevalidationRun(ctx context.Context, staleBefore, now int64) (*RevalidationRun, error) {
+	run, err := scanRevalidationRun(db.Pool.QueryRow(ctx,
+		`UPDATE revalidation_runs SET updated_at = $1
+		 WHERE status = $2 AND updated_at < $3
+		 LIMIT 1
+		 RETURNING `+revalidationColumns,
+		now, RevalidationRunning, staleBefore))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim revalidation run: %w", err)
+	}
+	return run, nil
+}
+
+// SaveRevalidationProgress records the progress and status of a run and renews
+// its lease. It reports false when the run stopped running meanwhile, i.e. it was
+// canceled.
+func (db *DB) SaveRevalidationProgress(ctx context.Context, run *RevalidationRun) (bool, error) {
+	tag, err := db.Pool.Exec(ctx,
+		`UPDATE revalidation_runs
+		 SET cursor = $2, scanned = $3, failed = $4, status = $5, error = $6, updated_at = $7, cursor_tenant = $9
+		 WHERE id = $1 AND status = $8`,
+		run.ID, run.Cursor, run.Scanned, run.Failed, run.Status, run.Error, run.UpdatedAt, RevalidationRunning, run.CursorTenant)
+	if err != nil {
+		return false, fmt.Errorf("failed to save revalidation progress: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// CancelRevalidationRun stops the run in progress after its current batch
+func (db *DB) CancelRevalidationRun(ctx context.Context, now int64) error {
+	tag, err := db.Pool.Exec(ctx,
+		`UPDATE revalidation_runs SET status = $1, updated_at = $2 WHERE status = $3`,
+		RevalidationCanceled, now, RevalidationRunning)
+	if err != nil {
+		return fmt.Errorf("failed to cancel revalidation run: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRevalidationNotFound
+	}
+	return nil
+}
+
+// GetEventsAfter returns up to limit stored events after (afterTenant, afterID),
+// in tenant and ID order, restricted to kinds when given. Time capsule payloads
+// are restored. An event that can't be read in full fails the whole batch, so
+// it is never checked, and possibly deleted, as something it isn't.
+func (db *DB) GetEventsAfter(ctx context.Context, afterTenant, afterID string, kinds []int, limit int) ([]TenantEvent, error) {
+	query := `SELECT tenant, id, pubkey, kind, created_at, content, tags, sig FROM events WHERE (tenant, id) > ($1, $2)`
+	args := []interface{}{afterTenant, afterID, limit}
+	if len(kinds) > 0 {
+		query += ` AND kind = ANY($4)`
+		args = append(args, kinds)
+	}
+	rows, err := db.Pool.Query(ctx, query+` ORDER BY tenant ASC, id ASC LIMIT $3`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query events: %w", err)
+	}
+	defer rows.Close()
+
+	var batch []TenantEvent
+	for rows.Next() {
+		var te TenantEvent
+		var createdAt int64
+		var rawTags []byte
+		if err := rows.Scan(&te.Tenant, &te.Event.ID, &te.Event.PubKey, &te.Event.Kind, &createdAt, &te.Event.Content, &rawTags, &te.Event.Sig); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		te.Event.CreatedAt = nostr.Timestamp(createdAt)
+		if len(rawTags) > 0 {
+			if err := json.Unmarshal(rawTags, &te.Event.Tags); err != nil {
+				return nil, fmt.Errorf("failed to decode tags of event %s: %w", te.Event.ID, err)
+			}
+		}
+		batch = append(batch, te)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read events: %w", err)
+	}
+	events := make([]nostr.Event, len(batch))
+	for i := range batch {
+		events[i] = batch[i].Event
+	}
+	if err := db.hydrateCapsuleBlobs(ctx, events); err != nil {
+		return nil, err
+	}
+	for i := range batch {
+		batch[i].Event = events[i]
+	}
+	return batch, nil
+}
+
+// QuarantineEvents moves events out of the events table of their tenant into
+// quarantined_events with the reason each failed, so they are no longer served
+// but can be reviewed
+func (db *DB) QuarantineEvents(ctx context.Context, events []TenantEvent, reasons []string, runID string, now int64) error {
+	if len(events) == 0 {
+		return nil
+	}
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin quarantine transaction: %w", err)
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil && !errors.Is(rollbackErr, pgx.ErrTxClosed) {
+			db.recordError(fmt.Errorf("rollback failed: %w", rollbackErr))
+		}
+	}()
+
+	for i, te := range events {
+		evt := te.Event
+		if _, err := tx.Exec(ctx,
+			`UPSERT INTO quarantined_events (id, pubkey, created_at, kind, tags, content, sig, tenant, reason, run_id, quarantined_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+			evt.ID, evt.PubKey, int64(evt.CreatedAt), evt.Kind, evt.Tags, evt.Content, evt.Sig,
+			te.Tenant, reasons[i], runID, now); err != nil {
+			return fmt.Errorf("failed to quarantine event: %w", err)
+		}
+	}
+	for tenant, ids := range idsByTenant(events) {
+		if _, err := tx.Exec(ctx, `DELETE FROM events WHERE tenant = $1 AND id = ANY($2)`, tenant, ids); err != nil {
+			return fmt.Errorf("failed to delete quarantined events: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit quarantine: %w", err)
+	}
+	db.forgetTenantEvents(events)
+	return nil
+}
+
+// DeleteEvents deletes stored events outright from their tenant
+func (db *DB) DeleteEvents(ctx context.Context, events []TenantEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	for tenant, ids := range idsByTenant(events) {
+		if _, err := db.Pool.Exec(ctx, `DELETE FROM events WHERE tenant = $1 AND id = ANY($2)`, tenant, ids); err != nil {
+			return fmt.Errorf("failed to delete events: %w", err)
+		}
+	}
+	db.forgetTenantEvents(events)
+	return nil
+}
+
+// idsByTenant groups the ids of events by their tenant
+func idsByTenant(events []TenantEvent) map[string][]string {
+	ids := make(map[string][]string)
+	for _, te := range events {
+		ids[te.Tenant] = append(ids[te.Tenant], te.Event.ID)
+	}
+	return ids
+}
+
+// forgetTenantEvents drops removed events of the main relay from the recent
+// and live rings, which only hold the main relay's
+func (db *DB) forgetTenantEvents(events []TenantEvent) {
+	var main []nostr.Event
+	for _, te := range events {
+		if te.Tenant == DefaultTenant {
+			main = append(main, te.Event)
+		}
+	}
+	db.forgetEvents(main)
+}
+
+// ListQuarantinedEvents returns the most recently quarantined events, newest first
+func (db *DB) ListQuarantinedEvents(ctx context.Context, limit int) ([]QuarantinedEvent, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT id, pubkey, created_at, kind, tags, content, sig, tenant, reason, run_id, quarantined_at
+		 FROM quarantined_events ORDER BY quarantined_at DESC, id ASC LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load quarantined events: %w", err)
+	}
+	defer rows.Close()
+
+	quarantined := []QuarantinedEvent{}
+	for rows.Next() {
+		var q QuarantinedEvent
+		var createdAt int64
+		var rawTags []byte
+		if err := rows.Scan(&q.Event.ID, &q.Event.PubKey, &createdAt, &q.Event.Kind, &rawTags,
+			&q.Event.Content, &q.Event.Sig, &q.Tenant, &q.Reason, &q.RunID, &q.QuarantinedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan quarantined event: %w", err)
+		}
+		q.Event.CreatedAt = nostr.Timestamp(createdAt)
+		if len(rawTags) > 0 {
+			if err := json.Unmarshal(rawTags, &q.Event.Tags); err != nil {
+				q.Event.Tags = nostr.Tags{}
+			}
+		}
+		quarantined = append(quarantined, q)
+	}
+	return quarantined, rows.Err()
+}
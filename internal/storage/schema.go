@@ -4,6 +4,8 @@ import (
 	"context"
 	_ "embed"
 	"fmt"
+	"regexp"
+	"strconv"
 	"time"
 
 	"github.com/Shugur-Network/relay/internal/constants"
@@ -14,6 +16,106 @@ import (
 //go:embed schema.sql
 var schemaDDL string
 
+// migration is a schema change applied once and recorded in schema_migrations,
+// for changes too costly to repeat at every start like schema.sql
+type migration struct {
+	version int
+	name    string
+	// minMajor and minMinor are the oldest CockroachDB release able to apply it;
+	// older databases skip it until they are upgraded
+	minMajor, minMinor int
+	// statements run one at a time, as schema changes can't share a transaction
+	statements []string
+}
+
+// migrations are applied in order after schema.sql
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "tenant_event_keys",
+		statements: []string{
+			`ALTER TABLE events DROP CONSTRAINT events_pkey, ADD CONSTRAINT events_pkey PRIMARY KEY (tenant ASC, id ASC)`,
+			`ALTER TABLE quarantined_events DROP CONSTRAINT quarantined_events_pkey, ADD CONSTRAINT quarantined_events_pkey PRIMARY KEY (tenant ASC, id ASC)`,
+		},
+	},
+	{
+		version: 2,
+		name:    "tenant_search_keys",
+		statements: []string{
+			`ALTER TABLE event_search_attrs DROP CONSTRAINT event_search_attrs_pkey, ADD CONSTRAINT event_search_attrs_pkey PRIMARY KEY (tenant ASC, id ASC)`,
+			`DROP INDEX IF EXISTS event_search_attrs@event_search_attrs_language`,
+			`DROP INDEX IF EXISTS event_search_attrs@event_search_attrs_nsfw`,
+			`ALTER TABLE nip05_domains DROP CONSTRAINT nip05_domains_pkey, ADD CONSTRAINT nip05_domains_pkey PRIMARY KEY (tenant ASC, pubkey ASC)`,
+			`DROP INDEX IF EXISTS nip05_domains@nip05_domains_domain`,
+		},
+	},
+	{
+		version: 3,
+		name:    "tenant_spam_reports",
+		statements: []string{
+			`ALTER TABLE spam_reports DROP CONSTRAINT spam_reports_pkey, ADD CONSTRAINT spam_reports_pkey PRIMARY KEY (tenant ASC, target ASC, reporter ASC)`,
+		},
+	},
+	{
+		// Trigram index on content so NIP-50 searches, one content ILIKE '%term%'
+		// per search term, don't scan the table. Building it backfills every event.
+		version:  4,
+		name:     "events_content_trgm",
+		minMajor: 22,
+		minMinor: 2,
+		statements: []string{
+			`CREATE INVERTED INDEX IF NOT EXISTS events_content_trgm ON events (content gin_trgm_ops)`,
+		},
+	},
+	{
+		version: 5,
+		name:    "tenant_zap_receipts",
+		statements: []string{
+			`ALTER TABLE zap_receipts DROP CONSTRAINT zap_receipts_pkey, ADD CONSTRAINT zap_receipts_pkey PRIMARY KEY (tenant ASC, id ASC)`,
+		},
+	},
+	{
+		// Reported events were once attributed to the report's first p tag
+		version: 6,
+		name:    "stored_report_authors",
+		statements: []string{
+			`UPDATE reports SET pubkey = COALESCE((SELECT e.pubkey FROM events e WHERE e.tenant = '' AND e.id = reports.target), '') WHERE target_type = 'event'`,
+		},
+	},
+	{
+		version: 7,
+		name:    "tenant_capsule_unlocks",
+		statements: []string{
+			`ALTER TABLE capsule_unlocks DROP CONSTRAINT capsule_unlocks_pkey, ADD CONSTRAINT capsule_unlocks_pkey PRIMARY KEY (tenant ASC, event_id ASC)`,
+		},
+	},
+	{
+		version: 8,
+		name:    "tenant_deleted_events",
+		statements: []string{
+			`ALTER TABLE deleted_events DROP CONSTRAINT deleted_events_pkey, ADD CONSTRAINT deleted_events_pkey PRIMARY KEY (tenant ASC, id ASC)`,
+		},
+	},
+	{
+		version: 9,
+		name:    "tenant_capsule_shares",
+		statements: []string{
+			`ALTER TABLE capsule_share_thresholds DROP CONSTRAINT capsule_share_thresholds_pkey, ADD CONSTRAINT capsule_share_thresholds_pkey PRIMARY KEY (tenant ASC, capsule_id ASC)`,
+			`ALTER TABLE capsule_shares DROP CONSTRAINT capsule_shares_pkey, ADD CONSTRAINT capsule_shares_pkey PRIMARY KEY (tenant ASC, capsule_id ASC, witness ASC)`,
+		},
+	},
+	{
+		version: 10,
+		name:    "tenant_event_receipts",
+		statements: []string{
+			`ALTER TABLE event_receipts DROP CONSTRAINT event_receipts_pkey, ADD CONSTRAINT event_receipts_pkey PRIMARY KEY (tenant ASC, event_id ASC)`,
+		},
+	},
+}
+
+// serverVersionPattern finds the release in version(), e.g. "CockroachDB CCL v23.1.11 (...)"
+var serverVersionPattern = regexp.MustCompile(`v(\d+)\.(\d+)`)
+
 // CreateDatabaseIfNotExists creates the specified database if it doesn't exist
 func (db *DB) CreateDatabaseIfNotExists(ctx context.Context, dbName string) error {
 	if !db.isConnected() {
@@ -67,6 +169,10 @@ func (db *DB) InitializeSchema(ctx context.Context) error {
 		logger.Error("Failed to initialize database schema", zap.Error(err))
 		return fmt.Errorf("failed to initialize database schema: %w", err)
 	}
+	if err := db.applyMigrations(ctx); err != nil {
+		logger.Error("Failed to migrate database schema", zap.Error(err))
+		return err
+	}
 
 	// Check if database is running in cluster mode
 	isCluster, err := db.isClusterMode(ctx)
@@ -89,6 +195,79 @@ func (db *DB) InitializeSchema(ctx context.Context) error {
 	return nil
 }
 
+// applyMigrations applies the migrations not recorded in schema_migrations yet
+func (db *DB) applyMigrations(ctx context.Context) error {
+	applied, err := db.AppliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	major, minor := db.serverVersion(ctx)
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+		if major < m.minMajor || (major == m.minMajor && minor < m.minMinor) {
+			logger.Warn("Skipping schema migration the database is too old for",
+				zap.Int("version", m.version),
+				zap.String("name", m.name),
+				zap.String("requires", fmt.Sprintf("v%d.%d", m.minMajor, m.minMinor)))
+			continue
+		}
+
+		logger.Info("Applying schema migration...", zap.Int("version", m.version), zap.String("name", m.name))
+		for _, stmt := range m.statements {
+			if _, err := db.Pool.Exec(ctx, stmt); err != nil {
+				return fmt.Errorf("schema migration %d (%s) failed: %w", m.version, m.name, err)
+			}
+		}
+		if _, err := db.Pool.Exec(ctx,
+			`INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)
+			 ON CONFLICT (version) DO NOTHING`,
+			m.version, m.name, time.Now().Unix()); err != nil {
+			return fmt.Errorf("failed to record schema migration %d: %w", m.version, err)
+		}
+		logger.Info("✅ Schema migration applied", zap.Int("version", m.version), zap.String("name", m.name))
+	}
+	return nil
+}
+
+// AppliedMigrations returns the versions of the migrations applied so far
+func (db *DB) AppliedMigrations(ctx context.Context) (map[int]bool, error) {
+	rows, err := db.Pool.Query(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schema migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("failed to scan schema migration: %w", err)
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// serverVersion returns the CockroachDB release the database runs, 0.0 when it
+// can't be told
+func (db *DB) serverVersion(ctx context.Context) (major, minor int) {
+	var version string
+	if err := db.Pool.QueryRow(ctx, `SELECT version()`).Scan(&version); err != nil {
+		logger.Debug("Failed to read database version", zap.Error(err))
+		return 0, 0
+	}
+	m := serverVersionPattern.FindStringSubmatch(version)
+	if m == nil {
+		return 0, 0
+	}
+	major, _ = strconv.Atoi(m[1])
+	minor, _ = strconv.Atoi(m[2])
+	return major, minor
+}
+
 // applyClusterSettingsAsync applies CockroachDB cluster performance settings asynchronously
 // Each setting is executed in its own transaction to avoid "cannot be used inside a multi-statement transaction" errors
 func (db *DB) applyClusterSettingsAsync(ctx context.Context) {
@@ -2,6 +2,19 @@
 -- CockroachDB optimized schema for Nostr relay
 -- Database: Defined in constants.DatabaseName
 
+-- =============================================================================
+-- Schema migrations - changes applied once rather than at every start
+-- =============================================================================
+-- Rebuilding a table or backfilling an index is too costly to repeat on every
+-- start, so these changes are listed in schema.go and recorded here once applied.
+CREATE TABLE IF NOT EXISTS schema_migrations (
+  version INT8 NOT NULL,
+  name STRING NOT NULL,
+  applied_at INT8 NOT NULL,
+
+  CONSTRAINT schema_migrations_pkey PRIMARY KEY (version ASC)
+);
+
 -- =============================================================================
 -- Events table - stores all Nostr events with optimized indexes
 -- =============================================================================
@@ -15,9 +28,11 @@ CREATE TABLE IF NOT EXISTS events (
   tags JSONB NULL,
   content STRING NULL,
   sig CHAR(128) NOT NULL,
+  -- tenant is the virtual relay the event was published to, '' for the main relay
+  tenant STRING NOT NULL DEFAULT '',
   
-  -- Primary key (matches production deployment)
-  CONSTRAINT events_pkey PRIMARY KEY (id ASC),
+  -- Events are unique per tenant: the same event may be published to several
+  CONSTRAINT events_pkey PRIMARY KEY (tenant ASC, id ASC),
   
   -- Performance-optimized indexes with STORING clauses for covering queries
   -- These indexes eliminate table lookups by storing frequently accessed columns
@@ -29,13 +44,14 @@ CREATE TABLE IF NOT EXISTS events (
   INVERTED INDEX events_tags (tags),
   INVERTED INDEX events_pubkey_tags_idx (pubkey ASC, tags),
   INVERTED INDEX events_kind_tags_idx (kind ASC, tags),
+  INDEX events_tenant_created_at (tenant ASC, created_at DESC),
 
   
-  -- Unique constraints for Nostr protocol compliance
-  UNIQUE INDEX uq_replaceable (pubkey ASC, kind ASC) 
-    WHERE (((kind = 0:::INT8) OR (kind = 3:::INT8)) OR (kind = 41:::INT8)) OR ((kind >= 10000:::INT8) AND (kind < 20000:::INT8)),
+  -- Unique constraints for Nostr protocol compliance, per tenant
+  UNIQUE INDEX uq_tenant_replaceable_versions (tenant ASC, pubkey ASC, kind ASC) 
+    WHERE ((kind = 0:::INT8) OR (kind = 3:::INT8)) OR (((kind >= 10000:::INT8) AND (kind < 20000:::INT8)) AND (kind NOT IN (11991:::INT8, 11992:::INT8))),
   
-  UNIQUE INDEX uq_addressable (pubkey ASC, kind ASC, 
+  UNIQUE INDEX uq_tenant_addressable (tenant ASC, pubkey ASC, kind ASC, 
     (jsonb_path_query_first(tags, '$[*]?(@[0] == "d")[1]':::JSONPATH, '{}':::JSONB, true)::STRING) ASC) 
     WHERE ((kind >= 30000:::INT8) AND (kind < 40000:::INT8)) AND jsonb_path_exists(tags, '$[*]?(@[0] == "d")':::JSONPATH),
   
@@ -46,6 +62,517 @@ CREATE TABLE IF NOT EXISTS events (
   CONSTRAINT kind_range CHECK ((kind >= 0:::INT8) AND (kind <= 65535:::INT8))
 );
 
+-- Events tables created before virtual relays hold only main relay events; their
+-- replaceable and addressable versions become unique per tenant. Time capsule
+-- witness shares (11991, 11992) and channel metadata (41) are not replaceable.
+ALTER TABLE events ADD COLUMN IF NOT EXISTS tenant STRING NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS events_tenant_created_at ON events (tenant ASC, created_at DESC);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_tenant_replaceable_versions ON events (tenant ASC, pubkey ASC, kind ASC)
+  WHERE ((kind = 0:::INT8) OR (kind = 3:::INT8)) OR (((kind >= 10000:::INT8) AND (kind < 20000:::INT8)) AND (kind NOT IN (11991:::INT8, 11992:::INT8)));
+CREATE UNIQUE INDEX IF NOT EXISTS uq_tenant_addressable ON events (tenant ASC, pubkey ASC, kind ASC,
+  (jsonb_path_query_first(tags, '$[*]?(@[0] == "d")[1]':::JSONPATH, '{}':::JSONB, true)::STRING) ASC)
+  WHERE ((kind >= 30000:::INT8) AND (kind < 40000:::INT8)) AND jsonb_path_exists(tags, '$[*]?(@[0] == "d")':::JSONPATH);
+DROP INDEX IF EXISTS events@uq_replaceable;
+DROP INDEX IF EXISTS events@uq_tenant_replaceable;
+DROP INDEX IF EXISTS events@uq_tenant_replaceable_kinds;
+DROP INDEX IF EXISTS events@uq_addressable;
+
+-- =============================================================================
+-- Event receipts - when the relay accepted each event (storage attestations)
+-- =============================================================================
+-- Only populated when IDENTITY.ATTESTATIONS is enabled. The relay signs
+-- attestations over (event id, received_at) on first request from this table.
+CREATE TABLE IF NOT EXISTS event_receipts (
+  event_id CHAR(64) NOT NULL,
+  received_at INT8 NOT NULL,
+  tenant STRING NOT NULL DEFAULT '',
+  attestation JSONB NULL,
+
+  CONSTRAINT event_receipts_pkey PRIMARY KEY (tenant ASC, event_id ASC),
+  CONSTRAINT valid_receipt_event_id CHECK (event_id ~ '^[a-f0-9]{64}$':::STRING)
+);
+-- Receipts are kept per tenant the event was accepted on; tables created before
+-- virtual relays hold the main relay's
+ALTER TABLE event_receipts ADD COLUMN IF NOT EXISTS tenant STRING NOT NULL DEFAULT '';
+-- The signed attestation is kept once made so later requests don't sign again
+ALTER TABLE event_receipts ADD COLUMN IF NOT EXISTS attestation JSONB NULL;
+
+-- =============================================================================
+-- Relay keys - relay identity kept in the database (IDENTITY.BACKEND=database)
+-- =============================================================================
+-- Keys are stored NIP-49 encrypted with IDENTITY.PASSPHRASE (older plaintext
+-- rows are encrypted on load), so stateless nodes keep the same relay ID
+-- without a key file volume.
+CREATE TABLE IF NOT EXISTS relay_keys (
+  name STRING NOT NULL,
+  key STRING NOT NULL,
+  updated_at INT8 NOT NULL,
+
+  CONSTRAINT relay_keys_pkey PRIMARY KEY (name ASC)
+);
+
+-- =============================================================================
+-- Capsule unlocks - wall-clock unlock time of time capsules (kind 1041)
+-- =============================================================================
+-- unlock_at is derived from the capsule's drand chain and round. The unlock
+-- scheduler flags rows as unlocked once unlock_at has passed and pushes the
+-- capsules to "#unlocked" subscriptions of their tenant.
+CREATE TABLE IF NOT EXISTS capsule_unlocks (
+  event_id CHAR(64) NOT NULL,
+  chain_hash CHAR(64) NOT NULL,
+  round INT8 NOT NULL,
+  unlock_at INT8 NOT NULL,
+  unlocked BOOL NOT NULL DEFAULT false,
+  tenant STRING NOT NULL DEFAULT '',
+
+  CONSTRAINT capsule_unlocks_pkey PRIMARY KEY (tenant ASC, event_id ASC),
+  INDEX capsule_unlocks_unlock_at (unlock_at ASC) STORING (unlocked)
+);
+-- Tables created before virtual relays index only main relay capsules; the
+-- scheduler's backfill indexes the other tenants' copies
+ALTER TABLE capsule_unlocks ADD COLUMN IF NOT EXISTS tenant STRING NOT NULL DEFAULT '';
+
+-- =============================================================================
+-- Capsule shares - witness share accounting for threshold time capsules
+-- =============================================================================
+-- capsule_share_thresholds holds the author's share distribution (kind 11992):
+-- the witnesses and how many of their shares unlock the capsule. capsule_shares
+-- records one unlock share (kind 11991) per listed witness. met_at is set once
+-- the received shares first reach the threshold.
+CREATE TABLE IF NOT EXISTS capsule_share_thresholds (
+  capsule_id CHAR(64) NOT NULL,
+  author CHAR(64) NOT NULL,
+  distribution_id CHAR(64) NOT NULL,
+  threshold INT4 NOT NULL,
+  witnesses STRING[] NOT NULL,
+  met_at INT8 NULL,
+  tenant STRING NOT NULL DEFAULT '',
+
+  CONSTRAINT capsule_share_thresholds_pkey PRIMARY KEY (tenant ASC, capsule_id ASC)
+);
+
+CREATE TABLE IF NOT EXISTS capsule_shares (
+  capsule_id CHAR(64) NOT NULL,
+  witness CHAR(64) NOT NULL,
+  event_id CHAR(64) NOT NULL,
+  received_at INT8 NOT NULL,
+  tenant STRING NOT NULL DEFAULT '',
+
+  CONSTRAINT capsule_shares_pkey PRIMARY KEY (tenant ASC, capsule_id ASC, witness ASC)
+);
+-- Shares are accounted per tenant the capsule is stored on; tables created
+-- before virtual relays hold the main relay's
+ALTER TABLE capsule_share_thresholds ADD COLUMN IF NOT EXISTS tenant STRING NOT NULL DEFAULT '';
+ALTER TABLE capsule_shares ADD COLUMN IF NOT EXISTS tenant STRING NOT NULL DEFAULT '';
+
+-- =============================================================================
+-- Capsule blobs - offloaded time capsule payloads (CAPSULES.BLOB_OFFLOAD_THRESHOLD)
+-- =============================================================================
+-- Large capsule payloads live here while the events row keeps an empty content,
+-- keeping the hot events table and cross-node polling light. Reads restore the
+-- payload; orphaned blobs are removed by capsule garbage collection.
+CREATE TABLE IF NOT EXISTS capsule_blobs (
+  event_id CHAR(64) NOT NULL,
+  content STRING NOT NULL,
+  created_at INT8 NOT NULL,
+
+  CONSTRAINT capsule_blobs_pkey PRIMARY KEY (event_id ASC)
+);
+
+-- =============================================================================
+-- Media blobs - Blossom (BUD-01/BUD-02) blob storage (BLOSSOM.ENABLED)
+-- =============================================================================
+-- Blobs are addressed by the sha256 of their content and stored once however
+-- many pubkeys upload them. media_blob_owners records each uploader, a blob is
+-- removed when its last owner deletes it.
+CREATE TABLE IF NOT EXISTS media_blobs (
+  sha256 CHAR(64) NOT NULL,
+  content BYTES NOT NULL,
+  size INT8 NOT NULL,
+  type STRING NOT NULL,
+  uploaded INT8 NOT NULL,
+
+  CONSTRAINT media_blobs_pkey PRIMARY KEY (sha256 ASC)
+);
+
+CREATE TABLE IF NOT EXISTS media_blob_owners (
+  pubkey CHAR(64) NOT NULL,
+  sha256 CHAR(64) NOT NULL,
+  uploaded INT8 NOT NULL,
+
+  CONSTRAINT media_blob_owners_pkey PRIMARY KEY (pubkey ASC, sha256 ASC),
+  INDEX media_blob_owners_sha256 (sha256 ASC)
+);
+
+-- =============================================================================
+-- Paid pubkeys - paid relay admission (PAYMENTS.ENABLED)
+-- =============================================================================
+-- paid_until is the unix time admission lapses, 0 for admission that never
+-- lapses. Nodes reload this table periodically to classify paying clients.
+CREATE TABLE IF NOT EXISTS paid_pubkeys (
+  pubkey CHAR(64) NOT NULL,
+  paid_until INT8 NOT NULL DEFAULT 0,
+  source STRING NOT NULL,
+  updated_at INT8 NOT NULL,
+
+  CONSTRAINT paid_pubkeys_pkey PRIMARY KEY (pubkey ASC)
+);
+-- tier names the membership tier last bought, empty for none
+ALTER TABLE paid_pubkeys ADD COLUMN IF NOT EXISTS tier STRING NOT NULL DEFAULT '';
+
+-- =============================================================================
+-- Suspended pubkeys - authors barred from publishing by an operator
+-- =============================================================================
+-- Suspended pubkeys can still read; their events and uploads are refused with
+-- the reason until they are reinstated.
+CREATE TABLE IF NOT EXISTS suspended_pubkeys (
+  pubkey CHAR(64) NOT NULL,
+  reason STRING NOT NULL DEFAULT '',
+  suspended_at INT8 NOT NULL,
+
+  CONSTRAINT suspended_pubkeys_pkey PRIMARY KEY (pubkey ASC)
+);
+-- Shadow suspensions acknowledge the pubkey's events without storing them
+ALTER TABLE suspended_pubkeys ADD COLUMN IF NOT EXISTS shadow BOOL NOT NULL DEFAULT false;
+
+-- =============================================================================
+-- Payment invoices - lightning invoices issued for admission and top-ups
+-- =============================================================================
+-- status moves from pending to paid once the backend reports the invoice
+-- settled, or to expired after expires_at. period is the admission granted in
+-- seconds, 0 for admission that never lapses.
+CREATE TABLE IF NOT EXISTS payment_invoices (
+  payment_hash CHAR(64) NOT NULL,
+  pubkey CHAR(64) NOT NULL,
+  plan STRING NOT NULL,
+  amount_msats INT8 NOT NULL,
+  period INT8 NOT NULL DEFAULT 0,
+  bolt11 STRING NOT NULL,
+  status STRING NOT NULL DEFAULT 'pending',
+  created_at INT8 NOT NULL,
+  expires_at INT8 NOT NULL,
+  paid_at INT8 NULL,
+
+  CONSTRAINT payment_invoices_pkey PRIMARY KEY (payment_hash ASC),
+  INDEX payment_invoices_status (status ASC, expires_at ASC),
+  INDEX payment_invoices_pubkey (pubkey ASC, created_at DESC)
+);
+
+-- =============================================================================
+-- Payment ledger - per-pubkey balance of zap top-ups and what they bought
+-- =============================================================================
+-- Credits are positive (entry_type 'zap', reference the zap receipt id), debits
+-- negative (entry_type the plan bought, reference the credit that triggered it).
+-- A pubkey's balance is the sum of its entries.
+CREATE TABLE IF NOT EXISTS payment_ledger (
+  entry_type STRING NOT NULL,
+  reference STRING NOT NULL,
+  pubkey CHAR(64) NOT NULL,
+  amount_msats INT8 NOT NULL,
+  created_at INT8 NOT NULL,
+
+  CONSTRAINT payment_ledger_pkey PRIMARY KEY (entry_type ASC, reference ASC),
+  INDEX payment_ledger_pubkey (pubkey ASC, created_at DESC)
+);
+
+-- =============================================================================
+-- Cashu proofs - ecash held by the relay from redeemed Cashu payments
+-- =============================================================================
+-- Payments are swapped at the mint for fresh proofs only the relay knows, stored
+-- here until the operator redeems them.
+CREATE TABLE IF NOT EXISTS cashu_proofs (
+  secret STRING NOT NULL,
+  mint STRING NOT NULL,
+  keyset_id STRING NOT NULL,
+  amount INT8 NOT NULL,
+  c STRING NOT NULL,
+  created_at INT8 NOT NULL,
+
+  CONSTRAINT cashu_proofs_pkey PRIMARY KEY (secret ASC),
+  INDEX cashu_proofs_mint (mint ASC)
+);
+
+-- =============================================================================
+-- Payment webhooks - outbox of signed notifications to the operator's endpoint
+-- =============================================================================
+-- id is derived from the event (e.g. tier.expired:<pubkey>:<paid_until>), so each
+-- event is queued once across the cluster. status moves from pending to
+-- delivered, or to failed after the last retry.
+CREATE TABLE IF NOT EXISTS payment_webhooks (
+  id STRING NOT NULL,
+  event_type STRING NOT NULL,
+  payload STRING NOT NULL,
+  status STRING NOT NULL,
+  attempts INT8 NOT NULL DEFAULT 0,
+  next_attempt_at INT8 NOT NULL,
+  created_at INT8 NOT NULL,
+
+  CONSTRAINT payment_webhooks_pkey PRIMARY KEY (id ASC),
+  INDEX payment_webhooks_due (status ASC, next_attempt_at ASC)
+);
+
+-- =============================================================================
+-- Invite codes - operator-generated codes that admit the pubkeys redeeming them
+-- =============================================================================
+-- max_uses 0 allows any number of redemptions and expires_at 0 never expires.
+-- period is the admission granted in seconds, 0 for admission that never lapses.
+CREATE TABLE IF NOT EXISTS invite_codes (
+  code STRING NOT NULL,
+  max_uses INT8 NOT NULL DEFAULT 0,
+  uses INT8 NOT NULL DEFAULT 0,
+  expires_at INT8 NOT NULL DEFAULT 0,
+  period INT8 NOT NULL DEFAULT 0,
+  note STRING NOT NULL DEFAULT '',
+  created_at INT8 NOT NULL,
+
+  CONSTRAINT invite_codes_pkey PRIMARY KEY (code ASC)
+);
+
+-- One row per pubkey that redeemed a code, so a pubkey can't spend a code's uses
+CREATE TABLE IF NOT EXISTS invite_redemptions (
+  code STRING NOT NULL,
+  pubkey CHAR(64) NOT NULL,
+  redeemed_at INT8 NOT NULL,
+
+  CONSTRAINT invite_redemptions_pkey PRIMARY KEY (code ASC, pubkey ASC)
+);
+
+-- =============================================================================
+-- Revalidation runs - passes re-running the current policies over stored events
+-- =============================================================================
+-- Events are checked in id order and cursor is the last id checked, so a run
+-- resumes after a restart. Only one run is in progress at a time; updated_at is
+-- the lease of the node running it, taken over once it goes stale.
+CREATE TABLE IF NOT EXISTS revalidation_runs (
+  id STRING NOT NULL,
+  action STRING NOT NULL,
+  mode STRING NOT NULL DEFAULT 'policies',
+  kinds INT8[] NULL,
+  cursor STRING NOT NULL DEFAULT '',
+  scanned INT8 NOT NULL DEFAULT 0,
+  failed INT8 NOT NULL DEFAULT 0,
+  status STRING NOT NULL,
+  error STRING NOT NULL DEFAULT '',
+  started_at INT8 NOT NULL,
+  updated_at INT8 NOT NULL,
+
+  CONSTRAINT revalidation_runs_pkey PRIMARY KEY (id ASC),
+  INDEX revalidation_runs_status (status ASC, updated_at ASC)
+);
+ALTER TABLE revalidation_runs ADD COLUMN IF NOT EXISTS mode STRING NOT NULL DEFAULT 'policies';
+ALTER TABLE revalidation_runs ADD COLUMN IF NOT EXISTS cursor_tenant STRING NOT NULL DEFAULT '';
+
+-- Events a revalidation run took out of service, kept for operator review
+CREATE TABLE IF NOT EXISTS quarantined_events (
+  id CHAR(64) NOT NULL,
+  pubkey CHAR(64) NOT NULL,
+  created_at INT8 NOT NULL,
+  kind INT8 NOT NULL,
+  tags JSONB NULL,
+  content STRING NULL,
+  sig CHAR(128) NOT NULL,
+  tenant STRING NOT NULL DEFAULT '',
+  reason STRING NOT NULL DEFAULT '',
+  run_id STRING NOT NULL,
+  quarantined_at INT8 NOT NULL,
+
+  CONSTRAINT quarantined_events_pkey PRIMARY KEY (tenant ASC, id ASC),
+  INDEX quarantined_events_at (quarantined_at DESC)
+);
+ALTER TABLE quarantined_events ADD COLUMN IF NOT EXISTS tenant STRING NOT NULL DEFAULT '';
+
+-- =============================================================================
+-- Deleted events - ids of events removed by NIP-09 deletion requests
+-- =============================================================================
+-- The events themselves are gone; their ids are kept so reactions, reposts and
+-- replies to them can be hidden (RELAY_POLICY.HIDE_DELETED_INTERACTIONS).
+CREATE TABLE IF NOT EXISTS deleted_events (
+  id CHAR(64) NOT NULL,
+  deletion_id CHAR(64) NOT NULL,
+  deleted_at INT8 NOT NULL,
+  tenant STRING NOT NULL DEFAULT '',
+
+  CONSTRAINT deleted_events_pkey PRIMARY KEY (tenant ASC, id ASC)
+);
+-- Tables created before virtual relays record only main relay deletions
+ALTER TABLE deleted_events ADD COLUMN IF NOT EXISTS tenant STRING NOT NULL DEFAULT '';
+
+-- =============================================================================
+-- Vanished pubkeys - authors that sent a NIP-62 request to vanish
+-- =============================================================================
+-- Their events up to vanished_at, and the gift wraps sent to them, were deleted
+-- and are refused from then on. request_id is the request, stored as an event.
+CREATE TABLE IF NOT EXISTS vanished_pubkeys (
+  tenant STRING NOT NULL DEFAULT '',
+  pubkey CHAR(64) NOT NULL,
+  request_id CHAR(64) NOT NULL,
+  vanished_at INT8 NOT NULL,
+  received_at INT8 NOT NULL,
+  purged_events INT8 NOT NULL DEFAULT 0,
+
+  CONSTRAINT vanished_pubkeys_pkey PRIMARY KEY (tenant ASC, pubkey ASC)
+);
+
+-- =============================================================================
+-- Tenants - virtual relays created through the admin API
+-- =============================================================================
+-- definition is the tenant as accepted by the API (config.TenantConfig); tenants
+-- in the TENANTS configuration aren't stored here.
+CREATE TABLE IF NOT EXISTS tenants (
+  id STRING NOT NULL,
+  definition JSONB NOT NULL,
+  created_at INT8 NOT NULL,
+  updated_at INT8 NOT NULL,
+
+  CONSTRAINT tenants_pkey PRIMARY KEY (id ASC)
+);
+
+-- Usage of each virtual relay by UTC day (day is the unix time of its midnight).
+-- Every node adds what it metered, so the rows add up the whole cluster.
+CREATE TABLE IF NOT EXISTS tenant_usage (
+  tenant STRING NOT NULL,
+  day INT8 NOT NULL,
+  events INT8 NOT NULL DEFAULT 0,
+  bytes_in INT8 NOT NULL DEFAULT 0,
+  bytes_out INT8 NOT NULL DEFAULT 0,
+  connection_seconds FLOAT8 NOT NULL DEFAULT 0,
+
+  CONSTRAINT tenant_usage_pkey PRIMARY KEY (tenant ASC, day ASC),
+  INDEX tenant_usage_day (day ASC)
+);
+
+-- =============================================================================
+-- Blocklist entries - pubkeys, event IDs and domains synced from blocklist feeds
+-- =============================================================================
+-- feed is the NAME of the RELAY_POLICY.BLOCKLIST_FEEDS feed listing the entry
+-- and type one of pubkey, event or domain. A sync replaces every entry of its
+-- feed; nodes restore the stored entries until their first sync succeeds.
+CREATE TABLE IF NOT EXISTS blocklist_entries (
+  feed STRING NOT NULL,
+  type STRING NOT NULL,
+  value STRING NOT NULL,
+  synced_at INT8 NOT NULL,
+
+  CONSTRAINT blocklist_entries_pkey PRIMARY KEY (feed ASC, type ASC, value ASC),
+  INDEX blocklist_entries_value (value ASC)
+);
+
+-- =============================================================================
+-- Search attributes - what NIP-50 search extensions narrow results by
+-- =============================================================================
+-- Rows are written when new events are stored, only for events with a language
+-- or marked sensitive; events stored before aren't indexed.
+CREATE TABLE IF NOT EXISTS event_search_attrs (
+  id CHAR(64) NOT NULL,
+  language STRING NOT NULL DEFAULT '',
+  nsfw BOOL NOT NULL DEFAULT false,
+  tenant STRING NOT NULL DEFAULT '',
+
+  CONSTRAINT event_search_attrs_pkey PRIMARY KEY (tenant ASC, id ASC),
+  INDEX event_search_attrs_tenant_language (tenant ASC, language ASC),
+  INDEX event_search_attrs_tenant_nsfw (tenant ASC, id ASC) WHERE nsfw
+);
+-- Tables created before virtual relays hold only main relay events
+ALTER TABLE event_search_attrs ADD COLUMN IF NOT EXISTS tenant STRING NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS event_search_attrs_tenant_language ON event_search_attrs (tenant ASC, language ASC);
+CREATE INDEX IF NOT EXISTS event_search_attrs_tenant_nsfw ON event_search_attrs (tenant ASC, id ASC) WHERE nsfw;
+
+-- Pubkeys that reported an event or pubkey (target) as spam with NIP-56 reports,
+-- for leaving spam out of searches (SEARCH.SPAM_REPORTS)
+CREATE TABLE IF NOT EXISTS spam_reports (
+  target CHAR(64) NOT NULL,
+  reporter CHAR(64) NOT NULL,
+  reported_at INT8 NOT NULL,
+  -- report_id is the report counted, for deleting it to stop it counting
+  report_id CHAR(64) NOT NULL DEFAULT '',
+  tenant STRING NOT NULL DEFAULT '',
+
+  CONSTRAINT spam_reports_pkey PRIMARY KEY (tenant ASC, target ASC, reporter ASC),
+  INDEX spam_reports_report (tenant ASC, report_id ASC)
+);
+-- Tables created before virtual relays hold only main relay reports
+ALTER TABLE spam_reports ADD COLUMN IF NOT EXISTS report_id CHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE spam_reports ADD COLUMN IF NOT EXISTS tenant STRING NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS spam_reports_report ON spam_reports (tenant ASC, report_id ASC);
+
+-- NIP-56 reports stored on the main relay, a row per event or pubkey (target)
+-- each reports, for the moderation queue. pubkey is the reported pubkey, the
+-- stored author of a reported event ('' when the event isn't stored).
+CREATE TABLE IF NOT EXISTS reports (
+  report_id CHAR(64) NOT NULL,
+  target CHAR(64) NOT NULL,
+  target_type STRING NOT NULL,      -- 'event' or 'pubkey'
+  pubkey CHAR(64) NOT NULL,
+  reporter CHAR(64) NOT NULL,
+  report_type STRING NOT NULL DEFAULT '',
+  received_at INT8 NOT NULL,
+
+  CONSTRAINT reports_pkey PRIMARY KEY (report_id ASC, target ASC),
+  INDEX reports_target (target ASC, received_at DESC),
+  INDEX reports_pubkey (pubkey ASC, received_at DESC)
+);
+
+-- Moderators' decisions on reported targets. Only reports received after
+-- resolved_at are open; those of a resolved pubkey's events are closed too.
+CREATE TABLE IF NOT EXISTS report_resolutions (
+  target CHAR(64) NOT NULL,
+  action STRING NOT NULL,           -- 'dismiss', 'shadow-ban' or 'blacklist'
+  note STRING NOT NULL DEFAULT '',
+  resolved_at INT8 NOT NULL,
+
+  CONSTRAINT report_resolutions_pkey PRIMARY KEY (target ASC)
+);
+
+-- Zap receipts (kind 9735) by the pubkey, event and address they zap, for zap
+-- totals. Rows are written when new receipts are stored, once their signer is
+-- found to be the recipient's zap provider (ZAP_TOTALS); receipts stored before
+-- aren't indexed.
+CREATE TABLE IF NOT EXISTS zap_receipts (
+  id CHAR(64) NOT NULL,
+  tenant STRING NOT NULL DEFAULT '',
+  recipient CHAR(64) NOT NULL,
+  event_id STRING NOT NULL DEFAULT '',
+  address STRING NOT NULL DEFAULT '',
+  sender CHAR(64) NOT NULL,
+  amount_msats INT8 NOT NULL,
+  created_at INT8 NOT NULL,
+
+  CONSTRAINT zap_receipts_pkey PRIMARY KEY (tenant ASC, id ASC),
+  INDEX zap_receipts_recipient (tenant ASC, recipient ASC) STORING (amount_msats),
+  INDEX zap_receipts_event (tenant ASC, event_id ASC) STORING (amount_msats) WHERE event_id != '',
+  INDEX zap_receipts_address (tenant ASC, address ASC) STORING (amount_msats) WHERE address != ''
+);
+
+-- Verified NIP-05 domains of the authors of stored profiles (kind 0), for the
+-- domain: search extension
+CREATE TABLE IF NOT EXISTS nip05_domains (
+  pubkey CHAR(64) NOT NULL,
+  domain STRING NOT NULL,
+  verified_at INT8 NOT NULL,
+  tenant STRING NOT NULL DEFAULT '',
+
+  CONSTRAINT nip05_domains_pkey PRIMARY KEY (tenant ASC, pubkey ASC),
+  INDEX nip05_domains_tenant_domain (tenant ASC, domain ASC)
+);
+-- Tables created before virtual relays hold only main relay profiles
+ALTER TABLE nip05_domains ADD COLUMN IF NOT EXISTS tenant STRING NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS nip05_domains_tenant_domain ON nip05_domains (tenant ASC, domain ASC);
+
+-- =============================================================================
+-- Event sinks - changefeeds the relay runs into external systems (SINK)
+-- =============================================================================
+-- sink_hash identifies the sink URI and kinds the job was created for, without
+-- storing the URI's credentials. updated_at is the lease of the node checking
+-- the job, so nodes starting together create it once.
+CREATE TABLE IF NOT EXISTS event_sinks (
+  name STRING NOT NULL,
+  sink_hash STRING NOT NULL DEFAULT '',
+  job_id INT8 NOT NULL DEFAULT 0,
+  updated_at INT8 NOT NULL,
+
+  CONSTRAINT event_sinks_pkey PRIMARY KEY (name ASC)
+);
+
 -- =============================================================================
 -- Zone Configuration Examples (Apply Manually Based on Your Deployment)
 -- =============================================================================
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/relay/nips"
+	"github.com/jackc/pgx/v5"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+// maxDomainVerifications bounds the NIP-05 lookups running at once; profiles
+// stored while as many run aren't verified
+const maxDomainVerifications = 16
+
+// NIP05Resolver returns the pubkey a NIP-05 identifier resolves to
+type NIP05Resolver func(ctx context.Context, identifier string) (string, error)
+
+// domainVerifier checks the NIP-05 identifiers of new profiles
+type domainVerifier struct {
+	resolve NIP05Resolver
+	timeout time.Duration
+	slots   chan struct{}
+}
+
+// EnableDomainVerification makes the processor verify the NIP-05 identifier of
+// every new profile with resolve, each lookup bounded by timeout, and record the
+// domains that verified for the domain: search extension. Must be called before
+// events are queued.
+func (ep *EventProcessor) EnableDomainVerification(resolve NIP05Resolver, timeout time.Duration) {
+	ep.domains = &domainVerifier{
+		resolve: resolve,
+		timeout: timeout,
+		slots:   make(chan struct{}, maxDomainVerifications),
+	}
+}
+
+// indexSearch records what the NIP-50 search extensions narrow results by for a
+// newly stored event of tenant
+func (ep *EventProcessor) indexSearch(tenant string, evt nostr.Event) {
+	language, nsfw := nips.SearchLanguage(evt), nips.IsSensitive(evt)
+	if language != "" || nsfw {
+		ctx, cancel := context.WithTimeout(ep.ctx, 3*time.Second)
+		err := ep.db.IndexSearchAttrs(ctx, tenant, evt.ID, language, nsfw)
+		cancel()
+		if err != nil {
+			logger.Warn("Failed to index search attributes", zap.String("event_id", evt.ID), zap.Error(err))
+		}
+	}
+
+	// Reports are only recorded while they count
+	if targets := nips.SpamReportTargets(&evt); len(targets) > 0 && ep.db.spamReports > 0 {
+		ctx, cancel := context.WithTimeout(ep.ctx, 3*time.Second)
+		err := ep.db.RecordSpamReports(ctx, tenant, evt, targets)
+		cancel()
+		if err != nil {
+			logger.Warn("Failed to record spam report", zap.String("event_id", evt.ID), zap.Error(err))
+		}
+	}
+
+	if evt.Kind == nostr.KindProfileMetadata && ep.domains != nil {
+		select {
+		case ep.domains.slots <- struct{}{}:
+			go func() {
+				defer func() { <-ep.domains.slots }()
+				ep.verifyDomain(tenant, evt)
+			}()
+		default:
+			logger.Debug("Too many NIP-05 lookups running, skipping profile", zap.String("pubkey", evt.PubKey))
+		}
+	}
+}
+
+// verifyDomain records the domain of a profile's NIP-05 identifier when it
+// resolves to the profile's author, and forgets it otherwise
+func (ep *EventProcessor) verifyDomain(tenant string, profile nostr.Event) {
+	identifier, domain := profileNIP05(profile)
+	verified := false
+	if identifier != "" {
+		ctx, cancel := context.WithTimeout(ep.ctx, ep.domains.timeout)
+		pubkey, err := ep.domains.resolve(ctx, identifier)
+		cancel()
+		if err != nil {
+			logger.Debug("NIP-05 lookup failed",
+				zap.String("pubkey", profile.PubKey),
+				zap.String("nip05", identifier),
+				zap.Error(err))
+		}
+		verified = err == nil && strings.EqualFold(pubkey, profile.PubKey)
+	}
+
+	ctx, cancel := context.WithTimeout(ep.ctx, 3*time.Second)
+	defer cancel()
+	var err error
+	if verified {
+		err = ep.db.SetNIP05Domain(ctx, tenant, profile.PubKey, domain, time.Now().Unix())
+	} else {
+		err = ep.db.ForgetNIP05Domain(ctx, tenant, profile.PubKey)
+	}
+	if err != nil {
+		logger.Warn("Failed to record NIP-05 domain", zap.String("pubkey", profile.PubKey), zap.Error(err))
+	}
+}
+
+// profileNIP05 returns the NIP-05 identifier of a profile and its domain, empty
+// when it has none. A bare domain stands for its root identifier "_@domain".
+func profileNIP05(profile nostr.Event) (string, string) {
+	var metadata struct {
+		NIP05 string `json:"nip05"`
+	}
+	if err := json.Unmarshal([]byte(profile.Content), &metadata); err != nil {
+		return "", ""
+	}
+	identifier := strings.ToLower(strings.TrimSpace(metadata.NIP05))
+	if identifier == "" {
+		return "", ""
+	}
+	if !strings.Contains(identifier, "@") {
+		identifier = "_@" + identifier
+	}
+	_, domain, _ := strings.Cut(identifier, "@")
+	if domain == "" {
+		return "", ""
+	}
+	return identifier, domain
+}
+
+// EnableSpamFilter leaves events out of search results once that many pubkeys
+// reported them, or their author, as spam (kind 1984). The NIP-50 include:spam
+// extension keeps them in.
+func (db *DB) EnableSpamFilter(reporters int) {
+	db.spamReports = reporters
+}
+
+// RecordSpamReports records that the report stored for tenant reported the
+// events and pubkeys in targets as spam; a reporter counts once per target
+func (db *DB) RecordSpamReports(ctx context.Context, tenant string, report nostr.Event, targets []string) error {
+	if _, err := db.Pool.Exec(ctx,
+		`UPSERT INTO spam_reports (tenant, target, reporter, reported_at, report_id)
+		 SELECT DISTINCT $1, target, $3, $4, $5 FROM unnest($2::STRING[]) AS target`,
+		tenant, targets, report.PubKey, int64(report.CreatedAt), report.ID); err != nil {
+		return fmt.Errorf("failed to record spam reports: %w", err)
+	}
+	return nil
+}
+
+// forgetSpamReports stops counting the reports among ids, deleted from tenant
+func forgetSpamReports(ctx context.Context, tx pgx.Tx, tenant string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM spam_reports WHERE tenant = $1 AND report_id = ANY($2)`, tenant, ids); err != nil {
+		return fmt.Errorf("failed to forget spam reports: %w", err)
+	}
+	return nil
+}
+
+// IndexSearchAttrs records the language and sensitivity of an event stored for
+// tenant
+func (db *DB) IndexSearchAttrs(ctx context.Context, tenant, id, language string, nsfw bool) error {
+	if _, err := db.Pool.Exec(ctx,
+		`UPSERT INTO event_search_attrs (tenant, id, language, nsfw) VALUES ($1, $2, $3, $4)`,
+		tenant, id, language, nsfw); err != nil {
+		return fmt.Errorf("failed to index search attributes: %w", err)
+	}
+	return nil
+}
+
+// SetNIP05Domain records the verified NIP-05 domain of pubkey's profile stored
+// for tenant
+func (db *DB) SetNIP05Domain(ctx context.Context, tenant, pubkey, domain string, verifiedAt int64) error {
+	if _, err := db.Pool.Exec(ctx,
+		`UPSERT INTO nip05_domains (tenant, pubkey, domain, verified_at) VALUES ($1, $2, $3, $4)`,
+		tenant, pubkey, domain, verifiedAt); err != nil {
+		return fmt.Errorf("failed to record NIP-05 domain: %w", err)
+	}
+	return nil
+}
+
+// ForgetNIP05Domain drops the NIP-05 domain of pubkey, whose profile no longer
+// names one that verifies
+func (db *DB) ForgetNIP05Domain(ctx context.Context, tenant, pubkey string) error {
+	if _, err := db.Pool.Exec(ctx, `DELETE FROM nip05_domains WHERE tenant = $1 AND pubkey = $2`, tenant, pubkey); err != nil {
+		return fmt.Errorf("failed to forget NIP-05 domain: %w", err)
+	}
+	return nil
+}
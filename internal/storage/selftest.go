@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// PendingMigration is a schema migration the database hasn't applied
+type PendingMigration struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	// Unsupported is set when the database is too old to apply it
+	Unsupported bool `json:"unsupported,omitempty"`
+}
+
+// SchemaVersion returns the version of the schema: the newest migration
+// applied, along with the migrations not applied yet, so a database left behind
+// by a failed migration shows up at startup rather than on the first query
+// touching it
+func (db *DB) SchemaVersion(ctx context.Context) (int, []PendingMigration, error) {
+	if !db.isConnected() {
+		return 0, nil, fmt.Errorf("database is not connected")
+	}
+	applied, err := db.AppliedMigrations(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	major, minor := db.serverVersion(ctx)
+
+	version := 0
+	var pending []PendingMigration
+	for _, m := range migrations {
+		if applied[m.version] {
+			version = m.version
+			continue
+		}
+		pending = append(pending, PendingMigration{
+			Version:     m.version,
+			Name:        m.name,
+			Unsupported: major < m.minMajor || (major == m.minMajor && minor < m.minMinor),
+		})
+	}
+	return version, pending, nil
+}
+
+// LatestSchemaVersion is the version of the newest migration the relay knows
+func LatestSchemaVersion() int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].version
+}
+
+// CheckSync checks that cross-node synchronization works: the dispatcher's
+// polling loop is running and completes a poll of the events table after the
+// check starts. It reports false without checking anything on a single-node
+// database, where there is nothing to synchronize.
+func (ed *EventDispatcher) CheckSync(ctx context.Context) (bool, error) {
+	if !ed.db.isConnected() {
+		return false, fmt.Errorf("database is not connected")
+	}
+	isCluster, err := ed.db.isClusterMode(ctx)
+	if err != nil || !isCluster {
+		return false, nil
+	}
+	if !ed.syncing.Load() {
+		return true, fmt.Errorf("cross-node polling is not running")
+	}
+
+	started := time.Now().UnixNano()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if ed.lastPoll.Load() >= started {
+			return true, nil
+		}
+		select {
+		case <-ctx.Done():
+			if last := ed.lastPoll.Load(); last > 0 {
+				return true, fmt.Errorf("no poll completed since %s", time.Unix(0, last).UTC().Format(time.RFC3339))
+			}
+			return true, fmt.Errorf("no poll completed yet")
+		case <-ticker.C:
+		}
+	}
+}
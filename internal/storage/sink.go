@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	nostr "github.com/nbd-wtf/go-nostr"
+)
+
+// sinkChangefeedName is the event_sinks row of the SINK changefeed
+const sinkChangefeedName = "changefeed"
+
+// sinkLease is how long, in seconds, a node checking the sink changefeed keeps
+// others from doing the same
+const sinkLease = 120
+
+// EventSink receives every new event stored, to deliver it to an external system
+type EventSink interface {
+	EventStored(tenant string, evt nostr.Event)
+}
+
+// EnableSink hands every new event stored to sink. Must be called before events
+// are queued.
+func (ep *EventProcessor) EnableSink(sink EventSink) {
+	ep.sink = sink
+}
+
+// EnsureSinkChangefeed makes sure a changefeed of the events of kinds, all kinds
+// when empty, runs into sinkURI. A running changefeed created for the same sink
+// is kept, one created for another sink is canceled and replaced, and a failed
+// or canceled one is recreated. It returns the job ID and whether the job was
+// created now; the ID is 0 while another node is checking the job.
+func (db *DB) EnsureSinkChangefeed(ctx context.Context, sinkURI string, kinds []int, now int64) (int64, bool, error) {
+	var storedHash string
+	var jobID int64
+	err := db.Pool.QueryRow(ctx,
+		`INSERT INTO event_sinks (name, sink_hash, job_id, updated_at) VALUES ($1, '', 0, $2)
+		 ON CONFLICT (name) DO UPDATE SET updated_at = excluded.updated_at
+		 WHERE event_sinks.updated_at < $3
+		 RETURNING sink_hash, job_id`,
+		sinkChangefeedName, now, now-sinkLease).Scan(&storedHash, &jobID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to claim sink changefeed: %w", err)
+	}
+
+	hash := sinkHash(sinkURI, kinds)
+	if jobID != 0 && storedHash == hash {
+		status, err := db.jobStatus(ctx, jobID)
+		if err != nil {
+			return 0, false, err
+		}
+		if status == "running" || status == "paused" || status == "pending" {
+			return jobID, false, db.releaseSinkChangefeed(ctx, hash, jobID)
+		}
+	} else if jobID != 0 {
+		if _, err := db.Pool.Exec(ctx, `CANCEL JOB $1`, jobID); err != nil && !isJobFinished(err) {
+			return 0, false, fmt.Errorf("failed to cancel previous sink changefeed %d: %w", jobID, err)
+		}
+	}
+
+	query := `CREATE CHANGEFEED FOR TABLE events INTO $1 WITH format = 'json', initial_scan = 'no'`
+	if len(kinds) > 0 {
+		list := make([]string, len(kinds))
+		for i, kind := range kinds {
+			list[i] = strconv.Itoa(kind)
+		}
+		query = `CREATE CHANGEFEED INTO $1 WITH format = 'json', initial_scan = 'no'
+		 AS SELECT * FROM events WHERE kind IN (` + strings.Join(list, ", ") + `)`
+	}
+	if err := db.Pool.QueryRow(ctx, query, sinkURI).Scan(&jobID); err != nil {
+		_ = db.releaseSinkChangefeed(ctx, "", 0)
+		return 0, false, fmt.Errorf("failed to create sink changefeed: %w", err)
+	}
+	return jobID, true, db.releaseSinkChangefeed(ctx, hash, jobID)
+}
+
+// DropSinkChangefeed cancels the sink changefeed, if any, returning its job ID
+func (db *DB) DropSinkChangefeed(ctx context.Context) (int64, error) {
+	var jobID int64
+	err := db.Pool.QueryRow(ctx, `SELECT job_id FROM event_sinks WHERE name = $1`, sinkChangefeedName).Scan(&jobID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to load sink changefeed: %w", err)
+	}
+	if jobID != 0 {
+		if _, err := db.Pool.Exec(ctx, `CANCEL JOB $1`, jobID); err != nil && !isJobFinished(err) {
+			return 0, fmt.Errorf("failed to cancel sink changefeed %d: %w", jobID, err)
+		}
+	}
+	if _, err := db.Pool.Exec(ctx, `DELETE FROM event_sinks WHERE name = $1`, sinkChangefeedName); err != nil {
+		return 0, fmt.Errorf("failed to forget sink changefeed: %w", err)
+	}
+	return jobID, nil
+}
+
+// releaseSinkChangefeed records the job created for hash and ends the lease
+func (db *DB) releaseSinkChangefeed(ctx context.Context, hash string, jobID int64) error {
+	if _, err := db.Pool.Exec(ctx,
+		`UPDATE event_sinks SET sink_hash = $2, job_id = $3, updated_at = 0 WHERE name = $1`,
+		sinkChangefeedName, hash, jobID); err != nil {
+		return fmt.Errorf("failed to record sink changefeed: %w", err)
+	}
+	return nil
+}
+
+// jobStatus returns the status of a job, empty when the job is gone
+func (db *DB) jobStatus(ctx context.Context, jobID int64) (string, error) {
+	var status string
+	err := db.Pool.QueryRow(ctx, `SELECT status FROM crdb_internal.jobs WHERE job_id = $1`, jobID).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load job %d: %w", jobID, err)
+	}
+	return status, nil
+}
+
+// isJobFinished reports whether CANCEL JOB failed because the job already ended
+func isJobFinished(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "not found") || strings.Contains(msg, "cannot be requested to be canceled") ||
+		strings.Contains(msg, "status canceled") || strings.Contains(msg, "status failed") ||
+		strings.Contains(msg, "status succeeded")
+}
+
+// sinkHash identifies a sink URI and kinds without keeping the URI's credentials
+func sinkHash(sinkURI string, kinds []int) string {
+	h := sha256.New()
+	h.Write([]byte(sinkURI))
+	for _, kind := range kinds {
+		h.Write([]byte("," + strconv.Itoa(kind)))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrSuspensionNotFound is returned when reinstating a pubkey that isn't suspended
+var ErrSuspensionNotFound = errors.New("pubkey is not suspended")
+
+// Suspension bars a pubkey from publishing; it can still read. A shadow
+// suspension acknowledges the pubkey's events as if they were stored, so it
+// isn't told it was suspended.
+type Suspension struct {
+	PubKey      string `json:"pubkey"`
+	Reason      string `json:"reason,omitempty"`
+	SuspendedAt int64  `json:"suspended_at"`
+	Shadow      bool   `json:"shadow,omitempty"`
+}
+
+// SuspendPubkey records or updates a pubkey's suspension
+func (db *DB) SuspendPubkey(ctx context.Context, s Suspension) error {
+	_, err := db.Pool.Exec(ctx,
+		`UPSERT INTO suspended_pubkeys (pubkey, reason, suspended_at, shadow) VALUES ($1, $2, $3, $4)`,
+		s.PubKey, s.Reason, s.SuspendedAt, s.Shadow)
+	if err != nil {
+		return fmt.Errorf("failed to record suspension: %w", err)
+	}
+	return nil
+}
+
+// ReinstatePubkey lifts a pubkey's suspension
+func (db *DB) ReinstatePubkey(ctx context.Context, pubkey string) error {
+	tag, err := db.Pool.Exec(ctx, `DELETE FROM suspended_pubkeys WHERE pubkey = $1`, pubkey)
+	if err != nil {
+		return fmt.Errorf("failed to delete suspension: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSuspensionNotFound
+	}
+	return nil
+}
+
+// GetSuspensions returns every suspended pubkey, most recently suspended first
+func (db *DB) GetSuspensions(ctx context.Context) ([]Suspension, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT pubkey, reason, suspended_at, shadow FROM suspended_pubkeys ORDER BY suspended_at DESC, pubkey ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load suspensions: %w", err)
+	}
+	defer rows.Close()
+
+	suspensions := []Suspension{}
+	for rows.Next() {
+		var s Suspension
+		if err := rows.Scan(&s.PubKey, &s.Reason, &s.SuspendedAt, &s.Shadow); err != nil {
+			return nil, fmt.Errorf("failed to scan suspension: %w", err)
+		}
+		suspensions = append(suspensions, s)
+	}
+	return suspensions, rows.Err()
+}
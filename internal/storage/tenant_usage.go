@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TenantUsage is what a virtual relay used over a period
+type TenantUsage struct {
+	Tenant string `json:"tenant"`
+	// Events is the new events stored
+	Events int64 `json:"events"`
+	// BytesIn and BytesOut are the WebSocket message bytes received from and
+	// sent to the tenant's clients
+	BytesIn  int64 `json:"bytes_in"`
+	BytesOut int64 `json:"bytes_out"`
+	// ConnectionSeconds is the time clients were connected, added up
+	ConnectionSeconds float64 `json:"connection_seconds"`
+}
+
+// TenantMeter accounts the events stored by each virtual relay
+type TenantMeter interface {
+	EventStored(tenant string)
+}
+
+// EnableTenantMetering accounts every new event to its tenant in meter. Must be
+// called before events are queued.
+func (ep *EventProcessor) EnableTenantMetering(meter TenantMeter) {
+	ep.tenantMeter = meter
+}
+
+// AddTenantUsage adds usage to the usage recorded for the UTC day starting at day
+func (db *DB) AddTenantUsage(ctx context.Context, day int64, usage []TenantUsage) error {
+	if len(usage) == 0 {
+		return nil
+	}
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin tenant usage transaction: %w", err)
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil && !errors.Is(rollbackErr, pgx.ErrTxClosed) {
+			db.recordError(fmt.Errorf("rollback failed: %w", rollbackErr))
+		}
+	}()
+
+	for _, u := range usage {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO tenant_usage (tenant, day, events, bytes_in, bytes_out, connection_seconds)
+			 VALUES ($1, $2, $3, $4, $5, $6)
+			 ON CONFLICT (tenant, day) DO UPDATE SET
+			   events = tenant_usage.events + excluded.events,
+			   bytes_in = tenant_usage.bytes_in + excluded.bytes_in,
+			   bytes_out = tenant_usage.bytes_out + excluded.bytes_out,
+			   connection_seconds = tenant_usage.connection_seconds + excluded.connection_seconds`,
+			u.Tenant, day, u.Events, u.BytesIn, u.BytesOut, u.ConnectionSeconds); err != nil {
+			return fmt.Errorf("failed to record tenant usage: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit tenant usage: %w", err)
+	}
+	return nil
+}
+
+// GetTenantUsage returns the usage of every tenant, or only of tenant when set,
+// over the UTC days starting in [from, to), ordered by tenant
+func (db *DB) GetTenantUsage(ctx context.Context, from, to int64, tenant string) ([]TenantUsage, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT tenant, SUM(events), SUM(bytes_in), SUM(bytes_out), SUM(connection_seconds)
+		 FROM tenant_usage
+		 WHERE day >= $1 AND day < $2 AND ($3 = '' OR tenant = $3)
+		 GROUP BY tenant
+		 ORDER BY tenant`,
+		from, to, tenant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tenant usage: %w", err)
+	}
+	defer rows.Close()
+
+	usage := []TenantUsage{}
+	for rows.Next() {
+		var u TenantUsage
+		if err := rows.Scan(&u.Tenant, &u.Events, &u.BytesIn, &u.BytesOut, &u.ConnectionSeconds); err != nil {
+			return nil, fmt.Errorf("failed to scan tenant usage: %w", err)
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Shugur-Network/relay/internal/config"
+	"github.com/jackc/pgx/v5"
+	nostr "github.com/nbd-wtf/go-nostr"
+)
+
+// DefaultTenant is the tenant of the main relay, which events and clients belong
+// to unless they came in through a virtual relay
+const DefaultTenant = ""
+
+// TenantEvent is a stored event with the tenant it was published to
+type TenantEvent struct {
+	Tenant string
+	Event  nostr.Event
+}
+
+// ErrTenantNotFound is returned when deleting a tenant that isn't stored
+var ErrTenantNotFound = errors.New("tenant not found")
+
+// SaveTenant records or replaces the definition of a tenant created at runtime
+func (db *DB) SaveTenant(ctx context.Context, t config.TenantConfig, now int64) error {
+	definition, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("failed to encode tenant: %w", err)
+	}
+	_, err = db.Pool.Exec(ctx,
+		`INSERT INTO tenants (id, definition, created_at, updated_at) VALUES ($1, $2, $3, $3)
+		 ON CONFLICT (id) DO UPDATE SET definition = excluded.definition, updated_at = excluded.updated_at`,
+		t.ID, definition, now)
+	if err != nil {
+		return fmt.Errorf("failed to save tenant: %w", err)
+	}
+	return nil
+}
+
+// GetTenants returns the tenants created at runtime, ordered by ID
+func (db *DB) GetTenants(ctx context.Context) ([]config.TenantConfig, error) {
+	rows, err := db.Pool.Query(ctx, `SELECT definition FROM tenants ORDER BY id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tenants: %w", err)
+	}
+	defer rows.Close()
+
+	tenants := []config.TenantConfig{}
+	for rows.Next() {
+		var definition []byte
+		if err := rows.Scan(&definition); err != nil {
+			return nil, fmt.Errorf("failed to scan tenant: %w", err)
+		}
+		var t config.TenantConfig
+		if err := json.Unmarshal(definition, &t); err != nil {
+			return nil, fmt.Errorf("failed to decode tenant: %w", err)
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, rows.Err()
+}
+
+// tenantTables are the tables besides events keyed by tenant, whose rows go
+// with a deleted tenant so a tenant recreated with the same ID starts empty.
+// tenant_usage is kept as the billing history of deleted tenants; revalidation
+// runs span every tenant and only point at one with their cursor.
+var tenantTables = []string{
+	"spam_reports", "event_search_attrs", "nip05_domains", "capsule_unlocks",
+	"capsule_shares", "capsule_share_thresholds", "deleted_events", "event_receipts",
+	"quarantined_events", "zap_receipts", "vanished_pubkeys",
+}
+
+// DeleteTenant deletes a tenant created at runtime together with its events and
+// every other row kept for it, except its usage history
+func (db *DB) DeleteTenant(ctx context.Context, id string) error {
+	if id == DefaultTenant {
+		return ErrTenantNotFound
+	}
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin tenant deletion: %w", err)
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil && !errors.Is(rollbackErr, pgx.ErrTxClosed) {
+			db.recordError(fmt.Errorf("rollback failed: %w", rollbackErr))
+		}
+	}()
+
+	tag, err := tx.Exec(ctx, `DELETE FROM tenants WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete tenant: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTenantNotFound
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM events WHERE tenant = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete tenant events: %w", err)
+	}
+	for _, table := range tenantTables {
+		if _, err := tx.Exec(ctx, `DELETE FROM `+table+` WHERE tenant = $1`, id); err != nil {
+			return fmt.Errorf("failed to delete tenant %s: %w", table, err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit tenant deletion: %w", err)
+	}
+	return nil
+}
+
+// CountTenantEvents returns the number of stored events of each virtual relay
+// holding any
+func (db *DB) CountTenantEvents(ctx context.Context) (map[string]int64, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT tenant, count(*) FROM events WHERE tenant != $1 GROUP BY tenant`, DefaultTenant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count tenant events: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var tenant string
+		var count int64
+		if err := rows.Scan(&tenant, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan tenant event count: %w", err)
+		}
+		counts[tenant] = count
+	}
+	return counts, rows.Err()
+}
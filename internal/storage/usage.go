@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// PubkeyUsage is one pubkey's billing and usage over a report range. Amounts are
+// in msats; the balance and admission are current, everything else is counted
+// within the range.
+type PubkeyUsage struct {
+	PubKey string `json:"pubkey"`
+	// Tier and PaidUntil are the current admission, PaidUntil nil when the pubkey
+	// holds none and 0 when it never lapses
+	Tier      string `json:"tier,omitempty"`
+	PaidUntil *int64 `json:"paid_until,omitempty"`
+	// InvoicedMsats is paid lightning invoices; CreditedMsats and SpentMsats are
+	// ledger top-ups (zaps, Cashu) and what they bought
+	InvoicedMsats int64 `json:"invoiced_msats"`
+	CreditedMsats int64 `json:"credited_msats"`
+	SpentMsats    int64 `json:"spent_msats"`
+	BalanceMsats  int64 `json:"balance_msats"`
+	// Events and EventBytes are the events published to the main relay, what the
+	// free daily quota meters, and the bytes of content and tags they store
+	Events     int64 `json:"events"`
+	EventBytes int64 `json:"event_bytes"`
+	// Blobs and BlobBytes are the media blobs uploaded
+	Blobs     int64 `json:"blobs"`
+	BlobBytes int64 `json:"blob_bytes"`
+}
+
+// GetUsageReport returns the usage in [from, to) of every pubkey that holds an
+// admission or paid or was credited in the range, or only of pubkey when set,
+// ordered by pubkey
+func (db *DB) GetUsageReport(ctx context.Context, from, to int64, pubkey string) ([]PubkeyUsage, error) {
+	rows, err := db.Pool.Query(ctx,
+		`WITH members AS (
+		   SELECT pubkey FROM paid_pubkeys
+		   UNION SELECT pubkey FROM payment_invoices WHERE status = 'paid' AND paid_at >= $1 AND paid_at < $2
+		   UNION SELECT pubkey FROM payment_ledger WHERE created_at >= $1 AND created_at < $2
+		 ),
+		 reported AS (
+		   SELECT pubkey FROM members WHERE $3 = ''
+		   UNION SELECT $3::CHAR(64) WHERE $3 != ''
+		 ),
+		 invoiced AS (
+		   SELECT pubkey, SUM(amount_msats) AS msats FROM payment_invoices
+		   WHERE status = 'paid' AND paid_at >= $1 AND paid_at < $2 AND pubkey IN (SELECT pubkey FROM reported)
+		   GROUP BY pubkey
+		 ),
+		 ledger AS (
+		   SELECT pubkey,
+		     SUM(CASE WHEN amount_msats > 0 AND created_at >= $1 AND created_at < $2 THEN amount_msats ELSE 0 END) AS credited,
+		     SUM(CASE WHEN amount_msats < 0 AND created_at >= $1 AND created_at < $2 THEN -amount_msats ELSE 0 END) AS spent,
+		     SUM(amount_msats) AS balance
+		   FROM payment_ledger WHERE pubkey IN (SELECT pubkey FROM reported)
+		   GROUP BY pubkey
+		 ),
+		 published AS (
+		   SELECT pubkey, COUNT(*) AS events,
+		     SUM(COALESCE(octet_length(content), 0) + COALESCE(octet_length(tags::STRING), 0)) AS bytes
+		   FROM events
+		   WHERE created_at >= $1 AND created_at < $2 AND tenant = $4 AND pubkey IN (SELECT pubkey FROM reported)
+		   GROUP BY pubkey
+		 ),
+		 uploaded AS (
+		   SELECT o.pubkey, COUNT(*) AS blobs, SUM(b.size) AS bytes
+		   FROM media_blob_owners o JOIN media_blobs b ON b.sha256 = o.sha256
+		   WHERE o.uploaded >= $1 AND o.uploaded < $2 AND o.pubkey IN (SELECT pubkey FROM reported)
+		   GROUP BY o.pubkey
+		 )
+		 SELECT r.pubkey, COALESCE(p.tier, ''), p.paid_until,
+		   COALESCE(i.msats, 0), COALESCE(l.credited, 0), COALESCE(l.spent, 0), COALESCE(l.balance, 0),
+		   COALESCE(e.events, 0), COALESCE(e.bytes, 0), COALESCE(u.blobs, 0), COALESCE(u.bytes, 0)
+		 FROM reported r
+		 LEFT JOIN paid_pubkeys p ON p.pubkey = r.pubkey
+		 LEFT JOIN invoiced i ON i.pubkey = r.pubkey
+		 LEFT JOIN ledger l ON l.pubkey = r.pubkey
+		 LEFT JOIN published e ON e.pubkey = r.pubkey
+		 LEFT JOIN uploaded u ON u.pubkey = r.pubkey
+		 ORDER BY r.pubkey`,
+		from, to, pubkey, DefaultTenant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load usage report: %w", err)
+	}
+	defer rows.Close()
+
+	usage := []PubkeyUsage{}
+	for rows.Next() {
+		var u PubkeyUsage
+		if err := rows.Scan(&u.PubKey, &u.Tier, &u.PaidUntil,
+			&u.InvoicedMsats, &u.CreditedMsats, &u.SpentMsats, &u.BalanceMsats,
+			&u.Events, &u.EventBytes, &u.Blobs, &u.BlobBytes); err != nil {
+			return nil, fmt.Errorf("failed to scan usage report: %w", err)
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
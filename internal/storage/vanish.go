@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	nostr "github.com/nbd-wtf/go-nostr"
+)
+
+// Vanish is a pubkey that asked to vanish with a NIP-62 request. Its events up
+// to VanishedAt, and the gift wraps sent to it, are gone and refused.
+type Vanish struct {
+	Tenant       string `json:"tenant,omitempty"`
+	PubKey       string `json:"pubkey"`
+	RequestID    string `json:"request_id"`
+	VanishedAt   int64  `json:"vanished_at"`
+	ReceivedAt   int64  `json:"received_at"`
+	PurgedEvents int64  `json:"purged_events"`
+}
+
+// deleteReturningEvents runs a DELETE ... RETURNING id, pubkey and returns the
+// ids and authors of the deleted events
+func deleteReturningEvents(ctx context.Context, tx pgx.Tx, query string, args ...interface{}) ([]nostr.Event, error) {
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []nostr.Event
+	for rows.Next() {
+		var evt nostr.Event
+		if err := rows.Scan(&evt.ID, &evt.PubKey); err != nil {
+			return nil, err
+		}
+		events = append(events, evt)
+	}
+	return events, rows.Err()
+}
+
+// PersistVanish carries out the NIP-62 request to vanish req on tenant: it
+// deletes every event its author published there up to the request, the gift
+// wraps addressed to them, and stores the request in their place. The pubkey
+// is recorded as vanished so the deleted events aren't accepted again.
+func (db *DB) PersistVanish(ctx context.Context, tenant string, req nostr.Event) (Vanish, error) {
+	pubkey := strings.ToLower(req.PubKey)
+	until := req.CreatedAt.Time().Unix()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return Vanish{}, err
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil && !errors.Is(rollbackErr, pgx.ErrTxClosed) {
+			db.recordError(fmt.Errorf("rollback failed: %w", rollbackErr))
+		}
+	}()
+
+	deleted, err := deleteReturningEvents(ctx, tx,
+		`DELETE FROM events WHERE pubkey = $1 AND created_at <= $2 AND tenant = $3 RETURNING id, pubkey`,
+		pubkey, until, tenant)
+	if err != nil {
+		return Vanish{}, fmt.Errorf("failed to delete events: %w", err)
+	}
+
+	recipient, _ := json.Marshal([][]string{{"p", pubkey}})
+	wraps, err := deleteReturningEvents(ctx, tx,
+		`DELETE FROM events WHERE kind = 1059 AND tags @> $1 AND created_at <= $2 AND tenant = $3 RETURNING id, pubkey`,
+		string(recipient), until, tenant)
+	if err != nil {
+		return Vanish{}, fmt.Errorf("failed to delete gift wraps: %w", err)
+	}
+	deleted = append(deleted, wraps...)
+
+	ids := make([]string, len(deleted))
+	for i, evt := range deleted {
+		ids[i] = evt.ID
+	}
+	if err := recordDeletedIDs(ctx, tx, tenant, ids, req); err != nil {
+		return Vanish{}, err
+	}
+	if err := forgetSpamReports(ctx, tx, tenant, ids); err != nil {
+		return Vanish{}, err
+	}
+	if err := forgetEventReceipts(ctx, tx, tenant, ids); err != nil {
+		return Vanish{}, err
+	}
+
+	v := Vanish{
+		Tenant:       tenant,
+		PubKey:       pubkey,
+		RequestID:    req.ID,
+		VanishedAt:   until,
+		ReceivedAt:   time.Now().Unix(),
+		PurgedEvents: int64(len(deleted)),
+	}
+	_, err = tx.Exec(ctx,
+		`UPSERT INTO vanished_pubkeys (tenant, pubkey, request_id, vanished_at, received_at, purged_events)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		v.Tenant, v.PubKey, v.RequestID, v.VanishedAt, v.ReceivedAt, v.PurgedEvents)
+	if err != nil {
+		return Vanish{}, fmt.Errorf("failed to record vanished pubkey: %w", err)
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO events (id,pubkey,created_at,kind,tags,content,sig,tenant)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`,
+		req.ID, req.PubKey, until, req.Kind, req.Tags, req.Content, req.Sig, tenant)
+	if err != nil {
+		return Vanish{}, fmt.Errorf("failed to store request to vanish: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return Vanish{}, err
+	}
+	if tenant == DefaultTenant {
+		db.forgetEvents(deleted)
+	}
+	db.Bloom.AddString(DedupKey(tenant, req.ID))
+	return v, nil
+}
+
+// GetVanishes returns every pubkey that asked to vanish, on any tenant
+func (db *DB) GetVanishes(ctx context.Context) ([]Vanish, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT tenant, pubkey, request_id, vanished_at, received_at, purged_events FROM vanished_pubkeys`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load vanished pubkeys: %w", err)
+	}
+	defer rows.Close()
+
+	vanishes := []Vanish{}
+	for rows.Next() {
+		var v Vanish
+		if err := rows.Scan(&v.Tenant, &v.PubKey, &v.RequestID, &v.VanishedAt, &v.ReceivedAt, &v.PurgedEvents); err != nil {
+			return nil, fmt.Errorf("failed to scan vanished pubkey: %w", err)
+		}
+		vanishes = append(vanishes, v)
+	}
+	return vanishes, rows.Err()
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// Webhook delivery statuses
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+)
+
+// WebhookDelivery is a queued payment webhook. Payload is the exact JSON body,
+// so retries are signed and sent unchanged.
+type WebhookDelivery struct {
+	ID        string
+	EventType string
+	Payload   string
+	Attempts  int
+	CreatedAt int64
+}
+
+// EnqueueWebhook queues a webhook for delivery at now. It returns false when a
+// webhook with the same id was already queued, by this node or another one.
+func (db *DB) EnqueueWebhook(ctx context.Context, d WebhookDelivery) (bool, error) {
+	tag, err := db.Pool.Exec(ctx,
+		`INSERT INTO payment_webhooks (id, event_type, payload, status, attempts, next_attempt_at, created_at)
+		 VALUES ($1, $2, $3, $4, 0, $5, $5)
+		 ON CONFLICT (id) DO NOTHING`,
+		d.ID, d.EventType, d.Payload, WebhookPending, d.CreatedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to queue webhook: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// ClaimDueWebhooks returns pending webhooks due at now and pushes their next
+// attempt to lease, so other nodes skip them while they are being delivered
+func (db *DB) ClaimDueWebhooks(ctx context.Context, now, lease int64, limit int) ([]WebhookDelivery, error) {
+	rows, err := db.Pool.Query(ctx,
+		`UPDATE payment_webhooks SET next_attempt_at = $3
+		 WHERE id IN (
+		   SELECT id FROM payment_webhooks
+		   WHERE status = $1 AND next_attempt_at <= $2
+		   ORDER BY next_attempt_at ASC LIMIT $4
+		 )
+		 RETURNING id, event_type, payload, attempts, created_at`,
+		WebhookPending, now, lease, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var due []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.EventType, &d.Payload, &d.Attempts, &d.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		due = append(due, d)
+	}
+	return due, rows.Err()
+}
+
+// MarkWebhookDelivered records a successful delivery
+func (db *DB) MarkWebhookDelivered(ctx context.Context, id string) error {
+	if _, err := db.Pool.Exec(ctx,
+		`UPDATE payment_webhooks SET status = $2, attempts = attempts + 1 WHERE id = $1`,
+		id, WebhookDelivered); err != nil {
+		return fmt.Errorf("failed to mark webhook delivered: %w", err)
+	}
+	return nil
+}
+
+// RetryWebhook records a failed delivery attempt and schedules the next one at
+// nextAttempt, or gives up on the webhook when failed is set
+func (db *DB) RetryWebhook(ctx context.Context, id string, nextAttempt int64, failed bool) error {
+	status := WebhookPending
+	if failed {
+		status = WebhookFailed
+	}
+	if _, err := db.Pool.Exec(ctx,
+		`UPDATE payment_webhooks SET status = $2, attempts = attempts + 1, next_attempt_at = $3 WHERE id = $1`,
+		id, status, nextAttempt); err != nil {
+		return fmt.Errorf("failed to reschedule webhook: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/Shugur-Network/relay/internal/relay/nips"
+	nostr "github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+// zapTargetColumns maps the tags a zap receipt names its target with to the
+// zap_receipts columns indexing them
+var zapTargetColumns = map[string]string{
+	"p": "recipient",
+	"e": "event_id",
+	"a": "address",
+}
+
+// ZapTotal sums the zap receipts of a pubkey, event or address
+type ZapTotal struct {
+	Count       int64 `json:"count"`
+	AmountMsats int64 `json:"amount_msats"`
+}
+
+// maxZapVerifications bounds the zap provider lookups running at once; receipts
+// stored while as many run aren't indexed
+const maxZapVerifications = 16
+
+// ZapProviderResolver returns the pubkey that signs the zap receipts of a
+// pubkey of tenant: the nostrPubkey of the LNURL-pay document behind the
+// lightning address of its profile
+type ZapProviderResolver func(ctx context.Context, tenant, pubkey string) (string, error)
+
+// zapVerifier checks the signers of new zap receipts
+type zapVerifier struct {
+	resolve ZapProviderResolver
+	timeout time.Duration
+	slots   chan struct{}
+}
+
+// EnableZapIndex makes the processor index new zap receipts for zap totals,
+// once resolve confirms they were signed by their recipient's zap provider.
+// Must be called before events are processed.
+func (ep *EventProcessor) EnableZapIndex(resolve ZapProviderResolver, timeout time.Duration) {
+	ep.zaps = &zapVerifier{
+		resolve: resolve,
+		timeout: timeout,
+		slots:   make(chan struct{}, maxZapVerifications),
+	}
+}
+
+// indexZapReceipt records who and what a newly stored zap receipt zaps, and for
+// how much, so zap totals don't decode every receipt. Receipts not signed by
+// the recipient's zap provider are left out: anyone could make them up.
+func (ep *EventProcessor) indexZapReceipt(tenant string, evt nostr.Event) {
+	receipt, err := nips.ParseZapReceipt(&evt)
+	if err != nil {
+		logger.Debug("Zap receipt not indexed", zap.String("event_id", evt.ID), zap.Error(err))
+		return
+	}
+	select {
+	case ep.zaps.slots <- struct{}{}:
+	default:
+		logger.Debug("Too many zap provider lookups running, skipping receipt", zap.String("event_id", evt.ID))
+		return
+	}
+	go func() {
+		defer func() { <-ep.zaps.slots }()
+
+		ctx, cancel := context.WithTimeout(ep.ctx, ep.zaps.timeout)
+		provider, err := ep.zaps.resolve(ctx, tenant, receipt.Recipient)
+		cancel()
+		if err != nil || !strings.EqualFold(provider, evt.PubKey) {
+			logger.Debug("Zap receipt not signed by the recipient's zap provider",
+				zap.String("event_id", evt.ID),
+				zap.String("provider", provider),
+				zap.Error(err))
+			return
+		}
+
+		ctx, cancel = context.WithTimeout(ep.ctx, 3*time.Second)
+		defer cancel()
+		if _, err := ep.db.Pool.Exec(ctx,
+			`UPSERT INTO zap_receipts (id, tenant, recipient, event_id, address, sender, amount_msats, created_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			evt.ID, tenant, receipt.Recipient, receipt.EventID, receipt.Address, receipt.Sender,
+			receipt.AmountMsats, int64(evt.CreatedAt)); err != nil {
+			logger.Warn("Failed to index zap receipt", zap.String("event_id", evt.ID), zap.Error(err))
+		}
+	}()
+}
+
+// GetZapTotals sums the stored zap receipts of tenant whose tag (p, e or a)
+// names value
+func (db *DB) GetZapTotals(ctx context.Context, tenant, tag, value string) (ZapTotal, error) {
+	column, ok := zapTargetColumns[tag]
+	if !ok {
+		return ZapTotal{}, fmt.Errorf("zap receipts aren't indexed by %q tags", tag)
+	}
+	if err := db.allow(); err != nil {
+		return ZapTotal{}, err
+	}
+
+	// Receipts deleted since they were indexed don't count
+	var total ZapTotal
+	err := db.Pool.QueryRow(ctx, fmt.Sprintf(
+		`SELECT count(*), COALESCE(sum(amount_msats), 0)::INT8 FROM zap_receipts z
+		 WHERE tenant = $1 AND %s = $2 AND EXISTS (SELECT 1 FROM events WHERE tenant = z.tenant AND id = z.id)`, column),
+		tenant, value).Scan(&total.Count, &total.AmountMsats)
+	db.observe(err)
+	if err != nil {
+		return ZapTotal{}, fmt.Errorf("failed to sum zap receipts: %w", err)
+	}
+	return total, nil
+}
@@ -0,0 +1,150 @@
+package tenant
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/metrics"
+	"github.com/Shugur-Network/relay/internal/storage"
+)
+
+// Meter accounts the usage of each virtual relay until it is drained to the
+// database. The main relay isn't metered.
+type Meter struct {
+	mu    sync.Mutex
+	usage map[string]*storage.TenantUsage
+	// open is the number of clients connected to each tenant
+	open map[string]int
+	// accruedAt is when connection time was last accounted
+	accruedAt time.Time
+}
+
+// NewMeter returns a meter with nothing accounted
+func NewMeter() *Meter {
+	return &Meter{
+		usage:     make(map[string]*storage.TenantUsage),
+		open:      make(map[string]int),
+		accruedAt: time.Now(),
+	}
+}
+
+// EventStored accounts a new event stored by tenant
+func (m *Meter) EventStored(tenant string) {
+	if tenant == storage.DefaultTenant {
+		return
+	}
+	m.mu.Lock()
+	m.get(tenant).Events++
+	m.mu.Unlock()
+	metrics.TenantEventsStored.WithLabelValues(tenant).Inc()
+}
+
+// BytesIn accounts n bytes received from a client of tenant
+func (m *Meter) BytesIn(tenant string, n int) {
+	if tenant == storage.DefaultTenant {
+		return
+	}
+	m.mu.Lock()
+	m.get(tenant).BytesIn += int64(n)
+	m.mu.Unlock()
+	metrics.TenantBytes.WithLabelValues(tenant, "in").Add(float64(n))
+}
+
+// BytesOut accounts n bytes sent to a client of tenant
+func (m *Meter) BytesOut(tenant string, n int) {
+	if tenant == storage.DefaultTenant {
+		return
+	}
+	m.mu.Lock()
+	m.get(tenant).BytesOut += int64(n)
+	m.mu.Unlock()
+	metrics.TenantBytes.WithLabelValues(tenant, "out").Add(float64(n))
+}
+
+// Connected starts accounting the connection time of a client of tenant
+func (m *Meter) Connected(tenant string) {
+	if tenant == storage.DefaultTenant {
+		return
+	}
+	m.mu.Lock()
+	m.accrue(time.Now())
+	m.open[tenant]++
+	m.mu.Unlock()
+	metrics.TenantConnections.WithLabelValues(tenant).Inc()
+}
+
+// Disconnected stops accounting the connection time of a client of tenant
+func (m *Meter) Disconnected(tenant string) {
+	if tenant == storage.DefaultTenant {
+		return
+	}
+	m.mu.Lock()
+	m.accrue(time.Now())
+	if m.open[tenant]--; m.open[tenant] <= 0 {
+		delete(m.open, tenant)
+	}
+	m.mu.Unlock()
+	metrics.TenantConnections.WithLabelValues(tenant).Dec()
+}
+
+// Drain returns the usage accounted since the last drain, with the connection
+// time of the clients still connected counted up to now
+func (m *Meter) Drain() []storage.TenantUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.accrue(time.Now())
+
+	drained := make([]storage.TenantUsage, 0, len(m.usage))
+	for _, u := range m.usage {
+		drained = append(drained, *u)
+	}
+	m.usage = make(map[string]*storage.TenantUsage)
+	return drained
+}
+
+// Restore accounts usage again, after it was drained but couldn't be stored
+func (m *Meter) Restore(usage []storage.TenantUsage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range usage {
+		total := m.get(u.Tenant)
+		total.Events += u.Events
+		total.BytesIn += u.BytesIn
+		total.BytesOut += u.BytesOut
+		total.ConnectionSeconds += u.ConnectionSeconds
+	}
+}
+
+// Forget drops the metrics of a deleted tenant
+func (m *Meter) Forget(tenant string) {
+	metrics.TenantEventsStored.DeleteLabelValues(tenant)
+	metrics.TenantBytes.DeleteLabelValues(tenant, "in")
+	metrics.TenantBytes.DeleteLabelValues(tenant, "out")
+	metrics.TenantConnectionSeconds.DeleteLabelValues(tenant)
+	metrics.TenantConnections.DeleteLabelValues(tenant)
+}
+
+// accrue accounts the connection time of the connected clients up to now; m.mu
+// must be held
+func (m *Meter) accrue(now time.Time) {
+	elapsed := now.Sub(m.accruedAt).Seconds()
+	m.accruedAt = now
+	if elapsed <= 0 {
+		return
+	}
+	for tenant, open := range m.open {
+		seconds := float64(open) * elapsed
+		m.get(tenant).ConnectionSeconds += seconds
+		metrics.TenantConnectionSeconds.WithLabelValues(tenant).Add(seconds)
+	}
+}
+
+// get returns the usage accounted to tenant; m.mu must be held
+func (m *Meter) get(tenant string) *storage.TenantUsage {
+	u, ok := m.usage[tenant]
+	if !ok {
+		u = &storage.TenantUsage{Tenant: tenant}
+		m.usage[tenant] = u
+	}
+	return u
+}
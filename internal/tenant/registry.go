@@ -0,0 +1,207 @@
+// Package tenant routes requests to the virtual relays hosted alongside the main
+// relay. A tenant is reached on its own hosts or path and keeps its own policies.
+package tenant
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Shugur-Network/relay/internal/config"
+)
+
+// Registry holds the tenants by ID. Tenants are stored as values and handed out
+// as copies, so a tenant read by a connection never changes under it.
+type Registry struct {
+	mu      sync.RWMutex
+	tenants map[string]config.TenantConfig
+	// configured are the IDs of the tenants from TENANTS, which can't be changed
+	// at runtime
+	configured map[string]bool
+	// stored is the last count of each tenant's stored events
+	stored map[string]int64
+}
+
+// NewRegistry returns a registry of the configured tenants
+func NewRegistry(tenants []config.TenantConfig) *Registry {
+	r := &Registry{
+		tenants:    make(map[string]config.TenantConfig, len(tenants)),
+		configured: make(map[string]bool, len(tenants)),
+		stored:     make(map[string]int64),
+	}
+	for _, t := range tenants {
+		r.tenants[t.ID] = t
+		r.configured[t.ID] = true
+	}
+	return r
+}
+
+// Configured reports whether the tenant with id comes from the configuration
+func (r *Registry) Configured(id string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.configured[id]
+}
+
+// Put adds t or replaces the tenant with its ID. It fails for a configured tenant
+// and for routes already taken by another tenant.
+func (r *Registry) Put(t config.TenantConfig) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.configured[t.ID] {
+		return fmt.Errorf("tenant %q is configured in TENANTS", t.ID)
+	}
+	if err := r.conflict(t); err != nil {
+		return err
+	}
+	r.tenants[t.ID] = t
+	return nil
+}
+
+// Remove drops the tenant with id, unless it is configured. It reports whether
+// a tenant was removed.
+func (r *Registry) Remove(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tenants[id]; !ok || r.configured[id] {
+		return false
+	}
+	delete(r.tenants, id)
+	return true
+}
+
+// Sync replaces the tenants created at runtime with stored. It returns the
+// stored tenants left out for clashing with the configured ones.
+func (r *Registry) Sync(stored []config.TenantConfig) []config.TenantConfig {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id := range r.tenants {
+		if !r.configured[id] {
+			delete(r.tenants, id)
+		}
+	}
+
+	var skipped []config.TenantConfig
+	for _, t := range stored {
+		if r.configured[t.ID] || r.conflict(t) != nil {
+			skipped = append(skipped, t)
+			continue
+		}
+		r.tenants[t.ID] = t
+	}
+	return skipped
+}
+
+// conflict returns an error when another tenant is reached on a route of t;
+// r.mu must be held
+func (r *Registry) conflict(t config.TenantConfig) error {
+	routes := t.Routes()
+	for _, other := range r.tenants {
+		if other.ID == t.ID {
+			continue
+		}
+		for _, route := range other.Routes() {
+			for _, own := range routes {
+				if route == own {
+					return fmt.Errorf("route %s of tenant %q is taken by tenant %q", own, t.ID, other.ID)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// SetStoredEvents records the count of each tenant's stored events
+func (r *Registry) SetStoredEvents(counts map[string]int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stored = counts
+}
+
+// StoredEvents returns the last count of the tenant's stored events
+func (r *Registry) StoredEvents(id string) int64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.stored[id]
+}
+
+// Get returns the tenant with id
+func (r *Registry) Get(id string) (config.TenantConfig, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.tenants[id]
+	return t, ok
+}
+
+// List returns every tenant, ordered by ID
+func (r *Registry) List() []config.TenantConfig {
+	r.mu.RLock()
+	tenants := make([]config.TenantConfig, 0, len(r.tenants))
+	for _, t := range r.tenants {
+		tenants = append(tenants, t)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].ID < tenants[j].ID })
+	return tenants
+}
+
+// Len returns the number of tenants
+func (r *Registry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.tenants)
+}
+
+// Resolve returns the tenant a request for host and path is routed to. A tenant
+// with a path matches that path with or without a trailing slash; one without
+// matches any path of its hosts. When several match, a path beats no path and
+// listed hosts beat any host.
+func (r *Registry) Resolve(host, path string) (config.TenantConfig, bool) {
+	host = normalizeHost(host)
+	path = strings.TrimSuffix(path, "/")
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var best config.TenantConfig
+	bestScore := -1
+	for _, t := range r.tenants {
+		score := 0
+		if t.Path != "" {
+			if strings.TrimSuffix(t.Path, "/") != path {
+				continue
+			}
+			score += 2
+		}
+		if len(t.Hosts) > 0 {
+			if !hasHost(t.Hosts, host) {
+				continue
+			}
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = t, score
+		}
+	}
+	return best, bestScore >= 0
+}
+
+// hasHost reports whether host is one of hosts
+func hasHost(hosts []string, host string) bool {
+	for _, h := range hosts {
+		if normalizeHost(h) == host {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeHost lowercases a Host header and drops its port and trailing dot
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
@@ -0,0 +1,240 @@
+// Package tor publishes the relay as a Tor onion service through tor's control
+// port. The published address is kept for the relay information document to
+// advertise.
+package tor
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DialTimeout bounds connecting to the control port
+	DialTimeout = 10 * time.Second
+	// VirtualPort is the port the onion service is reached on
+	VirtualPort = 80
+	// replyOK is the status of a successful control port reply
+	replyOK = 250
+)
+
+// address is the onion address the relay is published on, "" while unpublished
+var address atomic.Value
+
+// Address returns the onion address the relay is published on, e.g.
+// "abc...xyz.onion", or "" when it isn't
+func Address() string {
+	addr, _ := address.Load().(string)
+	return addr
+}
+
+// SetAddress records the onion address the relay is published on
+func SetAddress(addr string) {
+	address.Store(strings.ToLower(addr))
+}
+
+// Controller is a connection to tor's control port. Onion services added through
+// it last as long as the connection.
+type Controller struct {
+	conn *textproto.Conn
+}
+
+// Dial connects to the control port at addr
+func Dial(ctx context.Context, addr string) (*Controller, error) {
+	dialer := net.Dialer{Timeout: DialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to tor control port %s: %w", addr, err)
+	}
+	return &Controller{conn: textproto.NewConn(conn)}, nil
+}
+
+// Close closes the connection, which removes the onion services added through it
+func (c *Controller) Close() error {
+	return c.conn.Close()
+}
+
+// command sends line and returns the lines of a successful reply
+func (c *Controller) command(line string) ([]string, error) {
+	if err := c.conn.PrintfLine("%s", line); err != nil {
+		return nil, fmt.Errorf("failed to send tor command: %w", err)
+	}
+	_, message, err := c.conn.ReadResponse(replyOK)
+	if err != nil {
+		return nil, fmt.Errorf("tor command %s failed: %w", strings.Fields(line)[0], err)
+	}
+	return strings.Split(message, "\n"), nil
+}
+
+// Authenticate authenticates with password when set, otherwise with the
+// authentication cookie or without credentials, as the control port offers
+func (c *Controller) Authenticate(password string) error {
+	if password != "" {
+		_, err := c.command("AUTHENTICATE " + strconv.Quote(password))
+		return err
+	}
+
+	lines, err := c.command("PROTOCOLINFO 1")
+	if err != nil {
+		return err
+	}
+	var methods []string
+	cookieFile := ""
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "AUTH ") {
+			continue
+		}
+		for _, field := range strings.Fields(strings.TrimPrefix(line, "AUTH ")) {
+			key, value, _ := strings.Cut(field, "=")
+			switch key {
+			case "METHODS":
+				methods = strings.Split(value, ",")
+			case "COOKIEFILE":
+				if unquoted, err := strconv.Unquote(value); err == nil {
+					cookieFile = unquoted
+				}
+			}
+		}
+	}
+
+	switch {
+	case hasMethod(methods, "NULL"):
+		_, err = c.command("AUTHENTICATE")
+		return err
+	case hasMethod(methods, "COOKIE") && cookieFile != "":
+		cookie, err := os.ReadFile(cookieFile)
+		if err != nil {
+			return fmt.Errorf("failed to read tor authentication cookie: %w", err)
+		}
+		_, err = c.command("AUTHENTICATE " + hex.EncodeToString(cookie))
+		return err
+	default:
+		return fmt.Errorf("tor control port needs one of %s, set TOR.CONTROL_PASSWORD", strings.Join(methods, ", "))
+	}
+}
+
+// hasMethod reports whether method is one of methods
+func hasMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// AddOnion publishes an onion service forwarding VirtualPort to target. With key
+// empty tor creates a new ed25519 key, which is returned; otherwise the service
+// is published with key and "" is returned in its place.
+func (c *Controller) AddOnion(key, target string) (serviceID, newKey string, err error) {
+	target = localTarget(target)
+	line := fmt.Sprintf("ADD_ONION NEW:ED25519-V3 Port=%d,%s", VirtualPort, target)
+	if key != "" {
+		line = fmt.Sprintf("ADD_ONION %s Port=%d,%s", key, VirtualPort, target)
+	}
+	lines, err := c.command(line)
+	if err != nil {
+		return "", "", err
+	}
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "ServiceID="):
+			serviceID = strings.TrimPrefix(line, "ServiceID=")
+		case strings.HasPrefix(line, "PrivateKey="):
+			newKey = strings.TrimPrefix(line, "PrivateKey=")
+		}
+	}
+	if serviceID == "" {
+		return "", "", errors.New("tor didn't return the onion service ID")
+	}
+	return serviceID, newKey, nil
+}
+
+// localTarget returns addr with an empty host, as in ":8181", replaced by the
+// loopback address tor forwards to
+func localTarget(addr string) string {
+	if host, port, err := net.SplitHostPort(addr); err == nil && host == "" {
+		return net.JoinHostPort("127.0.0.1", port)
+	}
+	return addr
+}
+
+// Publish authenticates and publishes an onion service forwarding to target with
+// the key in keyFile, creating and saving a key when the file doesn't exist. It
+// returns the onion address; the service lasts until the controller is closed.
+func (c *Controller) Publish(password, keyFile, target string) (string, error) {
+	if err := c.Authenticate(password); err != nil {
+		return "", err
+	}
+
+	key, err := readKey(keyFile)
+	if err != nil {
+		return "", err
+	}
+	serviceID, newKey, err := c.AddOnion(key, target)
+	if err != nil {
+		return "", err
+	}
+	if newKey != "" && keyFile != "" {
+		if err := writeKey(keyFile, newKey); err != nil {
+			return "", err
+		}
+	}
+	return serviceID + ".onion", nil
+}
+
+// readKey returns the key saved in path, "" when there is none
+func readKey(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read onion service key: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// writeKey saves key to path, readable by the owner only
+func writeKey(path, key string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create onion service key directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(key+"\n"), 0o600); err != nil {
+		return fmt.Errorf("failed to save onion service key: %w", err)
+	}
+	return nil
+}
+
+// Wait blocks until ctx is done or tor closes the connection, which takes the
+// onion services added through it down
+func (c *Controller) Wait(ctx context.Context) error {
+	closed := make(chan error, 1)
+	go func() {
+		for {
+			if _, err := c.conn.ReadLine(); err != nil {
+				closed <- err
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-closed:
+		return fmt.Errorf("tor control connection closed: %w", err)
+	}
+}
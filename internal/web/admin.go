@@ -0,0 +1,98 @@
+package web
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Shugur-Network/relay/internal/config"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"go.uber.org/zap"
+)
+
+// MaxAdminBodySize limits the size of admin API request bodies
+const MaxAdminBodySize = 64 * 1024
+
+// AdminInputValidation returns input validation settings for admin API endpoints
+func AdminInputValidation() *InputValidation {
+	pathPatterns := []*regexp.Regexp{
+		regexp.MustCompile(`^/api/admin/[a-z0-9_-]+(/[a-zA-Z0-9_-]+)?$`),
+		// Suspending or resuming a virtual relay
+		regexp.MustCompile(`^/api/admin/tenants/[a-z0-9-]+/(suspend|resume)$`),
+		// Downloading a capture file
+		regexp.MustCompile(`^/api/admin/captures/[a-f0-9]+/file$`),
+	}
+
+	allowedQueryParams := map[string]bool{
+		"limit": true,
+		"since": true,
+		"until": true,
+	}
+
+	routeQueryParams := map[string]map[string]bool{
+		// Usage report range, pubkey and output format
+		"/api/admin/report": {"from": true, "to": true, "pubkey": true, "format": true},
+		// Decision log status filter
+		"/api/admin/decisions": {"status": true},
+		// Tenant usage range, tenant and output format
+		"/api/admin/tenant-usage": {"from": true, "to": true, "tenant": true, "format": true},
+		// Blocklist feed entry lookup
+		"/api/admin/blocklist-feeds": {"value": true},
+		// Session filters and sort counter
+		"/api/admin/sessions": {"ip": true, "pubkey": true, "active": true, "sort": true},
+	}
+
+	return &InputValidation{
+		MaxPathLength:      256,
+		MaxQueryLength:     1024,
+		MaxHeaderLength:    4096,
+		AllowedQueryParams: allowedQueryParams,
+		RouteQueryParams:   routeQueryParams,
+		PathPatterns:       pathPatterns,
+	}
+}
+
+// AdminAuthHandlerFunc rejects requests that don't carry the configured admin bearer token
+func AdminAuthHandlerFunc(cfg config.AdminConfig, handlerFunc http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !cfg.Enabled || cfg.Token == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Token)) != 1 {
+			logger.Warn("Admin API authentication failed",
+				zap.String("client_ip", r.RemoteAddr),
+				zap.String("path", r.URL.Path))
+			WriteAdminError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, MaxAdminBodySize)
+		handlerFunc(w, r)
+	})
+}
+
+// SecureAdminHandlerFunc combines security headers, input validation and token auth for admin handlers
+func SecureAdminHandlerFunc(cfg config.AdminConfig, handlerFunc http.HandlerFunc) http.HandlerFunc {
+	return SecurityHandlerFunc(APISecurityHeaders(),
+		ValidatedHandlerFunc(AdminInputValidation(), AdminAuthHandlerFunc(cfg, handlerFunc)))
+}
+
+// WriteAdminJSON writes a JSON response for admin endpoints
+func WriteAdminJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error("Failed to encode admin response", zap.Error(err))
+	}
+}
+
+// WriteAdminError writes a JSON error body for admin endpoints
+func WriteAdminError(w http.ResponseWriter, status int, message string) {
+	WriteAdminJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,37 @@
+package web
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminInputValidation(t *testing.T) {
+	iv := AdminInputValidation()
+
+	tests := []struct {
+		target string
+		valid  bool
+	}{
+		{"/api/admin/tenants", true},
+		{"/api/admin/tenants/community-a", true},
+		{"/api/admin/tenants/community-a/suspend", true},
+		{"/api/admin/tenants/community-a/resume", true},
+		{"/api/admin/tenants/community-a/delete", false},
+		{"/api/admin/captures/0123abcd/file", true},
+		{"/api/admin/captures/0123abcd/other", false},
+		{"/api/admin/report?from=2026-01-01&to=2026-02-01&pubkey=ab&format=csv", true},
+		{"/api/admin/decisions?status=rejected&limit=10", true},
+		{"/api/admin/tenant-usage?from=2026-01-01&to=2026-02-01&tenant=a&format=csv", true},
+		{"/api/admin/blocklist-feeds?value=example.com", true},
+		{"/api/admin/sessions?ip=192.0.2.1&pubkey=ab&active=true&sort=requests", true},
+		// Route parameters only apply to their route
+		{"/api/admin/sessions?status=rejected", false},
+		{"/api/admin/decisions?value=example.com", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.target, nil)
+		if err := iv.ValidateRequest(r); (err == nil) != tt.valid {
+			t.Errorf("ValidateRequest(%s) = %v, want valid %v", tt.target, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package web
+
+import (
+	"net/http"
+	"regexp"
+)
+
+// blossomPathPattern matches the Blossom media endpoints
+var blossomPathPattern = regexp.MustCompile(`^/([a-f0-9]{64}(\.[a-z0-9]{1,10})?|upload|list/[a-f0-9]{64})$`)
+
+// IsBlossomPath reports whether path is one of the Blossom media endpoints
+func IsBlossomPath(path string) bool {
+	return blossomPathPattern.MatchString(path)
+}
+
+// BlossomInputValidation returns input validation settings for Blossom endpoints.
+// Headers may carry a base64 authorization event, so they get a larger limit.
+func BlossomInputValidation() *InputValidation {
+	allowedQueryParams := map[string]bool{
+		"since": true, // List window start (unix seconds)
+		"until": true, // List window end (unix seconds)
+	}
+
+	return &InputValidation{
+		MaxPathLength:      256,
+		MaxQueryLength:     256,
+		MaxHeaderLength:    16384,
+		AllowedQueryParams: allowedQueryParams,
+		PathPatterns:       []*regexp.Regexp{blossomPathPattern},
+	}
+}
+
+// SecureBlossomHandlerFunc combines API security headers with Blossom input validation
+func SecureBlossomHandlerFunc(handlerFunc http.HandlerFunc) http.HandlerFunc {
+	return SecurityHandlerFunc(APISecurityHeaders(),
+		ValidatedHandlerFunc(BlossomInputValidation(), handlerFunc))
+}
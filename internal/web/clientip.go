@@ -0,0 +1,97 @@
+package web
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientIPs finds the address of the client behind a request. The X-Real-IP and
+// X-Forwarded-For headers are only believed when the request comes from one of
+// the trusted reverse proxies; anyone else could set them to any address.
+type ClientIPs struct {
+	trusted []netip.Prefix
+}
+
+// NewClientIPs parses the trusted proxies, CIDR ranges or single addresses,
+// IPv4 or IPv6
+func NewClientIPs(trustedProxies []string) (*ClientIPs, error) {
+	c := &ClientIPs{}
+	for _, entry := range trustedProxies {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+			}
+			addr = addr.Unmap()
+			c.trusted = append(c.trusted, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy range %q: %w", entry, err)
+		}
+		if p.Addr().Is4In6() && p.Bits() >= 96 {
+			p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+		}
+		c.trusted = append(c.trusted, p.Masked())
+	}
+	return c, nil
+}
+
+// ClientIP returns the client address of r: the peer address, or the address
+// the trusted proxy it came from forwarded
+func (c *ClientIPs) ClientIP(r *http.Request) string {
+	peer := PeerIP(r)
+	if !c.isTrusted(peer) {
+		return peer
+	}
+	if realIP, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return realIP.Unmap().String()
+	}
+	// The last hop not added by a trusted proxy is the client
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		if ip := hop.Unmap().String(); !c.isTrusted(ip) {
+			return ip
+		}
+	}
+	return peer
+}
+
+// isTrusted reports whether ip is one of the trusted proxies
+func (c *ClientIPs) isTrusted(ip string) bool {
+	if c == nil {
+		return false
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	for _, p := range c.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// PeerIP returns the address of the peer r came from, IPv4-mapped addresses as
+// IPv4
+func PeerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr.Unmap().String()
+	}
+	return host
+}
@@ -0,0 +1,57 @@
+package web
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	ips, err := NewClientIPs([]string{"10.0.0.0/8", "::ffff:192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		realIP     string
+		forwarded  string
+		want       string
+	}{
+		{"untrusted peer", "203.0.113.7:4000", "", "", "203.0.113.7"},
+		// Anyone else could claim any address to get past the IP deny list
+		{"untrusted peer spoofing X-Real-IP", "203.0.113.7:4000", "198.51.100.1", "", "203.0.113.7"},
+		{"untrusted peer spoofing X-Forwarded-For", "203.0.113.7:4000", "", "198.51.100.1", "203.0.113.7"},
+		{"trusted proxy X-Real-IP", "10.1.2.3:4000", "198.51.100.1", "", "198.51.100.1"},
+		{"trusted proxy X-Forwarded-For", "10.1.2.3:4000", "", "192.0.2.9, 198.51.100.1", "198.51.100.1"},
+		{"trusted hops skipped", "10.1.2.3:4000", "", "198.51.100.1, 10.4.4.4", "198.51.100.1"},
+		{"trusted proxy without headers", "10.1.2.3:4000", "", "", "10.1.2.3"},
+		{"unparsable hop", "10.1.2.3:4000", "", "garbage", "10.1.2.3"},
+		{"mapped trusted proxy", "[::ffff:192.168.1.1]:4000", "198.51.100.1", "", "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := ips.ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPWithoutTrustedProxies(t *testing.T) {
+	var ips *ClientIPs
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "203.0.113.7:4000"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	if got := ips.ClientIP(r); got != "203.0.113.7" {
+		t.Errorf("ClientIP = %s, want the peer address", got)
+	}
+}
@@ -0,0 +1,51 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Shugur-Network/relay/internal/config"
+)
+
+// CORSHandlerFunc wraps an http.HandlerFunc with the CORS headers of policy and
+// answers preflight requests without calling the handler
+func CORSHandlerFunc(policy config.CORSPolicy, handlerFunc http.HandlerFunc) http.HandlerFunc {
+	methods := strings.Join(policy.AllowedMethods, ", ")
+	headers := strings.Join(policy.AllowedHeaders, ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if origin := allowedOrigin(policy.AllowedOrigins, r.Header.Get("Origin")); origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if origin != "*" {
+				w.Header().Add("Vary", "Origin")
+			}
+			if methods != "" {
+				w.Header().Set("Access-Control-Allow-Methods", methods)
+			}
+			if headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+		}
+
+		// Preflight requests are answered here, disallowed origins get no CORS headers
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		handlerFunc(w, r)
+	})
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin value for origin, or ""
+// when it isn't allowed
+func allowedOrigin(allowed []string, origin string) string {
+	for _, o := range allowed {
+		if o == "*" {
+			return "*"
+		}
+		if origin != "" && strings.EqualFold(o, origin) {
+			return origin
+		}
+	}
+	return ""
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/Shugur-Network/relay/internal/errors"
 	"github.com/Shugur-Network/relay/internal/identity"
 	"github.com/Shugur-Network/relay/internal/metrics"
+	"github.com/Shugur-Network/relay/internal/selftest"
 	"github.com/Shugur-Network/relay/internal/storage"
 	"go.uber.org/zap"
 )
@@ -31,11 +32,13 @@ type DashboardData struct {
 	Host          string                        `json:"host"`
 	Pubkey        string                        `json:"pubkey"`
 	RelayID       string                        `json:"relay_id"`
+	Operator      *identity.OperatorStatus      `json:"operator,omitempty"`
 	SupportedNIPs []interface{}                 `json:"supported_nips"`
 	Limitation    *LimitationData               `json:"limitation"`
 	Stats         *StatsData                    `json:"stats"`
 	Uptime        string                        `json:"uptime"`
 	Cluster       *storage.CockroachClusterInfo `json:"cluster"`
+	SelfTest      *selftest.Report              `json:"selftest,omitempty"`
 }
 
 // LimitationData represents relay limitations
@@ -170,8 +173,6 @@ func (h *Handler) HandleStatsAPI(w http.ResponseWriter, r *http.Request) {
 	
 	// Set headers
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 
 	// Handle preflight requests
 	if r.Method == "OPTIONS" {
@@ -215,8 +216,6 @@ func (h *Handler) HandleMetricsAPI(w http.ResponseWriter, r *http.Request) {
 	
 	// Set headers
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 
 	// Handle preflight requests
 	if r.Method == "OPTIONS" {
@@ -301,6 +300,12 @@ func (h *Handler) getDashboardData(host string) *DashboardData {
 	// Get cluster information
 	clusterInfo := h.getClusterData()
 
+	// Only names and statuses of the self-test are public
+	var selfTest *selftest.Report
+	if report := selftest.Latest(); report != nil {
+		selfTest = report.Summary()
+	}
+
 	return &DashboardData{
 		Name:          metadata.Name,
 		Description:   metadata.Description,
@@ -311,6 +316,7 @@ func (h *Handler) getDashboardData(host string) *DashboardData {
 		Host:          host,
 		Pubkey:        metadata.PubKey,
 		RelayID:       relayID,
+		Operator:      identity.CurrentOperatorStatus(),
 		SupportedNIPs: metadata.SupportedNIPs,
 		Limitation: &LimitationData{
 			MaxMessageLength: metadata.Limitation.MaxMessageLength,
@@ -320,9 +326,10 @@ func (h *Handler) getDashboardData(host string) *DashboardData {
 			AuthRequired:     metadata.Limitation.AuthRequired,
 			PaymentRequired:  metadata.Limitation.PaymentRequired,
 		},
-		Stats:   h.getStatsData(),
-		Uptime:  h.formatUptime(time.Since(h.startTime)),
-		Cluster: clusterInfo,
+		Stats:    h.getStatsData(),
+		Uptime:   h.formatUptime(time.Since(h.startTime)),
+		Cluster:  clusterInfo,
+		SelfTest: selfTest,
 	}
 }
 
@@ -410,8 +417,6 @@ func (h *Handler) HandleClusterAPI(w http.ResponseWriter, r *http.Request) {
 	
 	// Set headers
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 
 	// Handle preflight requests
 	if r.Method == "OPTIONS" {
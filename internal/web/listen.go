@@ -0,0 +1,17 @@
+package web
+
+import (
+	"context"
+	"net"
+)
+
+// Listen opens a TCP listener on addr. With reusePort the port is bound with
+// SO_REUSEPORT, so a new relay process can start listening on it while the old
+// one drains its connections.
+func Listen(ctx context.Context, addr string, reusePort bool) (net.Listener, error) {
+	var lc net.ListenConfig
+	if reusePort {
+		lc.Control = reusePortControl
+	}
+	return lc.Listen(ctx, "tcp", addr)
+}
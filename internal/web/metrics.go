@@ -0,0 +1,114 @@
+package web
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/config"
+	"github.com/Shugur-Network/relay/internal/logger"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+// MetricsAuthHandlerFunc rejects scrape requests that don't carry the configured
+// metrics bearer token. An empty token leaves the endpoint open.
+func MetricsAuthHandlerFunc(token string, handlerFunc http.HandlerFunc) http.HandlerFunc {
+	if token == "" {
+		return handlerFunc
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			logger.Warn("Metrics authentication failed", zap.String("client_ip", r.RemoteAddr))
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handlerFunc(w, r)
+	})
+}
+
+// metricsTLSConfig builds the TLS config of the metrics listener, requiring client
+// certificates signed by cfg.ClientCA when it is set
+func metricsTLSConfig(cfg config.MetricsConfig) (*tls.Config, error) {
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.ClientCA == "" {
+		return tlsCfg, nil
+	}
+
+	pem, err := os.ReadFile(cfg.ClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metrics client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in metrics client CA %s", cfg.ClientCA)
+	}
+	tlsCfg.ClientCAs = pool
+	tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	return tlsCfg, nil
+}
+
+// ServeMetrics serves the Prometheus endpoint at /metrics on its own listener until
+// ctx is canceled, so operator metrics stay off the public WebSocket port. With
+// reusePort the port is shared with a new relay process during an upgrade.
+func ServeMetrics(ctx context.Context, cfg config.MetricsConfig, reusePort bool) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", MetricsAuthHandlerFunc(cfg.AuthToken, promhttp.Handler().ServeHTTP))
+
+	addr := net.JoinHostPort(cfg.Address, strconv.Itoa(cfg.Port))
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	ln, err := Listen(ctx, addr, reusePort)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(cfg.Address); (ip == nil || !ip.IsLoopback()) && cfg.Address != "localhost" && cfg.AuthToken == "" && cfg.ClientCA == "" {
+		logger.Warn("Metrics are served without authentication beyond localhost; set METRICS.AUTH_TOKEN or METRICS.CLIENT_CA",
+			zap.String("address", addr))
+	}
+	if cfg.TLSCert != "" {
+		if srv.TLSConfig, err = metricsTLSConfig(cfg); err != nil {
+			_ = ln.Close()
+			return err
+		}
+		logger.Info("Metrics server listening",
+			zap.String("address", addr),
+			zap.Bool("tls", true),
+			zap.Bool("client_certs", cfg.ClientCA != ""),
+			zap.Bool("token_auth", cfg.AuthToken != ""))
+		err = srv.ServeTLS(ln, cfg.TLSCert, cfg.TLSKey)
+	} else {
+		logger.Info("Metrics server listening",
+			zap.String("address", addr),
+			zap.Bool("token_auth", cfg.AuthToken != ""))
+		err = srv.Serve(ln)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
@@ -155,6 +155,8 @@ type InputValidation struct {
 	MaxHeaderLength int
 	// AllowedQueryParams whitelist of allowed query parameter names
 	AllowedQueryParams map[string]bool
+	// RouteQueryParams whitelists further query parameters on specific paths
+	RouteQueryParams map[string]map[string]bool
 	// PathPatterns allowed path patterns (regex)
 	PathPatterns []*regexp.Regexp
 }
@@ -193,16 +195,38 @@ func APIInputValidation() *InputValidation {
 		regexp.MustCompile(`^/api/stats$`),
 		regexp.MustCompile(`^/api/metrics$`),
 		regexp.MustCompile(`^/api/cluster$`),
+		regexp.MustCompile(`^/api/attestations/[a-f0-9]{64}$`),
+		regexp.MustCompile(`^/api/capsules/[a-f0-9]{64}/shares$`),
+		regexp.MustCompile(`^/api/capsules/upcoming$`),
+		regexp.MustCompile(`^/api/payments/invoice$`),
+		regexp.MustCompile(`^/api/payments/invoice/[a-f0-9]{64}$`),
+		regexp.MustCompile(`^/api/payments/webhook$`),
+		regexp.MustCompile(`^/api/payments/ledger/[a-f0-9]{64}$`),
+		regexp.MustCompile(`^/api/payments/cashu$`),
+		regexp.MustCompile(`^/api/invites/redeem$`),
+		regexp.MustCompile(`^/api/zaps$`),
+		regexp.MustCompile(`^/subscribe$`),
+		regexp.MustCompile(`^/\.well-known/nostr\.json$`),
+		regexp.MustCompile(`^/\.well-known/security\.txt$`),
+		regexp.MustCompile(`^/\.well-known/lnurlp/[a-zA-Z0-9._-]{1,64}$`),
 	}
 
 	allowedQueryParams := map[string]bool{
-		"type": true, // Only type parameter allowed for APIs
+		"type":   true, // Cluster API type parameter
+		"since":  true, // Capsule schedule window start (unix seconds)
+		"until":  true, // Capsule schedule window end (unix seconds)
+		"limit":  true, // Capsule schedule page size
+		"filter": true, // SSE subscription filter (JSON)
+		"name":   true, // NIP-05 name lookup in nostr.json
+		"p":      true, // Zap totals of a pubkey
+		"e":      true, // Zap totals of an event
+		"a":      true, // Zap totals of an addressable event
 	}
 
 	return &InputValidation{
-		MaxPathLength:      1024, // Shorter path limit for APIs
-		MaxQueryLength:     1024, // Shorter query limit for APIs
-		MaxHeaderLength:    4096, // Shorter header limit for APIs
+		MaxPathLength:      1024,  // Shorter path limit for APIs
+		MaxQueryLength:     16384, // Room for URL-encoded SSE filters
+		MaxHeaderLength:    4096,  // Shorter header limit for APIs
 		AllowedQueryParams: allowedQueryParams,
 		PathPatterns:       pathPatterns,
 	}
@@ -251,7 +275,7 @@ func (iv *InputValidation) ValidateRequest(r *http.Request) error {
 	if len(iv.AllowedQueryParams) > 0 {
 		queryValues := r.URL.Query()
 		for param := range queryValues {
-			if !iv.AllowedQueryParams[param] {
+			if !iv.AllowedQueryParams[param] && !iv.RouteQueryParams[r.URL.Path][param] {
 				return &ValidationError{
 					Type:    "invalid_query_param",
 					Message: "Invalid query parameter",
@@ -0,0 +1,147 @@
+package web
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Shugur-Network/relay/internal/config"
+	"github.com/Shugur-Network/relay/internal/metrics"
+	"golang.org/x/time/rate"
+)
+
+// httpVisitorIdle is how long an IP's limiter state is kept after its last request
+const httpVisitorIdle = 10 * time.Minute
+
+// httpVisitor holds the limiter state of one client IP
+type httpVisitor struct {
+	limiter  *rate.Limiter
+	inFlight int
+	lastSeen time.Time
+}
+
+// HTTPLimiter applies per-IP token buckets and concurrency caps to HTTP handlers
+type HTTPLimiter struct {
+	cfg       config.HTTPLimitConfig
+	clientIPs *ClientIPs
+	slots     chan struct{}
+	visitors  map[string]*httpVisitor
+	lastPrune time.Time
+	mutex     sync.Mutex
+}
+
+// NewHTTPLimiter creates an HTTP limiter from config, telling clients apart by
+// the addresses clientIPs finds. A disabled config yields a limiter whose
+// handlers pass every request through.
+func NewHTTPLimiter(cfg config.HTTPLimitConfig, clientIPs *ClientIPs) *HTTPLimiter {
+	l := &HTTPLimiter{
+		cfg:       cfg,
+		clientIPs: clientIPs,
+		visitors:  make(map[string]*httpVisitor),
+		lastPrune: time.Now(),
+	}
+	if cfg.MaxConcurrent > 0 {
+		l.slots = make(chan struct{}, cfg.MaxConcurrent)
+	}
+	return l
+}
+
+// HandlerFunc wraps an http.HandlerFunc with the per-IP rate limit and the
+// concurrency caps, answering 429 when either is exceeded
+func (l *HTTPLimiter) HandlerFunc(group string, handlerFunc http.HandlerFunc) http.HandlerFunc {
+	return l.wrap(group, true, handlerFunc)
+}
+
+// RateHandlerFunc wraps a long-lived streaming handler with the per-IP rate limit
+// only, so open streams don't hold the concurrency slots of short requests
+func (l *HTTPLimiter) RateHandlerFunc(group string, handlerFunc http.HandlerFunc) http.HandlerFunc {
+	return l.wrap(group, false, handlerFunc)
+}
+
+func (l *HTTPLimiter) wrap(group string, capConcurrency bool, handlerFunc http.HandlerFunc) http.HandlerFunc {
+	if l == nil || !l.cfg.Enabled {
+		return handlerFunc
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := l.clientIPs.ClientIP(r)
+		if reason := l.acquire(ip, capConcurrency); reason != "" {
+			metrics.HTTPRequestsLimited.WithLabelValues(group, reason).Inc()
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		if capConcurrency {
+			defer l.release(ip)
+		}
+		handlerFunc(w, r)
+	})
+}
+
+// acquire takes a token and, when capConcurrency is set, a concurrency slot for ip.
+// It returns the rejection reason, or "" when the request may proceed.
+func (l *HTTPLimiter) acquire(ip string, capConcurrency bool) string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	l.pruneLocked(now)
+
+	v, ok := l.visitors[ip]
+	if !ok {
+		limit := rate.Inf
+		if l.cfg.RequestsPerSecond > 0 {
+			limit = rate.Limit(l.cfg.RequestsPerSecond)
+		}
+		v = &httpVisitor{limiter: rate.NewLimiter(limit, l.cfg.BurstSize)}
+		l.visitors[ip] = v
+	}
+	v.lastSeen = now
+
+	if !v.limiter.AllowN(now, 1) {
+		return "rate"
+	}
+	if !capConcurrency {
+		return ""
+	}
+	if l.cfg.MaxConcurrentPerIP > 0 && v.inFlight >= l.cfg.MaxConcurrentPerIP {
+		return "ip_concurrency"
+	}
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			return "concurrency"
+		}
+	}
+	v.inFlight++
+	metrics.HTTPRequestsInFlight.Inc()
+	return ""
+}
+
+// release returns the concurrency slot taken by acquire
+func (l *HTTPLimiter) release(ip string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if v, ok := l.visitors[ip]; ok && v.inFlight > 0 {
+		v.inFlight--
+	}
+	if l.slots != nil {
+		<-l.slots
+	}
+	metrics.HTTPRequestsInFlight.Dec()
+}
+
+// pruneLocked drops idle visitors at most once per idle period. Caller holds the mutex.
+func (l *HTTPLimiter) pruneLocked(now time.Time) {
+	if now.Sub(l.lastPrune) < httpVisitorIdle {
+		return
+	}
+	l.lastPrune = now
+	for ip, v := range l.visitors {
+		if v.inFlight == 0 && now.Sub(v.lastSeen) > httpVisitorIdle {
+			delete(l.visitors, ip)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package web
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+)
+
+// reusePortControl fails where SO_REUSEPORT isn't available
+func reusePortControl(_, _ string, _ syscall.RawConn) error {
+	return fmt.Errorf("RELAY.REUSE_PORT is not supported on %s", runtime.GOOS)
+}